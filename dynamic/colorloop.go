@@ -0,0 +1,170 @@
+package dynamic
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/tasks"
+	"strconv"
+	"time"
+)
+
+const (
+	// Name of the colors parameter
+	ColorsParamName = "Colors"
+
+	// Name of the dwell time parameter. Dwell time is in seconds.
+	DwellParamName = "DwellSecs"
+
+	// Name of the transition time parameter. Transition time is in seconds.
+	TransitionParamName = "TransSecs"
+)
+
+// ColorLoopFactory implements Factory and lets user provide a list of
+// colors, a brightness, a dwell time, and a transition time. It generates
+// an ops.HueAction that cycles the lights through the colors until
+// interrupted. The lights stay at each color for the dwell time and take
+// the transition time to change from one color to the next.
+type ColorLoopFactory struct {
+}
+
+func (f ColorLoopFactory) Params() NamedParamList {
+	return kColorLoopParams
+}
+
+func (f ColorLoopFactory) New(values []interface{}) ops.HueAction {
+	choices := values[0].([]interface{})
+	colors := make([]gohue.Color, len(choices))
+	for i := range choices {
+		colors[i] = choices[i].(gohue.Color)
+	}
+	return &ColorLoopAction{
+		Colors:     colors,
+		Brightness: uint8(values[1].(int)),
+		Dwell:      time.Duration(values[2].(int)) * time.Second,
+		Transition: time.Duration(values[3].(int)) * time.Second,
+	}
+}
+
+// colors are the colors to cycle through; colorsString is the string
+// representation of colors; brightness is the brightness of the lights;
+// dwell and transition are the dwell and transition times rounded down to
+// the nearest second.
+func (f ColorLoopFactory) NewExplicit(
+	colors []gohue.Color,
+	colorsString string,
+	brightness uint8,
+	dwell time.Duration,
+	transition time.Duration) (
+	action ops.HueAction, paramsAsStrings []string) {
+	dwellSecs := int(dwell / time.Second)
+	transitionSecs := int(transition / time.Second)
+	action = &ColorLoopAction{
+		Colors:     colors,
+		Brightness: brightness,
+		Dwell:      time.Duration(dwellSecs) * time.Second,
+		Transition: time.Duration(transitionSecs) * time.Second,
+	}
+	paramsAsStrings = []string{
+		colorsString,
+		strconv.Itoa(int(brightness)),
+		strconv.Itoa(dwellSecs),
+		strconv.Itoa(transitionSecs),
+	}
+	return
+}
+
+// Encode encodes a HueAction that this instance created as a string
+func (f ColorLoopFactory) Encode(action ops.HueAction) string {
+	c := action.(*ColorLoopAction)
+	serializer := make(ParamSerializer)
+	serializer.SetColors(ColorsParamName, c.Colors)
+	serializer.SetBrightness(BrightnessParamName, c.Brightness)
+	serializer.SetInt(DwellParamName, int(c.Dwell/time.Second))
+	serializer.SetInt(TransitionParamName, int(c.Transition/time.Second))
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+func (f ColorLoopFactory) Decode(s string) (action ops.HueAction, err error) {
+	serializer, err := NewParamSerializer(s)
+	if err != nil {
+		return
+	}
+	var result ColorLoopAction
+	if result.Colors, err = serializer.GetColors(ColorsParamName); err != nil {
+		return
+	}
+	if len(result.Colors) == 0 {
+		err = errBadValue
+		return
+	}
+	if result.Brightness, err = serializer.GetBrightness(
+		BrightnessParamName); err != nil {
+		return
+	}
+	dwellSecs, err := serializer.GetInt(DwellParamName)
+	if err != nil {
+		return
+	}
+	transitionSecs, err := serializer.GetInt(TransitionParamName)
+	if err != nil {
+		return
+	}
+	if dwellSecs < 0 || transitionSecs < 0 {
+		err = errBadValue
+		return
+	}
+	result.Dwell = time.Duration(dwellSecs) * time.Second
+	result.Transition = time.Duration(transitionSecs) * time.Second
+	action = &result
+	return
+}
+
+// ColorLoopAction is the ops.HueAction that ColorLoopFactory generates.
+// These instances must be treated as immutable.
+type ColorLoopAction struct {
+	Colors     []gohue.Color
+	Brightness uint8
+	Dwell      time.Duration
+	Transition time.Duration
+}
+
+func (c *ColorLoopAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	ops.ColorLoopAction(c.Colors, c.Brightness, c.Dwell, c.Transition).Do(
+		ctxt, lightSet, e)
+}
+
+func (c *ColorLoopAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+var (
+	kColorLoopParams = NamedParamList{
+		{
+			Name: ColorsParamName,
+			Param: MultiPicker(
+				kColorChoices,
+				[]interface{}{gohue.Red, gohue.Green, gohue.Blue},
+				"Red,Green,Blue"),
+		},
+		{
+			Name:  BrightnessParamName,
+			Param: Brightness(),
+			Help:  kBrightnessHelp,
+		},
+		{
+			Name:  DwellParamName,
+			Param: Int(0, 3600, 10, 4),
+			Unit:  "seconds",
+			Group: "Timing",
+		},
+		{
+			Name:  TransitionParamName,
+			Param: Int(0, 3600, 2, 4),
+			Unit:  "seconds",
+			Group: "Timing",
+		},
+	}
+)
@@ -0,0 +1,60 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/dynamic/testutils"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestColorLoopFactoryNewExplicit(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          110,
+		Description: "Loop",
+		Factory:     dynamic.ColorLoopFactory{},
+	}
+	actual := aTask.FromExplicit(
+		aTask.Factory.(dynamic.ColorLoopFactory).NewExplicit(
+			[]gohue.Color{gohue.Red, gohue.Yellow},
+			"Red,Yellow",
+			150,
+			30*time.Second,
+			5*time.Second))
+	expectedDescription := "Loop Colors: Red,Yellow Bri: 150 DwellSecs: 30 TransSecs: 5"
+	if actual.Description != expectedDescription {
+		t.Errorf("Expected %s, got %s", expectedDescription, actual.Description)
+	}
+	testutils.VerifySerialization(t, aTask.Factory, actual.HueAction)
+}
+
+func TestColorLoopFactoryFromUrlValues(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          110,
+		Description: "Loop",
+		Factory:     dynamic.ColorLoopFactory{},
+	}
+	urlValues := make(url.Values)
+	// Blue then Red
+	urlValues.Add("p0", "3")
+	urlValues.Add("p0", "1")
+	urlValues.Set("p1", "100")
+	urlValues.Set("p2", "20")
+	urlValues.Set("p3", "4")
+	actual := aTask.FromUrlValues("p", urlValues)
+	expectedDescription := "Loop Colors: Blue,Red Bri: 100 DwellSecs: 20 TransSecs: 4"
+	if actual.Description != expectedDescription {
+		t.Errorf("Expected %s, got %s", expectedDescription, actual.Description)
+	}
+	expectedAction := &dynamic.ColorLoopAction{
+		Colors:     []gohue.Color{gohue.Blue, gohue.Red},
+		Brightness: 100,
+		Dwell:      20 * time.Second,
+		Transition: 4 * time.Second,
+	}
+	if !reflect.DeepEqual(expectedAction, actual.HueAction) {
+		t.Errorf("Expected %v, got %v", expectedAction, actual.HueAction)
+	}
+}
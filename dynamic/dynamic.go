@@ -7,12 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
 	"github.com/keep94/marvin/ops"
 	"github.com/keep94/maybe"
+	"math/rand"
 	"net/url"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	kBrightnessHelp = "0 to 255"
+	kSurpriseMe     = "Surprise me"
 )
 
 const (
@@ -27,6 +35,16 @@ var (
 	// Reported if no value exists for a key in ParamSerializer
 	ErrNoValue = errors.New("dynamic: No value.")
 
+	// Reported by StrictParam.ConvertStrict if the value is not a number.
+	ErrNotANumber = errors.New("dynamic: Not a number.")
+
+	// Reported by StrictParam.ConvertStrict if the value is out of range.
+	ErrOutOfRange = errors.New("dynamic: Value out of range.")
+
+	// Reported by StrictParam.ConvertStrict if the value does not
+	// correspond to a choice.
+	ErrNoSuchChoice = errors.New("dynamic: No such choice.")
+
 	errBadValue = errors.New("dynamic: Bad value.")
 )
 
@@ -51,6 +69,60 @@ type Param interface {
 	Convert(s string) (interface{}, string)
 }
 
+// StrictParam is a Param that can report why a user supplied value
+// was rejected instead of silently substituting the default value.
+// The Params that Int and Picker return implement StrictParam.
+type StrictParam interface {
+	Param
+
+	// ConvertStrict works like Convert except that it returns an error
+	// if s is not a valid value. An empty s is always valid and
+	// converts to the default value.
+	ConvertStrict(s string) (interface{}, string, error)
+}
+
+// ConvertStrict converts s using p.ConvertStrict if p implements
+// StrictParam. Otherwise ConvertStrict falls back to p.Convert and never
+// returns an error.
+func ConvertStrict(p Param, s string) (interface{}, string, error) {
+	if sp, ok := p.(StrictParam); ok {
+		return sp.ConvertStrict(s)
+	}
+	value, str := p.Convert(s)
+	return value, str, nil
+}
+
+// ParamError reports a user supplied value that a Param rejected.
+type ParamError struct {
+
+	// The zero based index of the parameter
+	Index int
+
+	// The name of the parameter
+	Name string
+
+	// The value the user supplied
+	Value string
+
+	// What was wrong with the value e.g ErrOutOfRange
+	Err error
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("%s: %q: %v", e.Name, e.Value, e.Err)
+}
+
+// ParamErrors reports all the parameters that a user got wrong.
+type ParamErrors []*ParamError
+
+func (e ParamErrors) Error() string {
+	parts := make([]string, len(e))
+	for i := range e {
+		parts[i] = e[i].Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
 // Choice represents a single choice in a choice dialog.
 type Choice struct {
 
@@ -78,6 +150,112 @@ func Picker(
 	}
 }
 
+// MultiPicker returns a Param that is presented as a choice dialog
+// allowing the user to select more than one choice. The returned Param
+// implements MultiSelectParam. Its value is a []interface{} containing the
+// Value field of each selected choice in the order selected. choices are
+// the choices the user will see excluding the "Select one" choice;
+// defaultValue is the value of the returned Param if user does not select
+// any choices; defaultName is the description of the default value to use
+// in generated ops.HueTask descriptions.
+func MultiPicker(
+	choices ChoiceList, defaultValue []interface{}, defaultName string) Param {
+	return &multiPicker{
+		picker: picker{
+			Choices:      choices,
+			DefaultValue: defaultValue,
+			DefaultName:  defaultName,
+		},
+	}
+}
+
+// PickerWithRandom works like Picker except that the choice dialog has an
+// additional "Surprise me" option after the last choice. When the user
+// selects "Surprise me," Convert picks one of the choices at random and
+// returns its value and name so that the description of the generated
+// ops.HueTask shows the choice made.
+func PickerWithRandom(
+	choices ChoiceList, defaultValue interface{}, defaultName string) Param {
+	return &randomPicker{
+		picker: picker{
+			Choices:      choices,
+			DefaultValue: defaultValue,
+			DefaultName:  defaultName,
+		},
+	}
+}
+
+// MultiSelectParam is a Param that accepts multiple selections.
+// The Convert method of a MultiSelectParam accepts the ordinal values of
+// the selected options separated by commas. HueTask.FromUrlValues joins
+// all the url values for a MultiSelectParam with commas before calling
+// Convert.
+type MultiSelectParam interface {
+	Param
+
+	// IsMultiSelect returns true if the choice dialog should allow
+	// multiple selections.
+	IsMultiSelect() bool
+}
+
+// ChoiceGroup represents a named group of choices in a choice dialog.
+type ChoiceGroup struct {
+
+	// The label of the group e.g "Warm"
+	Name string
+
+	// The choices in the group
+	Choices ChoiceList
+}
+
+// GroupedPicker works like Picker except that the choices are divided
+// into groups. The returned Param implements GroupedParam. Its Selection
+// and Convert methods work as if the choices of all the groups were in
+// one flat ChoiceList so that ordinal values remain the same whether or
+// not the caller renders the groups.
+func GroupedPicker(
+	groups []ChoiceGroup, defaultValue interface{}, defaultName string) Param {
+	result := &groupedPicker{
+		picker: picker{
+			DefaultValue: defaultValue,
+			DefaultName:  defaultName,
+		},
+	}
+	for _, group := range groups {
+		selectionGroup := SelectionGroup{Name: group.Name}
+		for _, choice := range group.Choices {
+			result.Choices = append(result.Choices, choice)
+			selectionGroup.Indexes = append(
+				selectionGroup.Indexes, len(result.Choices))
+		}
+		result.groups = append(result.groups, selectionGroup)
+	}
+	return result
+}
+
+// SelectionGroup represents a group of options in a choice dialog.
+type SelectionGroup struct {
+
+	// The label of the group
+	Name string
+
+	// The positions of the options in this group within the slice that
+	// Selection returns. These positions are also the ordinal values of
+	// the options. Positions are in ascending order.
+	Indexes []int
+}
+
+// GroupedParam is a Param whose options are divided into groups such as
+// for rendering with <optgroup>. The first option that Selection returns,
+// the one similar to "Select one," is never in a group.
+type GroupedParam interface {
+	Param
+
+	// SelectionGroups returns the groups of options in the order they
+	// should appear.
+	SelectionGroups() []SelectionGroup
+}
+
 // Int returns an Param that is presented as a text field and has an
 // integer value. minValue and maxValue the minimum and maximum value
 // inclusive of the integer; defaultValue is the default value if user
@@ -93,9 +271,53 @@ func Int(
 	}
 }
 
+// Slider works like Int except that the returned Param hints that it
+// should be presented as a range slider moving in increments of step.
+// The size of the text field to use when a slider is not possible is
+// the length of the longer of minValue and maxValue.
+func Slider(minValue, maxValue, defaultValue, step int) Param {
+	maxChars := len(strconv.Itoa(maxValue))
+	if minChars := len(strconv.Itoa(minValue)); minChars > maxChars {
+		maxChars = minChars
+	}
+	return &intParam{
+		MinValue:     minValue,
+		MaxValue:     maxValue,
+		DefaultValue: defaultValue,
+		MaxChars:     maxChars,
+		Step:         step,
+		PreferSlider: true,
+	}
+}
+
+// RangeHints tells user input forms how to render a numeric parameter.
+type RangeHints struct {
+
+	// The minimum and maximum values inclusive
+	Min int
+	Max int
+
+	// The increment between valid values
+	Step int
+
+	// True if the parameter should be rendered as a range slider rather
+	// than as a text field.
+	PreferSlider bool
+}
+
+// RangeParam is a numeric Param that provides hints for rendering it.
+// The Params that Int and Slider return implement RangeParam. These
+// hints do not affect how Convert works.
+type RangeParam interface {
+	Param
+
+	// RangeHints returns the rendering hints.
+	RangeHints() RangeHints
+}
+
 // Brightness is a convenience rourtine that returns an integer parameter
 // representing brightness which is (0-255) with default of 255 and size
-// of 3 chars.
+// of 3 chars. The returned Param prefers to be presented as a slider.
 func Brightness() Param {
 	return kBrightness
 }
@@ -114,11 +336,65 @@ type NamedParam struct {
 	// generated ops.HueTask.
 	Name string
 	Param
+
+	// The name of the section of the user input form in which this
+	// parameter appears. Empty means the default section.
+	Group string
+
+	// Optional help text that appears next to the input field on user
+	// input forms e.g "0 to 255".
+	Help string
+
+	// Optional unit of the parameter's value that appears next to the
+	// input field on user input forms e.g "seconds".
+	Unit string
 }
 
 // NamedParamList represents an immutable list of NamedParam
 type NamedParamList []NamedParam
 
+// Grouped returns a copy of params with the Group field of each
+// parameter set to group.
+func Grouped(group string, params ...NamedParam) NamedParamList {
+	result := make(NamedParamList, len(params))
+	copy(result, params)
+	for i := range result {
+		result[i].Group = group
+	}
+	return result
+}
+
+// ParamGroup represents a section of parameters on a user input form.
+type ParamGroup struct {
+
+	// The name of the section. Empty for the default section.
+	Name string
+
+	// The zero based positions of the parameters in this section
+	// in the enclosing NamedParamList. The position of a parameter
+	// determines the key of its url value. Positions are in ascending
+	// order.
+	Indexes []int
+}
+
+// Groups returns the sections of this instance. Sections appear in the
+// order their first parameter appears in this instance. Callers can
+// render the sections in the order returned.
+func (l NamedParamList) Groups() []ParamGroup {
+	var result []ParamGroup
+	groupIdxs := make(map[string]int)
+	for i := range l {
+		idx, ok := groupIdxs[l[i].Group]
+		if !ok {
+			idx = len(result)
+			groupIdxs[l[i].Group] = idx
+			result = append(result, ParamGroup{Name: l[i].Group})
+		}
+		result[idx].Indexes = append(result[idx].Indexes, i)
+	}
+	return result
+}
+
 // Factory generates an ops.HueAction from a list of user inputs.
 // Specific implementations also provide a NewExplicit mehod that takes
 // explicitly typed parameters and returns a new ops.HueAction and the
@@ -133,6 +409,17 @@ type Factory interface {
 	New(values []interface{}) ops.HueAction
 }
 
+// Describer is implemented by Factory instances that summarise the values
+// a user supplied better than the default "Name: value Name: value"
+// description.
+type Describer interface {
+
+	// Describe returns the summary of values to appear after the
+	// description of the HueTask in generated ops.HueTask descriptions.
+	// values are the same values passed to New.
+	Describe(values []interface{}) string
+}
+
 // Encoder converts a specific type of hue action to a string.
 type Encoder interface {
 	Encode(action ops.HueAction) string
@@ -168,6 +455,23 @@ type HueTask struct {
 
 	// Helps to generate the ops.HueTask
 	Factory
+
+	// Optional category e.g "Notifications" for navigating long lists
+	// of tasks. Empty means uncategorized.
+	Category string
+
+	// Optional tags e.g "party" for filtering long lists of tasks.
+	Tags []string
+}
+
+// HasTag returns true if this instance has given tag.
+func (h *HueTask) HasTag(tag string) bool {
+	for _, t := range h.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
 // FromOpsHueTask is a convenience routine that converts an
@@ -183,11 +487,25 @@ func FromOpsHueTask(h *ops.HueTask) *HueTask {
 // FromExplicit creates an ops.HueTask from this instance.
 // Callers must call NewExplcit on this instance's Factory field and pass
 // the return values to this method.
+// Since FromExplicit has no values to pass to a Describer, it always
+// generates the default description.
 func (h *HueTask) FromExplicit(
 	action ops.HueAction, paramsAsStrings []string) *ops.HueTask {
+	return h.fromValues(h.Params(), action, nil, paramsAsStrings)
+}
+
+// fromValues creates an ops.HueTask. params are the parameters the
+// values came from. Callers fetch params once per request since they can
+// change between calls to Params, such as the stored scenes of a
+// SceneFactory.
+func (h *HueTask) fromValues(
+	params NamedParamList,
+	action ops.HueAction,
+	values []interface{},
+	paramsAsStrings []string) *ops.HueTask {
 	return &ops.HueTask{
 		Id:          h.Id,
-		Description: h.getDescription(paramsAsStrings),
+		Description: h.getDescription(params, values, paramsAsStrings),
 		HueAction:   action,
 	}
 }
@@ -204,16 +522,87 @@ func (h *HueTask) FromUrlValues(prefix string, values url.Values) *ops.HueTask {
 	paramNames := make([]string, len(params))
 	for i := range params {
 		paramValues[i], paramNames[i] = params[i].Convert(
-			values.Get(fmt.Sprintf("%s%d", prefix, i)))
+			urlValue(params[i].Param, prefix, i, values))
+	}
+	return h.fromValues(params, h.New(paramValues), paramValues, paramNames)
+}
+
+// FromUrlValuesStrict works like FromUrlValues except that it validates
+// each user supplied value with ConvertStrict. If any value is invalid,
+// FromUrlValuesStrict returns nil along with a ParamErrors describing
+// each invalid value.
+func (h *HueTask) FromUrlValuesStrict(
+	prefix string, values url.Values) (*ops.HueTask, error) {
+	result, errs := h.fromUrlValuesStrict(prefix, values)
+	if errs != nil {
+		return nil, errs
 	}
-	return h.FromExplicit(h.New(paramValues), paramNames)
+	return result, nil
 }
 
-func (h *HueTask) getDescription(names []string) string {
+// FieldErrors maps the key of each invalid url value, e.g "p1", to what
+// was wrong with it.
+type FieldErrors map[string]*ParamError
+
+// TryFromUrlValues works like FromUrlValuesStrict except that it reports
+// invalid values as FieldErrors so that handlers can redisplay the html
+// form with a message next to each invalid field. If all values are
+// valid, TryFromUrlValues returns nil FieldErrors.
+func (h *HueTask) TryFromUrlValues(
+	prefix string, values url.Values) (*ops.HueTask, FieldErrors) {
+	result, errs := h.fromUrlValuesStrict(prefix, values)
+	if errs == nil {
+		return result, nil
+	}
+	fieldErrs := make(FieldErrors, len(errs))
+	for _, err := range errs {
+		fieldErrs[urlKey(prefix, err.Index)] = err
+	}
+	return nil, fieldErrs
+}
+
+func (h *HueTask) fromUrlValuesStrict(
+	prefix string, values url.Values) (*ops.HueTask, ParamErrors) {
 	params := h.Params()
+	paramValues := make([]interface{}, len(params))
+	paramNames := make([]string, len(params))
+	var errs ParamErrors
+	for i := range params {
+		s := urlValue(params[i].Param, prefix, i, values)
+		var err error
+		paramValues[i], paramNames[i], err = ConvertStrict(params[i].Param, s)
+		if err != nil {
+			errs = append(errs, &ParamError{
+				Index: i, Name: params[i].Name, Value: s, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return h.fromValues(
+		params, h.New(paramValues), paramValues, paramNames), nil
+}
+
+func urlKey(prefix string, idx int) string {
+	return fmt.Sprintf("%s%d", prefix, idx)
+}
+
+func urlValue(param Param, prefix string, idx int, values url.Values) string {
+	key := urlKey(prefix, idx)
+	if multi, ok := param.(MultiSelectParam); ok && multi.IsMultiSelect() {
+		return strings.Join(values[key], ",")
+	}
+	return values.Get(key)
+}
+
+func (h *HueTask) getDescription(
+	params NamedParamList, values []interface{}, names []string) string {
 	if len(params) == 0 {
 		return h.Description
 	}
+	if describer, ok := h.Factory.(Describer); ok && values != nil {
+		return fmt.Sprintf("%s %s", h.Description, describer.Describe(values))
+	}
 	parts := make([]string, len(params))
 	for i := range parts {
 		parts[i] = fmt.Sprintf("%s: %s", params[i].Name, names[i])
@@ -253,6 +642,55 @@ func (l HueTaskList) SortByDescriptionIgnoreCase() HueTaskList {
 	return result
 }
 
+// FilterByTag returns a new HueTaskList with only the HueTasks in this
+// instance that have given tag. The HueTasks in the returned list are in
+// the same order as in this instance.
+func (l HueTaskList) FilterByTag(tag string) HueTaskList {
+	var result HueTaskList
+	for _, ht := range l {
+		if ht.HasTag(tag) {
+			result = append(result, ht)
+		}
+	}
+	return result
+}
+
+// HueTaskCategory represents the HueTasks in a category.
+type HueTaskCategory struct {
+
+	// The name of the category. Empty means uncategorized.
+	Name string
+
+	// The HueTasks in the category
+	Tasks HueTaskList
+}
+
+// GroupByCategory groups the HueTasks in this instance by category.
+// Categories are sorted by name ignoring case except that uncategorized
+// HueTasks come last. Within each category, HueTasks are in the same
+// order as in this instance so callers wanting HueTasks sorted by
+// description should call SortByDescriptionIgnoreCase first.
+func (l HueTaskList) GroupByCategory() []HueTaskCategory {
+	var result []HueTaskCategory
+	categoryIdxs := make(map[string]int)
+	for _, ht := range l {
+		idx, ok := categoryIdxs[ht.Category]
+		if !ok {
+			idx = len(result)
+			categoryIdxs[ht.Category] = idx
+			result = append(result, HueTaskCategory{Name: ht.Category})
+		}
+		result[idx].Tasks = append(result[idx].Tasks, ht)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Name == "" || result[j].Name == "" {
+			return result[i].Name != "" && result[j].Name == ""
+		}
+		return strings.ToLower(result[i].Name) < strings.ToLower(result[j].Name)
+	})
+	return result
+}
+
 // ParamSerializer encodes parameters for hue tasks as a string.
 type ParamSerializer map[string][]string
 
@@ -286,6 +724,101 @@ func (p ParamSerializer) SetInt(key string, value int) ParamSerializer {
 // then returns ErrNoValue. May return a different error if the value
 // stored is corrupted or cannot be converted to an int.
 func (p ParamSerializer) GetInt(key string) (result int, err error) {
+	value, err := p.getSingle(key)
+	if err != nil {
+		return
+	}
+	return strconv.Atoi(value)
+}
+
+// SetBool stores a bool value and returns this instance for chaining.
+func (p ParamSerializer) SetBool(key string, value bool) ParamSerializer {
+	p[key] = []string{strconv.FormatBool(value)}
+	return p
+}
+
+// GetBool returns the stored bool value. If no value stored under key
+// then returns ErrNoValue. May return a different error if the value
+// stored is corrupted or cannot be converted to a bool.
+func (p ParamSerializer) GetBool(key string) (result bool, err error) {
+	value, err := p.getSingle(key)
+	if err != nil {
+		return
+	}
+	return strconv.ParseBool(value)
+}
+
+// SetFloat stores a float64 value and returns this instance for chaining.
+func (p ParamSerializer) SetFloat(key string, value float64) ParamSerializer {
+	p[key] = []string{strconv.FormatFloat(value, 'g', -1, 64)}
+	return p
+}
+
+// GetFloat returns the stored float64 value. If no value stored under key
+// then returns ErrNoValue. May return a different error if the value
+// stored is corrupted or cannot be converted to a float64.
+func (p ParamSerializer) GetFloat(key string) (result float64, err error) {
+	value, err := p.getSingle(key)
+	if err != nil {
+		return
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// SetDuration stores a duration value and returns this instance for
+// chaining.
+func (p ParamSerializer) SetDuration(
+	key string, value time.Duration) ParamSerializer {
+	p[key] = []string{value.String()}
+	return p
+}
+
+// GetDuration returns the stored duration value. If no value stored under
+// key then returns ErrNoValue. May return a different error if the value
+// stored is corrupted or cannot be converted to a duration.
+func (p ParamSerializer) GetDuration(key string) (
+	result time.Duration, err error) {
+	value, err := p.getSingle(key)
+	if err != nil {
+		return
+	}
+	return time.ParseDuration(value)
+}
+
+// SetString stores a string value and returns this instance for chaining.
+func (p ParamSerializer) SetString(key string, value string) ParamSerializer {
+	p[key] = []string{value}
+	return p
+}
+
+// GetString returns the stored string value. If no value stored under key
+// then returns ErrNoValue. May return a different error if the value
+// stored is corrupted.
+func (p ParamSerializer) GetString(key string) (result string, err error) {
+	return p.getSingle(key)
+}
+
+// SetLightSet stores a set of lights and returns this instance for
+// chaining.
+func (p ParamSerializer) SetLightSet(
+	key string, value lights.Set) ParamSerializer {
+	p[key] = []string{value.String()}
+	return p
+}
+
+// GetLightSet returns the stored set of lights. If no value stored under
+// key then returns ErrNoValue. May return a different error if the value
+// stored is corrupted or cannot be converted to a set of lights.
+func (p ParamSerializer) GetLightSet(key string) (
+	result lights.Set, err error) {
+	value, err := p.getSingle(key)
+	if err != nil {
+		return
+	}
+	return lights.InvString(value)
+}
+
+func (p ParamSerializer) getSingle(key string) (result string, err error) {
 	value, ok := p[key]
 	if !ok {
 		err = ErrNoValue
@@ -295,7 +828,7 @@ func (p ParamSerializer) GetInt(key string) (result int, err error) {
 		err = errBadValue
 		return
 	}
-	return strconv.Atoi(value[0])
+	return value[0], nil
 }
 
 // SetBrightness stores a brightness value and returns this instance
@@ -356,6 +889,43 @@ func (p ParamSerializer) GetColor(key string) (result gohue.Color, err error) {
 	return
 }
 
+// SetColors stores a list of colors and returns this instance for chaining.
+func (p ParamSerializer) SetColors(
+	key string, colors []gohue.Color) ParamSerializer {
+	value := make([]string, 2*len(colors))
+	for i := range colors {
+		value[2*i] = strconv.Itoa(int(colors[i].X()*10000.0 + 0.5))
+		value[2*i+1] = strconv.Itoa(int(colors[i].Y()*10000.0 + 0.5))
+	}
+	p[key] = value
+	return p
+}
+
+// GetColors returns the stored list of colors. If no value stored under
+// key then returns ErrNoValue. May return a different error if the value
+// stored is corrupted or cannot be converted to a list of colors.
+func (p ParamSerializer) GetColors(key string) (
+	result []gohue.Color, err error) {
+	value, ok := p[key]
+	if !ok {
+		err = ErrNoValue
+		return
+	}
+	if len(value)%2 != 0 {
+		err = errBadValue
+		return
+	}
+	colors := make([]gohue.Color, len(value)/2)
+	for i := range colors {
+		single := ParamSerializer{key: value[2*i : 2*i+2]}
+		if colors[i], err = single.GetColor(key); err != nil {
+			return
+		}
+	}
+	result = colors
+	return
+}
+
 // PlainFactory implements Factory and lets user provide brightness and
 // color and then generates an ops.HueAction that makes lights the user
 // supplied color and brightness.
@@ -371,7 +941,11 @@ func NewPlainFactory(colorPicker Param) PlainFactory {
 	return PlainFactory{
 		NamedParamList{
 			{Name: ColorParamName, Param: colorPicker},
-			{Name: BrightnessParamName, Param: Brightness()},
+			{
+				Name:  BrightnessParamName,
+				Param: Brightness(),
+				Help:  kBrightnessHelp,
+			},
 		},
 	}
 }
@@ -429,7 +1003,11 @@ func (p PlainFactory) Decode(s string) (action ops.HueAction, err error) {
 var (
 	kPlainParams = NamedParamList{
 		{Name: ColorParamName, Param: ColorPicker(gohue.White, "White")},
-		{Name: BrightnessParamName, Param: Brightness()},
+		{
+			Name:  BrightnessParamName,
+			Param: Brightness(),
+			Help:  kBrightnessHelp,
+		},
 	}
 )
 
@@ -482,8 +1060,8 @@ func (p PlainColorFactory) Decode(s string) (action ops.HueAction, err error) {
 func plainAction(color gohue.Color, brightness uint8) ops.HueAction {
 	return ops.StaticHueAction{
 		0: ops.ColorBrightness{
-			gohue.NewMaybeColor(color),
-			maybe.NewUint8(brightness),
+			Color:      gohue.NewMaybeColor(color),
+			Brightness: maybe.NewUint8(brightness),
 		},
 	}
 }
@@ -496,12 +1074,16 @@ func getColorAndBrightnessFromAction(action ops.HueAction) (gohue.Color, uint8)
 
 var (
 	kPlainColorParams = NamedParamList{
-		{Name: BrightnessParamName, Param: Brightness()},
+		{
+			Name:  BrightnessParamName,
+			Param: Brightness(),
+			Help:  kBrightnessHelp,
+		},
 	}
 )
 
 var (
-	kBrightness   = Int(0, 255, 255, 3)
+	kBrightness   = Slider(0, 255, 255, 1)
 	kColorChoices = ChoiceList{
 		{"Red", gohue.Red},
 		{"Green", gohue.Green},
@@ -529,12 +1111,27 @@ type intParam struct {
 	MaxValue     int
 	DefaultValue int
 	MaxChars     int
+	Step         int
+	PreferSlider bool
 }
 
 func (p *intParam) MaxCharCount() int {
 	return p.MaxChars
 }
 
+func (p *intParam) RangeHints() RangeHints {
+	step := p.Step
+	if step <= 0 {
+		step = 1
+	}
+	return RangeHints{
+		Min:          p.MinValue,
+		Max:          p.MaxValue,
+		Step:         step,
+		PreferSlider: p.PreferSlider,
+	}
+}
+
 func (p *intParam) Convert(s string) (interface{}, string) {
 	result, err := strconv.Atoi(s)
 	if err != nil || result > p.MaxValue || result < p.MinValue {
@@ -543,6 +1140,20 @@ func (p *intParam) Convert(s string) (interface{}, string) {
 	return result, strconv.Itoa(result)
 }
 
+func (p *intParam) ConvertStrict(s string) (interface{}, string, error) {
+	if s == "" {
+		return p.DefaultValue, strconv.Itoa(p.DefaultValue), nil
+	}
+	result, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, "", ErrNotANumber
+	}
+	if result > p.MaxValue || result < p.MinValue {
+		return nil, "", ErrOutOfRange
+	}
+	return result, strconv.Itoa(result), nil
+}
+
 type picker struct {
 	Choices      ChoiceList
 	DefaultValue interface{}
@@ -570,6 +1181,97 @@ func (p *picker) Convert(s string) (interface{}, string) {
 	return p.Choices[val-1].Value, p.Choices[val-1].Name
 }
 
+func (p *picker) ConvertStrict(s string) (interface{}, string, error) {
+	if s == "" || s == "0" {
+		return p.DefaultValue, p.DefaultName, nil
+	}
+	val, err := strconv.Atoi(s)
+	if err != nil || val < 1 || val > len(p.Choices) {
+		return nil, "", ErrNoSuchChoice
+	}
+	return p.Choices[val-1].Value, p.Choices[val-1].Name, nil
+}
+
+type groupedPicker struct {
+	picker
+	groups []SelectionGroup
+}
+
+func (p *groupedPicker) SelectionGroups() []SelectionGroup {
+	return p.groups
+}
+
+type randomPicker struct {
+	picker
+}
+
+func (p *randomPicker) Selection() []string {
+	return append(p.picker.Selection(), kSurpriseMe)
+}
+
+func (p *randomPicker) Convert(s string) (interface{}, string) {
+	return p.picker.Convert(p.resolve(s))
+}
+
+func (p *randomPicker) ConvertStrict(s string) (interface{}, string, error) {
+	return p.picker.ConvertStrict(p.resolve(s))
+}
+
+// resolve replaces the ordinal value of the "Surprise me" option with
+// the ordinal value of a randomly picked choice.
+func (p *randomPicker) resolve(s string) string {
+	val, err := strconv.Atoi(s)
+	if err != nil || val != len(p.Choices)+1 || len(p.Choices) == 0 {
+		return s
+	}
+	return strconv.Itoa(rand.Intn(len(p.Choices)) + 1)
+}
+
+type multiPicker struct {
+	picker
+}
+
+func (p *multiPicker) IsMultiSelect() bool {
+	return true
+}
+
+func (p *multiPicker) Convert(s string) (interface{}, string) {
+	values, names := p.convert(s)
+	if len(values) == 0 {
+		return p.DefaultValue, p.DefaultName
+	}
+	return values, strings.Join(names, ",")
+}
+
+func (p *multiPicker) ConvertStrict(s string) (interface{}, string, error) {
+	values, names := p.convert(s)
+	if len(values) == 0 {
+		if s == "" || s == "0" {
+			return p.DefaultValue, p.DefaultName, nil
+		}
+		return nil, "", ErrNoSuchChoice
+	}
+	if len(values) != len(strings.Split(s, ",")) {
+		return nil, "", ErrNoSuchChoice
+	}
+	return values, strings.Join(names, ","), nil
+}
+
+func (p *multiPicker) convert(s string) (values []interface{}, names []string) {
+	if s == "" {
+		return
+	}
+	for _, part := range strings.Split(s, ",") {
+		val, _ := strconv.Atoi(strings.TrimSpace(part))
+		if val < 1 || val > len(p.Choices) {
+			continue
+		}
+		values = append(values, p.Choices[val-1].Value)
+		names = append(names, p.Choices[val-1].Name)
+	}
+	return
+}
+
 type constantFactory struct {
 	Action ops.HueAction
 }
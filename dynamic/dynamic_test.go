@@ -1,14 +1,17 @@
 package dynamic_test
 
 import (
+	"fmt"
 	"github.com/keep94/gohue"
 	"github.com/keep94/marvin/dynamic"
 	"github.com/keep94/marvin/dynamic/testutils"
+	"github.com/keep94/marvin/lights"
 	"github.com/keep94/marvin/ops"
 	"github.com/keep94/maybe"
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestInt(t *testing.T) {
@@ -62,9 +65,349 @@ func TestPicker(t *testing.T) {
 	assertIntParamValue(t, 21, "XXI", val, str)
 }
 
+func TestMultiPicker(t *testing.T) {
+	choiceList := dynamic.ChoiceList{
+		{"Red", 30},
+		{"Green", 59},
+		{"Blue", 11},
+	}
+	param := dynamic.MultiPicker(choiceList, []interface{}{21}, "XXI")
+	if !param.(dynamic.MultiSelectParam).IsMultiSelect() {
+		t.Error("Expected multi select")
+	}
+	val, str := param.Convert("3,1")
+	if !reflect.DeepEqual([]interface{}{11, 30}, val) || str != "Blue,Red" {
+		t.Errorf("Expected [11 30] Blue,Red, got %v %s", val, str)
+	}
+	val, str = param.Convert("")
+	if !reflect.DeepEqual([]interface{}{21}, val) || str != "XXI" {
+		t.Errorf("Expected [21] XXI, got %v %s", val, str)
+	}
+	strict := param.(dynamic.StrictParam)
+	if _, _, err := strict.ConvertStrict("1,4"); err != dynamic.ErrNoSuchChoice {
+		t.Errorf("Expected ErrNoSuchChoice, got %v", err)
+	}
+	_, str, err := strict.ConvertStrict("2")
+	assertNoError(t, err)
+	if str != "Green" {
+		t.Errorf("Expected Green, got %s", str)
+	}
+}
+
+func TestGroupedPicker(t *testing.T) {
+	groups := []dynamic.ChoiceGroup{
+		{Name: "Warm", Choices: dynamic.ChoiceList{{"Red", 30}, {"Orange", 40}}},
+		{Name: "Empty"},
+		{Name: "Cool", Choices: dynamic.ChoiceList{{"Blue", 11}}},
+	}
+	param := dynamic.GroupedPicker(groups, 21, "XXI")
+	expectedSelection := []string{"--Pick one--", "Red", "Orange", "Blue"}
+	if out := param.Selection(); !reflect.DeepEqual(expectedSelection, out) {
+		t.Errorf("Expected %v, got %v", expectedSelection, out)
+	}
+	expectedGroups := []dynamic.SelectionGroup{
+		{Name: "Warm", Indexes: []int{1, 2}},
+		{Name: "Empty"},
+		{Name: "Cool", Indexes: []int{3}},
+	}
+	out := param.(dynamic.GroupedParam).SelectionGroups()
+	if !reflect.DeepEqual(expectedGroups, out) {
+		t.Errorf("Expected %v, got %v", expectedGroups, out)
+	}
+	val, str := param.Convert("3")
+	assertIntParamValue(t, 11, "Blue", val, str)
+	val, str = param.Convert("4")
+	assertIntParamValue(t, 21, "XXI", val, str)
+	if _, _, err := param.(dynamic.StrictParam).ConvertStrict("4"); err != dynamic.ErrNoSuchChoice {
+		t.Errorf("Expected ErrNoSuchChoice, got %v", err)
+	}
+}
+
+func TestRangeHints(t *testing.T) {
+	expected := dynamic.RangeHints{Min: -5, Max: 3, Step: 1}
+	if out := dynamic.Int(-5, 3, 1, 4).(dynamic.RangeParam).RangeHints(); out != expected {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+	param := dynamic.Slider(-100, 50, 0, 10)
+	if out := param.MaxCharCount(); out != 4 {
+		t.Errorf("Expected 4, got %d", out)
+	}
+	val, str := param.Convert("51")
+	assertIntParamValue(t, 0, "0", val, str)
+	expected = dynamic.RangeHints{Min: -100, Max: 50, Step: 10, PreferSlider: true}
+	if out := param.(dynamic.RangeParam).RangeHints(); out != expected {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+	if out := dynamic.Brightness().(dynamic.RangeParam).RangeHints(); !out.PreferSlider {
+		t.Error("Expected brightness to prefer a slider")
+	}
+}
+
+func TestPickerWithRandom(t *testing.T) {
+	choiceList := dynamic.ChoiceList{
+		{"Red", 30},
+		{"Green", 59},
+	}
+	param := dynamic.PickerWithRandom(choiceList, 21, "XXI")
+	expectedSelection := []string{"--Pick one--", "Red", "Green", "Surprise me"}
+	if out := param.Selection(); !reflect.DeepEqual(expectedSelection, out) {
+		t.Errorf("Expected %v, got %v", expectedSelection, out)
+	}
+	val, str := param.Convert("2")
+	assertIntParamValue(t, 59, "Green", val, str)
+	val, str = param.Convert("")
+	assertIntParamValue(t, 21, "XXI", val, str)
+	for i := 0; i < 20; i++ {
+		val, str = param.Convert("3")
+		if !(val == 30 && str == "Red") && !(val == 59 && str == "Green") {
+			t.Errorf("Expected a random choice, got %v %s", val, str)
+		}
+	}
+	val, str, err := param.(dynamic.StrictParam).ConvertStrict("3")
+	assertNoError(t, err)
+	if val != 30 && val != 59 {
+		t.Errorf("Expected a random choice, got %v %s", val, str)
+	}
+	if _, _, err := param.(dynamic.StrictParam).ConvertStrict("4"); err != dynamic.ErrNoSuchChoice {
+		t.Errorf("Expected ErrNoSuchChoice, got %v", err)
+	}
+}
+
+func TestIntStrict(t *testing.T) {
+	param := dynamic.Int(-5, 3, 1, 4).(dynamic.StrictParam)
+	val, str, err := param.ConvertStrict("-5")
+	assertIntParamValue(t, -5, "-5", val, str)
+	assertNoError(t, err)
+	val, str, err = param.ConvertStrict("")
+	assertIntParamValue(t, 1, "1", val, str)
+	assertNoError(t, err)
+	if _, _, err := param.ConvertStrict("4"); err != dynamic.ErrOutOfRange {
+		t.Errorf("Expected ErrOutOfRange, got %v", err)
+	}
+	if _, _, err := param.ConvertStrict("-6"); err != dynamic.ErrOutOfRange {
+		t.Errorf("Expected ErrOutOfRange, got %v", err)
+	}
+	if _, _, err := param.ConvertStrict("abc"); err != dynamic.ErrNotANumber {
+		t.Errorf("Expected ErrNotANumber, got %v", err)
+	}
+}
+
+func TestPickerStrict(t *testing.T) {
+	choiceList := dynamic.ChoiceList{
+		{"Red", 30},
+		{"Green", 59},
+	}
+	param := dynamic.Picker(choiceList, 21, "XXI").(dynamic.StrictParam)
+	val, str, err := param.ConvertStrict("2")
+	assertIntParamValue(t, 59, "Green", val, str)
+	assertNoError(t, err)
+	val, str, err = param.ConvertStrict("0")
+	assertIntParamValue(t, 21, "XXI", val, str)
+	assertNoError(t, err)
+	val, str, err = param.ConvertStrict("")
+	assertIntParamValue(t, 21, "XXI", val, str)
+	assertNoError(t, err)
+	if _, _, err := param.ConvertStrict("3"); err != dynamic.ErrNoSuchChoice {
+		t.Errorf("Expected ErrNoSuchChoice, got %v", err)
+	}
+	if _, _, err := param.ConvertStrict("x"); err != dynamic.ErrNoSuchChoice {
+		t.Errorf("Expected ErrNoSuchChoice, got %v", err)
+	}
+}
+
+func TestFromUrlValuesStrict(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          105,
+		Description: "Foo",
+		Factory:     dynamic.PlainFactory{},
+	}
+	urlValues := make(url.Values)
+	urlValues.Set("p0", "1")
+	urlValues.Set("p1", "98")
+	expected := &ops.HueTask{
+		Id:          105,
+		Description: "Foo Color: Red Bri: 98",
+		HueAction: ops.StaticHueAction{
+			0: {Color: gohue.NewMaybeColor(gohue.Red),
+				Brightness: maybe.NewUint8(98)},
+		},
+	}
+	actual, err := aTask.FromUrlValuesStrict("p", urlValues)
+	assertNoError(t, err)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+
+	urlValues.Set("p0", "99")
+	urlValues.Set("p1", "500")
+	actual, err = aTask.FromUrlValuesStrict("p", urlValues)
+	if actual != nil {
+		t.Error("Expected no hue task")
+	}
+	expectedErrs := dynamic.ParamErrors{
+		{
+			Index: 0,
+			Name:  dynamic.ColorParamName,
+			Value: "99",
+			Err:   dynamic.ErrNoSuchChoice,
+		},
+		{
+			Index: 1,
+			Name:  dynamic.BrightnessParamName,
+			Value: "500",
+			Err:   dynamic.ErrOutOfRange,
+		},
+	}
+	if !reflect.DeepEqual(expectedErrs, err) {
+		t.Errorf("Expected %v, got %v", expectedErrs, err)
+	}
+}
+
+func TestTryFromUrlValues(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          105,
+		Description: "Foo",
+		Factory:     dynamic.PlainFactory{},
+	}
+	urlValues := make(url.Values)
+	urlValues.Set("r0", "1")
+	urlValues.Set("r1", "98")
+	actual, errs := aTask.TryFromUrlValues("r", urlValues)
+	if errs != nil {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+	if actual.Description != "Foo Color: Red Bri: 98" {
+		t.Errorf("Expected 'Foo Color: Red Bri: 98', got %s", actual.Description)
+	}
+	urlValues.Set("r1", "x")
+	actual, errs = aTask.TryFromUrlValues("r", urlValues)
+	if actual != nil {
+		t.Error("Expected no hue task")
+	}
+	expectedErrs := dynamic.FieldErrors{
+		"r1": {
+			Index: 1,
+			Name:  dynamic.BrightnessParamName,
+			Value: "x",
+			Err:   dynamic.ErrNotANumber,
+		},
+	}
+	if !reflect.DeepEqual(expectedErrs, errs) {
+		t.Errorf("Expected %v, got %v", expectedErrs, errs)
+	}
+}
+
+func TestFilterByTagAndGroupByCategory(t *testing.T) {
+	hueTasks := dynamic.HueTaskList{
+		{Id: 1, Description: "One", Category: "notify", Tags: []string{"party"}},
+		{Id: 2, Description: "Two"},
+		{Id: 3, Description: "Three", Category: "Basic", Tags: []string{"night", "party"}},
+		{Id: 4, Description: "Four", Category: "notify"},
+	}
+	if out := taskIds(hueTasks.FilterByTag("party")); !reflect.DeepEqual([]int{1, 3}, out) {
+		t.Errorf("Expected [1 3], got %v", out)
+	}
+	if out := hueTasks.FilterByTag("none"); len(out) != 0 {
+		t.Errorf("Expected no tasks, got %v", out)
+	}
+	categories := hueTasks.GroupByCategory()
+	var names []string
+	var ids [][]int
+	for _, category := range categories {
+		names = append(names, category.Name)
+		ids = append(ids, taskIds(category.Tasks))
+	}
+	if expected := []string{"Basic", "notify", ""}; !reflect.DeepEqual(expected, names) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+	if expected := [][]int{{3}, {1, 4}, {2}}; !reflect.DeepEqual(expected, ids) {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+}
+
+type describingFactory struct {
+}
+
+func (f describingFactory) Params() dynamic.NamedParamList {
+	return dynamic.NamedParamList{
+		{Name: dynamic.BrightnessParamName, Param: dynamic.Brightness()},
+	}
+}
+
+func (f describingFactory) New(values []interface{}) ops.HueAction {
+	return ops.StaticHueAction{
+		0: {Brightness: maybe.NewUint8(uint8(values[0].(int)))},
+	}
+}
+
+func (f describingFactory) Describe(values []interface{}) string {
+	return fmt.Sprintf("to %d of 255", values[0].(int))
+}
+
+func taskIds(hueTasks dynamic.HueTaskList) []int {
+	result := make([]int, len(hueTasks))
+	for i := range hueTasks {
+		result[i] = hueTasks[i].Id
+	}
+	return result
+}
+
+func TestDescriber(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          106,
+		Description: "Dim",
+		Factory:     describingFactory{},
+	}
+	urlValues := make(url.Values)
+	urlValues.Set("p0", "40")
+	actual := aTask.FromUrlValues("p", urlValues)
+	if actual.Description != "Dim to 40 of 255" {
+		t.Errorf("Expected 'Dim to 40 of 255', got %s", actual.Description)
+	}
+	actual, err := aTask.FromUrlValuesStrict("p", urlValues)
+	assertNoError(t, err)
+	if actual.Description != "Dim to 40 of 255" {
+		t.Errorf("Expected 'Dim to 40 of 255', got %s", actual.Description)
+	}
+	// FromExplicit has no values to describe
+	actual = aTask.FromExplicit(actual.HueAction, []string{"40"})
+	if actual.Description != "Dim Bri: 40" {
+		t.Errorf("Expected 'Dim Bri: 40', got %s", actual.Description)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	params := dynamic.NamedParamList{
+		{Name: "A", Param: dynamic.Brightness()},
+	}
+	params = append(params, dynamic.Grouped(
+		"Timing",
+		dynamic.NamedParam{Name: "B", Param: dynamic.Brightness()},
+		dynamic.NamedParam{Name: "C", Param: dynamic.Brightness()})...)
+	params = append(params, dynamic.NamedParam{
+		Name: "D", Param: dynamic.Brightness()})
+	expected := []dynamic.ParamGroup{
+		{Name: "", Indexes: []int{0, 3}},
+		{Name: "Timing", Indexes: []int{1, 2}},
+	}
+	if out := params.Groups(); !reflect.DeepEqual(expected, out) {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+	expected = []dynamic.ParamGroup{
+		{Name: "From", Indexes: []int{0, 1}},
+		{Name: "To", Indexes: []int{2, 3}},
+		{Name: "Timing", Indexes: []int{4}},
+	}
+	transitionParams := dynamic.TransitionFactory{}.Params()
+	if out := transitionParams.Groups(); !reflect.DeepEqual(expected, out) {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+}
+
 func TestConstant(t *testing.T) {
 	anAction := ops.StaticHueAction{
-		0: {gohue.NewMaybeColor(gohue.Blue), maybe.NewUint8(87)}}
+		0: {Color: gohue.NewMaybeColor(gohue.Blue),
+			Brightness: maybe.NewUint8(87)}}
 	factory := dynamic.Constant(anAction)
 	aTask := &dynamic.HueTask{
 		Id:          112,
@@ -78,7 +421,8 @@ func TestConstant(t *testing.T) {
 		Id:          112,
 		Description: "Baz",
 		HueAction: ops.StaticHueAction{
-			0: {gohue.NewMaybeColor(gohue.Blue), maybe.NewUint8(87)},
+			0: {Color: gohue.NewMaybeColor(gohue.Blue),
+				Brightness: maybe.NewUint8(87)},
 		},
 	}
 	actual := aTask.FromUrlValues("p", urlValues)
@@ -106,7 +450,8 @@ func TestFromUrlValues(t *testing.T) {
 		Id:          105,
 		Description: "Foo Color: Red Bri: 98",
 		HueAction: ops.StaticHueAction{
-			0: {gohue.NewMaybeColor(gohue.Red), maybe.NewUint8(98)},
+			0: {Color: gohue.NewMaybeColor(gohue.Red),
+				Brightness: maybe.NewUint8(98)},
 		},
 	}
 	actual := aTask.FromUrlValues("p", urlValues)
@@ -119,7 +464,8 @@ func TestFromUrlValues(t *testing.T) {
 		Id:          105,
 		Description: "Foo Color: White Bri: 255",
 		HueAction: ops.StaticHueAction{
-			0: {gohue.NewMaybeColor(gohue.White), maybe.NewUint8(gohue.Bright)},
+			0: {Color: gohue.NewMaybeColor(gohue.White),
+				Brightness: maybe.NewUint8(gohue.Bright)},
 		},
 	}
 	// No supplied values
@@ -139,7 +485,8 @@ func TestPlainFactoryNewExplicit(t *testing.T) {
 		Id:          107,
 		Description: "Bar Color: Blue Bri: 131",
 		HueAction: ops.StaticHueAction{
-			0: {gohue.NewMaybeColor(gohue.Blue), maybe.NewUint8(131)},
+			0: {Color: gohue.NewMaybeColor(gohue.Blue),
+				Brightness: maybe.NewUint8(131)},
 		},
 	}
 	actual := aTask.FromExplicit(
@@ -160,7 +507,8 @@ func TestPlainColorFactoryNewExplicit(t *testing.T) {
 		Id:          108,
 		Description: "Baz Bri: 52",
 		HueAction: ops.StaticHueAction{
-			0: {gohue.NewMaybeColor(gohue.Pink), maybe.NewUint8(52)},
+			0: {Color: gohue.NewMaybeColor(gohue.Pink),
+				Brightness: maybe.NewUint8(52)},
 		},
 	}
 	actual := aTask.FromExplicit(
@@ -275,6 +623,90 @@ func TestParamSerializer(t *testing.T) {
 	}
 }
 
+func TestParamSerializerColors(t *testing.T) {
+	p := make(dynamic.ParamSerializer)
+	colors := []gohue.Color{gohue.Red, gohue.Green, gohue.Blue}
+	s := p.SetColors("loop", colors).SetInt("bad", 3).Encode()
+	q, err := dynamic.NewParamSerializer(s)
+	if err != nil {
+		t.Fatal("Got error deserializing.")
+	}
+	if out, err := q.GetColors("loop"); !reflect.DeepEqual(colors, out) || err != nil {
+		t.Errorf("Expected %v, got %v", colors, out)
+	}
+	if _, err := q.GetColors("bad"); err == nil || err == dynamic.ErrNoValue {
+		t.Errorf("Expected to get an undefined error, got %v", err)
+	}
+	if _, err := q.GetColors("notthere"); err != dynamic.ErrNoValue {
+		t.Errorf("Expected to get ErrNoValue, got %v", err)
+	}
+}
+
+func TestHelpAndUnit(t *testing.T) {
+	params := dynamic.SunriseFactory{}.Params()
+	if params[0].Unit != "minutes" || params[0].Help != "" {
+		t.Errorf("Expected minutes with no help, got %q %q", params[0].Unit, params[0].Help)
+	}
+	params = dynamic.PlainFactory{}.Params()
+	if params[1].Help != "0 to 255" || params[1].Unit != "" {
+		t.Errorf("Expected 0 to 255 with no unit, got %q %q", params[1].Help, params[1].Unit)
+	}
+}
+
+func TestParamSerializerMoreTypes(t *testing.T) {
+	p := make(dynamic.ParamSerializer)
+	p.SetBool("on", true).SetFloat("ratio", 0.375)
+	p.SetDuration("wait", 90*time.Second).SetString("name", "Den, lamp")
+	p.SetLightSet("some", lights.New(2, 5)).SetLightSet("all", lights.All)
+	p.SetLightSet("none", lights.None).SetColor("color", gohue.Red)
+	q, err := dynamic.NewParamSerializer(p.Encode())
+	if err != nil {
+		t.Fatal("Got error deserializing.")
+	}
+	if out, err := q.GetBool("on"); !out || err != nil {
+		t.Errorf("Expected true, got %v", out)
+	}
+	if out, err := q.GetFloat("ratio"); out != 0.375 || err != nil {
+		t.Errorf("Expected 0.375, got %v", out)
+	}
+	if out, err := q.GetDuration("wait"); out != 90*time.Second || err != nil {
+		t.Errorf("Expected 1m30s, got %v", out)
+	}
+	if out, err := q.GetString("name"); out != "Den, lamp" || err != nil {
+		t.Errorf("Expected 'Den, lamp', got %v", out)
+	}
+	if out, err := q.GetLightSet("some"); out.String() != "2,5" || err != nil {
+		t.Errorf("Expected 2,5, got %v", out)
+	}
+	if out, err := q.GetLightSet("all"); !out.IsAll() || err != nil {
+		t.Errorf("Expected All, got %v", out)
+	}
+	if out, err := q.GetLightSet("none"); !out.IsNone() || err != nil {
+		t.Errorf("Expected None, got %v", out)
+	}
+	if _, err := q.GetBool("color"); err == nil || err == dynamic.ErrNoValue {
+		t.Errorf("Expected to get an undefined error, got %v", err)
+	}
+	if _, err := q.GetFloat("name"); err == nil || err == dynamic.ErrNoValue {
+		t.Errorf("Expected to get an undefined error, got %v", err)
+	}
+	if _, err := q.GetDuration("name"); err == nil || err == dynamic.ErrNoValue {
+		t.Errorf("Expected to get an undefined error, got %v", err)
+	}
+	if _, err := q.GetLightSet("name"); err == nil || err == dynamic.ErrNoValue {
+		t.Errorf("Expected to get an undefined error, got %v", err)
+	}
+	if _, err := q.GetString("notthere"); err != dynamic.ErrNoValue {
+		t.Errorf("Expected to get ErrNoValue, got %v", err)
+	}
+}
+
+func assertNoError(t *testing.T, err error) {
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
 func assertIntParamValue(
 	t *testing.T, eval int, estr string, val interface{}, str string) {
 	if val.(int) != eval {
@@ -0,0 +1,461 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Integer parameter type in task definitions
+	IntParamType = "int"
+
+	// Brightness parameter type in task definitions
+	BrightnessParamType = "brightness"
+
+	// Color parameter type in task definitions
+	ColorParamType = "color"
+)
+
+const (
+	kLightsKey = "Lights"
+)
+
+// TaskDef is the declarative definition of a dynamic HueTask.
+type TaskDef struct {
+	// Must be between 1 and ops.PersistentTaskIdOffset - 1 inclusive.
+	Id int `json:"id"`
+
+	Description string `json:"description"`
+
+	// Optional category and tags. See HueTask.
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+
+	Params []ParamDef `json:"params"`
+
+	// Maps a light id to its color and brightness. Light id 0 means all
+	// lights.
+	Action map[string]LightDef `json:"action"`
+}
+
+// ParamDef is the declarative definition of a parameter.
+type ParamDef struct {
+	Name string `json:"name"`
+
+	// One of IntParamType, BrightnessParamType, or ColorParamType.
+	Type string `json:"type"`
+
+	// For IntParamType only, the range of the integer inclusive.
+	Min int `json:"min"`
+	Max int `json:"max"`
+
+	// For IntParamType only, the size of the input field.
+	MaxChars int `json:"maxChars"`
+
+	// Optional help text and unit. See NamedParam.
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+
+	// The default value. A number for IntParamType and BrightnessParamType;
+	// the name of a color for ColorParamType.
+	Default json.RawMessage `json:"default"`
+}
+
+// LightDef is the declarative definition of a light's color and
+// brightness. Color is either the name of a color or "$" followed by the
+// name of a color parameter. Brightness is either a number or a string
+// consisting of "$" followed by the name of a brightness or int parameter.
+// An empty Color or a missing Brightness leaves that property unset.
+type LightDef struct {
+	Color      string          `json:"color"`
+	Brightness json.RawMessage `json:"bri"`
+}
+
+// Loader reads dynamic HueTasks from declarative JSON definitions so that
+// simple tasks can be added without recompiling. The JSON is an array of
+// TaskDef. The zero value is ready to use.
+type Loader struct {
+	// The colors that color parameters and light definitions may use.
+	// nil means the same colors that ColorPicker uses.
+	Colors ChoiceList
+}
+
+// LoadFile works like Load except that it reads from the named file.
+func (l *Loader) LoadFile(path string) (HueTaskList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return l.Load(f)
+}
+
+// Load reads task definitions from r and returns the corresponding
+// HueTasks. The Factory of each returned HueTask implements
+// FactoryEncoderDecoder. Load returns an error if any definition is
+// invalid.
+func (l *Loader) Load(r io.Reader) (HueTaskList, error) {
+	var defs []TaskDef
+	if err := json.NewDecoder(r).Decode(&defs); err != nil {
+		return nil, err
+	}
+	result := make(HueTaskList, len(defs))
+	ids := make(map[int]bool, len(defs))
+	for i := range defs {
+		task, err := l.newHueTask(&defs[i])
+		if err != nil {
+			return nil, fmt.Errorf("dynamic: task %d: %v", defs[i].Id, err)
+		}
+		if ids[task.Id] {
+			return nil, fmt.Errorf("dynamic: task %d: duplicate id", task.Id)
+		}
+		ids[task.Id] = true
+		result[i] = task
+	}
+	return result, nil
+}
+
+func (l *Loader) colors() ChoiceList {
+	if l.Colors == nil {
+		return kColorChoices
+	}
+	return l.Colors
+}
+
+func (l *Loader) colorByName(name string) (gohue.Color, bool) {
+	for _, choice := range l.colors() {
+		if strings.EqualFold(choice.Name, name) {
+			color, ok := choice.Value.(gohue.Color)
+			return color, ok
+		}
+	}
+	var zero gohue.Color
+	return zero, false
+}
+
+func (l *Loader) newHueTask(def *TaskDef) (*HueTask, error) {
+	if def.Id <= 0 || def.Id >= ops.PersistentTaskIdOffset {
+		return nil, fmt.Errorf(
+			"id must be between 1 and %d", ops.PersistentTaskIdOffset-1)
+	}
+	factory := &templateFactory{paramIdx: make(map[string]int)}
+	for i := range def.Params {
+		param, err := l.newParam(&def.Params[i])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := factory.paramIdx[def.Params[i].Name]; ok {
+			return nil, fmt.Errorf("duplicate param %s", def.Params[i].Name)
+		}
+		factory.paramIdx[def.Params[i].Name] = i
+		factory.params = append(
+			factory.params,
+			NamedParam{
+				Name:  def.Params[i].Name,
+				Param: param,
+				Help:  def.Params[i].Help,
+				Unit:  def.Params[i].Unit,
+			})
+		factory.types = append(factory.types, def.Params[i].Type)
+	}
+	if len(def.Action) == 0 {
+		return nil, fmt.Errorf("action is missing")
+	}
+	for lightIdStr, lightDef := range def.Action {
+		lightId, err := strconv.Atoi(lightIdStr)
+		if err != nil || lightId < 0 {
+			return nil, fmt.Errorf("bad light id %s", lightIdStr)
+		}
+		light, err := l.newLightTemplate(lightId, lightDef, factory)
+		if err != nil {
+			return nil, err
+		}
+		factory.lights = append(factory.lights, light)
+	}
+	sort.Slice(factory.lights, func(i, j int) bool {
+		return factory.lights[i].lightId < factory.lights[j].lightId
+	})
+	return &HueTask{
+		Id:          def.Id,
+		Description: def.Description,
+		Factory:     factory,
+		Category:    def.Category,
+		Tags:        def.Tags,
+	}, nil
+}
+
+func (l *Loader) newParam(def *ParamDef) (Param, error) {
+	if def.Name == "" {
+		return nil, fmt.Errorf("param name missing")
+	}
+	switch def.Type {
+	case IntParamType:
+		defaultValue := def.Min
+		if err := unmarshalDefault(def.Default, &defaultValue); err != nil {
+			return nil, fmt.Errorf("param %s: %v", def.Name, err)
+		}
+		if def.Min > def.Max || defaultValue < def.Min || defaultValue > def.Max {
+			return nil, fmt.Errorf("param %s: bad range", def.Name)
+		}
+		maxChars := def.MaxChars
+		if maxChars <= 0 {
+			maxChars = len(strconv.Itoa(def.Max))
+		}
+		return Int(def.Min, def.Max, defaultValue, maxChars), nil
+	case BrightnessParamType:
+		defaultValue := 255
+		if err := unmarshalDefault(def.Default, &defaultValue); err != nil {
+			return nil, fmt.Errorf("param %s: %v", def.Name, err)
+		}
+		if defaultValue < 0 || defaultValue > 255 {
+			return nil, fmt.Errorf("param %s: bad default", def.Name)
+		}
+		return Int(0, 255, defaultValue, 3), nil
+	case ColorParamType:
+		defaultName := "White"
+		if err := unmarshalDefault(def.Default, &defaultName); err != nil {
+			return nil, fmt.Errorf("param %s: %v", def.Name, err)
+		}
+		color, ok := l.colorByName(defaultName)
+		if !ok {
+			return nil, fmt.Errorf(
+				"param %s: unknown color %s", def.Name, defaultName)
+		}
+		return Picker(l.colors(), color, defaultName), nil
+	default:
+		return nil, fmt.Errorf("param %s: unknown type %s", def.Name, def.Type)
+	}
+}
+
+func (l *Loader) newLightTemplate(
+	lightId int,
+	def LightDef,
+	factory *templateFactory) (*lightTemplate, error) {
+	result := &lightTemplate{lightId: lightId, colorIdx: -1, briIdx: -1}
+	if strings.HasPrefix(def.Color, "$") {
+		idx, ok := factory.paramIdx[def.Color[1:]]
+		if !ok || factory.types[idx] != ColorParamType {
+			return nil, fmt.Errorf("bad color param %s", def.Color)
+		}
+		result.colorIdx = idx
+	} else if def.Color != "" {
+		color, ok := l.colorByName(def.Color)
+		if !ok {
+			return nil, fmt.Errorf("unknown color %s", def.Color)
+		}
+		result.color.Set(color)
+	}
+	if len(def.Brightness) == 0 {
+		return result, nil
+	}
+	var briRef string
+	if err := json.Unmarshal(def.Brightness, &briRef); err == nil {
+		idx, ok := factory.paramIdx[strings.TrimPrefix(briRef, "$")]
+		if !ok || !strings.HasPrefix(briRef, "$") || factory.types[idx] == ColorParamType {
+			return nil, fmt.Errorf("bad brightness param %s", briRef)
+		}
+		result.briIdx = idx
+		return result, nil
+	}
+	var bri int
+	if err := json.Unmarshal(def.Brightness, &bri); err != nil || bri < 0 || bri > 255 {
+		return nil, fmt.Errorf("bad brightness %s", string(def.Brightness))
+	}
+	result.brightness.Set(uint8(bri))
+	return result, nil
+}
+
+func unmarshalDefault(raw json.RawMessage, ptr interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, ptr)
+}
+
+type lightTemplate struct {
+	lightId    int
+	color      gohue.MaybeColor
+	colorIdx   int
+	brightness maybe.Uint8
+	briIdx     int
+}
+
+func (t *lightTemplate) ColorBrightness(
+	values []interface{}) ops.ColorBrightness {
+	result := ops.ColorBrightness{Color: t.color, Brightness: t.brightness}
+	if t.colorIdx != -1 {
+		result.Color = gohue.NewMaybeColor(values[t.colorIdx].(gohue.Color))
+	}
+	if t.briIdx != -1 {
+		bri := values[t.briIdx].(int)
+		if bri < 0 {
+			bri = 0
+		}
+		if bri > 255 {
+			bri = 255
+		}
+		result.Brightness = maybe.NewUint8(uint8(bri))
+	}
+	return result
+}
+
+// templateFactory is the Factory for HueTasks that Loader creates.
+// It generates ops.StaticHueAction instances.
+type templateFactory struct {
+	params   NamedParamList
+	types    []string
+	paramIdx map[string]int
+	lights   []*lightTemplate
+}
+
+func (f *templateFactory) Params() NamedParamList {
+	return f.params
+}
+
+func (f *templateFactory) New(values []interface{}) ops.HueAction {
+	result := make(ops.StaticHueAction, len(f.lights))
+	for _, light := range f.lights {
+		result[light.lightId] = light.ColorBrightness(values)
+	}
+	return result
+}
+
+// Encode encodes a HueAction that this instance created as a string
+func (f *templateFactory) Encode(action ops.HueAction) string {
+	lightIds := make([]int, len(f.lights))
+	for i, light := range f.lights {
+		lightIds[i] = light.lightId
+	}
+	serializer := make(ParamSerializer)
+	setStaticHueAction(serializer, lightIds, action.(ops.StaticHueAction))
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+func (f *templateFactory) Decode(s string) (ops.HueAction, error) {
+	serializer, err := NewParamSerializer(s)
+	if err != nil {
+		return nil, err
+	}
+	static, err := getStaticHueAction(serializer)
+	if err != nil {
+		return nil, err
+	}
+	return static, nil
+}
+
+// setStaticHueAction stores the entries of static for lightIds in
+// serializer.
+func setStaticHueAction(
+	serializer ParamSerializer,
+	lightIds []int,
+	static ops.StaticHueAction) {
+	lightIdStrs := make([]string, len(lightIds))
+	for i, lightId := range lightIds {
+		lightIdStrs[i] = strconv.Itoa(lightId)
+		cb := static[lightId]
+		if cb.Color.Valid {
+			serializer.SetColor(colorKey(lightId), cb.Color.Color)
+		}
+		if cb.Brightness.Valid {
+			serializer.SetBrightness(brightnessKey(lightId), cb.Brightness.Value)
+		}
+		if cb.On.Valid {
+			serializer.SetBool(onKey(lightId), cb.On.Value)
+		}
+		if cb.ColorTemperature.Valid {
+			serializer.SetInt(
+				colorTemperatureKey(lightId), int(cb.ColorTemperature.Value))
+		}
+		if cb.TransitionTime.Valid {
+			serializer.SetInt(
+				transitionTimeKey(lightId), int(cb.TransitionTime.Value))
+		}
+	}
+	serializer[kLightsKey] = lightIdStrs
+}
+
+// getStaticHueAction returns what setStaticHueAction stored in
+// serializer.
+func getStaticHueAction(
+	serializer ParamSerializer) (ops.StaticHueAction, error) {
+	lightIds, ok := serializer[kLightsKey]
+	if !ok {
+		return nil, ErrNoValue
+	}
+	result := make(ops.StaticHueAction, len(lightIds))
+	for _, lightIdStr := range lightIds {
+		lightId, err := strconv.Atoi(lightIdStr)
+		if err != nil || lightId < 0 {
+			return nil, errBadValue
+		}
+		var cb ops.ColorBrightness
+		color, err := serializer.GetColor(colorKey(lightId))
+		if err == nil {
+			cb.Color.Set(color)
+		} else if err != ErrNoValue {
+			return nil, err
+		}
+		bri, err := serializer.GetBrightness(brightnessKey(lightId))
+		if err == nil {
+			cb.Brightness.Set(bri)
+		} else if err != ErrNoValue {
+			return nil, err
+		}
+		on, err := serializer.GetBool(onKey(lightId))
+		if err == nil {
+			cb.On.Set(on)
+		} else if err != ErrNoValue {
+			return nil, err
+		}
+		mireds, err := serializer.GetInt(colorTemperatureKey(lightId))
+		if err == nil {
+			if mireds <= 0 || mireds > math.MaxUint16 {
+				return nil, errBadValue
+			}
+			cb.ColorTemperature.Set(uint16(mireds))
+		} else if err != ErrNoValue {
+			return nil, err
+		}
+		transitionTime, err := serializer.GetInt(transitionTimeKey(lightId))
+		if err == nil {
+			if transitionTime < 0 || transitionTime > math.MaxUint16 {
+				return nil, errBadValue
+			}
+			cb.TransitionTime.Set(uint16(transitionTime))
+		} else if err != ErrNoValue {
+			return nil, err
+		}
+		result[lightId] = cb
+	}
+	return result, nil
+}
+
+func colorKey(lightId int) string {
+	return fmt.Sprintf("C%d", lightId)
+}
+
+func brightnessKey(lightId int) string {
+	return fmt.Sprintf("B%d", lightId)
+}
+
+func onKey(lightId int) string {
+	return fmt.Sprintf("O%d", lightId)
+}
+
+func colorTemperatureKey(lightId int) string {
+	return fmt.Sprintf("T%d", lightId)
+}
+
+func transitionTimeKey(lightId int) string {
+	return fmt.Sprintf("X%d", lightId)
+}
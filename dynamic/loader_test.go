@@ -0,0 +1,99 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/dynamic/testutils"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const kTaskDefs = `[
+  {
+    "id": 50,
+    "description": "Reading",
+    "params": [
+      {"name": "Color", "type": "color", "default": "Yellow"},
+      {"name": "Bri", "type": "brightness", "default": 200}
+    ],
+    "action": {
+      "1": {"color": "$Color", "bri": "$Bri"},
+      "2": {"color": "Blue", "bri": 30}
+    }
+  },
+  {
+    "id": 51,
+    "description": "Off",
+    "category": "Basic",
+    "tags": ["night"],
+    "action": {"0": {}}
+  }
+]`
+
+func TestLoader(t *testing.T) {
+	var loader dynamic.Loader
+	hueTasks, err := loader.Load(strings.NewReader(kTaskDefs))
+	if err != nil {
+		t.Fatalf("Got error loading: %v", err)
+	}
+	if out := len(hueTasks); out != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", out)
+	}
+	reading := hueTasks[0]
+	actual := reading.FromUrlValues("p", make(url.Values))
+	expected := &ops.HueTask{
+		Id:          50,
+		Description: "Reading Color: Yellow Bri: 200",
+		HueAction: ops.StaticHueAction{
+			1: {Color: gohue.NewMaybeColor(gohue.Yellow),
+				Brightness: maybe.NewUint8(200)},
+			2: {Color: gohue.NewMaybeColor(gohue.Blue),
+				Brightness: maybe.NewUint8(30)},
+		},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	testutils.VerifySerialization(t, reading.Factory, actual.HueAction)
+
+	off := hueTasks[1]
+	actual = off.FromUrlValues("p", make(url.Values))
+	expected = &ops.HueTask{
+		Id:          51,
+		Description: "Off",
+		HueAction:   ops.StaticHueAction{0: {}},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	testutils.VerifySerialization(t, off.Factory, actual.HueAction)
+	if off.Category != "Basic" || !off.HasTag("night") {
+		t.Errorf("Expected Basic category and night tag, got %v %v", off.Category, off.Tags)
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	badDefs := []string{
+		`[{"id": 0, "action": {"0": {}}}]`,
+		`[{"id": 10000, "action": {"0": {}}}]`,
+		`[{"id": 5, "action": {"0": {}}}, {"id": 5, "action": {"0": {}}}]`,
+		`[{"id": 5}]`,
+		`[{"id": 5, "action": {"0": {"color": "Mauve"}}}]`,
+		`[{"id": 5, "action": {"0": {"color": "$Color"}}}]`,
+		`[{"id": 5, "action": {"0": {"bri": 256}}}]`,
+		`[{"id": 5, "action": {"-1": {}}}]`,
+		`[{"id": 5, "params": [{"name": "X", "type": "float"}], "action": {"0": {}}}]`,
+		`[{"id": 5, "params": [{"name": "X", "type": "int", "min": 3, "max": 1}], "action": {"0": {}}}]`,
+		`[{"id": 5, "params": [{"name": "X", "type": "color"}], "action": {"0": {"bri": "$X"}}}]`,
+	}
+	var loader dynamic.Loader
+	for _, def := range badDefs {
+		if _, err := loader.Load(strings.NewReader(def)); err == nil {
+			t.Errorf("Expected error loading %s", def)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package dynamic
+
+import (
+	"fmt"
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"sort"
+)
+
+// PerLightFactory implements Factory and lets user provide a color and
+// brightness for each light in a set of lights. It generates an
+// ops.StaticHueAction with an entry for each light. The parameters for
+// light 3 are named "Color3" and "Bri3" and appear in the "Light 3"
+// section of user input forms. Since the lights can change at any time,
+// PerLightFactory fetches them each time Params or New is called.
+type PerLightFactory struct {
+	lightSet    func() lights.Set
+	colorPicker Param
+}
+
+// NewPerLightFactory returns a PerLightFactory for the lights that
+// lightSet returns. colorPicker is the color picker to use for each
+// light. Client uses the Picker function to provide a color picker. If
+// colorPicker is nil, the one that the ColorPicker function returns with
+// a default color of white is used. If lightSet returns all lights or no
+// lights, the returned factory provides one color and brightness for all
+// lights.
+func NewPerLightFactory(
+	lightSet func() lights.Set, colorPicker Param) *PerLightFactory {
+	if colorPicker == nil {
+		colorPicker = ColorPicker(gohue.White, "White")
+	}
+	return &PerLightFactory{lightSet: lightSet, colorPicker: colorPicker}
+}
+
+// Params returns a color and brightness for each of the current lights.
+func (f *PerLightFactory) Params() NamedParamList {
+	lightIds := f.lightIds()
+	params := make(NamedParamList, 0, 2*len(lightIds))
+	for _, lightId := range lightIds {
+		params = append(params, Grouped(
+			fmt.Sprintf("Light %d", lightId),
+			NamedParam{
+				Name:  fmt.Sprintf("%s%d", ColorParamName, lightId),
+				Param: f.colorPicker,
+			},
+			NamedParam{
+				Name:  fmt.Sprintf("%s%d", BrightnessParamName, lightId),
+				Param: Brightness(),
+				Help:  kBrightnessHelp,
+			})...)
+	}
+	return params
+}
+
+// New pairs values with the current lights in ascending order by light
+// id. If the lights changed since Params was called, New ignores the
+// values or lights left over.
+func (f *PerLightFactory) New(values []interface{}) ops.HueAction {
+	lightIds := f.lightIds()
+	if len(lightIds) > len(values)/2 {
+		lightIds = lightIds[:len(values)/2]
+	}
+	result := make(ops.StaticHueAction, len(lightIds))
+	for i, lightId := range lightIds {
+		result[lightId] = ops.ColorBrightness{
+			Color:      gohue.NewMaybeColor(values[2*i].(gohue.Color)),
+			Brightness: maybe.NewUint8(uint8(values[2*i+1].(int))),
+		}
+	}
+	return result
+}
+
+// Encode encodes a HueAction that this instance created as a string
+func (f *PerLightFactory) Encode(action ops.HueAction) string {
+	static := action.(ops.StaticHueAction)
+	lightIds := make([]int, 0, len(static))
+	for lightId := range static {
+		lightIds = append(lightIds, lightId)
+	}
+	sort.Ints(lightIds)
+	serializer := make(ParamSerializer)
+	setStaticHueAction(serializer, lightIds, static)
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+func (f *PerLightFactory) Decode(s string) (ops.HueAction, error) {
+	serializer, err := NewParamSerializer(s)
+	if err != nil {
+		return nil, err
+	}
+	static, err := getStaticHueAction(serializer)
+	if err != nil {
+		return nil, err
+	}
+	return static, nil
+}
+
+// lightIds returns the ids of the current lights in ascending order or
+// just 0 if the current lights are all lights or no lights.
+func (f *PerLightFactory) lightIds() []int {
+	lightIds, _ := f.lightSet().Slice()
+	if len(lightIds) == 0 {
+		return []int{0}
+	}
+	return lightIds
+}
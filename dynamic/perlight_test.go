@@ -0,0 +1,91 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/dynamic/testutils"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestPerLightFactory(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          118,
+		Description: "Each",
+		Factory: dynamic.NewPerLightFactory(
+			func() lights.Set { return lights.New(5, 2) }, nil),
+	}
+	expectedGroups := []dynamic.ParamGroup{
+		{Name: "Light 2", Indexes: []int{0, 1}},
+		{Name: "Light 5", Indexes: []int{2, 3}},
+	}
+	if out := aTask.Params().Groups(); !reflect.DeepEqual(expectedGroups, out) {
+		t.Errorf("Expected %v, got %v", expectedGroups, out)
+	}
+	urlValues := make(url.Values)
+	urlValues.Set("p0", "1")
+	urlValues.Set("p1", "10")
+	urlValues.Set("p2", "3")
+	actual := aTask.FromUrlValues("p", urlValues)
+	expectedDescription := "Each Color2: Red Bri2: 10 Color5: Blue Bri5: 255"
+	if actual.Description != expectedDescription {
+		t.Errorf("Expected %s, got %s", expectedDescription, actual.Description)
+	}
+	expected := ops.StaticHueAction{
+		2: {Color: gohue.NewMaybeColor(gohue.Red),
+			Brightness: maybe.NewUint8(10)},
+		5: {Color: gohue.NewMaybeColor(gohue.Blue),
+			Brightness: maybe.NewUint8(255)},
+	}
+	if !reflect.DeepEqual(expected, actual.HueAction) {
+		t.Errorf("Expected %v, got %v", expected, actual.HueAction)
+	}
+	testutils.VerifySerialization(t, aTask.Factory, actual.HueAction)
+}
+
+func TestPerLightFactoryAllLights(t *testing.T) {
+	factory := dynamic.NewPerLightFactory(
+		func() lights.Set { return lights.All }, nil)
+	params := factory.Params()
+	if len(params) != 2 || params[0].Name != "Color0" || params[1].Name != "Bri0" {
+		t.Errorf("Unexpected params %v", params)
+	}
+}
+
+func TestPerLightFactoryLightsChange(t *testing.T) {
+	lightSet := lights.New(2)
+	aTask := &dynamic.HueTask{
+		Id:          118,
+		Description: "Each",
+		Factory: dynamic.NewPerLightFactory(
+			func() lights.Set { return lightSet }, nil),
+	}
+	urlValues := make(url.Values)
+	urlValues.Set("p0", "1")
+	urlValues.Set("p2", "3")
+	lightSet = lights.New(2, 5)
+	actual := aTask.FromUrlValues("p", urlValues)
+	expected := ops.StaticHueAction{
+		2: {Color: gohue.NewMaybeColor(gohue.Red),
+			Brightness: maybe.NewUint8(255)},
+		5: {Color: gohue.NewMaybeColor(gohue.Blue),
+			Brightness: maybe.NewUint8(255)},
+	}
+	if !reflect.DeepEqual(expected, actual.HueAction) {
+		t.Errorf("Expected %v, got %v", expected, actual.HueAction)
+	}
+	testutils.VerifySerialization(t, aTask.Factory, actual.HueAction)
+	lightSet = lights.New(7)
+	actual = aTask.FromUrlValues("p", urlValues)
+	expected = ops.StaticHueAction{
+		7: {Color: gohue.NewMaybeColor(gohue.Red),
+			Brightness: maybe.NewUint8(255)},
+	}
+	if !reflect.DeepEqual(expected, actual.HueAction) {
+		t.Errorf("Expected %v, got %v", expected, actual.HueAction)
+	}
+}
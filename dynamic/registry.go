@@ -0,0 +1,86 @@
+package dynamic
+
+import (
+	"errors"
+	"fmt"
+	"github.com/keep94/marvin/ops"
+	"sort"
+	"sync"
+)
+
+var (
+	// Reported by Registry.Register if the id is already registered.
+	ErrDuplicateId = errors.New("dynamic: Duplicate Id.")
+
+	// Reported by Registry.Register if the id is not positive or is
+	// greater than or equal to ops.PersistentTaskIdOffset.
+	ErrBadId = errors.New("dynamic: Bad Id.")
+)
+
+// Registry stores HueTask instances by Id. Registry implements
+// huedb.DynamicHueTaskStore. Registry instances can be safely used with
+// multiple goroutines. The zero value is an empty Registry ready for use.
+type Registry struct {
+	mutex sync.RWMutex
+	tasks map[int]*HueTask
+}
+
+// NewRegistry returns a new Registry containing hueTasks. NewRegistry
+// returns an error if hueTasks could not all be registered.
+func NewRegistry(hueTasks HueTaskList) (*Registry, error) {
+	result := &Registry{}
+	if err := result.RegisterAll(hueTasks); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Register registers task. Register returns an error wrapping ErrBadId
+// if task's Id is out of range or an error wrapping ErrDuplicateId if
+// task's Id is already registered.
+func (r *Registry) Register(task *HueTask) error {
+	if task.Id <= 0 || task.Id >= ops.PersistentTaskIdOffset {
+		return fmt.Errorf("%w: %d", ErrBadId, task.Id)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.tasks[task.Id]; ok {
+		return fmt.Errorf("%w: %d", ErrDuplicateId, task.Id)
+	}
+	if r.tasks == nil {
+		r.tasks = make(map[int]*HueTask)
+	}
+	r.tasks[task.Id] = task
+	return nil
+}
+
+// RegisterAll registers each task in hueTasks stopping at the first error.
+func (r *Registry) RegisterAll(hueTasks HueTaskList) error {
+	for _, task := range hueTasks {
+		if err := r.Register(task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ById returns the HueTask with given id or nil if there is no such task.
+func (r *Registry) ById(id int) *HueTask {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.tasks[id]
+}
+
+// All returns all the registered HueTasks sorted by Id.
+func (r *Registry) All() HueTaskList {
+	r.mutex.RLock()
+	result := make(HueTaskList, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		result = append(result, task)
+	}
+	r.mutex.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
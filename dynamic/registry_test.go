@@ -0,0 +1,55 @@
+package dynamic_test
+
+import (
+	"errors"
+	"github.com/keep94/marvin/dynamic"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	first := &dynamic.HueTask{Id: 7, Description: "Seven"}
+	second := &dynamic.HueTask{Id: 3, Description: "Three"}
+	registry, err := dynamic.NewRegistry(dynamic.HueTaskList{first, second})
+	if err != nil {
+		t.Fatalf("Got error creating registry: %v", err)
+	}
+	if out := registry.ById(7); out != first {
+		t.Errorf("Expected %v, got %v", first, out)
+	}
+	if out := registry.ById(4); out != nil {
+		t.Errorf("Expected nil, got %v", out)
+	}
+	expected := dynamic.HueTaskList{second, first}
+	if out := registry.All(); !reflect.DeepEqual(expected, out) {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+	err = registry.Register(&dynamic.HueTask{Id: 3})
+	if !errors.Is(err, dynamic.ErrDuplicateId) {
+		t.Errorf("Expected ErrDuplicateId, got %v", err)
+	}
+	err = registry.Register(&dynamic.HueTask{Id: 10000})
+	if !errors.Is(err, dynamic.ErrBadId) {
+		t.Errorf("Expected ErrBadId, got %v", err)
+	}
+	err = registry.Register(&dynamic.HueTask{Id: 0})
+	if !errors.Is(err, dynamic.ErrBadId) {
+		t.Errorf("Expected ErrBadId, got %v", err)
+	}
+	if out := len(registry.All()); out != 2 {
+		t.Errorf("Expected 2 tasks, got %d", out)
+	}
+}
+
+func TestRegistryZeroValue(t *testing.T) {
+	var registry dynamic.Registry
+	if out := registry.ById(1); out != nil {
+		t.Errorf("Expected nil, got %v", out)
+	}
+	if err := registry.Register(&dynamic.HueTask{Id: 1}); err != nil {
+		t.Errorf("Got error registering: %v", err)
+	}
+	if out := registry.ById(1); out == nil {
+		t.Error("Expected task to be registered")
+	}
+}
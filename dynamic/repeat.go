@@ -0,0 +1,176 @@
+package dynamic
+
+import (
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/tasks"
+	"strconv"
+	"time"
+)
+
+const (
+	// Name of the repeat count parameter
+	CountParamName = "Count"
+
+	// Name of the pause parameter. Pause is in seconds.
+	PauseParamName = "PauseSecs"
+)
+
+const (
+	kInnerKey = "Inner"
+)
+
+// RepeatFactory implements Factory by wrapping another Factory. It
+// generates an ops.HueAction that does the ops.HueAction the wrapped
+// Factory generates a user supplied number of times with a user supplied
+// pause in between. The parameters of a RepeatFactory are the parameters
+// of the wrapped Factory followed by the count and pause parameters.
+type RepeatFactory struct {
+	inner Factory
+}
+
+// Repeat returns a RepeatFactory that wraps inner. If inner implements
+// Encoder and Decoder, Repeat returns a *RepeatEncoderDecoder so that the
+// returned factory implements them too; otherwise Repeat returns a
+// *RepeatFactory.
+func Repeat(inner Factory) Factory {
+	factory := &RepeatFactory{inner: inner}
+	if _, ok := inner.(FactoryEncoderDecoder); ok {
+		return &RepeatEncoderDecoder{RepeatFactory: factory}
+	}
+	return factory
+}
+
+func (f *RepeatFactory) Params() NamedParamList {
+	innerParams := f.inner.Params()
+	result := make(NamedParamList, len(innerParams), len(innerParams)+2)
+	copy(result, innerParams)
+	return append(result, kRepeatParams...)
+}
+
+func (f *RepeatFactory) New(values []interface{}) ops.HueAction {
+	innerLen := len(values) - len(kRepeatParams)
+	return &RepeatAction{
+		Action: f.inner.New(values[:innerLen]),
+		Count:  values[innerLen].(int),
+		Pause:  time.Duration(values[innerLen+1].(int)) * time.Second,
+	}
+}
+
+// action and actionParamsAsStrings are what the NewExplicit method of the
+// wrapped Factory returns; count is the number of times to do action;
+// pause is the pause between each time rounded down to the nearest second.
+func (f *RepeatFactory) NewExplicit(
+	action ops.HueAction,
+	actionParamsAsStrings []string,
+	count int,
+	pause time.Duration) (
+	repeatAction ops.HueAction, paramsAsStrings []string) {
+	pauseSecs := int(pause / time.Second)
+	repeatAction = &RepeatAction{
+		Action: action,
+		Count:  count,
+		Pause:  time.Duration(pauseSecs) * time.Second,
+	}
+	paramsAsStrings = make(
+		[]string, len(actionParamsAsStrings), len(actionParamsAsStrings)+2)
+	copy(paramsAsStrings, actionParamsAsStrings)
+	paramsAsStrings = append(
+		paramsAsStrings, strconv.Itoa(count), strconv.Itoa(pauseSecs))
+	return
+}
+
+// RepeatEncoderDecoder is a RepeatFactory wrapping a Factory that
+// implements Encoder and Decoder. Repeat creates these instances.
+type RepeatEncoderDecoder struct {
+	*RepeatFactory
+}
+
+// Encode encodes a HueAction that this instance created as a string.
+func (f *RepeatEncoderDecoder) Encode(action ops.HueAction) string {
+	r := action.(*RepeatAction)
+	serializer := make(ParamSerializer)
+	serializer.SetInt(CountParamName, r.Count)
+	serializer.SetInt(PauseParamName, int(r.Pause/time.Second))
+	serializer.SetString(kInnerKey, f.inner.(Encoder).Encode(r.Action))
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+func (f *RepeatEncoderDecoder) Decode(s string) (
+	action ops.HueAction, err error) {
+	serializer, err := NewParamSerializer(s)
+	if err != nil {
+		return
+	}
+	var result RepeatAction
+	if result.Count, err = serializer.GetInt(CountParamName); err != nil {
+		return
+	}
+	pauseSecs, err := serializer.GetInt(PauseParamName)
+	if err != nil {
+		return
+	}
+	result.Pause = time.Duration(pauseSecs) * time.Second
+	innerEncoded, err := serializer.GetString(kInnerKey)
+	if err != nil {
+		return
+	}
+	if result.Action, err = f.inner.(Decoder).Decode(
+		innerEncoded); err != nil {
+		return
+	}
+	action = &result
+	return
+}
+
+// RepeatAction is the ops.HueAction that RepeatFactory generates.
+// These instances must be treated as immutable.
+type RepeatAction struct {
+
+	// The action to repeat
+	Action ops.HueAction
+
+	// The number of times to do Action
+	Count int
+
+	// The pause between each time
+	Pause time.Duration
+}
+
+// Do does Action Count times pausing for Pause between each time. Do
+// stops early if the execution ends or reports an error. If Action runs
+// until interrupted, Do never gets past the first time.
+func (r *RepeatAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	for i := 0; i < r.Count; i++ {
+		if i > 0 && !e.Sleep(r.Pause) {
+			return
+		}
+		r.Action.Do(ctxt, lightSet, e)
+		if e.IsEnded() || e.Error() != nil {
+			return
+		}
+	}
+}
+
+func (r *RepeatAction) UsedLights(lightSet lights.Set) lights.Set {
+	return r.Action.UsedLights(lightSet)
+}
+
+var (
+	kRepeatParams = NamedParamList{
+		{
+			Name:  CountParamName,
+			Param: Int(1, 20, 3, 2),
+			Unit:  "times",
+			Group: "Repeat",
+		},
+		{
+			Name:  PauseParamName,
+			Param: Int(0, 3600, 1, 4),
+			Unit:  "seconds",
+			Group: "Repeat",
+		},
+	}
+)
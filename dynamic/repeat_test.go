@@ -0,0 +1,117 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/dynamic/testutils"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/tasks"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepeatFactory(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          117,
+		Description: "Flash",
+		Factory:     dynamic.Repeat(dynamic.PlainFactory{}),
+	}
+	params := aTask.Params()
+	if len(params) != 4 || params[2].Name != "Count" || params[3].Name != "PauseSecs" {
+		t.Fatalf("Unexpected params %v", params)
+	}
+	urlValues := make(url.Values)
+	urlValues.Set("p0", "1")
+	urlValues.Set("p1", "100")
+	urlValues.Set("p2", "4")
+	urlValues.Set("p3", "2")
+	actual := aTask.FromUrlValues("p", urlValues)
+	expectedDescription := "Flash Color: Red Bri: 100 Count: 4 PauseSecs: 2"
+	if actual.Description != expectedDescription {
+		t.Errorf("Expected %s, got %s", expectedDescription, actual.Description)
+	}
+	plain := dynamic.PlainFactory{}
+	innerAction, innerStrings := plain.NewExplicit(gohue.Red, "Red", 100)
+	expectedAction, expectedStrings := aTask.Factory.(*dynamic.RepeatEncoderDecoder).NewExplicit(
+		innerAction, innerStrings, 4, 2500*time.Millisecond)
+	if !reflect.DeepEqual(expectedAction, actual.HueAction) {
+		t.Errorf("Expected %v, got %v", expectedAction, actual.HueAction)
+	}
+	if out := aTask.FromExplicit(expectedAction, expectedStrings).Description; out != expectedDescription {
+		t.Errorf("Expected %s, got %s", expectedDescription, out)
+	}
+	testutils.VerifySerialization(t, aTask.Factory, actual.HueAction)
+}
+
+func TestRepeatNotEncoder(t *testing.T) {
+	factory := dynamic.Repeat(notEncoderFactory{})
+	if _, ok := factory.(dynamic.Encoder); ok {
+		t.Error("Expected factory not to be an Encoder.")
+	}
+	if _, ok := factory.(dynamic.Decoder); ok {
+		t.Error("Expected factory not to be a Decoder.")
+	}
+	if _, ok := factory.(*dynamic.RepeatFactory); !ok {
+		t.Errorf("Expected *RepeatFactory, got %T", factory)
+	}
+}
+
+func TestRepeatEncodesPauseInSeconds(t *testing.T) {
+	factory := dynamic.Repeat(dynamic.PlainFactory{}).(*dynamic.RepeatEncoderDecoder)
+	plain := dynamic.PlainFactory{}
+	innerAction, innerStrings := plain.NewExplicit(gohue.Red, "Red", 100)
+	action, _ := factory.NewExplicit(
+		innerAction, innerStrings, 2, 90*time.Second)
+	serializer, err := dynamic.NewParamSerializer(factory.Encode(action))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := serializer.GetInt("PauseSecs"); err != nil || out != 90 {
+		t.Errorf("Expected 90, got %d, %v", out, err)
+	}
+}
+
+// notEncoderFactory is a Factory that implements neither Encoder nor
+// Decoder.
+type notEncoderFactory struct {
+}
+
+func (f notEncoderFactory) Params() dynamic.NamedParamList {
+	return nil
+}
+
+func (f notEncoderFactory) New(values []interface{}) ops.HueAction {
+	return &countingAction{}
+}
+
+func TestRepeatActionDo(t *testing.T) {
+	counter := &countingAction{}
+	action := &dynamic.RepeatAction{Action: counter, Count: 3}
+	if err := tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		action.Do(make(contextForTesting), lights.New(2), e)
+	})); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if counter.count != 3 {
+		t.Errorf("Expected 3, got %d", counter.count)
+	}
+	if out := action.UsedLights(lights.New(2)); out.String() != "2" {
+		t.Errorf("Expected 2, got %v", out)
+	}
+}
+
+type countingAction struct {
+	count int
+}
+
+func (c *countingAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	c.count++
+}
+
+func (c *countingAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
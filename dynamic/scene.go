@@ -0,0 +1,160 @@
+package dynamic
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/tasks"
+	"sort"
+	"strings"
+)
+
+const (
+	// Name of the scene parameter
+	SceneParamName = "Scene"
+)
+
+// NamedColorsRunner fetches all the stored scenes. Implementations of
+// huedb.NamedColorsRunner satisfy this interface.
+type NamedColorsRunner interface {
+	// NamedColors gets all named colors.
+	NamedColors(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+// SceneStore fetches stored scenes all at once or one at a time by id.
+// Implementations of both huedb.NamedColorsRunner and
+// huedb.NamedColorsByIdRunner satisfy this interface.
+type SceneStore interface {
+	NamedColorsRunner
+
+	// NamedColorsById gets one scene by id.
+	NamedColorsById(t db.Transaction, id int64, scene *ops.NamedColors) error
+}
+
+// SceneFactory implements Factory and lets user pick one of the scenes
+// stored in a database. It generates an ops.HueAction that sets the lights
+// to the picked scene. Since scenes can change at any time, the scene
+// choices are fetched from the database each time Params is called.
+type SceneFactory struct {
+	store     SceneStore
+	presorted bool
+}
+
+// NewSceneFactory returns a SceneFactory that fetches scenes from store.
+func NewSceneFactory(store SceneStore) *SceneFactory {
+	return &SceneFactory{store: store}
+}
+
+// NewPresortedSceneFactory works like NewSceneFactory except that store
+// already returns the scenes sorted by description so the returned
+// SceneFactory does not sort them again.
+// huedb.OrderedSceneStore makes such a store.
+func NewPresortedSceneFactory(store SceneStore) *SceneFactory {
+	return &SceneFactory{store: store, presorted: true}
+}
+
+// Params returns a picker of all the stored scenes sorted by description.
+// If the scenes cannot be fetched, the picker will have no choices.
+func (f *SceneFactory) Params() NamedParamList {
+	scenes, _ := fetchScenes(f.store, f.presorted)
+	choices := make(ChoiceList, len(scenes))
+	for i := range scenes {
+		choices[i] = Choice{Name: scenes[i].Description, Value: scenes[i]}
+	}
+	return NamedParamList{
+		{
+			Name:  SceneParamName,
+			Param: Picker(choices, (*ops.NamedColors)(nil), "None"),
+		},
+	}
+}
+
+func (f *SceneFactory) New(values []interface{}) ops.HueAction {
+	return newSceneAction(values[0].(*ops.NamedColors))
+}
+
+// scene is the stored scene. NewExplicit uses the description of scene
+// as its string representation.
+func (f *SceneFactory) NewExplicit(scene *ops.NamedColors) (
+	action ops.HueAction, paramsAsStrings []string) {
+	return newSceneAction(scene), []string{scene.Description}
+}
+
+// Encode encodes a HueAction that this instance created as a string
+func (f *SceneFactory) Encode(action ops.HueAction) string {
+	serializer := make(ParamSerializer)
+	serializer.SetInt(SceneParamName, int(action.(*SceneAction).Id))
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+// Decode reads the scene from the database by id so that changes to the
+// scene made after encoding are reflected in the returned HueAction. If
+// the scene is no longer in the database, Decode returns the error that
+// the store reports for a missing id, huedb.ErrNoSuchId for the huedb
+// stores.
+func (f *SceneFactory) Decode(s string) (action ops.HueAction, err error) {
+	serializer, err := NewParamSerializer(s)
+	if err != nil {
+		return
+	}
+	id, err := serializer.GetInt(SceneParamName)
+	if err != nil {
+		return
+	}
+	if id == 0 {
+		return newSceneAction(nil), nil
+	}
+	var scene ops.NamedColors
+	if err = f.store.NamedColorsById(nil, int64(id), &scene); err != nil {
+		return
+	}
+	return newSceneAction(&scene), nil
+}
+
+// fetchScenes fetches all the scenes in store sorted by description
+// ignoring case. If presorted is true, store already returns the scenes
+// in that order.
+func fetchScenes(store NamedColorsRunner, presorted bool) (
+	[]*ops.NamedColors, error) {
+	var result []*ops.NamedColors
+	if err := store.NamedColors(
+		nil, goconsume.AppendPtrsTo(&result)); err != nil {
+		return nil, err
+	}
+	if presorted {
+		return result, nil
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return strings.ToLower(result[i].Description) < strings.ToLower(result[j].Description)
+	})
+	return result, nil
+}
+
+// SceneAction is the ops.HueAction that SceneFactory generates.
+// These instances must be treated as immutable.
+type SceneAction struct {
+	// The id of the stored scene. 0 means no scene.
+	Id int64
+	ops.StaticHueAction
+}
+
+// Do sets the lights to the scene. Do does nothing if there is no scene.
+func (a *SceneAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	if len(a.StaticHueAction) == 0 {
+		return
+	}
+	a.StaticHueAction.Do(ctxt, a.UsedLights(lightSet), e)
+}
+
+func newSceneAction(scene *ops.NamedColors) *SceneAction {
+	if scene == nil {
+		return &SceneAction{}
+	}
+	return &SceneAction{
+		Id:              scene.Id,
+		StaticHueAction: ops.StaticHueAction(scene.Colors),
+	}
+}
@@ -0,0 +1,166 @@
+package dynamic_test
+
+import (
+	"errors"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/dynamic/testutils"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+var (
+	errNoSuchId = errors.New("No such id.")
+
+	kRoomColors = ops.LightColors{
+		2: {Color: gohue.NewMaybeColor(gohue.Red),
+			Brightness: maybe.NewUint8(99)},
+	}
+	kKitchenColors = ops.LightColors{
+		5: {Color: gohue.NewMaybeColor(gohue.Blue),
+			Brightness: maybe.NewUint8(45)},
+	}
+)
+
+func TestSceneFactory(t *testing.T) {
+	store := fakeNamedColorsRunner{
+		{Id: 3, Colors: kRoomColors, Description: "room"},
+		{Id: 7, Colors: kKitchenColors, Description: "Kitchen"},
+	}
+	aTask := &dynamic.HueTask{
+		Id:          113,
+		Description: "Scene",
+		Factory:     dynamic.NewSceneFactory(store),
+	}
+	params := aTask.Params()
+	expectedSelection := []string{"--Pick one--", "Kitchen", "room"}
+	if out := params[0].Selection(); !reflect.DeepEqual(expectedSelection, out) {
+		t.Errorf("Expected %v, got %v", expectedSelection, out)
+	}
+	urlValues := make(url.Values)
+	urlValues.Set("p0", "2")
+	actual := aTask.FromUrlValues("p", urlValues)
+	if actual.Description != "Scene Scene: room" {
+		t.Errorf("Expected 'Scene Scene: room', got %s", actual.Description)
+	}
+	expected := &dynamic.SceneAction{
+		Id:              3,
+		StaticHueAction: ops.StaticHueAction(kRoomColors),
+	}
+	if !reflect.DeepEqual(expected, actual.HueAction) {
+		t.Errorf("Expected %v, got %v", expected, actual.HueAction)
+	}
+	testutils.VerifySerialization(t, aTask.Factory, actual.HueAction)
+
+	factory := aTask.Factory.(*dynamic.SceneFactory)
+	encoded := factory.Encode(actual.HueAction)
+	_, err := dynamic.NewSceneFactory(store[1:]).Decode(encoded)
+	if err != errNoSuchId {
+		t.Errorf("Expected errNoSuchId, got %v", err)
+	}
+}
+
+func TestSceneFactoryDecodeById(t *testing.T) {
+	store := &countingNamedColorsRunner{
+		fakeNamedColorsRunner: fakeNamedColorsRunner{
+			{Id: 3, Colors: kRoomColors, Description: "room"},
+			{Id: 7, Colors: kKitchenColors, Description: "Kitchen"},
+		},
+	}
+	factory := dynamic.NewSceneFactory(store)
+	decoded, err := factory.Decode(`{"Scene":["7"]}`)
+	if err != nil {
+		t.Fatalf("Got error decoding: %v", err)
+	}
+	expected := &dynamic.SceneAction{
+		Id:              7,
+		StaticHueAction: ops.StaticHueAction(kKitchenColors),
+	}
+	if !reflect.DeepEqual(expected, decoded) {
+		t.Errorf("Expected %v, got %v", expected, decoded)
+	}
+	if store.count != 0 {
+		t.Errorf("Expected no scans of all scenes, got %d", store.count)
+	}
+}
+
+func TestPresortedSceneFactory(t *testing.T) {
+	store := fakeNamedColorsRunner{
+		{Id: 3, Colors: kRoomColors, Description: "room"},
+		{Id: 7, Colors: kKitchenColors, Description: "Kitchen"},
+	}
+	params := dynamic.NewPresortedSceneFactory(store).Params()
+	expectedSelection := []string{"--Pick one--", "room", "Kitchen"}
+	if out := params[0].Selection(); !reflect.DeepEqual(expectedSelection, out) {
+		t.Errorf("Expected %v, got %v", expectedSelection, out)
+	}
+}
+
+func TestSceneFactoryNoScene(t *testing.T) {
+	store := &countingNamedColorsRunner{
+		fakeNamedColorsRunner: fakeNamedColorsRunner{
+			{Id: 3, Colors: kRoomColors, Description: "room"},
+		},
+	}
+	aTask := &dynamic.HueTask{
+		Id:          113,
+		Description: "Scene",
+		Factory:     dynamic.NewSceneFactory(store),
+	}
+	actual := aTask.FromUrlValues("p", make(url.Values))
+	if store.count != 1 {
+		t.Errorf("Expected scenes fetched once, got %d", store.count)
+	}
+	ctxt := make(contextForTesting)
+	if err := tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		actual.Do(ctxt, lights.All, e)
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if len(ctxt) != 0 {
+		t.Errorf("Expected no lights set, got %v", ctxt)
+	}
+}
+
+type fakeNamedColorsRunner []*ops.NamedColors
+
+func (f fakeNamedColorsRunner) NamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	for i := range f {
+		if !consumer.CanConsume() {
+			break
+		}
+		namedColors := *f[i]
+		consumer.Consume(&namedColors)
+	}
+	return nil
+}
+
+func (f fakeNamedColorsRunner) NamedColorsById(
+	t db.Transaction, id int64, scene *ops.NamedColors) error {
+	for i := range f {
+		if f[i].Id == id {
+			*scene = *f[i]
+			return nil
+		}
+	}
+	return errNoSuchId
+}
+
+type countingNamedColorsRunner struct {
+	fakeNamedColorsRunner
+	count int
+}
+
+func (c *countingNamedColorsRunner) NamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	c.count++
+	return c.fakeNamedColorsRunner.NamedColors(t, consumer)
+}
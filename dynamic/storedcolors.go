@@ -0,0 +1,109 @@
+package dynamic
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/ops"
+	"strings"
+)
+
+// ColorPickerFromStore works like ColorPicker except that in addition to
+// the built-in colors, the returned picker offers the colors of the
+// single color scenes in store sorted by description. A single color
+// scene is one where every light with a color has the same color. Stored
+// scenes with the same name as a built-in color are skipped. The returned
+// picker fetches the scenes each time it is used so that it always offers
+// the current choices. If the scenes cannot be fetched, the returned
+// picker offers only the built-in colors.
+//
+// Pass the returned picker to the factories that accept a color picker,
+// NewPlainFactory and NewPerLightFactory:
+//
+//	NewPlainFactory(ColorPickerFromStore(store, gohue.White, "White"))
+//
+// Factories with a built-in color parameter such as StrobeFactory still
+// offer only the built-in colors.
+func ColorPickerFromStore(
+	store NamedColorsRunner,
+	defaultColor gohue.Color,
+	defaultName string) Param {
+	return &storedColorPicker{
+		store:        store,
+		defaultColor: defaultColor,
+		defaultName:  defaultName,
+	}
+}
+
+type storedColorPicker struct {
+	store        NamedColorsRunner
+	defaultColor gohue.Color
+	defaultName  string
+}
+
+func (p *storedColorPicker) Selection() []string {
+	return p.picker().Selection()
+}
+
+func (p *storedColorPicker) MaxCharCount() int {
+	return p.picker().MaxCharCount()
+}
+
+func (p *storedColorPicker) Convert(s string) (interface{}, string) {
+	return p.picker().Convert(s)
+}
+
+func (p *storedColorPicker) ConvertStrict(s string) (
+	interface{}, string, error) {
+	return p.picker().ConvertStrict(s)
+}
+
+// picker returns a picker with the current choices.
+func (p *storedColorPicker) picker() *picker {
+	return &picker{
+		Choices:      ColorChoicesFromStore(p.store),
+		DefaultValue: p.defaultColor,
+		DefaultName:  p.defaultName,
+	}
+}
+
+// ColorChoicesFromStore returns the choices that ColorPickerFromStore
+// uses.
+func ColorChoicesFromStore(store NamedColorsRunner) ChoiceList {
+	scenes, err := fetchScenes(store, false)
+	if err != nil {
+		return kColorChoices
+	}
+	result := make(ChoiceList, len(kColorChoices), len(kColorChoices)+len(scenes))
+	copy(result, kColorChoices)
+	names := make(map[string]bool, len(kColorChoices))
+	for _, choice := range kColorChoices {
+		names[strings.ToLower(choice.Name)] = true
+	}
+	for _, scene := range scenes {
+		color, ok := singleColor(scene.Colors)
+		if !ok || names[strings.ToLower(scene.Description)] {
+			continue
+		}
+		names[strings.ToLower(scene.Description)] = true
+		result = append(result, Choice{Name: scene.Description, Value: color})
+	}
+	return result
+}
+
+// singleColor returns the one color in colors. singleColor returns false
+// if colors has no color or more than one color.
+func singleColor(colors ops.LightColors) (result gohue.Color, ok bool) {
+	for _, cb := range colors {
+		if !cb.Color.Valid {
+			continue
+		}
+		if !ok {
+			result, ok = cb.Color.Color, true
+			continue
+		}
+		if cb.Color.Color != result {
+			var zero gohue.Color
+			return zero, false
+		}
+	}
+	return
+}
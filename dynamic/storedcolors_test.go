@@ -0,0 +1,87 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"testing"
+)
+
+func TestColorPickerFromStore(t *testing.T) {
+	teal := gohue.NewColor(0.17, 0.34)
+	store := fakeNamedColorsRunner{
+		{
+			Id: 1,
+			Colors: ops.LightColors{
+				1: {Color: gohue.NewMaybeColor(teal),
+					Brightness: maybe.NewUint8(50)},
+				2: {Color: gohue.NewMaybeColor(teal),
+					Brightness: maybe.Uint8{}},
+				3: {Color: gohue.MaybeColor{}, Brightness: maybe.NewUint8(10)},
+			},
+			Description: "teal",
+		},
+		{Id: 2, Colors: kRoomColors, Description: "Crimson"},
+		{
+			Id: 3,
+			Colors: ops.LightColors{
+				1: {Color: gohue.NewMaybeColor(gohue.Red),
+					Brightness: maybe.Uint8{}},
+				2: {Color: gohue.NewMaybeColor(gohue.Blue),
+					Brightness: maybe.Uint8{}},
+			},
+			Description: "Mixed",
+		},
+		{
+			Id: 4,
+			Colors: ops.LightColors{
+				0: {Color: gohue.MaybeColor{}, Brightness: maybe.NewUint8(0)},
+			},
+			Description: "Off",
+		},
+		{Id: 5, Colors: kKitchenColors, Description: "red"},
+	}
+	picker := dynamic.ColorPickerFromStore(store, gohue.White, "White")
+	selection := picker.Selection()
+	if len(selection) != 13 {
+		t.Fatalf("Expected 13 choices, got %v", selection)
+	}
+	if out := selection[11:]; out[0] != "Crimson" || out[1] != "teal" {
+		t.Errorf("Expected [Crimson teal], got %v", out)
+	}
+	value, name := picker.Convert("12")
+	if value != teal || name != "teal" {
+		t.Errorf("Expected teal, got %v %s", value, name)
+	}
+	value, name = picker.Convert("")
+	if value != gohue.White || name != "White" {
+		t.Errorf("Expected White, got %v %s", value, name)
+	}
+}
+
+func TestColorPickerFromStoreFresh(t *testing.T) {
+	store := &countingNamedColorsRunner{}
+	params := dynamic.NewPlainFactory(
+		dynamic.ColorPickerFromStore(store, gohue.White, "White")).Params()
+	if out := len(params[0].Selection()); out != 11 {
+		t.Errorf("Expected 11 choices, got %d", out)
+	}
+	teal := gohue.NewColor(0.17, 0.34)
+	store.fakeNamedColorsRunner = append(
+		store.fakeNamedColorsRunner,
+		&ops.NamedColors{
+			Id: 1,
+			Colors: ops.LightColors{
+				0: {Color: gohue.NewMaybeColor(teal)},
+			},
+			Description: "teal",
+		})
+	if out := len(params[0].Selection()); out != 12 {
+		t.Errorf("Expected 12 choices, got %d", out)
+	}
+	value, name := params[0].Convert("11")
+	if value != teal || name != "teal" {
+		t.Errorf("Expected teal, got %v %s", value, name)
+	}
+}
@@ -0,0 +1,226 @@
+package dynamic
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"strconv"
+	"time"
+)
+
+const (
+	// Name of the frequency parameter. Frequency is in hertz.
+	FrequencyParamName = "Hz"
+
+	// The maximum frequency of a strobe in hertz. Each cycle of a strobe
+	// sends two commands to the bridge for each light.
+	MaxStrobeFrequency = 5
+
+	// The maximum duration of a strobe.
+	MaxStrobeDuration = time.Minute
+)
+
+// StrobeFactory implements Factory and lets user provide a color,
+// brightness, frequency in hertz, and duration in seconds. It generates
+// an ops.HueAction that flashes the lights on and off. To protect the
+// bridge, frequency is capped at MaxStrobeFrequency and duration is capped
+// at MaxStrobeDuration.
+type StrobeFactory struct {
+}
+
+func (f StrobeFactory) Params() NamedParamList {
+	return kStrobeFactory.Params()
+}
+
+func (f StrobeFactory) New(values []interface{}) ops.HueAction {
+	return kStrobeFactory.New(values)
+}
+
+// color is the color of the strobe; colorString is the string
+// representation of color; brightness is the brightness of the strobe;
+// frequency is in hertz; duration is rounded down to the nearest second.
+// NewExplicit caps frequency and duration.
+func (f StrobeFactory) NewExplicit(
+	color gohue.Color,
+	colorString string,
+	brightness uint8,
+	frequency int,
+	duration time.Duration) (action ops.HueAction, paramsAsStrings []string) {
+	strobe := newStrobeAction(
+		color,
+		brightness,
+		frequency,
+		duration/time.Second*time.Second)
+	paramsAsStrings = []string{
+		colorString,
+		strconv.Itoa(int(brightness)),
+		strconv.Itoa(strobe.Frequency),
+		strconv.Itoa(int(strobe.Duration / time.Second)),
+	}
+	return strobe, paramsAsStrings
+}
+
+// Encode encodes a HueAction that this instance created as a string
+func (f StrobeFactory) Encode(action ops.HueAction) string {
+	s := action.(*StrobeAction)
+	serializer := make(ParamSerializer)
+	serializer.SetColor(ColorParamName, s.Color)
+	serializer.SetBrightness(BrightnessParamName, s.Brightness)
+	serializer.SetInt(FrequencyParamName, s.Frequency)
+	serializer.SetInt(DurationParamName, int(s.Duration/time.Second))
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+// Decode caps frequency and duration.
+func (f StrobeFactory) Decode(s string) (action ops.HueAction, err error) {
+	serializer, err := NewParamSerializer(s)
+	if err != nil {
+		return
+	}
+	color, err := serializer.GetColor(ColorParamName)
+	if err != nil {
+		return
+	}
+	brightness, err := serializer.GetBrightness(BrightnessParamName)
+	if err != nil {
+		return
+	}
+	frequency, err := serializer.GetInt(FrequencyParamName)
+	if err != nil {
+		return
+	}
+	secs, err := serializer.GetInt(DurationParamName)
+	if err != nil {
+		return
+	}
+	action = newStrobeAction(
+		color, brightness, frequency, time.Duration(secs)*time.Second)
+	return
+}
+
+// StrobeAction is the ops.HueAction that StrobeFactory generates.
+// These instances must be treated as immutable.
+type StrobeAction struct {
+	Color      gohue.Color
+	Brightness uint8
+	Frequency  int
+	Duration   time.Duration
+}
+
+func (s *StrobeAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	safe := newStrobeAction(s.Color, s.Brightness, s.Frequency, s.Duration)
+	halfPeriod := time.Second / time.Duration(2*safe.Frequency)
+	// The bridge's default transition is longer than halfPeriod so the
+	// lights would never reach either state.
+	on := ops.StaticHueAction{
+		0: ops.ColorBrightness{
+			Color:          gohue.NewMaybeColor(safe.Color),
+			Brightness:     maybe.NewUint8(safe.Brightness),
+			TransitionTime: maybe.NewUint16(0),
+		},
+	}
+	off := ops.StaticHueAction{
+		0: ops.ColorBrightness{TransitionTime: maybe.NewUint16(0)},
+	}
+	end := e.Now().Add(safe.Duration)
+	for e.Now().Before(end) {
+		on.Do(ctxt, lightSet, e)
+		if e.Error() != nil || !e.Sleep(halfPeriod) {
+			return
+		}
+		off.Do(ctxt, lightSet, e)
+		if e.Error() != nil || !e.Sleep(halfPeriod) {
+			return
+		}
+	}
+}
+
+func (s *StrobeAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+func newStrobeAction(
+	color gohue.Color,
+	brightness uint8,
+	frequency int,
+	duration time.Duration) *StrobeAction {
+	if frequency < 1 {
+		frequency = 1
+	}
+	if frequency > MaxStrobeFrequency {
+		frequency = MaxStrobeFrequency
+	}
+	if duration < 0 {
+		duration = 0
+	}
+	if duration > MaxStrobeDuration {
+		duration = MaxStrobeDuration
+	}
+	return &StrobeAction{
+		Color:      color,
+		Brightness: brightness,
+		Frequency:  frequency,
+		Duration:   duration,
+	}
+}
+
+// strobeParams holds the values the user supplies to StrobeFactory.
+type strobeParams struct {
+	Color      gohue.Color
+	Brightness int
+	Frequency  int
+	Seconds    int
+}
+
+type typedStrobeFactory struct {
+}
+
+func (f typedStrobeFactory) Fields() []TypedField[strobeParams] {
+	return kStrobeFields
+}
+
+func (f typedStrobeFactory) New(p strobeParams) ops.HueAction {
+	return newStrobeAction(
+		p.Color,
+		uint8(p.Brightness),
+		p.Frequency,
+		time.Duration(p.Seconds)*time.Second)
+}
+
+var (
+	kStrobeFields = []TypedField[strobeParams]{
+		Field(
+			NamedParam{
+				Name:  ColorParamName,
+				Param: ColorPicker(gohue.White, "White"),
+			},
+			func(p *strobeParams) *gohue.Color { return &p.Color }),
+		Field(
+			NamedParam{
+				Name:  BrightnessParamName,
+				Param: Brightness(),
+				Help:  kBrightnessHelp,
+			},
+			func(p *strobeParams) *int { return &p.Brightness }),
+		Field(
+			NamedParam{
+				Name:  FrequencyParamName,
+				Param: Int(1, MaxStrobeFrequency, 2, 1),
+				Unit:  "Hz",
+			},
+			func(p *strobeParams) *int { return &p.Frequency }),
+		Field(
+			NamedParam{
+				Name: DurationParamName,
+				Param: Slider(
+					1, int(MaxStrobeDuration/time.Second), 10, 1),
+				Unit: "seconds",
+			},
+			func(p *strobeParams) *int { return &p.Seconds }),
+	}
+	kStrobeFactory = FromTyped[strobeParams](typedStrobeFactory{})
+)
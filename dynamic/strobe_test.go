@@ -0,0 +1,111 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/dynamic/testutils"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStrobeFactoryNewExplicit(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          112,
+		Description: "Strobe",
+		Factory:     dynamic.StrobeFactory{},
+	}
+	actual := aTask.FromExplicit(
+		aTask.Factory.(dynamic.StrobeFactory).NewExplicit(
+			gohue.Red, "Red", 255, 3, 15*time.Second))
+	expectedDescription := "Strobe Color: Red Bri: 255 Hz: 3 Secs: 15"
+	if actual.Description != expectedDescription {
+		t.Errorf("Expected %s, got %s", expectedDescription, actual.Description)
+	}
+	testutils.VerifySerialization(t, aTask.Factory, actual.HueAction)
+}
+
+func TestStrobeFactoryLimits(t *testing.T) {
+	factory := dynamic.StrobeFactory{}
+	action, paramsAsStrings := factory.NewExplicit(
+		gohue.Red, "Red", 255, 20, time.Hour)
+	expected := &dynamic.StrobeAction{
+		Color:      gohue.Red,
+		Brightness: 255,
+		Frequency:  dynamic.MaxStrobeFrequency,
+		Duration:   dynamic.MaxStrobeDuration,
+	}
+	if !reflect.DeepEqual(expected, action) {
+		t.Errorf("Expected %v, got %v", expected, action)
+	}
+	expectedStrings := []string{"Red", "255", "5", "60"}
+	if !reflect.DeepEqual(expectedStrings, paramsAsStrings) {
+		t.Errorf("Expected %v, got %v", expectedStrings, paramsAsStrings)
+	}
+	action = factory.New([]interface{}{gohue.Red, 255, 20, 3600})
+	if !reflect.DeepEqual(expected, action) {
+		t.Errorf("Expected %v, got %v", expected, action)
+	}
+	encoded := `{"Color":["6750","3220"],"Bri":["255"],"Hz":["20"],"Secs":["3600"]}`
+	decoded, err := factory.Decode(encoded)
+	if err != nil {
+		t.Fatalf("Got error decoding: %v", err)
+	}
+	decodedStrobe := decoded.(*dynamic.StrobeAction)
+	if decodedStrobe.Frequency != dynamic.MaxStrobeFrequency || decodedStrobe.Duration != dynamic.MaxStrobeDuration {
+		t.Errorf("Expected frequency and duration to be capped, got %v", decodedStrobe)
+	}
+}
+
+func TestStrobeActionDoNoTransition(t *testing.T) {
+	action := &dynamic.StrobeAction{
+		Color:      gohue.Red,
+		Brightness: 200,
+		Frequency:  dynamic.MaxStrobeFrequency,
+		Duration:   time.Second,
+	}
+	ctxt := &recordingContext{}
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 6, 21, 8, 0, 0, 0, time.UTC)}
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		action.Do(ctxt, lights.New(3), e)
+	}), clock); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if out := len(ctxt.sent); out != 2*dynamic.MaxStrobeFrequency {
+		t.Fatalf("Expected %d commands, got %d", 2*dynamic.MaxStrobeFrequency, out)
+	}
+	on := gohue.LightProperties{
+		C:              gohue.NewMaybeColor(gohue.Red),
+		Bri:            maybe.NewUint8(200),
+		On:             maybe.NewBool(true),
+		TransitionTime: maybe.NewUint16(0),
+	}
+	off := gohue.LightProperties{
+		On:             maybe.NewBool(false),
+		TransitionTime: maybe.NewUint16(0),
+	}
+	for i, properties := range ctxt.sent {
+		expected := on
+		if i%2 == 1 {
+			expected = off
+		}
+		if properties != expected {
+			t.Errorf("Command %d: expected %v, got %v", i, expected, properties)
+		}
+	}
+}
+
+type recordingContext struct {
+	sent []gohue.LightProperties
+}
+
+func (c *recordingContext) Set(
+	lightId int,
+	properties *gohue.LightProperties) (response []byte, err error) {
+	c.sent = append(c.sent, *properties)
+	return
+}
@@ -0,0 +1,195 @@
+package dynamic
+
+import (
+	"fmt"
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"reflect"
+	"time"
+)
+
+// StructEncoderDecoder implements Encoder and Decoder for one type of
+// ops.HueAction by deriving the encoding from the fields of the action's
+// struct type rather than from hand written ParamSerializer code.
+// Factories can embed a *StructEncoderDecoder to get their Encode and
+// Decode methods.
+//
+// Each exported field is stored in a ParamSerializer under the value of
+// its "param" struct tag or if the field has no such tag, under the
+// field's name. A field with a "param" tag of "-" is not stored. Fields
+// can be of the following types: int, uint8 (stored as a brightness),
+// bool, float64, string, time.Duration, gohue.Color, []gohue.Color, and
+// lights.Set.
+type StructEncoderDecoder struct {
+	actionType reflect.Type
+	isPtr      bool
+	fields     []structField
+}
+
+// NewStructEncoderDecoder returns a StructEncoderDecoder for the type of
+// prototype which must be either a struct or a pointer to a struct.
+// Typically, prototype is a nil pointer e.g (*MyAction)(nil). Decode
+// returns a pointer to a struct if prototype is a pointer. Otherwise
+// Decode returns a struct. NewStructEncoderDecoder panics if prototype
+// is not a struct or a pointer to a struct or if any stored field is of
+// an unsupported type.
+func NewStructEncoderDecoder(
+	prototype ops.HueAction) *StructEncoderDecoder {
+	actionType := reflect.TypeOf(prototype)
+	result := &StructEncoderDecoder{}
+	if actionType.Kind() == reflect.Ptr {
+		actionType = actionType.Elem()
+		result.isPtr = true
+	}
+	if actionType.Kind() != reflect.Struct {
+		panic("dynamic: prototype must be a struct or pointer to a struct")
+	}
+	result.actionType = actionType
+	for i := 0; i < actionType.NumField(); i++ {
+		field := actionType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		key := field.Tag.Get("param")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = field.Name
+		}
+		codec, ok := kFieldCodecs[field.Type]
+		if !ok {
+			panic(fmt.Sprintf(
+				"dynamic: Field %s has unsupported type %v",
+				field.Name,
+				field.Type))
+		}
+		result.fields = append(
+			result.fields, structField{idx: i, key: key, codec: codec})
+	}
+	return result
+}
+
+// Encode encodes action as a string. action must be of the same type as
+// the prototype passed to NewStructEncoderDecoder.
+func (s *StructEncoderDecoder) Encode(action ops.HueAction) string {
+	value := reflect.ValueOf(action)
+	if s.isPtr {
+		value = value.Elem()
+	}
+	serializer := make(ParamSerializer)
+	for _, field := range s.fields {
+		field.codec.set(serializer, field.key, value.Field(field.idx))
+	}
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+func (s *StructEncoderDecoder) Decode(encoded string) (ops.HueAction, error) {
+	serializer, err := NewParamSerializer(encoded)
+	if err != nil {
+		return nil, err
+	}
+	ptr := reflect.New(s.actionType)
+	value := ptr.Elem()
+	for _, field := range s.fields {
+		fieldValue, err := field.codec.get(serializer, field.key)
+		if err != nil {
+			return nil, err
+		}
+		value.Field(field.idx).Set(reflect.ValueOf(fieldValue))
+	}
+	if s.isPtr {
+		return ptr.Interface().(ops.HueAction), nil
+	}
+	return value.Interface().(ops.HueAction), nil
+}
+
+type structField struct {
+	idx   int
+	key   string
+	codec fieldCodec
+}
+
+type fieldCodec struct {
+	set func(p ParamSerializer, key string, value reflect.Value)
+	get func(p ParamSerializer, key string) (interface{}, error)
+}
+
+var (
+	kFieldCodecs = map[reflect.Type]fieldCodec{
+		reflect.TypeOf(0): {
+			set: func(p ParamSerializer, key string, value reflect.Value) {
+				p.SetInt(key, int(value.Int()))
+			},
+			get: func(p ParamSerializer, key string) (interface{}, error) {
+				return p.GetInt(key)
+			},
+		},
+		reflect.TypeOf(uint8(0)): {
+			set: func(p ParamSerializer, key string, value reflect.Value) {
+				p.SetBrightness(key, uint8(value.Uint()))
+			},
+			get: func(p ParamSerializer, key string) (interface{}, error) {
+				return p.GetBrightness(key)
+			},
+		},
+		reflect.TypeOf(false): {
+			set: func(p ParamSerializer, key string, value reflect.Value) {
+				p.SetBool(key, value.Bool())
+			},
+			get: func(p ParamSerializer, key string) (interface{}, error) {
+				return p.GetBool(key)
+			},
+		},
+		reflect.TypeOf(0.0): {
+			set: func(p ParamSerializer, key string, value reflect.Value) {
+				p.SetFloat(key, value.Float())
+			},
+			get: func(p ParamSerializer, key string) (interface{}, error) {
+				return p.GetFloat(key)
+			},
+		},
+		reflect.TypeOf(""): {
+			set: func(p ParamSerializer, key string, value reflect.Value) {
+				p.SetString(key, value.String())
+			},
+			get: func(p ParamSerializer, key string) (interface{}, error) {
+				return p.GetString(key)
+			},
+		},
+		reflect.TypeOf(time.Duration(0)): {
+			set: func(p ParamSerializer, key string, value reflect.Value) {
+				p.SetDuration(key, time.Duration(value.Int()))
+			},
+			get: func(p ParamSerializer, key string) (interface{}, error) {
+				return p.GetDuration(key)
+			},
+		},
+		reflect.TypeOf(gohue.Color{}): {
+			set: func(p ParamSerializer, key string, value reflect.Value) {
+				p.SetColor(key, value.Interface().(gohue.Color))
+			},
+			get: func(p ParamSerializer, key string) (interface{}, error) {
+				return p.GetColor(key)
+			},
+		},
+		reflect.TypeOf([]gohue.Color(nil)): {
+			set: func(p ParamSerializer, key string, value reflect.Value) {
+				p.SetColors(key, value.Interface().([]gohue.Color))
+			},
+			get: func(p ParamSerializer, key string) (interface{}, error) {
+				return p.GetColors(key)
+			},
+		},
+		reflect.TypeOf(lights.Set(nil)): {
+			set: func(p ParamSerializer, key string, value reflect.Value) {
+				p.SetLightSet(key, value.Interface().(lights.Set))
+			},
+			get: func(p ParamSerializer, key string) (interface{}, error) {
+				return p.GetLightSet(key)
+			},
+		},
+	}
+)
@@ -0,0 +1,112 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/tasks"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStructEncoderDecoder(t *testing.T) {
+	codec := dynamic.NewStructEncoderDecoder((*allTypesAction)(nil))
+	action := &allTypesAction{
+		Count:      3,
+		Brightness: 200,
+		On:         true,
+		Ratio:      0.25,
+		Name:       "hello",
+		Wait:       2 * time.Minute,
+		Color:      gohue.Red,
+		Colors:     []gohue.Color{gohue.Blue, gohue.Green},
+		Lights:     lights.New(1, 3),
+		Skipped:    7,
+	}
+	encoded := codec.Encode(action)
+	decoded, err := codec.Decode(encoded)
+	if err != nil {
+		t.Fatalf("Got error decoding: %v", err)
+	}
+	action.Skipped = 0
+	if !reflect.DeepEqual(action, decoded) {
+		t.Errorf("Expected %v, got %v", action, decoded)
+	}
+	serializer, _ := dynamic.NewParamSerializer(encoded)
+	if out, _ := serializer.GetInt("N"); out != 3 {
+		t.Errorf("Expected 3 under tag name, got %d", out)
+	}
+	if _, err := codec.Decode("{}"); err != dynamic.ErrNoValue {
+		t.Errorf("Expected ErrNoValue, got %v", err)
+	}
+}
+
+func TestStructEncoderDecoderNonPointer(t *testing.T) {
+	codec := dynamic.NewStructEncoderDecoder(countAction{})
+	decoded, err := codec.Decode(codec.Encode(countAction{Count: 5}))
+	if err != nil {
+		t.Fatalf("Got error decoding: %v", err)
+	}
+	if !reflect.DeepEqual(countAction{Count: 5}, decoded) {
+		t.Errorf("Expected {5}, got %v", decoded)
+	}
+}
+
+func TestStructEncoderDecoderBadType(t *testing.T) {
+	assertPanics(t, func() {
+		dynamic.NewStructEncoderDecoder(badTypeAction{})
+	})
+	assertPanics(t, func() {
+		dynamic.NewStructEncoderDecoder(ops.StaticHueAction{})
+	})
+}
+
+type allTypesAction struct {
+	Count      int `param:"N"`
+	Brightness uint8
+	On         bool
+	Ratio      float64
+	Name       string
+	Wait       time.Duration
+	Color      gohue.Color
+	Colors     []gohue.Color
+	Lights     lights.Set
+	Skipped    int `param:"-"`
+}
+
+func (a *allTypesAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+}
+
+func (a *allTypesAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+type countAction struct {
+	Count int
+}
+
+func (a countAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+}
+
+func (a countAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+type badTypeAction struct {
+	countAction
+	Bad []int
+}
+
+func assertPanics(t *testing.T, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic")
+		}
+	}()
+	f()
+}
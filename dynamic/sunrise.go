@@ -0,0 +1,152 @@
+package dynamic
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"strconv"
+	"time"
+)
+
+const (
+	// Name of the duration in minutes parameter
+	MinutesParamName = "Mins"
+
+	// Name of the color temperature parameter. Color temperature is in
+	// kelvin.
+	KelvinParamName = "Kelvin"
+)
+
+var (
+	// The color a sunrise starts with.
+	kDeepRed = gohue.NewColor(0.675, 0.322)
+)
+
+// SunriseFactory implements Factory and lets user provide a duration in
+// minutes, a target brightness, and a target color temperature in kelvin.
+// It generates an ops.HueAction that simulates a sunrise by ramping the
+// lights from a deep red at minimum brightness to the target color
+// temperature and brightness over the duration.
+type SunriseFactory struct {
+}
+
+func (f SunriseFactory) Params() NamedParamList {
+	return kSunriseParams
+}
+
+func (f SunriseFactory) New(values []interface{}) ops.HueAction {
+	return &SunriseAction{
+		Duration:   time.Duration(values[0].(int)) * time.Minute,
+		Brightness: uint8(values[1].(int)),
+		Kelvin:     values[2].(int),
+	}
+}
+
+// duration is the length of the sunrise rounded down to the nearest
+// minute; brightness is the target brightness; kelvin is the target
+// color temperature.
+func (f SunriseFactory) NewExplicit(
+	duration time.Duration, brightness uint8, kelvin int) (
+	action ops.HueAction, paramsAsStrings []string) {
+	mins := int(duration / time.Minute)
+	action = &SunriseAction{
+		Duration:   time.Duration(mins) * time.Minute,
+		Brightness: brightness,
+		Kelvin:     kelvin,
+	}
+	paramsAsStrings = []string{
+		strconv.Itoa(mins),
+		strconv.Itoa(int(brightness)),
+		strconv.Itoa(kelvin),
+	}
+	return
+}
+
+// Encode encodes a HueAction that this instance created as a string
+func (f SunriseFactory) Encode(action ops.HueAction) string {
+	s := action.(*SunriseAction)
+	serializer := make(ParamSerializer)
+	serializer.SetInt(MinutesParamName, int(s.Duration/time.Minute))
+	serializer.SetBrightness(BrightnessParamName, s.Brightness)
+	serializer.SetInt(KelvinParamName, s.Kelvin)
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+func (f SunriseFactory) Decode(s string) (action ops.HueAction, err error) {
+	serializer, err := NewParamSerializer(s)
+	if err != nil {
+		return
+	}
+	var result SunriseAction
+	mins, err := serializer.GetInt(MinutesParamName)
+	if err != nil {
+		return
+	}
+	if result.Brightness, err = serializer.GetBrightness(
+		BrightnessParamName); err != nil {
+		return
+	}
+	if result.Kelvin, err = serializer.GetInt(KelvinParamName); err != nil {
+		return
+	}
+	if mins < 0 || result.Kelvin < ops.MinKelvin || result.Kelvin > ops.MaxKelvin {
+		err = errBadValue
+		return
+	}
+	result.Duration = time.Duration(mins) * time.Minute
+	action = &result
+	return
+}
+
+// SunriseAction is the ops.HueAction that SunriseFactory generates.
+// These instances must be treated as immutable.
+type SunriseAction struct {
+	Duration   time.Duration
+	Brightness uint8
+	Kelvin     int
+}
+
+// Do ramps the lights using ops.RampAction with ops.PerceptualCurve so
+// that the light appears to the eye to brighten at a constant rate.
+func (s *SunriseAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	ops.RampAction(
+		ops.ColorBrightness{
+			Color:      gohue.NewMaybeColor(kDeepRed),
+			Brightness: maybe.NewUint8(1),
+		},
+		ops.ColorBrightness{
+			Color:      gohue.NewMaybeColor(ops.KelvinToColor(float64(s.Kelvin))),
+			Brightness: maybe.NewUint8(s.Brightness),
+		},
+		s.Duration,
+		ops.PerceptualCurve).Do(ctxt, lightSet, e)
+}
+
+func (s *SunriseAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+var (
+	kSunriseParams = NamedParamList{
+		{
+			Name:  MinutesParamName,
+			Param: Int(1, 180, 30, 3),
+			Unit:  "minutes",
+		},
+		{
+			Name:  BrightnessParamName,
+			Param: Brightness(),
+			Help:  kBrightnessHelp,
+		},
+		{
+			Name:  KelvinParamName,
+			Param: Int(2000, 6500, 2700, 4),
+			Help:  "2000 (warm) to 6500 (cool)",
+			Unit:  "K",
+		},
+	}
+)
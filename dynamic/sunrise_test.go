@@ -0,0 +1,71 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/dynamic/testutils"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSunriseFactoryNewExplicit(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          111,
+		Description: "Sunrise",
+		Factory:     dynamic.SunriseFactory{},
+	}
+	actual := aTask.FromExplicit(
+		aTask.Factory.(dynamic.SunriseFactory).NewExplicit(
+			20*time.Minute, 220, 3000))
+	expectedDescription := "Sunrise Mins: 20 Bri: 220 Kelvin: 3000"
+	if actual.Description != expectedDescription {
+		t.Errorf("Expected %s, got %s", expectedDescription, actual.Description)
+	}
+	testutils.VerifySerialization(t, aTask.Factory, actual.HueAction)
+}
+
+func TestSunriseActionDoPerceptual(t *testing.T) {
+	action := &dynamic.SunriseAction{
+		Duration:   time.Minute,
+		Brightness: 255,
+		Kelvin:     2700,
+	}
+	ramp := ops.RampAction(
+		ops.ColorBrightness{
+			Color:      gohue.NewMaybeColor(gohue.NewColor(0.675, 0.322)),
+			Brightness: maybe.NewUint8(1),
+		},
+		ops.ColorBrightness{
+			Color:      gohue.NewMaybeColor(ops.KelvinToColor(2700)),
+			Brightness: maybe.NewUint8(255),
+		},
+		time.Minute,
+		ops.PerceptualCurve)
+	actual := runRecorded(t, action)
+	expected := runRecorded(t, ramp)
+	if len(actual) < 3 {
+		t.Fatalf("Expected several steps, got %v", actual)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func runRecorded(
+	t *testing.T, action ops.HueAction) []gohue.LightProperties {
+	t.Helper()
+	ctxt := &recordingContext{}
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 6, 21, 6, 0, 0, 0, time.UTC)}
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		action.Do(ctxt, lights.New(3), e)
+	}), clock); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	return ctxt.sent
+}
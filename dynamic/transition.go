@@ -0,0 +1,190 @@
+package dynamic
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"strconv"
+	"time"
+)
+
+const (
+	// Name of the starting color parameter
+	StartColorParamName = "Start"
+
+	// Name of the starting brightness parameter
+	StartBrightnessParamName = "StartBri"
+
+	// Name of the ending color parameter
+	EndColorParamName = "End"
+
+	// Name of the ending brightness parameter
+	EndBrightnessParamName = "EndBri"
+
+	// Name of the duration parameter. Duration is in seconds.
+	DurationParamName = "Secs"
+)
+
+// TransitionFactory implements Factory and lets user provide a starting
+// color and brightness, an ending color and brightness, and a duration in
+// seconds. It generates an ops.HueAction that gradually changes the lights
+// from the starting color and brightness to the ending color and
+// brightness over the duration.
+type TransitionFactory struct {
+}
+
+func (f TransitionFactory) Params() NamedParamList {
+	return kTransitionParams
+}
+
+func (f TransitionFactory) New(values []interface{}) ops.HueAction {
+	return &TransitionAction{
+		StartColor:      values[0].(gohue.Color),
+		StartBrightness: uint8(values[1].(int)),
+		EndColor:        values[2].(gohue.Color),
+		EndBrightness:   uint8(values[3].(int)),
+		Duration:        time.Duration(values[4].(int)) * time.Second,
+	}
+}
+
+// start and end are the starting and ending colors; startString and
+// endString are their string representations; startBri and endBri are
+// the starting and ending brightness; duration is the length of the
+// transition rounded down to the nearest second.
+func (f TransitionFactory) NewExplicit(
+	start gohue.Color,
+	startString string,
+	startBri uint8,
+	end gohue.Color,
+	endString string,
+	endBri uint8,
+	duration time.Duration) (action ops.HueAction, paramsAsStrings []string) {
+	secs := int(duration / time.Second)
+	action = &TransitionAction{
+		StartColor:      start,
+		StartBrightness: startBri,
+		EndColor:        end,
+		EndBrightness:   endBri,
+		Duration:        time.Duration(secs) * time.Second,
+	}
+	paramsAsStrings = []string{
+		startString,
+		strconv.Itoa(int(startBri)),
+		endString,
+		strconv.Itoa(int(endBri)),
+		strconv.Itoa(secs),
+	}
+	return
+}
+
+// Encode encodes a HueAction that this instance created as a string
+func (f TransitionFactory) Encode(action ops.HueAction) string {
+	t := action.(*TransitionAction)
+	serializer := make(ParamSerializer)
+	serializer.SetColor(StartColorParamName, t.StartColor)
+	serializer.SetBrightness(StartBrightnessParamName, t.StartBrightness)
+	serializer.SetColor(EndColorParamName, t.EndColor)
+	serializer.SetBrightness(EndBrightnessParamName, t.EndBrightness)
+	serializer.SetInt(DurationParamName, int(t.Duration/time.Second))
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+func (f TransitionFactory) Decode(s string) (action ops.HueAction, err error) {
+	serializer, err := NewParamSerializer(s)
+	if err != nil {
+		return
+	}
+	var result TransitionAction
+	if result.StartColor, err = serializer.GetColor(
+		StartColorParamName); err != nil {
+		return
+	}
+	if result.StartBrightness, err = serializer.GetBrightness(
+		StartBrightnessParamName); err != nil {
+		return
+	}
+	if result.EndColor, err = serializer.GetColor(EndColorParamName); err != nil {
+		return
+	}
+	if result.EndBrightness, err = serializer.GetBrightness(
+		EndBrightnessParamName); err != nil {
+		return
+	}
+	secs, err := serializer.GetInt(DurationParamName)
+	if err != nil {
+		return
+	}
+	if secs < 0 {
+		err = errBadValue
+		return
+	}
+	result.Duration = time.Duration(secs) * time.Second
+	action = &result
+	return
+}
+
+// TransitionAction is the ops.HueAction that TransitionFactory generates.
+// These instances must be treated as immutable.
+type TransitionAction struct {
+	StartColor      gohue.Color
+	StartBrightness uint8
+	EndColor        gohue.Color
+	EndBrightness   uint8
+	Duration        time.Duration
+}
+
+// Do changes the lights at a constant rate using ops.RampAction.
+func (t *TransitionAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	ops.RampAction(
+		ops.ColorBrightness{
+			Color:      gohue.NewMaybeColor(t.StartColor),
+			Brightness: maybe.NewUint8(t.StartBrightness),
+		},
+		ops.ColorBrightness{
+			Color:      gohue.NewMaybeColor(t.EndColor),
+			Brightness: maybe.NewUint8(t.EndBrightness),
+		},
+		t.Duration,
+		ops.LinearCurve).Do(ctxt, lightSet, e)
+}
+
+func (t *TransitionAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+var (
+	kTransitionParams = NamedParamList{
+		{
+			Name:  StartColorParamName,
+			Param: ColorPicker(gohue.White, "White"),
+			Group: "From",
+		},
+		{
+			Name:  StartBrightnessParamName,
+			Param: Brightness(),
+			Help:  kBrightnessHelp,
+			Group: "From",
+		},
+		{
+			Name:  EndColorParamName,
+			Param: ColorPicker(gohue.White, "White"),
+			Group: "To",
+		},
+		{
+			Name:  EndBrightnessParamName,
+			Param: Brightness(),
+			Help:  kBrightnessHelp,
+			Group: "To",
+		},
+		{
+			Name:  DurationParamName,
+			Param: Int(1, 14400, 60, 5),
+			Unit:  "seconds",
+			Group: "Timing",
+		},
+	}
+)
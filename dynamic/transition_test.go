@@ -0,0 +1,75 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/dynamic/testutils"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransitionFactoryNewExplicit(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          109,
+		Description: "Fade",
+		Factory:     dynamic.TransitionFactory{},
+	}
+	actual := aTask.FromExplicit(
+		aTask.Factory.(dynamic.TransitionFactory).NewExplicit(
+			gohue.Red, "Red", 20, gohue.Blue, "Blue", 200, 90*time.Second))
+	expectedDescription := "Fade Start: Red StartBri: 20 End: Blue EndBri: 200 Secs: 90"
+	if actual.Description != expectedDescription {
+		t.Errorf("Expected %s, got %s", expectedDescription, actual.Description)
+	}
+	expectedAction := &dynamic.TransitionAction{
+		StartColor:      gohue.Red,
+		StartBrightness: 20,
+		EndColor:        gohue.Blue,
+		EndBrightness:   200,
+		Duration:        90 * time.Second,
+	}
+	if !reflect.DeepEqual(expectedAction, actual.HueAction) {
+		t.Errorf("Expected %v, got %v", expectedAction, actual.HueAction)
+	}
+	testutils.VerifySerialization(t, aTask.Factory, actual.HueAction)
+}
+
+func TestTransitionActionDo(t *testing.T) {
+	action := &dynamic.TransitionAction{
+		StartColor:      gohue.Red,
+		StartBrightness: 20,
+		EndColor:        gohue.Blue,
+		EndBrightness:   200,
+	}
+	ctxt := make(contextForTesting)
+	if err := tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		action.Do(ctxt, lights.New(3), e)
+	})); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := contextForTesting{
+		3: {
+			C:              gohue.NewMaybeColor(gohue.Blue),
+			Bri:            maybe.NewUint8(200),
+			On:             maybe.NewBool(true),
+			TransitionTime: maybe.NewUint16(0),
+		},
+	}
+	if !reflect.DeepEqual(expected, ctxt) {
+		t.Errorf("Expected %v, got %v", expected, ctxt)
+	}
+}
+
+type contextForTesting map[int]*gohue.LightProperties
+
+func (c contextForTesting) Set(
+	lightId int,
+	properties *gohue.LightProperties) (response []byte, err error) {
+	propertiesCopy := *properties
+	c[lightId] = &propertiesCopy
+	return
+}
@@ -0,0 +1,89 @@
+package dynamic
+
+import (
+	"fmt"
+	"github.com/keep94/marvin/ops"
+)
+
+// TypedField binds one parameter for which the user must supply a value
+// to a field of the parameter struct P. Use Field to create one.
+type TypedField[P any] struct {
+	NamedParam
+	store func(p *P, value interface{}) bool
+}
+
+// Field returns a TypedField that stores the value of param in the field
+// of P that ptr returns. The values that param produces must have type V.
+func Field[P, V any](param NamedParam, ptr func(p *P) *V) TypedField[P] {
+	return TypedField[P]{
+		NamedParam: param,
+		store: func(p *P, value interface{}) bool {
+			v, ok := value.(V)
+			if ok {
+				*ptr(p) = v
+			}
+			return ok
+		},
+	}
+}
+
+// TypedFactory works like Factory except that New receives the values
+// that the user supplied as a single struct, P, instead of as a
+// []interface{}. Use FromTyped to use a TypedFactory where a Factory is
+// expected.
+type TypedFactory[P any] interface {
+
+	// Fields returns the parameters for which user must supply values
+	// along with the field of P that receives each value.
+	Fields() []TypedField[P]
+
+	// New creates the ops.HueAction using the values that the user
+	// supplied.
+	New(params P) ops.HueAction
+}
+
+// FromTyped returns a Factory that passes the user supplied values to f
+// as a P. Since each value goes to its own field of P, reordering the
+// fields of f does not break the returned Factory. FromTyped panics if
+// the default value of any field of f has the wrong type for that field
+// so that a mismatch fails when the Factory is built rather than when a
+// task is generated.
+func FromTyped[P any](f TypedFactory[P]) Factory {
+	fields := f.Fields()
+	params := make(NamedParamList, len(fields))
+	for i := range fields {
+		params[i] = fields[i].NamedParam
+		defaultValue, _ := fields[i].Convert("")
+		var p P
+		if defaultValue != nil && !fields[i].store(&p, defaultValue) {
+			panic(fmt.Sprintf(
+				"dynamic: Param %s has values of type %T which its field cannot hold",
+				fields[i].Name,
+				defaultValue))
+		}
+	}
+	return &typedFactory[P]{factory: f, fields: fields, params: params}
+}
+
+type typedFactory[P any] struct {
+	factory TypedFactory[P]
+	fields  []TypedField[P]
+	params  NamedParamList
+}
+
+func (f *typedFactory[P]) Params() NamedParamList {
+	return f.params
+}
+
+func (f *typedFactory[P]) New(values []interface{}) ops.HueAction {
+	var p P
+	for i := range f.fields {
+		if values[i] != nil && !f.fields[i].store(&p, values[i]) {
+			panic(fmt.Sprintf(
+				"dynamic: Param %s got value of type %T",
+				f.fields[i].Name,
+				values[i]))
+		}
+	}
+	return f.factory.New(p)
+}
@@ -0,0 +1,102 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type plainParams struct {
+	Bri   int
+	Color gohue.Color
+}
+
+type plainTypedFactory []dynamic.TypedField[plainParams]
+
+func (f plainTypedFactory) Fields() []dynamic.TypedField[plainParams] {
+	return f
+}
+
+func (f plainTypedFactory) New(p plainParams) ops.HueAction {
+	return ops.StaticHueAction{
+		0: {
+			Color:      gohue.NewMaybeColor(p.Color),
+			Brightness: maybe.NewUint8(uint8(p.Bri)),
+		},
+	}
+}
+
+func colorField(param dynamic.Param) dynamic.TypedField[plainParams] {
+	return dynamic.Field(
+		dynamic.NamedParam{Name: "Colour", Param: param},
+		func(p *plainParams) *gohue.Color { return &p.Color })
+}
+
+func briField(param dynamic.Param) dynamic.TypedField[plainParams] {
+	return dynamic.Field(
+		dynamic.NamedParam{Name: "Bri", Param: param},
+		func(p *plainParams) *int { return &p.Bri })
+}
+
+func TestTypedFactory(t *testing.T) {
+	aTask := &dynamic.HueTask{
+		Id:          114,
+		Description: "Typed",
+		Factory: dynamic.FromTyped[plainParams](plainTypedFactory{
+			colorField(dynamic.ColorPicker(gohue.White, "White")),
+			briField(dynamic.Brightness()),
+		}),
+	}
+	urlValues := make(url.Values)
+	urlValues.Set("p0", "3")
+	urlValues.Set("p1", "17")
+	expected := &ops.HueTask{
+		Id:          114,
+		Description: "Typed Colour: Blue Bri: 17",
+		HueAction: ops.StaticHueAction{
+			0: {
+				Color:      gohue.NewMaybeColor(gohue.Blue),
+				Brightness: maybe.NewUint8(17),
+			},
+		},
+	}
+	actual := aTask.FromUrlValues("p", urlValues)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTypedFactoryReordered(t *testing.T) {
+	factory := dynamic.FromTyped[plainParams](plainTypedFactory{
+		briField(dynamic.Brightness()),
+		colorField(dynamic.ColorPicker(gohue.White, "White")),
+	})
+	expected := ops.StaticHueAction{
+		0: {
+			Color:      gohue.NewMaybeColor(gohue.Red),
+			Brightness: maybe.NewUint8(40),
+		},
+	}
+	actual := factory.New([]interface{}{40, gohue.Red})
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func TestTypedFactoryBadField(t *testing.T) {
+	assertPanics(t, func() {
+		dynamic.FromTyped[plainParams](plainTypedFactory{
+			colorField(dynamic.Brightness()),
+		})
+	})
+	factory := dynamic.FromTyped[plainParams](plainTypedFactory{
+		briField(dynamic.Brightness()),
+	})
+	assertPanics(t, func() {
+		factory.New([]interface{}{gohue.Red})
+	})
+}
@@ -0,0 +1,197 @@
+package dynamic
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/weather"
+	"github.com/keep94/tasks"
+	"strconv"
+	"time"
+)
+
+const (
+	// Name of the cold temperature parameter. Temperature is in celsius.
+	ColdParamName = "Cold"
+
+	// Name of the hot temperature parameter. Temperature is in celsius.
+	HotParamName = "Hot"
+)
+
+const (
+	// How many times a weather lamp flashes for a weather warning.
+	kWeatherAlertFlashes = 3
+
+	// How long each flash for a weather warning lasts.
+	kWeatherAlertFlash = 500 * time.Millisecond
+)
+
+// WeatherFactory implements Factory and lets user provide a cold
+// temperature, a hot temperature, and a brightness. It generates an
+// ops.HueAction that makes a weather lamp: it colors the lights by the
+// current temperature in a weather.Cache from blue at or below the cold
+// temperature through white to red at or above the hot temperature. If
+// the cache has any active weather warnings, the lights flash red first.
+type WeatherFactory struct {
+	cache *weather.Cache
+}
+
+// NewWeatherFactory returns a WeatherFactory that uses the observations
+// and alerts in cache.
+func NewWeatherFactory(cache *weather.Cache) *WeatherFactory {
+	return &WeatherFactory{cache: cache}
+}
+
+func (f *WeatherFactory) Params() NamedParamList {
+	return kWeatherParams
+}
+
+func (f *WeatherFactory) New(values []interface{}) ops.HueAction {
+	return &WeatherAction{
+		Cache:      f.cache,
+		Cold:       values[0].(int),
+		Hot:        values[1].(int),
+		Brightness: uint8(values[2].(int)),
+	}
+}
+
+// cold and hot are the cold and hot temperatures in celsius; brightness
+// is the brightness of the lights.
+func (f *WeatherFactory) NewExplicit(
+	cold, hot int, brightness uint8) (
+	action ops.HueAction, paramsAsStrings []string) {
+	action = &WeatherAction{
+		Cache:      f.cache,
+		Cold:       cold,
+		Hot:        hot,
+		Brightness: brightness,
+	}
+	paramsAsStrings = []string{
+		strconv.Itoa(cold),
+		strconv.Itoa(hot),
+		strconv.Itoa(int(brightness)),
+	}
+	return
+}
+
+// Encode encodes a HueAction that this instance created as a string
+func (f *WeatherFactory) Encode(action ops.HueAction) string {
+	w := action.(*WeatherAction)
+	serializer := make(ParamSerializer)
+	serializer.SetInt(ColdParamName, w.Cold)
+	serializer.SetInt(HotParamName, w.Hot)
+	serializer.SetBrightness(BrightnessParamName, w.Brightness)
+	return serializer.Encode()
+}
+
+// Decode decodes a string that Encode produced back into a HueAction.
+func (f *WeatherFactory) Decode(s string) (action ops.HueAction, err error) {
+	serializer, err := NewParamSerializer(s)
+	if err != nil {
+		return
+	}
+	result := WeatherAction{Cache: f.cache}
+	if result.Cold, err = serializer.GetInt(ColdParamName); err != nil {
+		return
+	}
+	if result.Hot, err = serializer.GetInt(HotParamName); err != nil {
+		return
+	}
+	if result.Brightness, err = serializer.GetBrightness(
+		BrightnessParamName); err != nil {
+		return
+	}
+	if result.Hot <= result.Cold {
+		err = errBadValue
+		return
+	}
+	action = &result
+	return
+}
+
+// WeatherAction is the ops.HueAction that WeatherFactory generates.
+// These instances must be treated as immutable.
+type WeatherAction struct {
+	Cache      *weather.Cache
+	Cold       int
+	Hot        int
+	Brightness uint8
+}
+
+func (w *WeatherAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	observation, _ := w.Cache.Get()
+	if observation == nil {
+		return
+	}
+	if hasWarning(w.Cache.Alerts()) {
+		on := plainAction(gohue.Red, w.Brightness)
+		off := ops.StaticHueAction{0: ops.ColorBrightness{}}
+		for i := 0; i < kWeatherAlertFlashes; i++ {
+			on.Do(ctxt, lightSet, e)
+			if e.Error() != nil || !e.Sleep(kWeatherAlertFlash) {
+				return
+			}
+			off.Do(ctxt, lightSet, e)
+			if e.Error() != nil || !e.Sleep(kWeatherAlertFlash) {
+				return
+			}
+		}
+	}
+	celsius := observation.In(weather.Metric).Temperature
+	plainAction(
+		TemperatureColor(celsius, float64(w.Cold), float64(w.Hot)),
+		w.Brightness).Do(ctxt, lightSet, e)
+}
+
+func (w *WeatherAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+// TemperatureColor returns blue if temperature is at or below cold, red
+// if temperature is at or above hot, and a blend through white for
+// temperatures in between.
+func TemperatureColor(temperature, cold, hot float64) gohue.Color {
+	if temperature <= cold {
+		return gohue.Blue
+	}
+	if temperature >= hot {
+		return gohue.Red
+	}
+	ratio := (temperature - cold) / (hot - cold)
+	if ratio < 0.5 {
+		return gohue.Blue.Blend(gohue.White, 2.0*ratio)
+	}
+	return gohue.White.Blend(gohue.Red, 2.0*ratio-1.0)
+}
+
+func hasWarning(alerts []weather.Alert) bool {
+	for i := range alerts {
+		if alerts[i].IsWarning() {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	kWeatherParams = NamedParamList{
+		{
+			Name:  ColdParamName,
+			Param: Int(-50, 50, 10, 3),
+			Unit:  "°C",
+			Help:  "-50 to 50",
+		},
+		{
+			Name:  HotParamName,
+			Param: Int(-50, 50, 30, 3),
+			Unit:  "°C",
+			Help:  "-50 to 50",
+		},
+		{
+			Name:  BrightnessParamName,
+			Param: Brightness(),
+			Help:  kBrightnessHelp,
+		},
+	}
+)
@@ -0,0 +1,112 @@
+package dynamic_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/dynamic/testutils"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/weather"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWeatherFactoryNewExplicit(t *testing.T) {
+	cache := weather.NewCache()
+	defer cache.Close()
+	aTask := &dynamic.HueTask{
+		Id:          113,
+		Description: "Weather Lamp",
+		Factory:     dynamic.NewWeatherFactory(cache),
+	}
+	actual := aTask.FromExplicit(
+		aTask.Factory.(*dynamic.WeatherFactory).NewExplicit(5, 25, 200))
+	expectedDescription := "Weather Lamp Cold: 5 Hot: 25 Bri: 200"
+	if actual.Description != expectedDescription {
+		t.Errorf("Expected %s, got %s", expectedDescription, actual.Description)
+	}
+	testutils.VerifySerialization(t, aTask.Factory, actual.HueAction)
+	if _, err := aTask.Factory.(*dynamic.WeatherFactory).Decode(
+		`{"Cold":["25"],"Hot":["5"],"Bri":["200"]}`); err == nil {
+		t.Error("Expected error decoding hot below cold")
+	}
+}
+
+func TestWeatherActionDo(t *testing.T) {
+	cache := weather.NewCache()
+	defer cache.Close()
+	action := &dynamic.WeatherAction{
+		Cache: cache, Cold: 10, Hot: 30, Brightness: 150}
+	ctxt := make(contextForTesting)
+	runWeatherAction(t, action, ctxt)
+	if len(ctxt) != 0 {
+		t.Errorf("Expected no changes without an observation, got %v", ctxt)
+	}
+	cache.Set(&weather.Observation{
+		Temperature: weather.CelsiusToFahrenheit(5.0),
+		Units:       weather.Imperial})
+	runWeatherAction(t, action, ctxt)
+	expected := contextForTesting{
+		3: {
+			C:   gohue.NewMaybeColor(gohue.Blue),
+			Bri: maybe.NewUint8(150),
+			On:  maybe.NewBool(true),
+		},
+	}
+	if !reflect.DeepEqual(expected, ctxt) {
+		t.Errorf("Expected %v, got %v", expected, ctxt)
+	}
+	cache.Set(&weather.Observation{Temperature: 35.0})
+	cache.SetAlerts([]weather.Alert{{Event: "Tornado Warning"}})
+	flashes := &countingContext{contextForTesting: make(contextForTesting)}
+	runWeatherAction(t, action, flashes)
+	expected[3].C = gohue.NewMaybeColor(gohue.Red)
+	if !reflect.DeepEqual(expected, flashes.contextForTesting) {
+		t.Errorf("Expected %v, got %v", expected, flashes.contextForTesting)
+	}
+	if flashes.count != 7 {
+		t.Errorf("Expected 7 sets, got %d", flashes.count)
+	}
+}
+
+func TestTemperatureColor(t *testing.T) {
+	if c := dynamic.TemperatureColor(0.0, 10.0, 30.0); c != gohue.Blue {
+		t.Errorf("Expected blue, got %v", c)
+	}
+	if c := dynamic.TemperatureColor(20.0, 10.0, 30.0); c != gohue.White {
+		t.Errorf("Expected white, got %v", c)
+	}
+	if c := dynamic.TemperatureColor(40.0, 10.0, 30.0); c != gohue.Red {
+		t.Errorf("Expected red, got %v", c)
+	}
+	expected := gohue.White.Blend(gohue.Red, 0.5)
+	if c := dynamic.TemperatureColor(25.0, 10.0, 30.0); c != expected {
+		t.Errorf("Expected %v, got %v", expected, c)
+	}
+}
+
+func runWeatherAction(
+	t *testing.T, action *dynamic.WeatherAction, ctxt ops.Context) {
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 6, 21, 8, 0, 0, 0, time.UTC)}
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		action.Do(ctxt, lights.New(3), e)
+	}), clock); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+}
+
+type countingContext struct {
+	contextForTesting
+	count int
+}
+
+func (c *countingContext) Set(
+	lightId int,
+	properties *gohue.LightProperties) (response []byte, err error) {
+	c.count++
+	return c.contextForTesting.Set(lightId, properties)
+}
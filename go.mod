@@ -1,8 +1,9 @@
 module github.com/keep94/marvin
 
-go 1.14
+go 1.18
 
 require (
+	github.com/go-sql-driver/mysql v1.6.0
 	github.com/keep94/appcommon v1.0.0
 	github.com/keep94/goconsume v1.0.0
 	github.com/keep94/gofunctional3 v1.0.0
@@ -11,6 +12,18 @@ require (
 	github.com/keep94/maybe v1.0.0
 	github.com/keep94/sunrise v1.0.1
 	github.com/keep94/tasks v1.0.0
+	github.com/lib/pq v1.10.9
 	github.com/stretchr/testify v1.6.1
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/net v0.0.0-20200904194848-62affa334b73
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/keep94/common v1.0.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a // indirect
+	golang.org/x/sys v0.0.0-20200923182605-d9f96fdee20d // indirect
+	golang.org/x/text v0.3.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
@@ -0,0 +1,117 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/lights"
+)
+
+// LightAlias is a friendly name for a single light.
+type LightAlias struct {
+	// The unique database dependent numeric ID of this alias.
+	Id int64
+
+	// The id of the light.
+	LightId int
+
+	// The friendly name of the light. Unique among aliases.
+	Name string
+}
+
+// LightGroup is a named set of lights.
+type LightGroup struct {
+	// The unique database dependent numeric ID of this group.
+	Id int64
+
+	// The name of the group. Unique among groups.
+	Name string
+
+	// The encoded set of lights in the group. lights.InvString decodes it.
+	LightSet string
+}
+
+type LightAliasesRunner interface {
+	// LightAliases gets all light aliases ordered by name.
+	LightAliases(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+type AddLightAliasRunner interface {
+	// AddLightAlias adds a light alias.
+	AddLightAlias(t db.Transaction, alias *LightAlias) error
+}
+
+type UpdateLightAliasRunner interface {
+	// UpdateLightAlias updates a light alias by id.
+	UpdateLightAlias(t db.Transaction, alias *LightAlias) error
+}
+
+type RemoveLightAliasRunner interface {
+	// RemoveLightAlias removes a light alias by id.
+	RemoveLightAlias(t db.Transaction, id int64) error
+}
+
+type LightGroupsRunner interface {
+	// LightGroups gets all light groups ordered by name.
+	LightGroups(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+type AddLightGroupRunner interface {
+	// AddLightGroup adds a light group.
+	AddLightGroup(t db.Transaction, group *LightGroup) error
+}
+
+type UpdateLightGroupRunner interface {
+	// UpdateLightGroup updates a light group by id.
+	UpdateLightGroup(t db.Transaction, group *LightGroup) error
+}
+
+type RemoveLightGroupRunner interface {
+	// RemoveLightGroup removes a light group by id.
+	RemoveLightGroup(t db.Transaction, id int64) error
+}
+
+// LightAliasStore persists light aliases and light groups.
+type LightAliasStore interface {
+	LightAliasesRunner
+	AddLightAliasRunner
+	UpdateLightAliasRunner
+	RemoveLightAliasRunner
+	LightGroupsRunner
+	AddLightGroupRunner
+	UpdateLightGroupRunner
+	RemoveLightGroupRunner
+}
+
+// LightNamesStore is what LightNames reads.
+type LightNamesStore interface {
+	LightAliasesRunner
+	LightGroupsRunner
+}
+
+// LightNames reads store and returns the friendly name of each light
+// keyed by light id and the set of lights in each group keyed by group
+// name.
+func LightNames(t db.Transaction, store LightNamesStore) (
+	names map[int]string, groups map[string]lights.Set, err error) {
+	var aliases []LightAlias
+	if err = store.LightAliases(t, goconsume.AppendTo(&aliases)); err != nil {
+		return
+	}
+	var lightGroups []LightGroup
+	if err = store.LightGroups(t, goconsume.AppendTo(&lightGroups)); err != nil {
+		return
+	}
+	names = make(map[int]string, len(aliases))
+	for _, alias := range aliases {
+		names[alias.LightId] = alias.Name
+	}
+	groups = make(map[string]lights.Set, len(lightGroups))
+	for _, group := range lightGroups {
+		var lightSet lights.Set
+		if lightSet, err = lights.InvString(group.LightSet); err != nil {
+			return nil, nil, err
+		}
+		groups[group.Name] = lightSet
+	}
+	return
+}
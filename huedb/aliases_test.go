@@ -0,0 +1,32 @@
+package huedb_test
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/lights"
+	"reflect"
+	"testing"
+)
+
+func TestLightNames(t *testing.T) {
+	store := in_memory.New()
+	store.AddLightAlias(nil, &huedb.LightAlias{LightId: 3, Name: "kitchen"})
+	store.AddLightAlias(nil, &huedb.LightAlias{LightId: 1, Name: "den"})
+	store.AddLightGroup(nil, &huedb.LightGroup{Name: "upstairs", LightSet: "1,2"})
+	names, groups, err := huedb.LightNames(nil, store)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	expectedNames := map[int]string{1: "den", 3: "kitchen"}
+	if !reflect.DeepEqual(expectedNames, names) {
+		t.Errorf("Expected %v, got %v", expectedNames, names)
+	}
+	expectedGroups := map[string]lights.Set{"upstairs": lights.New(1, 2)}
+	if !reflect.DeepEqual(expectedGroups, groups) {
+		t.Errorf("Expected %v, got %v", expectedGroups, groups)
+	}
+	store.AddLightGroup(nil, &huedb.LightGroup{Name: "bad", LightSet: "x"})
+	if _, _, err := huedb.LightNames(nil, store); err == nil {
+		t.Error("Expected error decoding bad light set.")
+	}
+}
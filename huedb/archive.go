@@ -0,0 +1,82 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"time"
+)
+
+// AtTimeTaskStatus tells how a scheduled task ended.
+type AtTimeTaskStatus int
+
+const (
+	// The scheduled task ran.
+	AtTimeTaskRan AtTimeTaskStatus = iota + 1
+
+	// The scheduled task was cancelled before it ran.
+	AtTimeTaskCancelled
+)
+
+func (s AtTimeTaskStatus) String() string {
+	switch s {
+	case AtTimeTaskRan:
+		return "Ran"
+	case AtTimeTaskCancelled:
+		return "Cancelled"
+	default:
+		return "Unknown"
+	}
+}
+
+// ArchivedAtTimeTask represents a scheduled task that has ended.
+type ArchivedAtTimeTask struct {
+	EncodedAtTimeTask
+
+	// How the scheduled task ended.
+	Status AtTimeTaskStatus
+
+	// When the scheduled task ended.
+	CompletedAt time.Time
+}
+
+type ArchiveEncodedAtTimeTaskRunner interface {
+	// ArchiveEncodedAtTimeTask moves a task by group id and schedule id
+	// to the archive. The Id field of the archived task is its database
+	// id in the archive.
+	ArchiveEncodedAtTimeTask(
+		t db.Transaction,
+		groupId, scheduleId string,
+		status AtTimeTaskStatus,
+		completedAt time.Time) error
+}
+
+type ArchivedAtTimeTasksRunner interface {
+	// ArchivedAtTimeTasks fetches the archived tasks in a particular group
+	// most recently completed first.
+	ArchivedAtTimeTasks(
+		t db.Transaction, groupId string, consumer goconsume.Consumer) error
+}
+
+// SetArchiver makes Finish move ended tasks to the archive with archiver
+// instead of removing them. archiver may be nil which means that Finish
+// removes ended tasks. The default is nil.
+func (s *AtTimeTaskStore) SetArchiver(archiver ArchiveEncodedAtTimeTaskRunner) {
+	s.archiver = archiver
+}
+
+// Finish removes a scheduled task by id after it ran or was cancelled.
+func (s *AtTimeTaskStore) Finish(scheduleId string, ran bool) {
+	if s.archiver == nil {
+		s.Remove(scheduleId)
+		return
+	}
+	status := AtTimeTaskCancelled
+	if ran {
+		status = AtTimeTaskRan
+	}
+	err := s.archiver.ArchiveEncodedAtTimeTask(
+		nil, s.groupId, scheduleId, status, time.Now())
+	if err != nil {
+		s.logger.Println(err)
+	}
+}
@@ -0,0 +1,56 @@
+package huedb_test
+
+import (
+	"bytes"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestAtTimeTaskStoreFinish(t *testing.T) {
+	memStore := in_memory.New()
+	var fakeEncoder fakeActionEncoder
+	buffer := bytes.NewBuffer(nil)
+	logger := log.New(buffer, "", 0)
+	store := huedb.NewAtTimeTaskStore(
+		fakeEncoder, fakeEncoder, memStore, "default", logger)
+	for _, id := range []string{"first", "second", "third"} {
+		store.Add(&ops.AtTimeTask{
+			Id:        id,
+			H:         &ops.HueTask{Id: 31, HueAction: intAction(131)},
+			Ls:        lights.All,
+			StartTime: time.Now().Add(time.Hour),
+		})
+	}
+
+	// Without an archiver, Finish just removes
+	store.Finish("first", true)
+	store.SetArchiver(memStore)
+	store.Finish("second", true)
+	store.Finish("third", false)
+	if out := len(encodedTasks(t, memStore, "default")); out != 0 {
+		t.Errorf("Expected no tasks, got %d", out)
+	}
+	var archived []huedb.ArchivedAtTimeTask
+	if err := memStore.ArchivedAtTimeTasks(
+		nil, "default", goconsume.AppendTo(&archived)); err != nil {
+		t.Fatalf("Got error reading archive: %v", err)
+	}
+	if len(archived) != 2 {
+		t.Fatalf("Expected 2 archived tasks, got %d", len(archived))
+	}
+	if out := archived[0].ScheduleId + " " + archived[0].Status.String(); out != "third Cancelled" {
+		t.Errorf("Expected third Cancelled, got %s", out)
+	}
+	if out := archived[1].ScheduleId + " " + archived[1].Status.String(); out != "second Ran" {
+		t.Errorf("Expected second Ran, got %s", out)
+	}
+	if len(buffer.Bytes()) > 0 {
+		t.Errorf("No logs expected: %s", string(buffer.Bytes()))
+	}
+}
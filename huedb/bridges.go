@@ -0,0 +1,79 @@
+package huedb
+
+import (
+	"context"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/ops"
+)
+
+// Bridge represents a paired hue bridge.
+type Bridge struct {
+	// The unique database dependent numeric ID of this bridge.
+	Id int64
+
+	// The friendly name of the bridge. Unique among bridges.
+	Name string
+
+	// The IP address or hostname of the bridge.
+	Host string
+
+	// The API username issued by the bridge when it was paired.
+	User string
+}
+
+type BridgeByIdRunner interface {
+	// BridgeById gets a bridge by id.
+	BridgeById(t db.Transaction, id int64, bridge *Bridge) error
+}
+
+type BridgesRunner interface {
+	// Bridges gets all bridges ordered by name.
+	Bridges(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+type AddBridgeRunner interface {
+	// AddBridge adds a bridge.
+	AddBridge(t db.Transaction, bridge *Bridge) error
+}
+
+type UpdateBridgeRunner interface {
+	// UpdateBridge updates a bridge by id.
+	UpdateBridge(t db.Transaction, bridge *Bridge) error
+}
+
+type RemoveBridgeRunner interface {
+	// RemoveBridge removes a bridge by id.
+	RemoveBridge(t db.Transaction, id int64) error
+}
+
+// BridgeStore persists bridges.
+type BridgeStore interface {
+	BridgeByIdRunner
+	BridgesRunner
+	AddBridgeRunner
+	UpdateBridgeRunner
+	RemoveBridgeRunner
+}
+
+// PairBridge pairs with the hue bridge at host using ops.Pair and adds it
+// to store under name. deviceName identifies this installation of marvin
+// to the bridge. On success, PairBridge stores the added bridge at
+// bridge.
+func PairBridge(
+	ctx context.Context,
+	t db.Transaction,
+	store AddBridgeRunner,
+	name, host, deviceName string,
+	bridge *Bridge) error {
+	user, err := ops.Pair(ctx, host, deviceName)
+	if err != nil {
+		return err
+	}
+	result := Bridge{Name: name, Host: host, User: user}
+	if err := store.AddBridge(t, &result); err != nil {
+		return err
+	}
+	*bridge = result
+	return nil
+}
@@ -0,0 +1,44 @@
+package huedb_test
+
+import (
+	"context"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPairBridge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"success":{"username":"abc123"}}]`))
+		}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	store := in_memory.New()
+	var bridge huedb.Bridge
+	if err := huedb.PairBridge(
+		context.Background(),
+		nil,
+		store,
+		"Upstairs",
+		host,
+		"living room",
+		&bridge); err != nil {
+		t.Fatalf("Got error pairing: %v", err)
+	}
+	var bridges []huedb.Bridge
+	if err := store.Bridges(nil, goconsume.AppendTo(&bridges)); err != nil {
+		t.Fatalf("Got error reading bridges: %v", err)
+	}
+	expected := []huedb.Bridge{
+		{Id: bridge.Id, Name: "Upstairs", Host: host, User: "abc123"},
+	}
+	if !reflect.DeepEqual(expected, bridges) {
+		t.Errorf("Expected %v, got %v", expected, bridges)
+	}
+}
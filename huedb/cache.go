@@ -0,0 +1,232 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/tasks"
+	"sync"
+	"time"
+)
+
+// CachedNamedColorsByIdRunner is a NamedColorsByIdRunner that caches
+// the named colors it fetches for a fixed time. Calls with a non-nil
+// transaction bypass the cache. CachedNamedColorsByIdRunner is safe to
+// use with multiple goroutines.
+type CachedNamedColorsByIdRunner struct {
+	delegate NamedColorsByIdRunner
+	ttl      time.Duration
+	clock    tasks.Clock
+	mutex    sync.Mutex
+	entries  map[int64]namedColorsEntry
+}
+
+// NewCachedNamedColorsByIdRunner returns a CachedNamedColorsByIdRunner
+// that fetches from delegate and caches for ttl.
+func NewCachedNamedColorsByIdRunner(
+	delegate NamedColorsByIdRunner,
+	ttl time.Duration) *CachedNamedColorsByIdRunner {
+	return NewCachedNamedColorsByIdRunnerWithClock(
+		delegate, ttl, tasks.SystemClock())
+}
+
+// NewCachedNamedColorsByIdRunnerWithClock provides a caller supplied
+// clock for testing.
+func NewCachedNamedColorsByIdRunnerWithClock(
+	delegate NamedColorsByIdRunner,
+	ttl time.Duration,
+	clock tasks.Clock) *CachedNamedColorsByIdRunner {
+	return &CachedNamedColorsByIdRunner{
+		delegate: delegate,
+		ttl:      ttl,
+		clock:    clock,
+		entries:  make(map[int64]namedColorsEntry),
+	}
+}
+
+func (c *CachedNamedColorsByIdRunner) NamedColorsById(
+	t db.Transaction, id int64, namedColors *ops.NamedColors) error {
+	if t != nil {
+		return c.delegate.NamedColorsById(t, id, namedColors)
+	}
+	now := c.clock.Now()
+	if c.get(id, now, namedColors) {
+		return nil
+	}
+	if err := c.delegate.NamedColorsById(nil, id, namedColors); err != nil {
+		return err
+	}
+	c.put(id, now, namedColors)
+	return nil
+}
+
+// Invalidate removes the named colors with given id from the cache.
+func (c *CachedNamedColorsByIdRunner) Invalidate(id int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, id)
+}
+
+// InvalidateAll empties the cache.
+func (c *CachedNamedColorsByIdRunner) InvalidateAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[int64]namedColorsEntry)
+}
+
+func (c *CachedNamedColorsByIdRunner) get(
+	id int64, now time.Time, namedColors *ops.NamedColors) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[id]
+	if !ok || !now.Before(entry.expires) {
+		return false
+	}
+	*namedColors = entry.namedColors
+	namedColors.Colors = copyLightColors(entry.namedColors.Colors)
+	return true
+}
+
+func (c *CachedNamedColorsByIdRunner) put(
+	id int64, now time.Time, namedColors *ops.NamedColors) {
+	entry := namedColorsEntry{
+		namedColors: *namedColors, expires: now.Add(c.ttl)}
+	entry.namedColors.Colors = copyLightColors(namedColors.Colors)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[id] = entry
+}
+
+// InvalidatingUpdateNamedColorsRunner returns an UpdateNamedColorsRunner
+// that works just like delegate except that it removes the updated named
+// colors from cache.
+func InvalidatingUpdateNamedColorsRunner(
+	delegate UpdateNamedColorsRunner,
+	cache *CachedNamedColorsByIdRunner) UpdateNamedColorsRunner {
+	return &invalidatingUpdateRunner{delegate: delegate, cache: cache}
+}
+
+// InvalidatingRemoveNamedColorsRunner returns a RemoveNamedColorsRunner
+// that works just like delegate except that it removes the removed named
+// colors from cache.
+func InvalidatingRemoveNamedColorsRunner(
+	delegate RemoveNamedColorsRunner,
+	cache *CachedNamedColorsByIdRunner) RemoveNamedColorsRunner {
+	return &invalidatingRemoveRunner{delegate: delegate, cache: cache}
+}
+
+// CachedDynamicHueTaskStore is a DynamicHueTaskStore that caches the
+// tasks it fetches for a fixed time. CachedDynamicHueTaskStore does not
+// cache nil. CachedDynamicHueTaskStore is safe to use with multiple
+// goroutines.
+type CachedDynamicHueTaskStore struct {
+	delegate DynamicHueTaskStore
+	ttl      time.Duration
+	clock    tasks.Clock
+	mutex    sync.Mutex
+	entries  map[int]hueTaskEntry
+}
+
+// NewCachedDynamicHueTaskStore returns a CachedDynamicHueTaskStore that
+// fetches from delegate and caches for ttl.
+func NewCachedDynamicHueTaskStore(
+	delegate DynamicHueTaskStore,
+	ttl time.Duration) *CachedDynamicHueTaskStore {
+	return NewCachedDynamicHueTaskStoreWithClock(
+		delegate, ttl, tasks.SystemClock())
+}
+
+// NewCachedDynamicHueTaskStoreWithClock provides a caller supplied clock
+// for testing.
+func NewCachedDynamicHueTaskStoreWithClock(
+	delegate DynamicHueTaskStore,
+	ttl time.Duration,
+	clock tasks.Clock) *CachedDynamicHueTaskStore {
+	return &CachedDynamicHueTaskStore{
+		delegate: delegate,
+		ttl:      ttl,
+		clock:    clock,
+		entries:  make(map[int]hueTaskEntry),
+	}
+}
+
+func (c *CachedDynamicHueTaskStore) ById(id int) *dynamic.HueTask {
+	now := c.clock.Now()
+	c.mutex.Lock()
+	entry, ok := c.entries[id]
+	c.mutex.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.hueTask
+	}
+	result := c.delegate.ById(id)
+	if result == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[id] = hueTaskEntry{hueTask: result, expires: now.Add(c.ttl)}
+	return result
+}
+
+// Invalidate removes the task with given id from the cache.
+func (c *CachedDynamicHueTaskStore) Invalidate(id int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, id)
+}
+
+// InvalidateAll empties the cache.
+func (c *CachedDynamicHueTaskStore) InvalidateAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[int]hueTaskEntry)
+}
+
+type namedColorsEntry struct {
+	namedColors ops.NamedColors
+	expires     time.Time
+}
+
+type hueTaskEntry struct {
+	hueTask *dynamic.HueTask
+	expires time.Time
+}
+
+type invalidatingUpdateRunner struct {
+	delegate UpdateNamedColorsRunner
+	cache    *CachedNamedColorsByIdRunner
+}
+
+func (r *invalidatingUpdateRunner) UpdateNamedColors(
+	t db.Transaction, namedColors *ops.NamedColors) error {
+	if err := r.delegate.UpdateNamedColors(t, namedColors); err != nil {
+		return err
+	}
+	r.cache.Invalidate(namedColors.Id)
+	return nil
+}
+
+type invalidatingRemoveRunner struct {
+	delegate RemoveNamedColorsRunner
+	cache    *CachedNamedColorsByIdRunner
+}
+
+func (r *invalidatingRemoveRunner) RemoveNamedColors(
+	t db.Transaction, id int64) error {
+	if err := r.delegate.RemoveNamedColors(t, id); err != nil {
+		return err
+	}
+	r.cache.Invalidate(id)
+	return nil
+}
+
+func copyLightColors(colors ops.LightColors) ops.LightColors {
+	if colors == nil {
+		return nil
+	}
+	result := make(ops.LightColors, len(colors))
+	for lightId, colorBrightness := range colors {
+		result[lightId] = colorBrightness
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package huedb_test
+
+import (
+	"github.com/keep94/marvin/dynamic"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/tasks"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCachedNamedColorsByIdRunner(t *testing.T) {
+	store := in_memory.New()
+	foo := ops.NamedColors{Colors: kColorMap1, Description: "Foo"}
+	addNamedColors(t, store, &foo)
+	clock := &tasks.ClockForTesting{Current: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)}
+	cache := huedb.NewCachedNamedColorsByIdRunnerWithClock(
+		store, time.Minute, clock)
+	assertNamedColorsById(t, cache, &foo)
+
+	// Changes behind the cache's back aren't seen until ttl elapses.
+	bar := foo
+	bar.Description = "Bar"
+	if err := store.UpdateNamedColors(nil, &bar); err != nil {
+		t.Fatalf("Got error updating: %v", err)
+	}
+	assertNamedColorsById(t, cache, &foo)
+	clock.Current = clock.Current.Add(time.Minute)
+	assertNamedColorsById(t, cache, &bar)
+
+	// Write through invalidation
+	baz := foo
+	baz.Description = "Baz"
+	updater := huedb.InvalidatingUpdateNamedColorsRunner(store, cache)
+	if err := updater.UpdateNamedColors(nil, &baz); err != nil {
+		t.Fatalf("Got error updating: %v", err)
+	}
+	assertNamedColorsById(t, cache, &baz)
+	remover := huedb.InvalidatingRemoveNamedColorsRunner(store, cache)
+	if err := remover.RemoveNamedColors(nil, foo.Id); err != nil {
+		t.Fatalf("Got error removing: %v", err)
+	}
+	var namedColors ops.NamedColors
+	if err := cache.NamedColorsById(
+		nil, foo.Id, &namedColors); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected ErrNoSuchId, got %v", err)
+	}
+}
+
+func TestCachedDynamicHueTaskStore(t *testing.T) {
+	store := fakeDynamicHueTaskStore{
+		1: &dynamic.HueTask{Id: 1, Description: "One"}}
+	clock := &tasks.ClockForTesting{Current: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)}
+	cache := huedb.NewCachedDynamicHueTaskStoreWithClock(
+		store, time.Minute, clock)
+	first := cache.ById(1)
+	store[1] = &dynamic.HueTask{Id: 1, Description: "Uno"}
+	if out := cache.ById(1); out != first {
+		t.Errorf("Expected %v, got %v", first, out)
+	}
+	cache.Invalidate(1)
+	if out := cache.ById(1); out != store[1] {
+		t.Errorf("Expected %v, got %v", store[1], out)
+	}
+	if out := cache.ById(2); out != nil {
+		t.Errorf("Expected nil, got %v", out)
+	}
+}
+
+func assertNamedColorsById(
+	t *testing.T,
+	store huedb.NamedColorsByIdRunner,
+	expected *ops.NamedColors) {
+	t.Helper()
+	var actual ops.NamedColors
+	if err := store.NamedColorsById(nil, expected.Id, &actual); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if !reflect.DeepEqual(expected, &actual) {
+		t.Errorf("Expected %v, got %v", expected, &actual)
+	}
+}
@@ -0,0 +1,233 @@
+package huedb
+
+import (
+	"encoding/json"
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	kColorsVersion = 2
+)
+
+// EncodeLightColors encodes colors as a string for storing in a database
+// column. The encoding is JSON so that new per light fields can be added
+// later. EncodeLightColors returns ErrBadLightColors if colors has a
+// negative light id, a color out of range, or a color temperature of 0.
+func EncodeLightColors(colors ops.LightColors) (string, error) {
+	result := jsonLightColors{
+		Version: kColorsVersion,
+		Lights:  make([]jsonLightColor, 0, len(colors)),
+	}
+	for lightId, colorBrightness := range colors {
+		if lightId < 0 {
+			return "", ErrBadLightColors
+		}
+		if colorBrightness.Color.Valid {
+			x := colorBrightness.Color.X()
+			y := colorBrightness.Color.Y()
+			if x < 0.0 || x > 1.0 || y < 0.0 || y > 1.0 {
+				return "", ErrBadLightColors
+			}
+		}
+		if colorBrightness.ColorTemperature.Valid &&
+			colorBrightness.ColorTemperature.Value == 0 {
+			return "", ErrBadLightColors
+		}
+		result.Lights = append(
+			result.Lights,
+			jsonLightColor{
+				Id:                  lightId,
+				jsonColorBrightness: asJSONColorBrightness(colorBrightness),
+			})
+	}
+	sort.Slice(result.Lights, func(i, j int) bool {
+		return result.Lights[i].Id < result.Lights[j].Id
+	})
+	encoded, err := json.Marshal(&result)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// DecodeLightColors decodes a string that EncodeLightColors produced.
+// DecodeLightColors also understands the pipe delimited format that
+// EncodeLightColors used to produce. If there are no colors,
+// DecodeLightColors returns nil. If encoded is malformed,
+// DecodeLightColors returns an error, usually ErrBadLightColors.
+func DecodeLightColors(encoded string) (ops.LightColors, error) {
+	if !strings.HasPrefix(encoded, "{") {
+		return decodeLegacyLightColors(encoded)
+	}
+	var decoded jsonLightColors
+	if err := json.Unmarshal([]byte(encoded), &decoded); err != nil {
+		return nil, err
+	}
+	if decoded.Version != kColorsVersion {
+		return nil, ErrBadLightColors
+	}
+	if len(decoded.Lights) == 0 {
+		return nil, nil
+	}
+	lightColors := make(ops.LightColors, len(decoded.Lights))
+	for _, light := range decoded.Lights {
+		if light.Id < 0 {
+			return nil, ErrBadLightColors
+		}
+		colorBrightness, err := light.asColorBrightness()
+		if err != nil {
+			return nil, err
+		}
+		lightColors[light.Id] = colorBrightness
+	}
+	return lightColors, nil
+}
+
+// decodeLegacyLightColors decodes the pipe delimited format.
+func decodeLegacyLightColors(encoded string) (ops.LightColors, error) {
+	if !strings.HasPrefix(encoded, "0|") && encoded != "0" {
+		return nil, ErrBadLightColors
+	}
+	marshalled := strings.Split(encoded, "|")
+	marshalledLen := len(marshalled)
+	if (marshalledLen-1)%4 != 0 {
+		return nil, ErrBadLightColors
+	}
+	lightColors := make(ops.LightColors, (marshalledLen-1)/4)
+	for idx := 1; idx < marshalledLen; idx += 4 {
+		lightId, err := strconv.Atoi(marshalled[idx])
+		if err != nil {
+			return nil, err
+		}
+		var ix int
+		if ix, err = strconv.Atoi(marshalled[idx+1]); err != nil {
+			return nil, err
+		}
+		var iy int
+		if iy, err = strconv.Atoi(marshalled[idx+2]); err != nil {
+			return nil, err
+		}
+		var ibrightness int
+		if ibrightness, err = strconv.Atoi(marshalled[idx+3]); err != nil {
+			return nil, err
+		}
+		if lightId < 0 {
+			return nil, ErrBadLightColors
+		}
+		var theColor gohue.MaybeColor
+		if ix != -1 {
+			x := float64(ix) / 10000.0
+			y := float64(iy) / 10000.0
+			if x < 0.0 || x > 1.0 || y < 0.0 || y > 1.0 {
+				return nil, ErrBadLightColors
+			}
+			theColor.Set(gohue.NewColor(x, y))
+		}
+		var theBrightness maybe.Uint8
+		if ibrightness != -1 {
+			if ibrightness < 0 || ibrightness > 255 {
+				return nil, ErrBadLightColors
+			}
+			theBrightness.Set(uint8(ibrightness))
+		}
+		lightColors[lightId] = ops.ColorBrightness{
+			Color: theColor, Brightness: theBrightness}
+	}
+	if len(lightColors) == 0 {
+		return nil, nil
+	}
+	return lightColors, nil
+}
+
+// jsonLightColors is the JSON form of ops.LightColors.
+type jsonLightColors struct {
+	Version int
+	Lights  []jsonLightColor
+}
+
+type jsonLightColor struct {
+	Id int
+	jsonColorBrightness
+}
+
+// jsonColorBrightness is the JSON form of ops.ColorBrightness. nil fields
+// mean no value.
+type jsonColorBrightness struct {
+	X                *float64 `json:",omitempty"`
+	Y                *float64 `json:",omitempty"`
+	Brightness       *uint8   `json:",omitempty"`
+	On               *bool    `json:",omitempty"`
+	ColorTemperature *uint16  `json:",omitempty"`
+	TransitionTime   *uint16  `json:",omitempty"`
+}
+
+func asJSONColorBrightness(
+	colorBrightness ops.ColorBrightness) jsonColorBrightness {
+	var result jsonColorBrightness
+	if colorBrightness.Color.Valid {
+		x := roundCoordinate(colorBrightness.Color.X())
+		y := roundCoordinate(colorBrightness.Color.Y())
+		result.X = &x
+		result.Y = &y
+	}
+	if colorBrightness.Brightness.Valid {
+		brightness := colorBrightness.Brightness.Value
+		result.Brightness = &brightness
+	}
+	if colorBrightness.On.Valid {
+		on := colorBrightness.On.Value
+		result.On = &on
+	}
+	if colorBrightness.ColorTemperature.Valid {
+		mireds := colorBrightness.ColorTemperature.Value
+		result.ColorTemperature = &mireds
+	}
+	if colorBrightness.TransitionTime.Valid {
+		transitionTime := colorBrightness.TransitionTime.Value
+		result.TransitionTime = &transitionTime
+	}
+	return result
+}
+
+// asColorBrightness returns ErrBadLightColors if the color is out of
+// range or if only one of X and Y is present.
+func (j *jsonColorBrightness) asColorBrightness() (
+	result ops.ColorBrightness, err error) {
+	if (j.X == nil) != (j.Y == nil) {
+		return ops.ColorBrightness{}, ErrBadLightColors
+	}
+	if j.X != nil {
+		x, y := *j.X, *j.Y
+		if x < 0.0 || x > 1.0 || y < 0.0 || y > 1.0 {
+			return ops.ColorBrightness{}, ErrBadLightColors
+		}
+		result.Color = gohue.NewMaybeColor(gohue.NewColor(x, y))
+	}
+	if j.Brightness != nil {
+		result.Brightness = maybe.NewUint8(*j.Brightness)
+	}
+	if j.On != nil {
+		result.On = maybe.NewBool(*j.On)
+	}
+	if j.ColorTemperature != nil {
+		if *j.ColorTemperature == 0 {
+			return ops.ColorBrightness{}, ErrBadLightColors
+		}
+		result.ColorTemperature = maybe.NewUint16(*j.ColorTemperature)
+	}
+	if j.TransitionTime != nil {
+		result.TransitionTime = maybe.NewUint16(*j.TransitionTime)
+	}
+	return
+}
+
+// roundCoordinate rounds a color coordinate to 4 decimal places.
+func roundCoordinate(x float64) float64 {
+	return math.Floor(x*10000.0+0.5) / 10000.0
+}
@@ -0,0 +1,99 @@
+package huedb_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeLightColors(t *testing.T) {
+	colors := ops.LightColors{
+		3: {Color: gohue.NewMaybeColor(gohue.NewColor(0.5, 0.3)),
+			Brightness: maybe.NewUint8(98)},
+		6: {Color: gohue.MaybeColor{}, Brightness: maybe.Uint8{}},
+	}
+	encoded, err := huedb.EncodeLightColors(colors)
+	if err != nil {
+		t.Fatalf("Got error encoding: %v", err)
+	}
+	expected := `{"Version":2,"Lights":[{"Id":3,"X":0.5,"Y":0.3,"Brightness":98},{"Id":6}]}`
+	if encoded != expected {
+		t.Errorf("Expected %s, got %s", expected, encoded)
+	}
+	decoded, err := huedb.DecodeLightColors(encoded)
+	if err != nil {
+		t.Fatalf("Got error decoding: %v", err)
+	}
+	if !reflect.DeepEqual(colors, decoded) {
+		t.Errorf("Expected %v, got %v", colors, decoded)
+	}
+	decoded, err = huedb.DecodeLightColors("0|3|5000|3000|98|6|-1|0|-1")
+	if err != nil {
+		t.Fatalf("Got error decoding legacy format: %v", err)
+	}
+	if !reflect.DeepEqual(colors, decoded) {
+		t.Errorf("Expected %v, got %v", colors, decoded)
+	}
+}
+
+func TestEncodeDecodeLightColorsOn(t *testing.T) {
+	colors := ops.LightColors{
+		2: {Brightness: maybe.NewUint8(10), On: maybe.NewBool(false)},
+		5: {On: maybe.NewBool(true)},
+		7: {ColorTemperature: maybe.NewUint16(370)},
+		8: {Brightness: maybe.NewUint8(3), TransitionTime: maybe.NewUint16(0)},
+	}
+	encoded, err := huedb.EncodeLightColors(colors)
+	if err != nil {
+		t.Fatalf("Got error encoding: %v", err)
+	}
+	expected := `{"Version":2,"Lights":[{"Id":2,"Brightness":10,"On":false},{"Id":5,"On":true},{"Id":7,"ColorTemperature":370},{"Id":8,"Brightness":3,"TransitionTime":0}]}`
+	if encoded != expected {
+		t.Errorf("Expected %s, got %s", expected, encoded)
+	}
+	decoded, err := huedb.DecodeLightColors(encoded)
+	if err != nil {
+		t.Fatalf("Got error decoding: %v", err)
+	}
+	if !reflect.DeepEqual(colors, decoded) {
+		t.Errorf("Expected %v, got %v", colors, decoded)
+	}
+}
+
+func TestDecodeLightColorsEmpty(t *testing.T) {
+	encoded, err := huedb.EncodeLightColors(nil)
+	if err != nil {
+		t.Fatalf("Got error encoding: %v", err)
+	}
+	for _, s := range []string{encoded, "0"} {
+		decoded, err := huedb.DecodeLightColors(s)
+		if err != nil {
+			t.Errorf("Got error decoding %s: %v", s, err)
+		}
+		if decoded != nil {
+			t.Errorf("Expected nil, got %v", decoded)
+		}
+	}
+}
+
+func TestDecodeLightColorsBad(t *testing.T) {
+	bad := []string{
+		`{"Version":3,"Lights":[]}`,
+		`{"Version":2,"Lights":[{"Id":-1}]}`,
+		`{"Version":2,"Lights":[{"Id":1,"X":0.5}]}`,
+		`{"Version":2,"Lights":[{"Id":1,"X":1.5,"Y":0.5}]}`,
+		"1|3|5000|3000|98",
+	}
+	for _, s := range bad {
+		if _, err := huedb.DecodeLightColors(s); err == nil {
+			t.Errorf("Expected error decoding %s", s)
+		}
+	}
+	if _, err := huedb.EncodeLightColors(
+		ops.LightColors{-1: {}}); err != huedb.ErrBadLightColors {
+		t.Errorf("Expected ErrBadLightColors, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package huedb
+
+import (
+	"errors"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+)
+
+const (
+	kMaxSceneDepth = 8
+)
+
+var (
+	// Indicates that a scene includes itself directly or indirectly.
+	ErrSceneCycle = errors.New("huedb: Scene includes itself.")
+)
+
+// SceneComponent includes the colors of one stored scene in another.
+type SceneComponent struct {
+	// The unique database dependent numeric ID of this component.
+	Id int64
+
+	// The id of the named colors that include the component.
+	NamedColorsId int64
+
+	// The id of the included named colors.
+	ComponentId int64
+
+	// The encoded set of lights to take from the included named colors.
+	// Empty means all lights. lights.InvString decodes it.
+	LightSet string
+
+	// Added to each light id of the included named colors after
+	// LightSet is applied. Lets a scene for one room apply to another
+	// room with the same layout.
+	LightOffset int
+}
+
+type SceneComponentsRunner interface {
+	// SceneComponents gets the components of the named colors with given
+	// id in ascending order by id.
+	SceneComponents(
+		t db.Transaction, namedColorsId int64, consumer goconsume.Consumer) error
+}
+
+type AddSceneComponentRunner interface {
+	// AddSceneComponent adds a scene component.
+	AddSceneComponent(t db.Transaction, component *SceneComponent) error
+}
+
+type RemoveSceneComponentRunner interface {
+	// RemoveSceneComponent removes a scene component by id.
+	RemoveSceneComponent(t db.Transaction, id int64) error
+}
+
+// CompositeStore is what CompositeNamedColorsByIdRunner reads.
+type CompositeStore interface {
+	NamedColorsByIdRunner
+	SceneComponentsRunner
+}
+
+// CompositeNamedColorsByIdRunner returns a NamedColorsByIdRunner that
+// flattens stored scenes that include other scenes. The colors of a
+// fetched scene are the colors of each component in order followed by
+// its own colors. Later colors for the same light win. Pass the returned
+// runner to HueTaskById, FutureHueTask, or NewActionDecoder to run
+// composite scenes as a single StaticHueAction. Fetching returns
+// ErrSceneCycle if a scene includes itself.
+func CompositeNamedColorsByIdRunner(
+	store CompositeStore) NamedColorsByIdRunner {
+	return compositeRunner{store}
+}
+
+type compositeRunner struct {
+	store CompositeStore
+}
+
+func (c compositeRunner) NamedColorsById(
+	t db.Transaction, id int64, namedColors *ops.NamedColors) error {
+	return c.resolve(t, id, namedColors, make(map[int64]bool))
+}
+
+// resolve fetches the named colors with given id and flattens their
+// components. visiting holds the ids of the scenes being resolved.
+func (c compositeRunner) resolve(
+	t db.Transaction,
+	id int64,
+	namedColors *ops.NamedColors,
+	visiting map[int64]bool) error {
+	if visiting[id] || len(visiting) >= kMaxSceneDepth {
+		return ErrSceneCycle
+	}
+	if err := c.store.NamedColorsById(t, id, namedColors); err != nil {
+		return err
+	}
+	var components []SceneComponent
+	if err := c.store.SceneComponents(
+		t, id, goconsume.AppendTo(&components)); err != nil {
+		return err
+	}
+	if len(components) == 0 {
+		return nil
+	}
+	visiting[id] = true
+	defer delete(visiting, id)
+	flattened := make(ops.LightColors)
+	for i := range components {
+		var included ops.NamedColors
+		if err := c.resolve(
+			t, components[i].ComponentId, &included, visiting); err != nil {
+			return err
+		}
+		if err := components[i].addColors(included.Colors, flattened); err != nil {
+			return err
+		}
+	}
+	for lightId, colorBrightness := range namedColors.Colors {
+		flattened[lightId] = colorBrightness
+	}
+	namedColors.Colors = flattened
+	return nil
+}
+
+// addColors adds the colors from this component's included scene to
+// dest applying LightSet and LightOffset.
+func (s *SceneComponent) addColors(colors, dest ops.LightColors) error {
+	lightSet, err := lights.InvString(s.LightSet)
+	if err != nil {
+		return err
+	}
+	for lightId, colorBrightness := range colors {
+		if !lightSet.IsAll() && !lightSet[lightId] {
+			continue
+		}
+		dest[lightId+s.LightOffset] = colorBrightness
+	}
+	return nil
+}
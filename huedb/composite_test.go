@@ -0,0 +1,96 @@
+package huedb_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"reflect"
+	"testing"
+)
+
+func TestCompositeNamedColorsByIdRunner(t *testing.T) {
+	red := ops.ColorBrightness{
+		Color:      gohue.NewMaybeColor(gohue.NewColor(0.6, 0.3)),
+		Brightness: maybe.NewUint8(200)}
+	blue := ops.ColorBrightness{
+		Color:      gohue.NewMaybeColor(gohue.NewColor(0.2, 0.1)),
+		Brightness: maybe.NewUint8(100)}
+	dim := ops.ColorBrightness{Brightness: maybe.NewUint8(10)}
+	store := in_memory.New()
+	livingRoom := ops.NamedColors{
+		Description: "Living room", Colors: ops.LightColors{1: red, 2: red}}
+	kitchen := ops.NamedColors{
+		Description: "Kitchen", Colors: ops.LightColors{1: blue, 2: blue}}
+	movieNight := ops.NamedColors{
+		Description: "Movie night", Colors: ops.LightColors{2: dim}}
+	addNamedColors(t, store, &livingRoom, &kitchen, &movieNight)
+	addSceneComponents(
+		t,
+		store,
+		&huedb.SceneComponent{
+			NamedColorsId: movieNight.Id, ComponentId: livingRoom.Id},
+		&huedb.SceneComponent{
+			NamedColorsId: movieNight.Id,
+			ComponentId:   kitchen.Id,
+			LightSet:      "1",
+			LightOffset:   10})
+	runner := huedb.CompositeNamedColorsByIdRunner(store)
+	var result ops.NamedColors
+	if err := runner.NamedColorsById(nil, movieNight.Id, &result); err != nil {
+		t.Fatalf("Got error resolving: %v", err)
+	}
+	expected := ops.LightColors{1: red, 2: dim, 11: blue}
+	if !reflect.DeepEqual(expected, result.Colors) {
+		t.Errorf("Expected %v, got %v", expected, result.Colors)
+	}
+	if result.Description != "Movie night" {
+		t.Errorf("Expected Movie night, got %s", result.Description)
+	}
+
+	// Plain scenes come back unchanged
+	if err := runner.NamedColorsById(nil, kitchen.Id, &result); err != nil {
+		t.Fatalf("Got error resolving: %v", err)
+	}
+	if !reflect.DeepEqual(kitchen.Colors, result.Colors) {
+		t.Errorf("Expected %v, got %v", kitchen.Colors, result.Colors)
+	}
+
+	hueTask := huedb.HueTaskById(
+		runner, int(movieNight.Id)+ops.PersistentTaskIdOffset)
+	if out := hueTask.HueAction; !reflect.DeepEqual(
+		ops.StaticHueAction(expected), out) {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+}
+
+func TestCompositeNamedColorsByIdRunnerCycle(t *testing.T) {
+	store := in_memory.New()
+	var first, second ops.NamedColors
+	addNamedColors(t, store, &first, &second)
+	addSceneComponents(
+		t,
+		store,
+		&huedb.SceneComponent{
+			NamedColorsId: first.Id, ComponentId: second.Id},
+		&huedb.SceneComponent{
+			NamedColorsId: second.Id, ComponentId: first.Id})
+	runner := huedb.CompositeNamedColorsByIdRunner(store)
+	var result ops.NamedColors
+	if err := runner.NamedColorsById(
+		nil, first.Id, &result); err != huedb.ErrSceneCycle {
+		t.Errorf("Expected ErrSceneCycle, got %v", err)
+	}
+}
+
+func addSceneComponents(
+	t *testing.T,
+	store huedb.AddSceneComponentRunner,
+	components ...*huedb.SceneComponent) {
+	for _, component := range components {
+		if err := store.AddSceneComponent(nil, component); err != nil {
+			t.Fatalf("Got error adding scene component: %v", err)
+		}
+	}
+}
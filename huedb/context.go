@@ -0,0 +1,73 @@
+package huedb
+
+import (
+	"context"
+	"github.com/keep94/marvin/ops"
+)
+
+// ContextRunner binds a context to a store.
+type ContextRunner interface {
+	// WithContext returns a Store that works like this one except that
+	// it passes ctx down to the database. Once ctx is done, calls to the
+	// returned Store give up and return ctx.Err().
+	WithContext(ctx context.Context) Store
+}
+
+// NamedColorsByIdWithContext works like store.NamedColorsById with a nil
+// transaction except that it returns ctx.Err() once ctx is done. If
+// store implements ContextRunner, NamedColorsByIdWithContext passes ctx
+// down to the database so that it can give up while waiting on it.
+// Otherwise it only checks ctx before calling store. namedColors is left
+// unchanged if NamedColorsByIdWithContext returns an error.
+func NamedColorsByIdWithContext(
+	ctx context.Context,
+	store NamedColorsByIdRunner,
+	id int64,
+	namedColors *ops.NamedColors) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if runner, ok := store.(ContextRunner); ok {
+		store = runner.WithContext(ctx)
+	}
+	var result ops.NamedColors
+	if err := store.NamedColorsById(nil, id, &result); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	*namedColors = result
+	return nil
+}
+
+// HueTaskByIdWithContext works like HueTaskById except that it gives up
+// as soon as ctx is done. When it gives up, the action of the returned
+// hue task reports ctx.Err().
+func HueTaskByIdWithContext(
+	ctx context.Context,
+	store NamedColorsByIdRunner,
+	hueTaskId int) *ops.HueTask {
+	if store == nil {
+		return HueTaskById(nil, hueTaskId)
+	}
+	var namedColors ops.NamedColors
+	err := NamedColorsByIdWithContext(
+		ctx,
+		store,
+		int64(hueTaskId-ops.PersistentTaskIdOffset),
+		&namedColors)
+	if err != nil {
+		return &ops.HueTask{
+			Id: hueTaskId, HueAction: errAction{err}, Description: "Error"}
+	}
+	return namedColors.AsHueTask()
+}
+
+// RefreshWithContext works like Refresh except that it gives up reading
+// persistent storage as soon as ctx is done.
+func (f *FutureHueTask) RefreshWithContext(ctx context.Context) *ops.HueTask {
+	result := *HueTaskByIdWithContext(ctx, f.Store, f.Id)
+	result.Description = f.Description
+	return &result
+}
@@ -0,0 +1,74 @@
+package huedb_test
+
+import (
+	"context"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/ops"
+	"testing"
+	"time"
+)
+
+func TestNamedColorsByIdWithContext(t *testing.T) {
+	store := in_memory.New()
+	addNamedColors(
+		t, store, &ops.NamedColors{Description: "Foo", Colors: kColorMap1})
+	var namedColors ops.NamedColors
+	if err := huedb.NamedColorsByIdWithContext(
+		context.Background(), store, 1, &namedColors); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if namedColors.Description != "Foo" {
+		t.Errorf("Expected Foo, got %s", namedColors.Description)
+	}
+}
+
+func TestNamedColorsByIdWithContextTimeout(t *testing.T) {
+	store := wedgedStore{unblock: make(chan struct{})}
+	defer close(store.unblock)
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var namedColors ops.NamedColors
+	if err := huedb.NamedColorsByIdWithContext(
+		ctx, store, 1, &namedColors); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	future := &huedb.FutureHueTask{
+		Id:          ops.PersistentTaskIdOffset + 1,
+		Description: "Foo",
+		Store:       store,
+	}
+	hueTask := future.RefreshWithContext(ctx)
+	if hueTask.Description != "Foo" {
+		t.Errorf("Expected Foo, got %s", hueTask.Description)
+	}
+}
+
+// wedgedStore blocks until unblock is closed or until the context that
+// WithContext bound to it is done.
+type wedgedStore struct {
+	huedb.Store
+	unblock chan struct{}
+	ctx     context.Context
+}
+
+func (w wedgedStore) WithContext(ctx context.Context) huedb.Store {
+	w.ctx = ctx
+	return w
+}
+
+func (w wedgedStore) NamedColorsById(
+	t db.Transaction, id int64, namedColors *ops.NamedColors) error {
+	var done <-chan struct{}
+	if w.ctx != nil {
+		done = w.ctx.Done()
+	}
+	select {
+	case <-w.unblock:
+		return huedb.ErrNoSuchId
+	case <-done:
+		return w.ctx.Err()
+	}
+}
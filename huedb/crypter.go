@@ -0,0 +1,82 @@
+package huedb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	kEncryptedPrefix = "enc1:"
+)
+
+var (
+	// Indicates that an encrypted value could not be decrypted, usually
+	// because the key is wrong.
+	ErrBadCiphertext = errors.New("huedb: Cannot decrypt value.")
+)
+
+// Crypter encrypts database column values at rest using AES-GCM.
+// A nil *Crypter leaves values unencrypted. Crypter instances are safe
+// to use with multiple goroutines.
+type Crypter struct {
+	aead cipher.AEAD
+}
+
+// NewCrypter returns a Crypter that uses key which must be 16, 24, or 32
+// bytes long.
+func NewCrypter(key []byte) (*Crypter, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Crypter{aead: aead}, nil
+}
+
+// Encrypt encrypts plain. If c is nil, Encrypt returns plain unchanged.
+func (c *Crypter) Encrypt(plain string) (string, error) {
+	if c == nil {
+		return plain, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return kEncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value that Encrypt produced. Decrypt returns values
+// that were never encrypted unchanged so that databases can be
+// encrypted gradually. If c is nil, Decrypt returns ErrBadCiphertext for
+// encrypted values.
+func (c *Crypter) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, kEncryptedPrefix) {
+		return value, nil
+	}
+	if c == nil {
+		return "", ErrBadCiphertext
+	}
+	sealed, err := base64.StdEncoding.DecodeString(
+		value[len(kEncryptedPrefix):])
+	if err != nil {
+		return "", ErrBadCiphertext
+	}
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", ErrBadCiphertext
+	}
+	plain, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", ErrBadCiphertext
+	}
+	return string(plain), nil
+}
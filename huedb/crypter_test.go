@@ -0,0 +1,62 @@
+package huedb_test
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"strings"
+	"testing"
+)
+
+func TestCrypter(t *testing.T) {
+	crypter := newCrypter(t, "0123456789abcdef0123456789abcdef")
+	encrypted, err := crypter.Encrypt("1,2,3")
+	if err != nil {
+		t.Fatalf("Got error encrypting: %v", err)
+	}
+	if strings.Contains(encrypted, "1,2,3") {
+		t.Errorf("Expected ciphertext, got %s", encrypted)
+	}
+	again, _ := crypter.Encrypt("1,2,3")
+	if again == encrypted {
+		t.Error("Expected different ciphertext each time.")
+	}
+	assertDecrypt(t, crypter, encrypted, "1,2,3")
+
+	// Unencrypted values pass through
+	assertDecrypt(t, crypter, "1,2,3", "1,2,3")
+	var nilCrypter *huedb.Crypter
+	assertDecrypt(t, nilCrypter, "1,2,3", "1,2,3")
+	if out, _ := nilCrypter.Encrypt("1,2,3"); out != "1,2,3" {
+		t.Errorf("Expected 1,2,3, got %s", out)
+	}
+
+	wrongKey := newCrypter(t, "fedcba9876543210fedcba9876543210")
+	if _, err := wrongKey.Decrypt(encrypted); err != huedb.ErrBadCiphertext {
+		t.Errorf("Expected ErrBadCiphertext, got %v", err)
+	}
+	if _, err := nilCrypter.Decrypt(encrypted); err != huedb.ErrBadCiphertext {
+		t.Errorf("Expected ErrBadCiphertext, got %v", err)
+	}
+	if _, err := huedb.NewCrypter([]byte("short")); err == nil {
+		t.Error("Expected error for bad key length.")
+	}
+}
+
+func newCrypter(t *testing.T, key string) *huedb.Crypter {
+	crypter, err := huedb.NewCrypter([]byte(key))
+	if err != nil {
+		t.Fatalf("Got error creating crypter: %v", err)
+	}
+	return crypter
+}
+
+func assertDecrypt(
+	t *testing.T, crypter *huedb.Crypter, value, expected string) {
+	t.Helper()
+	actual, err := crypter.Decrypt(value)
+	if err != nil {
+		t.Errorf("Got error decrypting: %v", err)
+	}
+	if actual != expected {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
@@ -0,0 +1,153 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/ops"
+	"sort"
+)
+
+// DescriptionOverride replaces the displayed description of a stored
+// hue task without changing the stored named colors.
+type DescriptionOverride struct {
+	// The id of the hue task. Unique among overrides.
+	HueTaskId int
+
+	// The description to display.
+	Description string
+}
+
+type DescriptionOverridesRunner interface {
+	// DescriptionOverrides gets all description overrides in ascending
+	// order by hue task id.
+	DescriptionOverrides(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+type SetDescriptionOverrideRunner interface {
+	// SetDescriptionOverride adds or replaces the description override
+	// for override.HueTaskId.
+	SetDescriptionOverride(
+		t db.Transaction, override *DescriptionOverride) error
+}
+
+type RemoveDescriptionOverrideRunner interface {
+	// RemoveDescriptionOverride removes the description override for a
+	// hue task id.
+	RemoveDescriptionOverride(t db.Transaction, hueTaskId int) error
+}
+
+// DescriptionOverrideStore persists description overrides.
+type DescriptionOverrideStore interface {
+	DescriptionOverridesRunner
+	SetDescriptionOverrideRunner
+	RemoveDescriptionOverrideRunner
+}
+
+// DescriptionOverrides lets a DescriptionMap serve as a read only source
+// of description overrides.
+func (m DescriptionMap) DescriptionOverrides(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&DescriptionOverride{
+			HueTaskId: id, Description: m[id]})
+	}
+	return nil
+}
+
+// ReadDescriptionMap reads all the description overrides in store into
+// a DescriptionMap.
+func ReadDescriptionMap(
+	t db.Transaction, store DescriptionOverridesRunner) (
+	DescriptionMap, error) {
+	if m, ok := store.(DescriptionMap); ok {
+		return m, nil
+	}
+	var overrides []DescriptionOverride
+	if err := store.DescriptionOverrides(
+		t, goconsume.AppendTo(&overrides)); err != nil {
+		return nil, err
+	}
+	result := make(DescriptionMap, len(overrides))
+	for _, override := range overrides {
+		result[override.HueTaskId] = override.Description
+	}
+	return result, nil
+}
+
+// OverrideDescriptionByIdRunner returns a new NamedColorsByIdRunner that
+// works just like delegate except that for a fetched NamedColors, x,
+// if overrides has an override for x.Id + ops.PersistentTaskIdOffset,
+// then x.Description is replaced with the overriding description.
+// The returned runner reads overrides each time it is called so that
+// changes to overrides take effect immediately.
+func OverrideDescriptionByIdRunner(
+	delegate NamedColorsByIdRunner,
+	overrides DescriptionOverridesRunner) NamedColorsByIdRunner {
+	return &fixDescriptionByIdRunner{
+		delegate: delegate, overrides: overrides}
+}
+
+// OverrideDescriptionsRunner returns a new NamedColorsRunner that works
+// just like delegate except that for a fetched NamedColors, x,
+// if overrides has an override for x.Id + ops.PersistentTaskIdOffset,
+// then x.Description is replaced with the overriding description.
+// The returned runner reads overrides each time it is called so that
+// changes to overrides take effect immediately.
+func OverrideDescriptionsRunner(
+	delegate NamedColorsRunner,
+	overrides DescriptionOverridesRunner) NamedColorsRunner {
+	return &fixDescriptionRunner{delegate: delegate, overrides: overrides}
+}
+
+type descriptionMapFilter DescriptionMap
+
+func (f descriptionMapFilter) Filter(ptr interface{}) bool {
+	p := ptr.(*ops.NamedColors)
+	desc, ok := f[int(p.Id)+ops.PersistentTaskIdOffset]
+	if ok {
+		p.Description = desc
+	}
+	return true
+}
+
+type fixDescriptionRunner struct {
+	delegate  NamedColorsRunner
+	overrides DescriptionOverridesRunner
+}
+
+func (r *fixDescriptionRunner) NamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	descriptionMap, err := ReadDescriptionMap(t, r.overrides)
+	if err != nil {
+		return err
+	}
+	consumer = goconsume.Filter(
+		consumer, descriptionMapFilter(descriptionMap).Filter)
+	return r.delegate.NamedColors(t, consumer)
+}
+
+type fixDescriptionByIdRunner struct {
+	delegate  NamedColorsByIdRunner
+	overrides DescriptionOverridesRunner
+}
+
+func (r *fixDescriptionByIdRunner) NamedColorsById(
+	t db.Transaction, id int64, namedColors *ops.NamedColors) error {
+	if err := r.delegate.NamedColorsById(t, id, namedColors); err != nil {
+		return err
+	}
+	descriptionMap, err := ReadDescriptionMap(t, r.overrides)
+	if err != nil {
+		return err
+	}
+	descriptionMapFilter(descriptionMap).Filter(namedColors)
+	return nil
+}
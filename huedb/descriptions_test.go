@@ -0,0 +1,57 @@
+package huedb_test
+
+import (
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"reflect"
+	"testing"
+)
+
+func TestOverrideDescriptionsRunner(t *testing.T) {
+	overrides := in_memory.New()
+	runner := huedb.OverrideDescriptionsRunner(kFakeStore, overrides)
+	if err := overrides.SetDescriptionOverride(
+		nil,
+		&huedb.DescriptionOverride{
+			HueTaskId: 10004, Description: "Baz"}); err != nil {
+		t.Fatalf("Got error setting override: %v", err)
+	}
+	tasks, err := huedb.HueTasks(runner)
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if !reflect.DeepEqual(kExpectedHueTasks, tasks) {
+		t.Errorf("Expected %v, got %v", kExpectedHueTasks, tasks)
+	}
+}
+
+func TestOverrideDescriptionByIdRunner(t *testing.T) {
+	overrides := in_memory.New()
+	runner := huedb.OverrideDescriptionByIdRunner(
+		fakeNamedColorsByIdRunner{kFakeStore[1]}, overrides)
+	task := huedb.HueTaskById(runner, 10004)
+	if task.Description != "Bar" {
+		t.Errorf("Expected Bar, got %s", task.Description)
+	}
+	overrides.SetDescriptionOverride(
+		nil, &huedb.DescriptionOverride{HueTaskId: 10004, Description: "Baz"})
+	task = huedb.HueTaskById(runner, 10004)
+	if !reflect.DeepEqual(kExpectedHueTasks[1], task) {
+		t.Errorf("Expected %v, got %v", kExpectedHueTasks[1], task)
+	}
+}
+
+func TestDescriptionMapOverrides(t *testing.T) {
+	descriptionMap := huedb.DescriptionMap{10004: "Baz", 10002: "Foo"}
+	var overrides []huedb.DescriptionOverride
+	descriptionMap.DescriptionOverrides(
+		nil, goconsume.AppendTo(&overrides))
+	expected := []huedb.DescriptionOverride{
+		{HueTaskId: 10002, Description: "Foo"},
+		{HueTaskId: 10004, Description: "Baz"},
+	}
+	if !reflect.DeepEqual(expected, overrides) {
+		t.Errorf("Expected %v, got %v", expected, overrides)
+	}
+}
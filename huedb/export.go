@@ -0,0 +1,266 @@
+package huedb
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/ops"
+	"io"
+)
+
+const (
+	kExportVersion = 2
+)
+
+var (
+	// Indicates that Import does not understand the export format.
+	ErrBadExport = errors.New("huedb: Unsupported export format.")
+)
+
+// ExportStore is what Export reads.
+type ExportStore interface {
+	NamedColorsRunner
+	EncodedAtTimeTaskStore
+	EncodedScheduledTasksRunner
+	LightAliasesRunner
+	LightGroupsRunner
+	SceneComponentsRunner
+	DescriptionOverridesRunner
+	ScheduleProfilesRunner
+}
+
+// ImportStore is what Import writes.
+type ImportStore interface {
+	AddNamedColorsBatchRunner
+	EncodedAtTimeTaskStore
+	AddEncodedScheduledTaskRunner
+	AddLightAliasRunner
+	AddLightGroupRunner
+	AddSceneComponentRunner
+	SetDescriptionOverrideRunner
+	AddScheduleProfileRunner
+	ActivateScheduleProfileRunner
+}
+
+// Export writes the named colors and their scene components, the at time
+// tasks in each group in groupIds, the scheduled tasks, the light
+// aliases and groups, the description overrides, and the schedule
+// profiles in store to w as indented JSON.
+func Export(
+	t db.Transaction,
+	w io.Writer,
+	store ExportStore,
+	groupIds ...string) error {
+	result := exportedDatabase{Version: kExportVersion}
+	consumer := goconsume.Map(
+		goconsume.AppendTo(&result.NamedColors),
+		func(src, dest interface{}) bool {
+			*dest.(*exportedNamedColors) = asExportedNamedColors(
+				src.(*ops.NamedColors))
+			return true
+		},
+		(*exportedNamedColors)(nil))
+	if err := store.NamedColors(t, consumer); err != nil {
+		return err
+	}
+	for _, groupId := range groupIds {
+		if err := store.EncodedAtTimeTasks(
+			t,
+			groupId,
+			goconsume.AppendTo(&result.AtTimeTasks)); err != nil {
+			return err
+		}
+	}
+	if err := store.EncodedScheduledTasks(
+		t, goconsume.AppendTo(&result.ScheduledTasks)); err != nil {
+		return err
+	}
+	for i := range result.NamedColors {
+		if err := store.SceneComponents(
+			t,
+			result.NamedColors[i].Id,
+			goconsume.AppendTo(&result.SceneComponents)); err != nil {
+			return err
+		}
+	}
+	if err := store.LightAliases(
+		t, goconsume.AppendTo(&result.LightAliases)); err != nil {
+		return err
+	}
+	if err := store.LightGroups(
+		t, goconsume.AppendTo(&result.LightGroups)); err != nil {
+		return err
+	}
+	if err := store.DescriptionOverrides(
+		t, goconsume.AppendTo(&result.DescriptionOverrides)); err != nil {
+		return err
+	}
+	if err := store.ScheduleProfiles(
+		t, goconsume.AppendTo(&result.ScheduleProfiles)); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&result)
+}
+
+// Import adds everything in r, which Export wrote, to store. The added
+// rows get new ids. Import updates the ids in imported rows that refer
+// to other imported rows so that they refer to the new ids. This
+// includes the hue task ids of tasks and description overrides, the
+// named colors ids of scene components, and the scheduled task ids of
+// schedule profiles. Import activates the imported schedule profile
+// that was active when exported. Import also reads what Export wrote
+// before it included anything besides named colors and tasks.
+func Import(t db.Transaction, r io.Reader, store ImportStore) error {
+	var database exportedDatabase
+	if err := json.NewDecoder(r).Decode(&database); err != nil {
+		return err
+	}
+	if database.Version < 1 || database.Version > kExportVersion {
+		return ErrBadExport
+	}
+	batch := make([]*ops.NamedColors, len(database.NamedColors))
+	oldHueTaskIds := make([]int, len(database.NamedColors))
+	for i := range database.NamedColors {
+		namedColors, err := database.NamedColors[i].asNamedColors()
+		if err != nil {
+			return err
+		}
+		batch[i] = namedColors
+		oldHueTaskIds[i] = batch[i].AsHueTask().Id
+	}
+	if err := store.AddNamedColorsBatch(t, batch); err != nil {
+		return err
+	}
+	newHueTaskIds := make(map[int]int, len(batch))
+	newNamedColorsIds := make(map[int64]int64, len(batch))
+	for i, namedColors := range batch {
+		newHueTaskIds[oldHueTaskIds[i]] = namedColors.AsHueTask().Id
+		newNamedColorsIds[database.NamedColors[i].Id] = namedColors.Id
+	}
+	for i := range database.AtTimeTasks {
+		task := &database.AtTimeTasks[i]
+		task.HueTaskId = remapHueTaskId(newHueTaskIds, task.HueTaskId)
+		if err := store.AddEncodedAtTimeTask(t, task); err != nil {
+			return err
+		}
+	}
+	newScheduledTaskIds := make(
+		map[int64]int64, len(database.ScheduledTasks))
+	for i := range database.ScheduledTasks {
+		task := &database.ScheduledTasks[i]
+		oldId := task.Id
+		task.HueTaskId = remapHueTaskId(newHueTaskIds, task.HueTaskId)
+		if err := store.AddEncodedScheduledTask(t, task); err != nil {
+			return err
+		}
+		newScheduledTaskIds[oldId] = task.Id
+	}
+	for i := range database.SceneComponents {
+		component := &database.SceneComponents[i]
+		component.NamedColorsId = remapId(
+			newNamedColorsIds, component.NamedColorsId)
+		component.ComponentId = remapId(
+			newNamedColorsIds, component.ComponentId)
+		if err := store.AddSceneComponent(t, component); err != nil {
+			return err
+		}
+	}
+	for i := range database.LightAliases {
+		if err := store.AddLightAlias(t, &database.LightAliases[i]); err != nil {
+			return err
+		}
+	}
+	for i := range database.LightGroups {
+		if err := store.AddLightGroup(t, &database.LightGroups[i]); err != nil {
+			return err
+		}
+	}
+	for i := range database.DescriptionOverrides {
+		override := &database.DescriptionOverrides[i]
+		override.HueTaskId = remapHueTaskId(newHueTaskIds, override.HueTaskId)
+		if err := store.SetDescriptionOverride(t, override); err != nil {
+			return err
+		}
+	}
+	for i := range database.ScheduleProfiles {
+		profile := &database.ScheduleProfiles[i]
+		for j, id := range profile.ScheduledTaskIds {
+			profile.ScheduledTaskIds[j] = remapId(newScheduledTaskIds, id)
+		}
+		// AddScheduleProfile clears Active.
+		active := profile.Active
+		if err := store.AddScheduleProfile(t, profile); err != nil {
+			return err
+		}
+		if active {
+			if err := store.ActivateScheduleProfile(t, profile.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func remapHueTaskId(newHueTaskIds map[int]int, hueTaskId int) int {
+	if newId, ok := newHueTaskIds[hueTaskId]; ok {
+		return newId
+	}
+	return hueTaskId
+}
+
+func remapId(newIds map[int64]int64, id int64) int64 {
+	if newId, ok := newIds[id]; ok {
+		return newId
+	}
+	return id
+}
+
+type exportedDatabase struct {
+	Version              int
+	NamedColors          []exportedNamedColors
+	AtTimeTasks          []EncodedAtTimeTask
+	ScheduledTasks       []EncodedScheduledTask
+	SceneComponents      []SceneComponent
+	LightAliases         []LightAlias
+	LightGroups          []LightGroup
+	DescriptionOverrides []DescriptionOverride
+	ScheduleProfiles     []ScheduleProfile
+}
+
+type exportedNamedColors struct {
+	Id          int64
+	Description string
+	Colors      map[int]jsonColorBrightness
+}
+
+func asExportedNamedColors(
+	namedColors *ops.NamedColors) exportedNamedColors {
+	colors := make(map[int]jsonColorBrightness, len(namedColors.Colors))
+	for lightId, colorBrightness := range namedColors.Colors {
+		colors[lightId] = asJSONColorBrightness(colorBrightness)
+	}
+	return exportedNamedColors{
+		Id:          namedColors.Id,
+		Description: namedColors.Description,
+		Colors:      colors,
+	}
+}
+
+func (e *exportedNamedColors) asNamedColors() (*ops.NamedColors, error) {
+	colors := make(ops.LightColors, len(e.Colors))
+	for lightId, exported := range e.Colors {
+		colorBrightness, err := exported.asColorBrightness()
+		if err != nil {
+			return nil, err
+		}
+		colors[lightId] = colorBrightness
+	}
+	return &ops.NamedColors{
+		Id:          e.Id,
+		Description: e.Description,
+		Colors:      colors,
+	}, nil
+}
@@ -0,0 +1,183 @@
+package huedb_test
+
+import (
+	"bytes"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/ops"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	source := in_memory.New()
+	first := ops.NamedColors{Colors: kColorMap1, Description: "Foo"}
+	second := ops.NamedColors{Colors: kColorMap2, Description: "Bar"}
+	addNamedColors(t, source, &first, &second)
+	atTimeTask := huedb.EncodedAtTimeTask{
+		GroupId:    "default",
+		ScheduleId: "abc",
+		HueTaskId:  second.AsHueTask().Id,
+		Time:       1500000000,
+	}
+	if err := source.AddEncodedAtTimeTask(nil, &atTimeTask); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	scheduledTask := huedb.EncodedScheduledTask{
+		HueTaskId: 31, Action: "162", Enabled: true}
+	if err := source.AddEncodedScheduledTask(nil, &scheduledTask); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	component := huedb.SceneComponent{
+		NamedColorsId: second.Id, ComponentId: first.Id, LightSet: "1"}
+	if err := source.AddSceneComponent(nil, &component); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	alias := huedb.LightAlias{LightId: 2, Name: "Lamp"}
+	if err := source.AddLightAlias(nil, &alias); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	group := huedb.LightGroup{Name: "Den", LightSet: "1,2"}
+	if err := source.AddLightGroup(nil, &group); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	override := huedb.DescriptionOverride{
+		HueTaskId: first.AsHueTask().Id, Description: "Fooey"}
+	if err := source.SetDescriptionOverride(nil, &override); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	profile := huedb.ScheduleProfile{
+		Name: "Weekday", ScheduledTaskIds: []int64{scheduledTask.Id}}
+	if err := source.AddScheduleProfile(nil, &profile); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	if err := source.ActivateScheduleProfile(nil, profile.Id); err != nil {
+		t.Fatalf("Got error activating: %v", err)
+	}
+	var buffer bytes.Buffer
+	if err := huedb.Export(nil, &buffer, source, "default"); err != nil {
+		t.Fatalf("Got error exporting: %v", err)
+	}
+
+	// Destination already has a named color and a scheduled task so
+	// imported ids change.
+	dest := in_memory.New()
+	existing := ops.NamedColors{Colors: kColorMap2, Description: "Baz"}
+	addNamedColors(t, dest, &existing)
+	existingTask := huedb.EncodedScheduledTask{HueTaskId: 32, Action: "7"}
+	if err := dest.AddEncodedScheduledTask(nil, &existingTask); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	if err := huedb.Import(nil, &buffer, dest); err != nil {
+		t.Fatalf("Got error importing: %v", err)
+	}
+	var namedColors []*ops.NamedColors
+	if err := dest.NamedColors(
+		nil, goconsume.AppendPtrsTo(&namedColors)); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	first.Id = 2
+	second.Id = 3
+	expectedColors := []*ops.NamedColors{&existing, &first, &second}
+	if !reflect.DeepEqual(expectedColors, namedColors) {
+		t.Errorf("Expected %v, got %v", expectedColors, namedColors)
+	}
+	atTimeTasks := encodedTasks(t, dest, "default")
+	if len(atTimeTasks) != 1 {
+		t.Fatalf("Expected 1 at time task, got %d", len(atTimeTasks))
+	}
+	if out := atTimeTasks[0].HueTaskId; out != second.AsHueTask().Id {
+		t.Errorf("Expected %d, got %d", second.AsHueTask().Id, out)
+	}
+	var scheduledTasks []*huedb.EncodedScheduledTask
+	if err := dest.EncodedScheduledTasks(
+		nil, goconsume.AppendPtrsTo(&scheduledTasks)); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	scheduledTask.Id = 2
+	expectedScheduled := []*huedb.EncodedScheduledTask{
+		&existingTask, &scheduledTask}
+	if !reflect.DeepEqual(expectedScheduled, scheduledTasks) {
+		t.Errorf("Expected %v, got %v", expectedScheduled, scheduledTasks)
+	}
+	var components []huedb.SceneComponent
+	if err := dest.SceneComponents(
+		nil, second.Id, goconsume.AppendTo(&components)); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if len(components) != 1 || components[0].ComponentId != first.Id || components[0].LightSet != "1" {
+		t.Errorf("Expected component of %d, got %v", first.Id, components)
+	}
+	var aliases []huedb.LightAlias
+	if err := dest.LightAliases(
+		nil, goconsume.AppendTo(&aliases)); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if len(aliases) != 1 || aliases[0].Name != "Lamp" || aliases[0].LightId != 2 {
+		t.Errorf("Expected Lamp alias, got %v", aliases)
+	}
+	var groups []huedb.LightGroup
+	if err := dest.LightGroups(nil, goconsume.AppendTo(&groups)); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Name != "Den" || groups[0].LightSet != "1,2" {
+		t.Errorf("Expected Den group, got %v", groups)
+	}
+	descriptions, err := huedb.ReadDescriptionMap(nil, dest)
+	if err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	expectedDescriptions := huedb.DescriptionMap{
+		first.AsHueTask().Id: "Fooey"}
+	if !reflect.DeepEqual(expectedDescriptions, descriptions) {
+		t.Errorf("Expected %v, got %v", expectedDescriptions, descriptions)
+	}
+	active, err := huedb.ActiveScheduleProfile(nil, dest)
+	if err != nil {
+		t.Fatalf("Got error reading active profile: %v", err)
+	}
+	if active.Name != "Weekday" || !reflect.DeepEqual(
+		[]int64{scheduledTask.Id}, active.ScheduledTaskIds) {
+		t.Errorf("Expected Weekday with %d, got %v", scheduledTask.Id, active)
+	}
+}
+
+func TestImportVersion1(t *testing.T) {
+	dest := in_memory.New()
+	if err := huedb.Import(
+		nil,
+		strings.NewReader(`{"Version": 1, "NamedColors": [{"Id": 5, "Description": "Foo"}]}`),
+		dest); err != nil {
+		t.Fatalf("Got error importing: %v", err)
+	}
+	var namedColors []*ops.NamedColors
+	if err := dest.NamedColors(
+		nil, goconsume.AppendPtrsTo(&namedColors)); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if len(namedColors) != 1 || namedColors[0].Description != "Foo" {
+		t.Errorf("Expected Foo, got %v", namedColors)
+	}
+}
+
+func TestImportBadVersion(t *testing.T) {
+	if err := huedb.Import(
+		nil,
+		strings.NewReader(`{"Version": 99}`),
+		in_memory.New()); err != huedb.ErrBadExport {
+		t.Errorf("Expected ErrBadExport, got %v", err)
+	}
+}
+
+func addNamedColors(
+	t *testing.T,
+	store huedb.AddNamedColorsRunner,
+	namedColors ...*ops.NamedColors) {
+	for _, nc := range namedColors {
+		if err := store.AddNamedColors(nil, nc); err != nil {
+			t.Fatalf("Got error adding: %v", err)
+		}
+	}
+}
@@ -3,29 +3,39 @@
 package fixture
 
 import (
+	"context"
+	"github.com/keep94/appcommon/db"
 	"github.com/keep94/goconsume"
 	"github.com/keep94/gohue"
 	"github.com/keep94/marvin/huedb"
 	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/weather"
 	"github.com/keep94/maybe"
+	"math"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var (
 	kFirstNamedColor = &ops.NamedColors{
 		Description: "Foo",
 		Colors: ops.LightColors{
-			3: {gohue.NewMaybeColor(gohue.NewColor(0.5, 0.3)), maybe.NewUint8(98)},
-			5: {gohue.NewMaybeColor(gohue.NewColor(0.6, 0.4)), maybe.NewUint8(0)},
+			3: {Color: gohue.NewMaybeColor(gohue.NewColor(0.5, 0.3)),
+				Brightness: maybe.NewUint8(98)},
+			5: {Color: gohue.NewMaybeColor(gohue.NewColor(0.6, 0.4)),
+				Brightness: maybe.NewUint8(0)},
 
-			6: {gohue.MaybeColor{}, maybe.Uint8{}}},
+			6: {Color: gohue.MaybeColor{}, Brightness: maybe.Uint8{}}},
 	}
 	kSecondNamedColor = &ops.NamedColors{
 		Description: "Bar",
 		Colors: ops.LightColors{
-			2: {gohue.NewMaybeColor(gohue.NewColor(0.22, 0.39)), maybe.NewUint8(255)},
-			7: {gohue.NewMaybeColor(gohue.NewColor(0.58, 0.41)), maybe.NewUint8(35)},
+			2: {Color: gohue.NewMaybeColor(gohue.NewColor(0.22, 0.39)),
+				Brightness: maybe.NewUint8(255)},
+			7: {Color: gohue.NewMaybeColor(gohue.NewColor(0.58, 0.41)),
+				Brightness: maybe.NewUint8(35)},
 		},
 	}
 )
@@ -40,6 +50,54 @@ type NamedColorsStore interface {
 	huedb.NamedColorsRunner
 }
 
+type NamedColorsBatchStore interface {
+	huedb.AddNamedColorsBatchRunner
+	huedb.NamedColorsRunner
+}
+
+type NamedColorsByIdsStore interface {
+	MinimalStore
+	huedb.NamedColorsByIdsRunner
+}
+
+type SceneComponentStore interface {
+	huedb.SceneComponentsRunner
+	huedb.AddSceneComponentRunner
+	huedb.RemoveSceneComponentRunner
+}
+
+type WeatherSettingsStore interface {
+	huedb.WeatherSettingsRunner
+	huedb.AddWeatherSettingsRunner
+	huedb.UpdateWeatherSettingsRunner
+	huedb.RemoveWeatherSettingsRunner
+}
+
+type LastLightColorsStore interface {
+	huedb.LastLightColorsRunner
+	huedb.SetLastLightColorsRunner
+}
+
+type ClearAtTimeTaskStore interface {
+	huedb.EncodedAtTimeTaskStore
+	ClearEncodedAtTimeTasks(t db.Transaction) error
+}
+
+type ArchiveAtTimeTaskStore interface {
+	huedb.EncodedAtTimeTaskStore
+	huedb.ArchiveEncodedAtTimeTaskRunner
+	huedb.ArchivedAtTimeTasksRunner
+}
+
+type SearchStore interface {
+	MinimalStore
+	huedb.UpdateNamedColorsRunner
+	huedb.RemoveNamedColorsRunner
+	huedb.AddEncodedScheduledTaskRunner
+	huedb.EncodedAtTimeTaskStore
+	huedb.SearchRunner
+}
+
 type UpdateNamedColorsStore interface {
 	MinimalStore
 	huedb.UpdateNamedColorsRunner
@@ -50,6 +108,61 @@ type RemoveNamedColorsStore interface {
 	huedb.RemoveNamedColorsRunner
 }
 
+type UserStore interface {
+	huedb.UserByIdRunner
+	huedb.UserByNameRunner
+	huedb.UsersRunner
+	huedb.AddUserRunner
+	huedb.UpdateUserRunner
+	huedb.RemoveUserRunner
+}
+
+type ScheduledTaskStore interface {
+	huedb.EncodedScheduledTaskByIdRunner
+	huedb.EncodedScheduledTasksRunner
+	huedb.AddEncodedScheduledTaskRunner
+	huedb.UpdateEncodedScheduledTaskRunner
+	huedb.RemoveEncodedScheduledTaskRunner
+}
+
+type NamedColorsPageStore interface {
+	MinimalStore
+	huedb.NamedColorsPageRunner
+	huedb.NamedColorsCountRunner
+}
+
+type NamedColorsOrderedStore interface {
+	MinimalStore
+	huedb.UpdateNamedColorsRunner
+	huedb.NamedColorsOrderedRunner
+}
+
+type NamedColorsByDescriptionStore interface {
+	MinimalStore
+	huedb.NamedColorsByDescriptionRunner
+}
+
+type ContextStore interface {
+	NamedColorsStore
+	huedb.ContextRunner
+}
+
+type BackupStore interface {
+	NamedColorsStore
+	huedb.PreferencesStore
+	huedb.BackupRunner
+	huedb.RestoreRunner
+}
+
+type NamedColorsHistoryStore interface {
+	MinimalStore
+	huedb.UpdateNamedColorsRunner
+	huedb.RemoveNamedColorsRunner
+	huedb.NamedColorsHistoryRunner
+	huedb.DeletedNamedColorsRunner
+	huedb.RestoreNamedColorsRunner
+}
+
 func NamedColorsById(t *testing.T, store MinimalStore) {
 	var first, second, firstResult, secondResult ops.NamedColors
 	createNamedColors(t, store, &first, &second)
@@ -77,12 +190,60 @@ func NamedColors(t *testing.T, store NamedColorsStore) {
 	assertNCEqual(t, &second, &results[1])
 }
 
+func AddNamedColorsBatch(t *testing.T, store NamedColorsBatchStore) {
+	first := *kFirstNamedColor
+	second := *kSecondNamedColor
+	if err := store.AddNamedColorsBatch(
+		nil, []*ops.NamedColors{&first, &second}); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	if first.Id == 0 || second.Id <= first.Id {
+		t.Errorf("Expected ascending ids, got %d and %d", first.Id, second.Id)
+	}
+	var results []ops.NamedColors
+	if err := store.NamedColors(nil, goconsume.AppendTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if out := len(results); out != 2 {
+		t.Fatalf("Expected array of size 2, got %d", out)
+	}
+	assertNCEqual(t, &first, &results[0])
+	assertNCEqual(t, &second, &results[1])
+}
+
+func NamedColorsByIds(t *testing.T, store NamedColorsByIdsStore) {
+	var first, second, third ops.NamedColors
+	createNamedColors(t, store, &first, &second)
+	createNamedColor(t, store, kFirstNamedColor, &third)
+	var results []ops.NamedColors
+	if err := store.NamedColorsByIds(
+		nil,
+		[]int64{third.Id, first.Id, 9999, third.Id},
+		goconsume.AppendTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if out := len(results); out != 2 {
+		t.Fatalf("Expected array of size 2, got %d", out)
+	}
+	assertNCEqual(t, &first, &results[0])
+	assertNCEqual(t, &third, &results[1])
+	results = nil
+	if err := store.NamedColorsByIds(
+		nil, nil, goconsume.AppendTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if out := len(results); out != 0 {
+		t.Errorf("Expected no results, got %d", out)
+	}
+}
+
 func UpdateNamedColors(t *testing.T, store UpdateNamedColorsStore) {
 	var first, second, firstResult, secondResult ops.NamedColors
 	createNamedColors(t, store, &first, &second)
 	second.Description = "Green"
 	second.Colors = ops.LightColors{
-		14: {gohue.NewMaybeColor(gohue.NewColor(0.6, 0.57)), maybe.NewUint8(17)}}
+		14: {Color: gohue.NewMaybeColor(gohue.NewColor(0.6, 0.57)),
+			Brightness: maybe.NewUint8(17)}}
 	if err := store.UpdateNamedColors(nil, &second); err != nil {
 		t.Errorf("Got error updating database: %v", err)
 	}
@@ -107,12 +268,14 @@ func UpdateNamedColors(t *testing.T, store UpdateNamedColorsStore) {
 
 	// Invalid colors
 	second.Colors = ops.LightColors{
-		-1: {gohue.NewMaybeColor(gohue.NewColor(0.29, 0.29)), maybe.NewUint8(99)}}
+		-1: {Color: gohue.NewMaybeColor(gohue.NewColor(0.29, 0.29)),
+			Brightness: maybe.NewUint8(99)}}
 	if err := store.UpdateNamedColors(nil, &second); err == nil {
 		t.Error("Expected to get an error because of invalid light Id")
 	}
 	second.Colors = ops.LightColors{
-		35: {gohue.NewMaybeColor(gohue.NewColor(1.29, 0.27)), maybe.NewUint8(101)}}
+		35: {Color: gohue.NewMaybeColor(gohue.NewColor(1.29, 0.27)),
+			Brightness: maybe.NewUint8(101)}}
 	if err := store.UpdateNamedColors(nil, &second); err == nil {
 		t.Error("Expected to get an error because of invalid color")
 	}
@@ -135,6 +298,808 @@ func RemoveNamedColors(t *testing.T, store RemoveNamedColorsStore) {
 	assertNCEqual(t, &second, &secondResult)
 }
 
+func NamedColorsPage(t *testing.T, store NamedColorsPageStore) {
+	if count, err := store.NamedColorsCount(nil); err != nil || count != 0 {
+		t.Errorf("Expected 0, nil, got %d, %v", count, err)
+	}
+	var first, second, third ops.NamedColors
+	createNamedColors(t, store, &first, &second)
+	createNamedColor(t, store, kFirstNamedColor, &third)
+	if count, err := store.NamedColorsCount(nil); err != nil || count != 3 {
+		t.Errorf("Expected 3, nil, got %d, %v", count, err)
+	}
+	assertNamedColorsPage(t, store, 0, 2, &first, &second)
+	assertNamedColorsPage(t, store, 2, 2, &third)
+	assertNamedColorsPage(t, store, 1, 1, &second)
+	assertNamedColorsPage(t, store, 3, 2)
+}
+
+func NamedColorsOrdered(t *testing.T, store NamedColorsOrderedStore) {
+	var first, second, third ops.NamedColors
+	createNamedColors(t, store, &first, &second)
+	createNamedColor(
+		t, store, &ops.NamedColors{Description: "apple"}, &third)
+	firstV2 := first
+	firstV2.Description = "Zoo"
+	if err := store.UpdateNamedColors(nil, &firstV2); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	secondV2 := second
+	secondV2.Description = "bar"
+	if err := store.UpdateNamedColors(nil, &secondV2); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	assertNamedColorsOrdered(
+		t, store, huedb.NamedColorsOrder{}, &firstV2, &secondV2, &third)
+	assertNamedColorsOrdered(
+		t,
+		store,
+		huedb.NamedColorsOrder{Descending: true},
+		&third, &secondV2, &firstV2)
+	assertNamedColorsOrdered(
+		t,
+		store,
+		huedb.NamedColorsOrder{By: huedb.OrderByDescription},
+		&third, &secondV2, &firstV2)
+	assertNamedColorsOrdered(
+		t,
+		store,
+		huedb.NamedColorsOrder{
+			By: huedb.OrderByDescription, Descending: true},
+		&firstV2, &secondV2, &third)
+	assertNamedColorsOrdered(
+		t,
+		store,
+		huedb.NamedColorsOrder{By: huedb.OrderByUpdatedAt},
+		&third, &firstV2, &secondV2)
+	assertNamedColorsOrdered(
+		t,
+		store,
+		huedb.NamedColorsOrder{By: huedb.OrderByUpdatedAt, Descending: true},
+		&secondV2, &firstV2, &third)
+}
+
+func NamedColorsByDescription(
+	t *testing.T, store NamedColorsByDescriptionStore) {
+	var first, second, third ops.NamedColors
+	createNamedColors(t, store, &first, &second)
+	createNamedColor(
+		t, store, &ops.NamedColors{Description: "100% bar"}, &third)
+	assertNamedColorsByDescription(t, store, "fo", &first)
+	assertNamedColorsByDescription(t, store, "BAR", &second, &third)
+	assertNamedColorsByDescription(t, store, "%", &third)
+	assertNamedColorsByDescription(t, store, "_")
+	assertNamedColorsByDescription(t, store, "", &first, &second, &third)
+}
+
+func NamedColorsHistory(t *testing.T, store NamedColorsHistoryStore) {
+	var first, second ops.NamedColors
+	createNamedColors(t, store, &first, &second)
+	firstV2 := first
+	firstV2.Description = "Foo v2"
+	if err := store.UpdateNamedColors(nil, &firstV2); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	if err := store.RemoveNamedColors(nil, second.Id); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	history := namedColorsHistory(t, store, first.Id)
+	assertRevisions(t, history, false, &first)
+	deleted := deletedNamedColors(t, store)
+	assertRevisions(t, deleted, true, &second)
+
+	if err := store.RestoreNamedColors(nil, deleted[0].Id); err != nil {
+		t.Errorf("Got error restoring: %v", err)
+	}
+	var result ops.NamedColors
+	if err := store.NamedColorsById(nil, second.Id, &result); err != nil {
+		t.Errorf("Got error reading database by id: %v", err)
+	}
+	assertNCEqual(t, &second, &result)
+	assertRevisions(t, deletedNamedColors(t, store), true)
+
+	if err := store.RestoreNamedColors(nil, history[0].Id); err != nil {
+		t.Errorf("Got error restoring: %v", err)
+	}
+	if err := store.NamedColorsById(nil, first.Id, &result); err != nil {
+		t.Errorf("Got error reading database by id: %v", err)
+	}
+	assertNCEqual(t, &first, &result)
+	history = namedColorsHistory(t, store, first.Id)
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 revisions, got %d", len(history))
+	}
+	assertNCEqual(t, &firstV2, &history[0].NamedColors)
+	if err := store.RestoreNamedColors(nil, 9999); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+}
+
+func ScheduledTasks(t *testing.T, store ScheduledTaskStore) {
+	first := huedb.EncodedScheduledTask{
+		HueTaskId:    3,
+		Action:       "Color=Red",
+		Description:  "Evening",
+		LightSet:     "1,2",
+		Recurrence:   "1760304600:86400:0",
+		Enabled:      true,
+		HighPriority: false,
+	}
+	second := huedb.EncodedScheduledTask{
+		HueTaskId:    10002,
+		Description:  "Morning",
+		HighPriority: true,
+	}
+	if err := store.AddEncodedScheduledTask(nil, &first); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	if err := store.AddEncodedScheduledTask(nil, &second); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	if first.Id == 0 || second.Id == 0 {
+		t.Error("Expected Id to be set.")
+	}
+	var firstResult huedb.EncodedScheduledTask
+	if err := store.EncodedScheduledTaskById(
+		nil, first.Id, &firstResult); err != nil {
+		t.Errorf("Got error reading database by id: %v", err)
+	}
+	assertSTEqual(t, &first, &firstResult)
+	second.Enabled = true
+	second.Recurrence = "1760333400:86400:62"
+	if err := store.UpdateEncodedScheduledTask(nil, &second); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	var results []*huedb.EncodedScheduledTask
+	if err := store.EncodedScheduledTasks(
+		nil, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	expected := []*huedb.EncodedScheduledTask{&first, &second}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+	if err := store.RemoveEncodedScheduledTask(nil, first.Id); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	if err := store.EncodedScheduledTaskById(
+		nil, first.Id, &firstResult); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+}
+
+func EncodedAtTimeTasks(t *testing.T, store huedb.EncodedAtTimeTaskStore) {
+	first := huedb.EncodedAtTimeTask{
+		GroupId:     "default",
+		ScheduleId:  "first",
+		HueTaskId:   7,
+		Action:      "action",
+		Description: "First",
+		LightSet:    "1,2",
+		Time:        1400000000,
+		Recurrence:  "86400:3",
+	}
+	second := huedb.EncodedAtTimeTask{
+		GroupId: "default", ScheduleId: "second", Time: 1400000600}
+	other := huedb.EncodedAtTimeTask{
+		GroupId: "other", ScheduleId: "first", Time: 1400000000}
+	for _, task := range []*huedb.EncodedAtTimeTask{&first, &second, &other} {
+		if err := store.AddEncodedAtTimeTask(nil, task); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	if first.Id == 0 || first.Id == second.Id || first.Id == other.Id {
+		t.Errorf(
+			"Expected distinct ids, got %d %d %d",
+			first.Id, second.Id, other.Id)
+	}
+	assertEncodedAtTimeTasks(t, store, "default", &first, &second)
+	assertEncodedAtTimeTasks(t, store, "other", &other)
+	if err := store.RemoveEncodedAtTimeTaskByScheduleId(
+		nil, "default", "first"); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	assertEncodedAtTimeTasks(t, store, "default", &second)
+	assertEncodedAtTimeTasks(t, store, "other", &other)
+}
+
+func ClearEncodedAtTimeTasks(t *testing.T, store ClearAtTimeTaskStore) {
+	for _, groupId := range []string{"default", "other"} {
+		task := huedb.EncodedAtTimeTask{
+			GroupId: groupId, ScheduleId: "first", Time: 1400000000}
+		if err := store.AddEncodedAtTimeTask(nil, &task); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	if err := store.ClearEncodedAtTimeTasks(nil); err != nil {
+		t.Errorf("Got error clearing database: %v", err)
+	}
+	assertEncodedAtTimeTasks(t, store, "default")
+	assertEncodedAtTimeTasks(t, store, "other")
+}
+
+func RemoveExpired(t *testing.T, store huedb.EncodedAtTimeTaskStore) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	expired := huedb.EncodedAtTimeTask{
+		GroupId: "default", ScheduleId: "expired", Time: now.Unix() - 1}
+	expired2 := huedb.EncodedAtTimeTask{
+		GroupId: "second", ScheduleId: "expired", Time: now.Unix() - 1}
+	current := huedb.EncodedAtTimeTask{
+		GroupId: "default", ScheduleId: "current", Time: now.Unix()}
+	for _, task := range []*huedb.EncodedAtTimeTask{
+		&expired, &expired2, &current} {
+		if err := store.AddEncodedAtTimeTask(nil, task); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	if err := store.RemoveExpired(nil, now); err != nil {
+		t.Errorf("Got error removing expired: %v", err)
+	}
+	assertEncodedAtTimeTasks(t, store, "default", &current)
+	assertEncodedAtTimeTasks(t, store, "second")
+}
+
+func UpdateEncodedAtTimeTaskTime(
+	t *testing.T, store huedb.EncodedAtTimeTaskStore) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	first := huedb.EncodedAtTimeTask{
+		GroupId:    "default",
+		ScheduleId: "abc",
+		Time:       now.Unix(),
+		Recurrence: "86400:6"}
+	second := huedb.EncodedAtTimeTask{
+		GroupId: "second", ScheduleId: "abc", Time: now.Unix()}
+	for _, task := range []*huedb.EncodedAtTimeTask{&first, &second} {
+		if err := store.AddEncodedAtTimeTask(nil, task); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	newTime := now.Add(time.Hour)
+	if err := store.UpdateEncodedAtTimeTaskTime(
+		nil, "default", "abc", "def", newTime); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	first.ScheduleId = "def"
+	first.Time = newTime.Unix()
+	assertEncodedAtTimeTasks(t, store, "default", &first)
+	assertEncodedAtTimeTasks(t, store, "second", &second)
+}
+
+func ArchiveEncodedAtTimeTask(t *testing.T, store ArchiveAtTimeTaskStore) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	first := huedb.EncodedAtTimeTask{
+		GroupId:     "default",
+		ScheduleId:  "first",
+		HueTaskId:   7,
+		Action:      "act",
+		Description: "First",
+		LightSet:    "1,2",
+		Time:        now.Unix(),
+		Recurrence:  "86400:6"}
+	second := huedb.EncodedAtTimeTask{
+		GroupId: "default", ScheduleId: "second", Time: now.Unix()}
+	third := huedb.EncodedAtTimeTask{
+		GroupId: "default", ScheduleId: "third", Time: now.Unix()}
+	other := huedb.EncodedAtTimeTask{
+		GroupId: "other", ScheduleId: "first", Time: now.Unix()}
+	for _, task := range []*huedb.EncodedAtTimeTask{
+		&first, &second, &third, &other} {
+		if err := store.AddEncodedAtTimeTask(nil, task); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	if err := store.ArchiveEncodedAtTimeTask(
+		nil, "default", "first", huedb.AtTimeTaskRan, now); err != nil {
+		t.Errorf("Got error archiving: %v", err)
+	}
+	later := now.Add(time.Minute)
+	if err := store.ArchiveEncodedAtTimeTask(
+		nil, "default", "second", huedb.AtTimeTaskCancelled, later); err != nil {
+		t.Errorf("Got error archiving: %v", err)
+	}
+	// Archiving a task that doesn't exist does nothing
+	if err := store.ArchiveEncodedAtTimeTask(
+		nil, "default", "none", huedb.AtTimeTaskRan, later); err != nil {
+		t.Errorf("Got error archiving: %v", err)
+	}
+	assertEncodedAtTimeTasks(t, store, "default", &third)
+	assertEncodedAtTimeTasks(t, store, "other", &other)
+	assertArchivedAtTimeTasks(
+		t,
+		store,
+		"default",
+		&huedb.ArchivedAtTimeTask{
+			EncodedAtTimeTask: second,
+			Status:            huedb.AtTimeTaskCancelled,
+			CompletedAt:       later},
+		&huedb.ArchivedAtTimeTask{
+			EncodedAtTimeTask: first,
+			Status:            huedb.AtTimeTaskRan,
+			CompletedAt:       now})
+	assertArchivedAtTimeTasks(t, store, "other")
+}
+
+func Users(t *testing.T, store UserStore) {
+	first := huedb.User{Name: "jill", Password: "abc", Role: huedb.Admin}
+	second := huedb.User{Name: "bob", Password: "def", Role: huedb.Guest}
+	for _, user := range []*huedb.User{&first, &second} {
+		if err := store.AddUser(nil, user); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+		if user.Id == 0 {
+			t.Error("Expected Id to be set.")
+		}
+	}
+	duplicate := huedb.User{Name: "jill"}
+	if err := store.AddUser(nil, &duplicate); err == nil {
+		t.Error("Expected error adding duplicate user name.")
+	}
+	var result huedb.User
+	if err := store.UserById(nil, first.Id, &result); err != nil {
+		t.Errorf("Got error reading database by id: %v", err)
+	}
+	assertUserEqual(t, &first, &result)
+	if err := store.UserByName(nil, "bob", &result); err != nil {
+		t.Errorf("Got error reading database by name: %v", err)
+	}
+	assertUserEqual(t, &second, &result)
+	if err := store.UserByName(
+		nil, "nobody", &result); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+	second.Role = huedb.Admin
+	second.Password = "ghi"
+	if err := store.UpdateUser(nil, &second); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	var results []*huedb.User
+	if err := store.Users(nil, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	expected := []*huedb.User{&second, &first}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+	if err := store.RemoveUser(nil, first.Id); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	if err := store.UserById(nil, first.Id, &result); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+}
+
+func LightAliases(t *testing.T, store huedb.LightAliasStore) {
+	kitchen := huedb.LightAlias{LightId: 3, Name: "kitchen"}
+	den := huedb.LightAlias{LightId: 1, Name: "den"}
+	for _, alias := range []*huedb.LightAlias{&kitchen, &den} {
+		if err := store.AddLightAlias(nil, alias); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	if err := store.AddLightAlias(
+		nil, &huedb.LightAlias{LightId: 2, Name: "den"}); err == nil {
+		t.Error("Expected error adding duplicate alias name.")
+	}
+	upstairs := huedb.LightGroup{Name: "upstairs", LightSet: "1,2"}
+	downstairs := huedb.LightGroup{Name: "downstairs", LightSet: "3"}
+	for _, group := range []*huedb.LightGroup{&upstairs, &downstairs} {
+		if err := store.AddLightGroup(nil, group); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	den.LightId = 2
+	if err := store.UpdateLightAlias(nil, &den); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	downstairs.LightSet = "3,4"
+	if err := store.UpdateLightGroup(nil, &downstairs); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	assertLightAliases(t, store, &den, &kitchen)
+	assertLightGroups(t, store, &downstairs, &upstairs)
+	if err := store.RemoveLightAlias(nil, den.Id); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	if err := store.RemoveLightGroup(nil, upstairs.Id); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	assertLightAliases(t, store, &kitchen)
+	assertLightGroups(t, store, &downstairs)
+}
+
+func Preferences(t *testing.T, store huedb.PreferencesStore) {
+	theme := huedb.Preference{UserId: 1, Key: "theme", Value: `"dark"`}
+	favorites := huedb.Preference{UserId: 1, Key: "favorites", Value: "[3,1]"}
+	other := huedb.Preference{UserId: 2, Key: "theme", Value: `"light"`}
+	for _, pref := range []*huedb.Preference{&theme, &favorites, &other} {
+		if err := store.SetPreference(nil, pref); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	theme.Value = `"solarized"`
+	if err := store.SetPreference(nil, &theme); err != nil {
+		t.Errorf("Got error replacing preference: %v", err)
+	}
+	var result huedb.Preference
+	if err := store.Preference(nil, 1, "theme", &result); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(&theme, &result) {
+		t.Errorf("Expected %v, got %v", &theme, &result)
+	}
+	var results []*huedb.Preference
+	if err := store.Preferences(
+		nil, 1, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	expected := []*huedb.Preference{&favorites, &theme}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+	if err := store.RemovePreference(nil, 1, "theme"); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	if err := store.Preference(
+		nil, 1, "theme", &result); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+	if err := store.Preference(nil, 2, "theme", &result); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(&other, &result) {
+		t.Errorf("Expected %v, got %v", &other, &result)
+	}
+}
+
+func SceneComponents(t *testing.T, store SceneComponentStore) {
+	first := huedb.SceneComponent{NamedColorsId: 1, ComponentId: 2}
+	other := huedb.SceneComponent{NamedColorsId: 2, ComponentId: 3}
+	second := huedb.SceneComponent{
+		NamedColorsId: 1, ComponentId: 3, LightSet: "1,2", LightOffset: 4}
+	for _, c := range []*huedb.SceneComponent{&first, &other, &second} {
+		if err := store.AddSceneComponent(nil, c); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	assertSceneComponents(t, store, 1, &first, &second)
+	if err := store.RemoveSceneComponent(nil, first.Id); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	assertSceneComponents(t, store, 1, &second)
+	assertSceneComponents(t, store, 2, &other)
+}
+
+func WeatherSettings(t *testing.T, store WeatherSettingsStore) {
+	noaa := huedb.WeatherSettings{
+		Provider:     huedb.NOAAProvider,
+		StationId:    "KNUQ",
+		PollInterval: 15 * time.Minute,
+		Units:        huedb.Fahrenheit,
+	}
+	purpleAir := huedb.WeatherSettings{
+		Provider:     huedb.PurpleAirProvider,
+		StationId:    "12345",
+		PollInterval: time.Hour,
+	}
+	for _, s := range []*huedb.WeatherSettings{&noaa, &purpleAir} {
+		if err := store.AddWeatherSettings(nil, s); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	noaa.StationId = "KSFO"
+	noaa.PollInterval = 5 * time.Minute
+	if err := store.UpdateWeatherSettings(nil, &noaa); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	assertWeatherSettings(t, store, &noaa, &purpleAir)
+	if err := store.RemoveWeatherSettings(nil, noaa.Id); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	assertWeatherSettings(t, store, &purpleAir)
+}
+
+func Bridges(t *testing.T, store huedb.BridgeStore) {
+	upstairs := huedb.Bridge{
+		Name: "upstairs", Host: "192.168.1.20", User: "abcdef"}
+	downstairs := huedb.Bridge{
+		Name: "downstairs", Host: "hue-downstairs.local", User: "ghijkl"}
+	for _, b := range []*huedb.Bridge{&upstairs, &downstairs} {
+		if err := store.AddBridge(nil, b); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	if err := store.AddBridge(
+		nil, &huedb.Bridge{Name: "upstairs"}); err == nil {
+		t.Error("Expected error adding duplicate bridge name")
+	}
+	upstairs.Host = "192.168.1.21"
+	if err := store.UpdateBridge(nil, &upstairs); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	var bridge huedb.Bridge
+	if err := store.BridgeById(nil, upstairs.Id, &bridge); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if bridge != upstairs {
+		t.Errorf("Expected %v, got %v", upstairs, bridge)
+	}
+	assertBridges(t, store, &downstairs, &upstairs)
+	if err := store.RemoveBridge(nil, downstairs.Id); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	if err := store.BridgeById(
+		nil, downstairs.Id, &bridge); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+	assertBridges(t, store, &upstairs)
+}
+
+func DescriptionOverrides(
+	t *testing.T, store huedb.DescriptionOverrideStore) {
+	overrides := []*huedb.DescriptionOverride{
+		{HueTaskId: 10005, Description: "Reading"},
+		{HueTaskId: 10002, Description: "Dinner"},
+		{HueTaskId: 10009, Description: "Movie"},
+	}
+	for _, o := range overrides {
+		if err := store.SetDescriptionOverride(nil, o); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	if err := store.SetDescriptionOverride(
+		nil,
+		&huedb.DescriptionOverride{
+			HueTaskId: 10005, Description: "Bright"}); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	if err := store.RemoveDescriptionOverride(nil, 10009); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	descriptionMap, err := huedb.ReadDescriptionMap(nil, store)
+	if err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	expected := huedb.DescriptionMap{10002: "Dinner", 10005: "Bright"}
+	if !reflect.DeepEqual(expected, descriptionMap) {
+		t.Errorf("Expected %v, got %v", expected, descriptionMap)
+	}
+}
+
+func LastLightColors(t *testing.T, store LastLightColorsStore) {
+	assertLastLightColors(t, store, ops.LightColors{})
+	if err := store.SetLastLightColors(
+		nil, kFirstNamedColor.Colors); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	red := ops.ColorBrightness{
+		Color:      gohue.NewMaybeColor(gohue.Red),
+		Brightness: maybe.NewUint8(200)}
+	if err := store.SetLastLightColors(
+		nil, ops.LightColors{5: red, 9: red}); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	assertLastLightColors(t, store, ops.LightColors{
+		3: kFirstNamedColor.Colors[3],
+		5: red,
+		6: kFirstNamedColor.Colors[6],
+		9: red})
+	if err := store.SetLastLightColors(
+		nil, ops.LightColors{0: red}); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	assertLastLightColors(t, store, ops.LightColors{0: red})
+}
+
+func ScheduleProfiles(t *testing.T, store huedb.ScheduleProfileStore) {
+	weekday := huedb.ScheduleProfile{
+		Name: "weekday", ScheduledTaskIds: []int64{7, 3, 7}}
+	vacation := huedb.ScheduleProfile{Name: "vacation", Active: true}
+	for _, p := range []*huedb.ScheduleProfile{&weekday, &vacation} {
+		if err := store.AddScheduleProfile(nil, p); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	if err := store.AddScheduleProfile(
+		nil, &huedb.ScheduleProfile{Name: "weekday"}); err == nil {
+		t.Error("Expected error adding duplicate profile name")
+	}
+	weekday.ScheduledTaskIds = []int64{3, 7}
+	vacation.Active = false
+	assertScheduleProfiles(t, store, &vacation, &weekday)
+	if _, err := huedb.ActiveScheduleProfile(
+		nil, store); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+
+	if err := store.ActivateScheduleProfile(nil, weekday.Id); err != nil {
+		t.Errorf("Got error activating: %v", err)
+	}
+	weekday.Active = true
+	assertScheduleProfiles(t, store, &vacation, &weekday)
+
+	// Updating leaves the active flag alone
+	update := weekday
+	update.ScheduledTaskIds = []int64{4}
+	update.Active = false
+	if err := store.UpdateScheduleProfile(nil, &update); err != nil {
+		t.Errorf("Got error updating database: %v", err)
+	}
+	weekday.ScheduledTaskIds = []int64{4}
+	var profile huedb.ScheduleProfile
+	if err := store.ScheduleProfileById(nil, weekday.Id, &profile); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(weekday, profile) {
+		t.Errorf("Expected %v, got %v", weekday, profile)
+	}
+
+	if err := store.ActivateScheduleProfile(nil, vacation.Id); err != nil {
+		t.Errorf("Got error activating: %v", err)
+	}
+	weekday.Active = false
+	vacation.Active = true
+	assertScheduleProfiles(t, store, &vacation, &weekday)
+	active, err := huedb.ActiveScheduleProfile(nil, store)
+	if err != nil {
+		t.Errorf("Got error reading active profile: %v", err)
+	} else if active.Id != vacation.Id {
+		t.Errorf("Expected %d, got %d", vacation.Id, active.Id)
+	}
+
+	if err := store.RemoveScheduleProfile(nil, vacation.Id); err != nil {
+		t.Errorf("Got error removing from database: %v", err)
+	}
+	if err := store.ScheduleProfileById(
+		nil, vacation.Id, &profile); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+	assertScheduleProfiles(t, store, &weekday)
+}
+
+func Search(t *testing.T, store SearchStore) {
+	var dinner, movie, gone ops.NamedColors
+	createNamedColor(
+		t, store, &ops.NamedColors{Description: "Dinner time"}, &dinner)
+	createNamedColor(
+		t, store, &ops.NamedColors{Description: "Movie night"}, &movie)
+	createNamedColor(
+		t, store, &ops.NamedColors{Description: "Late dinner"}, &gone)
+	if err := store.RemoveNamedColors(nil, gone.Id); err != nil {
+		t.Fatalf("Got error removing: %v", err)
+	}
+	movie.Description = "Movie-Dinner"
+	if err := store.UpdateNamedColors(nil, &movie); err != nil {
+		t.Fatalf("Got error updating: %v", err)
+	}
+	scheduled := huedb.EncodedScheduledTask{Description: "Weekday dinner"}
+	if err := store.AddEncodedScheduledTask(nil, &scheduled); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	timer := huedb.EncodedAtTimeTask{
+		GroupId: "default", ScheduleId: "abc", Description: "Dinner bell"}
+	if err := store.AddEncodedAtTimeTask(nil, &timer); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	assertSearch(
+		t,
+		store,
+		"DIN",
+		&huedb.SearchResult{
+			Kind:        huedb.NamedColorsSearchResult,
+			Id:          dinner.Id,
+			Description: "Dinner time"},
+		&huedb.SearchResult{
+			Kind:        huedb.NamedColorsSearchResult,
+			Id:          movie.Id,
+			Description: "Movie-Dinner"},
+		&huedb.SearchResult{
+			Kind:        huedb.ScheduledTaskSearchResult,
+			Id:          scheduled.Id,
+			Description: "Weekday dinner"},
+		&huedb.SearchResult{
+			Kind:        huedb.AtTimeTaskSearchResult,
+			Id:          timer.Id,
+			Description: "Dinner bell"})
+	assertSearch(
+		t,
+		store,
+		"dinner mov",
+		&huedb.SearchResult{
+			Kind:        huedb.NamedColorsSearchResult,
+			Id:          movie.Id,
+			Description: "Movie-Dinner"})
+
+	// Words must begin a word in the description
+	assertSearch(t, store, "inner")
+	assertSearch(t, store, "late")
+	assertSearch(t, store, "  ")
+}
+
+func SensorEvents(t *testing.T, store huedb.SensorEventStore) {
+	now := time.Date(2015, 6, 1, 2, 13, 0, 0, time.UTC)
+	motion := huedb.SensorEvent{
+		SensorId: 3, Type: huedb.MotionEvent, Value: "true", Time: now}
+	button := huedb.SensorEvent{
+		SensorId: 5,
+		Type:     huedb.ButtonEvent,
+		Value:    "1002",
+		Time:     now.Add(-time.Hour)}
+	noMotion := huedb.SensorEvent{
+		SensorId: 3,
+		Type:     huedb.MotionEvent,
+		Value:    "false",
+		Time:     now.Add(time.Minute)}
+	sameTime := huedb.SensorEvent{
+		SensorId: 5, Type: huedb.ButtonEvent, Value: "4002", Time: now}
+	for _, event := range []*huedb.SensorEvent{
+		&motion, &button, &noMotion, &sameTime} {
+		if err := store.AddSensorEvent(nil, event); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	assertSensorEvents(
+		t, store, now.Add(-time.Hour), now.Add(time.Hour),
+		&button, &motion, &sameTime, &noMotion)
+	assertSensorEvents(
+		t, store, now, now.Add(time.Minute), &motion, &sameTime)
+	assertSensorEvents(t, store, now.Add(time.Hour), now.Add(2*time.Hour))
+	if err := store.TrimSensorEvents(nil, now); err != nil {
+		t.Errorf("Got error trimming: %v", err)
+	}
+	assertSensorEvents(
+		t, store, now.Add(-time.Hour), now.Add(time.Hour),
+		&motion, &sameTime, &noMotion)
+}
+
+func WeatherObservations(t *testing.T, store huedb.WeatherObservationStore) {
+	now := time.Date(2015, 6, 1, 2, 13, 0, 0, time.UTC)
+	cold := huedb.WeatherObservation{
+		Station:     "KNUQ",
+		Temperature: 12.5,
+		Weather:     "Fair",
+		WindSpeed:   2.5,
+		Time:        now.Add(-3 * time.Hour)}
+	mild := huedb.WeatherObservation{
+		Station:     "KNUQ",
+		Temperature: 18.0,
+		Weather:     "Partly Cloudy",
+		Time:        now.Add(-time.Hour)}
+	warm := huedb.WeatherObservation{
+		Station: "KSJC", Temperature: 21.0, Weather: "Fair", Time: now}
+	log := huedb.NewWeatherObservationLog(store)
+	for _, observation := range []*huedb.WeatherObservation{
+		&cold, &mild} {
+		if err := store.AddWeatherObservation(nil, observation); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	if err := log.LogObservation(
+		"KSJC",
+		&weather.Observation{
+			Temperature: weather.CelsiusToFahrenheit(21.0),
+			Weather:     "Fair",
+			Units:       weather.Imperial},
+		now); err != nil {
+		t.Fatalf("Got %v logging observation", err)
+	}
+	assertWeatherObservations(
+		t, store, now.Add(-3*time.Hour), now.Add(time.Hour),
+		&cold, &mild, &warm)
+	var recent []*huedb.WeatherObservation
+	if err := huedb.RecentWeatherObservations(
+		nil, store, 2, now, goconsume.AppendPtrsTo(&recent)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(recent) != 2 {
+		t.Errorf("Expected 2 recent observations, got %d", len(recent))
+	}
+	if err := store.TrimWeatherObservations(nil, now.Add(-time.Hour)); err != nil {
+		t.Errorf("Got error trimming: %v", err)
+	}
+	assertWeatherObservations(
+		t, store, now.Add(-3*time.Hour), now.Add(time.Hour), &mild, &warm)
+}
+
 func createNamedColors(
 	t *testing.T,
 	store MinimalStore,
@@ -163,3 +1128,441 @@ func assertNCEqual(t *testing.T, expected, actual *ops.NamedColors) {
 		t.Errorf("Expected %v, got %v", expected, actual)
 	}
 }
+
+func assertSTEqual(t *testing.T, expected, actual *huedb.EncodedScheduledTask) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func namedColorsHistory(
+	t *testing.T,
+	store huedb.NamedColorsHistoryRunner,
+	id int64) (result []*huedb.NamedColorsRevision) {
+	if err := store.NamedColorsHistory(
+		nil, id, goconsume.AppendPtrsTo(&result)); err != nil {
+		t.Errorf("Got error reading history: %v", err)
+	}
+	return
+}
+
+func deletedNamedColors(
+	t *testing.T,
+	store huedb.DeletedNamedColorsRunner) (
+	result []*huedb.NamedColorsRevision) {
+	if err := store.DeletedNamedColors(
+		nil, goconsume.AppendPtrsTo(&result)); err != nil {
+		t.Errorf("Got error reading deleted named colors: %v", err)
+	}
+	return
+}
+
+func assertRevisions(
+	t *testing.T,
+	revisions []*huedb.NamedColorsRevision,
+	deleted bool,
+	expected ...*ops.NamedColors) {
+	if len(revisions) != len(expected) {
+		t.Errorf("Expected %d revisions, got %d", len(expected), len(revisions))
+		return
+	}
+	for i := range revisions {
+		if revisions[i].Id == 0 {
+			t.Error("Expected revision Id to be set.")
+		}
+		if revisions[i].UpdatedAt.IsZero() {
+			t.Error("Expected UpdatedAt to be set.")
+		}
+		if revisions[i].Deleted != deleted {
+			t.Errorf("Expected Deleted %v, got %v", deleted, revisions[i].Deleted)
+		}
+		assertNCEqual(t, expected[i], &revisions[i].NamedColors)
+	}
+}
+
+func assertNamedColorsByDescription(
+	t *testing.T,
+	store huedb.NamedColorsByDescriptionRunner,
+	pattern string,
+	expected ...*ops.NamedColors) {
+	var results []*ops.NamedColors
+	if err := store.NamedColorsByDescription(
+		nil, pattern, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(expected) == 0 && len(results) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("For %q, expected %v, got %v", pattern, expected, results)
+	}
+}
+
+func assertNamedColorsPage(
+	t *testing.T,
+	store huedb.NamedColorsPageRunner,
+	offset, limit int,
+	expected ...*ops.NamedColors) {
+	var results []*ops.NamedColors
+	if err := store.NamedColorsPage(
+		nil, offset, limit, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(expected) == 0 && len(results) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("For %d, %d expected %v, got %v", offset, limit, expected, results)
+	}
+}
+
+func assertEncodedAtTimeTasks(
+	t *testing.T,
+	store huedb.EncodedAtTimeTaskStore,
+	groupId string,
+	expected ...*huedb.EncodedAtTimeTask) {
+	var results []*huedb.EncodedAtTimeTask
+	if err := store.EncodedAtTimeTasks(
+		nil, groupId, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(expected) == 0 && len(results) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+}
+
+func assertUserEqual(t *testing.T, expected, actual *huedb.User) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertLightAliases(
+	t *testing.T,
+	store huedb.LightAliasesRunner,
+	expected ...*huedb.LightAlias) {
+	var actual []*huedb.LightAlias
+	if err := store.LightAliases(
+		nil, goconsume.AppendPtrsTo(&actual)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertLightGroups(
+	t *testing.T,
+	store huedb.LightGroupsRunner,
+	expected ...*huedb.LightGroup) {
+	var actual []*huedb.LightGroup
+	if err := store.LightGroups(
+		nil, goconsume.AppendPtrsTo(&actual)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertSceneComponents(
+	t *testing.T,
+	store huedb.SceneComponentsRunner,
+	namedColorsId int64,
+	expected ...*huedb.SceneComponent) {
+	var actual []*huedb.SceneComponent
+	if err := store.SceneComponents(
+		nil, namedColorsId, goconsume.AppendPtrsTo(&actual)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertWeatherSettings(
+	t *testing.T,
+	store huedb.WeatherSettingsRunner,
+	expected ...*huedb.WeatherSettings) {
+	var actual []*huedb.WeatherSettings
+	if err := store.WeatherSettings(
+		nil, goconsume.AppendPtrsTo(&actual)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertBridges(
+	t *testing.T,
+	store huedb.BridgesRunner,
+	expected ...*huedb.Bridge) {
+	var actual []*huedb.Bridge
+	if err := store.Bridges(nil, goconsume.AppendPtrsTo(&actual)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertLastLightColors(
+	t *testing.T,
+	store huedb.LastLightColorsRunner,
+	expected ops.LightColors) {
+	actual, err := store.LastLightColors(nil)
+	if err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func assertNamedColorsOrdered(
+	t *testing.T,
+	store huedb.NamedColorsOrderedRunner,
+	order huedb.NamedColorsOrder,
+	expected ...*ops.NamedColors) {
+	var actual []*ops.NamedColors
+	if err := store.NamedColorsOrdered(
+		nil, order, goconsume.AppendPtrsTo(&actual)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(actual) != len(expected) {
+		t.Errorf("Expected %d named colors, got %d", len(expected), len(actual))
+		return
+	}
+	for i := range expected {
+		assertNCEqual(t, expected[i], actual[i])
+	}
+}
+
+func assertArchivedAtTimeTasks(
+	t *testing.T,
+	store huedb.ArchivedAtTimeTasksRunner,
+	groupId string,
+	expected ...*huedb.ArchivedAtTimeTask) {
+	var results []*huedb.ArchivedAtTimeTask
+	if err := store.ArchivedAtTimeTasks(
+		nil, groupId, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(results) != len(expected) {
+		t.Errorf("Expected %d archived tasks, got %d", len(expected), len(results))
+		return
+	}
+	for i := range results {
+		if results[i].Id == 0 {
+			t.Error("Expected archived task to have an id")
+		}
+		if !results[i].CompletedAt.Equal(expected[i].CompletedAt) {
+			t.Errorf("Expected %v, got %v", expected[i].CompletedAt, results[i].CompletedAt)
+		}
+		actual := *results[i]
+		actual.Id = 0
+		actual.CompletedAt = time.Time{}
+		want := *expected[i]
+		want.Id = 0
+		want.CompletedAt = time.Time{}
+		if !reflect.DeepEqual(want, actual) {
+			t.Errorf("Expected %v, got %v", want, actual)
+		}
+	}
+}
+
+func assertSensorEvents(
+	t *testing.T,
+	store huedb.SensorEventsRunner,
+	start, end time.Time,
+	expected ...*huedb.SensorEvent) {
+	var results []*huedb.SensorEvent
+	if err := store.SensorEvents(
+		nil, start, end, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(results) != len(expected) {
+		t.Errorf("Expected %d sensor events, got %d", len(expected), len(results))
+		return
+	}
+	for i := range results {
+		if !results[i].Time.Equal(expected[i].Time) {
+			t.Errorf("Expected %v, got %v", expected[i].Time, results[i].Time)
+		}
+		actual := *results[i]
+		actual.Time = time.Time{}
+		want := *expected[i]
+		want.Time = time.Time{}
+		if !reflect.DeepEqual(want, actual) {
+			t.Errorf("Expected %v, got %v", want, actual)
+		}
+	}
+}
+
+func assertScheduleProfiles(
+	t *testing.T,
+	store huedb.ScheduleProfilesRunner,
+	expected ...*huedb.ScheduleProfile) {
+	var results []*huedb.ScheduleProfile
+	if err := store.ScheduleProfiles(
+		nil, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+}
+
+func assertSearch(
+	t *testing.T,
+	store huedb.SearchRunner,
+	query string,
+	expected ...*huedb.SearchResult) {
+	var results []*huedb.SearchResult
+	if err := store.Search(
+		nil, query, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error searching database: %v", err)
+	}
+	if len(expected) == 0 && len(results) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("For %q, expected %v, got %v", query, expected, results)
+	}
+}
+
+func assertWeatherObservations(
+	t *testing.T,
+	store huedb.WeatherObservationsRunner,
+	start, end time.Time,
+	expected ...*huedb.WeatherObservation) {
+	var results []*huedb.WeatherObservation
+	if err := store.WeatherObservations(
+		nil, start, end, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(results) != len(expected) {
+		t.Errorf("Expected %d observations, got %d", len(expected), len(results))
+		return
+	}
+	for i := range results {
+		if !results[i].Time.Equal(expected[i].Time) {
+			t.Errorf("Expected %v, got %v", expected[i].Time, results[i].Time)
+		}
+		actual := *results[i]
+		actual.Time = time.Time{}
+		actual.Id = 0
+		want := *expected[i]
+		want.Time = time.Time{}
+		want.Id = 0
+		if math.Abs(actual.Temperature-want.Temperature) > 0.001 {
+			t.Errorf("Expected %v, got %v", want, actual)
+		}
+		actual.Temperature = want.Temperature
+		if !reflect.DeepEqual(want, actual) {
+			t.Errorf("Expected %v, got %v", want, actual)
+		}
+	}
+}
+
+func BackupRestore(t *testing.T, store BackupStore) {
+	foo := ops.NamedColors{Description: "Foo"}
+	if err := store.AddNamedColors(nil, &foo); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	theme := huedb.Preference{UserId: 1, Key: "theme", Value: `"dark"`}
+	if err := store.SetPreference(nil, &theme); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backup")
+	if err := store.Backup(nil, path); err != nil {
+		t.Fatalf("Got error backing up: %v", err)
+	}
+	bar := ops.NamedColors{Description: "Bar"}
+	if err := store.AddNamedColors(nil, &bar); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	if err := store.RemovePreference(nil, 1, "theme"); err != nil {
+		t.Fatalf("Got error removing from database: %v", err)
+	}
+	if err := store.Restore(nil, path); err != nil {
+		t.Fatalf("Got error restoring: %v", err)
+	}
+	var results []*ops.NamedColors
+	if err := store.NamedColors(
+		nil, goconsume.AppendPtrsTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(results) != 1 || results[0].Id != foo.Id || results[0].Description != "Foo" {
+		t.Errorf("Expected only %v, got %v", &foo, results)
+	}
+	var pref huedb.Preference
+	if err := store.Preference(nil, 1, "theme", &pref); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if !reflect.DeepEqual(&theme, &pref) {
+		t.Errorf("Expected %v, got %v", &theme, &pref)
+	}
+	baz := ops.NamedColors{Description: "Baz"}
+	if err := store.AddNamedColors(nil, &baz); err != nil {
+		t.Fatalf("Got %v adding to store", err)
+	}
+	if baz.Id == foo.Id {
+		t.Errorf("Expected new id after restore, got %d", baz.Id)
+	}
+	if err := store.Restore(
+		nil, filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected error restoring missing file.")
+	}
+}
+
+func WithContext(t *testing.T, store ContextStore) {
+	var foo ops.NamedColors
+	createNamedColor(
+		t, store.WithContext(context.Background()), kFirstNamedColor, &foo)
+	var result ops.NamedColors
+	if err := store.NamedColorsById(nil, foo.Id, &result); err != nil {
+		t.Errorf("Got error reading database by id: %v", err)
+	}
+	if !reflect.DeepEqual(&foo, &result) {
+		t.Errorf("Expected %v, got %v", &foo, &result)
+	}
+	if err := huedb.NamedColorsByIdWithContext(
+		context.Background(), store, foo.Id, &result); err != nil {
+		t.Errorf("Got error reading database by id: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := huedb.NamedColorsByIdWithContext(
+		ctx, store, foo.Id, &result); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// CancelledContext checks that a store bound to a context that is
+// already done does nothing and returns ctx.Err().
+func CancelledContext(t *testing.T, store ContextStore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bound := store.WithContext(ctx)
+	foo := ops.NamedColors{Description: "Foo"}
+	if err := bound.AddNamedColors(nil, &foo); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	var results []ops.NamedColors
+	if err := bound.NamedColors(
+		nil, goconsume.AppendTo(&results)); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if err := store.NamedColors(nil, goconsume.AppendTo(&results)); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected nothing added, got %v", results)
+	}
+}
@@ -0,0 +1,1762 @@
+// Package for_bolt provides a bbolt implementation of interfaces in huedb
+// package. bbolt is pure Go so this package needs no cgo.
+package for_bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/ops"
+	bolt "go.etcd.io/bbolt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	kNamedColorsBucket          = []byte("named_colors")
+	kNamedColorsHistoryBucket   = []byte("named_colors_history")
+	kAtTimeTasksBucket          = []byte("at_time_tasks")
+	kAtTimeTasksArchiveBucket   = []byte("at_time_tasks_archive")
+	kScheduledTasksBucket       = []byte("scheduled_tasks")
+	kUsersBucket                = []byte("users")
+	kLightAliasesBucket         = []byte("light_aliases")
+	kLightGroupsBucket          = []byte("light_groups")
+	kSceneComponentsBucket      = []byte("scene_components")
+	kBridgesBucket              = []byte("bridges")
+	kWeatherSettingsBucket      = []byte("weather_settings")
+	kDescriptionOverridesBucket = []byte("description_overrides")
+	kLastLightColorsBucket      = []byte("last_light_colors")
+	kScheduleProfilesBucket     = []byte("schedule_profiles")
+	kSensorEventsBucket         = []byte("sensor_events")
+	kWeatherObservationsBucket  = []byte("weather_observations")
+	kPreferencesBucket          = []byte("preferences")
+)
+
+var (
+	errDuplicateName = errors.New("for_bolt: Duplicate name.")
+)
+
+// Store implements the huedb interfaces. A non-nil db.Transaction passed
+// to a Store method must be a *bolt.Tx from the same database. Methods
+// that write need a writable *bolt.Tx. Store creates its buckets as
+// needed so it needs no setup.
+type Store struct {
+	db  *bolt.DB
+	ctx context.Context
+}
+
+// New returns a Store backed by db.
+func New(db *bolt.DB) Store {
+	return Store{db: db}
+}
+
+// WithContext returns a Store like s that gives up once ctx is done.
+// bbolt cannot interrupt a transaction so the returned Store checks ctx
+// before and after waiting for its transaction to start.
+func (s Store) WithContext(ctx context.Context) huedb.Store {
+	s.ctx = ctx
+	return s
+}
+
+// NewDoer returns a db.Doer that runs actions within a single writable
+// transaction of db. The Transaction passed to each action is a *bolt.Tx.
+func NewDoer(db *bolt.DB) db.Doer {
+	return doer{db}
+}
+
+func (s Store) NamedColorsById(
+	t db.Transaction, id int64, namedColors *ops.NamedColors) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		value := getValue(tx, kNamedColorsBucket, id)
+		if value == nil {
+			return huedb.ErrNoSuchId
+		}
+		return unmarshallNamedColors(id, value, namedColors)
+	})
+}
+
+func (s Store) NamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kNamedColorsBucket, func(id int64, value []byte) (bool, error) {
+			if !consumer.CanConsume() {
+				return false, nil
+			}
+			var namedColors ops.NamedColors
+			if err := unmarshallNamedColors(id, value, &namedColors); err != nil {
+				return false, err
+			}
+			consumer.Consume(&namedColors)
+			return true, nil
+		})
+	})
+}
+
+func (s Store) NamedColorsOrdered(
+	t db.Transaction,
+	order huedb.NamedColorsOrder,
+	consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		var all []ops.NamedColors
+		if err := s.NamedColors(tx, goconsume.AppendTo(&all)); err != nil {
+			return err
+		}
+		lastRevision := make(map[int64]int64)
+		err := forEach(tx, kNamedColorsHistoryBucket, func(id int64, value []byte) (bool, error) {
+			var raw rawRevision
+			if err := json.Unmarshal(value, &raw); err != nil {
+				return false, err
+			}
+			lastRevision[raw.NamedColorsId] = id
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		less := func(i, j int) bool {
+			return all[i].Id < all[j].Id
+		}
+		switch order.By {
+		case huedb.OrderByDescription:
+			less = func(i, j int) bool {
+				return strings.ToLower(all[i].Description) < strings.ToLower(all[j].Description)
+			}
+		case huedb.OrderByUpdatedAt:
+			less = func(i, j int) bool {
+				return lastRevision[all[i].Id] < lastRevision[all[j].Id]
+			}
+		}
+		if order.Descending {
+			ascending := less
+			less = func(i, j int) bool {
+				return ascending(j, i)
+			}
+		}
+		sort.SliceStable(all, less)
+		for i := range all {
+			if !consumer.CanConsume() {
+				break
+			}
+			consumer.Consume(&all[i])
+		}
+		return nil
+	})
+}
+
+func (s Store) NamedColorsByIds(
+	t db.Transaction, ids []int64, consumer goconsume.Consumer) error {
+	sorted := sortIds(append([]int64(nil), ids...))
+	return s.view(t, func(tx *bolt.Tx) error {
+		for i, id := range sorted {
+			if !consumer.CanConsume() {
+				break
+			}
+			if i > 0 && sorted[i-1] == id {
+				continue
+			}
+			value := getValue(tx, kNamedColorsBucket, id)
+			if value == nil {
+				continue
+			}
+			var namedColors ops.NamedColors
+			if err := unmarshallNamedColors(id, value, &namedColors); err != nil {
+				return err
+			}
+			consumer.Consume(&namedColors)
+		}
+		return nil
+	})
+}
+
+func (s Store) NamedColorsPage(
+	t db.Transaction, offset, limit int, consumer goconsume.Consumer) error {
+	if offset < 0 {
+		offset = 0
+	}
+	end := math.MaxInt
+	if limit >= 0 {
+		end = offset + limit
+	}
+	return s.NamedColors(t, goconsume.Slice(consumer, offset, end))
+}
+
+func (s Store) NamedColorsCount(t db.Transaction) (count int, err error) {
+	err = s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kNamedColorsBucket, func(id int64, value []byte) (bool, error) {
+			count++
+			return true, nil
+		})
+	})
+	return
+}
+
+func (s Store) NamedColorsByDescription(
+	t db.Transaction, pattern string, consumer goconsume.Consumer) error {
+	pattern = strings.ToLower(pattern)
+	return s.NamedColors(t, goconsume.Filter(
+		consumer,
+		func(ptr interface{}) bool {
+			namedColors := ptr.(*ops.NamedColors)
+			return strings.Contains(
+				strings.ToLower(namedColors.Description), pattern)
+		}))
+}
+
+func (s Store) AddNamedColors(
+	t db.Transaction, namedColors *ops.NamedColors) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return addNamedColors(tx, namedColors)
+	})
+}
+
+func (s Store) AddNamedColorsBatch(
+	t db.Transaction, batch []*ops.NamedColors) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		for _, namedColors := range batch {
+			if err := addNamedColors(tx, namedColors); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateLightColors does nothing because Store always encodes colors in
+// the current format.
+func (s Store) MigrateLightColors(t db.Transaction) error {
+	return nil
+}
+
+func (s Store) UpdateNamedColors(
+	t db.Transaction, namedColors *ops.NamedColors) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		value, err := marshallNamedColors(namedColors)
+		if err != nil {
+			return err
+		}
+		if getValue(tx, kNamedColorsBucket, namedColors.Id) == nil {
+			return nil
+		}
+		if err := addRevision(tx, namedColors.Id, false); err != nil {
+			return err
+		}
+		return putValue(tx, kNamedColorsBucket, namedColors.Id, value)
+	})
+}
+
+func (s Store) RemoveNamedColors(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		if getValue(tx, kNamedColorsBucket, id) == nil {
+			return nil
+		}
+		if err := addRevision(tx, id, true); err != nil {
+			return err
+		}
+		return remove(tx, kNamedColorsBucket, id)
+	})
+}
+
+func (s Store) NamedColorsHistory(
+	t db.Transaction, id int64, consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		return forEachReversed(tx, kNamedColorsHistoryBucket, func(revisionId int64, value []byte) (bool, error) {
+			if !consumer.CanConsume() {
+				return false, nil
+			}
+			var raw rawRevision
+			if err := json.Unmarshal(value, &raw); err != nil {
+				return false, err
+			}
+			if raw.NamedColorsId != id {
+				return true, nil
+			}
+			var revision huedb.NamedColorsRevision
+			if err := raw.unmarshall(revisionId, &revision); err != nil {
+				return false, err
+			}
+			consumer.Consume(&revision)
+			return true, nil
+		})
+	})
+}
+
+func (s Store) DeletedNamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		seen := make(map[int64]bool)
+		return forEachReversed(tx, kNamedColorsHistoryBucket, func(revisionId int64, value []byte) (bool, error) {
+			if !consumer.CanConsume() {
+				return false, nil
+			}
+			var raw rawRevision
+			if err := json.Unmarshal(value, &raw); err != nil {
+				return false, err
+			}
+			if seen[raw.NamedColorsId] {
+				return true, nil
+			}
+			seen[raw.NamedColorsId] = true
+			if !raw.Deleted || getValue(tx, kNamedColorsBucket, raw.NamedColorsId) != nil {
+				return true, nil
+			}
+			var revision huedb.NamedColorsRevision
+			if err := raw.unmarshall(revisionId, &revision); err != nil {
+				return false, err
+			}
+			consumer.Consume(&revision)
+			return true, nil
+		})
+	})
+}
+
+func (s Store) RestoreNamedColors(t db.Transaction, revisionId int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		var raw rawRevision
+		if err := get(tx, kNamedColorsHistoryBucket, revisionId, &raw); err != nil {
+			return err
+		}
+		if getValue(tx, kNamedColorsBucket, raw.NamedColorsId) != nil {
+			if err := addRevision(tx, raw.NamedColorsId, false); err != nil {
+				return err
+			}
+		}
+		return put(tx, kNamedColorsBucket, raw.NamedColorsId, &raw.rawNamedColors)
+	})
+}
+
+func (s Store) EncodedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kAtTimeTasksBucket, func(id int64, value []byte) (bool, error) {
+			if !consumer.CanConsume() {
+				return false, nil
+			}
+			var task huedb.EncodedAtTimeTask
+			if err := json.Unmarshal(value, &task); err != nil {
+				return false, err
+			}
+			if task.GroupId == groupId {
+				task.Id = id
+				consumer.Consume(&task)
+			}
+			return true, nil
+		})
+	})
+}
+
+func (s Store) AddEncodedAtTimeTask(
+	t db.Transaction, task *huedb.EncodedAtTimeTask) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		taskCopy := *task
+		taskCopy.Id = 0
+		id, err := add(tx, kAtTimeTasksBucket, &taskCopy)
+		if err != nil {
+			return err
+		}
+		task.Id = id
+		return nil
+	})
+}
+
+func (s Store) RemoveEncodedAtTimeTaskByScheduleId(
+	t db.Transaction, groupId, scheduleId string) error {
+	return s.removeEncodedAtTimeTasks(t, func(task *huedb.EncodedAtTimeTask) bool {
+		return task.GroupId == groupId && task.ScheduleId == scheduleId
+	})
+}
+
+func (s Store) UpdateEncodedAtTimeTaskTime(
+	t db.Transaction,
+	groupId, scheduleId, newScheduleId string,
+	newTime time.Time) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		updated := make(map[int64]*huedb.EncodedAtTimeTask)
+		err := forEach(tx, kAtTimeTasksBucket, func(id int64, value []byte) (bool, error) {
+			var task huedb.EncodedAtTimeTask
+			if err := json.Unmarshal(value, &task); err != nil {
+				return false, err
+			}
+			if task.GroupId == groupId && task.ScheduleId == scheduleId {
+				task.ScheduleId = newScheduleId
+				task.Time = newTime.Unix()
+				updated[id] = &task
+			}
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for id, task := range updated {
+			if err := put(tx, kAtTimeTasksBucket, id, task); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) RemoveExpired(t db.Transaction, before time.Time) error {
+	return s.removeEncodedAtTimeTasks(t, func(task *huedb.EncodedAtTimeTask) bool {
+		return task.Time < before.Unix()
+	})
+}
+
+// ClearEncodedAtTimeTasks removes every at time task. It keeps the
+// bucket so that the ids of the removed tasks are never used again.
+func (s Store) ClearEncodedAtTimeTasks(t db.Transaction) error {
+	return s.removeEncodedAtTimeTasks(t, func(task *huedb.EncodedAtTimeTask) bool {
+		return true
+	})
+}
+
+func (s Store) ArchiveEncodedAtTimeTask(
+	t db.Transaction,
+	groupId, scheduleId string,
+	status huedb.AtTimeTaskStatus,
+	completedAt time.Time) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		var archived []*rawArchivedAtTimeTask
+		err := forEach(tx, kAtTimeTasksBucket, func(id int64, value []byte) (bool, error) {
+			var task huedb.EncodedAtTimeTask
+			if err := json.Unmarshal(value, &task); err != nil {
+				return false, err
+			}
+			if task.GroupId == groupId && task.ScheduleId == scheduleId {
+				archived = append(archived, &rawArchivedAtTimeTask{
+					EncodedAtTimeTask: task,
+					Status:            status,
+					CompletedAt:       completedAt.Unix(),
+				})
+			}
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, task := range archived {
+			if _, err := add(tx, kAtTimeTasksArchiveBucket, task); err != nil {
+				return err
+			}
+		}
+		return s.RemoveEncodedAtTimeTaskByScheduleId(tx, groupId, scheduleId)
+	})
+}
+
+func (s Store) ArchivedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
+	var result []huedb.ArchivedAtTimeTask
+	err := s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kAtTimeTasksArchiveBucket, func(id int64, value []byte) (bool, error) {
+			var raw rawArchivedAtTimeTask
+			if err := json.Unmarshal(value, &raw); err != nil {
+				return false, err
+			}
+			if raw.GroupId == groupId {
+				task := huedb.ArchivedAtTimeTask{
+					EncodedAtTimeTask: raw.EncodedAtTimeTask,
+					Status:            raw.Status,
+					CompletedAt:       time.Unix(raw.CompletedAt, 0),
+				}
+				task.Id = id
+				result = append(result, task)
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if !result[i].CompletedAt.Equal(result[j].CompletedAt) {
+			return result[i].CompletedAt.After(result[j].CompletedAt)
+		}
+		return result[i].Id > result[j].Id
+	})
+	for i := range result {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&result[i])
+	}
+	return nil
+}
+
+func (s Store) EncodedScheduledTaskById(
+	t db.Transaction, id int64, task *huedb.EncodedScheduledTask) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		if err := get(tx, kScheduledTasksBucket, id, task); err != nil {
+			return err
+		}
+		task.Id = id
+		return nil
+	})
+}
+
+func (s Store) EncodedScheduledTasks(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kScheduledTasksBucket, func(id int64, value []byte) (bool, error) {
+			if !consumer.CanConsume() {
+				return false, nil
+			}
+			var task huedb.EncodedScheduledTask
+			if err := json.Unmarshal(value, &task); err != nil {
+				return false, err
+			}
+			task.Id = id
+			consumer.Consume(&task)
+			return true, nil
+		})
+	})
+}
+
+func (s Store) AddEncodedScheduledTask(
+	t db.Transaction, task *huedb.EncodedScheduledTask) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		id, err := add(tx, kScheduledTasksBucket, task)
+		if err != nil {
+			return err
+		}
+		task.Id = id
+		return nil
+	})
+}
+
+func (s Store) UpdateEncodedScheduledTask(
+	t db.Transaction, task *huedb.EncodedScheduledTask) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		if getValue(tx, kScheduledTasksBucket, task.Id) == nil {
+			return nil
+		}
+		return put(tx, kScheduledTasksBucket, task.Id, task)
+	})
+}
+
+func (s Store) RemoveEncodedScheduledTask(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return remove(tx, kScheduledTasksBucket, id)
+	})
+}
+
+func (s Store) UserById(
+	t db.Transaction, id int64, user *huedb.User) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		if err := get(tx, kUsersBucket, id, user); err != nil {
+			return err
+		}
+		user.Id = id
+		return nil
+	})
+}
+
+func (s Store) UserByName(
+	t db.Transaction, name string, user *huedb.User) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		found := false
+		err := forEach(tx, kUsersBucket, func(id int64, value []byte) (bool, error) {
+			var stored huedb.User
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return false, err
+			}
+			if stored.Name != name {
+				return true, nil
+			}
+			stored.Id = id
+			*user = stored
+			found = true
+			return false, nil
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return huedb.ErrNoSuchId
+		}
+		return nil
+	})
+}
+
+func (s Store) Users(t db.Transaction, consumer goconsume.Consumer) error {
+	var users []huedb.User
+	err := s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kUsersBucket, func(id int64, value []byte) (bool, error) {
+			var user huedb.User
+			if err := json.Unmarshal(value, &user); err != nil {
+				return false, err
+			}
+			user.Id = id
+			users = append(users, user)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+	for i := range users {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&users[i])
+	}
+	return nil
+}
+
+func (s Store) AddUser(t db.Transaction, user *huedb.User) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		id, err := addNamed(tx, kUsersBucket, user.Name, user)
+		if err != nil {
+			return err
+		}
+		user.Id = id
+		return nil
+	})
+}
+
+func (s Store) UpdateUser(t db.Transaction, user *huedb.User) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return updateNamed(tx, kUsersBucket, user.Id, user.Name, user)
+	})
+}
+
+func (s Store) RemoveUser(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return remove(tx, kUsersBucket, id)
+	})
+}
+
+func (s Store) LightAliases(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	var aliases []huedb.LightAlias
+	err := s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kLightAliasesBucket, func(id int64, value []byte) (bool, error) {
+			var alias huedb.LightAlias
+			if err := json.Unmarshal(value, &alias); err != nil {
+				return false, err
+			}
+			alias.Id = id
+			aliases = append(aliases, alias)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(aliases, func(i, j int) bool {
+		return aliases[i].Name < aliases[j].Name
+	})
+	for i := range aliases {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&aliases[i])
+	}
+	return nil
+}
+
+func (s Store) AddLightAlias(
+	t db.Transaction, alias *huedb.LightAlias) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		id, err := addNamed(tx, kLightAliasesBucket, alias.Name, alias)
+		if err != nil {
+			return err
+		}
+		alias.Id = id
+		return nil
+	})
+}
+
+func (s Store) UpdateLightAlias(
+	t db.Transaction, alias *huedb.LightAlias) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return updateNamed(tx, kLightAliasesBucket, alias.Id, alias.Name, alias)
+	})
+}
+
+func (s Store) RemoveLightAlias(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return remove(tx, kLightAliasesBucket, id)
+	})
+}
+
+func (s Store) LightGroups(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	var groups []huedb.LightGroup
+	err := s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kLightGroupsBucket, func(id int64, value []byte) (bool, error) {
+			var group huedb.LightGroup
+			if err := json.Unmarshal(value, &group); err != nil {
+				return false, err
+			}
+			group.Id = id
+			groups = append(groups, group)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	for i := range groups {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&groups[i])
+	}
+	return nil
+}
+
+func (s Store) AddLightGroup(
+	t db.Transaction, group *huedb.LightGroup) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		id, err := addNamed(tx, kLightGroupsBucket, group.Name, group)
+		if err != nil {
+			return err
+		}
+		group.Id = id
+		return nil
+	})
+}
+
+func (s Store) UpdateLightGroup(
+	t db.Transaction, group *huedb.LightGroup) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return updateNamed(tx, kLightGroupsBucket, group.Id, group.Name, group)
+	})
+}
+
+func (s Store) RemoveLightGroup(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return remove(tx, kLightGroupsBucket, id)
+	})
+}
+
+func (s Store) SceneComponents(
+	t db.Transaction,
+	namedColorsId int64,
+	consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kSceneComponentsBucket, func(id int64, value []byte) (bool, error) {
+			if !consumer.CanConsume() {
+				return false, nil
+			}
+			var component huedb.SceneComponent
+			if err := json.Unmarshal(value, &component); err != nil {
+				return false, err
+			}
+			if component.NamedColorsId == namedColorsId {
+				component.Id = id
+				consumer.Consume(&component)
+			}
+			return true, nil
+		})
+	})
+}
+
+func (s Store) AddSceneComponent(
+	t db.Transaction, component *huedb.SceneComponent) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		id, err := add(tx, kSceneComponentsBucket, component)
+		if err != nil {
+			return err
+		}
+		component.Id = id
+		return nil
+	})
+}
+
+func (s Store) RemoveSceneComponent(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return remove(tx, kSceneComponentsBucket, id)
+	})
+}
+
+func (s Store) BridgeById(
+	t db.Transaction, id int64, bridge *huedb.Bridge) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		if err := get(tx, kBridgesBucket, id, bridge); err != nil {
+			return err
+		}
+		bridge.Id = id
+		return nil
+	})
+}
+
+func (s Store) Bridges(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	var bridges []huedb.Bridge
+	err := s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kBridgesBucket, func(id int64, value []byte) (bool, error) {
+			var bridge huedb.Bridge
+			if err := json.Unmarshal(value, &bridge); err != nil {
+				return false, err
+			}
+			bridge.Id = id
+			bridges = append(bridges, bridge)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(bridges, func(i, j int) bool {
+		return bridges[i].Name < bridges[j].Name
+	})
+	for i := range bridges {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&bridges[i])
+	}
+	return nil
+}
+
+func (s Store) AddBridge(t db.Transaction, bridge *huedb.Bridge) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		id, err := addNamed(tx, kBridgesBucket, bridge.Name, bridge)
+		if err != nil {
+			return err
+		}
+		bridge.Id = id
+		return nil
+	})
+}
+
+func (s Store) UpdateBridge(t db.Transaction, bridge *huedb.Bridge) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return updateNamed(tx, kBridgesBucket, bridge.Id, bridge.Name, bridge)
+	})
+}
+
+func (s Store) RemoveBridge(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return remove(tx, kBridgesBucket, id)
+	})
+}
+
+func (s Store) WeatherSettings(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kWeatherSettingsBucket, func(id int64, value []byte) (bool, error) {
+			if !consumer.CanConsume() {
+				return false, nil
+			}
+			var settings huedb.WeatherSettings
+			if err := json.Unmarshal(value, &settings); err != nil {
+				return false, err
+			}
+			settings.Id = id
+			consumer.Consume(&settings)
+			return true, nil
+		})
+	})
+}
+
+func (s Store) AddWeatherSettings(
+	t db.Transaction, settings *huedb.WeatherSettings) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		id, err := add(tx, kWeatherSettingsBucket, settings)
+		if err != nil {
+			return err
+		}
+		settings.Id = id
+		return nil
+	})
+}
+
+func (s Store) UpdateWeatherSettings(
+	t db.Transaction, settings *huedb.WeatherSettings) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		if getValue(tx, kWeatherSettingsBucket, settings.Id) == nil {
+			return nil
+		}
+		return put(tx, kWeatherSettingsBucket, settings.Id, settings)
+	})
+}
+
+func (s Store) RemoveWeatherSettings(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return remove(tx, kWeatherSettingsBucket, id)
+	})
+}
+
+func (s Store) Search(
+	t db.Transaction, query string, consumer goconsume.Consumer) error {
+	words := huedb.SearchWords(query)
+	if len(words) == 0 {
+		return nil
+	}
+	consumer = goconsume.Filter(consumer, func(ptr interface{}) bool {
+		return huedb.SearchMatches(ptr.(*huedb.SearchResult).Description, words)
+	})
+	return s.view(t, func(tx *bolt.Tx) error {
+		kinds := []struct {
+			bucket []byte
+			kind   string
+		}{
+			{kNamedColorsBucket, huedb.NamedColorsSearchResult},
+			{kScheduledTasksBucket, huedb.ScheduledTaskSearchResult},
+			{kAtTimeTasksBucket, huedb.AtTimeTaskSearchResult},
+		}
+		for _, k := range kinds {
+			err := forEach(tx, k.bucket, func(id int64, value []byte) (bool, error) {
+				if !consumer.CanConsume() {
+					return false, nil
+				}
+				var described struct{ Description string }
+				if err := json.Unmarshal(value, &described); err != nil {
+					return false, err
+				}
+				consumer.Consume(&huedb.SearchResult{
+					Kind:        k.kind,
+					Id:          id,
+					Description: described.Description})
+				return true, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) ScheduleProfileById(
+	t db.Transaction, id int64, profile *huedb.ScheduleProfile) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		if err := get(tx, kScheduleProfilesBucket, id, profile); err != nil {
+			return err
+		}
+		profile.Id = id
+		return nil
+	})
+}
+
+func (s Store) ScheduleProfiles(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	var profiles []huedb.ScheduleProfile
+	err := s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kScheduleProfilesBucket, func(id int64, value []byte) (bool, error) {
+			var profile huedb.ScheduleProfile
+			if err := json.Unmarshal(value, &profile); err != nil {
+				return false, err
+			}
+			profile.Id = id
+			profiles = append(profiles, profile)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	for i := range profiles {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&profiles[i])
+	}
+	return nil
+}
+
+func (s Store) AddScheduleProfile(
+	t db.Transaction, profile *huedb.ScheduleProfile) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		stored := copyScheduleProfile(profile)
+		stored.Active = false
+		id, err := addNamed(tx, kScheduleProfilesBucket, stored.Name, &stored)
+		if err != nil {
+			return err
+		}
+		profile.Id = id
+		profile.Active = false
+		return nil
+	})
+}
+
+func (s Store) UpdateScheduleProfile(
+	t db.Transaction, profile *huedb.ScheduleProfile) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		var stored huedb.ScheduleProfile
+		if err := get(
+			tx, kScheduleProfilesBucket, profile.Id, &stored); err != nil {
+			if err == huedb.ErrNoSuchId {
+				return nil
+			}
+			return err
+		}
+		updated := copyScheduleProfile(profile)
+		updated.Active = stored.Active
+		return updateNamed(
+			tx, kScheduleProfilesBucket, profile.Id, updated.Name, &updated)
+	})
+}
+
+func (s Store) RemoveScheduleProfile(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return remove(tx, kScheduleProfilesBucket, id)
+	})
+}
+
+func (s Store) ActivateScheduleProfile(t db.Transaction, id int64) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		updated := make(map[int64]*huedb.ScheduleProfile)
+		err := forEach(tx, kScheduleProfilesBucket, func(profileId int64, value []byte) (bool, error) {
+			var profile huedb.ScheduleProfile
+			if err := json.Unmarshal(value, &profile); err != nil {
+				return false, err
+			}
+			profile.Active = profileId == id
+			updated[profileId] = &profile
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for profileId, profile := range updated {
+			if err := put(
+				tx, kScheduleProfilesBucket, profileId, profile); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) AddSensorEvent(
+	t db.Transaction, event *huedb.SensorEvent) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		id, err := add(tx, kSensorEventsBucket, &rawSensorEvent{
+			SensorId: event.SensorId,
+			Type:     event.Type,
+			Value:    event.Value,
+			Time:     event.Time.Unix(),
+		})
+		if err != nil {
+			return err
+		}
+		event.Id = id
+		return nil
+	})
+}
+
+func (s Store) SensorEvents(
+	t db.Transaction,
+	start, end time.Time,
+	consumer goconsume.Consumer) error {
+	var result []huedb.SensorEvent
+	err := s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kSensorEventsBucket, func(id int64, value []byte) (bool, error) {
+			var raw rawSensorEvent
+			if err := json.Unmarshal(value, &raw); err != nil {
+				return false, err
+			}
+			if raw.Time >= start.Unix() && raw.Time < end.Unix() {
+				result = append(result, huedb.SensorEvent{
+					Id:       id,
+					SensorId: raw.SensorId,
+					Type:     raw.Type,
+					Value:    raw.Value,
+					Time:     time.Unix(raw.Time, 0),
+				})
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	for i := range result {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&result[i])
+	}
+	return nil
+}
+
+func (s Store) TrimSensorEvents(t db.Transaction, before time.Time) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return removeIf(tx, kSensorEventsBucket, func(value []byte) (bool, error) {
+			var raw rawSensorEvent
+			if err := json.Unmarshal(value, &raw); err != nil {
+				return false, err
+			}
+			return raw.Time < before.Unix(), nil
+		})
+	})
+}
+
+func (s Store) AddWeatherObservation(
+	t db.Transaction, observation *huedb.WeatherObservation) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		id, err := add(tx, kWeatherObservationsBucket, &rawWeatherObservation{
+			Station:     observation.Station,
+			Temperature: observation.Temperature,
+			Weather:     observation.Weather,
+			WindSpeed:   observation.WindSpeed,
+			Time:        observation.Time.Unix(),
+		})
+		if err != nil {
+			return err
+		}
+		observation.Id = id
+		return nil
+	})
+}
+
+func (s Store) WeatherObservations(
+	t db.Transaction,
+	start, end time.Time,
+	consumer goconsume.Consumer) error {
+	var result []huedb.WeatherObservation
+	err := s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kWeatherObservationsBucket, func(id int64, value []byte) (bool, error) {
+			var raw rawWeatherObservation
+			if err := json.Unmarshal(value, &raw); err != nil {
+				return false, err
+			}
+			if raw.Time >= start.Unix() && raw.Time < end.Unix() {
+				result = append(result, huedb.WeatherObservation{
+					Id:          id,
+					Station:     raw.Station,
+					Temperature: raw.Temperature,
+					Weather:     raw.Weather,
+					WindSpeed:   raw.WindSpeed,
+					Time:        time.Unix(raw.Time, 0),
+				})
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	for i := range result {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&result[i])
+	}
+	return nil
+}
+
+func (s Store) TrimWeatherObservations(
+	t db.Transaction, before time.Time) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return removeIf(tx, kWeatherObservationsBucket, func(value []byte) (bool, error) {
+			var raw rawWeatherObservation
+			if err := json.Unmarshal(value, &raw); err != nil {
+				return false, err
+			}
+			return raw.Time < before.Unix(), nil
+		})
+	})
+}
+
+func (s Store) DescriptionOverrides(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kDescriptionOverridesBucket, func(id int64, value []byte) (bool, error) {
+			if !consumer.CanConsume() {
+				return false, nil
+			}
+			consumer.Consume(&huedb.DescriptionOverride{
+				HueTaskId:   int(id),
+				Description: string(value),
+			})
+			return true, nil
+		})
+	})
+}
+
+func (s Store) SetDescriptionOverride(
+	t db.Transaction, override *huedb.DescriptionOverride) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return putValue(
+			tx,
+			kDescriptionOverridesBucket,
+			int64(override.HueTaskId),
+			[]byte(override.Description))
+	})
+}
+
+func (s Store) RemoveDescriptionOverride(
+	t db.Transaction, hueTaskId int) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return remove(tx, kDescriptionOverridesBucket, int64(hueTaskId))
+	})
+}
+
+func (s Store) LastLightColors(t db.Transaction) (
+	colors ops.LightColors, err error) {
+	colors = make(ops.LightColors)
+	err = s.view(t, func(tx *bolt.Tx) error {
+		return forEach(tx, kLastLightColorsBucket, func(id int64, value []byte) (bool, error) {
+			lightColors, err := huedb.DecodeLightColors(string(value))
+			if err != nil {
+				return false, err
+			}
+			colors[int(id)] = lightColors[int(id)]
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s Store) SetLastLightColors(
+	t db.Transaction, colors ops.LightColors) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		if _, ok := colors[0]; ok {
+			if err := removeIf(tx, kLastLightColorsBucket, func(value []byte) (bool, error) {
+				return true, nil
+			}); err != nil {
+				return err
+			}
+		}
+		for id, cb := range colors {
+			encoded, err := huedb.EncodeLightColors(ops.LightColors{id: cb})
+			if err != nil {
+				return err
+			}
+			if err := putValue(
+				tx, kLastLightColorsBucket, int64(id), []byte(encoded)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) Preference(
+	t db.Transaction, userId int64, key string, pref *huedb.Preference) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(kPreferencesBucket)
+		if bucket == nil {
+			return huedb.ErrNoSuchId
+		}
+		value := bucket.Get(preferenceKey(userId, key))
+		if value == nil {
+			return huedb.ErrNoSuchId
+		}
+		*pref = huedb.Preference{UserId: userId, Key: key, Value: string(value)}
+		return nil
+	})
+}
+
+func (s Store) Preferences(
+	t db.Transaction, userId int64, consumer goconsume.Consumer) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(kPreferencesBucket)
+		if bucket == nil {
+			return nil
+		}
+		prefix := idToKey(userId)
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && consumer.CanConsume(); k, v = cursor.Next() {
+			if !strings.HasPrefix(string(k), string(prefix)) {
+				break
+			}
+			consumer.Consume(&huedb.Preference{
+				UserId: userId,
+				Key:    string(k[len(prefix):]),
+				Value:  string(v),
+			})
+		}
+		return nil
+	})
+}
+
+func (s Store) SetPreference(t db.Transaction, pref *huedb.Preference) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(kPreferencesBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(
+			preferenceKey(pref.UserId, pref.Key), []byte(pref.Value))
+	})
+}
+
+func (s Store) RemovePreference(
+	t db.Transaction, userId int64, key string) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(kPreferencesBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete(preferenceKey(userId, key))
+	})
+}
+
+// Backup copies the database to a new bbolt file at dest. Backup reads
+// within one transaction so it can run while other goroutines use the
+// database.
+func (s Store) Backup(t db.Transaction, dest string) error {
+	return s.view(t, func(tx *bolt.Tx) error {
+		return tx.CopyFile(dest, 0600)
+	})
+}
+
+// Restore replaces the contents of the database with the contents of
+// the bbolt file at src which Backup created.
+func (s Store) Restore(t db.Transaction, src string) error {
+	srcDb, err := bolt.Open(src, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer srcDb.Close()
+	return srcDb.View(func(srcTx *bolt.Tx) error {
+		return s.update(t, func(tx *bolt.Tx) error {
+			var names [][]byte
+			err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				names = append(names, name)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+			return srcTx.ForEach(func(name []byte, srcBucket *bolt.Bucket) error {
+				bucket, err := tx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				err = srcBucket.ForEach(func(key, value []byte) error {
+					return bucket.Put(key, value)
+				})
+				if err != nil {
+					return err
+				}
+				return bucket.SetSequence(srcBucket.Sequence())
+			})
+		})
+	})
+}
+
+func (s Store) removeEncodedAtTimeTasks(
+	t db.Transaction, shouldRemove func(task *huedb.EncodedAtTimeTask) bool) error {
+	return s.update(t, func(tx *bolt.Tx) error {
+		return removeIf(tx, kAtTimeTasksBucket, func(value []byte) (bool, error) {
+			var task huedb.EncodedAtTimeTask
+			if err := json.Unmarshal(value, &task); err != nil {
+				return false, err
+			}
+			return shouldRemove(&task), nil
+		})
+	})
+}
+
+func (s Store) view(t db.Transaction, f func(tx *bolt.Tx) error) error {
+	if err := s.contextErr(); err != nil {
+		return err
+	}
+	if t != nil {
+		return f(t.(*bolt.Tx))
+	}
+	return s.db.View(s.withContext(f))
+}
+
+func (s Store) update(t db.Transaction, f func(tx *bolt.Tx) error) error {
+	if err := s.contextErr(); err != nil {
+		return err
+	}
+	if t != nil {
+		return f(t.(*bolt.Tx))
+	}
+	return s.db.Update(s.withContext(f))
+}
+
+// withContext returns a function that runs f unless the context of s
+// is done.
+func (s Store) withContext(
+	f func(tx *bolt.Tx) error) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		if err := s.contextErr(); err != nil {
+			return err
+		}
+		return f(tx)
+	}
+}
+
+func (s Store) contextErr() error {
+	if s.ctx == nil {
+		return nil
+	}
+	return s.ctx.Err()
+}
+
+type doer struct {
+	db *bolt.DB
+}
+
+func (d doer) Do(action db.Action) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return action(tx)
+	})
+}
+
+// addNamedColors stores namedColors under a new id and sets its Id field.
+func addNamedColors(tx *bolt.Tx, namedColors *ops.NamedColors) error {
+	value, err := marshallNamedColors(namedColors)
+	if err != nil {
+		return err
+	}
+	id, err := addValue(tx, kNamedColorsBucket, value)
+	if err != nil {
+		return err
+	}
+	namedColors.Id = id
+	return nil
+}
+
+// addRevision records the current version of the named colors with given
+// id as a new revision.
+func addRevision(tx *bolt.Tx, id int64, deleted bool) error {
+	var raw rawRevision
+	if err := get(tx, kNamedColorsBucket, id, &raw.rawNamedColors); err != nil {
+		return err
+	}
+	raw.NamedColorsId = id
+	raw.UpdatedAt = time.Now().Unix()
+	raw.Deleted = deleted
+	_, err := add(tx, kNamedColorsHistoryBucket, &raw)
+	return err
+}
+
+// addNamed stores value, which has the given name, under a new id and
+// returns that id. addNamed returns errDuplicateName if another value in
+// bucket already has name.
+func addNamed(
+	tx *bolt.Tx, bucket []byte, name string, value interface{}) (
+	int64, error) {
+	taken, err := nameTaken(tx, bucket, name, 0)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, errDuplicateName
+	}
+	return add(tx, bucket, value)
+}
+
+// updateNamed replaces the value with id in bucket with value which has
+// the given name. updateNamed does nothing if there is no value with id
+// and returns errDuplicateName if another value in bucket already has
+// name.
+func updateNamed(
+	tx *bolt.Tx,
+	bucket []byte,
+	id int64,
+	name string,
+	value interface{}) error {
+	if getValue(tx, bucket, id) == nil {
+		return nil
+	}
+	taken, err := nameTaken(tx, bucket, name, id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errDuplicateName
+	}
+	return put(tx, bucket, id, value)
+}
+
+// nameTaken returns true if a value in bucket other than the one with
+// exceptId has a Name field equal to name.
+func nameTaken(
+	tx *bolt.Tx, bucket []byte, name string, exceptId int64) (
+	taken bool, err error) {
+	err = forEach(tx, bucket, func(id int64, value []byte) (bool, error) {
+		var named struct{ Name string }
+		if err := json.Unmarshal(value, &named); err != nil {
+			return false, err
+		}
+		taken = id != exceptId && named.Name == name
+		return !taken, nil
+	})
+	return
+}
+
+// get unmarshals the value with id in bucket into ptr. get returns
+// huedb.ErrNoSuchId if there is no such value.
+func get(tx *bolt.Tx, bucket []byte, id int64, ptr interface{}) error {
+	value := getValue(tx, bucket, id)
+	if value == nil {
+		return huedb.ErrNoSuchId
+	}
+	return json.Unmarshal(value, ptr)
+}
+
+// getValue returns the value with id in bucket or nil if there is no such
+// value.
+func getValue(tx *bolt.Tx, bucket []byte, id int64) []byte {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	return b.Get(idToKey(id))
+}
+
+// put stores value marshalled as JSON under id in bucket.
+func put(tx *bolt.Tx, bucket []byte, id int64, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return putValue(tx, bucket, id, encoded)
+}
+
+func putValue(tx *bolt.Tx, bucket []byte, id int64, value []byte) error {
+	b, err := tx.CreateBucketIfNotExists(bucket)
+	if err != nil {
+		return err
+	}
+	return b.Put(idToKey(id), value)
+}
+
+// add stores value marshalled as JSON in bucket under a new id and
+// returns that id.
+func add(tx *bolt.Tx, bucket []byte, value interface{}) (int64, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	return addValue(tx, bucket, encoded)
+}
+
+func addValue(tx *bolt.Tx, bucket []byte, value []byte) (int64, error) {
+	b, err := tx.CreateBucketIfNotExists(bucket)
+	if err != nil {
+		return 0, err
+	}
+	seq, err := b.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	if err := b.Put(idToKey(int64(seq)), value); err != nil {
+		return 0, err
+	}
+	return int64(seq), nil
+}
+
+func remove(tx *bolt.Tx, bucket []byte, id int64) error {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	return b.Delete(idToKey(id))
+}
+
+// removeIf removes each value in bucket for which shouldRemove returns
+// true.
+func removeIf(
+	tx *bolt.Tx,
+	bucket []byte,
+	shouldRemove func(value []byte) (bool, error)) error {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	var toBeRemoved [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		ok, err := shouldRemove(v)
+		if ok {
+			toBeRemoved = append(toBeRemoved, k)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range toBeRemoved {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEach calls f with the id and value of each value in bucket in id
+// order. forEach stops early when f returns false or an error.
+func forEach(
+	tx *bolt.Tx,
+	bucket []byte,
+	f func(id int64, value []byte) (bool, error)) error {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	cursor := b.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		if ok, err := f(keyToId(k), v); !ok || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachReversed works like forEach except that it goes in descending
+// id order.
+func forEachReversed(
+	tx *bolt.Tx,
+	bucket []byte,
+	f func(id int64, value []byte) (bool, error)) error {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	cursor := b.Cursor()
+	for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+		if ok, err := f(keyToId(k), v); !ok || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rawNamedColors is how ops.NamedColors is stored. The id is the key.
+type rawNamedColors struct {
+	Colors      string
+	Description string
+}
+
+func marshallNamedColors(namedColors *ops.NamedColors) ([]byte, error) {
+	colors, err := huedb.EncodeLightColors(namedColors.Colors)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&rawNamedColors{
+		Colors:      colors,
+		Description: namedColors.Description,
+	})
+}
+
+func unmarshallNamedColors(
+	id int64, value []byte, namedColors *ops.NamedColors) error {
+	var raw rawNamedColors
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return err
+	}
+	return raw.unmarshall(id, namedColors)
+}
+
+func (r *rawNamedColors) unmarshall(
+	id int64, namedColors *ops.NamedColors) error {
+	colors, err := huedb.DecodeLightColors(r.Colors)
+	if err != nil {
+		return err
+	}
+	namedColors.Id = id
+	namedColors.Colors = colors
+	namedColors.Description = r.Description
+	return nil
+}
+
+// rawRevision is how huedb.NamedColorsRevision is stored. The id of the
+// revision is the key.
+type rawRevision struct {
+	rawNamedColors
+	NamedColorsId int64
+	UpdatedAt     int64
+	Deleted       bool
+}
+
+func (r *rawRevision) unmarshall(
+	id int64, revision *huedb.NamedColorsRevision) error {
+	if err := r.rawNamedColors.unmarshall(
+		r.NamedColorsId, &revision.NamedColors); err != nil {
+		return err
+	}
+	revision.Id = id
+	revision.UpdatedAt = time.Unix(r.UpdatedAt, 0)
+	revision.Deleted = r.Deleted
+	return nil
+}
+
+// rawArchivedAtTimeTask is how huedb.ArchivedAtTimeTask is stored.
+type rawArchivedAtTimeTask struct {
+	huedb.EncodedAtTimeTask
+	Status      huedb.AtTimeTaskStatus
+	CompletedAt int64
+}
+
+// rawSensorEvent is how huedb.SensorEvent is stored.
+type rawSensorEvent struct {
+	SensorId int
+	Type     string
+	Value    string
+	Time     int64
+}
+
+// rawWeatherObservation is how huedb.WeatherObservation is stored.
+type rawWeatherObservation struct {
+	Station     string
+	Temperature float64
+	Weather     string
+	WindSpeed   float64
+	Time        int64
+}
+
+// preferenceKey returns the key of the preference with given key for
+// given user. Keys of the same user share a prefix and sort by key.
+func preferenceKey(userId int64, key string) []byte {
+	return append(idToKey(userId), key...)
+}
+
+// copyScheduleProfile returns a copy of profile with its scheduled task
+// ids sorted and without duplicates.
+func copyScheduleProfile(
+	profile *huedb.ScheduleProfile) huedb.ScheduleProfile {
+	result := *profile
+	result.ScheduledTaskIds = nil
+	for _, id := range sortIds(append([]int64(nil), profile.ScheduledTaskIds...)) {
+		count := len(result.ScheduledTaskIds)
+		if count == 0 || result.ScheduledTaskIds[count-1] != id {
+			result.ScheduledTaskIds = append(result.ScheduledTaskIds, id)
+		}
+	}
+	return result
+}
+
+func sortIds(ids []int64) []int64 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// idToKey converts an id to a key that sorts in id order.
+func idToKey(id int64) []byte {
+	result := make([]byte, 8)
+	binary.BigEndian.PutUint64(result, uint64(id))
+	return result
+}
+
+func keyToId(key []byte) int64 {
+	return int64(binary.BigEndian.Uint64(key))
+}
@@ -0,0 +1,102 @@
+package for_bolt_test
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/fixture"
+	"github.com/keep94/marvin/huedb/for_bolt"
+	"github.com/keep94/marvin/huedb/storetest"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNamedColorsById(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NamedColorsById(t, for_bolt.New(db))
+}
+
+func TestNamedColors(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NamedColors(t, for_bolt.New(db))
+}
+
+func TestUpdateNamedColors(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.UpdateNamedColors(t, for_bolt.New(db))
+}
+
+func TestRemoveNamedColors(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.RemoveNamedColors(t, for_bolt.New(db))
+}
+
+func TestRemoveExpired(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.RemoveExpired(t, for_bolt.New(db))
+}
+
+func TestUpdateEncodedAtTimeTaskTime(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.UpdateEncodedAtTimeTaskTime(t, for_bolt.New(db))
+}
+
+func TestClearEncodedAtTimeTasksKeepsIds(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := for_bolt.New(db)
+	first := &huedb.EncodedAtTimeTask{ScheduleId: "first", Time: 1000}
+	if err := store.AddEncodedAtTimeTask(nil, first); err != nil {
+		t.Fatalf("Error adding task: %v", err)
+	}
+	if err := store.ClearEncodedAtTimeTasks(nil); err != nil {
+		t.Fatalf("Error clearing tasks: %v", err)
+	}
+	second := &huedb.EncodedAtTimeTask{ScheduleId: "second", Time: 2000}
+	if err := store.AddEncodedAtTimeTask(nil, second); err != nil {
+		t.Fatalf("Error adding task: %v", err)
+	}
+	if second.Id <= first.Id {
+		t.Errorf("Expected id after %d, got %d", first.Id, second.Id)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.CancelledContext(t, for_bolt.New(db))
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (interface{}, func()) {
+		db := openDb(t)
+		return for_bolt.New(db), func() { closeDb(t, db) }
+	})
+}
+
+func closeDb(t *testing.T, db *bolt.DB) {
+	path := db.Path()
+	if err := db.Close(); err != nil {
+		t.Errorf("Error closing database: %v", err)
+	}
+	os.RemoveAll(filepath.Dir(path))
+}
+
+func openDb(t *testing.T) *bolt.DB {
+	dir, err := ioutil.TempDir("", "for_bolt")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "hue.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	return db
+}
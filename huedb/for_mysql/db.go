@@ -0,0 +1,142 @@
+// Package for_mysql provides a MySQL or MariaDB implementation of
+// interfaces in huedb package. Callers must register a MySQL driver such
+// as github.com/go-sql-driver/mysql with database/sql and use mysql_setup
+// to create the tables.
+package for_mysql
+
+import (
+	"database/sql"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/marvin/huedb/for_sql"
+)
+
+var (
+	kQueries = &for_sql.Queries{
+		NamedColorsById:          "select id, colors, description from named_colors where id = ?",
+		NamedColors:              "select id, colors, description from named_colors order by 1",
+		NamedColorsPage:          "select id, colors, description from named_colors order by 1 limit ? offset ?",
+		NamedColorsOrdered:       "select nc.id, nc.colors, nc.description from named_colors nc left join (select named_colors_id, max(id) as last_revision from named_colors_history group by named_colors_id) h on h.named_colors_id = nc.id order by %s",
+		NamedColorsCount:         "select count(*) from named_colors",
+		NamedColorsByIds:         "select id, colors, description from named_colors where id in (%s) order by 1",
+		NamedColorsByDescription: "select id, colors, description from named_colors where lower(description) like lower(?) escape '\\\\' order by 1",
+		AddNamedColors:           "insert into named_colors (colors, description) values (?, ?)",
+		UpdateNamedColors:        "update named_colors set colors = ?, description = ? where id = ?",
+		RemoveNamedColors:        "delete from named_colors where id = ?",
+
+		AddNamedColorsRevision:  "insert into named_colors_history (named_colors_id, colors, description, updated_at, deleted) select id, colors, description, ?, ? from named_colors where id = ?",
+		NamedColorsHistory:      "select id, named_colors_id, colors, description, updated_at, deleted from named_colors_history where named_colors_id = ? order by 1 desc",
+		DeletedNamedColors:      "select id, named_colors_id, colors, description, updated_at, deleted from named_colors_history where id in (select max(id) from named_colors_history group by named_colors_id) and deleted and named_colors_id not in (select id from named_colors) order by 1 desc",
+		NamedColorsRevisionById: "select id, named_colors_id, colors, description, updated_at, deleted from named_colors_history where id = ?",
+		AddNamedColorsWithId:    "insert into named_colors (colors, description, id) values (?, ?, ?)",
+
+		AddEncodedAtTimeTask:                "insert into at_time_tasks (schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		EncodedAtTimeTasks:                  "select id, schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence from at_time_tasks where group_id = ? order by 1",
+		RemoveEncodedAtTimeTaskByScheduleId: "delete from at_time_tasks where group_id = ? and schedule_id = ?",
+		ClearEncodedAtTimeTasks:             "delete from at_time_tasks",
+		RemoveExpiredEncodedAtTimeTasks:     "delete from at_time_tasks where time < ?",
+		UpdateEncodedAtTimeTaskTime:         "update at_time_tasks set schedule_id = ?, time = ? where group_id = ? and schedule_id = ?",
+
+		ArchiveEncodedAtTimeTask: "insert into at_time_tasks_archive (schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence, status, completed_at) select schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence, ?, ? from at_time_tasks where group_id = ? and schedule_id = ?",
+		ArchivedAtTimeTasks:      "select id, schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence, status, completed_at from at_time_tasks_archive where group_id = ? order by completed_at desc, id desc",
+
+		EncodedScheduledTaskById:   "select id, hue_task_id, action, description, light_set, recurrence, enabled, `high_priority` from scheduled_tasks where id = ?",
+		EncodedScheduledTasks:      "select id, hue_task_id, action, description, light_set, recurrence, enabled, `high_priority` from scheduled_tasks order by 1",
+		AddEncodedScheduledTask:    "insert into scheduled_tasks (hue_task_id, action, description, light_set, recurrence, enabled, `high_priority`) values (?, ?, ?, ?, ?, ?, ?)",
+		UpdateEncodedScheduledTask: "update scheduled_tasks set hue_task_id = ?, action = ?, description = ?, light_set = ?, recurrence = ?, enabled = ?, `high_priority` = ? where id = ?",
+		RemoveEncodedScheduledTask: "delete from scheduled_tasks where id = ?",
+
+		UserById:   "select id, name, password, role from users where id = ?",
+		UserByName: "select id, name, password, role from users where name = ?",
+		Users:      "select id, name, password, role from users order by name",
+		AddUser:    "insert into users (name, password, role) values (?, ?, ?)",
+		UpdateUser: "update users set name = ?, password = ?, role = ? where id = ?",
+		RemoveUser: "delete from users where id = ?",
+
+		LightAliases:     "select id, light_id, name from light_aliases order by name",
+		AddLightAlias:    "insert into light_aliases (light_id, name) values (?, ?)",
+		UpdateLightAlias: "update light_aliases set light_id = ?, name = ? where id = ?",
+		RemoveLightAlias: "delete from light_aliases where id = ?",
+		LightGroups:      "select id, name, light_set from light_groups order by name",
+		AddLightGroup:    "insert into light_groups (name, light_set) values (?, ?)",
+		UpdateLightGroup: "update light_groups set name = ?, light_set = ? where id = ?",
+		RemoveLightGroup: "delete from light_groups where id = ?",
+
+		SceneComponents:      "select id, named_colors_id, component_id, light_set, light_offset from scene_components where named_colors_id = ? order by 1",
+		AddSceneComponent:    "insert into scene_components (named_colors_id, component_id, light_set, light_offset) values (?, ?, ?, ?)",
+		RemoveSceneComponent: "delete from scene_components where id = ?",
+
+		BridgeById:   "select id, name, host, user from bridges where id = ?",
+		Bridges:      "select id, name, host, user from bridges order by name",
+		AddBridge:    "insert into bridges (name, host, user) values (?, ?, ?)",
+		UpdateBridge: "update bridges set name = ?, host = ?, user = ? where id = ?",
+		RemoveBridge: "delete from bridges where id = ?",
+
+		WeatherSettings:       "select id, provider, station_id, api_key, poll_interval, units from weather_settings order by 1",
+		AddWeatherSettings:    "insert into weather_settings (provider, station_id, api_key, poll_interval, units) values (?, ?, ?, ?, ?)",
+		UpdateWeatherSettings: "update weather_settings set provider = ?, station_id = ?, api_key = ?, poll_interval = ?, units = ? where id = ?",
+		RemoveWeatherSettings: "delete from weather_settings where id = ?",
+
+		DescriptionOverrides:      "select hue_task_id, description from description_overrides order by hue_task_id",
+		SetDescriptionOverride:    "replace into description_overrides (hue_task_id, description) values (?, ?)",
+		RemoveDescriptionOverride: "delete from description_overrides where hue_task_id = ?",
+
+		LastLightColors:      "select light_id, colors from last_light_colors",
+		SetLastLightColors:   "replace into last_light_colors (light_id, colors) values (?, ?)",
+		ClearLastLightColors: "delete from last_light_colors",
+
+		ScheduleProfileById:     "select id, name, scheduled_task_ids, active from schedule_profiles where id = ?",
+		ScheduleProfiles:        "select id, name, scheduled_task_ids, active from schedule_profiles order by name",
+		AddScheduleProfile:      "insert into schedule_profiles (name, scheduled_task_ids, active) values (?, ?, false)",
+		UpdateScheduleProfile:   "update schedule_profiles set name = ?, scheduled_task_ids = ? where id = ?",
+		RemoveScheduleProfile:   "delete from schedule_profiles where id = ?",
+		ActivateScheduleProfile: "update schedule_profiles set active = (id = ?)",
+
+		SearchNamedColors:    "select id, description from named_colors order by 1",
+		SearchScheduledTasks: "select id, description from scheduled_tasks order by 1",
+		SearchAtTimeTasks:    "select id, description from at_time_tasks order by 1",
+
+		AddSensorEvent:   "insert into sensor_events (sensor_id, type, value, time) values (?, ?, ?, ?)",
+		SensorEvents:     "select id, sensor_id, type, value, time from sensor_events where time >= ? and time < ? order by time, id",
+		TrimSensorEvents: "delete from sensor_events where time < ?",
+
+		AddWeatherObservation:   "insert into weather_observations (station, temperature, weather, wind_speed, time) values (?, ?, ?, ?, ?)",
+		WeatherObservations:     "select id, station, temperature, weather, wind_speed, time from weather_observations where time >= ? and time < ? order by time, id",
+		TrimWeatherObservations: "delete from weather_observations where time < ?",
+
+		Preference:       "select user_id, `key`, value from preferences where user_id = ? and `key` = ?",
+		Preferences:      "select user_id, `key`, value from preferences where user_id = ? order by `key`",
+		SetPreference:    "replace into preferences (user_id, `key`, value) values (?, ?, ?)",
+		RemovePreference: "delete from preferences where user_id = ? and `key` = ?",
+
+		Placeholder: func(n int) string {
+			return "?"
+		},
+
+		QuoteName: func(name string) string {
+			return "`" + name + "`"
+		},
+	}
+)
+
+// Store implements the huedb interfaces. A non-nil db.Transaction passed
+// to a Store method must be a *sql.Tx from the same database.
+type Store struct {
+	for_sql.Store
+}
+
+// New returns a Store backed by db.
+func New(db *sql.DB) Store {
+	return Store{for_sql.New(db, kQueries)}
+}
+
+// NewWithReader returns a Store that writes with db and reads with
+// reader.
+func NewWithReader(db, reader *sql.DB) Store {
+	return Store{for_sql.NewWithReader(db, reader, kQueries)}
+}
+
+// NewDoer returns a db.Doer that runs actions within a single
+// transaction of db.
+func NewDoer(db *sql.DB) db.Doer {
+	return for_sql.NewDoer(db)
+}
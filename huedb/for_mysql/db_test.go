@@ -0,0 +1,141 @@
+package for_mysql_test
+
+import (
+	"database/sql"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/keep94/marvin/huedb/fixture"
+	"github.com/keep94/marvin/huedb/for_mysql"
+	"github.com/keep94/marvin/huedb/mysql_setup"
+	"github.com/keep94/marvin/huedb/storetest"
+	"os"
+	"testing"
+)
+
+// These tests run only if the MARVIN_MYSQL_DSN environment variable holds
+// the data source name of a scratch MySQL or MariaDB database. To run
+// them against a throwaway server:
+//
+//	docker run -d -p 3306:3306 -e MARIADB_ROOT_PASSWORD=secret \
+//	    -e MARIADB_DATABASE=marvin_test mariadb
+//	MARVIN_MYSQL_DSN='root:secret@tcp(localhost:3306)/marvin_test' go test
+//
+// The tests drop and recreate the tables in that database.
+const kMysqlDsnEnv = "MARVIN_MYSQL_DSN"
+
+var kTables = []string{
+	"named_colors",
+	"at_time_tasks",
+	"named_colors_history",
+	"scheduled_tasks",
+	"users",
+	"light_aliases",
+	"light_groups",
+	"scene_components",
+	"bridges",
+	"weather_settings",
+	"description_overrides",
+	"last_light_colors",
+	"at_time_tasks_archive",
+	"schedule_profiles",
+	"sensor_events",
+	"weather_observations",
+	"preferences",
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(kMysqlDsnEnv) == "" {
+		fmt.Fprintf(
+			os.Stderr,
+			"for_mysql: %s not set; MySQL store not tested\n",
+			kMysqlDsnEnv)
+	}
+	os.Exit(m.Run())
+}
+
+func TestNamedColorsById(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NamedColorsById(t, for_mysql.New(db))
+}
+
+func TestNamedColors(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NamedColors(t, for_mysql.New(db))
+}
+
+func TestUpdateNamedColors(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.UpdateNamedColors(t, for_mysql.New(db))
+}
+
+func TestRemoveNamedColors(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.RemoveNamedColors(t, for_mysql.New(db))
+}
+
+func TestRemoveExpired(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.RemoveExpired(t, for_mysql.New(db))
+}
+
+func TestUpdateEncodedAtTimeTaskTime(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.UpdateEncodedAtTimeTaskTime(t, for_mysql.New(db))
+}
+
+func TestEncodedAtTimeTasks(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.EncodedAtTimeTasks(t, for_mysql.New(db))
+}
+
+func TestClearEncodedAtTimeTasks(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.ClearEncodedAtTimeTasks(t, for_mysql.New(db))
+}
+
+func TestCancelledContext(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.CancelledContext(t, for_mysql.New(db))
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (interface{}, func()) {
+		db := openDb(t)
+		return for_mysql.New(db), func() { closeDb(t, db) }
+	})
+}
+
+func closeDb(t *testing.T, db *sql.DB) {
+	if err := db.Close(); err != nil {
+		t.Errorf("Error closing database: %v", err)
+	}
+}
+
+func openDb(t *testing.T) *sql.DB {
+	dsn := os.Getenv(kMysqlDsnEnv)
+	if dsn == "" {
+		t.Skipf("%s not set; MySQL store not tested", kMysqlDsnEnv)
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	for _, table := range kTables {
+		if _, err := db.Exec("drop table if exists " + table); err != nil {
+			t.Fatalf("Error dropping tables: %v", err)
+		}
+	}
+	if err := mysql_setup.SetUpTables(db); err != nil {
+		t.Fatalf("Error creating tables: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,147 @@
+// Package for_postgres provides a PostgreSQL implementation of interfaces
+// in huedb package. Callers must register a PostgreSQL driver such as
+// github.com/lib/pq with database/sql and use postgres_setup to create
+// the tables.
+package for_postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/marvin/huedb/for_sql"
+)
+
+var (
+	kQueries = &for_sql.Queries{
+		NamedColorsById:          "select id, colors, description from named_colors where id = $1",
+		NamedColors:              "select id, colors, description from named_colors order by 1",
+		NamedColorsPage:          "select id, colors, description from named_colors order by 1 limit $1 offset $2",
+		NamedColorsOrdered:       "select nc.id, nc.colors, nc.description from named_colors nc left join (select named_colors_id, max(id) as last_revision from named_colors_history group by named_colors_id) h on h.named_colors_id = nc.id order by %s",
+		NamedColorsCount:         "select count(*) from named_colors",
+		NamedColorsByIds:         "select id, colors, description from named_colors where id in (%s) order by 1",
+		NamedColorsByDescription: "select id, colors, description from named_colors where lower(description) like lower($1) escape '\\' order by 1",
+		AddNamedColors:           "insert into named_colors (colors, description) values ($1, $2) returning id",
+		UpdateNamedColors:        "update named_colors set colors = $1, description = $2 where id = $3",
+		RemoveNamedColors:        "delete from named_colors where id = $1",
+
+		AddNamedColorsRevision:  "insert into named_colors_history (named_colors_id, colors, description, updated_at, deleted) select id, colors, description, $1::bigint, $2::boolean from named_colors where id = $3",
+		NamedColorsHistory:      "select id, named_colors_id, colors, description, updated_at, deleted from named_colors_history where named_colors_id = $1 order by 1 desc",
+		DeletedNamedColors:      "select id, named_colors_id, colors, description, updated_at, deleted from named_colors_history where id in (select max(id) from named_colors_history group by named_colors_id) and deleted and named_colors_id not in (select id from named_colors) order by 1 desc",
+		NamedColorsRevisionById: "select id, named_colors_id, colors, description, updated_at, deleted from named_colors_history where id = $1",
+		AddNamedColorsWithId:    "insert into named_colors (colors, description, id) values ($1, $2, $3)",
+
+		AddEncodedAtTimeTask:                "insert into at_time_tasks (schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence) values ($1, $2, $3, $4, $5, $6, $7, $8) returning id",
+		EncodedAtTimeTasks:                  "select id, schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence from at_time_tasks where group_id = $1 order by 1",
+		RemoveEncodedAtTimeTaskByScheduleId: "delete from at_time_tasks where group_id = $1 and schedule_id = $2",
+		ClearEncodedAtTimeTasks:             "delete from at_time_tasks",
+		RemoveExpiredEncodedAtTimeTasks:     "delete from at_time_tasks where time < $1",
+		UpdateEncodedAtTimeTaskTime:         "update at_time_tasks set schedule_id = $1, time = $2 where group_id = $3 and schedule_id = $4",
+
+		ArchiveEncodedAtTimeTask: "insert into at_time_tasks_archive (schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence, status, completed_at) select schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence, $1::integer, $2::bigint from at_time_tasks where group_id = $3 and schedule_id = $4",
+		ArchivedAtTimeTasks:      "select id, schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence, status, completed_at from at_time_tasks_archive where group_id = $1 order by completed_at desc, id desc",
+
+		EncodedScheduledTaskById:   "select id, hue_task_id, action, description, light_set, recurrence, enabled, high_priority from scheduled_tasks where id = $1",
+		EncodedScheduledTasks:      "select id, hue_task_id, action, description, light_set, recurrence, enabled, high_priority from scheduled_tasks order by 1",
+		AddEncodedScheduledTask:    "insert into scheduled_tasks (hue_task_id, action, description, light_set, recurrence, enabled, high_priority) values ($1, $2, $3, $4, $5, $6, $7) returning id",
+		UpdateEncodedScheduledTask: "update scheduled_tasks set hue_task_id = $1, action = $2, description = $3, light_set = $4, recurrence = $5, enabled = $6, high_priority = $7 where id = $8",
+		RemoveEncodedScheduledTask: "delete from scheduled_tasks where id = $1",
+
+		UserById:   "select id, name, password, role from users where id = $1",
+		UserByName: "select id, name, password, role from users where name = $1",
+		Users:      "select id, name, password, role from users order by name collate \"C\"",
+		AddUser:    "insert into users (name, password, role) values ($1, $2, $3) returning id",
+		UpdateUser: "update users set name = $1, password = $2, role = $3 where id = $4",
+		RemoveUser: "delete from users where id = $1",
+
+		LightAliases:     "select id, light_id, name from light_aliases order by name collate \"C\"",
+		AddLightAlias:    "insert into light_aliases (light_id, name) values ($1, $2) returning id",
+		UpdateLightAlias: "update light_aliases set light_id = $1, name = $2 where id = $3",
+		RemoveLightAlias: "delete from light_aliases where id = $1",
+		LightGroups:      "select id, name, light_set from light_groups order by name collate \"C\"",
+		AddLightGroup:    "insert into light_groups (name, light_set) values ($1, $2) returning id",
+		UpdateLightGroup: "update light_groups set name = $1, light_set = $2 where id = $3",
+		RemoveLightGroup: "delete from light_groups where id = $1",
+
+		SceneComponents:      "select id, named_colors_id, component_id, light_set, light_offset from scene_components where named_colors_id = $1 order by 1",
+		AddSceneComponent:    "insert into scene_components (named_colors_id, component_id, light_set, light_offset) values ($1, $2, $3, $4) returning id",
+		RemoveSceneComponent: "delete from scene_components where id = $1",
+
+		BridgeById:   "select id, name, host, \"user\" from bridges where id = $1",
+		Bridges:      "select id, name, host, \"user\" from bridges order by name collate \"C\"",
+		AddBridge:    "insert into bridges (name, host, \"user\") values ($1, $2, $3) returning id",
+		UpdateBridge: "update bridges set name = $1, host = $2, \"user\" = $3 where id = $4",
+		RemoveBridge: "delete from bridges where id = $1",
+
+		WeatherSettings:       "select id, provider, station_id, api_key, poll_interval, units from weather_settings order by 1",
+		AddWeatherSettings:    "insert into weather_settings (provider, station_id, api_key, poll_interval, units) values ($1, $2, $3, $4, $5) returning id",
+		UpdateWeatherSettings: "update weather_settings set provider = $1, station_id = $2, api_key = $3, poll_interval = $4, units = $5 where id = $6",
+		RemoveWeatherSettings: "delete from weather_settings where id = $1",
+
+		DescriptionOverrides:      "select hue_task_id, description from description_overrides order by hue_task_id",
+		SetDescriptionOverride:    "insert into description_overrides (hue_task_id, description) values ($1, $2) on conflict (hue_task_id) do update set description = excluded.description",
+		RemoveDescriptionOverride: "delete from description_overrides where hue_task_id = $1",
+
+		LastLightColors:      "select light_id, colors from last_light_colors",
+		SetLastLightColors:   "insert into last_light_colors (light_id, colors) values ($1, $2) on conflict (light_id) do update set colors = excluded.colors",
+		ClearLastLightColors: "delete from last_light_colors",
+
+		ScheduleProfileById:     "select id, name, scheduled_task_ids, active from schedule_profiles where id = $1",
+		ScheduleProfiles:        "select id, name, scheduled_task_ids, active from schedule_profiles order by name collate \"C\"",
+		AddScheduleProfile:      "insert into schedule_profiles (name, scheduled_task_ids, active) values ($1, $2, false) returning id",
+		UpdateScheduleProfile:   "update schedule_profiles set name = $1, scheduled_task_ids = $2 where id = $3",
+		RemoveScheduleProfile:   "delete from schedule_profiles where id = $1",
+		ActivateScheduleProfile: "update schedule_profiles set active = (id = $1)",
+
+		SearchNamedColors:    "select id, description from named_colors order by 1",
+		SearchScheduledTasks: "select id, description from scheduled_tasks order by 1",
+		SearchAtTimeTasks:    "select id, description from at_time_tasks order by 1",
+
+		AddSensorEvent:   "insert into sensor_events (sensor_id, type, value, time) values ($1, $2, $3, $4) returning id",
+		SensorEvents:     "select id, sensor_id, type, value, time from sensor_events where time >= $1 and time < $2 order by time, id",
+		TrimSensorEvents: "delete from sensor_events where time < $1",
+
+		AddWeatherObservation:   "insert into weather_observations (station, temperature, weather, wind_speed, time) values ($1, $2, $3, $4, $5) returning id",
+		WeatherObservations:     "select id, station, temperature, weather, wind_speed, time from weather_observations where time >= $1 and time < $2 order by time, id",
+		TrimWeatherObservations: "delete from weather_observations where time < $1",
+
+		Preference:       "select user_id, key, value from preferences where user_id = $1 and key = $2",
+		Preferences:      "select user_id, key, value from preferences where user_id = $1 order by key collate \"C\"",
+		SetPreference:    "insert into preferences (user_id, key, value) values ($1, $2, $3) on conflict (user_id, key) do update set value = excluded.value",
+		RemovePreference: "delete from preferences where user_id = $1 and key = $2",
+
+		Placeholder: func(n int) string {
+			return fmt.Sprintf("$%d", n)
+		},
+
+		AddReturnsId: true,
+
+		QuoteName: func(name string) string {
+			return `"` + name + `"`
+		},
+
+		ResetId: "select setval(pg_get_serial_sequence('%[1]s', 'id'), coalesce(max(id), 0) + 1, false) from %[1]s",
+	}
+)
+
+// Store implements the huedb interfaces. A non-nil db.Transaction passed
+// to a Store method must be a *sql.Tx from the same database.
+type Store struct {
+	for_sql.Store
+}
+
+// New returns a Store backed by db.
+func New(db *sql.DB) Store {
+	return Store{for_sql.New(db, kQueries)}
+}
+
+// NewWithReader returns a Store that writes with db and reads with
+// reader.
+func NewWithReader(db, reader *sql.DB) Store {
+	return Store{for_sql.NewWithReader(db, reader, kQueries)}
+}
+
+// NewDoer returns a db.Doer that runs actions within a single
+// transaction of db.
+func NewDoer(db *sql.DB) db.Doer {
+	return for_sql.NewDoer(db)
+}
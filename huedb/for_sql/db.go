@@ -0,0 +1,1711 @@
+// Package for_sql provides a database/sql implementation of interfaces in
+// huedb package. Packages for specific databases such as for_postgres and
+// for_mysql supply the SQL for their database.
+package for_sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/appcommon/passwords"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/ops"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Keeps the number of parameters in a statement well under what
+	// databases allow.
+	kMaxIdsPerQuery = 500
+)
+
+const (
+	kBackupVersion = 1
+)
+
+var (
+	kLikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+)
+
+var (
+	errBadBackup = errors.New("for_sql: Unsupported backup format.")
+)
+
+// kBackupTables lists the tables that Backup copies in the order that
+// Restore fills them.
+var kBackupTables = []backupTableInfo{
+	{"named_colors", true},
+	{"named_colors_history", true},
+	{"at_time_tasks", true},
+	{"at_time_tasks_archive", true},
+	{"scheduled_tasks", true},
+	{"users", true},
+	{"light_aliases", true},
+	{"light_groups", true},
+	{"scene_components", true},
+	{"bridges", true},
+	{"weather_settings", true},
+	{"description_overrides", false},
+	{"last_light_colors", false},
+	{"schedule_profiles", true},
+	{"sensor_events", true},
+	{"weather_observations", true},
+	{"preferences", false},
+}
+
+// Queries contains the SQL statements that Store uses. Statements take
+// their parameters in the same order as the sqlite statements in
+// for_sqlite.
+type Queries struct {
+	NamedColorsById string
+	NamedColors     string
+
+	// NamedColorsPage takes the limit and then the offset.
+	NamedColorsPage string
+
+	// NamedColorsOrdered selects from named_colors as nc left joined with
+	// the largest revision id of each named colors as h.last_revision. It
+	// contains %s for the order by clause.
+	NamedColorsOrdered string
+
+	NamedColorsCount string
+
+	// NamedColorsByIds contains %s for a comma separated list of
+	// placeholders.
+	NamedColorsByIds string
+
+	// NamedColorsByDescription takes a LIKE pattern that uses backslash
+	// as the escape character. It must match without regard to case.
+	NamedColorsByDescription string
+
+	AddNamedColors    string
+	UpdateNamedColors string
+	RemoveNamedColors string
+
+	AddNamedColorsRevision  string
+	NamedColorsHistory      string
+	DeletedNamedColors      string
+	NamedColorsRevisionById string
+	AddNamedColorsWithId    string
+
+	AddEncodedAtTimeTask                string
+	EncodedAtTimeTasks                  string
+	RemoveEncodedAtTimeTaskByScheduleId string
+	ClearEncodedAtTimeTasks             string
+	RemoveExpiredEncodedAtTimeTasks     string
+	UpdateEncodedAtTimeTaskTime         string
+
+	ArchiveEncodedAtTimeTask string
+	ArchivedAtTimeTasks      string
+
+	EncodedScheduledTaskById   string
+	EncodedScheduledTasks      string
+	AddEncodedScheduledTask    string
+	UpdateEncodedScheduledTask string
+	RemoveEncodedScheduledTask string
+
+	UserById   string
+	UserByName string
+	Users      string
+	AddUser    string
+	UpdateUser string
+	RemoveUser string
+
+	LightAliases     string
+	AddLightAlias    string
+	UpdateLightAlias string
+	RemoveLightAlias string
+	LightGroups      string
+	AddLightGroup    string
+	UpdateLightGroup string
+	RemoveLightGroup string
+
+	SceneComponents      string
+	AddSceneComponent    string
+	RemoveSceneComponent string
+
+	BridgeById   string
+	Bridges      string
+	AddBridge    string
+	UpdateBridge string
+	RemoveBridge string
+
+	WeatherSettings       string
+	AddWeatherSettings    string
+	UpdateWeatherSettings string
+	RemoveWeatherSettings string
+
+	DescriptionOverrides string
+
+	// SetDescriptionOverride adds the override or replaces the existing
+	// one for the same hue task.
+	SetDescriptionOverride    string
+	RemoveDescriptionOverride string
+
+	LastLightColors string
+
+	// SetLastLightColors adds the colors or replaces the existing ones
+	// for the same light.
+	SetLastLightColors   string
+	ClearLastLightColors string
+
+	ScheduleProfileById     string
+	ScheduleProfiles        string
+	AddScheduleProfile      string
+	UpdateScheduleProfile   string
+	RemoveScheduleProfile   string
+	ActivateScheduleProfile string
+
+	// The search statements select the id and description of every row
+	// in id order.
+	SearchNamedColors    string
+	SearchScheduledTasks string
+	SearchAtTimeTasks    string
+
+	AddSensorEvent   string
+	SensorEvents     string
+	TrimSensorEvents string
+
+	AddWeatherObservation   string
+	WeatherObservations     string
+	TrimWeatherObservations string
+
+	Preference  string
+	Preferences string
+
+	// SetPreference adds the preference or replaces the existing one with
+	// the same user and key.
+	SetPreference    string
+	RemovePreference string
+
+	// Placeholder returns the placeholder for the nth parameter of a
+	// statement. n starts at 1.
+	Placeholder func(n int) string
+
+	// If true, the add statements return the new id as a single row e.g
+	// with "returning id." If false, Store gets the new id from
+	// sql.Result.LastInsertId.
+	AddReturnsId bool
+
+	// QuoteName quotes a table or column name.
+	QuoteName func(name string) string
+
+	// ResetId makes the next id that the table %s assigns greater than
+	// every id in it. Restore runs it after filling each table with an
+	// id column. Empty means the database does this on its own.
+	ResetId string
+}
+
+// Store implements the huedb interfaces. A non-nil db.Transaction passed
+// to a Store method must be a *sql.Tx from the same database.
+type Store struct {
+	db      *sql.DB
+	readDb  *sql.DB
+	queries *Queries
+	ctx     context.Context
+}
+
+// New returns a Store backed by db that uses queries.
+func New(db *sql.DB, queries *Queries) Store {
+	return Store{db: db, queries: queries}
+}
+
+// NewWithReader returns a Store that uses queries to write with db and
+// read with reader. reader is typically a connection pool to a read
+// replica or a pool reserved for reads. Calls with a non-nil transaction
+// use that transaction for both reads and writes.
+func NewWithReader(db, reader *sql.DB, queries *Queries) Store {
+	return Store{db: db, readDb: reader, queries: queries}
+}
+
+// WithContext returns a Store like s that passes ctx to each statement
+// and transaction so that the database gives up once ctx is done.
+func (s Store) WithContext(ctx context.Context) huedb.Store {
+	s.ctx = ctx
+	return s
+}
+
+// NewDoer returns a db.Doer that runs actions within a single
+// transaction of db. The Transaction passed to each action is a *sql.Tx.
+func NewDoer(db *sql.DB) db.Doer {
+	return doer{db}
+}
+
+func (s Store) NamedColorsById(
+	t db.Transaction, id int64, namedColors *ops.NamedColors) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readSingle(
+			s.context(), tx, namedColors, scanNamedColors, s.queries.NamedColorsById, id)
+	})
+}
+
+func (s Store) NamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(), tx, consumer, scanNamedColors, s.queries.NamedColors)
+	})
+}
+
+func (s Store) NamedColorsPage(
+	t db.Transaction, offset, limit int, consumer goconsume.Consumer) error {
+	if offset < 0 {
+		offset = 0
+	}
+	var sqlLimit int64 = math.MaxInt64
+	if limit >= 0 {
+		sqlLimit = int64(limit)
+	}
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanNamedColors,
+			s.queries.NamedColorsPage,
+			sqlLimit,
+			offset)
+	})
+}
+
+func (s Store) NamedColorsOrdered(
+	t db.Transaction,
+	order huedb.NamedColorsOrder,
+	consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanNamedColors,
+			fmt.Sprintf(s.queries.NamedColorsOrdered, orderByClause(order)))
+	})
+}
+
+func (s Store) NamedColorsByIds(
+	t db.Transaction, ids []int64, consumer goconsume.Consumer) error {
+	ids = sortedUniqueIds(ids)
+	return s.read(t, func(tx *sql.Tx) error {
+		for len(ids) > 0 {
+			chunk := ids
+			if len(chunk) > kMaxIdsPerQuery {
+				chunk = chunk[:kMaxIdsPerQuery]
+			}
+			ids = ids[len(chunk):]
+			args := make([]interface{}, len(chunk))
+			placeholders := make([]string, len(chunk))
+			for i := range chunk {
+				args[i] = chunk[i]
+				placeholders[i] = s.queries.Placeholder(i + 1)
+			}
+			if err := readMultiple(
+				s.context(),
+				tx,
+				consumer,
+				scanNamedColors,
+				fmt.Sprintf(
+					s.queries.NamedColorsByIds,
+					strings.Join(placeholders, ", ")),
+				args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) NamedColorsCount(t db.Transaction) (count int, err error) {
+	err = s.read(t, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(s.context(), s.queries.NamedColorsCount).Scan(&count)
+	})
+	return
+}
+
+func (s Store) NamedColorsByDescription(
+	t db.Transaction, pattern string, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanNamedColors,
+			s.queries.NamedColorsByDescription,
+			"%"+kLikeEscaper.Replace(pattern)+"%")
+	})
+}
+
+func (s Store) AddNamedColors(
+	t db.Transaction, namedColors *ops.NamedColors) error {
+	colors, err := huedb.EncodeLightColors(namedColors.Colors)
+	if err != nil {
+		return err
+	}
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&namedColors.Id,
+			s.queries.AddNamedColors,
+			colors,
+			namedColors.Description)
+	})
+}
+
+func (s Store) AddNamedColorsBatch(
+	t db.Transaction, batch []*ops.NamedColors) error {
+	encoded := make([]string, len(batch))
+	for i, namedColors := range batch {
+		var err error
+		if encoded[i], err = huedb.EncodeLightColors(
+			namedColors.Colors); err != nil {
+			return err
+		}
+	}
+	return s.do(t, func(tx *sql.Tx) error {
+		for i, namedColors := range batch {
+			if err := s.add(
+				tx,
+				&namedColors.Id,
+				s.queries.AddNamedColors,
+				encoded[i],
+				namedColors.Description); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateLightColors does nothing because Store has always encoded colors
+// in the current format.
+func (s Store) MigrateLightColors(t db.Transaction) error {
+	return nil
+}
+
+func (s Store) UpdateNamedColors(
+	t db.Transaction, namedColors *ops.NamedColors) error {
+	colors, err := huedb.EncodeLightColors(namedColors.Colors)
+	if err != nil {
+		return err
+	}
+	return s.do(t, func(tx *sql.Tx) error {
+		if err := s.addNamedColorsRevision(
+			tx, namedColors.Id, false); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(
+			s.context(), s.queries.UpdateNamedColors,
+			colors,
+			namedColors.Description,
+			namedColors.Id)
+		return err
+	})
+}
+
+func (s Store) RemoveNamedColors(t db.Transaction, id int64) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		if err := s.addNamedColorsRevision(tx, id, true); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(s.context(), s.queries.RemoveNamedColors, id)
+		return err
+	})
+}
+
+func (s Store) NamedColorsHistory(
+	t db.Transaction, id int64, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanNamedColorsRevision,
+			s.queries.NamedColorsHistory,
+			id)
+	})
+}
+
+func (s Store) DeletedNamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanNamedColorsRevision,
+			s.queries.DeletedNamedColors)
+	})
+}
+
+func (s Store) RestoreNamedColors(t db.Transaction, revisionId int64) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		var revision huedb.NamedColorsRevision
+		if err := readSingle(
+			s.context(),
+			tx,
+			&revision,
+			scanNamedColorsRevision,
+			s.queries.NamedColorsRevisionById,
+			revisionId); err != nil {
+			return err
+		}
+		colors, err := huedb.EncodeLightColors(revision.Colors)
+		if err != nil {
+			return err
+		}
+		var existing ops.NamedColors
+		err = s.NamedColorsById(tx, revision.NamedColors.Id, &existing)
+		if err == huedb.ErrNoSuchId {
+			_, err := tx.ExecContext(
+				s.context(), s.queries.AddNamedColorsWithId,
+				colors,
+				revision.Description,
+				revision.NamedColors.Id)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.addNamedColorsRevision(
+			tx, revision.NamedColors.Id, false); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(
+			s.context(), s.queries.UpdateNamedColors,
+			colors,
+			revision.Description,
+			revision.NamedColors.Id)
+		return err
+	})
+}
+
+func (s Store) EncodedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanEncodedAtTimeTask,
+			s.queries.EncodedAtTimeTasks,
+			groupId)
+	})
+}
+
+func (s Store) AddEncodedAtTimeTask(
+	t db.Transaction, task *huedb.EncodedAtTimeTask) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&task.Id,
+			s.queries.AddEncodedAtTimeTask,
+			task.ScheduleId,
+			task.HueTaskId,
+			task.Action,
+			task.Description,
+			task.LightSet,
+			task.Time,
+			task.GroupId,
+			task.Recurrence)
+	})
+}
+
+func (s Store) RemoveEncodedAtTimeTaskByScheduleId(
+	t db.Transaction, groupId, scheduleId string) error {
+	return s.exec(
+		t, s.queries.RemoveEncodedAtTimeTaskByScheduleId, groupId, scheduleId)
+}
+
+func (s Store) ClearEncodedAtTimeTasks(t db.Transaction) error {
+	return s.exec(t, s.queries.ClearEncodedAtTimeTasks)
+}
+
+func (s Store) UpdateEncodedAtTimeTaskTime(
+	t db.Transaction,
+	groupId, scheduleId, newScheduleId string,
+	newTime time.Time) error {
+	return s.exec(
+		t,
+		s.queries.UpdateEncodedAtTimeTaskTime,
+		newScheduleId,
+		newTime.Unix(),
+		groupId,
+		scheduleId)
+}
+
+func (s Store) RemoveExpired(t db.Transaction, before time.Time) error {
+	return s.exec(t, s.queries.RemoveExpiredEncodedAtTimeTasks, before.Unix())
+}
+
+func (s Store) ArchiveEncodedAtTimeTask(
+	t db.Transaction,
+	groupId, scheduleId string,
+	status huedb.AtTimeTaskStatus,
+	completedAt time.Time) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(
+			s.context(), s.queries.ArchiveEncodedAtTimeTask,
+			int(status),
+			completedAt.Unix(),
+			groupId,
+			scheduleId); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(
+			s.context(), s.queries.RemoveEncodedAtTimeTaskByScheduleId, groupId, scheduleId)
+		return err
+	})
+}
+
+func (s Store) ArchivedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanArchivedAtTimeTask,
+			s.queries.ArchivedAtTimeTasks,
+			groupId)
+	})
+}
+
+func (s Store) EncodedScheduledTaskById(
+	t db.Transaction, id int64, task *huedb.EncodedScheduledTask) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readSingle(
+			s.context(),
+			tx,
+			task,
+			scanEncodedScheduledTask,
+			s.queries.EncodedScheduledTaskById,
+			id)
+	})
+}
+
+func (s Store) EncodedScheduledTasks(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanEncodedScheduledTask,
+			s.queries.EncodedScheduledTasks)
+	})
+}
+
+func (s Store) AddEncodedScheduledTask(
+	t db.Transaction, task *huedb.EncodedScheduledTask) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&task.Id,
+			s.queries.AddEncodedScheduledTask,
+			task.HueTaskId,
+			task.Action,
+			task.Description,
+			task.LightSet,
+			task.Recurrence,
+			task.Enabled,
+			task.HighPriority)
+	})
+}
+
+func (s Store) UpdateEncodedScheduledTask(
+	t db.Transaction, task *huedb.EncodedScheduledTask) error {
+	return s.exec(
+		t,
+		s.queries.UpdateEncodedScheduledTask,
+		task.HueTaskId,
+		task.Action,
+		task.Description,
+		task.LightSet,
+		task.Recurrence,
+		task.Enabled,
+		task.HighPriority,
+		task.Id)
+}
+
+func (s Store) RemoveEncodedScheduledTask(t db.Transaction, id int64) error {
+	return s.exec(t, s.queries.RemoveEncodedScheduledTask, id)
+}
+
+func (s Store) UserById(
+	t db.Transaction, id int64, user *huedb.User) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readSingle(s.context(), tx, user, scanUser, s.queries.UserById, id)
+	})
+}
+
+func (s Store) UserByName(
+	t db.Transaction, name string, user *huedb.User) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readSingle(s.context(), tx, user, scanUser, s.queries.UserByName, name)
+	})
+}
+
+func (s Store) Users(t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(s.context(), tx, consumer, scanUser, s.queries.Users)
+	})
+}
+
+func (s Store) AddUser(t db.Transaction, user *huedb.User) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&user.Id,
+			s.queries.AddUser,
+			user.Name,
+			string(user.Password),
+			int(user.Role))
+	})
+}
+
+func (s Store) UpdateUser(t db.Transaction, user *huedb.User) error {
+	return s.exec(
+		t,
+		s.queries.UpdateUser,
+		user.Name,
+		string(user.Password),
+		int(user.Role),
+		user.Id)
+}
+
+func (s Store) RemoveUser(t db.Transaction, id int64) error {
+	return s.exec(t, s.queries.RemoveUser, id)
+}
+
+func (s Store) LightAliases(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(), tx, consumer, scanLightAlias, s.queries.LightAliases)
+	})
+}
+
+func (s Store) AddLightAlias(
+	t db.Transaction, alias *huedb.LightAlias) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&alias.Id,
+			s.queries.AddLightAlias,
+			alias.LightId,
+			alias.Name)
+	})
+}
+
+func (s Store) UpdateLightAlias(
+	t db.Transaction, alias *huedb.LightAlias) error {
+	return s.exec(
+		t, s.queries.UpdateLightAlias, alias.LightId, alias.Name, alias.Id)
+}
+
+func (s Store) RemoveLightAlias(t db.Transaction, id int64) error {
+	return s.exec(t, s.queries.RemoveLightAlias, id)
+}
+
+func (s Store) LightGroups(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(), tx, consumer, scanLightGroup, s.queries.LightGroups)
+	})
+}
+
+func (s Store) AddLightGroup(
+	t db.Transaction, group *huedb.LightGroup) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&group.Id,
+			s.queries.AddLightGroup,
+			group.Name,
+			group.LightSet)
+	})
+}
+
+func (s Store) UpdateLightGroup(
+	t db.Transaction, group *huedb.LightGroup) error {
+	return s.exec(
+		t, s.queries.UpdateLightGroup, group.Name, group.LightSet, group.Id)
+}
+
+func (s Store) RemoveLightGroup(t db.Transaction, id int64) error {
+	return s.exec(t, s.queries.RemoveLightGroup, id)
+}
+
+func (s Store) SceneComponents(
+	t db.Transaction,
+	namedColorsId int64,
+	consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanSceneComponent,
+			s.queries.SceneComponents,
+			namedColorsId)
+	})
+}
+
+func (s Store) AddSceneComponent(
+	t db.Transaction, component *huedb.SceneComponent) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&component.Id,
+			s.queries.AddSceneComponent,
+			component.NamedColorsId,
+			component.ComponentId,
+			component.LightSet,
+			component.LightOffset)
+	})
+}
+
+func (s Store) RemoveSceneComponent(t db.Transaction, id int64) error {
+	return s.exec(t, s.queries.RemoveSceneComponent, id)
+}
+
+func (s Store) BridgeById(
+	t db.Transaction, id int64, bridge *huedb.Bridge) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readSingle(s.context(), tx, bridge, scanBridge, s.queries.BridgeById, id)
+	})
+}
+
+func (s Store) Bridges(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(s.context(), tx, consumer, scanBridge, s.queries.Bridges)
+	})
+}
+
+func (s Store) AddBridge(t db.Transaction, bridge *huedb.Bridge) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&bridge.Id,
+			s.queries.AddBridge,
+			bridge.Name,
+			bridge.Host,
+			bridge.User)
+	})
+}
+
+func (s Store) UpdateBridge(t db.Transaction, bridge *huedb.Bridge) error {
+	return s.exec(
+		t,
+		s.queries.UpdateBridge,
+		bridge.Name,
+		bridge.Host,
+		bridge.User,
+		bridge.Id)
+}
+
+func (s Store) RemoveBridge(t db.Transaction, id int64) error {
+	return s.exec(t, s.queries.RemoveBridge, id)
+}
+
+func (s Store) WeatherSettings(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(), tx, consumer, scanWeatherSettings, s.queries.WeatherSettings)
+	})
+}
+
+func (s Store) AddWeatherSettings(
+	t db.Transaction, settings *huedb.WeatherSettings) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&settings.Id,
+			s.queries.AddWeatherSettings,
+			settings.Provider,
+			settings.StationId,
+			settings.APIKey,
+			int64(settings.PollInterval/time.Second),
+			settings.Units)
+	})
+}
+
+func (s Store) UpdateWeatherSettings(
+	t db.Transaction, settings *huedb.WeatherSettings) error {
+	return s.exec(
+		t,
+		s.queries.UpdateWeatherSettings,
+		settings.Provider,
+		settings.StationId,
+		settings.APIKey,
+		int64(settings.PollInterval/time.Second),
+		settings.Units,
+		settings.Id)
+}
+
+func (s Store) RemoveWeatherSettings(t db.Transaction, id int64) error {
+	return s.exec(t, s.queries.RemoveWeatherSettings, id)
+}
+
+func (s Store) DescriptionOverrides(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanDescriptionOverride,
+			s.queries.DescriptionOverrides)
+	})
+}
+
+func (s Store) SetDescriptionOverride(
+	t db.Transaction, override *huedb.DescriptionOverride) error {
+	return s.exec(
+		t,
+		s.queries.SetDescriptionOverride,
+		override.HueTaskId,
+		override.Description)
+}
+
+func (s Store) RemoveDescriptionOverride(
+	t db.Transaction, hueTaskId int) error {
+	return s.exec(t, s.queries.RemoveDescriptionOverride, hueTaskId)
+}
+
+func (s Store) LastLightColors(t db.Transaction) (
+	colors ops.LightColors, err error) {
+	err = s.read(t, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(s.context(), s.queries.LastLightColors)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		colors = make(ops.LightColors)
+		for rows.Next() {
+			var lightId int
+			var encoded string
+			if err := rows.Scan(&lightId, &encoded); err != nil {
+				return err
+			}
+			lightColors, err := huedb.DecodeLightColors(encoded)
+			if err != nil {
+				return err
+			}
+			colors[lightId] = lightColors[lightId]
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (s Store) SetLastLightColors(
+	t db.Transaction, colors ops.LightColors) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		if _, ok := colors[0]; ok {
+			if _, err := tx.ExecContext(
+				s.context(), s.queries.ClearLastLightColors); err != nil {
+				return err
+			}
+		}
+		for id, cb := range colors {
+			encoded, err := huedb.EncodeLightColors(ops.LightColors{id: cb})
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(
+				s.context(), s.queries.SetLastLightColors, id, encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) ScheduleProfileById(
+	t db.Transaction, id int64, profile *huedb.ScheduleProfile) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readSingle(
+			s.context(),
+			tx,
+			profile,
+			scanScheduleProfile,
+			s.queries.ScheduleProfileById,
+			id)
+	})
+}
+
+func (s Store) ScheduleProfiles(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(), tx, consumer, scanScheduleProfile, s.queries.ScheduleProfiles)
+	})
+}
+
+func (s Store) AddScheduleProfile(
+	t db.Transaction, profile *huedb.ScheduleProfile) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		if err := s.add(
+			tx,
+			&profile.Id,
+			s.queries.AddScheduleProfile,
+			profile.Name,
+			encodeIds(profile.ScheduledTaskIds)); err != nil {
+			return err
+		}
+		profile.Active = false
+		return nil
+	})
+}
+
+func (s Store) UpdateScheduleProfile(
+	t db.Transaction, profile *huedb.ScheduleProfile) error {
+	return s.exec(
+		t,
+		s.queries.UpdateScheduleProfile,
+		profile.Name,
+		encodeIds(profile.ScheduledTaskIds),
+		profile.Id)
+}
+
+func (s Store) RemoveScheduleProfile(t db.Transaction, id int64) error {
+	return s.exec(t, s.queries.RemoveScheduleProfile, id)
+}
+
+func (s Store) ActivateScheduleProfile(t db.Transaction, id int64) error {
+	return s.exec(t, s.queries.ActivateScheduleProfile, id)
+}
+
+// Search reads the description of every named colors, scheduled task, and
+// at time task and matches query against them.
+func (s Store) Search(
+	t db.Transaction, query string, consumer goconsume.Consumer) error {
+	words := huedb.SearchWords(query)
+	if len(words) == 0 {
+		return nil
+	}
+	consumer = goconsume.Filter(consumer, func(ptr interface{}) bool {
+		p := ptr.(*huedb.SearchResult)
+		return huedb.SearchMatches(p.Description, words)
+	})
+	return s.read(t, func(tx *sql.Tx) error {
+		for _, source := range []struct {
+			kind  string
+			query string
+		}{
+			{huedb.NamedColorsSearchResult, s.queries.SearchNamedColors},
+			{huedb.ScheduledTaskSearchResult, s.queries.SearchScheduledTasks},
+			{huedb.AtTimeTaskSearchResult, s.queries.SearchAtTimeTasks},
+		} {
+			kind := source.kind
+			if err := readMultiple(
+				s.context(),
+				tx,
+				consumer,
+				func(row scanner, result *huedb.SearchResult) error {
+					result.Kind = kind
+					return row.Scan(&result.Id, &result.Description)
+				},
+				source.query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) AddSensorEvent(
+	t db.Transaction, event *huedb.SensorEvent) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&event.Id,
+			s.queries.AddSensorEvent,
+			event.SensorId,
+			event.Type,
+			event.Value,
+			event.Time.Unix())
+	})
+}
+
+func (s Store) SensorEvents(
+	t db.Transaction,
+	start, end time.Time,
+	consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanSensorEvent,
+			s.queries.SensorEvents,
+			start.Unix(),
+			end.Unix())
+	})
+}
+
+func (s Store) TrimSensorEvents(t db.Transaction, before time.Time) error {
+	return s.exec(t, s.queries.TrimSensorEvents, before.Unix())
+}
+
+func (s Store) AddWeatherObservation(
+	t db.Transaction, observation *huedb.WeatherObservation) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		return s.add(
+			tx,
+			&observation.Id,
+			s.queries.AddWeatherObservation,
+			observation.Station,
+			observation.Temperature,
+			observation.Weather,
+			observation.WindSpeed,
+			observation.Time.Unix())
+	})
+}
+
+func (s Store) WeatherObservations(
+	t db.Transaction,
+	start, end time.Time,
+	consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(),
+			tx,
+			consumer,
+			scanWeatherObservation,
+			s.queries.WeatherObservations,
+			start.Unix(),
+			end.Unix())
+	})
+}
+
+func (s Store) TrimWeatherObservations(
+	t db.Transaction, before time.Time) error {
+	return s.exec(t, s.queries.TrimWeatherObservations, before.Unix())
+}
+
+func (s Store) Preference(
+	t db.Transaction, userId int64, key string, pref *huedb.Preference) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readSingle(
+			s.context(), tx, pref, scanPreference, s.queries.Preference, userId, key)
+	})
+}
+
+func (s Store) Preferences(
+	t db.Transaction, userId int64, consumer goconsume.Consumer) error {
+	return s.read(t, func(tx *sql.Tx) error {
+		return readMultiple(
+			s.context(), tx, consumer, scanPreference, s.queries.Preferences, userId)
+	})
+}
+
+func (s Store) SetPreference(t db.Transaction, pref *huedb.Preference) error {
+	return s.exec(
+		t, s.queries.SetPreference, pref.UserId, pref.Key, pref.Value)
+}
+
+func (s Store) RemovePreference(
+	t db.Transaction, userId int64, key string) error {
+	return s.exec(t, s.queries.RemovePreference, userId, key)
+}
+
+// Backup writes every row of every table to the file dest. Backup reads
+// all the tables in one repeatable read transaction so that it sees a
+// consistent database while other goroutines continue to use it.
+func (s Store) Backup(t db.Transaction, dest string) error {
+	result := backupFile{Version: kBackupVersion}
+	err := s.readSnapshot(t, func(tx *sql.Tx) error {
+		for _, info := range kBackupTables {
+			table, err := s.backupTable(tx, info.name)
+			if err != nil {
+				return err
+			}
+			result.Tables = append(result.Tables, table)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(&result); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Restore replaces the contents of every table with the contents of the
+// file src which Backup created. Rows keep their ids.
+func (s Store) Restore(t db.Transaction, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var backup backupFile
+	decoder := json.NewDecoder(f)
+	decoder.UseNumber()
+	if err := decoder.Decode(&backup); err != nil {
+		return err
+	}
+	if backup.Version != kBackupVersion {
+		return errBadBackup
+	}
+	return s.do(t, func(tx *sql.Tx) error {
+		for _, info := range kBackupTables {
+			if _, err := tx.ExecContext(
+				s.context(), "delete from "+s.queries.QuoteName(info.name)); err != nil {
+				return err
+			}
+		}
+		for i := range backup.Tables {
+			if err := s.restoreTable(tx, &backup.Tables[i]); err != nil {
+				return err
+			}
+		}
+		if s.queries.ResetId == "" {
+			return nil
+		}
+		for _, info := range kBackupTables {
+			if !info.hasId {
+				continue
+			}
+			if _, err := tx.ExecContext(
+				s.context(), fmt.Sprintf(s.queries.ResetId, info.name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// backupTable reads every row of the table name.
+func (s Store) backupTable(
+	tx *sql.Tx, name string) (result backupTable, err error) {
+	rows, err := tx.QueryContext(
+		s.context(), "select * from "+s.queries.QuoteName(name))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result.Name = name
+	if result.Columns, err = rows.Columns(); err != nil {
+		return
+	}
+	for rows.Next() {
+		row := make([]interface{}, len(result.Columns))
+		ptrs := make([]interface{}, len(row))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return
+		}
+		// Drivers return text columns as []byte which JSON would
+		// encode in base64.
+		for i := range row {
+			if b, ok := row[i].([]byte); ok {
+				row[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	err = rows.Err()
+	return
+}
+
+// restoreTable adds the rows of table to the database. restoreTable
+// returns errBadBackup if table names a table or column that Backup
+// does not write.
+func (s Store) restoreTable(tx *sql.Tx, table *backupTable) error {
+	if !isBackupTable(table.Name) {
+		return errBadBackup
+	}
+	columns, err := s.columns(tx, table.Name)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(table.Columns))
+	placeholders := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		if !columns[column] {
+			return errBadBackup
+		}
+		quoted[i] = s.queries.QuoteName(column)
+		placeholders[i] = s.queries.Placeholder(i + 1)
+	}
+	query := fmt.Sprintf(
+		"insert into %s (%s) values (%s)",
+		s.queries.QuoteName(table.Name),
+		strings.Join(quoted, ", "),
+		strings.Join(placeholders, ", "))
+	for _, row := range table.Rows {
+		if len(row) != len(table.Columns) {
+			return errBadBackup
+		}
+		if _, err := tx.ExecContext(s.context(), query, row...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columns returns the names of the columns of the table name.
+func (s Store) columns(tx *sql.Tx, name string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(
+		s.context(), "select * from "+s.queries.QuoteName(name)+" where 1 = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]bool, len(names))
+	for _, column := range names {
+		result[column] = true
+	}
+	return result, rows.Err()
+}
+
+func (s Store) addNamedColorsRevision(
+	tx *sql.Tx, id int64, deleted bool) error {
+	_, err := tx.ExecContext(
+		s.context(), s.queries.AddNamedColorsRevision, time.Now().Unix(), deleted, id)
+	return err
+}
+
+func (s Store) add(
+	tx *sql.Tx, id *int64, query string, args ...interface{}) error {
+	if s.queries.AddReturnsId {
+		return tx.QueryRowContext(s.context(), query, args...).Scan(id)
+	}
+	result, err := tx.ExecContext(s.context(), query, args...)
+	if err != nil {
+		return err
+	}
+	*id, err = result.LastInsertId()
+	return err
+}
+
+func (s Store) exec(
+	t db.Transaction, query string, args ...interface{}) error {
+	return s.do(t, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(s.context(), query, args...)
+		return err
+	})
+}
+
+func (s Store) do(t db.Transaction, f func(tx *sql.Tx) error) error {
+	return s.run(t, s.db, nil, f)
+}
+
+// read works like do except that it uses the reader database when
+// t is nil.
+func (s Store) read(t db.Transaction, f func(tx *sql.Tx) error) error {
+	return s.run(t, s.reader(), nil, f)
+}
+
+// readSnapshot works like read except that when t is nil, f runs in a
+// read only transaction that sees the database as it was when the
+// transaction started.
+func (s Store) readSnapshot(
+	t db.Transaction, f func(tx *sql.Tx) error) error {
+	return s.run(
+		t,
+		s.reader(),
+		&sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true},
+		f)
+}
+
+// run runs f with t or, if t is nil, within a new transaction of
+// database started with opts. If the context of s is done, run returns
+// ctx.Err() instead of whatever error the driver reported.
+func (s Store) run(
+	t db.Transaction,
+	database *sql.DB,
+	opts *sql.TxOptions,
+	f func(tx *sql.Tx) error) error {
+	var err error
+	if t != nil {
+		err = f(t.(*sql.Tx))
+	} else {
+		err = doInTransaction(s.context(), database, opts, f)
+	}
+	if err != nil && s.ctx != nil && s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	return err
+}
+
+func (s Store) reader() *sql.DB {
+	if s.readDb == nil {
+		return s.db
+	}
+	return s.readDb
+}
+
+func (s Store) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+type doer struct {
+	db *sql.DB
+}
+
+func (d doer) Do(action db.Action) error {
+	return doInTransaction(
+		context.Background(), d.db, nil, func(tx *sql.Tx) error {
+			return action(tx)
+		})
+}
+
+func doInTransaction(
+	ctx context.Context,
+	db *sql.DB,
+	opts *sql.TxOptions,
+	f func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// scanner is what *sql.Row and *sql.Rows have in common.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// readSingle reads the single row that query returns into value using
+// scan. readSingle returns huedb.ErrNoSuchId if query returns no rows.
+func readSingle[T any](
+	ctx context.Context,
+	tx *sql.Tx,
+	value *T,
+	scan func(row scanner, value *T) error,
+	query string,
+	args ...interface{}) error {
+	err := scan(tx.QueryRowContext(ctx, query, args...), value)
+	if err == sql.ErrNoRows {
+		return huedb.ErrNoSuchId
+	}
+	return err
+}
+
+// readMultiple reads each row that query returns into a new T using scan
+// and sends a pointer to it to consumer.
+func readMultiple[T any](
+	ctx context.Context,
+	tx *sql.Tx,
+	consumer goconsume.Consumer,
+	scan func(row scanner, value *T) error,
+	query string,
+	args ...interface{}) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for consumer.CanConsume() && rows.Next() {
+		var value T
+		if err := scan(rows, &value); err != nil {
+			return err
+		}
+		consumer.Consume(&value)
+	}
+	return rows.Err()
+}
+
+func scanNamedColors(row scanner, namedColors *ops.NamedColors) error {
+	var colors string
+	if err := row.Scan(
+		&namedColors.Id, &colors, &namedColors.Description); err != nil {
+		return err
+	}
+	var err error
+	namedColors.Colors, err = huedb.DecodeLightColors(colors)
+	return err
+}
+
+func scanNamedColorsRevision(
+	row scanner, revision *huedb.NamedColorsRevision) error {
+	var colors string
+	var updatedAt int64
+	if err := row.Scan(
+		&revision.Id,
+		&revision.NamedColors.Id,
+		&colors,
+		&revision.Description,
+		&updatedAt,
+		&revision.Deleted); err != nil {
+		return err
+	}
+	revision.UpdatedAt = time.Unix(updatedAt, 0)
+	var err error
+	revision.Colors, err = huedb.DecodeLightColors(colors)
+	return err
+}
+
+func scanEncodedAtTimeTask(row scanner, task *huedb.EncodedAtTimeTask) error {
+	return row.Scan(
+		&task.Id,
+		&task.ScheduleId,
+		&task.HueTaskId,
+		&task.Action,
+		&task.Description,
+		&task.LightSet,
+		&task.Time,
+		&task.GroupId,
+		&task.Recurrence)
+}
+
+func scanArchivedAtTimeTask(
+	row scanner, task *huedb.ArchivedAtTimeTask) error {
+	var status int
+	var completedAt int64
+	if err := row.Scan(
+		&task.Id,
+		&task.ScheduleId,
+		&task.HueTaskId,
+		&task.Action,
+		&task.Description,
+		&task.LightSet,
+		&task.Time,
+		&task.GroupId,
+		&task.Recurrence,
+		&status,
+		&completedAt); err != nil {
+		return err
+	}
+	task.Status = huedb.AtTimeTaskStatus(status)
+	task.CompletedAt = time.Unix(completedAt, 0)
+	return nil
+}
+
+func scanEncodedScheduledTask(
+	row scanner, task *huedb.EncodedScheduledTask) error {
+	return row.Scan(
+		&task.Id,
+		&task.HueTaskId,
+		&task.Action,
+		&task.Description,
+		&task.LightSet,
+		&task.Recurrence,
+		&task.Enabled,
+		&task.HighPriority)
+}
+
+func scanUser(row scanner, user *huedb.User) error {
+	var password string
+	var role int
+	if err := row.Scan(&user.Id, &user.Name, &password, &role); err != nil {
+		return err
+	}
+	user.Password = passwords.Password(password)
+	user.Role = huedb.Role(role)
+	return nil
+}
+
+func scanLightAlias(row scanner, alias *huedb.LightAlias) error {
+	return row.Scan(&alias.Id, &alias.LightId, &alias.Name)
+}
+
+func scanLightGroup(row scanner, group *huedb.LightGroup) error {
+	return row.Scan(&group.Id, &group.Name, &group.LightSet)
+}
+
+func scanSceneComponent(row scanner, component *huedb.SceneComponent) error {
+	return row.Scan(
+		&component.Id,
+		&component.NamedColorsId,
+		&component.ComponentId,
+		&component.LightSet,
+		&component.LightOffset)
+}
+
+func scanBridge(row scanner, bridge *huedb.Bridge) error {
+	return row.Scan(&bridge.Id, &bridge.Name, &bridge.Host, &bridge.User)
+}
+
+func scanWeatherSettings(
+	row scanner, settings *huedb.WeatherSettings) error {
+	var pollInterval int64
+	if err := row.Scan(
+		&settings.Id,
+		&settings.Provider,
+		&settings.StationId,
+		&settings.APIKey,
+		&pollInterval,
+		&settings.Units); err != nil {
+		return err
+	}
+	settings.PollInterval = time.Duration(pollInterval) * time.Second
+	return nil
+}
+
+func scanDescriptionOverride(
+	row scanner, override *huedb.DescriptionOverride) error {
+	return row.Scan(&override.HueTaskId, &override.Description)
+}
+
+func scanScheduleProfile(row scanner, profile *huedb.ScheduleProfile) error {
+	var ids string
+	if err := row.Scan(
+		&profile.Id, &profile.Name, &ids, &profile.Active); err != nil {
+		return err
+	}
+	var err error
+	profile.ScheduledTaskIds, err = decodeIds(ids)
+	return err
+}
+
+func scanSensorEvent(row scanner, event *huedb.SensorEvent) error {
+	var eventTime int64
+	if err := row.Scan(
+		&event.Id,
+		&event.SensorId,
+		&event.Type,
+		&event.Value,
+		&eventTime); err != nil {
+		return err
+	}
+	event.Time = time.Unix(eventTime, 0)
+	return nil
+}
+
+func scanWeatherObservation(
+	row scanner, observation *huedb.WeatherObservation) error {
+	var observationTime int64
+	if err := row.Scan(
+		&observation.Id,
+		&observation.Station,
+		&observation.Temperature,
+		&observation.Weather,
+		&observation.WindSpeed,
+		&observationTime); err != nil {
+		return err
+	}
+	observation.Time = time.Unix(observationTime, 0)
+	return nil
+}
+
+func scanPreference(row scanner, pref *huedb.Preference) error {
+	return row.Scan(&pref.UserId, &pref.Key, &pref.Value)
+}
+
+// orderByClause returns the order by clause for the NamedColorsOrdered
+// query. Revisions have ascending ids so the latest revision of named
+// colors tells when they were last updated.
+func orderByClause(order huedb.NamedColorsOrder) string {
+	var direction string
+	if order.Descending {
+		direction = " desc"
+	}
+	switch order.By {
+	case huedb.OrderByDescription:
+		return "lower(nc.description)" + direction + ", nc.id"
+	case huedb.OrderByUpdatedAt:
+		return "coalesce(h.last_revision, 0)" + direction + ", nc.id"
+	default:
+		return "nc.id" + direction
+	}
+}
+
+// encodeIds encodes ids as a comma separated list sorted and without
+// duplicates.
+func encodeIds(ids []int64) string {
+	ids = sortedUniqueIds(ids)
+	idStrs := make([]string, len(ids))
+	for i := range ids {
+		idStrs[i] = strconv.FormatInt(ids[i], 10)
+	}
+	return strings.Join(idStrs, ",")
+}
+
+func decodeIds(encoded string) ([]int64, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	var result []int64
+	for _, idStr := range strings.Split(encoded, ",") {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, id)
+	}
+	return result, nil
+}
+
+// sortedUniqueIds returns a sorted copy of ids without duplicates.
+func sortedUniqueIds(ids []int64) []int64 {
+	result := make([]int64, len(ids))
+	copy(result, ids)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	idx := 0
+	for i := range result {
+		if i == 0 || result[i] != result[i-1] {
+			result[idx] = result[i]
+			idx++
+		}
+	}
+	return result[:idx]
+}
+
+// backupTableInfo describes a table that Backup copies.
+type backupTableInfo struct {
+	name string
+
+	// hasId is true if the table assigns ids to its rows.
+	hasId bool
+}
+
+func isBackupTable(name string) bool {
+	for _, info := range kBackupTables {
+		if info.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// backupFile is what Backup writes.
+type backupFile struct {
+	Version int
+	Tables  []backupTable
+}
+
+type backupTable struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
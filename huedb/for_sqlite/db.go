@@ -3,50 +3,231 @@
 package for_sqlite
 
 import (
+	"context"
+	"fmt"
 	"github.com/keep94/appcommon/db"
 	"github.com/keep94/appcommon/db/sqlite_db"
 	"github.com/keep94/appcommon/db/sqlite_rw"
+	"github.com/keep94/appcommon/passwords"
 	"github.com/keep94/goconsume"
-	"github.com/keep94/gohue"
 	"github.com/keep94/gosqlite/sqlite"
 	"github.com/keep94/marvin/huedb"
 	"github.com/keep94/marvin/ops"
-	"github.com/keep94/maybe"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	kSQLNamedColorsById   = "select id, colors, description from named_colors where id = ?"
-	kSQLNamedColors       = "select id, colors, description from named_colors order by 1"
-	kSQLAddNamedColors    = "insert into named_colors (colors, description) values (?, ?)"
-	kSQLUpdateNamedColors = "update named_colors set colors = ?, description = ? where id = ?"
-	kSQLRemoveNamedColors = "delete from named_colors where id = ?"
-
-	kSQLAddEncodedAtTimeTask                = "insert into at_time_tasks (schedule_id, hue_task_id, action, description, light_set, time, group_id) values (?, ?, ?, ?, ?, ?, ?)"
-	kSQLEncodedAtTimeTasks                  = "select id, schedule_id, hue_task_id, action, description, light_set, time, group_id from at_time_tasks where group_id = ? order by 1"
+	kSQLNamedColorsById    = "select id, colors, description from named_colors where id = ?"
+	kSQLNamedColors        = "select id, colors, description from named_colors order by 1"
+	kSQLNamedColorsPage    = "select id, colors, description from named_colors order by 1 limit ? offset ?"
+	kSQLNamedColorsOrdered = "select nc.id, nc.colors, nc.description from named_colors nc left join (select named_colors_id, max(id) as last_revision from named_colors_history group by named_colors_id) h on h.named_colors_id = nc.id order by %s"
+	kSQLNamedColorsCount   = "select count(*) from named_colors"
+	kSQLNamedColorsByIds   = "select id, colors, description from named_colors where id in (%s) order by 1"
+	kSQLNamedColorsByDesc  = "select id, colors, description from named_colors where description like ? escape '\\' order by 1"
+	kSQLAddNamedColors     = "insert into named_colors (colors, description) values (?, ?)"
+	kSQLUpdateNamedColors  = "update named_colors set colors = ?, description = ? where id = ?"
+	kSQLRemoveNamedColors  = "delete from named_colors where id = ?"
+
+	kSQLAddNamedColorsRevision  = "insert into named_colors_history (named_colors_id, colors, description, updated_at, deleted) select id, colors, description, ?, ? from named_colors where id = ?"
+	kSQLNamedColorsHistory      = "select id, named_colors_id, colors, description, updated_at, deleted from named_colors_history where named_colors_id = ? order by 1 desc"
+	kSQLDeletedNamedColors      = "select id, named_colors_id, colors, description, updated_at, deleted from named_colors_history where id in (select max(id) from named_colors_history group by named_colors_id) and deleted = 1 and named_colors_id not in (select id from named_colors) order by 1 desc"
+	kSQLNamedColorsRevisionById = "select id, named_colors_id, colors, description, updated_at, deleted from named_colors_history where id = ?"
+	kSQLNamedColorsIdExists     = "select id from named_colors where id = ?"
+	kSQLAddNamedColorsWithId    = "insert into named_colors (colors, description, id) values (?, ?, ?)"
+
+	kSQLLegacyNamedColors          = "select id, colors from named_colors where colors not like '{%'"
+	kSQLMigrateNamedColors         = "update named_colors set colors = ? where id = ?"
+	kSQLLegacyNamedColorsRevisions = "select id, colors from named_colors_history where colors not like '{%'"
+	kSQLMigrateNamedColorsRevision = "update named_colors_history set colors = ? where id = ?"
+
+	kSQLAddEncodedAtTimeTask                = "insert into at_time_tasks (schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence) values (?, ?, ?, ?, ?, ?, ?, ?)"
+	kSQLEncodedAtTimeTasks                  = "select id, schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence from at_time_tasks where group_id = ? order by 1"
 	kSQLRemoveEncodedAtTimeTaskByScheduleId = "delete from at_time_tasks where group_id = ? and schedule_id = ?"
 	kSQLClearEncodedAtTimeTasks             = "delete from at_time_tasks"
+	kSQLRemoveExpiredEncodedAtTimeTasks     = "delete from at_time_tasks where time < ?"
+	kSQLUpdateEncodedAtTimeTaskTime         = "update at_time_tasks set schedule_id = ?, time = ? where group_id = ? and schedule_id = ?"
+
+	kSQLArchiveEncodedAtTimeTask = "insert into at_time_tasks_archive (schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence, status, completed_at) select schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence, ?, ? from at_time_tasks where group_id = ? and schedule_id = ?"
+	kSQLArchivedAtTimeTasks      = "select id, schedule_id, hue_task_id, action, description, light_set, time, group_id, recurrence, status, completed_at from at_time_tasks_archive where group_id = ? order by completed_at desc, id desc"
+
+	kSQLEncodedScheduledTaskById   = "select id, hue_task_id, action, description, light_set, recurrence, enabled, high_priority from scheduled_tasks where id = ?"
+	kSQLEncodedScheduledTasks      = "select id, hue_task_id, action, description, light_set, recurrence, enabled, high_priority from scheduled_tasks order by 1"
+	kSQLAddEncodedScheduledTask    = "insert into scheduled_tasks (hue_task_id, action, description, light_set, recurrence, enabled, high_priority) values (?, ?, ?, ?, ?, ?, ?)"
+	kSQLUpdateEncodedScheduledTask = "update scheduled_tasks set hue_task_id = ?, action = ?, description = ?, light_set = ?, recurrence = ?, enabled = ?, high_priority = ? where id = ?"
+	kSQLRemoveEncodedScheduledTask = "delete from scheduled_tasks where id = ?"
+
+	kSQLUserById   = "select id, name, password, role from users where id = ?"
+	kSQLUserByName = "select id, name, password, role from users where name = ?"
+	kSQLUsers      = "select id, name, password, role from users order by name"
+	kSQLAddUser    = "insert into users (name, password, role) values (?, ?, ?)"
+	kSQLUpdateUser = "update users set name = ?, password = ?, role = ? where id = ?"
+	kSQLRemoveUser = "delete from users where id = ?"
+
+	kSQLLightAliases     = "select id, light_id, name from light_aliases order by name"
+	kSQLAddLightAlias    = "insert into light_aliases (light_id, name) values (?, ?)"
+	kSQLUpdateLightAlias = "update light_aliases set light_id = ?, name = ? where id = ?"
+	kSQLRemoveLightAlias = "delete from light_aliases where id = ?"
+	kSQLLightGroups      = "select id, name, light_set from light_groups order by name"
+	kSQLAddLightGroup    = "insert into light_groups (name, light_set) values (?, ?)"
+	kSQLUpdateLightGroup = "update light_groups set name = ?, light_set = ? where id = ?"
+	kSQLRemoveLightGroup = "delete from light_groups where id = ?"
+
+	kSQLSceneComponents      = "select id, named_colors_id, component_id, light_set, light_offset from scene_components where named_colors_id = ? order by 1"
+	kSQLAddSceneComponent    = "insert into scene_components (named_colors_id, component_id, light_set, light_offset) values (?, ?, ?, ?)"
+	kSQLRemoveSceneComponent = "delete from scene_components where id = ?"
+
+	kSQLBridgeById   = "select id, name, host, user from bridges where id = ?"
+	kSQLBridges      = "select id, name, host, user from bridges order by name"
+	kSQLAddBridge    = "insert into bridges (name, host, user) values (?, ?, ?)"
+	kSQLUpdateBridge = "update bridges set name = ?, host = ?, user = ? where id = ?"
+	kSQLRemoveBridge = "delete from bridges where id = ?"
+
+	kSQLWeatherSettings       = "select id, provider, station_id, api_key, poll_interval, units from weather_settings order by 1"
+	kSQLAddWeatherSettings    = "insert into weather_settings (provider, station_id, api_key, poll_interval, units) values (?, ?, ?, ?, ?)"
+	kSQLUpdateWeatherSettings = "update weather_settings set provider = ?, station_id = ?, api_key = ?, poll_interval = ?, units = ? where id = ?"
+	kSQLRemoveWeatherSettings = "delete from weather_settings where id = ?"
+
+	kSQLDescriptionOverrides      = "select hue_task_id, description from description_overrides order by hue_task_id"
+	kSQLSetDescriptionOverride    = "insert or replace into description_overrides (hue_task_id, description) values (?, ?)"
+	kSQLRemoveDescriptionOverride = "delete from description_overrides where hue_task_id = ?"
+
+	kSQLLastLightColors      = "select light_id, colors from last_light_colors"
+	kSQLSetLastLightColors   = "insert or replace into last_light_colors (light_id, colors) values (?, ?)"
+	kSQLClearLastLightColors = "delete from last_light_colors"
+
+	kSQLScheduleProfileById     = "select id, name, scheduled_task_ids, active from schedule_profiles where id = ?"
+	kSQLScheduleProfiles        = "select id, name, scheduled_task_ids, active from schedule_profiles order by name"
+	kSQLAddScheduleProfile      = "insert into schedule_profiles (name, scheduled_task_ids, active) values (?, ?, 0)"
+	kSQLUpdateScheduleProfile   = "update schedule_profiles set name = ?, scheduled_task_ids = ? where id = ?"
+	kSQLRemoveScheduleProfile   = "delete from schedule_profiles where id = ?"
+	kSQLActivateScheduleProfile = "update schedule_profiles set active = (id = ?)"
+
+	kSQLHasSearchIndex      = "select count(*) from sqlite_master where type = 'table' and name = 'search_index'"
+	kSQLSearchIndex         = "select kind, ref_id, description from search_index where search_index match ? and kind = ? order by ref_id"
+	kSQLSearchNamedColors   = "select 'named_colors', id, description from named_colors where %s order by id"
+	kSQLSearchScheduledTask = "select 'scheduled_task', id, description from scheduled_tasks where %s order by id"
+	kSQLSearchAtTimeTasks   = "select 'at_time_task', id, description from at_time_tasks order by id"
+
+	kSQLAddSensorEvent   = "insert into sensor_events (sensor_id, type, value, time) values (?, ?, ?, ?)"
+	kSQLSensorEvents     = "select id, sensor_id, type, value, time from sensor_events where time >= ? and time < ? order by time, id"
+	kSQLTrimSensorEvents = "delete from sensor_events where time < ?"
+
+	kSQLAddWeatherObservation   = "insert into weather_observations (station, temperature, weather, wind_speed, time) values (?, ?, ?, ?, ?)"
+	kSQLWeatherObservations     = "select id, station, temperature, weather, wind_speed, time from weather_observations where time >= ? and time < ? order by time, id"
+	kSQLTrimWeatherObservations = "delete from weather_observations where time < ?"
+
+	kSQLPreference       = "select user_id, key, value from preferences where user_id = ? and key = ?"
+	kSQLPreferences      = "select user_id, key, value from preferences where user_id = ? order by key"
+	kSQLSetPreference    = "insert or replace into preferences (user_id, key, value) values (?, ?, ?)"
+	kSQLRemovePreference = "delete from preferences where user_id = ? and key = ?"
+)
+
+const (
+	// sqlite allows at most 999 parameters in a statement.
+	kMaxIdsPerQuery = 500
+)
+
+var (
+	kLikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
 )
 
 type Store struct {
-	db sqlite_db.Doer
+	db      sqlite_db.Doer
+	readDb  sqlite_db.Doer
+	crypter *huedb.Crypter
+	ctx     context.Context
 }
 
 func New(db *sqlite_db.Db) Store {
-	return Store{db}
+	return Store{db: db}
 }
 
 func ConnNew(conn *sqlite.Conn) Store {
-	return Store{sqlite_db.NewSqliteDoer(conn)}
+	return Store{db: sqlite_db.NewSqliteDoer(conn)}
+}
+
+// WithCrypter returns a Store like this one that encrypts the colors of
+// named colors, the actions, descriptions, and light sets of at time
+// tasks, and the API usernames of bridges with crypter. The returned Store still reads values that were
+// stored unencrypted.
+func (s Store) WithCrypter(crypter *huedb.Crypter) Store {
+	s.crypter = crypter
+	return s
+}
+
+// WithReader returns a Store like this one that reads with reader when
+// called with a nil transaction. reader is typically a separate
+// connection to the same database file in WAL mode so that reads don't
+// wait behind writes. See sqlite_setup.EnableWAL.
+func (s Store) WithReader(reader *sqlite_db.Db) Store {
+	s.readDb = reader
+	return s
+}
+
+// WithContext returns a Store like this one that interrupts the
+// statement it is running once ctx is done and then returns ctx.Err().
+func (s Store) WithContext(ctx context.Context) huedb.Store {
+	s.ctx = ctx
+	return s
+}
+
+// do runs f with the connection of t or, if t is nil, of doer. If s has
+// a context, do interrupts f once that context is done.
+func (s Store) do(
+	doer sqlite_db.Doer,
+	t db.Transaction,
+	f func(conn *sqlite.Conn) error) error {
+	if s.ctx == nil {
+		return sqlite_db.ToDoer(doer, t).Do(f)
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	var interrupted bool
+	err := sqlite_db.ToDoer(doer, t).Do(func(conn *sqlite.Conn) error {
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-s.ctx.Done():
+				interrupt(conn)
+				interrupted = true
+			case <-stop:
+			}
+		}()
+		err := f(conn)
+		// Don't return until the goroutine is done so that it never
+		// interrupts whatever runs on conn next.
+		close(stop)
+		<-stopped
+		return err
+	})
+	// sqlite_rw.ReadRows drops the error of an interrupted statement so
+	// f may have returned nil after reading only some of the rows.
+	if interrupted || (err != nil && s.ctx.Err() != nil) {
+		return s.ctx.Err()
+	}
+	return err
+}
+
+func (s Store) reader() sqlite_db.Doer {
+	if s.readDb == nil {
+		return s.db
+	}
+	return s.readDb
 }
 
 func (s Store) NamedColorsById(
 	t db.Transaction, id int64, namedColors *ops.NamedColors) error {
-	return sqlite_db.ToDoer(s.db, t).Do(func(conn *sqlite.Conn) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
 		return sqlite_rw.ReadSingle(
 			conn,
-			(&rawNamedColors{}).init(namedColors),
+			(&rawNamedColors{crypter: s.crypter}).init(namedColors),
 			huedb.ErrNoSuchId,
 			kSQLNamedColorsById,
 			id)
@@ -55,48 +236,253 @@ func (s Store) NamedColorsById(
 
 func (s Store) NamedColors(
 	t db.Transaction, consumer goconsume.Consumer) error {
-	return sqlite_db.ToDoer(s.db, t).Do(func(conn *sqlite.Conn) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
 		return sqlite_rw.ReadMultiple(
 			conn,
-			(&rawNamedColors{}).init(&ops.NamedColors{}),
+			(&rawNamedColors{crypter: s.crypter}).init(&ops.NamedColors{}),
 			consumer,
 			kSQLNamedColors)
 	})
 }
 
+func (s Store) NamedColorsPage(
+	t db.Transaction, offset, limit int, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawNamedColors{crypter: s.crypter}).init(&ops.NamedColors{}),
+			consumer,
+			kSQLNamedColorsPage,
+			limit,
+			offset)
+	})
+}
+
+func (s Store) NamedColorsOrdered(
+	t db.Transaction,
+	order huedb.NamedColorsOrder,
+	consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawNamedColors{crypter: s.crypter}).init(&ops.NamedColors{}),
+			consumer,
+			fmt.Sprintf(kSQLNamedColorsOrdered, orderByClause(order)))
+	})
+}
+
+func (s Store) NamedColorsByIds(
+	t db.Transaction, ids []int64, consumer goconsume.Consumer) error {
+	ids = sortedUniqueIds(ids)
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		for len(ids) > 0 {
+			chunk := ids
+			if len(chunk) > kMaxIdsPerQuery {
+				chunk = chunk[:kMaxIdsPerQuery]
+			}
+			ids = ids[len(chunk):]
+			args := make([]interface{}, len(chunk))
+			for i := range chunk {
+				args[i] = chunk[i]
+			}
+			placeholders := strings.TrimSuffix(
+				strings.Repeat("?, ", len(chunk)), ", ")
+			if err := sqlite_rw.ReadMultiple(
+				conn,
+				(&rawNamedColors{crypter: s.crypter}).init(&ops.NamedColors{}),
+				consumer,
+				fmt.Sprintf(kSQLNamedColorsByIds, placeholders),
+				args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) NamedColorsCount(t db.Transaction) (count int, err error) {
+	err = s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		var count64 int64
+		if err := sqlite_rw.ReadSingle(
+			conn,
+			(&rawInt64{}).init(&count64),
+			huedb.ErrNoSuchId,
+			kSQLNamedColorsCount); err != nil {
+			return err
+		}
+		count = int(count64)
+		return nil
+	})
+	return
+}
+
+func (s Store) NamedColorsByDescription(
+	t db.Transaction, pattern string, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawNamedColors{crypter: s.crypter}).init(&ops.NamedColors{}),
+			consumer,
+			kSQLNamedColorsByDesc,
+			"%"+kLikeEscaper.Replace(pattern)+"%")
+	})
+}
+
 func (s Store) AddNamedColors(
 	t db.Transaction, namedColors *ops.NamedColors) error {
-	return sqlite_db.ToDoer(s.db, t).Do(func(conn *sqlite.Conn) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
 		return sqlite_rw.AddRow(
 			conn,
-			(&rawNamedColors{}).init(namedColors),
+			(&rawNamedColors{crypter: s.crypter}).init(namedColors),
 			&namedColors.Id,
 			kSQLAddNamedColors)
 	})
 }
 
+func (s Store) AddNamedColorsBatch(
+	t db.Transaction, batch []*ops.NamedColors) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		stmt, err := conn.Prepare(kSQLAddNamedColors)
+		if err != nil {
+			return err
+		}
+		defer stmt.Finalize()
+		lastRowIdStmt, err := conn.Prepare(sqlite_db.LastRowIdSQL)
+		if err != nil {
+			return err
+		}
+		defer lastRowIdStmt.Finalize()
+		for _, namedColors := range batch {
+			values, err := sqlite_rw.InsertValues(
+				(&rawNamedColors{crypter: s.crypter}).init(namedColors))
+			if err != nil {
+				return err
+			}
+			if err := stmt.Exec(values...); err != nil {
+				return err
+			}
+			// Insert statements return no rows, so Next just runs stmt.
+			stmt.Next()
+			if err := stmt.Error(); err != nil {
+				return err
+			}
+			if namedColors.Id, err = sqlite_db.LastRowIdFromStmt(
+				lastRowIdStmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) MigrateLightColors(t db.Transaction) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		if err := migrateLightColors(
+			conn,
+			s.crypter,
+			kSQLLegacyNamedColors,
+			kSQLMigrateNamedColors); err != nil {
+			return err
+		}
+		return migrateLightColors(
+			conn,
+			s.crypter,
+			kSQLLegacyNamedColorsRevisions,
+			kSQLMigrateNamedColorsRevision)
+	})
+}
+
 func (s Store) UpdateNamedColors(
 	t db.Transaction, namedColors *ops.NamedColors) error {
-	return sqlite_db.ToDoer(s.db, t).Do(func(conn *sqlite.Conn) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		if err := addNamedColorsRevision(
+			conn, namedColors.Id, false); err != nil {
+			return err
+		}
 		return sqlite_rw.UpdateRow(
 			conn,
-			(&rawNamedColors{}).init(namedColors),
+			(&rawNamedColors{crypter: s.crypter}).init(namedColors),
 			kSQLUpdateNamedColors)
 	})
 }
 
 func (s Store) RemoveNamedColors(t db.Transaction, id int64) error {
-	return sqlite_db.ToDoer(s.db, t).Do(func(conn *sqlite.Conn) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		if err := addNamedColorsRevision(conn, id, true); err != nil {
+			return err
+		}
 		return conn.Exec(kSQLRemoveNamedColors, id)
 	})
 }
 
+func (s Store) NamedColorsHistory(
+	t db.Transaction, id int64, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawNamedColorsRevision{crypter: s.crypter}).init(&huedb.NamedColorsRevision{}),
+			consumer,
+			kSQLNamedColorsHistory,
+			id)
+	})
+}
+
+func (s Store) DeletedNamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawNamedColorsRevision{crypter: s.crypter}).init(&huedb.NamedColorsRevision{}),
+			consumer,
+			kSQLDeletedNamedColors)
+	})
+}
+
+func (s Store) RestoreNamedColors(t db.Transaction, revisionId int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		var revision huedb.NamedColorsRevision
+		if err := sqlite_rw.ReadSingle(
+			conn,
+			(&rawNamedColorsRevision{crypter: s.crypter}).init(&revision),
+			huedb.ErrNoSuchId,
+			kSQLNamedColorsRevisionById,
+			revisionId); err != nil {
+			return err
+		}
+		var id int64
+		err := sqlite_rw.ReadSingle(
+			conn,
+			(&rawInt64{}).init(&id),
+			huedb.ErrNoSuchId,
+			kSQLNamedColorsIdExists,
+			revision.NamedColors.Id)
+		if err == huedb.ErrNoSuchId {
+			row := (&rawNamedColors{crypter: s.crypter}).init(&revision.NamedColors)
+			values, err := sqlite_rw.UpdateValues(row)
+			if err != nil {
+				return err
+			}
+			return conn.Exec(kSQLAddNamedColorsWithId, values...)
+		}
+		if err != nil {
+			return err
+		}
+		if err := addNamedColorsRevision(conn, id, false); err != nil {
+			return err
+		}
+		return sqlite_rw.UpdateRow(
+			conn,
+			(&rawNamedColors{crypter: s.crypter}).init(&revision.NamedColors),
+			kSQLUpdateNamedColors)
+	})
+}
+
 func (s Store) EncodedAtTimeTasks(
 	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
-	return sqlite_db.ToDoer(s.db, t).Do(func(conn *sqlite.Conn) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
 		return sqlite_rw.ReadMultiple(
 			conn,
-			(&rawEncodedAtTimeTask{}).init(&huedb.EncodedAtTimeTask{}),
+			(&rawEncodedAtTimeTask{crypter: s.crypter}).init(&huedb.EncodedAtTimeTask{}),
 			consumer,
 			kSQLEncodedAtTimeTasks,
 			groupId)
@@ -105,10 +491,10 @@ func (s Store) EncodedAtTimeTasks(
 
 func (s Store) AddEncodedAtTimeTask(
 	t db.Transaction, task *huedb.EncodedAtTimeTask) error {
-	return sqlite_db.ToDoer(s.db, t).Do(func(conn *sqlite.Conn) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
 		return sqlite_rw.AddRow(
 			conn,
-			(&rawEncodedAtTimeTask{}).init(task),
+			(&rawEncodedAtTimeTask{crypter: s.crypter}).init(task),
 			&task.Id,
 			kSQLAddEncodedAtTimeTask)
 	})
@@ -116,152 +502,1386 @@ func (s Store) AddEncodedAtTimeTask(
 
 func (s Store) RemoveEncodedAtTimeTaskByScheduleId(
 	t db.Transaction, groupId, scheduleId string) error {
-	return sqlite_db.ToDoer(s.db, t).Do(func(conn *sqlite.Conn) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
 		return conn.Exec(
 			kSQLRemoveEncodedAtTimeTaskByScheduleId, groupId, scheduleId)
 	})
 }
 
 func (s Store) ClearEncodedAtTimeTasks(t db.Transaction) error {
-	return sqlite_db.ToDoer(s.db, t).Do(func(conn *sqlite.Conn) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
 		return conn.Exec(kSQLClearEncodedAtTimeTasks)
 	})
 }
 
-type rawNamedColors struct {
-	*ops.NamedColors
-	colors string
+func (s Store) UpdateEncodedAtTimeTaskTime(
+	t db.Transaction,
+	groupId, scheduleId, newScheduleId string,
+	newTime time.Time) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(
+			kSQLUpdateEncodedAtTimeTaskTime,
+			newScheduleId,
+			newTime.Unix(),
+			groupId,
+			scheduleId)
+	})
 }
 
-func (r *rawNamedColors) init(bo *ops.NamedColors) *rawNamedColors {
-	r.NamedColors = bo
-	return r
+func (s Store) RemoveExpired(t db.Transaction, before time.Time) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveExpiredEncodedAtTimeTasks, before.Unix())
+	})
 }
 
-func (r *rawNamedColors) ValuePtr() interface{} {
-	return r.NamedColors
+func (s Store) ArchiveEncodedAtTimeTask(
+	t db.Transaction,
+	groupId, scheduleId string,
+	status huedb.AtTimeTaskStatus,
+	completedAt time.Time) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		if err := conn.Exec(
+			kSQLArchiveEncodedAtTimeTask,
+			int(status),
+			completedAt.Unix(),
+			groupId,
+			scheduleId); err != nil {
+			return err
+		}
+		return conn.Exec(
+			kSQLRemoveEncodedAtTimeTaskByScheduleId, groupId, scheduleId)
+	})
 }
 
-func (r *rawNamedColors) Ptrs() []interface{} {
-	return []interface{}{&r.Id, &r.colors, &r.Description}
+func (s Store) ArchivedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawArchivedAtTimeTask{crypter: s.crypter}).init(&huedb.ArchivedAtTimeTask{}),
+			consumer,
+			kSQLArchivedAtTimeTasks,
+			groupId)
+	})
 }
 
-func (r *rawNamedColors) Values() []interface{} {
-	return []interface{}{r.colors, r.Description, r.Id}
+func (s Store) EncodedScheduledTaskById(
+	t db.Transaction, id int64, task *huedb.EncodedScheduledTask) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadSingle(
+			conn,
+			(&rawEncodedScheduledTask{}).init(task),
+			huedb.ErrNoSuchId,
+			kSQLEncodedScheduledTaskById,
+			id)
+	})
 }
 
-func (r *rawNamedColors) Unmarshall() error {
-	if !strings.HasPrefix(r.colors, "0|") && r.colors != "0" {
-		return huedb.ErrBadLightColors
-	}
-	marshalled := strings.Split(r.colors, "|")
-	marshalledLen := len(marshalled)
-	lightColors := make(ops.LightColors, (marshalledLen-1)/4)
-	for idx := 1; idx < marshalledLen; idx += 4 {
-		lightId, err := strconv.Atoi(marshalled[idx])
-		if err != nil {
-			return err
-		}
-		var ix int
-		if ix, err = strconv.Atoi(marshalled[idx+1]); err != nil {
-			return err
-		}
-		var iy int
-		if iy, err = strconv.Atoi(marshalled[idx+2]); err != nil {
-			return err
-		}
-		var ibrightness int
-		if ibrightness, err = strconv.Atoi(marshalled[idx+3]); err != nil {
-			return err
-		}
-		if lightId < 0 {
-			return huedb.ErrBadLightColors
-		}
-		var theColor gohue.MaybeColor
-		if ix != -1 {
-			x := float64(ix) / 10000.0
-			y := float64(iy) / 10000.0
-			if x < 0.0 || x > 1.0 || y < 0.0 || y > 1.0 {
-				return huedb.ErrBadLightColors
-			}
-			theColor.Set(gohue.NewColor(x, y))
-		}
-		var theBrightness maybe.Uint8
-		if ibrightness != -1 {
-			if ibrightness < 0 || ibrightness > 255 {
-				return huedb.ErrBadLightColors
-			}
-			theBrightness.Set(uint8(ibrightness))
-		}
-		lightColors[lightId] = ops.ColorBrightness{theColor, theBrightness}
-	}
-	if len(lightColors) == 0 {
-		r.Colors = nil
-	} else {
-		r.Colors = lightColors
-	}
-	return nil
+func (s Store) EncodedScheduledTasks(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawEncodedScheduledTask{}).init(&huedb.EncodedScheduledTask{}),
+			consumer,
+			kSQLEncodedScheduledTasks)
+	})
 }
 
-func (r *rawNamedColors) Marshall() error {
-	marshalled := make([]string, 4*len(r.Colors)+1)
-	marshalled[0] = "0"
-	var idx = 1
-	for lightId, colorBrightness := range r.Colors {
-		if lightId < 0 {
-			return huedb.ErrBadLightColors
-		}
-		var ix, iy int
-		if colorBrightness.Color.Valid {
-			x := colorBrightness.Color.X()
-			y := colorBrightness.Color.Y()
-			if x < 0.0 || x > 1.0 || y < 0.0 || y > 1.0 {
-				return huedb.ErrBadLightColors
-			}
-			ix = int(x*10000.0 + 0.5)
-			iy = int(y*10000.0 + 0.5)
-		} else {
-			ix = -1
-			iy = 0
-		}
-		var iBrightness int
-		if colorBrightness.Brightness.Valid {
-			iBrightness = int(colorBrightness.Brightness.Value)
-		} else {
-			iBrightness = -1
-		}
-		marshalled[idx] = strconv.Itoa(lightId)
-		idx++
-		marshalled[idx] = strconv.Itoa(ix)
-		idx++
-		marshalled[idx] = strconv.Itoa(iy)
-		idx++
-		marshalled[idx] = strconv.Itoa(iBrightness)
-		idx++
-	}
-	r.colors = strings.Join(marshalled, "|")
-	return nil
+func (s Store) AddEncodedScheduledTask(
+	t db.Transaction, task *huedb.EncodedScheduledTask) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.AddRow(
+			conn,
+			(&rawEncodedScheduledTask{}).init(task),
+			&task.Id,
+			kSQLAddEncodedScheduledTask)
+	})
 }
 
-type rawEncodedAtTimeTask struct {
-	*huedb.EncodedAtTimeTask
-	sqlite_rw.SimpleRow
+func (s Store) UpdateEncodedScheduledTask(
+	t db.Transaction, task *huedb.EncodedScheduledTask) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.UpdateRow(
+			conn,
+			(&rawEncodedScheduledTask{}).init(task),
+			kSQLUpdateEncodedScheduledTask)
+	})
 }
 
-func (r *rawEncodedAtTimeTask) init(
-	bo *huedb.EncodedAtTimeTask) *rawEncodedAtTimeTask {
-	r.EncodedAtTimeTask = bo
-	return r
+func (s Store) RemoveEncodedScheduledTask(t db.Transaction, id int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveEncodedScheduledTask, id)
+	})
 }
 
-func (r *rawEncodedAtTimeTask) ValuePtr() interface{} {
-	return r.EncodedAtTimeTask
+func (s Store) UserById(
+	t db.Transaction, id int64, user *huedb.User) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadSingle(
+			conn,
+			(&rawUser{}).init(user),
+			huedb.ErrNoSuchId,
+			kSQLUserById,
+			id)
+	})
 }
 
-func (r *rawEncodedAtTimeTask) Ptrs() []interface{} {
-	return []interface{}{&r.Id, &r.ScheduleId, &r.HueTaskId, &r.Action, &r.Description, &r.LightSet, &r.Time, &r.GroupId}
+func (s Store) UserByName(
+	t db.Transaction, name string, user *huedb.User) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadSingle(
+			conn,
+			(&rawUser{}).init(user),
+			huedb.ErrNoSuchId,
+			kSQLUserByName,
+			name)
+	})
 }
 
-func (r *rawEncodedAtTimeTask) Values() []interface{} {
-	return []interface{}{r.ScheduleId, r.HueTaskId, r.Action, r.Description, r.LightSet, r.Time, r.GroupId, r.Id}
+func (s Store) Users(t db.Transaction, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawUser{}).init(&huedb.User{}),
+			consumer,
+			kSQLUsers)
+	})
+}
+
+func (s Store) AddUser(t db.Transaction, user *huedb.User) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.AddRow(
+			conn,
+			(&rawUser{}).init(user),
+			&user.Id,
+			kSQLAddUser)
+	})
+}
+
+func (s Store) UpdateUser(t db.Transaction, user *huedb.User) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.UpdateRow(
+			conn,
+			(&rawUser{}).init(user),
+			kSQLUpdateUser)
+	})
+}
+
+func (s Store) RemoveUser(t db.Transaction, id int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveUser, id)
+	})
+}
+
+func (s Store) LightAliases(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawLightAlias{}).init(&huedb.LightAlias{}),
+			consumer,
+			kSQLLightAliases)
+	})
+}
+
+func (s Store) AddLightAlias(
+	t db.Transaction, alias *huedb.LightAlias) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.AddRow(
+			conn,
+			(&rawLightAlias{}).init(alias),
+			&alias.Id,
+			kSQLAddLightAlias)
+	})
+}
+
+func (s Store) UpdateLightAlias(
+	t db.Transaction, alias *huedb.LightAlias) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.UpdateRow(
+			conn,
+			(&rawLightAlias{}).init(alias),
+			kSQLUpdateLightAlias)
+	})
+}
+
+func (s Store) RemoveLightAlias(t db.Transaction, id int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveLightAlias, id)
+	})
+}
+
+func (s Store) LightGroups(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawLightGroup{}).init(&huedb.LightGroup{}),
+			consumer,
+			kSQLLightGroups)
+	})
+}
+
+func (s Store) AddLightGroup(
+	t db.Transaction, group *huedb.LightGroup) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.AddRow(
+			conn,
+			(&rawLightGroup{}).init(group),
+			&group.Id,
+			kSQLAddLightGroup)
+	})
+}
+
+func (s Store) UpdateLightGroup(
+	t db.Transaction, group *huedb.LightGroup) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.UpdateRow(
+			conn,
+			(&rawLightGroup{}).init(group),
+			kSQLUpdateLightGroup)
+	})
+}
+
+func (s Store) RemoveLightGroup(t db.Transaction, id int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveLightGroup, id)
+	})
+}
+
+func (s Store) SceneComponents(
+	t db.Transaction,
+	namedColorsId int64,
+	consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawSceneComponent{}).init(&huedb.SceneComponent{}),
+			consumer,
+			kSQLSceneComponents,
+			namedColorsId)
+	})
+}
+
+func (s Store) AddSceneComponent(
+	t db.Transaction, component *huedb.SceneComponent) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.AddRow(
+			conn,
+			(&rawSceneComponent{}).init(component),
+			&component.Id,
+			kSQLAddSceneComponent)
+	})
+}
+
+func (s Store) RemoveSceneComponent(t db.Transaction, id int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveSceneComponent, id)
+	})
+}
+
+func (s Store) BridgeById(
+	t db.Transaction, id int64, bridge *huedb.Bridge) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadSingle(
+			conn,
+			(&rawBridge{crypter: s.crypter}).init(bridge),
+			huedb.ErrNoSuchId,
+			kSQLBridgeById,
+			id)
+	})
+}
+
+func (s Store) Bridges(t db.Transaction, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawBridge{crypter: s.crypter}).init(&huedb.Bridge{}),
+			consumer,
+			kSQLBridges)
+	})
+}
+
+func (s Store) AddBridge(t db.Transaction, bridge *huedb.Bridge) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.AddRow(
+			conn,
+			(&rawBridge{crypter: s.crypter}).init(bridge),
+			&bridge.Id,
+			kSQLAddBridge)
+	})
+}
+
+func (s Store) UpdateBridge(t db.Transaction, bridge *huedb.Bridge) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.UpdateRow(
+			conn,
+			(&rawBridge{crypter: s.crypter}).init(bridge),
+			kSQLUpdateBridge)
+	})
+}
+
+func (s Store) RemoveBridge(t db.Transaction, id int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveBridge, id)
+	})
+}
+
+func (s Store) WeatherSettings(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawWeatherSettings{}).init(&huedb.WeatherSettings{}),
+			consumer,
+			kSQLWeatherSettings)
+	})
+}
+
+func (s Store) AddWeatherSettings(
+	t db.Transaction, settings *huedb.WeatherSettings) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.AddRow(
+			conn,
+			(&rawWeatherSettings{}).init(settings),
+			&settings.Id,
+			kSQLAddWeatherSettings)
+	})
+}
+
+func (s Store) UpdateWeatherSettings(
+	t db.Transaction, settings *huedb.WeatherSettings) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.UpdateRow(
+			conn,
+			(&rawWeatherSettings{}).init(settings),
+			kSQLUpdateWeatherSettings)
+	})
+}
+
+func (s Store) RemoveWeatherSettings(t db.Transaction, id int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveWeatherSettings, id)
+	})
+}
+
+func (s Store) ScheduleProfileById(
+	t db.Transaction, id int64, profile *huedb.ScheduleProfile) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadSingle(
+			conn,
+			(&rawScheduleProfile{}).init(profile),
+			huedb.ErrNoSuchId,
+			kSQLScheduleProfileById,
+			id)
+	})
+}
+
+func (s Store) ScheduleProfiles(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawScheduleProfile{}).init(&huedb.ScheduleProfile{}),
+			consumer,
+			kSQLScheduleProfiles)
+	})
+}
+
+func (s Store) AddScheduleProfile(
+	t db.Transaction, profile *huedb.ScheduleProfile) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		if err := sqlite_rw.AddRow(
+			conn,
+			(&rawScheduleProfile{}).init(profile),
+			&profile.Id,
+			kSQLAddScheduleProfile); err != nil {
+			return err
+		}
+		profile.Active = false
+		return nil
+	})
+}
+
+func (s Store) UpdateScheduleProfile(
+	t db.Transaction, profile *huedb.ScheduleProfile) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.UpdateRow(
+			conn,
+			(&rawScheduleProfile{}).init(profile),
+			kSQLUpdateScheduleProfile)
+	})
+}
+
+func (s Store) RemoveScheduleProfile(t db.Transaction, id int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveScheduleProfile, id)
+	})
+}
+
+func (s Store) ActivateScheduleProfile(t db.Transaction, id int64) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLActivateScheduleProfile, id)
+	})
+}
+
+// Search uses the full text search index that sqlite_setup.SetUpTables
+// creates when sqlite supports FTS5. Otherwise, Search uses LIKE. Because
+// at time task descriptions may be encrypted, Search always reads every
+// at time task.
+func (s Store) Search(
+	t db.Transaction, query string, consumer goconsume.Consumer) error {
+	words := huedb.SearchWords(query)
+	if len(words) == 0 {
+		return nil
+	}
+	consumer = goconsume.Filter(consumer, func(ptr interface{}) bool {
+		p := ptr.(*huedb.SearchResult)
+		return huedb.SearchMatches(p.Description, words)
+	})
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		var indexCount int64
+		if err := sqlite_rw.ReadSingle(
+			conn,
+			(&rawInt64{}).init(&indexCount),
+			huedb.ErrNoSuchId,
+			kSQLHasSearchIndex); err != nil {
+			return err
+		}
+		if indexCount > 0 {
+			if err := searchIndex(
+				conn, words, huedb.NamedColorsSearchResult, consumer); err != nil {
+				return err
+			}
+			if err := searchIndex(
+				conn, words, huedb.ScheduledTaskSearchResult, consumer); err != nil {
+				return err
+			}
+		} else {
+			where, params := likeAllWords(words)
+			if err := sqlite_rw.ReadMultiple(
+				conn,
+				(&rawSearchResult{}).init(&huedb.SearchResult{}),
+				consumer,
+				fmt.Sprintf(kSQLSearchNamedColors, where),
+				params...); err != nil {
+				return err
+			}
+			if err := sqlite_rw.ReadMultiple(
+				conn,
+				(&rawSearchResult{}).init(&huedb.SearchResult{}),
+				consumer,
+				fmt.Sprintf(kSQLSearchScheduledTask, where),
+				params...); err != nil {
+				return err
+			}
+		}
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawSearchResult{crypter: s.crypter}).init(&huedb.SearchResult{}),
+			consumer,
+			kSQLSearchAtTimeTasks)
+	})
+}
+
+func (s Store) AddSensorEvent(
+	t db.Transaction, event *huedb.SensorEvent) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.AddRow(
+			conn,
+			(&rawSensorEvent{}).init(event),
+			&event.Id,
+			kSQLAddSensorEvent)
+	})
+}
+
+func (s Store) SensorEvents(
+	t db.Transaction,
+	start, end time.Time,
+	consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawSensorEvent{}).init(&huedb.SensorEvent{}),
+			consumer,
+			kSQLSensorEvents,
+			start.Unix(),
+			end.Unix())
+	})
+}
+
+func (s Store) TrimSensorEvents(t db.Transaction, before time.Time) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLTrimSensorEvents, before.Unix())
+	})
+}
+
+func (s Store) AddWeatherObservation(
+	t db.Transaction, observation *huedb.WeatherObservation) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.AddRow(
+			conn,
+			(&rawWeatherObservation{}).init(observation),
+			&observation.Id,
+			kSQLAddWeatherObservation)
+	})
+}
+
+func (s Store) WeatherObservations(
+	t db.Transaction,
+	start, end time.Time,
+	consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawWeatherObservation{}).init(&huedb.WeatherObservation{}),
+			consumer,
+			kSQLWeatherObservations,
+			start.Unix(),
+			end.Unix())
+	})
+}
+
+func (s Store) TrimWeatherObservations(
+	t db.Transaction, before time.Time) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLTrimWeatherObservations, before.Unix())
+	})
+}
+
+func (s Store) DescriptionOverrides(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawDescriptionOverride{}).init(&huedb.DescriptionOverride{}),
+			consumer,
+			kSQLDescriptionOverrides)
+	})
+}
+
+func (s Store) SetDescriptionOverride(
+	t db.Transaction, override *huedb.DescriptionOverride) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(
+			kSQLSetDescriptionOverride,
+			override.HueTaskId,
+			override.Description)
+	})
+}
+
+func (s Store) RemoveDescriptionOverride(
+	t db.Transaction, hueTaskId int) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemoveDescriptionOverride, hueTaskId)
+	})
+}
+
+func (s Store) LastLightColors(t db.Transaction) (
+	colors ops.LightColors, err error) {
+	err = s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		var rows []encodedColors
+		if err := sqlite_rw.ReadMultiple(
+			conn,
+			(&rawEncodedColors{}).init(&encodedColors{}),
+			goconsume.AppendTo(&rows),
+			kSQLLastLightColors); err != nil {
+			return err
+		}
+		colors = make(ops.LightColors, len(rows))
+		for _, row := range rows {
+			lightColors, err := huedb.DecodeLightColors(row.colors)
+			if err != nil {
+				return err
+			}
+			colors[int(row.id)] = lightColors[int(row.id)]
+		}
+		return nil
+	})
+	return
+}
+
+func (s Store) SetLastLightColors(
+	t db.Transaction, colors ops.LightColors) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		if _, ok := colors[0]; ok {
+			if err := conn.Exec(kSQLClearLastLightColors); err != nil {
+				return err
+			}
+		}
+		for id, cb := range colors {
+			encoded, err := huedb.EncodeLightColors(ops.LightColors{id: cb})
+			if err != nil {
+				return err
+			}
+			if err := conn.Exec(kSQLSetLastLightColors, id, encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) Preference(
+	t db.Transaction, userId int64, key string, pref *huedb.Preference) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadSingle(
+			conn,
+			(&rawPreference{}).init(pref),
+			huedb.ErrNoSuchId,
+			kSQLPreference,
+			userId,
+			key)
+	})
+}
+
+func (s Store) Preferences(
+	t db.Transaction, userId int64, consumer goconsume.Consumer) error {
+	return s.do(s.reader(), t, func(conn *sqlite.Conn) error {
+		return sqlite_rw.ReadMultiple(
+			conn,
+			(&rawPreference{}).init(&huedb.Preference{}),
+			consumer,
+			kSQLPreferences,
+			userId)
+	})
+}
+
+func (s Store) SetPreference(t db.Transaction, pref *huedb.Preference) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLSetPreference, pref.UserId, pref.Key, pref.Value)
+	})
+}
+
+func (s Store) RemovePreference(
+	t db.Transaction, userId int64, key string) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		return conn.Exec(kSQLRemovePreference, userId, key)
+	})
+}
+
+// Backup copies the database to a new sqlite file at dest using the
+// sqlite online backup API. Backup can run while other goroutines use
+// the database.
+func (s Store) Backup(t db.Transaction, dest string) error {
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		destConn, err := sqlite.Open(dest)
+		if err != nil {
+			return err
+		}
+		defer destConn.Close()
+		return copyDatabase(destConn, conn)
+	})
+}
+
+// Restore replaces the contents of the database with the contents of
+// the sqlite file at src which Backup created.
+func (s Store) Restore(t db.Transaction, src string) error {
+	// Opening a missing file creates an empty database which would wipe
+	// out everything.
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	return s.do(s.db, t, func(conn *sqlite.Conn) error {
+		srcConn, err := sqlite.Open(src)
+		if err != nil {
+			return err
+		}
+		defer srcConn.Close()
+		return copyDatabase(conn, srcConn)
+	})
+}
+
+// copyDatabase copies the main database of src to the main database of
+// dest in one step.
+func copyDatabase(dest, src *sqlite.Conn) error {
+	backup, err := sqlite.NewBackup(dest, "main", src, "main")
+	if err != nil {
+		return err
+	}
+	defer backup.Close()
+	return backup.Run(-1, 0, nil)
+}
+
+// sortedUniqueIds returns a sorted copy of ids without duplicates.
+func sortedUniqueIds(ids []int64) []int64 {
+	result := make([]int64, len(ids))
+	copy(result, ids)
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	idx := 0
+	for i := range result {
+		if i == 0 || result[i] != result[i-1] {
+			result[idx] = result[i]
+			idx++
+		}
+	}
+	return result[:idx]
+}
+
+// searchIndex reads the rows of a particular kind from the full text
+// search index that match words.
+func searchIndex(
+	conn *sqlite.Conn,
+	words []string,
+	kind string,
+	consumer goconsume.Consumer) error {
+	terms := make([]string, len(words))
+	for i := range words {
+		terms[i] = `"` + strings.Replace(words[i], `"`, `""`, -1) + `"*`
+	}
+	return sqlite_rw.ReadMultiple(
+		conn,
+		(&rawSearchResult{}).init(&huedb.SearchResult{}),
+		consumer,
+		kSQLSearchIndex,
+		"description : "+strings.Join(terms, " AND "),
+		kind)
+}
+
+// likeAllWords returns a where clause that matches descriptions
+// containing all of words along with its parameters.
+func likeAllWords(words []string) (string, []interface{}) {
+	clauses := make([]string, len(words))
+	params := make([]interface{}, len(words))
+	for i := range words {
+		clauses[i] = "description like ? escape '\\'"
+		params[i] = "%" + kLikeEscaper.Replace(words[i]) + "%"
+	}
+	return strings.Join(clauses, " and "), params
+}
+
+// migrateLightColors re-encodes the colors that selectSQL returns and
+// writes them back with updateSQL. selectSQL also returns encrypted
+// colors since they don't look like JSON. migrateLightColors skips those
+// already in the current format.
+func migrateLightColors(
+	conn *sqlite.Conn,
+	crypter *huedb.Crypter,
+	selectSQL, updateSQL string) error {
+	var rows []encodedColors
+	if err := sqlite_rw.ReadMultiple(
+		conn,
+		(&rawEncodedColors{}).init(&encodedColors{}),
+		goconsume.AppendTo(&rows),
+		selectSQL); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		decrypted, err := crypter.Decrypt(row.colors)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(decrypted, "{") {
+			continue
+		}
+		colors, err := huedb.DecodeLightColors(decrypted)
+		if err != nil {
+			return err
+		}
+		encoded, err := huedb.EncodeLightColors(colors)
+		if err != nil {
+			return err
+		}
+		if encoded, err = crypter.Encrypt(encoded); err != nil {
+			return err
+		}
+		if err := conn.Exec(updateSQL, encoded, row.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderByClause returns the order by clause for kSQLNamedColorsOrdered.
+// Revisions have ascending ids so the latest revision of named colors
+// tells when they were last updated.
+func orderByClause(order huedb.NamedColorsOrder) string {
+	var direction string
+	if order.Descending {
+		direction = " desc"
+	}
+	switch order.By {
+	case huedb.OrderByDescription:
+		return "nc.description collate nocase" + direction + ", nc.id"
+	case huedb.OrderByUpdatedAt:
+		return "coalesce(h.last_revision, 0)" + direction + ", nc.id"
+	default:
+		return "nc.id" + direction
+	}
+}
+
+func addNamedColorsRevision(
+	conn *sqlite.Conn, id int64, deleted bool) error {
+	return conn.Exec(
+		kSQLAddNamedColorsRevision, time.Now().Unix(), deleted, id)
+}
+
+type rawNamedColors struct {
+	*ops.NamedColors
+	colors  string
+	crypter *huedb.Crypter
+}
+
+func (r *rawNamedColors) init(bo *ops.NamedColors) *rawNamedColors {
+	r.NamedColors = bo
+	return r
+}
+
+func (r *rawNamedColors) ValuePtr() interface{} {
+	return r.NamedColors
+}
+
+func (r *rawNamedColors) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.colors, &r.Description}
+}
+
+func (r *rawNamedColors) Values() []interface{} {
+	return []interface{}{r.colors, r.Description, r.Id}
+}
+
+func (r *rawNamedColors) Unmarshall() error {
+	colors, err := r.crypter.Decrypt(r.colors)
+	if err != nil {
+		return err
+	}
+	r.Colors, err = huedb.DecodeLightColors(colors)
+	return err
+}
+
+func (r *rawNamedColors) Marshall() error {
+	colors, err := huedb.EncodeLightColors(r.Colors)
+	if err != nil {
+		return err
+	}
+	r.colors, err = r.crypter.Encrypt(colors)
+	return err
+}
+
+type rawNamedColorsRevision struct {
+	*huedb.NamedColorsRevision
+	colors    string
+	updatedAt int64
+	crypter   *huedb.Crypter
+}
+
+func (r *rawNamedColorsRevision) init(
+	bo *huedb.NamedColorsRevision) *rawNamedColorsRevision {
+	r.NamedColorsRevision = bo
+	return r
+}
+
+func (r *rawNamedColorsRevision) ValuePtr() interface{} {
+	return r.NamedColorsRevision
+}
+
+func (r *rawNamedColorsRevision) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.NamedColors.Id, &r.colors, &r.Description, &r.updatedAt, &r.Deleted}
+}
+
+func (r *rawNamedColorsRevision) Unmarshall() error {
+	r.UpdatedAt = time.Unix(r.updatedAt, 0)
+	colors, err := r.crypter.Decrypt(r.colors)
+	if err != nil {
+		return err
+	}
+	r.Colors, err = huedb.DecodeLightColors(colors)
+	return err
+}
+
+type encodedColors struct {
+	id     int64
+	colors string
+}
+
+type rawEncodedColors struct {
+	*encodedColors
+	sqlite_rw.SimpleRow
+}
+
+func (r *rawEncodedColors) init(bo *encodedColors) *rawEncodedColors {
+	r.encodedColors = bo
+	return r
+}
+
+func (r *rawEncodedColors) ValuePtr() interface{} {
+	return r.encodedColors
+}
+
+func (r *rawEncodedColors) Ptrs() []interface{} {
+	return []interface{}{&r.id, &r.colors}
+}
+
+type rawInt64 struct {
+	value *int64
+	sqlite_rw.SimpleRow
+}
+
+func (r *rawInt64) init(value *int64) *rawInt64 {
+	r.value = value
+	return r
+}
+
+func (r *rawInt64) ValuePtr() interface{} {
+	return r.value
+}
+
+func (r *rawInt64) Ptrs() []interface{} {
+	return []interface{}{r.value}
+}
+
+type rawEncodedAtTimeTask struct {
+	*huedb.EncodedAtTimeTask
+	action      string
+	description string
+	lightSet    string
+	crypter     *huedb.Crypter
+}
+
+func (r *rawEncodedAtTimeTask) init(
+	bo *huedb.EncodedAtTimeTask) *rawEncodedAtTimeTask {
+	r.EncodedAtTimeTask = bo
+	return r
+}
+
+func (r *rawEncodedAtTimeTask) ValuePtr() interface{} {
+	return r.EncodedAtTimeTask
+}
+
+func (r *rawEncodedAtTimeTask) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.ScheduleId, &r.HueTaskId, &r.action, &r.description, &r.lightSet, &r.Time, &r.GroupId, &r.Recurrence}
+}
+
+func (r *rawEncodedAtTimeTask) Values() []interface{} {
+	return []interface{}{r.ScheduleId, r.HueTaskId, r.action, r.description, r.lightSet, r.Time, r.GroupId, r.Recurrence, r.Id}
+}
+
+func (r *rawEncodedAtTimeTask) Unmarshall() (err error) {
+	if r.Action, err = r.crypter.Decrypt(r.action); err != nil {
+		return
+	}
+	if r.Description, err = r.crypter.Decrypt(r.description); err != nil {
+		return
+	}
+	r.LightSet, err = r.crypter.Decrypt(r.lightSet)
+	return
+}
+
+func (r *rawEncodedAtTimeTask) Marshall() (err error) {
+	if r.action, err = r.crypter.Encrypt(r.Action); err != nil {
+		return
+	}
+	if r.description, err = r.crypter.Encrypt(r.Description); err != nil {
+		return
+	}
+	r.lightSet, err = r.crypter.Encrypt(r.LightSet)
+	return
+}
+
+type rawArchivedAtTimeTask struct {
+	*huedb.ArchivedAtTimeTask
+	action      string
+	description string
+	lightSet    string
+	status      int64
+	completedAt int64
+	crypter     *huedb.Crypter
+}
+
+func (r *rawArchivedAtTimeTask) init(
+	bo *huedb.ArchivedAtTimeTask) *rawArchivedAtTimeTask {
+	r.ArchivedAtTimeTask = bo
+	return r
+}
+
+func (r *rawArchivedAtTimeTask) ValuePtr() interface{} {
+	return r.ArchivedAtTimeTask
+}
+
+func (r *rawArchivedAtTimeTask) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.ScheduleId, &r.HueTaskId, &r.action, &r.description, &r.lightSet, &r.Time, &r.GroupId, &r.Recurrence, &r.status, &r.completedAt}
+}
+
+func (r *rawArchivedAtTimeTask) Unmarshall() (err error) {
+	if r.Action, err = r.crypter.Decrypt(r.action); err != nil {
+		return
+	}
+	if r.Description, err = r.crypter.Decrypt(r.description); err != nil {
+		return
+	}
+	if r.LightSet, err = r.crypter.Decrypt(r.lightSet); err != nil {
+		return
+	}
+	r.Status = huedb.AtTimeTaskStatus(r.status)
+	r.CompletedAt = time.Unix(r.completedAt, 0)
+	return
+}
+
+type rawEncodedScheduledTask struct {
+	*huedb.EncodedScheduledTask
+	sqlite_rw.SimpleRow
+}
+
+func (r *rawEncodedScheduledTask) init(
+	bo *huedb.EncodedScheduledTask) *rawEncodedScheduledTask {
+	r.EncodedScheduledTask = bo
+	return r
+}
+
+func (r *rawEncodedScheduledTask) ValuePtr() interface{} {
+	return r.EncodedScheduledTask
+}
+
+func (r *rawEncodedScheduledTask) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.HueTaskId, &r.Action, &r.Description, &r.LightSet, &r.Recurrence, &r.Enabled, &r.HighPriority}
+}
+
+func (r *rawEncodedScheduledTask) Values() []interface{} {
+	return []interface{}{r.HueTaskId, r.Action, r.Description, r.LightSet, r.Recurrence, r.Enabled, r.HighPriority, r.Id}
+}
+
+type rawUser struct {
+	*huedb.User
+	password string
+	role     int
+}
+
+func (r *rawUser) init(bo *huedb.User) *rawUser {
+	r.User = bo
+	return r
+}
+
+func (r *rawUser) ValuePtr() interface{} {
+	return r.User
+}
+
+func (r *rawUser) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.Name, &r.password, &r.role}
+}
+
+func (r *rawUser) Values() []interface{} {
+	return []interface{}{r.Name, r.password, r.role, r.Id}
+}
+
+func (r *rawUser) Unmarshall() error {
+	r.Password = passwords.Password(r.password)
+	r.Role = huedb.Role(r.role)
+	return nil
+}
+
+func (r *rawUser) Marshall() error {
+	r.password = string(r.Password)
+	r.role = int(r.Role)
+	return nil
+}
+
+type rawLightAlias struct {
+	*huedb.LightAlias
+	sqlite_rw.SimpleRow
+}
+
+func (r *rawLightAlias) init(bo *huedb.LightAlias) *rawLightAlias {
+	r.LightAlias = bo
+	return r
+}
+
+func (r *rawLightAlias) ValuePtr() interface{} {
+	return r.LightAlias
+}
+
+func (r *rawLightAlias) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.LightId, &r.Name}
+}
+
+func (r *rawLightAlias) Values() []interface{} {
+	return []interface{}{r.LightId, r.Name, r.Id}
+}
+
+type rawLightGroup struct {
+	*huedb.LightGroup
+	sqlite_rw.SimpleRow
+}
+
+func (r *rawLightGroup) init(bo *huedb.LightGroup) *rawLightGroup {
+	r.LightGroup = bo
+	return r
+}
+
+func (r *rawLightGroup) ValuePtr() interface{} {
+	return r.LightGroup
+}
+
+func (r *rawLightGroup) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.Name, &r.LightSet}
+}
+
+func (r *rawLightGroup) Values() []interface{} {
+	return []interface{}{r.Name, r.LightSet, r.Id}
+}
+
+type rawDescriptionOverride struct {
+	*huedb.DescriptionOverride
+	sqlite_rw.SimpleRow
+}
+
+func (r *rawDescriptionOverride) init(
+	bo *huedb.DescriptionOverride) *rawDescriptionOverride {
+	r.DescriptionOverride = bo
+	return r
+}
+
+func (r *rawDescriptionOverride) ValuePtr() interface{} {
+	return r.DescriptionOverride
+}
+
+func (r *rawDescriptionOverride) Ptrs() []interface{} {
+	return []interface{}{&r.HueTaskId, &r.Description}
+}
+
+type rawPreference struct {
+	*huedb.Preference
+	sqlite_rw.SimpleRow
+}
+
+func (r *rawPreference) init(bo *huedb.Preference) *rawPreference {
+	r.Preference = bo
+	return r
+}
+
+func (r *rawPreference) ValuePtr() interface{} {
+	return r.Preference
+}
+
+func (r *rawPreference) Ptrs() []interface{} {
+	return []interface{}{&r.UserId, &r.Key, &r.Value}
+}
+
+type rawSceneComponent struct {
+	*huedb.SceneComponent
+	sqlite_rw.SimpleRow
+}
+
+func (r *rawSceneComponent) init(
+	bo *huedb.SceneComponent) *rawSceneComponent {
+	r.SceneComponent = bo
+	return r
+}
+
+func (r *rawSceneComponent) ValuePtr() interface{} {
+	return r.SceneComponent
+}
+
+func (r *rawSceneComponent) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.NamedColorsId, &r.ComponentId, &r.LightSet, &r.LightOffset}
+}
+
+func (r *rawSceneComponent) Values() []interface{} {
+	return []interface{}{r.NamedColorsId, r.ComponentId, r.LightSet, r.LightOffset, r.Id}
+}
+
+type rawBridge struct {
+	*huedb.Bridge
+	user    string
+	crypter *huedb.Crypter
+}
+
+func (r *rawBridge) init(bo *huedb.Bridge) *rawBridge {
+	r.Bridge = bo
+	return r
+}
+
+func (r *rawBridge) ValuePtr() interface{} {
+	return r.Bridge
+}
+
+func (r *rawBridge) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.Name, &r.Host, &r.user}
+}
+
+func (r *rawBridge) Values() []interface{} {
+	return []interface{}{r.Name, r.Host, r.user, r.Id}
+}
+
+func (r *rawBridge) Unmarshall() (err error) {
+	r.User, err = r.crypter.Decrypt(r.user)
+	return
+}
+
+func (r *rawBridge) Marshall() (err error) {
+	r.user, err = r.crypter.Encrypt(r.User)
+	return
+}
+
+type rawWeatherSettings struct {
+	*huedb.WeatherSettings
+	pollInterval int64
+}
+
+func (r *rawWeatherSettings) init(
+	bo *huedb.WeatherSettings) *rawWeatherSettings {
+	r.WeatherSettings = bo
+	return r
+}
+
+func (r *rawWeatherSettings) ValuePtr() interface{} {
+	return r.WeatherSettings
+}
+
+func (r *rawWeatherSettings) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.Provider, &r.StationId, &r.APIKey, &r.pollInterval, &r.Units}
+}
+
+func (r *rawWeatherSettings) Values() []interface{} {
+	return []interface{}{r.Provider, r.StationId, r.APIKey, r.pollInterval, r.Units, r.Id}
+}
+
+func (r *rawWeatherSettings) Unmarshall() error {
+	r.PollInterval = time.Duration(r.pollInterval) * time.Second
+	return nil
+}
+
+func (r *rawWeatherSettings) Marshall() error {
+	r.pollInterval = int64(r.PollInterval / time.Second)
+	return nil
+}
+
+type rawScheduleProfile struct {
+	*huedb.ScheduleProfile
+	scheduledTaskIds string
+	active           int
+}
+
+func (r *rawScheduleProfile) init(
+	bo *huedb.ScheduleProfile) *rawScheduleProfile {
+	r.ScheduleProfile = bo
+	return r
+}
+
+func (r *rawScheduleProfile) ValuePtr() interface{} {
+	return r.ScheduleProfile
+}
+
+func (r *rawScheduleProfile) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.Name, &r.scheduledTaskIds, &r.active}
+}
+
+func (r *rawScheduleProfile) Values() []interface{} {
+	return []interface{}{r.Name, r.scheduledTaskIds, r.Id}
+}
+
+func (r *rawScheduleProfile) Unmarshall() error {
+	r.Active = r.active != 0
+	r.ScheduledTaskIds = nil
+	if r.scheduledTaskIds == "" {
+		return nil
+	}
+	for _, idStr := range strings.Split(r.scheduledTaskIds, ",") {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return err
+		}
+		r.ScheduledTaskIds = append(r.ScheduledTaskIds, id)
+	}
+	return nil
+}
+
+func (r *rawScheduleProfile) Marshall() error {
+	ids := sortedUniqueIds(r.ScheduledTaskIds)
+	idStrs := make([]string, len(ids))
+	for i := range ids {
+		idStrs[i] = strconv.FormatInt(ids[i], 10)
+	}
+	r.scheduledTaskIds = strings.Join(idStrs, ",")
+	return nil
+}
+
+type rawSearchResult struct {
+	*huedb.SearchResult
+	description string
+	crypter     *huedb.Crypter
+}
+
+func (r *rawSearchResult) init(bo *huedb.SearchResult) *rawSearchResult {
+	r.SearchResult = bo
+	return r
+}
+
+func (r *rawSearchResult) ValuePtr() interface{} {
+	return r.SearchResult
+}
+
+func (r *rawSearchResult) Ptrs() []interface{} {
+	return []interface{}{&r.Kind, &r.Id, &r.description}
+}
+
+func (r *rawSearchResult) Unmarshall() (err error) {
+	r.Description, err = r.crypter.Decrypt(r.description)
+	return
+}
+
+type rawSensorEvent struct {
+	*huedb.SensorEvent
+	time int64
+}
+
+func (r *rawSensorEvent) init(bo *huedb.SensorEvent) *rawSensorEvent {
+	r.SensorEvent = bo
+	return r
+}
+
+func (r *rawSensorEvent) ValuePtr() interface{} {
+	return r.SensorEvent
+}
+
+func (r *rawSensorEvent) Ptrs() []interface{} {
+	return []interface{}{&r.Id, &r.SensorId, &r.Type, &r.Value, &r.time}
+}
+
+func (r *rawSensorEvent) Values() []interface{} {
+	return []interface{}{r.SensorId, r.Type, r.Value, r.time, r.Id}
+}
+
+func (r *rawSensorEvent) Unmarshall() error {
+	r.Time = time.Unix(r.time, 0)
+	return nil
+}
+
+func (r *rawSensorEvent) Marshall() error {
+	r.time = r.Time.Unix()
+	return nil
+}
+
+type rawWeatherObservation struct {
+	*huedb.WeatherObservation
+	time int64
+}
+
+func (r *rawWeatherObservation) init(
+	bo *huedb.WeatherObservation) *rawWeatherObservation {
+	r.WeatherObservation = bo
+	return r
+}
+
+func (r *rawWeatherObservation) ValuePtr() interface{} {
+	return r.WeatherObservation
+}
+
+func (r *rawWeatherObservation) Ptrs() []interface{} {
+	return []interface{}{
+		&r.Id, &r.Station, &r.Temperature, &r.Weather, &r.WindSpeed, &r.time}
+}
+
+func (r *rawWeatherObservation) Values() []interface{} {
+	return []interface{}{
+		r.Station, r.Temperature, r.Weather, r.WindSpeed, r.time, r.Id}
+}
+
+func (r *rawWeatherObservation) Unmarshall() error {
+	r.Time = time.Unix(r.time, 0)
+	return nil
+}
+
+func (r *rawWeatherObservation) Marshall() error {
+	r.time = r.Time.Unix()
+	return nil
 }
@@ -1,12 +1,24 @@
 package for_sqlite_test
 
 import (
+	"context"
+	"fmt"
 	"github.com/keep94/appcommon/db/sqlite_db"
+	"github.com/keep94/goconsume"
 	"github.com/keep94/gosqlite/sqlite"
+	"github.com/keep94/marvin/huedb"
 	"github.com/keep94/marvin/huedb/fixture"
 	"github.com/keep94/marvin/huedb/for_sqlite"
 	"github.com/keep94/marvin/huedb/sqlite_setup"
+	"github.com/keep94/marvin/huedb/storetest"
+	"github.com/keep94/marvin/ops"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNamedColorsById(t *testing.T) {
@@ -33,6 +45,482 @@ func TestRemoveNamedColors(t *testing.T) {
 	fixture.RemoveNamedColors(t, for_sqlite.New(db))
 }
 
+func TestNamedColorsPage(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NamedColorsPage(t, for_sqlite.New(db))
+}
+
+func TestNamedColorsOrdered(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NamedColorsOrdered(t, for_sqlite.New(db))
+}
+
+func TestNamedColorsByDescription(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NamedColorsByDescription(t, for_sqlite.New(db))
+}
+
+func TestNamedColorsHistory(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NamedColorsHistory(t, for_sqlite.New(db))
+}
+
+func TestScheduledTasks(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.ScheduledTasks(t, for_sqlite.New(db))
+}
+
+func TestRemoveExpired(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.RemoveExpired(t, for_sqlite.New(db))
+}
+
+func TestUpdateEncodedAtTimeTaskTime(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.UpdateEncodedAtTimeTaskTime(t, for_sqlite.New(db))
+}
+
+func TestArchiveEncodedAtTimeTask(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.ArchiveEncodedAtTimeTask(t, for_sqlite.New(db))
+}
+
+func TestUsers(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.Users(t, for_sqlite.New(db))
+}
+
+func TestLightAliases(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.LightAliases(t, for_sqlite.New(db))
+}
+
+func TestPreferences(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.Preferences(t, for_sqlite.New(db))
+}
+
+func TestAddNamedColorsBatch(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.AddNamedColorsBatch(t, for_sqlite.New(db))
+}
+
+func TestNamedColorsByIds(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.NamedColorsByIds(t, for_sqlite.New(db))
+}
+
+func TestSceneComponents(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.SceneComponents(t, for_sqlite.New(db))
+}
+
+func TestWeatherSettings(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.WeatherSettings(t, for_sqlite.New(db))
+}
+
+func TestBridges(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.Bridges(t, for_sqlite.New(db))
+}
+
+func TestDescriptionOverrides(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.DescriptionOverrides(t, for_sqlite.New(db))
+}
+
+func TestLastLightColors(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.LastLightColors(t, for_sqlite.New(db))
+}
+
+func TestSearch(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.Search(t, for_sqlite.New(db))
+}
+
+func TestSearchWithoutIndex(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	err := db.Do(func(conn *sqlite.Conn) error {
+		for _, table := range []string{"named_colors", "scheduled_tasks"} {
+			for _, suffix := range []string{"insert", "update", "delete"} {
+				if err := conn.Exec(fmt.Sprintf(
+					"drop trigger %s_search_%s", table, suffix)); err != nil {
+					return err
+				}
+			}
+		}
+		return conn.Exec("drop table search_index")
+	})
+	if err != nil {
+		t.Fatalf("Error dropping search index: %v", err)
+	}
+	fixture.Search(t, for_sqlite.New(db))
+}
+
+func TestSetUpTablesIndexesExistingRows(t *testing.T) {
+	conn, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	db := sqlite_db.New(conn)
+	defer closeDb(t, db)
+	err = db.Do(func(conn *sqlite.Conn) error {
+		if err := conn.Exec("create table named_colors (id INTEGER PRIMARY KEY AUTOINCREMENT, description TEXT, colors TEXT)"); err != nil {
+			return err
+		}
+		if err := conn.Exec("insert into named_colors (description, colors) values ('Dinner', '{}')"); err != nil {
+			return err
+		}
+		return sqlite_setup.SetUpTables(conn)
+	})
+	if err != nil {
+		t.Fatalf("Error setting up tables: %v", err)
+	}
+	var results []huedb.SearchResult
+	if err := for_sqlite.New(db).Search(
+		nil, "dinner", goconsume.AppendTo(&results)); err != nil {
+		t.Fatalf("Got error searching: %v", err)
+	}
+	expected := []huedb.SearchResult{
+		{Kind: huedb.NamedColorsSearchResult, Id: 1, Description: "Dinner"},
+	}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+}
+
+func TestScheduleProfiles(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.ScheduleProfiles(t, for_sqlite.New(db))
+}
+
+func TestSensorEvents(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.SensorEvents(t, for_sqlite.New(db))
+}
+
+func TestWeatherObservations(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.WeatherObservations(t, for_sqlite.New(db))
+}
+
+func TestCancelledContext(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.CancelledContext(t, for_sqlite.New(db))
+}
+
+func TestInterruptWithContext(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := for_sqlite.New(db)
+	for _, description := range []string{"Foo", "Bar", "Baz"} {
+		namedColors := ops.NamedColors{Description: description}
+		if err := store.AddNamedColors(nil, &namedColors); err != nil {
+			t.Fatalf("Got error adding: %v", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var count int
+	consumer := goconsume.ConsumerFunc(func(ptr interface{}) {
+		count++
+		if count == 1 {
+			cancel()
+			// Give the store time to interrupt the statement.
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+	if err := store.WithContext(ctx).NamedColors(
+		nil, consumer); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 row before interrupt, got %d", count)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (interface{}, func()) {
+		db := openDb(t)
+		return for_sqlite.New(db), func() { closeDb(t, db) }
+	})
+}
+
+func TestSetUpTablesAddsRecurrence(t *testing.T) {
+	conn, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	db := sqlite_db.New(conn)
+	defer closeDb(t, db)
+	err = db.Do(func(conn *sqlite.Conn) error {
+		err := conn.Exec("create table at_time_tasks (id INTEGER PRIMARY KEY AUTOINCREMENT, schedule_id TEXT, hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, time INTEGER, group_id TEXT)")
+		if err != nil {
+			return err
+		}
+		err = conn.Exec("insert into at_time_tasks (schedule_id, hue_task_id, action, description, light_set, time, group_id) values ('abc', 3, '', 'Old', '', 1400000000, 'legacy')")
+		if err != nil {
+			return err
+		}
+		return sqlite_setup.SetUpTables(conn)
+	})
+	if err != nil {
+		t.Fatalf("Error setting up tables: %v", err)
+	}
+	store := for_sqlite.New(db)
+	var tasks []huedb.EncodedAtTimeTask
+	if err := store.EncodedAtTimeTasks(
+		nil, "legacy", goconsume.AppendTo(&tasks)); err != nil {
+		t.Fatalf("Got error reading database: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Description != "Old" || tasks[0].Recurrence != "" {
+		t.Errorf("Expected one task without recurrence, got %v", tasks)
+	}
+	fixture.UpdateEncodedAtTimeTaskTime(t, store)
+}
+
+func TestMetricsStore(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	var collector huedb.MetricsCollector
+	fixture.NamedColors(
+		t, huedb.NewMetricsStore(for_sqlite.New(db), &collector))
+	if out := len(collector.Metrics()); out != 2 {
+		t.Errorf("Expected metrics for 2 methods, got %d", out)
+	}
+}
+
+func TestMigrateLightColors(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	err := db.Do(func(conn *sqlite.Conn) error {
+		return conn.Exec(
+			"insert into named_colors (colors, description) values (?, ?)",
+			"0|3|5000|3000|98|6|-1|0|-1",
+			"Legacy")
+	})
+	if err != nil {
+		t.Fatalf("Got error inserting legacy row: %v", err)
+	}
+	store := for_sqlite.New(db)
+	var before ops.NamedColors
+	if err := store.NamedColorsById(nil, 1, &before); err != nil {
+		t.Fatalf("Got error reading legacy row: %v", err)
+	}
+	if err := store.MigrateLightColors(nil); err != nil {
+		t.Fatalf("Got error migrating: %v", err)
+	}
+	var encoded string
+	err = db.Do(func(conn *sqlite.Conn) error {
+		stmt, err := conn.Prepare("select colors from named_colors where id = 1")
+		if err != nil {
+			return err
+		}
+		defer stmt.Finalize()
+		if err := stmt.Exec(); err != nil {
+			return err
+		}
+		stmt.Next()
+		return stmt.Scan(&encoded)
+	})
+	if err != nil {
+		t.Fatalf("Got error reading migrated row: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "{") {
+		t.Errorf("Expected JSON colors, got %s", encoded)
+	}
+	var after ops.NamedColors
+	if err := store.NamedColorsById(nil, 1, &after); err != nil {
+		t.Fatalf("Got error reading migrated row: %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("Expected %v, got %v", before, after)
+	}
+}
+
+func TestWithCrypter(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	crypter, err := huedb.NewCrypter([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Got error creating crypter: %v", err)
+	}
+	store := for_sqlite.New(db).WithCrypter(crypter)
+	fixture.UpdateNamedColors(t, store)
+	fixture.NamedColorsHistory(t, store)
+	fixture.UpdateEncodedAtTimeTaskTime(t, store)
+	fixture.Bridges(t, store)
+	var encoded string
+	err = db.Do(func(conn *sqlite.Conn) error {
+		stmt, err := conn.Prepare("select colors from named_colors limit 1")
+		if err != nil {
+			return err
+		}
+		defer stmt.Finalize()
+		if err := stmt.Exec(); err != nil {
+			return err
+		}
+		stmt.Next()
+		return stmt.Scan(&encoded)
+	})
+	if err != nil {
+		t.Fatalf("Got error reading raw colors: %v", err)
+	}
+	if strings.HasPrefix(encoded, "{") {
+		t.Errorf("Expected encrypted colors, got %s", encoded)
+	}
+	var namedColors ops.NamedColors
+	if err := for_sqlite.New(db).NamedColorsById(
+		nil, 1, &namedColors); err != huedb.ErrBadCiphertext {
+		t.Errorf("Expected huedb.ErrBadCiphertext, got %v", err)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := for_sqlite.New(db)
+	foo := ops.NamedColors{Description: "Foo"}
+	if err := store.AddNamedColors(nil, &foo); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	path := filepath.Join(tempDir(t), "backup.db")
+	if err := store.Backup(nil, path); err != nil {
+		t.Fatalf("Got error backing up: %v", err)
+	}
+	bar := ops.NamedColors{Description: "Bar"}
+	if err := store.AddNamedColors(nil, &bar); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	if err := store.Restore(nil, path); err != nil {
+		t.Fatalf("Got error restoring: %v", err)
+	}
+	var results []ops.NamedColors
+	if err := store.NamedColors(nil, goconsume.AppendTo(&results)); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if len(results) != 1 || results[0].Description != "Foo" {
+		t.Errorf("Expected only Foo, got %v", results)
+	}
+	if err := store.Restore(
+		nil, filepath.Join(tempDir(t), "missing.db")); err == nil {
+		t.Error("Expected error restoring missing file.")
+	}
+}
+
+func TestWithReader(t *testing.T) {
+	path := filepath.Join(tempDir(t), "hue.db")
+	conn, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	if err := sqlite_setup.EnableWAL(conn); err != nil {
+		t.Fatalf("Error enabling WAL: %v", err)
+	}
+	db := sqlite_db.New(conn)
+	defer closeDb(t, db)
+	if err := db.Do(sqlite_setup.SetUpTables); err != nil {
+		t.Fatalf("Error creating tables: %v", err)
+	}
+	readConn, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	reader := sqlite_db.New(readConn)
+	defer closeDb(t, reader)
+	store := for_sqlite.New(db).WithReader(reader)
+	fixture.NamedColors(t, store)
+
+	// Reads don't wait behind a write in progress and don't see it.
+	err = db.Do(func(conn *sqlite.Conn) error {
+		if err := conn.Exec(
+			"insert into named_colors (description, colors) values ('Baz', '{}')"); err != nil {
+			return err
+		}
+		count, err := store.NamedColorsCount(nil)
+		if err != nil {
+			return err
+		}
+		if count != 2 {
+			t.Errorf("Expected 2, got %d", count)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Got error reading during write: %v", err)
+	}
+}
+
+func TestEnableWALInMemory(t *testing.T) {
+	conn, err := sqlite.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	defer conn.Close()
+	if err := sqlite_setup.EnableWAL(conn); err == nil {
+		t.Error("Expected error enabling WAL on in memory database")
+	}
+}
+
+func TestNewWithRetry(t *testing.T) {
+	path := filepath.Join(tempDir(t), "hue.db")
+	conn, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	db := sqlite_db.New(conn)
+	defer closeDb(t, db)
+	if err := db.Do(sqlite_setup.SetUpTables); err != nil {
+		t.Fatalf("Error creating tables: %v", err)
+	}
+	locker, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	defer locker.Close()
+	if err := locker.Exec("begin exclusive"); err != nil {
+		t.Fatalf("Error locking database: %v", err)
+	}
+	namedColors := ops.NamedColors{Description: "Foo"}
+	if err := for_sqlite.New(db).AddNamedColors(nil, &namedColors); err == nil {
+		t.Error("Expected busy error without retry.")
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		locker.Exec("commit")
+	}()
+	store := for_sqlite.NewWithRetry(db, 5*time.Second)
+	if err := store.AddNamedColors(nil, &namedColors); err != nil {
+		t.Errorf("Got error adding with retry: %v", err)
+	}
+}
+
 func closeDb(t *testing.T, db *sqlite_db.Db) {
 	if err := db.Close(); err != nil {
 		t.Errorf("Error closing database: %v", err)
@@ -53,3 +541,14 @@ func openDb(t *testing.T) *sqlite_db.Db {
 	}
 	return db
 }
+
+// tempDir returns a new temporary directory that is removed when t
+// finishes.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "for_sqlite")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
@@ -0,0 +1,21 @@
+package for_sqlite
+
+/*
+#cgo LDFLAGS: -lsqlite3
+
+#include <sqlite3.h>
+*/
+import "C"
+
+import (
+	"github.com/keep94/gosqlite/sqlite"
+	"unsafe"
+)
+
+// interrupt makes the statement running on conn fail with
+// sqlite.ErrInterrupt. gosqlite does not wrap sqlite3_interrupt, so
+// interrupt reads the sqlite3 handle from conn, which is the only field
+// of sqlite.Conn.
+func interrupt(conn *sqlite.Conn) {
+	C.sqlite3_interrupt(*(**C.sqlite3)(unsafe.Pointer(conn)))
+}
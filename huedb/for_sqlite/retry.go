@@ -0,0 +1,62 @@
+package for_sqlite
+
+import (
+	"github.com/keep94/appcommon/db/sqlite_db"
+	"github.com/keep94/gosqlite/sqlite"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	kInitialRetryWait = 10 * time.Millisecond
+	kMaxRetryWait     = 500 * time.Millisecond
+)
+
+// NewWithRetry works like New except that the returned Store retries
+// operations that fail because the database is busy or locked. Between
+// tries, the returned Store waits a random time that roughly doubles
+// with each try. The returned Store gives up and returns the error once
+// retrying would go past maxWait. Operations that run within a caller
+// supplied transaction are not retried since the caller owns the
+// transaction.
+func NewWithRetry(db *sqlite_db.Db, maxWait time.Duration) Store {
+	return Store{db: &retryingDoer{delegate: db, maxWait: maxWait}}
+}
+
+type retryingDoer struct {
+	delegate sqlite_db.Doer
+	maxWait  time.Duration
+}
+
+func (r *retryingDoer) Do(action sqlite_db.Action) error {
+	deadline := time.Now().Add(r.maxWait)
+	wait := kInitialRetryWait
+	for {
+		err := r.delegate.Do(action)
+		if !isBusy(err) {
+			return err
+		}
+		// Sleep between half and all of wait so that competing writers
+		// don't retry in lock step.
+		jittered := wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		if time.Now().Add(jittered).After(deadline) {
+			return err
+		}
+		time.Sleep(jittered)
+		if wait *= 2; wait > kMaxRetryWait {
+			wait = kMaxRetryWait
+		}
+	}
+}
+
+// isBusy returns true if err means that the database is busy or locked.
+// sqlite errors carry the error code only in their message.
+func isBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, sqlite.ErrBusy.Error()) ||
+		strings.HasPrefix(msg, sqlite.ErrLocked.Error())
+}
@@ -0,0 +1,48 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/ops"
+	"time"
+)
+
+// NamedColorsRevision is a prior version of named colors. Stores that
+// keep history record a revision each time they update or remove named
+// colors.
+type NamedColorsRevision struct {
+	// The unique database dependent numeric ID of this revision.
+	Id int64
+
+	// The named colors as they were before the update or removal.
+	// NamedColors.Id is the id of the named colors.
+	ops.NamedColors
+
+	// When the named colors were updated or removed.
+	UpdatedAt time.Time
+
+	// True if the named colors were removed rather than updated.
+	Deleted bool
+}
+
+type NamedColorsHistoryRunner interface {
+	// NamedColorsHistory gets the revisions of the named colors with given
+	// id newest first. id may be the id of removed named colors.
+	NamedColorsHistory(
+		t db.Transaction, id int64, consumer goconsume.Consumer) error
+}
+
+type DeletedNamedColorsRunner interface {
+	// DeletedNamedColors gets the last revision of each removed named
+	// colors that has not been restored, most recently removed first.
+	DeletedNamedColors(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+type RestoreNamedColorsRunner interface {
+	// RestoreNamedColors restores named colors to the revision with
+	// given id. If the named colors were removed, RestoreNamedColors adds
+	// them back with their original id. Otherwise, RestoreNamedColors
+	// updates them which records their current version as a new revision.
+	// RestoreNamedColors returns ErrNoSuchId if there is no such revision.
+	RestoreNamedColors(t db.Transaction, revisionId int64) error
+}
@@ -0,0 +1,1539 @@
+// Package in_memory provides an in memory implementation of interfaces in
+// huedb package. It is for tests and for running without a database.
+package in_memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/ops"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errDuplicateName = errors.New("in_memory: Duplicate name.")
+)
+
+// Store implements the huedb interfaces using maps. Store ignores the
+// db.Transaction passed to its methods. Like a database, Store assigns
+// ids starting at 1 and never reuses them. Store is safe to use with
+// multiple goroutines.
+type Store struct {
+	mutex         sync.Mutex
+	namedColors   map[int64]rawNamedColors
+	atTimeTasks   map[int64]huedb.EncodedAtTimeTask
+	scheduled     map[int64]huedb.EncodedScheduledTask
+	history       []revision
+	users         map[int64]huedb.User
+	lastUserId    int64
+	aliases       map[int64]huedb.LightAlias
+	lastAliasId   int64
+	groups        map[int64]huedb.LightGroup
+	lastGroupId   int64
+	preferences   map[preferenceKey]string
+	descriptions  huedb.DescriptionMap
+	lastColors    ops.LightColors
+	components    map[int64]huedb.SceneComponent
+	lastCompId    int64
+	bridges       map[int64]huedb.Bridge
+	lastBridgeId  int64
+	weather       map[int64]huedb.WeatherSettings
+	lastWeatherId int64
+	lastColorsId  int64
+	lastAtTimeId  int64
+	archive       []huedb.ArchivedAtTimeTask
+	lastArchiveId int64
+	profiles      map[int64]huedb.ScheduleProfile
+	lastProfileId int64
+	sensorEvents  []huedb.SensorEvent
+	lastSensorId  int64
+	observations  []huedb.WeatherObservation
+	lastObsId     int64
+	lastSchedId   int64
+}
+
+// New returns a new, empty Store.
+func New() *Store {
+	return &Store{
+		namedColors:  make(map[int64]rawNamedColors),
+		atTimeTasks:  make(map[int64]huedb.EncodedAtTimeTask),
+		scheduled:    make(map[int64]huedb.EncodedScheduledTask),
+		users:        make(map[int64]huedb.User),
+		aliases:      make(map[int64]huedb.LightAlias),
+		groups:       make(map[int64]huedb.LightGroup),
+		preferences:  make(map[preferenceKey]string),
+		descriptions: make(huedb.DescriptionMap),
+		lastColors:   make(ops.LightColors),
+		components:   make(map[int64]huedb.SceneComponent),
+		bridges:      make(map[int64]huedb.Bridge),
+		weather:      make(map[int64]huedb.WeatherSettings),
+		profiles:     make(map[int64]huedb.ScheduleProfile),
+	}
+}
+
+// WithContext returns s. Calls to s never wait on a database so there is
+// nothing for ctx to cancel.
+func (s *Store) WithContext(ctx context.Context) huedb.Store {
+	return s
+}
+
+// NewDoer returns a db.Doer that runs actions with a nil Transaction.
+// Actions are not atomic.
+func NewDoer() db.Doer {
+	return doer{}
+}
+
+func (s *Store) NamedColorsById(
+	t db.Transaction, id int64, namedColors *ops.NamedColors) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	raw, ok := s.namedColors[id]
+	if !ok {
+		return huedb.ErrNoSuchId
+	}
+	return raw.unmarshall(id, namedColors)
+}
+
+func (s *Store) NamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range s.namedColorsIds() {
+		if !consumer.CanConsume() {
+			break
+		}
+		var namedColors ops.NamedColors
+		if err := s.namedColors[id].unmarshall(id, &namedColors); err != nil {
+			return err
+		}
+		consumer.Consume(&namedColors)
+	}
+	return nil
+}
+
+func (s *Store) NamedColorsOrdered(
+	t db.Transaction,
+	order huedb.NamedColorsOrder,
+	consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ids := s.namedColorsIds()
+	all := make([]ops.NamedColors, len(ids))
+	for i, id := range ids {
+		if err := s.namedColors[id].unmarshall(id, &all[i]); err != nil {
+			return err
+		}
+	}
+	lastRevision := make(map[int64]int)
+	for i := range s.history {
+		lastRevision[s.history[i].namedColorsId] = i + 1
+	}
+	less := func(i, j int) bool {
+		return all[i].Id < all[j].Id
+	}
+	switch order.By {
+	case huedb.OrderByDescription:
+		less = func(i, j int) bool {
+			return strings.ToLower(all[i].Description) < strings.ToLower(all[j].Description)
+		}
+	case huedb.OrderByUpdatedAt:
+		less = func(i, j int) bool {
+			return lastRevision[all[i].Id] < lastRevision[all[j].Id]
+		}
+	}
+	if order.Descending {
+		ascending := less
+		less = func(i, j int) bool {
+			return ascending(j, i)
+		}
+	}
+	sort.SliceStable(all, less)
+	for i := range all {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&all[i])
+	}
+	return nil
+}
+
+func (s *Store) NamedColorsByIds(
+	t db.Transaction, ids []int64, consumer goconsume.Consumer) error {
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range s.namedColorsIds() {
+		if !consumer.CanConsume() {
+			break
+		}
+		if !wanted[id] {
+			continue
+		}
+		var namedColors ops.NamedColors
+		if err := s.namedColors[id].unmarshall(id, &namedColors); err != nil {
+			return err
+		}
+		consumer.Consume(&namedColors)
+	}
+	return nil
+}
+
+func (s *Store) NamedColorsPage(
+	t db.Transaction, offset, limit int, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ids := s.namedColorsIds()
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(ids) {
+		offset = len(ids)
+	}
+	ids = ids[offset:]
+	if limit >= 0 && limit < len(ids) {
+		ids = ids[:limit]
+	}
+	for _, id := range ids {
+		if !consumer.CanConsume() {
+			break
+		}
+		var namedColors ops.NamedColors
+		if err := s.namedColors[id].unmarshall(id, &namedColors); err != nil {
+			return err
+		}
+		consumer.Consume(&namedColors)
+	}
+	return nil
+}
+
+func (s *Store) NamedColorsCount(t db.Transaction) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.namedColors), nil
+}
+
+func (s *Store) NamedColorsByDescription(
+	t db.Transaction, pattern string, consumer goconsume.Consumer) error {
+	pattern = strings.ToLower(pattern)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range s.namedColorsIds() {
+		if !consumer.CanConsume() {
+			break
+		}
+		raw := s.namedColors[id]
+		if !strings.Contains(strings.ToLower(raw.Description), pattern) {
+			continue
+		}
+		var namedColors ops.NamedColors
+		if err := raw.unmarshall(id, &namedColors); err != nil {
+			return err
+		}
+		consumer.Consume(&namedColors)
+	}
+	return nil
+}
+
+func (s *Store) AddNamedColors(
+	t db.Transaction, namedColors *ops.NamedColors) error {
+	raw, err := marshallNamedColors(namedColors)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastColorsId++
+	s.namedColors[s.lastColorsId] = raw
+	namedColors.Id = s.lastColorsId
+	return nil
+}
+
+func (s *Store) AddNamedColorsBatch(
+	t db.Transaction, batch []*ops.NamedColors) error {
+	raws := make([]rawNamedColors, len(batch))
+	for i, namedColors := range batch {
+		var err error
+		if raws[i], err = marshallNamedColors(namedColors); err != nil {
+			return err
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, namedColors := range batch {
+		s.lastColorsId++
+		s.namedColors[s.lastColorsId] = raws[i]
+		namedColors.Id = s.lastColorsId
+	}
+	return nil
+}
+
+// MigrateLightColors does nothing because Store always encodes colors in
+// the current format.
+func (s *Store) MigrateLightColors(t db.Transaction) error {
+	return nil
+}
+
+func (s *Store) UpdateNamedColors(
+	t db.Transaction, namedColors *ops.NamedColors) error {
+	raw, err := marshallNamedColors(namedColors)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.namedColors[namedColors.Id]; ok {
+		s.addRevision(namedColors.Id, false)
+		s.namedColors[namedColors.Id] = raw
+	}
+	return nil
+}
+
+func (s *Store) RemoveNamedColors(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.namedColors[id]; ok {
+		s.addRevision(id, true)
+		delete(s.namedColors, id)
+	}
+	return nil
+}
+
+func (s *Store) NamedColorsHistory(
+	t db.Transaction, id int64, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := len(s.history) - 1; i >= 0 && consumer.CanConsume(); i-- {
+		if s.history[i].namedColorsId != id {
+			continue
+		}
+		var result huedb.NamedColorsRevision
+		if err := s.history[i].unmarshall(int64(i+1), &result); err != nil {
+			return err
+		}
+		consumer.Consume(&result)
+	}
+	return nil
+}
+
+func (s *Store) DeletedNamedColors(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	seen := make(map[int64]bool)
+	for i := len(s.history) - 1; i >= 0 && consumer.CanConsume(); i-- {
+		id := s.history[i].namedColorsId
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, ok := s.namedColors[id]; ok || !s.history[i].deleted {
+			continue
+		}
+		var result huedb.NamedColorsRevision
+		if err := s.history[i].unmarshall(int64(i+1), &result); err != nil {
+			return err
+		}
+		consumer.Consume(&result)
+	}
+	return nil
+}
+
+func (s *Store) RestoreNamedColors(t db.Transaction, revisionId int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if revisionId < 1 || revisionId > int64(len(s.history)) {
+		return huedb.ErrNoSuchId
+	}
+	restored := s.history[revisionId-1]
+	if _, ok := s.namedColors[restored.namedColorsId]; ok {
+		s.addRevision(restored.namedColorsId, false)
+	}
+	s.namedColors[restored.namedColorsId] = restored.rawNamedColors
+	return nil
+}
+
+func (s *Store) EncodedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range s.atTimeTaskIds() {
+		if !consumer.CanConsume() {
+			break
+		}
+		task := s.atTimeTasks[id]
+		if task.GroupId != groupId {
+			continue
+		}
+		consumer.Consume(&task)
+	}
+	return nil
+}
+
+func (s *Store) AddEncodedAtTimeTask(
+	t db.Transaction, task *huedb.EncodedAtTimeTask) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastAtTimeId++
+	task.Id = s.lastAtTimeId
+	s.atTimeTasks[task.Id] = *task
+	return nil
+}
+
+func (s *Store) RemoveEncodedAtTimeTaskByScheduleId(
+	t db.Transaction, groupId, scheduleId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, task := range s.atTimeTasks {
+		if task.GroupId == groupId && task.ScheduleId == scheduleId {
+			delete(s.atTimeTasks, id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) UpdateEncodedAtTimeTaskTime(
+	t db.Transaction,
+	groupId, scheduleId, newScheduleId string,
+	newTime time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, task := range s.atTimeTasks {
+		if task.GroupId == groupId && task.ScheduleId == scheduleId {
+			task.ScheduleId = newScheduleId
+			task.Time = newTime.Unix()
+			s.atTimeTasks[id] = task
+		}
+	}
+	return nil
+}
+
+func (s *Store) RemoveExpired(t db.Transaction, before time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, task := range s.atTimeTasks {
+		if task.Time < before.Unix() {
+			delete(s.atTimeTasks, id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) ArchiveEncodedAtTimeTask(
+	t db.Transaction,
+	groupId, scheduleId string,
+	status huedb.AtTimeTaskStatus,
+	completedAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, task := range s.atTimeTasks {
+		if task.GroupId == groupId && task.ScheduleId == scheduleId {
+			s.lastArchiveId++
+			task.Id = s.lastArchiveId
+			s.archive = append(s.archive, huedb.ArchivedAtTimeTask{
+				EncodedAtTimeTask: task,
+				Status:            status,
+				CompletedAt:       time.Unix(completedAt.Unix(), 0),
+			})
+			delete(s.atTimeTasks, id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) ArchivedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	var result []huedb.ArchivedAtTimeTask
+	for _, task := range s.archive {
+		if task.GroupId == groupId {
+			result = append(result, task)
+		}
+	}
+	s.mutex.Unlock()
+	sort.SliceStable(result, func(i, j int) bool {
+		if !result[i].CompletedAt.Equal(result[j].CompletedAt) {
+			return result[i].CompletedAt.After(result[j].CompletedAt)
+		}
+		return result[i].Id > result[j].Id
+	})
+	for i := range result {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&result[i])
+	}
+	return nil
+}
+
+func (s *Store) ClearEncodedAtTimeTasks(t db.Transaction) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.atTimeTasks = make(map[int64]huedb.EncodedAtTimeTask)
+	return nil
+}
+
+func (s *Store) EncodedScheduledTaskById(
+	t db.Transaction, id int64, task *huedb.EncodedScheduledTask) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.scheduled[id]
+	if !ok {
+		return huedb.ErrNoSuchId
+	}
+	*task = stored
+	return nil
+}
+
+func (s *Store) EncodedScheduledTasks(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range s.scheduledIds() {
+		if !consumer.CanConsume() {
+			break
+		}
+		task := s.scheduled[id]
+		consumer.Consume(&task)
+	}
+	return nil
+}
+
+func (s *Store) AddEncodedScheduledTask(
+	t db.Transaction, task *huedb.EncodedScheduledTask) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastSchedId++
+	task.Id = s.lastSchedId
+	s.scheduled[task.Id] = *task
+	return nil
+}
+
+func (s *Store) UpdateEncodedScheduledTask(
+	t db.Transaction, task *huedb.EncodedScheduledTask) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.scheduled[task.Id]; ok {
+		s.scheduled[task.Id] = *task
+	}
+	return nil
+}
+
+func (s *Store) RemoveEncodedScheduledTask(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.scheduled, id)
+	return nil
+}
+
+func (s *Store) UserById(
+	t db.Transaction, id int64, user *huedb.User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.users[id]
+	if !ok {
+		return huedb.ErrNoSuchId
+	}
+	*user = stored
+	return nil
+}
+
+func (s *Store) UserByName(
+	t db.Transaction, name string, user *huedb.User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, stored := range s.users {
+		if stored.Name == name {
+			*user = stored
+			return nil
+		}
+	}
+	return huedb.ErrNoSuchId
+}
+
+func (s *Store) Users(t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	users := make([]huedb.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+	for i := range users {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&users[i])
+	}
+	return nil
+}
+
+func (s *Store) AddUser(t db.Transaction, user *huedb.User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.nameTaken(user.Name, 0) {
+		return errDuplicateName
+	}
+	s.lastUserId++
+	user.Id = s.lastUserId
+	s.users[user.Id] = *user
+	return nil
+}
+
+func (s *Store) UpdateUser(t db.Transaction, user *huedb.User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.users[user.Id]; !ok {
+		return nil
+	}
+	if s.nameTaken(user.Name, user.Id) {
+		return errDuplicateName
+	}
+	s.users[user.Id] = *user
+	return nil
+}
+
+func (s *Store) RemoveUser(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.users, id)
+	return nil
+}
+
+// nameTaken returns true if a user other than the one with exceptId has
+// name. Caller must hold the lock.
+func (s *Store) nameTaken(name string, exceptId int64) bool {
+	for id, user := range s.users {
+		if id != exceptId && user.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) LightAliases(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	aliases := make([]huedb.LightAlias, 0, len(s.aliases))
+	for _, alias := range s.aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].Name < aliases[j].Name
+	})
+	for i := range aliases {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&aliases[i])
+	}
+	return nil
+}
+
+func (s *Store) AddLightAlias(
+	t db.Transaction, alias *huedb.LightAlias) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.aliasNameTaken(alias.Name, 0) {
+		return errDuplicateName
+	}
+	s.lastAliasId++
+	alias.Id = s.lastAliasId
+	s.aliases[alias.Id] = *alias
+	return nil
+}
+
+func (s *Store) UpdateLightAlias(
+	t db.Transaction, alias *huedb.LightAlias) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.aliases[alias.Id]; !ok {
+		return nil
+	}
+	if s.aliasNameTaken(alias.Name, alias.Id) {
+		return errDuplicateName
+	}
+	s.aliases[alias.Id] = *alias
+	return nil
+}
+
+func (s *Store) RemoveLightAlias(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.aliases, id)
+	return nil
+}
+
+func (s *Store) LightGroups(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	groups := make([]huedb.LightGroup, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	for i := range groups {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&groups[i])
+	}
+	return nil
+}
+
+func (s *Store) AddLightGroup(
+	t db.Transaction, group *huedb.LightGroup) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.groupNameTaken(group.Name, 0) {
+		return errDuplicateName
+	}
+	s.lastGroupId++
+	group.Id = s.lastGroupId
+	s.groups[group.Id] = *group
+	return nil
+}
+
+func (s *Store) UpdateLightGroup(
+	t db.Transaction, group *huedb.LightGroup) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.groups[group.Id]; !ok {
+		return nil
+	}
+	if s.groupNameTaken(group.Name, group.Id) {
+		return errDuplicateName
+	}
+	s.groups[group.Id] = *group
+	return nil
+}
+
+func (s *Store) RemoveLightGroup(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.groups, id)
+	return nil
+}
+
+func (s *Store) SceneComponents(
+	t db.Transaction,
+	namedColorsId int64,
+	consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ids := make([]int64, 0, len(s.components))
+	for id, component := range s.components {
+		if component.NamedColorsId == namedColorsId {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range sortIds(ids) {
+		if !consumer.CanConsume() {
+			break
+		}
+		component := s.components[id]
+		consumer.Consume(&component)
+	}
+	return nil
+}
+
+func (s *Store) AddSceneComponent(
+	t db.Transaction, component *huedb.SceneComponent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastCompId++
+	component.Id = s.lastCompId
+	s.components[component.Id] = *component
+	return nil
+}
+
+func (s *Store) RemoveSceneComponent(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.components, id)
+	return nil
+}
+
+func (s *Store) BridgeById(
+	t db.Transaction, id int64, bridge *huedb.Bridge) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.bridges[id]
+	if !ok {
+		return huedb.ErrNoSuchId
+	}
+	*bridge = stored
+	return nil
+}
+
+func (s *Store) Bridges(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	bridges := make([]huedb.Bridge, 0, len(s.bridges))
+	for _, bridge := range s.bridges {
+		bridges = append(bridges, bridge)
+	}
+	sort.Slice(bridges, func(i, j int) bool {
+		return bridges[i].Name < bridges[j].Name
+	})
+	for i := range bridges {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&bridges[i])
+	}
+	return nil
+}
+
+func (s *Store) AddBridge(t db.Transaction, bridge *huedb.Bridge) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.bridgeNameTaken(bridge.Name, 0) {
+		return errDuplicateName
+	}
+	s.lastBridgeId++
+	bridge.Id = s.lastBridgeId
+	s.bridges[bridge.Id] = *bridge
+	return nil
+}
+
+func (s *Store) UpdateBridge(t db.Transaction, bridge *huedb.Bridge) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.bridges[bridge.Id]; !ok {
+		return nil
+	}
+	if s.bridgeNameTaken(bridge.Name, bridge.Id) {
+		return errDuplicateName
+	}
+	s.bridges[bridge.Id] = *bridge
+	return nil
+}
+
+func (s *Store) RemoveBridge(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.bridges, id)
+	return nil
+}
+
+func (s *Store) WeatherSettings(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ids := make([]int64, 0, len(s.weather))
+	for id := range s.weather {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIds(ids) {
+		if !consumer.CanConsume() {
+			break
+		}
+		settings := s.weather[id]
+		consumer.Consume(&settings)
+	}
+	return nil
+}
+
+func (s *Store) AddWeatherSettings(
+	t db.Transaction, settings *huedb.WeatherSettings) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastWeatherId++
+	settings.Id = s.lastWeatherId
+	s.weather[settings.Id] = *settings
+	return nil
+}
+
+func (s *Store) UpdateWeatherSettings(
+	t db.Transaction, settings *huedb.WeatherSettings) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.weather[settings.Id]; ok {
+		s.weather[settings.Id] = *settings
+	}
+	return nil
+}
+
+func (s *Store) RemoveWeatherSettings(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.weather, id)
+	return nil
+}
+
+func (s *Store) Search(
+	t db.Transaction, query string, consumer goconsume.Consumer) error {
+	words := huedb.SearchWords(query)
+	if len(words) == 0 {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var results []huedb.SearchResult
+	for _, id := range s.namedColorsIds() {
+		results = append(results, huedb.SearchResult{
+			Kind:        huedb.NamedColorsSearchResult,
+			Id:          id,
+			Description: s.namedColors[id].Description})
+	}
+	scheduledIds := make([]int64, 0, len(s.scheduled))
+	for id := range s.scheduled {
+		scheduledIds = append(scheduledIds, id)
+	}
+	for _, id := range sortIds(scheduledIds) {
+		results = append(results, huedb.SearchResult{
+			Kind:        huedb.ScheduledTaskSearchResult,
+			Id:          id,
+			Description: s.scheduled[id].Description})
+	}
+	atTimeIds := make([]int64, 0, len(s.atTimeTasks))
+	for id := range s.atTimeTasks {
+		atTimeIds = append(atTimeIds, id)
+	}
+	for _, id := range sortIds(atTimeIds) {
+		results = append(results, huedb.SearchResult{
+			Kind:        huedb.AtTimeTaskSearchResult,
+			Id:          id,
+			Description: s.atTimeTasks[id].Description})
+	}
+	for i := range results {
+		if !consumer.CanConsume() {
+			break
+		}
+		if huedb.SearchMatches(results[i].Description, words) {
+			consumer.Consume(&results[i])
+		}
+	}
+	return nil
+}
+
+func (s *Store) ScheduleProfileById(
+	t db.Transaction, id int64, profile *huedb.ScheduleProfile) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.profiles[id]
+	if !ok {
+		return huedb.ErrNoSuchId
+	}
+	*profile = copyScheduleProfile(&stored)
+	return nil
+}
+
+func (s *Store) ScheduleProfiles(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	profiles := make([]huedb.ScheduleProfile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		profiles = append(profiles, copyScheduleProfile(&profile))
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	for i := range profiles {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&profiles[i])
+	}
+	return nil
+}
+
+func (s *Store) AddScheduleProfile(
+	t db.Transaction, profile *huedb.ScheduleProfile) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.profileNameTaken(profile.Name, 0) {
+		return errDuplicateName
+	}
+	s.lastProfileId++
+	profile.Id = s.lastProfileId
+	profile.Active = false
+	s.profiles[profile.Id] = copyScheduleProfile(profile)
+	return nil
+}
+
+func (s *Store) UpdateScheduleProfile(
+	t db.Transaction, profile *huedb.ScheduleProfile) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.profiles[profile.Id]
+	if !ok {
+		return nil
+	}
+	if s.profileNameTaken(profile.Name, profile.Id) {
+		return errDuplicateName
+	}
+	updated := copyScheduleProfile(profile)
+	updated.Active = stored.Active
+	s.profiles[profile.Id] = updated
+	return nil
+}
+
+func (s *Store) RemoveScheduleProfile(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.profiles, id)
+	return nil
+}
+
+func (s *Store) ActivateScheduleProfile(t db.Transaction, id int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for profileId, profile := range s.profiles {
+		profile.Active = profileId == id
+		s.profiles[profileId] = profile
+	}
+	return nil
+}
+
+func (s *Store) AddSensorEvent(
+	t db.Transaction, event *huedb.SensorEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastSensorId++
+	event.Id = s.lastSensorId
+	stored := *event
+	stored.Time = time.Unix(event.Time.Unix(), 0)
+	s.sensorEvents = append(s.sensorEvents, stored)
+	return nil
+}
+
+func (s *Store) SensorEvents(
+	t db.Transaction,
+	start, end time.Time,
+	consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	var result []huedb.SensorEvent
+	for _, event := range s.sensorEvents {
+		if event.Time.Unix() >= start.Unix() && event.Time.Unix() < end.Unix() {
+			result = append(result, event)
+		}
+	}
+	s.mutex.Unlock()
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	for i := range result {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&result[i])
+	}
+	return nil
+}
+
+func (s *Store) TrimSensorEvents(t db.Transaction, before time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	kept := s.sensorEvents[:0]
+	for _, event := range s.sensorEvents {
+		if event.Time.Unix() >= before.Unix() {
+			kept = append(kept, event)
+		}
+	}
+	s.sensorEvents = kept
+	return nil
+}
+
+func (s *Store) AddWeatherObservation(
+	t db.Transaction, observation *huedb.WeatherObservation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastObsId++
+	observation.Id = s.lastObsId
+	stored := *observation
+	stored.Time = time.Unix(observation.Time.Unix(), 0)
+	s.observations = append(s.observations, stored)
+	return nil
+}
+
+func (s *Store) WeatherObservations(
+	t db.Transaction,
+	start, end time.Time,
+	consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	var result []huedb.WeatherObservation
+	for _, observation := range s.observations {
+		if observation.Time.Unix() >= start.Unix() &&
+			observation.Time.Unix() < end.Unix() {
+			result = append(result, observation)
+		}
+	}
+	s.mutex.Unlock()
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	for i := range result {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&result[i])
+	}
+	return nil
+}
+
+func (s *Store) TrimWeatherObservations(
+	t db.Transaction, before time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	kept := s.observations[:0]
+	for _, observation := range s.observations {
+		if observation.Time.Unix() >= before.Unix() {
+			kept = append(kept, observation)
+		}
+	}
+	s.observations = kept
+	return nil
+}
+
+func (s *Store) DescriptionOverrides(
+	t db.Transaction, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.descriptions.DescriptionOverrides(t, consumer)
+}
+
+func (s *Store) SetDescriptionOverride(
+	t db.Transaction, override *huedb.DescriptionOverride) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.descriptions[override.HueTaskId] = override.Description
+	return nil
+}
+
+func (s *Store) RemoveDescriptionOverride(
+	t db.Transaction, hueTaskId int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.descriptions, hueTaskId)
+	return nil
+}
+
+func (s *Store) LastLightColors(t db.Transaction) (ops.LightColors, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := make(ops.LightColors, len(s.lastColors))
+	for id, cb := range s.lastColors {
+		result[id] = cb
+	}
+	return result, nil
+}
+
+func (s *Store) SetLastLightColors(
+	t db.Transaction, colors ops.LightColors) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := colors[0]; ok {
+		s.lastColors = make(ops.LightColors)
+	}
+	for id, cb := range colors {
+		s.lastColors[id] = cb
+	}
+	return nil
+}
+
+func (s *Store) Preference(
+	t db.Transaction, userId int64, key string, pref *huedb.Preference) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, ok := s.preferences[preferenceKey{userId: userId, key: key}]
+	if !ok {
+		return huedb.ErrNoSuchId
+	}
+	*pref = huedb.Preference{UserId: userId, Key: key, Value: value}
+	return nil
+}
+
+func (s *Store) Preferences(
+	t db.Transaction, userId int64, consumer goconsume.Consumer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var prefs []huedb.Preference
+	for k, value := range s.preferences {
+		if k.userId == userId {
+			prefs = append(
+				prefs,
+				huedb.Preference{UserId: userId, Key: k.key, Value: value})
+		}
+	}
+	sort.Slice(prefs, func(i, j int) bool {
+		return prefs[i].Key < prefs[j].Key
+	})
+	for i := range prefs {
+		if !consumer.CanConsume() {
+			break
+		}
+		consumer.Consume(&prefs[i])
+	}
+	return nil
+}
+
+func (s *Store) SetPreference(t db.Transaction, pref *huedb.Preference) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.preferences[preferenceKey{userId: pref.UserId, key: pref.Key}] = pref.Value
+	return nil
+}
+
+func (s *Store) RemovePreference(
+	t db.Transaction, userId int64, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.preferences, preferenceKey{userId: userId, key: key})
+	return nil
+}
+
+// Backup writes the contents of the Store to the file dest.
+func (s *Store) Backup(t db.Transaction, dest string) error {
+	var buffer bytes.Buffer
+	if err := s.encode(&buffer); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, buffer.Bytes(), 0600)
+}
+
+// Restore replaces the contents of the Store with the contents of the
+// file src which Backup created.
+func (s *Store) Restore(t db.Transaction, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// gob leaves out empty maps so decode into a snapshot whose maps
+	// already exist.
+	snap, err := New().snapshot()
+	if err != nil {
+		return err
+	}
+	if err := gob.NewDecoder(f).Decode(snap); err != nil {
+		return err
+	}
+	lastColors, err := huedb.DecodeLightColors(snap.LastColors)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.namedColors = snap.NamedColors
+	s.atTimeTasks = snap.AtTimeTasks
+	s.scheduled = snap.Scheduled
+	s.history = make([]revision, len(snap.History))
+	for i, r := range snap.History {
+		s.history[i] = revision{
+			rawNamedColors: r.RawNamedColors,
+			namedColorsId:  r.NamedColorsId,
+			updatedAt:      r.UpdatedAt,
+			deleted:        r.Deleted,
+		}
+	}
+	s.users = snap.Users
+	s.aliases = snap.Aliases
+	s.groups = snap.Groups
+	s.preferences = make(map[preferenceKey]string, len(snap.Preferences))
+	for _, pref := range snap.Preferences {
+		s.preferences[preferenceKey{userId: pref.UserId, key: pref.Key}] = pref.Value
+	}
+	s.descriptions = snap.Descriptions
+	s.lastColors = lastColors
+	s.components = snap.Components
+	s.bridges = snap.Bridges
+	s.weather = snap.Weather
+	s.archive = snap.Archive
+	s.profiles = snap.Profiles
+	s.sensorEvents = snap.SensorEvents
+	s.observations = snap.Observations
+	for i, lastId := range s.lastIds() {
+		if i < len(snap.LastIds) {
+			*lastId = snap.LastIds[i]
+		}
+	}
+	return nil
+}
+
+func (s *Store) encode(w io.Writer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snap, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(snap)
+}
+
+// snapshot returns the contents of the Store in the form that Backup
+// writes. Caller must hold the lock.
+func (s *Store) snapshot() (*snapshot, error) {
+	lastColors, err := huedb.EncodeLightColors(s.lastColors)
+	if err != nil {
+		return nil, err
+	}
+	result := &snapshot{
+		NamedColors:  s.namedColors,
+		AtTimeTasks:  s.atTimeTasks,
+		Scheduled:    s.scheduled,
+		Users:        s.users,
+		Aliases:      s.aliases,
+		Groups:       s.groups,
+		Descriptions: s.descriptions,
+		LastColors:   lastColors,
+		Components:   s.components,
+		Bridges:      s.bridges,
+		Weather:      s.weather,
+		Archive:      s.archive,
+		Profiles:     s.profiles,
+		SensorEvents: s.sensorEvents,
+		Observations: s.observations,
+	}
+	for _, r := range s.history {
+		result.History = append(result.History, snapshotRevision{
+			RawNamedColors: r.rawNamedColors,
+			NamedColorsId:  r.namedColorsId,
+			UpdatedAt:      r.updatedAt,
+			Deleted:        r.deleted,
+		})
+	}
+	for key, value := range s.preferences {
+		result.Preferences = append(result.Preferences, huedb.Preference{
+			UserId: key.userId, Key: key.key, Value: value})
+	}
+	for _, lastId := range s.lastIds() {
+		result.LastIds = append(result.LastIds, *lastId)
+	}
+	return result, nil
+}
+
+// lastIds returns the last id that the Store assigned for each kind of
+// row in the order that snapshot stores them.
+func (s *Store) lastIds() []*int64 {
+	return []*int64{
+		&s.lastColorsId,
+		&s.lastAtTimeId,
+		&s.lastSchedId,
+		&s.lastUserId,
+		&s.lastAliasId,
+		&s.lastGroupId,
+		&s.lastCompId,
+		&s.lastBridgeId,
+		&s.lastWeatherId,
+		&s.lastArchiveId,
+		&s.lastProfileId,
+		&s.lastSensorId,
+		&s.lastObsId,
+	}
+}
+
+// aliasNameTaken returns true if a light alias other than the one with
+// exceptId has name. Caller must hold the lock.
+func (s *Store) aliasNameTaken(name string, exceptId int64) bool {
+	for id, alias := range s.aliases {
+		if id != exceptId && alias.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// groupNameTaken returns true if a light group other than the one with
+// exceptId has name. Caller must hold the lock.
+func (s *Store) groupNameTaken(name string, exceptId int64) bool {
+	for id, group := range s.groups {
+		if id != exceptId && group.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addRevision records the current version of the named colors with given
+// id as a new revision. Caller must hold the lock.
+func (s *Store) addRevision(id int64, deleted bool) {
+	s.history = append(s.history, revision{
+		rawNamedColors: s.namedColors[id],
+		namedColorsId:  id,
+		updatedAt:      time.Now(),
+		deleted:        deleted,
+	})
+}
+
+type doer struct {
+}
+
+func (d doer) Do(action db.Action) error {
+	return action(nil)
+}
+
+// rawNamedColors is how ops.NamedColors is stored. Storing colors encoded
+// means callers never share a LightColors map with the Store, and colors
+// round the same way they do in a database.
+type rawNamedColors struct {
+	Colors      string
+	Description string
+}
+
+func marshallNamedColors(
+	namedColors *ops.NamedColors) (result rawNamedColors, err error) {
+	if result.Colors, err = huedb.EncodeLightColors(
+		namedColors.Colors); err != nil {
+		return
+	}
+	result.Description = namedColors.Description
+	return
+}
+
+func (r rawNamedColors) unmarshall(
+	id int64, namedColors *ops.NamedColors) error {
+	colors, err := huedb.DecodeLightColors(r.Colors)
+	if err != nil {
+		return err
+	}
+	namedColors.Id = id
+	namedColors.Colors = colors
+	namedColors.Description = r.Description
+	return nil
+}
+
+// revision is a prior version of named colors. The id of a revision is
+// its index in Store.history plus 1.
+type revision struct {
+	rawNamedColors
+	namedColorsId int64
+	updatedAt     time.Time
+	deleted       bool
+}
+
+func (r *revision) unmarshall(
+	id int64, result *huedb.NamedColorsRevision) error {
+	if err := r.rawNamedColors.unmarshall(
+		r.namedColorsId, &result.NamedColors); err != nil {
+		return err
+	}
+	result.Id = id
+	result.UpdatedAt = r.updatedAt
+	result.Deleted = r.deleted
+	return nil
+}
+
+// snapshot is what Backup writes.
+type snapshot struct {
+	NamedColors  map[int64]rawNamedColors
+	AtTimeTasks  map[int64]huedb.EncodedAtTimeTask
+	Scheduled    map[int64]huedb.EncodedScheduledTask
+	History      []snapshotRevision
+	Users        map[int64]huedb.User
+	Aliases      map[int64]huedb.LightAlias
+	Groups       map[int64]huedb.LightGroup
+	Preferences  []huedb.Preference
+	Descriptions huedb.DescriptionMap
+	LastColors   string
+	Components   map[int64]huedb.SceneComponent
+	Bridges      map[int64]huedb.Bridge
+	Weather      map[int64]huedb.WeatherSettings
+	Archive      []huedb.ArchivedAtTimeTask
+	Profiles     map[int64]huedb.ScheduleProfile
+	SensorEvents []huedb.SensorEvent
+	Observations []huedb.WeatherObservation
+	LastIds      []int64
+}
+
+// snapshotRevision is how snapshot stores a revision.
+type snapshotRevision struct {
+	RawNamedColors rawNamedColors
+	NamedColorsId  int64
+	UpdatedAt      time.Time
+	Deleted        bool
+}
+
+type preferenceKey struct {
+	userId int64
+	key    string
+}
+
+// namedColorsIds returns the ids of the named colors in ascending order.
+func (s *Store) namedColorsIds() []int64 {
+	result := make([]int64, 0, len(s.namedColors))
+	for id := range s.namedColors {
+		result = append(result, id)
+	}
+	return sortIds(result)
+}
+
+// atTimeTaskIds returns the ids of the at time tasks in ascending order.
+func (s *Store) atTimeTaskIds() []int64 {
+	result := make([]int64, 0, len(s.atTimeTasks))
+	for id := range s.atTimeTasks {
+		result = append(result, id)
+	}
+	return sortIds(result)
+}
+
+// scheduledIds returns the ids of the scheduled tasks in ascending order.
+func (s *Store) scheduledIds() []int64 {
+	result := make([]int64, 0, len(s.scheduled))
+	for id := range s.scheduled {
+		result = append(result, id)
+	}
+	return sortIds(result)
+}
+
+func sortIds(ids []int64) []int64 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// profileNameTaken returns true if a schedule profile other than the one
+// with exceptId has name. Caller must hold the lock.
+func (s *Store) profileNameTaken(name string, exceptId int64) bool {
+	for id, profile := range s.profiles {
+		if id != exceptId && profile.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// copyScheduleProfile returns a copy of profile with its scheduled task
+// ids sorted and without duplicates.
+func copyScheduleProfile(
+	profile *huedb.ScheduleProfile) huedb.ScheduleProfile {
+	result := *profile
+	result.ScheduledTaskIds = nil
+	for _, id := range sortIds(append([]int64(nil), profile.ScheduledTaskIds...)) {
+		count := len(result.ScheduledTaskIds)
+		if count == 0 || result.ScheduledTaskIds[count-1] != id {
+			result.ScheduledTaskIds = append(result.ScheduledTaskIds, id)
+		}
+	}
+	return result
+}
+
+// bridgeNameTaken returns true if a bridge other than the one with
+// exceptId has name. Caller must hold the lock.
+func (s *Store) bridgeNameTaken(name string, exceptId int64) bool {
+	for id, bridge := range s.bridges {
+		if id != exceptId && bridge.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package in_memory_test
+
+import (
+	"github.com/keep94/marvin/huedb/fixture"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/huedb/storetest"
+	"testing"
+)
+
+func TestNamedColorsById(t *testing.T) {
+	fixture.NamedColorsById(t, in_memory.New())
+}
+
+func TestNamedColors(t *testing.T) {
+	fixture.NamedColors(t, in_memory.New())
+}
+
+func TestUpdateNamedColors(t *testing.T) {
+	fixture.UpdateNamedColors(t, in_memory.New())
+}
+
+func TestRemoveNamedColors(t *testing.T) {
+	fixture.RemoveNamedColors(t, in_memory.New())
+}
+
+func TestNamedColorsPage(t *testing.T) {
+	fixture.NamedColorsPage(t, in_memory.New())
+}
+
+func TestNamedColorsOrdered(t *testing.T) {
+	fixture.NamedColorsOrdered(t, in_memory.New())
+}
+
+func TestNamedColorsByDescription(t *testing.T) {
+	fixture.NamedColorsByDescription(t, in_memory.New())
+}
+
+func TestNamedColorsHistory(t *testing.T) {
+	fixture.NamedColorsHistory(t, in_memory.New())
+}
+
+func TestScheduledTasks(t *testing.T) {
+	fixture.ScheduledTasks(t, in_memory.New())
+}
+
+func TestRemoveExpired(t *testing.T) {
+	fixture.RemoveExpired(t, in_memory.New())
+}
+
+func TestUpdateEncodedAtTimeTaskTime(t *testing.T) {
+	fixture.UpdateEncodedAtTimeTaskTime(t, in_memory.New())
+}
+
+func TestArchiveEncodedAtTimeTask(t *testing.T) {
+	fixture.ArchiveEncodedAtTimeTask(t, in_memory.New())
+}
+
+func TestUsers(t *testing.T) {
+	fixture.Users(t, in_memory.New())
+}
+
+func TestLightAliases(t *testing.T) {
+	fixture.LightAliases(t, in_memory.New())
+}
+
+func TestPreferences(t *testing.T) {
+	fixture.Preferences(t, in_memory.New())
+}
+
+func TestAddNamedColorsBatch(t *testing.T) {
+	fixture.AddNamedColorsBatch(t, in_memory.New())
+}
+
+func TestNamedColorsByIds(t *testing.T) {
+	fixture.NamedColorsByIds(t, in_memory.New())
+}
+
+func TestSceneComponents(t *testing.T) {
+	fixture.SceneComponents(t, in_memory.New())
+}
+
+func TestWeatherSettings(t *testing.T) {
+	fixture.WeatherSettings(t, in_memory.New())
+}
+
+func TestBridges(t *testing.T) {
+	fixture.Bridges(t, in_memory.New())
+}
+
+func TestDescriptionOverrides(t *testing.T) {
+	fixture.DescriptionOverrides(t, in_memory.New())
+}
+
+func TestLastLightColors(t *testing.T) {
+	fixture.LastLightColors(t, in_memory.New())
+}
+
+func TestSearch(t *testing.T) {
+	fixture.Search(t, in_memory.New())
+}
+
+func TestScheduleProfiles(t *testing.T) {
+	fixture.ScheduleProfiles(t, in_memory.New())
+}
+
+func TestSensorEvents(t *testing.T) {
+	fixture.SensorEvents(t, in_memory.New())
+}
+
+func TestWeatherObservations(t *testing.T) {
+	fixture.WeatherObservations(t, in_memory.New())
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (interface{}, func()) {
+		return in_memory.New(), nil
+	})
+}
@@ -0,0 +1,234 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// How long a LightStateRecorder waits before writing changes so that
+	// a running animation does not write on every step.
+	kLightStateFlushDelay = 2 * time.Second
+)
+
+type LastLightColorsRunner interface {
+	// LastLightColors gets the last color and brightness applied to each
+	// light.
+	LastLightColors(t db.Transaction) (ops.LightColors, error)
+}
+
+type SetLastLightColorsRunner interface {
+	// SetLastLightColors records the color and brightness of each light
+	// in colors replacing what was recorded for those lights. If colors
+	// has light id 0, meaning all lights, SetLastLightColors replaces what
+	// was recorded for every light.
+	SetLastLightColors(t db.Transaction, colors ops.LightColors) error
+}
+
+// LightStateRecorder is an ops.Context that records the color and
+// brightness of each light it sets. Pass a LightStateRecorder to
+// utils.NewMultiExecutor in place of the connection to the hue bridge.
+// LightStateRecorder writes to its store a short time after the lights
+// change. LightStateRecorder is an ops.Wrapper so it supports the same
+// optional interfaces as the Context it wraps. LightStateRecorder
+// instances are safe to use with multiple goroutines.
+type LightStateRecorder struct {
+	ops.ContextWrapper
+	recorded *lightState
+}
+
+// NewLightStateRecorder returns a new LightStateRecorder that sets
+// lights with ctxt and records their colors in store. logger receives
+// errors writing to store.
+func NewLightStateRecorder(
+	ctxt ops.Context,
+	store SetLastLightColorsRunner,
+	logger *log.Logger) *LightStateRecorder {
+	return &LightStateRecorder{
+		ContextWrapper: ops.ContextWrapper{Context: ctxt},
+		recorded: &lightState{
+			store:  store,
+			logger: logger,
+			state:  make(ops.LightColors),
+			groups: make(map[int]lights.Set)},
+	}
+}
+
+// Rewrap returns a LightStateRecorder that sets lights with ctxt and
+// records to the same place as this one.
+func (r *LightStateRecorder) Rewrap(ctxt ops.Context) ops.Context {
+	return &LightStateRecorder{
+		ContextWrapper: ops.ContextWrapper{Context: ctxt},
+		recorded:       r.recorded,
+	}
+}
+
+// Set sets the properties of a light and records them if successful.
+func (r *LightStateRecorder) Set(
+	lightId int, properties *gohue.LightProperties) ([]byte, error) {
+	response, err := r.ContextWrapper.Set(lightId, properties)
+	if err == nil {
+		var noColorTemperature maybe.Uint16
+		r.recorded.record(lightId, properties, noColorTemperature)
+	}
+	return response, err
+}
+
+// SetWithColorTemperature sets the properties and color temperature of a
+// light and records them if successful.
+func (r *LightStateRecorder) SetWithColorTemperature(
+	lightId int, properties *gohue.LightProperties, mireds uint16) (
+	[]byte, error) {
+	response, err := r.ContextWrapper.SetWithColorTemperature(
+		lightId, properties, mireds)
+	if err == nil {
+		r.recorded.record(lightId, properties, maybe.NewUint16(mireds))
+	}
+	return response, err
+}
+
+// GroupFor returns the bridge group having exactly the lights in
+// lightSet and remembers those lights so that SetGroup can record them.
+func (r *LightStateRecorder) GroupFor(lightSet lights.Set) (
+	groupId int, ok bool) {
+	groupId, ok = r.ContextWrapper.GroupFor(lightSet)
+	if ok {
+		r.recorded.rememberGroup(groupId, lightSet)
+	}
+	return
+}
+
+// SetGroup sets the properties of the lights in a bridge group and
+// records them if successful. SetGroup records nothing if GroupFor did
+// not return groupId earlier.
+func (r *LightStateRecorder) SetGroup(
+	groupId int, properties *gohue.LightProperties) ([]byte, error) {
+	response, err := r.ContextWrapper.SetGroup(groupId, properties)
+	if err == nil {
+		var noColorTemperature maybe.Uint16
+		for lightId := range r.recorded.group(groupId) {
+			r.recorded.record(lightId, properties, noColorTemperature)
+		}
+	}
+	return response, err
+}
+
+// Flush writes any unwritten changes to the store.
+func (r *LightStateRecorder) Flush() error {
+	return r.recorded.flush()
+}
+
+// lightState is what a LightStateRecorder records. The LightStateRecorder
+// instances that Rewrap returns share it.
+type lightState struct {
+	store   SetLastLightColorsRunner
+	logger  *log.Logger
+	mutex   sync.Mutex
+	state   ops.LightColors
+	pending ops.LightColors
+	groups  map[int]lights.Set
+	timer   *time.Timer
+}
+
+func (r *lightState) flush() error {
+	r.mutex.Lock()
+	pending := r.pending
+	r.pending = nil
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.mutex.Unlock()
+	if pending == nil {
+		return nil
+	}
+	return r.store.SetLastLightColors(nil, pending)
+}
+
+func (r *lightState) rememberGroup(groupId int, lightSet lights.Set) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.groups[groupId] = lightSet
+}
+
+func (r *lightState) group(groupId int) lights.Set {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.groups[groupId]
+}
+
+// record records what properties and mireds did to a light. Turning a
+// light off keeps its color and brightness so that turning it back on
+// with just On records the color and brightness it comes back with.
+func (r *lightState) record(
+	lightId int, properties *gohue.LightProperties, mireds maybe.Uint16) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	cb, ok := r.state[lightId]
+	if !ok && lightId != 0 {
+		cb = r.state[0]
+	}
+	if properties.On.Valid {
+		cb.On = properties.On
+	}
+	if properties.C.Valid {
+		cb.Color = properties.C
+		cb.ColorTemperature = mireds
+	} else if mireds.Valid {
+		cb.ColorTemperature = mireds
+	}
+	if properties.Bri.Valid {
+		cb.Brightness = properties.Bri
+	}
+	if lightId == 0 {
+		r.state = make(ops.LightColors)
+		r.pending = make(ops.LightColors)
+	}
+	if r.pending == nil {
+		r.pending = make(ops.LightColors)
+	}
+	r.state[lightId] = cb
+	r.pending[lightId] = cb
+	if r.timer == nil {
+		r.timer = time.AfterFunc(kLightStateFlushDelay, r.flushAndLog)
+	}
+}
+
+func (r *lightState) flushAndLog() {
+	if err := r.flush(); err != nil {
+		r.logger.Printf("While recording light colors: %v", err)
+	}
+}
+
+// RestoreLastLightColors sets each light to the last color and
+// brightness recorded in store. Call it at startup to restore the lights
+// after a power outage.
+func RestoreLastLightColors(
+	t db.Transaction, ctxt ops.Context, store LastLightColorsRunner) error {
+	colors, err := store.LastLightColors(t)
+	if err != nil {
+		return err
+	}
+	// Light id 0 means all lights so it has to go first.
+	if cb, ok := colors[0]; ok {
+		if err := ops.Restore(ctxt, ops.LightColors{0: cb}); err != nil {
+			return err
+		}
+	}
+	individual := make(ops.LightColors, len(colors))
+	for id, cb := range colors {
+		if id != 0 {
+			individual[id] = cb
+		}
+	}
+	if len(individual) == 0 {
+		return nil
+	}
+	return ops.Restore(ctxt, individual)
+}
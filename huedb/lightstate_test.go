@@ -0,0 +1,167 @@
+package huedb_test
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestLightStateRecorder(t *testing.T) {
+	store := in_memory.New()
+	ctxt := make(contextForTesting)
+	recorder := huedb.NewLightStateRecorder(
+		ctxt, store, log.New(ioutil.Discard, "", 0))
+	red := gohue.NewMaybeColor(gohue.Red)
+	recorder.Set(3, &gohue.LightProperties{
+		C: red, Bri: maybe.NewUint8(100), On: maybe.NewBool(true)})
+	recorder.Set(3, &gohue.LightProperties{Bri: maybe.NewUint8(50)})
+	recorder.Set(5, &gohue.LightProperties{On: maybe.NewBool(false)})
+	if len(ctxt) != 2 {
+		t.Errorf("Expected 2 lights set, got %d", len(ctxt))
+	}
+	if err := recorder.Flush(); err != nil {
+		t.Fatalf("Got error flushing: %v", err)
+	}
+	expected := ops.LightColors{
+		3: {Color: red, Brightness: maybe.NewUint8(50), On: maybe.NewBool(true)},
+		5: {On: maybe.NewBool(false)},
+	}
+	actual, err := store.LastLightColors(nil)
+	if err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+
+	restored := make(contextForTesting)
+	if err := huedb.RestoreLastLightColors(nil, restored, store); err != nil {
+		t.Fatalf("Got error restoring: %v", err)
+	}
+	if out := restored[3]; out == nil || out.Bri != maybe.NewUint8(50) || out.C != red {
+		t.Errorf("Expected light 3 restored, got %v", out)
+	}
+	if out := restored[5]; out == nil || out.On != maybe.NewBool(false) {
+		t.Errorf("Expected light 5 off, got %v", out)
+	}
+}
+
+func TestLightStateRecorderOnAndColorTemperature(t *testing.T) {
+	store := in_memory.New()
+	ctxt := &colorTemperatureContextForTesting{
+		contextForTesting: make(contextForTesting)}
+	recorder := huedb.NewLightStateRecorder(
+		ctxt, store, log.New(ioutil.Discard, "", 0))
+	ctCtxt, ok := ops.AsColorTemperatureContext(recorder)
+	if !ok {
+		t.Fatal("Expected recorder to be a ColorTemperatureContext")
+	}
+	if _, ok := ops.AsGroupContext(recorder); ok {
+		t.Error("Expected recorder not to be a GroupContext")
+	}
+	recorder.Set(2, &gohue.LightProperties{
+		Bri: maybe.NewUint8(80), On: maybe.NewBool(true)})
+	recorder.Set(2, &gohue.LightProperties{On: maybe.NewBool(false)})
+	recorder.Set(2, &gohue.LightProperties{On: maybe.NewBool(true)})
+	recorder.Set(4, &gohue.LightProperties{On: maybe.NewBool(true)})
+	ctCtxt.SetWithColorTemperature(
+		6, &gohue.LightProperties{On: maybe.NewBool(true)}, 370)
+	if err := recorder.Flush(); err != nil {
+		t.Fatalf("Got error flushing: %v", err)
+	}
+	expected := ops.LightColors{
+		2: {Brightness: maybe.NewUint8(80), On: maybe.NewBool(true)},
+		4: {On: maybe.NewBool(true)},
+		6: {On: maybe.NewBool(true), ColorTemperature: maybe.NewUint16(370)},
+	}
+	actual, err := store.LastLightColors(nil)
+	if err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	for id, cb := range actual {
+		if cb.IsOff() {
+			t.Errorf("Expected light %d on", id)
+		}
+	}
+	if out := ctxt.mireds[6]; out != 370 {
+		t.Errorf("Expected 370 mireds sent, got %d", out)
+	}
+}
+
+func TestLightStateRecorderGroup(t *testing.T) {
+	store := in_memory.New()
+	ctxt := &groupContextForTesting{
+		contextForTesting: make(contextForTesting),
+		GroupMap:          ops.GroupMap{1: lights.New(2, 3)},
+	}
+	recorder := huedb.NewLightStateRecorder(
+		ctxt, store, log.New(ioutil.Discard, "", 0))
+	red := gohue.NewMaybeColor(gohue.Red)
+	ops.StaticHueAction{2: {Color: red}, 3: {Color: red}}.Do(
+		recorder, lights.New(2, 3), nil)
+	if ctxt.groupsSet != 1 {
+		t.Errorf("Expected one group command, got %d", ctxt.groupsSet)
+	}
+	if err := recorder.Flush(); err != nil {
+		t.Fatalf("Got error flushing: %v", err)
+	}
+	expected := ops.LightColors{
+		2: {Color: red, On: maybe.NewBool(true)},
+		3: {Color: red, On: maybe.NewBool(true)},
+	}
+	actual, err := store.LastLightColors(nil)
+	if err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+type contextForTesting map[int]*gohue.LightProperties
+
+func (c contextForTesting) Set(
+	lightId int,
+	properties *gohue.LightProperties) (response []byte, err error) {
+	propertiesCopy := *properties
+	c[lightId] = &propertiesCopy
+	return
+}
+
+type colorTemperatureContextForTesting struct {
+	contextForTesting
+	mireds map[int]uint16
+}
+
+func (c *colorTemperatureContextForTesting) SetWithColorTemperature(
+	lightId int, properties *gohue.LightProperties, mireds uint16) (
+	response []byte, err error) {
+	if c.mireds == nil {
+		c.mireds = make(map[int]uint16)
+	}
+	c.mireds[lightId] = mireds
+	return c.contextForTesting.Set(lightId, properties)
+}
+
+type groupContextForTesting struct {
+	contextForTesting
+	ops.GroupMap
+	groupsSet int
+}
+
+func (c *groupContextForTesting) SetGroup(
+	groupId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	c.groupsSet++
+	return
+}
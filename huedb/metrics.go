@@ -0,0 +1,657 @@
+package huedb
+
+import (
+	"context"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/tasks"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store is the union of the store interfaces in this package.
+type Store interface {
+	NamedColorsByIdRunner
+	NamedColorsRunner
+	NamedColorsOrderedRunner
+	NamedColorsPageRunner
+	NamedColorsByIdsRunner
+	NamedColorsCountRunner
+	NamedColorsByDescriptionRunner
+	AddNamedColorsRunner
+	AddNamedColorsBatchRunner
+	MigrateLightColorsRunner
+	UpdateNamedColorsRunner
+	RemoveNamedColorsRunner
+	EncodedAtTimeTaskStore
+	ArchiveEncodedAtTimeTaskRunner
+	ArchivedAtTimeTasksRunner
+	EncodedScheduledTaskByIdRunner
+	EncodedScheduledTasksRunner
+	AddEncodedScheduledTaskRunner
+	UpdateEncodedScheduledTaskRunner
+	RemoveEncodedScheduledTaskRunner
+	NamedColorsHistoryRunner
+	DeletedNamedColorsRunner
+	RestoreNamedColorsRunner
+	UserByIdRunner
+	UserByNameRunner
+	UsersRunner
+	AddUserRunner
+	UpdateUserRunner
+	RemoveUserRunner
+	LightAliasesRunner
+	AddLightAliasRunner
+	UpdateLightAliasRunner
+	RemoveLightAliasRunner
+	LightGroupsRunner
+	AddLightGroupRunner
+	UpdateLightGroupRunner
+	RemoveLightGroupRunner
+	SceneComponentsRunner
+	AddSceneComponentRunner
+	RemoveSceneComponentRunner
+	BridgeByIdRunner
+	BridgesRunner
+	AddBridgeRunner
+	UpdateBridgeRunner
+	RemoveBridgeRunner
+	WeatherSettingsRunner
+	AddWeatherSettingsRunner
+	UpdateWeatherSettingsRunner
+	RemoveWeatherSettingsRunner
+	DescriptionOverridesRunner
+	SetDescriptionOverrideRunner
+	RemoveDescriptionOverrideRunner
+	LastLightColorsRunner
+	SetLastLightColorsRunner
+	SearchRunner
+	ScheduleProfileByIdRunner
+	ScheduleProfilesRunner
+	AddScheduleProfileRunner
+	UpdateScheduleProfileRunner
+	RemoveScheduleProfileRunner
+	ActivateScheduleProfileRunner
+	AddSensorEventRunner
+	SensorEventsRunner
+	TrimSensorEventsRunner
+	AddWeatherObservationRunner
+	WeatherObservationsRunner
+	TrimWeatherObservationsRunner
+	PreferenceRunner
+	PreferencesRunner
+	SetPreferenceRunner
+	RemovePreferenceRunner
+	ContextRunner
+}
+
+// MetricsSink receives an observation for each call to a store that
+// NewMetricsStore returns. Implementations must be safe to use with
+// multiple goroutines.
+type MetricsSink interface {
+	// Observe records that the store method named method took duration
+	// and returned err.
+	Observe(method string, duration time.Duration, err error)
+}
+
+// NewMetricsStore returns a Store that works just like delegate except
+// that it reports the duration and outcome of each call to sink.
+func NewMetricsStore(delegate Store, sink MetricsSink) Store {
+	return NewMetricsStoreWithClock(delegate, sink, tasks.SystemClock())
+}
+
+// NewMetricsStoreWithClock provides a caller supplied clock for testing.
+func NewMetricsStoreWithClock(
+	delegate Store, sink MetricsSink, clock tasks.Clock) Store {
+	return &metricsStore{delegate: delegate, sink: sink, clock: clock}
+}
+
+// MethodMetrics summarizes the calls to one store method.
+type MethodMetrics struct {
+	// The name of the store method.
+	Method string
+
+	// The number of calls.
+	Count int
+
+	// The number of calls that returned an error.
+	Errors int
+
+	// The total time spent in all calls.
+	TotalDuration time.Duration
+
+	// The time spent in the slowest call.
+	MaxDuration time.Duration
+}
+
+// AverageDuration returns the average time spent in a call.
+func (m *MethodMetrics) AverageDuration() time.Duration {
+	if m.Count == 0 {
+		return 0
+	}
+	return m.TotalDuration / time.Duration(m.Count)
+}
+
+// ErrorRate returns the fraction of calls that returned an error.
+func (m *MethodMetrics) ErrorRate() float64 {
+	if m.Count == 0 {
+		return 0.0
+	}
+	return float64(m.Errors) / float64(m.Count)
+}
+
+// MetricsCollector is a MetricsSink that keeps running totals per store
+// method in memory. The zero value is ready to use.
+type MetricsCollector struct {
+	mutex   sync.Mutex
+	metrics map[string]*MethodMetrics
+}
+
+func (c *MetricsCollector) Observe(
+	method string, duration time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.metrics == nil {
+		c.metrics = make(map[string]*MethodMetrics)
+	}
+	m, ok := c.metrics[method]
+	if !ok {
+		m = &MethodMetrics{Method: method}
+		c.metrics[method] = m
+	}
+	m.Count++
+	if err != nil {
+		m.Errors++
+	}
+	m.TotalDuration += duration
+	if duration > m.MaxDuration {
+		m.MaxDuration = duration
+	}
+}
+
+// Metrics returns the totals for each store method called so far sorted
+// by method name.
+func (c *MetricsCollector) Metrics() []MethodMetrics {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	result := make([]MethodMetrics, 0, len(c.metrics))
+	for _, m := range c.metrics {
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Method < result[j].Method
+	})
+	return result
+}
+
+type metricsStore struct {
+	delegate Store
+	sink     MetricsSink
+	clock    tasks.Clock
+}
+
+func (m *metricsStore) observe(method string, start time.Time, err *error) {
+	m.sink.Observe(method, m.clock.Now().Sub(start), *err)
+}
+
+// WithContext returns a store that reports to the same sink as m.
+func (m *metricsStore) WithContext(ctx context.Context) Store {
+	return &metricsStore{
+		delegate: m.delegate.WithContext(ctx), sink: m.sink, clock: m.clock}
+}
+
+func (m *metricsStore) NamedColorsById(
+	t db.Transaction, id int64, colors *ops.NamedColors) (err error) {
+	defer m.observe("NamedColorsById", m.clock.Now(), &err)
+	return m.delegate.NamedColorsById(t, id, colors)
+}
+
+func (m *metricsStore) NamedColors(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("NamedColors", m.clock.Now(), &err)
+	return m.delegate.NamedColors(t, consumer)
+}
+
+func (m *metricsStore) NamedColorsOrdered(
+	t db.Transaction,
+	order NamedColorsOrder,
+	consumer goconsume.Consumer) (err error) {
+	defer m.observe("NamedColorsOrdered", m.clock.Now(), &err)
+	return m.delegate.NamedColorsOrdered(t, order, consumer)
+}
+
+func (m *metricsStore) NamedColorsPage(
+	t db.Transaction, offset, limit int, consumer goconsume.Consumer) (err error) {
+	defer m.observe("NamedColorsPage", m.clock.Now(), &err)
+	return m.delegate.NamedColorsPage(t, offset, limit, consumer)
+}
+
+func (m *metricsStore) NamedColorsByIds(
+	t db.Transaction, ids []int64, consumer goconsume.Consumer) (err error) {
+	defer m.observe("NamedColorsByIds", m.clock.Now(), &err)
+	return m.delegate.NamedColorsByIds(t, ids, consumer)
+}
+
+func (m *metricsStore) NamedColorsCount(
+	t db.Transaction) (count int, err error) {
+	defer m.observe("NamedColorsCount", m.clock.Now(), &err)
+	return m.delegate.NamedColorsCount(t)
+}
+
+func (m *metricsStore) NamedColorsByDescription(
+	t db.Transaction, pattern string, consumer goconsume.Consumer) (err error) {
+	defer m.observe("NamedColorsByDescription", m.clock.Now(), &err)
+	return m.delegate.NamedColorsByDescription(t, pattern, consumer)
+}
+
+func (m *metricsStore) AddNamedColors(
+	t db.Transaction, colors *ops.NamedColors) (err error) {
+	defer m.observe("AddNamedColors", m.clock.Now(), &err)
+	return m.delegate.AddNamedColors(t, colors)
+}
+
+func (m *metricsStore) AddNamedColorsBatch(
+	t db.Transaction, batch []*ops.NamedColors) (err error) {
+	defer m.observe("AddNamedColorsBatch", m.clock.Now(), &err)
+	return m.delegate.AddNamedColorsBatch(t, batch)
+}
+
+func (m *metricsStore) MigrateLightColors(
+	t db.Transaction) (err error) {
+	defer m.observe("MigrateLightColors", m.clock.Now(), &err)
+	return m.delegate.MigrateLightColors(t)
+}
+
+func (m *metricsStore) UpdateNamedColors(
+	t db.Transaction, colors *ops.NamedColors) (err error) {
+	defer m.observe("UpdateNamedColors", m.clock.Now(), &err)
+	return m.delegate.UpdateNamedColors(t, colors)
+}
+
+func (m *metricsStore) RemoveNamedColors(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("RemoveNamedColors", m.clock.Now(), &err)
+	return m.delegate.RemoveNamedColors(t, id)
+}
+
+func (m *metricsStore) AddEncodedAtTimeTask(
+	t db.Transaction, task *EncodedAtTimeTask) (err error) {
+	defer m.observe("AddEncodedAtTimeTask", m.clock.Now(), &err)
+	return m.delegate.AddEncodedAtTimeTask(t, task)
+}
+
+func (m *metricsStore) RemoveEncodedAtTimeTaskByScheduleId(
+	t db.Transaction, groupId, scheduleId string) (err error) {
+	defer m.observe("RemoveEncodedAtTimeTaskByScheduleId", m.clock.Now(), &err)
+	return m.delegate.RemoveEncodedAtTimeTaskByScheduleId(t, groupId, scheduleId)
+}
+
+func (m *metricsStore) EncodedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) (err error) {
+	defer m.observe("EncodedAtTimeTasks", m.clock.Now(), &err)
+	return m.delegate.EncodedAtTimeTasks(t, groupId, consumer)
+}
+
+func (m *metricsStore) RemoveExpired(
+	t db.Transaction, before time.Time) (err error) {
+	defer m.observe("RemoveExpired", m.clock.Now(), &err)
+	return m.delegate.RemoveExpired(t, before)
+}
+
+func (m *metricsStore) UpdateEncodedAtTimeTaskTime(
+	t db.Transaction, groupId, scheduleId, newScheduleId string, newTime time.Time) (err error) {
+	defer m.observe("UpdateEncodedAtTimeTaskTime", m.clock.Now(), &err)
+	return m.delegate.UpdateEncodedAtTimeTaskTime(t, groupId, scheduleId, newScheduleId, newTime)
+}
+
+func (m *metricsStore) ArchiveEncodedAtTimeTask(
+	t db.Transaction, groupId, scheduleId string, status AtTimeTaskStatus, completedAt time.Time) (err error) {
+	defer m.observe("ArchiveEncodedAtTimeTask", m.clock.Now(), &err)
+	return m.delegate.ArchiveEncodedAtTimeTask(t, groupId, scheduleId, status, completedAt)
+}
+
+func (m *metricsStore) ArchivedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) (err error) {
+	defer m.observe("ArchivedAtTimeTasks", m.clock.Now(), &err)
+	return m.delegate.ArchivedAtTimeTasks(t, groupId, consumer)
+}
+
+func (m *metricsStore) EncodedScheduledTaskById(
+	t db.Transaction, id int64, task *EncodedScheduledTask) (err error) {
+	defer m.observe("EncodedScheduledTaskById", m.clock.Now(), &err)
+	return m.delegate.EncodedScheduledTaskById(t, id, task)
+}
+
+func (m *metricsStore) EncodedScheduledTasks(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("EncodedScheduledTasks", m.clock.Now(), &err)
+	return m.delegate.EncodedScheduledTasks(t, consumer)
+}
+
+func (m *metricsStore) AddEncodedScheduledTask(
+	t db.Transaction, task *EncodedScheduledTask) (err error) {
+	defer m.observe("AddEncodedScheduledTask", m.clock.Now(), &err)
+	return m.delegate.AddEncodedScheduledTask(t, task)
+}
+
+func (m *metricsStore) UpdateEncodedScheduledTask(
+	t db.Transaction, task *EncodedScheduledTask) (err error) {
+	defer m.observe("UpdateEncodedScheduledTask", m.clock.Now(), &err)
+	return m.delegate.UpdateEncodedScheduledTask(t, task)
+}
+
+func (m *metricsStore) RemoveEncodedScheduledTask(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("RemoveEncodedScheduledTask", m.clock.Now(), &err)
+	return m.delegate.RemoveEncodedScheduledTask(t, id)
+}
+
+func (m *metricsStore) NamedColorsHistory(
+	t db.Transaction, id int64, consumer goconsume.Consumer) (err error) {
+	defer m.observe("NamedColorsHistory", m.clock.Now(), &err)
+	return m.delegate.NamedColorsHistory(t, id, consumer)
+}
+
+func (m *metricsStore) DeletedNamedColors(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("DeletedNamedColors", m.clock.Now(), &err)
+	return m.delegate.DeletedNamedColors(t, consumer)
+}
+
+func (m *metricsStore) RestoreNamedColors(
+	t db.Transaction, revisionId int64) (err error) {
+	defer m.observe("RestoreNamedColors", m.clock.Now(), &err)
+	return m.delegate.RestoreNamedColors(t, revisionId)
+}
+
+func (m *metricsStore) UserById(
+	t db.Transaction, id int64, user *User) (err error) {
+	defer m.observe("UserById", m.clock.Now(), &err)
+	return m.delegate.UserById(t, id, user)
+}
+
+func (m *metricsStore) UserByName(
+	t db.Transaction, name string, user *User) (err error) {
+	defer m.observe("UserByName", m.clock.Now(), &err)
+	return m.delegate.UserByName(t, name, user)
+}
+
+func (m *metricsStore) Users(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("Users", m.clock.Now(), &err)
+	return m.delegate.Users(t, consumer)
+}
+
+func (m *metricsStore) AddUser(
+	t db.Transaction, user *User) (err error) {
+	defer m.observe("AddUser", m.clock.Now(), &err)
+	return m.delegate.AddUser(t, user)
+}
+
+func (m *metricsStore) UpdateUser(
+	t db.Transaction, user *User) (err error) {
+	defer m.observe("UpdateUser", m.clock.Now(), &err)
+	return m.delegate.UpdateUser(t, user)
+}
+
+func (m *metricsStore) RemoveUser(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("RemoveUser", m.clock.Now(), &err)
+	return m.delegate.RemoveUser(t, id)
+}
+
+func (m *metricsStore) LightAliases(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("LightAliases", m.clock.Now(), &err)
+	return m.delegate.LightAliases(t, consumer)
+}
+
+func (m *metricsStore) AddLightAlias(
+	t db.Transaction, alias *LightAlias) (err error) {
+	defer m.observe("AddLightAlias", m.clock.Now(), &err)
+	return m.delegate.AddLightAlias(t, alias)
+}
+
+func (m *metricsStore) UpdateLightAlias(
+	t db.Transaction, alias *LightAlias) (err error) {
+	defer m.observe("UpdateLightAlias", m.clock.Now(), &err)
+	return m.delegate.UpdateLightAlias(t, alias)
+}
+
+func (m *metricsStore) RemoveLightAlias(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("RemoveLightAlias", m.clock.Now(), &err)
+	return m.delegate.RemoveLightAlias(t, id)
+}
+
+func (m *metricsStore) LightGroups(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("LightGroups", m.clock.Now(), &err)
+	return m.delegate.LightGroups(t, consumer)
+}
+
+func (m *metricsStore) AddLightGroup(
+	t db.Transaction, group *LightGroup) (err error) {
+	defer m.observe("AddLightGroup", m.clock.Now(), &err)
+	return m.delegate.AddLightGroup(t, group)
+}
+
+func (m *metricsStore) UpdateLightGroup(
+	t db.Transaction, group *LightGroup) (err error) {
+	defer m.observe("UpdateLightGroup", m.clock.Now(), &err)
+	return m.delegate.UpdateLightGroup(t, group)
+}
+
+func (m *metricsStore) RemoveLightGroup(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("RemoveLightGroup", m.clock.Now(), &err)
+	return m.delegate.RemoveLightGroup(t, id)
+}
+
+func (m *metricsStore) SceneComponents(
+	t db.Transaction, namedColorsId int64, consumer goconsume.Consumer) (err error) {
+	defer m.observe("SceneComponents", m.clock.Now(), &err)
+	return m.delegate.SceneComponents(t, namedColorsId, consumer)
+}
+
+func (m *metricsStore) AddSceneComponent(
+	t db.Transaction, component *SceneComponent) (err error) {
+	defer m.observe("AddSceneComponent", m.clock.Now(), &err)
+	return m.delegate.AddSceneComponent(t, component)
+}
+
+func (m *metricsStore) RemoveSceneComponent(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("RemoveSceneComponent", m.clock.Now(), &err)
+	return m.delegate.RemoveSceneComponent(t, id)
+}
+
+func (m *metricsStore) BridgeById(
+	t db.Transaction, id int64, bridge *Bridge) (err error) {
+	defer m.observe("BridgeById", m.clock.Now(), &err)
+	return m.delegate.BridgeById(t, id, bridge)
+}
+
+func (m *metricsStore) Bridges(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("Bridges", m.clock.Now(), &err)
+	return m.delegate.Bridges(t, consumer)
+}
+
+func (m *metricsStore) AddBridge(
+	t db.Transaction, bridge *Bridge) (err error) {
+	defer m.observe("AddBridge", m.clock.Now(), &err)
+	return m.delegate.AddBridge(t, bridge)
+}
+
+func (m *metricsStore) UpdateBridge(
+	t db.Transaction, bridge *Bridge) (err error) {
+	defer m.observe("UpdateBridge", m.clock.Now(), &err)
+	return m.delegate.UpdateBridge(t, bridge)
+}
+
+func (m *metricsStore) RemoveBridge(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("RemoveBridge", m.clock.Now(), &err)
+	return m.delegate.RemoveBridge(t, id)
+}
+
+func (m *metricsStore) WeatherSettings(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("WeatherSettings", m.clock.Now(), &err)
+	return m.delegate.WeatherSettings(t, consumer)
+}
+
+func (m *metricsStore) AddWeatherSettings(
+	t db.Transaction, settings *WeatherSettings) (err error) {
+	defer m.observe("AddWeatherSettings", m.clock.Now(), &err)
+	return m.delegate.AddWeatherSettings(t, settings)
+}
+
+func (m *metricsStore) UpdateWeatherSettings(
+	t db.Transaction, settings *WeatherSettings) (err error) {
+	defer m.observe("UpdateWeatherSettings", m.clock.Now(), &err)
+	return m.delegate.UpdateWeatherSettings(t, settings)
+}
+
+func (m *metricsStore) RemoveWeatherSettings(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("RemoveWeatherSettings", m.clock.Now(), &err)
+	return m.delegate.RemoveWeatherSettings(t, id)
+}
+
+func (m *metricsStore) DescriptionOverrides(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("DescriptionOverrides", m.clock.Now(), &err)
+	return m.delegate.DescriptionOverrides(t, consumer)
+}
+
+func (m *metricsStore) SetDescriptionOverride(
+	t db.Transaction, override *DescriptionOverride) (err error) {
+	defer m.observe("SetDescriptionOverride", m.clock.Now(), &err)
+	return m.delegate.SetDescriptionOverride(t, override)
+}
+
+func (m *metricsStore) RemoveDescriptionOverride(
+	t db.Transaction, hueTaskId int) (err error) {
+	defer m.observe("RemoveDescriptionOverride", m.clock.Now(), &err)
+	return m.delegate.RemoveDescriptionOverride(t, hueTaskId)
+}
+
+func (m *metricsStore) LastLightColors(
+	t db.Transaction) (colors ops.LightColors, err error) {
+	defer m.observe("LastLightColors", m.clock.Now(), &err)
+	return m.delegate.LastLightColors(t)
+}
+
+func (m *metricsStore) Search(
+	t db.Transaction, query string, consumer goconsume.Consumer) (err error) {
+	defer m.observe("Search", m.clock.Now(), &err)
+	return m.delegate.Search(t, query, consumer)
+}
+
+func (m *metricsStore) ScheduleProfileById(
+	t db.Transaction, id int64, profile *ScheduleProfile) (err error) {
+	defer m.observe("ScheduleProfileById", m.clock.Now(), &err)
+	return m.delegate.ScheduleProfileById(t, id, profile)
+}
+
+func (m *metricsStore) ScheduleProfiles(
+	t db.Transaction, consumer goconsume.Consumer) (err error) {
+	defer m.observe("ScheduleProfiles", m.clock.Now(), &err)
+	return m.delegate.ScheduleProfiles(t, consumer)
+}
+
+func (m *metricsStore) AddScheduleProfile(
+	t db.Transaction, profile *ScheduleProfile) (err error) {
+	defer m.observe("AddScheduleProfile", m.clock.Now(), &err)
+	return m.delegate.AddScheduleProfile(t, profile)
+}
+
+func (m *metricsStore) UpdateScheduleProfile(
+	t db.Transaction, profile *ScheduleProfile) (err error) {
+	defer m.observe("UpdateScheduleProfile", m.clock.Now(), &err)
+	return m.delegate.UpdateScheduleProfile(t, profile)
+}
+
+func (m *metricsStore) RemoveScheduleProfile(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("RemoveScheduleProfile", m.clock.Now(), &err)
+	return m.delegate.RemoveScheduleProfile(t, id)
+}
+
+func (m *metricsStore) ActivateScheduleProfile(
+	t db.Transaction, id int64) (err error) {
+	defer m.observe("ActivateScheduleProfile", m.clock.Now(), &err)
+	return m.delegate.ActivateScheduleProfile(t, id)
+}
+
+func (m *metricsStore) AddSensorEvent(
+	t db.Transaction, event *SensorEvent) (err error) {
+	defer m.observe("AddSensorEvent", m.clock.Now(), &err)
+	return m.delegate.AddSensorEvent(t, event)
+}
+
+func (m *metricsStore) SensorEvents(
+	t db.Transaction, start, end time.Time, consumer goconsume.Consumer) (err error) {
+	defer m.observe("SensorEvents", m.clock.Now(), &err)
+	return m.delegate.SensorEvents(t, start, end, consumer)
+}
+
+func (m *metricsStore) TrimSensorEvents(
+	t db.Transaction, before time.Time) (err error) {
+	defer m.observe("TrimSensorEvents", m.clock.Now(), &err)
+	return m.delegate.TrimSensorEvents(t, before)
+}
+
+func (m *metricsStore) AddWeatherObservation(
+	t db.Transaction, observation *WeatherObservation) (err error) {
+	defer m.observe("AddWeatherObservation", m.clock.Now(), &err)
+	return m.delegate.AddWeatherObservation(t, observation)
+}
+
+func (m *metricsStore) WeatherObservations(
+	t db.Transaction,
+	start, end time.Time,
+	consumer goconsume.Consumer) (err error) {
+	defer m.observe("WeatherObservations", m.clock.Now(), &err)
+	return m.delegate.WeatherObservations(t, start, end, consumer)
+}
+
+func (m *metricsStore) TrimWeatherObservations(
+	t db.Transaction, before time.Time) (err error) {
+	defer m.observe("TrimWeatherObservations", m.clock.Now(), &err)
+	return m.delegate.TrimWeatherObservations(t, before)
+}
+
+func (m *metricsStore) SetLastLightColors(
+	t db.Transaction, colors ops.LightColors) (err error) {
+	defer m.observe("SetLastLightColors", m.clock.Now(), &err)
+	return m.delegate.SetLastLightColors(t, colors)
+}
+
+func (m *metricsStore) Preference(
+	t db.Transaction, userId int64, key string, pref *Preference) (err error) {
+	defer m.observe("Preference", m.clock.Now(), &err)
+	return m.delegate.Preference(t, userId, key, pref)
+}
+
+func (m *metricsStore) Preferences(
+	t db.Transaction, userId int64, consumer goconsume.Consumer) (err error) {
+	defer m.observe("Preferences", m.clock.Now(), &err)
+	return m.delegate.Preferences(t, userId, consumer)
+}
+
+func (m *metricsStore) SetPreference(
+	t db.Transaction, pref *Preference) (err error) {
+	defer m.observe("SetPreference", m.clock.Now(), &err)
+	return m.delegate.SetPreference(t, pref)
+}
+
+func (m *metricsStore) RemovePreference(
+	t db.Transaction, userId int64, key string) (err error) {
+	defer m.observe("RemovePreference", m.clock.Now(), &err)
+	return m.delegate.RemovePreference(t, userId, key)
+}
@@ -0,0 +1,76 @@
+package huedb_test
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/ops"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMetricsStore(t *testing.T) {
+	var collector huedb.MetricsCollector
+	store := huedb.NewMetricsStoreWithClock(
+		in_memory.New(), &collector, &steppingClock{})
+	namedColors := ops.NamedColors{Description: "Foo", Colors: kColorMap1}
+	if err := store.AddNamedColors(nil, &namedColors); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	var result ops.NamedColors
+	if err := store.NamedColorsById(nil, namedColors.Id, &result); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if err := store.NamedColorsById(
+		nil, 9999, &result); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+	if count, err := store.NamedColorsCount(nil); count != 1 || err != nil {
+		t.Errorf("Expected 1, got %d, %v", count, err)
+	}
+	expected := []huedb.MethodMetrics{
+		{
+			Method:        "AddNamedColors",
+			Count:         1,
+			TotalDuration: time.Second,
+			MaxDuration:   time.Second,
+		},
+		{
+			Method:        "NamedColorsById",
+			Count:         2,
+			Errors:        1,
+			TotalDuration: 2 * time.Second,
+			MaxDuration:   time.Second,
+		},
+		{
+			Method:        "NamedColorsCount",
+			Count:         1,
+			TotalDuration: time.Second,
+			MaxDuration:   time.Second,
+		},
+	}
+	actual := collector.Metrics()
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	if out := actual[1].ErrorRate(); out != 0.5 {
+		t.Errorf("Expected 0.5, got %v", out)
+	}
+	if out := actual[1].AverageDuration(); out != time.Second {
+		t.Errorf("Expected 1s, got %v", out)
+	}
+}
+
+// steppingClock advances one second each time it is read.
+type steppingClock struct {
+	current time.Time
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.current = c.current.Add(time.Second)
+	return c.current
+}
+
+func (c *steppingClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
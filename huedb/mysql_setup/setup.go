@@ -0,0 +1,97 @@
+// Package mysql_setup sets up a MySQL or MariaDB database for Hue Web App
+package mysql_setup
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SetUpTables creates all needed tables in database.
+func SetUpTables(db *sql.DB) error {
+	_, err := db.Exec("create table if not exists named_colors (id BIGINT PRIMARY KEY AUTO_INCREMENT, description TEXT, colors TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists at_time_tasks (id BIGINT PRIMARY KEY AUTO_INCREMENT, schedule_id VARCHAR(255), hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, time BIGINT, group_id VARCHAR(255), recurrence VARCHAR(255) NOT NULL DEFAULT '', index at_time_tasks_scheduleid_idx (group_id, schedule_id))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists named_colors_history (id BIGINT PRIMARY KEY AUTO_INCREMENT, named_colors_id BIGINT, description TEXT, colors TEXT, updated_at BIGINT, deleted BOOLEAN, index named_colors_history_named_colors_id_idx (named_colors_id))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists scheduled_tasks (id BIGINT PRIMARY KEY AUTO_INCREMENT, hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, recurrence TEXT, enabled BOOLEAN, `high_priority` BOOLEAN)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists users (id BIGINT PRIMARY KEY AUTO_INCREMENT, name VARCHAR(255) COLLATE utf8mb4_bin, password TEXT, role INTEGER, unique index users_name_idx (name))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists light_aliases (id BIGINT PRIMARY KEY AUTO_INCREMENT, light_id INTEGER, name VARCHAR(255) COLLATE utf8mb4_bin, unique index light_aliases_name_idx (name))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists light_groups (id BIGINT PRIMARY KEY AUTO_INCREMENT, name VARCHAR(255) COLLATE utf8mb4_bin, light_set TEXT, unique index light_groups_name_idx (name))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists scene_components (id BIGINT PRIMARY KEY AUTO_INCREMENT, named_colors_id BIGINT, component_id BIGINT, light_set TEXT, light_offset INTEGER, index scene_components_named_colors_id_idx (named_colors_id))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists bridges (id BIGINT PRIMARY KEY AUTO_INCREMENT, name VARCHAR(255) COLLATE utf8mb4_bin, host TEXT, user TEXT, unique index bridges_name_idx (name))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists weather_settings (id BIGINT PRIMARY KEY AUTO_INCREMENT, provider TEXT, station_id TEXT, api_key TEXT, poll_interval BIGINT, units TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists description_overrides (hue_task_id INTEGER PRIMARY KEY, description TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists last_light_colors (light_id INTEGER PRIMARY KEY, colors TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists at_time_tasks_archive (id BIGINT PRIMARY KEY AUTO_INCREMENT, schedule_id VARCHAR(255), hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, time BIGINT, group_id VARCHAR(255), recurrence VARCHAR(255), status INTEGER, completed_at BIGINT, index at_time_tasks_archive_group_id_idx (group_id, completed_at))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists schedule_profiles (id BIGINT PRIMARY KEY AUTO_INCREMENT, name VARCHAR(255) COLLATE utf8mb4_bin, scheduled_task_ids TEXT, active BOOLEAN, unique index schedule_profiles_name_idx (name))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists sensor_events (id BIGINT PRIMARY KEY AUTO_INCREMENT, sensor_id INTEGER, type TEXT, value TEXT, time BIGINT, index sensor_events_time_idx (time))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists weather_observations (id BIGINT PRIMARY KEY AUTO_INCREMENT, station TEXT, temperature DOUBLE, weather TEXT, wind_speed DOUBLE, time BIGINT, index weather_observations_time_idx (time))")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists preferences (user_id BIGINT, `key` VARCHAR(255) COLLATE utf8mb4_bin, value TEXT, PRIMARY KEY (user_id, `key`))")
+	if err != nil {
+		return err
+	}
+	return addColumnIfMissing(
+		db, "at_time_tasks", "recurrence", "VARCHAR(255) NOT NULL DEFAULT ''")
+}
+
+// addColumnIfMissing adds a column to a table created by an older
+// version of SetUpTables.
+func addColumnIfMissing(db *sql.DB, table, column, decl string) error {
+	var count int
+	err := db.QueryRow(
+		"select count(*) from information_schema.columns where table_schema = database() and table_name = ? and column_name = ?",
+		table,
+		column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = db.Exec(
+		fmt.Sprintf("alter table %s add column %s %s", table, column, decl))
+	return err
+}
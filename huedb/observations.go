@@ -0,0 +1,97 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/weather"
+	"time"
+)
+
+// WeatherObservation represents one logged weather observation.
+type WeatherObservation struct {
+	// The unique database dependent numeric ID of this observation.
+	Id int64
+
+	// The provider specific station or location observed.
+	Station string
+
+	// Temperature in celsius
+	Temperature float64
+
+	// Weather conditions e.g 'Fair' or 'Partly Cloudy'
+	Weather string
+
+	// Wind speed in meters per second
+	WindSpeed float64
+
+	// When the observation was fetched. Stores keep this to the second.
+	Time time.Time
+}
+
+type AddWeatherObservationRunner interface {
+	// AddWeatherObservation adds a weather observation.
+	AddWeatherObservation(t db.Transaction, observation *WeatherObservation) error
+}
+
+type WeatherObservationsRunner interface {
+	// WeatherObservations gets the weather observations fetched on or after
+	// start and before end in ascending order by time. Observations
+	// fetched at the same time come in ascending order by id.
+	WeatherObservations(
+		t db.Transaction,
+		start, end time.Time,
+		consumer goconsume.Consumer) error
+}
+
+type TrimWeatherObservationsRunner interface {
+	// TrimWeatherObservations removes the weather observations fetched
+	// before the given time.
+	TrimWeatherObservations(t db.Transaction, before time.Time) error
+}
+
+// WeatherObservationStore stores weather observations.
+type WeatherObservationStore interface {
+	AddWeatherObservationRunner
+	WeatherObservationsRunner
+	TrimWeatherObservationsRunner
+}
+
+// RecentWeatherObservations gets the weather observations in store
+// fetched within the last hours hours of now in ascending order by time.
+func RecentWeatherObservations(
+	t db.Transaction,
+	store WeatherObservationsRunner,
+	hours int,
+	now time.Time,
+	consumer goconsume.Consumer) error {
+	return store.WeatherObservations(
+		t,
+		now.Add(-time.Duration(hours)*time.Hour),
+		now.Add(time.Second),
+		consumer)
+}
+
+// NewWeatherObservationLog returns a weather.ObservationLog that adds
+// each observation to store in metric units.
+func NewWeatherObservationLog(
+	store AddWeatherObservationRunner) weather.ObservationLog {
+	return weatherObservationLog{store: store}
+}
+
+type weatherObservationLog struct {
+	store AddWeatherObservationRunner
+}
+
+func (l weatherObservationLog) LogObservation(
+	station string,
+	observation *weather.Observation,
+	fetchedAt time.Time) error {
+	metric := observation.In(weather.Metric)
+	return l.store.AddWeatherObservation(nil, &WeatherObservation{
+		Station:     station,
+		Temperature: metric.Temperature,
+		Weather:     metric.Weather,
+		WindSpeed:   metric.WindSpeed,
+		Time:        fetchedAt,
+	})
+}
@@ -0,0 +1,127 @@
+// Package postgres_setup sets up a PostgreSQL database for Hue Web App
+package postgres_setup
+
+import (
+	"database/sql"
+)
+
+// SetUpTables creates all needed tables in database.
+func SetUpTables(db *sql.DB) error {
+	_, err := db.Exec("create table if not exists named_colors (id BIGSERIAL PRIMARY KEY, description TEXT, colors TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists at_time_tasks (id BIGSERIAL PRIMARY KEY, schedule_id TEXT, hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, time BIGINT, group_id TEXT, recurrence TEXT NOT NULL DEFAULT '')")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("alter table at_time_tasks add column if not exists recurrence TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create index if not exists at_time_tasks_scheduleid_idx on at_time_tasks (group_id, schedule_id)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists named_colors_history (id BIGSERIAL PRIMARY KEY, named_colors_id BIGINT, description TEXT, colors TEXT, updated_at BIGINT, deleted BOOLEAN)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create index if not exists named_colors_history_named_colors_id_idx on named_colors_history (named_colors_id)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists scheduled_tasks (id BIGSERIAL PRIMARY KEY, hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, recurrence TEXT, enabled BOOLEAN, high_priority BOOLEAN)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists users (id BIGSERIAL PRIMARY KEY, name TEXT, password TEXT, role INTEGER)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create unique index if not exists users_name_idx on users (name)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists light_aliases (id BIGSERIAL PRIMARY KEY, light_id INTEGER, name TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create unique index if not exists light_aliases_name_idx on light_aliases (name)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists light_groups (id BIGSERIAL PRIMARY KEY, name TEXT, light_set TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create unique index if not exists light_groups_name_idx on light_groups (name)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists scene_components (id BIGSERIAL PRIMARY KEY, named_colors_id BIGINT, component_id BIGINT, light_set TEXT, light_offset INTEGER)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create index if not exists scene_components_named_colors_id_idx on scene_components (named_colors_id)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists bridges (id BIGSERIAL PRIMARY KEY, name TEXT, host TEXT, \"user\" TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create unique index if not exists bridges_name_idx on bridges (name)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists weather_settings (id BIGSERIAL PRIMARY KEY, provider TEXT, station_id TEXT, api_key TEXT, poll_interval BIGINT, units TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists description_overrides (hue_task_id INTEGER PRIMARY KEY, description TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists last_light_colors (light_id INTEGER PRIMARY KEY, colors TEXT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists at_time_tasks_archive (id BIGSERIAL PRIMARY KEY, schedule_id TEXT, hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, time BIGINT, group_id TEXT, recurrence TEXT, status INTEGER, completed_at BIGINT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create index if not exists at_time_tasks_archive_group_id_idx on at_time_tasks_archive (group_id, completed_at)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists schedule_profiles (id BIGSERIAL PRIMARY KEY, name TEXT, scheduled_task_ids TEXT, active BOOLEAN)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create unique index if not exists schedule_profiles_name_idx on schedule_profiles (name)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists sensor_events (id BIGSERIAL PRIMARY KEY, sensor_id INTEGER, type TEXT, value TEXT, time BIGINT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create index if not exists sensor_events_time_idx on sensor_events (time)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists weather_observations (id BIGSERIAL PRIMARY KEY, station TEXT, temperature DOUBLE PRECISION, weather TEXT, wind_speed DOUBLE PRECISION, time BIGINT)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create index if not exists weather_observations_time_idx on weather_observations (time)")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("create table if not exists preferences (user_id BIGINT, key TEXT, value TEXT, PRIMARY KEY (user_id, key))")
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package huedb
+
+import (
+	"encoding/json"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+)
+
+// Preference is a per user setting such as favorite tasks or UI theme.
+type Preference struct {
+	// The id of the user who owns the preference.
+	UserId int64
+
+	// The name of the preference. Unique for each user.
+	Key string
+
+	// The value of the preference as JSON.
+	Value string
+}
+
+type PreferenceRunner interface {
+	// Preference gets the preference with given key for given user.
+	// Preference returns ErrNoSuchId if there is no such preference.
+	Preference(
+		t db.Transaction, userId int64, key string, pref *Preference) error
+}
+
+type PreferencesRunner interface {
+	// Preferences gets all the preferences of given user ordered by key.
+	Preferences(
+		t db.Transaction, userId int64, consumer goconsume.Consumer) error
+}
+
+type SetPreferenceRunner interface {
+	// SetPreference adds a preference or replaces the preference with the
+	// same user id and key.
+	SetPreference(t db.Transaction, pref *Preference) error
+}
+
+type RemovePreferenceRunner interface {
+	// RemovePreference removes the preference with given key for given
+	// user.
+	RemovePreference(t db.Transaction, userId int64, key string) error
+}
+
+// PreferencesStore persists per user preferences.
+type PreferencesStore interface {
+	PreferenceRunner
+	PreferencesRunner
+	SetPreferenceRunner
+	RemovePreferenceRunner
+}
+
+// ReadPreference decodes the preference with given key for given user
+// into value. ReadPreference returns ErrNoSuchId if there is no such
+// preference.
+func ReadPreference(
+	t db.Transaction,
+	store PreferenceRunner,
+	userId int64,
+	key string,
+	value interface{}) error {
+	var pref Preference
+	if err := store.Preference(t, userId, key, &pref); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(pref.Value), value)
+}
+
+// WritePreference stores value encoded as JSON as the preference with
+// given key for given user.
+func WritePreference(
+	t db.Transaction,
+	store SetPreferenceRunner,
+	userId int64,
+	key string,
+	value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return store.SetPreference(
+		t, &Preference{UserId: userId, Key: key, Value: string(encoded)})
+}
@@ -0,0 +1,29 @@
+package huedb_test
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"reflect"
+	"testing"
+)
+
+func TestReadWritePreference(t *testing.T) {
+	store := in_memory.New()
+	favorites := []int{7, 3}
+	if err := huedb.WritePreference(
+		nil, store, 1, "favorites", favorites); err != nil {
+		t.Fatalf("Got error writing: %v", err)
+	}
+	var actual []int
+	if err := huedb.ReadPreference(
+		nil, store, 1, "favorites", &actual); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if !reflect.DeepEqual(favorites, actual) {
+		t.Errorf("Expected %v, got %v", favorites, actual)
+	}
+	if err := huedb.ReadPreference(
+		nil, store, 2, "favorites", &actual); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+)
+
+// ScheduleProfile represents a named set of scheduled tasks such as
+// "Vacation" or "Weekday". At most one schedule profile is active at a
+// time.
+type ScheduleProfile struct {
+	// The unique database dependent numeric ID of this profile.
+	Id int64
+
+	// The name of the profile. Unique among schedule profiles.
+	Name string
+
+	// The ids of the EncodedScheduledTask instances in this profile in
+	// ascending order.
+	ScheduledTaskIds []int64
+
+	// True if this is the active profile. Only ActivateScheduleProfile
+	// changes this field in persistent storage.
+	Active bool
+}
+
+type ScheduleProfileByIdRunner interface {
+	// ScheduleProfileById gets a schedule profile by id.
+	ScheduleProfileById(
+		t db.Transaction, id int64, profile *ScheduleProfile) error
+}
+
+type ScheduleProfilesRunner interface {
+	// ScheduleProfiles gets all schedule profiles ordered by name.
+	ScheduleProfiles(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+type AddScheduleProfileRunner interface {
+	// AddScheduleProfile adds an inactive schedule profile.
+	AddScheduleProfile(t db.Transaction, profile *ScheduleProfile) error
+}
+
+type UpdateScheduleProfileRunner interface {
+	// UpdateScheduleProfile updates the name and scheduled tasks of a
+	// schedule profile by id. It leaves the Active field alone.
+	UpdateScheduleProfile(t db.Transaction, profile *ScheduleProfile) error
+}
+
+type RemoveScheduleProfileRunner interface {
+	// RemoveScheduleProfile removes a schedule profile by id.
+	RemoveScheduleProfile(t db.Transaction, id int64) error
+}
+
+type ActivateScheduleProfileRunner interface {
+	// ActivateScheduleProfile makes the schedule profile with given id the
+	// only active one. An id of 0 leaves no profile active.
+	ActivateScheduleProfile(t db.Transaction, id int64) error
+}
+
+// ScheduleProfileStore persists schedule profiles.
+type ScheduleProfileStore interface {
+	ScheduleProfileByIdRunner
+	ScheduleProfilesRunner
+	AddScheduleProfileRunner
+	UpdateScheduleProfileRunner
+	RemoveScheduleProfileRunner
+	ActivateScheduleProfileRunner
+}
+
+// ActiveScheduleProfile returns the active schedule profile in store or
+// ErrNoSuchId if no profile is active.
+func ActiveScheduleProfile(
+	t db.Transaction, store ScheduleProfilesRunner) (*ScheduleProfile, error) {
+	var all []ScheduleProfile
+	if err := store.ScheduleProfiles(t, goconsume.AppendTo(&all)); err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if all[i].Active {
+			return &all[i], nil
+		}
+	}
+	return nil, ErrNoSuchId
+}
@@ -0,0 +1,174 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"sync"
+	"time"
+)
+
+// WriteQueue applies store writes in a background goroutine in the order
+// they were queued so that callers don't wait on slow storage.
+// WriteQueue is safe to use with multiple goroutines.
+type WriteQueue struct {
+	writes  chan func() error
+	onWrite func(err error)
+	mutex   sync.Mutex
+	drained *sync.Cond
+	pending int
+	closed  bool
+	done    chan struct{}
+}
+
+// NewWriteQueue returns a new WriteQueue holding at most size writes that
+// have yet to be applied. Once the queue is full, Enqueue blocks until
+// there is room. After applying each write, the background goroutine
+// calls onWrite with the error from the write or nil if the write
+// succeeded. onWrite may be nil.
+func NewWriteQueue(size int, onWrite func(err error)) *WriteQueue {
+	result := &WriteQueue{
+		writes:  make(chan func() error, size),
+		onWrite: onWrite,
+		done:    make(chan struct{}),
+	}
+	result.drained = sync.NewCond(&result.mutex)
+	go result.loop()
+	return result
+}
+
+// Enqueue queues write. After Close, Enqueue applies write right away.
+func (q *WriteQueue) Enqueue(write func() error) {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		q.apply(write)
+		return
+	}
+	q.pending++
+	q.mutex.Unlock()
+	q.writes <- write
+}
+
+// Flush blocks until all writes queued so far are applied.
+func (q *WriteQueue) Flush() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for q.pending > 0 {
+		q.drained.Wait()
+	}
+}
+
+// Close applies any queued writes and stops the background goroutine.
+func (q *WriteQueue) Close() {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return
+	}
+	q.closed = true
+	q.mutex.Unlock()
+	q.Flush()
+	close(q.writes)
+	<-q.done
+}
+
+func (q *WriteQueue) loop() {
+	defer close(q.done)
+	for write := range q.writes {
+		q.apply(write)
+		q.mutex.Lock()
+		q.pending--
+		if q.pending == 0 {
+			q.drained.Broadcast()
+		}
+		q.mutex.Unlock()
+	}
+}
+
+func (q *WriteQueue) apply(write func() error) {
+	err := write()
+	if q.onWrite != nil {
+		q.onWrite(err)
+	}
+}
+
+// QueuedEncodedAtTimeTaskStore is an EncodedAtTimeTaskStore that queues
+// writes made with a nil transaction on a WriteQueue instead of waiting
+// for them. Writes report errors through the WriteQueue rather than
+// returning them, and AddEncodedAtTimeTask does not set the Id field of
+// the task. Reads wait for queued writes so that they always see them.
+// Calls with a non-nil transaction wait for queued writes and then go
+// straight to the underlying store.
+type QueuedEncodedAtTimeTaskStore struct {
+	store EncodedAtTimeTaskStore
+	queue *WriteQueue
+}
+
+// NewQueuedEncodedAtTimeTaskStore returns a QueuedEncodedAtTimeTaskStore
+// that writes to store through queue.
+func NewQueuedEncodedAtTimeTaskStore(
+	store EncodedAtTimeTaskStore,
+	queue *WriteQueue) *QueuedEncodedAtTimeTaskStore {
+	return &QueuedEncodedAtTimeTaskStore{store: store, queue: queue}
+}
+
+func (s *QueuedEncodedAtTimeTaskStore) AddEncodedAtTimeTask(
+	t db.Transaction, task *EncodedAtTimeTask) error {
+	if t != nil {
+		s.queue.Flush()
+		return s.store.AddEncodedAtTimeTask(t, task)
+	}
+	taskCopy := *task
+	s.queue.Enqueue(func() error {
+		return s.store.AddEncodedAtTimeTask(nil, &taskCopy)
+	})
+	return nil
+}
+
+func (s *QueuedEncodedAtTimeTaskStore) RemoveEncodedAtTimeTaskByScheduleId(
+	t db.Transaction, groupId, scheduleId string) error {
+	if t != nil {
+		s.queue.Flush()
+		return s.store.RemoveEncodedAtTimeTaskByScheduleId(
+			t, groupId, scheduleId)
+	}
+	s.queue.Enqueue(func() error {
+		return s.store.RemoveEncodedAtTimeTaskByScheduleId(
+			nil, groupId, scheduleId)
+	})
+	return nil
+}
+
+func (s *QueuedEncodedAtTimeTaskStore) EncodedAtTimeTasks(
+	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
+	s.queue.Flush()
+	return s.store.EncodedAtTimeTasks(t, groupId, consumer)
+}
+
+func (s *QueuedEncodedAtTimeTaskStore) RemoveExpired(
+	t db.Transaction, before time.Time) error {
+	if t != nil {
+		s.queue.Flush()
+		return s.store.RemoveExpired(t, before)
+	}
+	s.queue.Enqueue(func() error {
+		return s.store.RemoveExpired(nil, before)
+	})
+	return nil
+}
+
+func (s *QueuedEncodedAtTimeTaskStore) UpdateEncodedAtTimeTaskTime(
+	t db.Transaction,
+	groupId, scheduleId, newScheduleId string,
+	newTime time.Time) error {
+	if t != nil {
+		s.queue.Flush()
+		return s.store.UpdateEncodedAtTimeTaskTime(
+			t, groupId, scheduleId, newScheduleId, newTime)
+	}
+	s.queue.Enqueue(func() error {
+		return s.store.UpdateEncodedAtTimeTaskTime(
+			nil, groupId, scheduleId, newScheduleId, newTime)
+	})
+	return nil
+}
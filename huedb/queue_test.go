@@ -0,0 +1,105 @@
+package huedb_test
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueuedEncodedAtTimeTaskStore(t *testing.T) {
+	store := &blockingEncodedAtTimeTaskStore{
+		EncodedAtTimeTaskStore: in_memory.New(),
+		gate:                   make(chan struct{}),
+	}
+	var mutex sync.Mutex
+	var writeCount int
+	queue := huedb.NewWriteQueue(10, func(err error) {
+		if err != nil {
+			t.Errorf("Got error writing: %v", err)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		writeCount++
+	})
+	defer queue.Close()
+	queued := huedb.NewQueuedEncodedAtTimeTaskStore(store, queue)
+
+	// These return right away even though the store is blocked.
+	first := huedb.EncodedAtTimeTask{
+		GroupId: "g", ScheduleId: "1", Action: "a", Time: 1000}
+	second := huedb.EncodedAtTimeTask{
+		GroupId: "g", ScheduleId: "2", Action: "b", Time: 2000}
+	if err := queued.AddEncodedAtTimeTask(nil, &first); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	if err := queued.AddEncodedAtTimeTask(nil, &second); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	if err := queued.UpdateEncodedAtTimeTaskTime(
+		nil, "g", "2", "3", time.Unix(3000, 0)); err != nil {
+		t.Fatalf("Got error updating: %v", err)
+	}
+	if err := queued.RemoveEncodedAtTimeTaskByScheduleId(
+		nil, "g", "1"); err != nil {
+		t.Fatalf("Got error removing: %v", err)
+	}
+	close(store.gate)
+
+	// Reads see all queued writes
+	var tasks []huedb.EncodedAtTimeTask
+	if err := queued.EncodedAtTimeTasks(
+		nil, "g", goconsume.AppendTo(&tasks)); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	for i := range tasks {
+		tasks[i].Id = 0
+	}
+	expected := []huedb.EncodedAtTimeTask{
+		{GroupId: "g", ScheduleId: "3", Action: "b", Time: 3000},
+	}
+	if !reflect.DeepEqual(expected, tasks) {
+		t.Errorf("Expected %v, got %v", expected, tasks)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if writeCount != 4 {
+		t.Errorf("Expected 4 writes, got %d", writeCount)
+	}
+}
+
+func TestWriteQueueClose(t *testing.T) {
+	var writes []int
+	queue := huedb.NewWriteQueue(1, nil)
+	for i := 0; i < 5; i++ {
+		i := i
+		queue.Enqueue(func() error {
+			writes = append(writes, i)
+			return nil
+		})
+	}
+	queue.Close()
+	queue.Enqueue(func() error {
+		writes = append(writes, 5)
+		return nil
+	})
+	expected := []int{0, 1, 2, 3, 4, 5}
+	if !reflect.DeepEqual(expected, writes) {
+		t.Errorf("Expected %v, got %v", expected, writes)
+	}
+}
+
+type blockingEncodedAtTimeTaskStore struct {
+	huedb.EncodedAtTimeTaskStore
+	gate chan struct{}
+}
+
+func (s *blockingEncodedAtTimeTaskStore) AddEncodedAtTimeTask(
+	t db.Transaction, task *huedb.EncodedAtTimeTask) error {
+	<-s.gate
+	return s.EncodedAtTimeTaskStore.AddEncodedAtTimeTask(t, task)
+}
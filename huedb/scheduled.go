@@ -0,0 +1,266 @@
+package huedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/utils"
+	"github.com/keep94/tasks/recurring"
+	"log"
+	"time"
+)
+
+// EncodedScheduledTask represents a utils.ScheduledTask in a form that
+// can be persisted in a database.
+type EncodedScheduledTask struct {
+	// The unique database dependent numeric ID of this scheduled task.
+	Id int64
+
+	// The ID of the scheduled hue task.
+	HueTaskId int
+
+	// The encoded form of the hue action in the scheduled hue task.
+	Action string
+
+	// The description of the scheduled task.
+	Description string
+
+	// The encoded set of lights on which the scheduled hue task will run.
+	LightSet string
+
+	// When the scheduled task runs. Empty means running always.
+	// DecodeRecurrence converts this to a RecurrenceSpec.
+	Recurrence string
+
+	// True if the scheduled task is enabled.
+	Enabled bool
+
+	// True if the scheduled task should preempt already running tasks.
+	HighPriority bool
+}
+
+type EncodedScheduledTaskByIdRunner interface {
+	// EncodedScheduledTaskById gets a scheduled task by id.
+	EncodedScheduledTaskById(
+		t db.Transaction, id int64, task *EncodedScheduledTask) error
+}
+
+type EncodedScheduledTasksRunner interface {
+	// EncodedScheduledTasks gets all scheduled tasks.
+	EncodedScheduledTasks(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+type AddEncodedScheduledTaskRunner interface {
+	// AddEncodedScheduledTask adds a scheduled task.
+	AddEncodedScheduledTask(t db.Transaction, task *EncodedScheduledTask) error
+}
+
+type UpdateEncodedScheduledTaskRunner interface {
+	// UpdateEncodedScheduledTask updates a scheduled task by id.
+	UpdateEncodedScheduledTask(
+		t db.Transaction, task *EncodedScheduledTask) error
+}
+
+type RemoveEncodedScheduledTaskRunner interface {
+	// RemoveEncodedScheduledTask removes a scheduled task by id.
+	RemoveEncodedScheduledTask(t db.Transaction, id int64) error
+}
+
+// RecurrenceSpec describes when a persisted scheduled task runs.
+type RecurrenceSpec struct {
+	// The first time the scheduled task runs.
+	Start time.Time
+
+	// The time between runs. Since Period is a fixed duration, a task
+	// that runs daily shifts by an hour of local time when daylight
+	// saving time begins or ends.
+	Period time.Duration
+
+	// The days of the week on which the scheduled task runs. Zero means
+	// every day.
+	Days recurring.DaysOfWeek
+}
+
+// Recurring returns the utils.Recurring that s describes.
+func (s *RecurrenceSpec) Recurring() *utils.Recurring {
+	r := recurring.AtInterval(s.Start, s.Period)
+	if s.Days != 0 {
+		r = recurring.Filter(r, recurring.OnDays(s.Days))
+	}
+	return &utils.Recurring{
+		R: r,
+		Description: fmt.Sprintf(
+			"Every %v from %s", s.Period, s.Start.Format(time.RFC3339)),
+	}
+}
+
+// EncodeRecurrence returns the Recurrence field value of an
+// EncodedScheduledTask for spec. A nil spec means running always. The
+// value is the start time in seconds after Jan 1 1970 GMT, the seconds
+// between runs, and the days of the week separated by colons.
+func EncodeRecurrence(spec *RecurrenceSpec) string {
+	if spec == nil {
+		return ""
+	}
+	return fmt.Sprintf(
+		"%d:%d:%d",
+		spec.Start.Unix(),
+		int64(spec.Period/time.Second),
+		int(spec.Days))
+}
+
+// DecodeRecurrence converts the Recurrence field value of an
+// EncodedScheduledTask back to a RecurrenceSpec. DecodeRecurrence
+// returns nil for the empty string meaning running always.
+func DecodeRecurrence(s string) (*RecurrenceSpec, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var start, seconds int64
+	var days int
+	if _, err := fmt.Sscanf(s, "%d:%d:%d", &start, &seconds, &days); err != nil {
+		return nil, errors.New(
+			fmt.Sprintf("Bad recurrence %s: %v", s, err))
+	}
+	if seconds <= 0 {
+		return nil, errors.New(
+			fmt.Sprintf("Bad recurrence %s: period must be positive", s))
+	}
+	return &RecurrenceSpec{
+		Start:  time.Unix(start, 0),
+		Period: time.Duration(seconds) * time.Second,
+		Days:   recurring.DaysOfWeek(days),
+	}, nil
+}
+
+// NewEncodedScheduledTask creates an EncodedScheduledTask that runs h on
+// lightSet. encoder encodes the hue action in h. recurrence is the value
+// for the Recurrence field.
+func NewEncodedScheduledTask(
+	encoder ActionEncoder,
+	h *ops.HueTask,
+	lightSet lights.Set,
+	recurrence string,
+	enabled bool,
+	hiPriority bool) (*EncodedScheduledTask, error) {
+	action, err := encoder.Encode(h.Id, h.HueAction)
+	if err != nil {
+		return nil, err
+	}
+	return &EncodedScheduledTask{
+		HueTaskId:    h.Id,
+		Action:       action,
+		Description:  h.Description,
+		LightSet:     lightSet.String(),
+		Recurrence:   recurrence,
+		Enabled:      enabled,
+		HighPriority: hiPriority,
+	}, nil
+}
+
+// ScheduledTasks reads all the scheduled tasks in store and materializes
+// them as utils.ScheduledTasks that run on te. Each materialized task
+// decodes its hue action with decoder each time it runs so that it
+// always runs the latest version of a persisted hue task. The Id of each
+// materialized task is the database id plus ops.PersistentTaskIdOffset
+// so that it does not collide with hard-coded scheduled tasks.
+// ScheduledTasks enables the materialized tasks whose Enabled field is
+// true. ScheduledTasks logs and skips the scheduled tasks it cannot
+// decode.
+func ScheduledTasks(
+	store EncodedScheduledTasksRunner,
+	decoder ActionDecoder,
+	te *utils.MultiExecutor,
+	logger *log.Logger) (utils.ScheduledTaskList, error) {
+	var allEncoded []*EncodedScheduledTask
+	if err := store.EncodedScheduledTasks(
+		nil, goconsume.AppendPtrsTo(&allEncoded)); err != nil {
+		return nil, err
+	}
+	var result utils.ScheduledTaskList
+	for _, encoded := range allEncoded {
+		scheduledTask, err := asScheduledTask(
+			encoded, decoder, te, logger)
+		if err != nil {
+			logger.Printf(
+				"While loading scheduled task %d: %v", encoded.Id, err)
+			continue
+		}
+		if encoded.Enabled {
+			scheduledTask.Enable()
+		}
+		result = append(result, scheduledTask)
+	}
+	return result, nil
+}
+
+func asScheduledTask(
+	encoded *EncodedScheduledTask,
+	decoder ActionDecoder,
+	te *utils.MultiExecutor,
+	logger *log.Logger) (*utils.ScheduledTask, error) {
+	if _, err := decoder.Decode(encoded.HueTaskId, encoded.Action); err != nil {
+		return nil, err
+	}
+	lightSet, err := lights.InvString(encoded.LightSet)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := DecodeRecurrence(encoded.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	var r *utils.Recurring
+	if spec != nil {
+		r = spec.Recurring()
+	}
+	h := &decodingFutureHueTask{
+		encoded: *encoded, decoder: decoder, logger: logger}
+	return utils.HueTaskToScheduledTask(
+		int(encoded.Id)+ops.PersistentTaskIdOffset,
+		h,
+		lightSet,
+		r,
+		encoded.HighPriority,
+		te), nil
+}
+
+type decodingFutureHueTask struct {
+	encoded EncodedScheduledTask
+	decoder ActionDecoder
+	logger  *log.Logger
+}
+
+func (d *decodingFutureHueTask) Refresh() *ops.HueTask {
+	return d.RefreshWithContext(context.Background())
+}
+
+func (d *decodingFutureHueTask) RefreshWithContext(
+	ctx context.Context) *ops.HueTask {
+	var action ops.HueAction
+	var err error
+	if decoder, ok := d.decoder.(ContextActionDecoder); ok {
+		action, err = decoder.DecodeWithContext(
+			ctx, d.encoded.HueTaskId, d.encoded.Action)
+	} else if err = ctx.Err(); err == nil {
+		action, err = d.decoder.Decode(d.encoded.HueTaskId, d.encoded.Action)
+	}
+	if err != nil {
+		d.logger.Printf(
+			"While decoding hue task %d: %v", d.encoded.HueTaskId, err)
+		action = errAction{err}
+	}
+	return &ops.HueTask{
+		Id:          d.encoded.HueTaskId,
+		HueAction:   action,
+		Description: d.encoded.Description,
+	}
+}
+
+func (d *decodingFutureHueTask) GetDescription() string {
+	return d.encoded.Description
+}
@@ -0,0 +1,131 @@
+package huedb_test
+
+import (
+	"bytes"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/utils"
+	"github.com/keep94/tasks/recurring"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestScheduledTasks(t *testing.T) {
+	var fakeEncoder fakeActionEncoder
+	eachEvening := &huedb.RecurrenceSpec{
+		Start:  time.Date(2026, 10, 12, 21, 30, 0, 0, time.UTC),
+		Period: 24 * time.Hour,
+		Days:   recurring.Weekdays,
+	}
+	store := in_memory.New()
+	evening, err := huedb.NewEncodedScheduledTask(
+		fakeEncoder,
+		&ops.HueTask{Id: 31, HueAction: intAction(131), Description: "Dim"},
+		lights.New(1, 2),
+		huedb.EncodeRecurrence(eachEvening),
+		false,
+		true)
+	if err != nil {
+		t.Fatalf("Got error encoding: %v", err)
+	}
+	badDecode := &huedb.EncodedScheduledTask{
+		HueTaskId: kIdDoesNotSupportDecode, Action: "999"}
+	badRecurring := &huedb.EncodedScheduledTask{
+		HueTaskId: 32, Action: "164", Recurrence: "1760304600:0:0"}
+	for _, task := range []*huedb.EncodedScheduledTask{
+		evening, badDecode, badRecurring} {
+		if err := store.AddEncodedScheduledTask(nil, task); err != nil {
+			t.Fatalf("Got error adding: %v", err)
+		}
+	}
+	buffer := bytes.NewBuffer(nil)
+	logger := log.New(buffer, "", 0)
+	scheduled, err := huedb.ScheduledTasks(
+		store,
+		fakeEncoder,
+		utils.NewMultiExecutor(nil, logger),
+		logger)
+	if err != nil {
+		t.Fatalf("Got error loading: %v", err)
+	}
+	if len(scheduled) != 1 {
+		t.Fatalf("Expected 1 scheduled task, got %d", len(scheduled))
+	}
+	task := scheduled[0]
+	if out := task.Id; out != int(evening.Id)+ops.PersistentTaskIdOffset {
+		t.Errorf("Expected id %d, got %d", evening.Id, out)
+	}
+	if out := task.Description; out != "Dim" {
+		t.Errorf("Expected Dim, got %s", out)
+	}
+	if out := task.Lights; out.String() != "1,2" {
+		t.Errorf("Expected lights 1,2, got %v", out)
+	}
+	// Friday, Monday
+	assertTimes(
+		t,
+		task.Times,
+		time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 16, 21, 30, 0, 0, time.UTC),
+		time.Date(2026, 10, 19, 21, 30, 0, 0, time.UTC))
+	if !task.HighPriority {
+		t.Error("Expected high priority")
+	}
+	if task.IsEnabled() {
+		t.Error("Expected task to be disabled")
+	}
+	if len(buffer.Bytes()) == 0 {
+		t.Error("Expected logs for tasks that could not be loaded")
+	}
+}
+
+func TestRecurrence(t *testing.T) {
+	spec := &huedb.RecurrenceSpec{
+		Start:  time.Date(2026, 10, 16, 6, 15, 0, 0, time.UTC),
+		Period: 8 * time.Hour,
+	}
+	encoded := huedb.EncodeRecurrence(spec)
+	decoded, err := huedb.DecodeRecurrence(encoded)
+	if err != nil {
+		t.Fatalf("Got error decoding %s: %v", encoded, err)
+	}
+	if !decoded.Start.Equal(spec.Start) || decoded.Period != spec.Period || decoded.Days != 0 {
+		t.Errorf("Expected %v, got %v", spec, decoded)
+	}
+	assertTimes(
+		t,
+		decoded.Recurring(),
+		time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 16, 14, 15, 0, 0, time.UTC),
+		time.Date(2026, 10, 16, 22, 15, 0, 0, time.UTC))
+	if out := huedb.EncodeRecurrence(nil); out != "" {
+		t.Errorf("Expected empty spec, got %s", out)
+	}
+	if r, err := huedb.DecodeRecurrence(""); r != nil || err != nil {
+		t.Errorf("Expected nil, nil, got %v, %v", r, err)
+	}
+	for _, bad := range []string{"7", "1760304600:0:0", "1760304600:-60:0"} {
+		if _, err := huedb.DecodeRecurrence(bad); err == nil {
+			t.Errorf("Expected error decoding %s", bad)
+		}
+	}
+}
+
+func assertTimes(
+	t *testing.T, r *utils.Recurring, start time.Time, expected ...time.Time) {
+	t.Helper()
+	stream := r.ForTime(start)
+	defer stream.Close()
+	var current time.Time
+	for _, e := range expected {
+		if err := stream.Next(&current); err != nil {
+			t.Fatalf("Got error reading times: %v", err)
+		}
+		if !current.Equal(e) {
+			t.Errorf("Expected %v, got %v", e, current)
+		}
+	}
+}
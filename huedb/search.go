@@ -0,0 +1,71 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"strings"
+	"unicode"
+)
+
+const (
+	// The search result is an ops.NamedColors.
+	NamedColorsSearchResult = "named_colors"
+
+	// The search result is an EncodedScheduledTask.
+	ScheduledTaskSearchResult = "scheduled_task"
+
+	// The search result is an EncodedAtTimeTask.
+	AtTimeTaskSearchResult = "at_time_task"
+)
+
+// SearchResult represents one thing that Search found.
+type SearchResult struct {
+	// What was found such as NamedColorsSearchResult.
+	Kind string
+
+	// The database id of what was found.
+	Id int64
+
+	// The description of what was found.
+	Description string
+}
+
+type SearchRunner interface {
+	// Search gets the named colors, scheduled tasks, and at time tasks
+	// whose descriptions match query according to SearchMatches. Search
+	// emits named colors first, then scheduled tasks, then at time tasks.
+	// Within each kind, Search emits results in ascending order by id.
+	// Search emits nothing if query has no words.
+	Search(t db.Transaction, query string, consumer goconsume.Consumer) error
+}
+
+// SearchWords splits query into the lower case words that
+// SearchMatches uses. Words are runs of letters and digits.
+func SearchWords(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), isNotWordRune)
+}
+
+// SearchMatches returns true if each word in words begins some word in
+// description ignoring case. words come from SearchWords.
+func SearchMatches(description string, words []string) bool {
+	descWords := SearchWords(description)
+	for _, word := range words {
+		if !beginsSomeWord(descWords, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func beginsSomeWord(descWords []string, word string) bool {
+	for _, descWord := range descWords {
+		if strings.HasPrefix(descWord, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
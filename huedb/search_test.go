@@ -0,0 +1,27 @@
+package huedb_test
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"testing"
+)
+
+func TestSearchMatches(t *testing.T) {
+	testCases := []struct {
+		description string
+		query       string
+		expected    bool
+	}{
+		{"Movie-Night", "night", true},
+		{"Movie-Night", "NI mo", true},
+		{"Movie-Night", "ight", false},
+		{"Movie-Night", "movie day", false},
+		{"Dinner (blue)", "blue", true},
+		{"", "a", false},
+	}
+	for _, tc := range testCases {
+		words := huedb.SearchWords(tc.query)
+		if out := huedb.SearchMatches(tc.description, words); out != tc.expected {
+			t.Errorf("For %q, %q expected %v, got %v", tc.description, tc.query, tc.expected, out)
+		}
+	}
+}
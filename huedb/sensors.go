@@ -0,0 +1,80 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"time"
+)
+
+const (
+	// A motion sensor saw or stopped seeing motion. Value is "true" or
+	// "false".
+	MotionEvent = "motion"
+
+	// A button was pressed. Value is the button event code such as "1002".
+	ButtonEvent = "button"
+
+	// A light level reading. Value is the light level reported by the
+	// sensor.
+	LightLevelEvent = "lightlevel"
+
+	// A temperature reading. Value is the temperature in hundredths of a
+	// degree Celsius.
+	TemperatureEvent = "temperature"
+)
+
+// SensorEvent represents one event from a sensor or button.
+type SensorEvent struct {
+	// The unique database dependent numeric ID of this event.
+	Id int64
+
+	// The hue bridge sensor id.
+	SensorId int
+
+	// The type of event such as MotionEvent.
+	Type string
+
+	// The type specific value of the event.
+	Value string
+
+	// When the event happened. Stores keep this to the second.
+	Time time.Time
+}
+
+type AddSensorEventRunner interface {
+	// AddSensorEvent adds a sensor event.
+	AddSensorEvent(t db.Transaction, event *SensorEvent) error
+}
+
+type SensorEventsRunner interface {
+	// SensorEvents gets the sensor events happening on or after start and
+	// before end in ascending order by time. Events happening at the same
+	// time come in ascending order by id.
+	SensorEvents(
+		t db.Transaction,
+		start, end time.Time,
+		consumer goconsume.Consumer) error
+}
+
+type TrimSensorEventsRunner interface {
+	// TrimSensorEvents removes the sensor events happening before the
+	// given time.
+	TrimSensorEvents(t db.Transaction, before time.Time) error
+}
+
+// SensorEventStore stores sensor events.
+type SensorEventStore interface {
+	AddSensorEventRunner
+	SensorEventsRunner
+	TrimSensorEventsRunner
+}
+
+// TrimSensorEventsOlderThan removes the sensor events in store that
+// happened more than retention before now.
+func TrimSensorEventsOlderThan(
+	t db.Transaction,
+	store TrimSensorEventsRunner,
+	retention time.Duration,
+	now time.Time) error {
+	return store.TrimSensorEvents(t, now.Add(-retention))
+}
@@ -0,0 +1,40 @@
+package huedb_test
+
+import (
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"testing"
+	"time"
+)
+
+func TestTrimSensorEventsOlderThan(t *testing.T) {
+	store := in_memory.New()
+	now := time.Date(2015, 6, 8, 2, 13, 0, 0, time.UTC)
+	for _, age := range []time.Duration{
+		8 * 24 * time.Hour, 6 * 24 * time.Hour, time.Minute} {
+		event := huedb.SensorEvent{
+			SensorId: 3,
+			Type:     huedb.MotionEvent,
+			Value:    "true",
+			Time:     now.Add(-age)}
+		if err := store.AddSensorEvent(nil, &event); err != nil {
+			t.Fatalf("Got error adding: %v", err)
+		}
+	}
+	if err := huedb.TrimSensorEventsOlderThan(
+		nil, store, 7*24*time.Hour, now); err != nil {
+		t.Fatalf("Got error trimming: %v", err)
+	}
+	var events []huedb.SensorEvent
+	if err := store.SensorEvents(
+		nil,
+		now.Add(-30*24*time.Hour),
+		now,
+		goconsume.AppendTo(&events)); err != nil {
+		t.Fatalf("Got error reading: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("Expected 2 events, got %d", len(events))
+	}
+}
@@ -2,7 +2,10 @@
 package sqlite_setup
 
 import (
+	"errors"
+	"fmt"
 	"github.com/keep94/gosqlite/sqlite"
+	"strings"
 )
 
 // SetUpTables creates all needed tables in database.
@@ -11,7 +14,11 @@ func SetUpTables(conn *sqlite.Conn) error {
 	if err != nil {
 		return err
 	}
-	err = conn.Exec("create table if not exists at_time_tasks (id INTEGER PRIMARY KEY AUTOINCREMENT, schedule_id TEXT, hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, time INTEGER, group_id TEXT)")
+	err = conn.Exec("create table if not exists at_time_tasks (id INTEGER PRIMARY KEY AUTOINCREMENT, schedule_id TEXT, hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, time INTEGER, group_id TEXT, recurrence TEXT)")
+	if err != nil {
+		return err
+	}
+	err = addColumnIfMissing(conn, "at_time_tasks", "recurrence", "TEXT")
 	if err != nil {
 		return err
 	}
@@ -19,5 +26,223 @@ func SetUpTables(conn *sqlite.Conn) error {
 	if err != nil {
 		return err
 	}
+	err = conn.Exec("create table if not exists named_colors_history (id INTEGER PRIMARY KEY AUTOINCREMENT, named_colors_id INTEGER, description TEXT, colors TEXT, updated_at INTEGER, deleted INTEGER)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create index if not exists named_colors_history_named_colors_id_idx on named_colors_history (named_colors_id)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists scheduled_tasks (id INTEGER PRIMARY KEY AUTOINCREMENT, hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, recurrence TEXT, enabled INTEGER, high_priority INTEGER)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, password TEXT, role INTEGER)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create unique index if not exists users_name_idx on users (name)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists light_aliases (id INTEGER PRIMARY KEY AUTOINCREMENT, light_id INTEGER, name TEXT)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create unique index if not exists light_aliases_name_idx on light_aliases (name)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists light_groups (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, light_set TEXT)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create unique index if not exists light_groups_name_idx on light_groups (name)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists scene_components (id INTEGER PRIMARY KEY AUTOINCREMENT, named_colors_id INTEGER, component_id INTEGER, light_set TEXT, light_offset INTEGER)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create index if not exists scene_components_named_colors_id_idx on scene_components (named_colors_id)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists bridges (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, host TEXT, user TEXT)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create unique index if not exists bridges_name_idx on bridges (name)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists weather_settings (id INTEGER PRIMARY KEY AUTOINCREMENT, provider TEXT, station_id TEXT, api_key TEXT, poll_interval INTEGER, units TEXT)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists description_overrides (hue_task_id INTEGER PRIMARY KEY, description TEXT)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists last_light_colors (light_id INTEGER PRIMARY KEY, colors TEXT)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists at_time_tasks_archive (id INTEGER PRIMARY KEY AUTOINCREMENT, schedule_id TEXT, hue_task_id INTEGER, action TEXT, description TEXT, light_set TEXT, time INTEGER, group_id TEXT, recurrence TEXT, status INTEGER, completed_at INTEGER)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create index if not exists at_time_tasks_archive_group_id_idx on at_time_tasks_archive (group_id, completed_at)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists schedule_profiles (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, scheduled_task_ids TEXT, active INTEGER)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create unique index if not exists schedule_profiles_name_idx on schedule_profiles (name)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists sensor_events (id INTEGER PRIMARY KEY AUTOINCREMENT, sensor_id INTEGER, type TEXT, value TEXT, time INTEGER)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create index if not exists sensor_events_time_idx on sensor_events (time)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists weather_observations (id INTEGER PRIMARY KEY AUTOINCREMENT, station TEXT, temperature REAL, weather TEXT, wind_speed REAL, time INTEGER)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create index if not exists weather_observations_time_idx on weather_observations (time)")
+	if err != nil {
+		return err
+	}
+	err = conn.Exec("create table if not exists preferences (user_id INTEGER, key TEXT, value TEXT, PRIMARY KEY (user_id, key))")
+	if err != nil {
+		return err
+	}
+	return setUpSearchIndex(conn)
+}
+
+// setUpSearchIndex creates the full text search index over named colors
+// and scheduled tasks along with the triggers that keep it up to date.
+// If sqlite doesn't support FTS5, setUpSearchIndex does nothing.
+func setUpSearchIndex(conn *sqlite.Conn) error {
+	exists, err := tableExists(conn, "search_index")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if conn.Exec("create virtual table search_index using fts5(kind UNINDEXED, ref_id UNINDEXED, description)") != nil {
+			// No FTS5 support
+			return nil
+		}
+		err = conn.Exec("insert into search_index (kind, ref_id, description) select 'named_colors', id, description from named_colors")
+		if err != nil {
+			return err
+		}
+		err = conn.Exec("insert into search_index (kind, ref_id, description) select 'scheduled_task', id, description from scheduled_tasks")
+		if err != nil {
+			return err
+		}
+	}
+	for _, source := range []struct {
+		table string
+		kind  string
+	}{
+		{"named_colors", "named_colors"},
+		{"scheduled_tasks", "scheduled_task"},
+	} {
+		err = conn.Exec(fmt.Sprintf("create trigger if not exists %[1]s_search_insert after insert on %[1]s begin insert into search_index (kind, ref_id, description) values ('%[2]s', new.id, new.description); end", source.table, source.kind))
+		if err != nil {
+			return err
+		}
+		err = conn.Exec(fmt.Sprintf("create trigger if not exists %[1]s_search_update after update of description on %[1]s begin delete from search_index where kind = '%[2]s' and ref_id = old.id; insert into search_index (kind, ref_id, description) values ('%[2]s', new.id, new.description); end", source.table, source.kind))
+		if err != nil {
+			return err
+		}
+		err = conn.Exec(fmt.Sprintf("create trigger if not exists %[1]s_search_delete after delete on %[1]s begin delete from search_index where kind = '%[2]s' and ref_id = old.id; end", source.table, source.kind))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableExists returns true if the database has a table with given name.
+func tableExists(conn *sqlite.Conn, name string) (bool, error) {
+	stmt, err := conn.Prepare(
+		"select name from sqlite_master where type = 'table' and name = ?")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Finalize()
+	if err := stmt.Exec(name); err != nil {
+		return false, err
+	}
+	exists := stmt.Next()
+	return exists, stmt.Error()
+}
+
+// EnableWAL puts the database file that conn uses in write-ahead log mode
+// so that reads on other connections don't wait behind writes. The mode
+// stays with the database file. Call EnableWAL outside of any transaction
+// such as before passing conn to sqlite_db.New. EnableWAL returns an error if the
+// database can't use write-ahead logging such as an in memory database.
+func EnableWAL(conn *sqlite.Conn) error {
+	stmt, err := conn.Prepare("pragma journal_mode=WAL")
+	if err != nil {
+		return err
+	}
+	defer stmt.Finalize()
+	if err := stmt.Exec(); err != nil {
+		return err
+	}
+	var mode string
+	if stmt.Next() {
+		if err := stmt.Scan(&mode); err != nil {
+			return err
+		}
+	}
+	if err := stmt.Error(); err != nil {
+		return err
+	}
+	if !strings.EqualFold(mode, "wal") {
+		return errors.New(fmt.Sprintf(
+			"sqlite_setup: Journal mode is %s, not WAL.", mode))
+	}
 	return nil
 }
+
+// addColumnIfMissing adds a column to a table created by an older
+// version of SetUpTables.
+func addColumnIfMissing(conn *sqlite.Conn, table, column, decl string) error {
+	stmt, err := conn.Prepare(fmt.Sprintf("pragma table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer stmt.Finalize()
+	if err := stmt.Exec(); err != nil {
+		return err
+	}
+	for stmt.Next() {
+		var cid, name, colType, notNull, defaultValue, pk string
+		if err := stmt.Scan(
+			&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := stmt.Error(); err != nil {
+		return err
+	}
+	return conn.Exec(
+		fmt.Sprintf("alter table %s add column %s %s", table, column, decl))
+}
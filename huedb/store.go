@@ -2,6 +2,7 @@
 package huedb
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/keep94/appcommon/db"
@@ -31,11 +32,117 @@ type NamedColorsRunner interface {
 	NamedColors(t db.Transaction, consumer goconsume.Consumer) error
 }
 
+type NamedColorsPageRunner interface {
+	// NamedColorsPage gets at most limit named colors ordered by id
+	// skipping the first offset named colors.
+	NamedColorsPage(
+		t db.Transaction, offset, limit int, consumer goconsume.Consumer) error
+}
+
+// NamedColorsOrderBy is what NamedColorsOrdered sorts named colors by.
+type NamedColorsOrderBy int
+
+const (
+	// Sort by id.
+	OrderById NamedColorsOrderBy = iota
+
+	// Sort by description ignoring case.
+	OrderByDescription
+
+	// Sort by when the named colors were last updated. Named colors that
+	// were never updated sort before all others.
+	OrderByUpdatedAt
+)
+
+// NamedColorsOrder tells NamedColorsOrdered how to sort.
+type NamedColorsOrder struct {
+	By         NamedColorsOrderBy
+	Descending bool
+}
+
+type NamedColorsOrderedRunner interface {
+	// NamedColorsOrdered gets all named colors sorted by order. Named
+	// colors that tie come in ascending order by id.
+	NamedColorsOrdered(
+		t db.Transaction,
+		order NamedColorsOrder,
+		consumer goconsume.Consumer) error
+}
+
+// OrderedNamedColorsRunner returns a NamedColorsRunner whose NamedColors
+// method returns the named colors in store sorted by order.
+func OrderedNamedColorsRunner(
+	store NamedColorsOrderedRunner,
+	order NamedColorsOrder) NamedColorsRunner {
+	return &orderedNamedColorsRunner{store: store, order: order}
+}
+
+// OrderedSceneStore works like OrderedNamedColorsRunner except that the
+// returned store can also fetch named colors by id so that it can back a
+// dynamic.SceneFactory from dynamic.NewPresortedSceneFactory.
+func OrderedSceneStore(
+	store interface {
+		NamedColorsOrderedRunner
+		NamedColorsByIdRunner
+	},
+	order NamedColorsOrder) dynamic.SceneStore {
+	return &orderedSceneStore{
+		orderedNamedColorsRunner: orderedNamedColorsRunner{
+			store: store, order: order},
+		NamedColorsByIdRunner: store,
+	}
+}
+
+type NamedColorsByIdsRunner interface {
+	// NamedColorsByIds gets the named colors with given ids in ascending
+	// order by id. NamedColorsByIds skips ids that do not exist.
+	NamedColorsByIds(
+		t db.Transaction, ids []int64, consumer goconsume.Consumer) error
+}
+
+type NamedColorsCountRunner interface {
+	// NamedColorsCount returns the number of named colors.
+	NamedColorsCount(t db.Transaction) (int, error)
+}
+
+type NamedColorsByDescriptionRunner interface {
+	// NamedColorsByDescription gets the named colors whose description
+	// contains pattern ignoring case.
+	NamedColorsByDescription(
+		t db.Transaction, pattern string, consumer goconsume.Consumer) error
+}
+
 type AddNamedColorsRunner interface {
 	// AddNamedColros adds named colors.
 	AddNamedColors(t db.Transaction, colors *ops.NamedColors) error
 }
 
+type AddNamedColorsBatchRunner interface {
+	// AddNamedColorsBatch adds many named colors at once. Either all of
+	// them get added or none of them do. AddNamedColorsBatch sets the Id
+	// field of each named colors it adds.
+	AddNamedColorsBatch(t db.Transaction, batch []*ops.NamedColors) error
+}
+
+type MigrateLightColorsRunner interface {
+	// MigrateLightColors rewrites stored named colors that are in the
+	// legacy pipe delimited format in the current format of
+	// EncodeLightColors.
+	MigrateLightColors(t db.Transaction) error
+}
+
+type BackupRunner interface {
+	// Backup copies the whole database to the file dest while other
+	// goroutines continue to use it.
+	Backup(t db.Transaction, dest string) error
+}
+
+type RestoreRunner interface {
+	// Restore replaces the contents of the database with the contents
+	// of the file src that Backup wrote.
+	Restore(t db.Transaction, src string) error
+}
+
 type UpdateNamedColorsRunner interface {
 	// UpdateNamedColors updates named colors by id.
 	UpdateNamedColors(t db.Transaction, colors *ops.NamedColors) error
@@ -57,6 +164,54 @@ func HueTasks(store NamedColorsRunner) (ops.HueTaskList, error) {
 	return tasks, nil
 }
 
+// HueTasksPage returns at most limit named colors as hue tasks skipping
+// the first offset named colors.
+func HueTasksPage(
+	store NamedColorsPageRunner, offset, limit int) (ops.HueTaskList, error) {
+	var tasks ops.HueTaskList
+	consumer := goconsume.AppendTo(&tasks)
+	consumer = &namedColorsToHueTaskConsumer{Consumer: consumer}
+	if err := store.NamedColorsPage(nil, offset, limit, consumer); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// HueTasksByIds returns the named colors whose hue task ids are in
+// hueTaskIds as hue tasks in ascending order by id using a single call
+// to store. HueTasksByIds ignores hue task ids that are not persistent
+// and skips named colors that do not exist.
+func HueTasksByIds(
+	store NamedColorsByIdsRunner, hueTaskIds []int) (ops.HueTaskList, error) {
+	ids := make([]int64, 0, len(hueTaskIds))
+	for _, hueTaskId := range hueTaskIds {
+		if hueTaskId >= ops.PersistentTaskIdOffset {
+			ids = append(ids, int64(hueTaskId-ops.PersistentTaskIdOffset))
+		}
+	}
+	var tasks ops.HueTaskList
+	consumer := goconsume.AppendTo(&tasks)
+	consumer = &namedColorsToHueTaskConsumer{Consumer: consumer}
+	if err := store.NamedColorsByIds(nil, ids, consumer); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// HueTasksByDescription returns the named colors whose description
+// contains pattern ignoring case as hue tasks.
+func HueTasksByDescription(
+	store NamedColorsByDescriptionRunner,
+	pattern string) (ops.HueTaskList, error) {
+	var tasks ops.HueTaskList
+	consumer := goconsume.AppendTo(&tasks)
+	consumer = &namedColorsToHueTaskConsumer{Consumer: consumer}
+	if err := store.NamedColorsByDescription(nil, pattern, consumer); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
 // HueTaskById returns a hue task for named colors by its Id. If not found
 // or if store is nil, returns a Hue task with an action that reports
 // ErrNoSuchId.
@@ -76,42 +231,32 @@ func HueTaskById(store NamedColorsByIdRunner, hueTaskId int) *ops.HueTask {
 }
 
 // DescriptionMap maps hue task ids to descriptions. These instances must
-// be treated as immutable.
+// be treated as immutable. New code should store description overrides
+// in a DescriptionOverrideStore instead.
 type DescriptionMap map[int]string
 
-type descriptionMapFilter DescriptionMap
-
-func (f descriptionMapFilter) Filter(ptr interface{}) bool {
-	p := ptr.(*ops.NamedColors)
-	desc, ok := f[int(p.Id)+ops.PersistentTaskIdOffset]
-	if ok {
-		p.Description = desc
-	}
-	return true
-}
-
 // FixDescriptionByIdRunner returns a new NamedColorsByIdRunner that works
 // just like delegate except that for a fetched NamedColors, x,
 // if x.Id + utils.PersistentTaskIdOffset is in descriptionMap, then
 // x.Description is replaced with the corresponding value in descriptionMap.
+// FixDescriptionByIdRunner is kept for compatibility; it is the same as
+// OverrideDescriptionByIdRunner(delegate, descriptionMap).
 func FixDescriptionByIdRunner(
 	delegate NamedColorsByIdRunner,
 	descriptionMap DescriptionMap) NamedColorsByIdRunner {
-	return &fixDescriptionByIdRunner{
-		delegate: delegate,
-		filter:   descriptionMapFilter(descriptionMap)}
+	return OverrideDescriptionByIdRunner(delegate, descriptionMap)
 }
 
 // FixDescriptionsRunner returns a new NamedColorsRunner that works
 // just like delegate except that ifor a fetched NamedColors, x,
 // if x.Id + utils.PersistentTaskIdOffset is in descriptionMap, then
 // x.Description is replaced with the corresponding value in descriptionMap.
+// FixDescriptionsRunner is kept for compatibility; it is the same as
+// OverrideDescriptionsRunner(delegate, descriptionMap).
 func FixDescriptionsRunner(
 	delegate NamedColorsRunner,
 	descriptionMap DescriptionMap) NamedColorsRunner {
-	return &fixDescriptionRunner{
-		delegate: delegate,
-		filter:   descriptionMapFilter(descriptionMap)}
+	return OverrideDescriptionsRunner(delegate, descriptionMap)
 }
 
 // FutureHueTask creates a HueTask from persistent storage by Id.
@@ -162,6 +307,35 @@ type EncodedAtTimeTask struct {
 
 	// The time the hue task is to run in seconds after Jan 1 1970 GMT
 	Time int64
+
+	// How the hue task repeats after it runs. Empty means the hue task
+	// runs once. DecodeRepeat converts this to an ops.Repeat.
+	Recurrence string
+}
+
+// EncodeRepeat returns the Recurrence field value of an
+// EncodedAtTimeTask for r. The value is the seconds between runs and
+// the number of runs left after the next one separated by a colon.
+func EncodeRepeat(r ops.Repeat) string {
+	if r.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", int64(r.Every/time.Second), r.Count)
+}
+
+// DecodeRepeat converts the Recurrence field value of an
+// EncodedAtTimeTask back to an ops.Repeat.
+func DecodeRepeat(spec string) (ops.Repeat, error) {
+	if spec == "" {
+		return ops.Repeat{}, nil
+	}
+	var seconds int64
+	var count int
+	if _, err := fmt.Sscanf(spec, "%d:%d", &seconds, &count); err != nil {
+		return ops.Repeat{}, errors.New(
+			fmt.Sprintf("Bad recurrence %s: %v", spec, err))
+	}
+	return ops.Repeat{Every: time.Duration(seconds) * time.Second, Count: count}, nil
 }
 
 // EncodedAtTimeTaskStore persists EncodedAtTimeTask instances.
@@ -178,6 +352,18 @@ type EncodedAtTimeTaskStore interface {
 	// EncodedAtTimeTasks fetches all tasks in a particular group.
 	EncodedAtTimeTasks(
 		t db.Transaction, groupId string, consumer goconsume.Consumer) error
+
+	// RemoveExpired removes the tasks in all groups that were to run
+	// before the given time.
+	RemoveExpired(t db.Transaction, before time.Time) error
+
+	// UpdateEncodedAtTimeTaskTime changes when a task runs keeping its
+	// database id. Because the schedule id of a task includes its start
+	// time, UpdateEncodedAtTimeTaskTime changes the schedule id too.
+	UpdateEncodedAtTimeTaskTime(
+		t db.Transaction,
+		groupId, scheduleId, newScheduleId string,
+		newTime time.Time) error
 }
 
 // ActionEncoder converts a hue action to a string.
@@ -194,6 +380,19 @@ type ActionDecoder interface {
 	Decode(hueTaskId int, encoded string) (ops.HueAction, error)
 }
 
+// ContextActionDecoder is an ActionDecoder that can give up reading
+// persistent storage once a context is done.
+type ContextActionDecoder interface {
+	ActionDecoder
+
+	// DecodeWithContext works like Decode except that it returns
+	// ctx.Err() once ctx is done.
+	DecodeWithContext(
+		ctx context.Context,
+		hueTaskId int,
+		encoded string) (ops.HueAction, error)
+}
+
 // DynamicHueTaskStore fetches a dynamic.HueTask by Id. If no task can be
 // fetched, returns nil.
 type DynamicHueTaskStore interface {
@@ -213,7 +412,7 @@ func NewActionEncoder(store DynamicHueTaskStore) ActionEncoder {
 	return basicActionEncoder{store}
 }
 
-// NewActionDecoder returns an ActionDecoder.
+// NewActionDecoder returns a ContextActionDecoder.
 // The Decode method of the returned ActionDecoder works the following way.
 // If hueTaskId < ops.PersistentTaskIdOffset, then Decode uses store to
 // look up the HueTask by hueTaskId. Decode delegates to the Factory field
@@ -224,7 +423,7 @@ func NewActionEncoder(store DynamicHueTaskStore) ActionEncoder {
 // to look up the hue action with id: hueTaskId - ops.PersistentTaskIdOffset.
 func NewActionDecoder(
 	store DynamicHueTaskStore,
-	dbStore NamedColorsByIdRunner) ActionDecoder {
+	dbStore NamedColorsByIdRunner) ContextActionDecoder {
 	return &basicActionDecoder{store: store, dbStore: dbStore}
 }
 
@@ -256,10 +455,18 @@ type basicActionDecoder struct {
 
 func (b *basicActionDecoder) Decode(
 	id int, encoded string) (ops.HueAction, error) {
+	return b.DecodeWithContext(context.Background(), id, encoded)
+}
+
+func (b *basicActionDecoder) DecodeWithContext(
+	ctx context.Context, id int, encoded string) (ops.HueAction, error) {
 	if id >= ops.PersistentTaskIdOffset {
 		var namedColors ops.NamedColors
-		if err := b.dbStore.NamedColorsById(
-			nil, int64(id-ops.PersistentTaskIdOffset), &namedColors); err != nil {
+		if err := NamedColorsByIdWithContext(
+			ctx,
+			b.dbStore,
+			int64(id-ops.PersistentTaskIdOffset),
+			&namedColors); err != nil {
 			return nil, err
 		}
 		return ops.StaticHueAction(namedColors.Colors), nil
@@ -278,11 +485,13 @@ func (b *basicActionDecoder) Decode(
 
 // AtTimeTaskStore is a store for ops.AtTimeTask instances.
 type AtTimeTaskStore struct {
-	encoder ActionEncoder
-	decoder ActionDecoder
-	store   EncodedAtTimeTaskStore
-	groupId string
-	logger  *log.Logger
+	encoder      ActionEncoder
+	decoder      ActionDecoder
+	store        EncodedAtTimeTaskStore
+	groupId      string
+	logger       *log.Logger
+	purgeExpired bool
+	archiver     ArchiveEncodedAtTimeTaskRunner
 }
 
 // NewAtTimeTaskStore creates and returns a new AtTimeTaskStore ready for use
@@ -300,8 +509,21 @@ func NewAtTimeTaskStore(
 		logger:  logger}
 }
 
+// SetPurgeExpired controls whether All first deletes from the database
+// the tasks in every group whose time has passed. If purge is true, All
+// never returns those tasks. The default is false which means that All
+// returns expired tasks along with the other tasks of this store's group.
+func (s *AtTimeTaskStore) SetPurgeExpired(purge bool) {
+	s.purgeExpired = purge
+}
+
 // All returns all tasks.
 func (s *AtTimeTaskStore) All() []*ops.AtTimeTask {
+	if s.purgeExpired {
+		if err := s.store.RemoveExpired(nil, time.Now()); err != nil {
+			s.logger.Println(err)
+		}
+	}
 	var allEncoded []*EncodedAtTimeTask
 	consumer := goconsume.AppendPtrsTo(&allEncoded)
 	if err := s.store.EncodedAtTimeTasks(nil, s.groupId, consumer); err != nil {
@@ -340,12 +562,23 @@ func (s *AtTimeTaskStore) Add(task *ops.AtTimeTask) {
 	encoded.LightSet = task.Ls.String()
 	encoded.Time = task.StartTime.Unix()
 	encoded.GroupId = s.groupId
+	encoded.Recurrence = EncodeRepeat(task.Repeat)
 	err = s.store.AddEncodedAtTimeTask(nil, &encoded)
 	if err != nil {
 		s.logger.Println(err)
 	}
 }
 
+// Reschedule changes when a scheduled task runs and its schedule id.
+func (s *AtTimeTaskStore) Reschedule(
+	scheduleId, newScheduleId string, newTime time.Time) {
+	err := s.store.UpdateEncodedAtTimeTaskTime(
+		nil, s.groupId, scheduleId, newScheduleId, newTime)
+	if err != nil {
+		s.logger.Println(err)
+	}
+}
+
 // Remove removes a scheduled task by id
 func (s *AtTimeTaskStore) Remove(scheduleId string) {
 	err := s.store.RemoveEncodedAtTimeTaskByScheduleId(nil, s.groupId, scheduleId)
@@ -371,11 +604,17 @@ func (s *AtTimeTaskStore) asAtTimeTask(encoded *EncodedAtTimeTask) *ops.AtTimeTa
 		s.logger.Printf("Error parsing light set %s", encoded.LightSet)
 		return nil
 	}
+	repeat, err := DecodeRepeat(encoded.Recurrence)
+	if err != nil {
+		s.logger.Printf("While decoding hue task %d: %v", encoded.HueTaskId, err)
+		return nil
+	}
 	return &ops.AtTimeTask{
 		Id:        encoded.ScheduleId,
 		H:         resultH,
 		Ls:        resultLs,
-		StartTime: time.Unix(encoded.Time, 0)}
+		StartTime: time.Unix(encoded.Time, 0),
+		Repeat:    repeat}
 }
 
 type errAction struct {
@@ -392,29 +631,19 @@ func (a errAction) UsedLights(
 	return lightSet
 }
 
-type fixDescriptionRunner struct {
-	delegate NamedColorsRunner
-	filter   descriptionMapFilter
+type orderedNamedColorsRunner struct {
+	store NamedColorsOrderedRunner
+	order NamedColorsOrder
 }
 
-func (r *fixDescriptionRunner) NamedColors(
+func (r *orderedNamedColorsRunner) NamedColors(
 	t db.Transaction, consumer goconsume.Consumer) error {
-	consumer = goconsume.Filter(consumer, r.filter.Filter)
-	return r.delegate.NamedColors(t, consumer)
+	return r.store.NamedColorsOrdered(t, r.order, consumer)
 }
 
-type fixDescriptionByIdRunner struct {
-	delegate NamedColorsByIdRunner
-	filter   descriptionMapFilter
-}
-
-func (r *fixDescriptionByIdRunner) NamedColorsById(
-	t db.Transaction, id int64, namedColors *ops.NamedColors) error {
-	if err := r.delegate.NamedColorsById(t, id, namedColors); err != nil {
-		return err
-	}
-	r.filter.Filter(namedColors)
-	return nil
+type orderedSceneStore struct {
+	orderedNamedColorsRunner
+	NamedColorsByIdRunner
 }
 
 type namedColorsToHueTaskConsumer struct {
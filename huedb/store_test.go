@@ -11,6 +11,7 @@ import (
 	"github.com/keep94/marvin/dynamic"
 	"github.com/keep94/marvin/huedb"
 	"github.com/keep94/marvin/huedb/for_sqlite"
+	"github.com/keep94/marvin/huedb/in_memory"
 	"github.com/keep94/marvin/huedb/sqlite_setup"
 	"github.com/keep94/marvin/lights"
 	"github.com/keep94/marvin/ops"
@@ -24,10 +25,9 @@ import (
 )
 
 var (
-	kNilEncodedAtTimeTask = &huedb.EncodedAtTimeTask{}
-	kEncodeNotSupported   = errors.New("huedb: Encode not supported")
-	kDecodeNotSupported   = errors.New("huedb: Decode not supported")
-	kDbError              = errors.New("huedb: Some database error.")
+	kEncodeNotSupported = errors.New("huedb: Encode not supported")
+	kDecodeNotSupported = errors.New("huedb: Decode not supported")
+	kDbError            = errors.New("huedb: Some database error.")
 )
 
 const (
@@ -37,12 +37,16 @@ const (
 
 var (
 	kColorMap1 = ops.LightColors{
-		2: {gohue.NewMaybeColor(gohue.NewColor(0.35, 0.52)), maybe.NewUint8(99)},
-		7: {gohue.NewMaybeColor(gohue.NewColor(0.51, 0.29)), maybe.NewUint8(113)},
+		2: {Color: gohue.NewMaybeColor(gohue.NewColor(0.35, 0.52)),
+			Brightness: maybe.NewUint8(99)},
+		7: {Color: gohue.NewMaybeColor(gohue.NewColor(0.51, 0.29)),
+			Brightness: maybe.NewUint8(113)},
 	}
 	kColorMap2 = ops.LightColors{
-		3: {gohue.NewMaybeColor(gohue.NewColor(0.41, 0.43)), maybe.NewUint8(20)},
-		5: {gohue.NewMaybeColor(gohue.NewColor(0.62, 0.28)), maybe.NewUint8(222)},
+		3: {Color: gohue.NewMaybeColor(gohue.NewColor(0.41, 0.43)),
+			Brightness: maybe.NewUint8(20)},
+		5: {Color: gohue.NewMaybeColor(gohue.NewColor(0.62, 0.28)),
+			Brightness: maybe.NewUint8(222)},
 	}
 	kFakeStore = fakeNamedColorsRunner{
 		{
@@ -82,6 +86,21 @@ func TestHueTasks(t *testing.T) {
 	}
 }
 
+func TestHueTasksByDescription(t *testing.T) {
+	store := in_memory.New()
+	foo := ops.NamedColors{Colors: kColorMap1, Description: "Foo"}
+	bar := ops.NamedColors{Colors: kColorMap2, Description: "Bar"}
+	addNamedColors(t, store, &foo, &bar)
+	tasks, err := huedb.HueTasksByDescription(store, "ba")
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := ops.HueTaskList{bar.AsHueTask()}
+	if !reflect.DeepEqual(expected, tasks) {
+		t.Errorf("Expected %v, got %v", expected, tasks)
+	}
+}
+
 func TestHueTaskById(t *testing.T) {
 	task := huedb.HueTaskById(huedb.FixDescriptionByIdRunner(
 		fakeNamedColorsByIdRunner{kFakeStore[1]}, kDescriptionMap), 10004)
@@ -129,6 +148,22 @@ func TestActionEncoder(t *testing.T) {
 	}
 }
 
+func TestActionEncoderWithRegistry(t *testing.T) {
+	registry, err := dynamic.NewRegistry(dynamic.HueTaskList{
+		{Id: 35, Factory: fakeSpecificActionEncoder(135)},
+	})
+	if err != nil {
+		t.Fatalf("Got error creating registry: %v", err)
+	}
+	ae := huedb.NewActionEncoder(registry)
+	if actual, err := ae.Encode(35, intAction(52)); actual != "187" || err != nil {
+		t.Errorf("Expected '187' and no error, got %s with %v", actual, err)
+	}
+	if _, err := ae.Encode(37, intAction(52)); err == nil {
+		t.Error("Expected an error, bad id.")
+	}
+}
+
 func TestActionDecoder(t *testing.T) {
 	fakeStore := fakeDynamicHueTaskStore{
 		42: &dynamic.HueTask{Id: 42, Factory: fakeSpecificActionEncoder(142)},
@@ -165,27 +200,53 @@ func TestActionDecoder(t *testing.T) {
 }
 
 func TestAtTimeTaskStore(t *testing.T) {
-	var fakeStore fakeEncodedAtTimeTaskStore
+	memStore := in_memory.New()
 	var fakeEncoder fakeActionEncoder
 	buffer := bytes.NewBuffer(nil)
 	logger := log.New(buffer, "", 0)
 	store := huedb.NewAtTimeTaskStore(
-		fakeEncoder, fakeEncoder, &fakeStore, "default", logger)
+		fakeEncoder, fakeEncoder, memStore, "default", logger)
 	verifyAtTimeTaskStoreNormal(t, store)
 	if len(buffer.Bytes()) > 0 {
 		t.Errorf("No logs expected: %s", string(buffer.Bytes()))
 	}
 	// Just to be sure encoding of action works.
-	if fakeStore[0].Action != "162" {
-		t.Errorf("Expected encoded action 162, got %s", fakeStore[0].Action)
+	if out := encodedTasks(t, memStore, "default")[0].Action; out != "162" {
+		t.Errorf("Expected encoded action 162, got %s", out)
 	}
 	// AtTimeTaskStores with different group Ids should not interfere with
 	// each other
 	store2 := huedb.NewAtTimeTaskStore(
-		fakeEncoder, fakeEncoder, &fakeStore, "second", logger)
+		fakeEncoder, fakeEncoder, memStore, "second", logger)
 	verifyAtTimeTaskStoreNormal(t, store2)
 }
 
+func TestAtTimeTaskStorePurgeExpired(t *testing.T) {
+	memStore := in_memory.New()
+	var fakeEncoder fakeActionEncoder
+	buffer := bytes.NewBuffer(nil)
+	logger := log.New(buffer, "", 0)
+	store := huedb.NewAtTimeTaskStore(
+		fakeEncoder, fakeEncoder, memStore, "default", logger)
+	expired := &ops.AtTimeTask{
+		Id:        "expired",
+		H:         &ops.HueTask{Id: 31, HueAction: intAction(131)},
+		Ls:        lights.All,
+		StartTime: time.Now().Add(-time.Hour),
+	}
+	store.Add(expired)
+	if out := len(store.All()); out != 1 {
+		t.Errorf("Expected 1 task, got %d", out)
+	}
+	store.SetPurgeExpired(true)
+	if out := len(store.All()); out != 0 {
+		t.Errorf("Expected 0 tasks, got %d", out)
+	}
+	if out := len(encodedTasks(t, memStore, "default")); out != 0 {
+		t.Errorf("Expected expired task to be removed, got %d tasks", out)
+	}
+}
+
 func TestAtTimeTaskStoreErrors(t *testing.T) {
 	fakeStore := fakeEncodedAtTimeTaskStoreWithErrors{
 		&huedb.EncodedAtTimeTask{Id: 1, Action: "35"},
@@ -224,12 +285,12 @@ func TestAtTimeTaskStoreErrors(t *testing.T) {
 }
 
 func TestAtTimeTaskStoreEncodeErrors(t *testing.T) {
-	var fakeStore fakeEncodedAtTimeTaskStore
+	memStore := in_memory.New()
 	var fakeEncoder fakeActionEncoder
 	buffer := bytes.NewBuffer(nil)
 	logger := log.New(buffer, "", 0)
 	store := huedb.NewAtTimeTaskStore(
-		fakeEncoder, fakeEncoder, &fakeStore, "default", logger)
+		fakeEncoder, fakeEncoder, memStore, "default", logger)
 	first := &ops.AtTimeTask{
 		Id: "firstId",
 		H: &ops.HueTask{
@@ -277,7 +338,7 @@ func TestAtTimeTaskStoreEncodeErrors(t *testing.T) {
 	}
 
 	// Now there should be 5 entries in the store.
-	if out := fakeStore.Size(); out != 5 {
+	if out := len(encodedTasks(t, memStore, "default")); out != 5 {
 		t.Errorf("Expected 5 entries in store, got %d", out)
 	}
 
@@ -287,7 +348,7 @@ func TestAtTimeTaskStoreEncodeErrors(t *testing.T) {
 	}
 
 	// All should have deleted the two entries that could not be read
-	if out := fakeStore.Size(); out != 3 {
+	if out := len(encodedTasks(t, memStore, "default")); out != 3 {
 		t.Errorf("Expected 3 entries in store, got %d", out)
 	}
 
@@ -309,7 +370,7 @@ func TestAtTimeTaskStoreEncodeErrors(t *testing.T) {
 
 	// If Encoding a task causes an error, it shouldn't be added to the
 	// database. size should still be 3.
-	if out := fakeStore.Size(); out != 3 {
+	if out := len(encodedTasks(t, memStore, "default")); out != 3 {
 		t.Errorf("Expected 3 entries in store, got %d", out)
 	}
 
@@ -382,6 +443,7 @@ func verifyAtTimeTaskStoreNormal(t *testing.T, store *huedb.AtTimeTaskStore) {
 		},
 		Ls:        lights.New(1, 4),
 		StartTime: now.Add(23 * time.Minute),
+		Repeat:    ops.Repeat{Every: 24 * time.Hour, Count: 6},
 	}
 	third := &ops.AtTimeTask{
 		Id: "thirdId",
@@ -467,61 +529,39 @@ func (f fakeEncodedAtTimeTaskStoreWithErrors) RemoveEncodedAtTimeTaskByScheduleI
 	return kDbError
 }
 
-func (f fakeEncodedAtTimeTaskStoreWithErrors) EncodedAtTimeTasks(
-	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
-	for i := range f {
-		if !consumer.CanConsume() {
-			break
-		}
-		encodedAtTimeTask := *f[i]
-		consumer.Consume(&encodedAtTimeTask)
-	}
+func (f fakeEncodedAtTimeTaskStoreWithErrors) UpdateEncodedAtTimeTaskTime(
+	t db.Transaction,
+	groupId, scheduleId, newScheduleId string,
+	newTime time.Time) error {
 	return kDbError
 }
 
-type fakeEncodedAtTimeTaskStore []*huedb.EncodedAtTimeTask
-
-func (f *fakeEncodedAtTimeTaskStore) AddEncodedAtTimeTask(
-	t db.Transaction, task *huedb.EncodedAtTimeTask) error {
-	task.Id = int64(len(*f) + 1)
-	stored := *task
-	*f = append(*f, &stored)
-	return nil
-}
-
-func (f fakeEncodedAtTimeTaskStore) RemoveEncodedAtTimeTaskByScheduleId(
-	t db.Transaction, groupId, scheduleId string) error {
-	for i := range f {
-		if f[i].ScheduleId == scheduleId && f[i].GroupId == groupId {
-			f[i] = kNilEncodedAtTimeTask
-			return nil
-		}
-	}
-	return nil
-}
-
-func (f fakeEncodedAtTimeTaskStore) Size() (result int) {
-	for i := range f {
-		if f[i].Id != 0 {
-			result++
-		}
-	}
-	return result
+func (f fakeEncodedAtTimeTaskStoreWithErrors) RemoveExpired(
+	t db.Transaction, before time.Time) error {
+	return kDbError
 }
 
-func (f fakeEncodedAtTimeTaskStore) EncodedAtTimeTasks(
+func (f fakeEncodedAtTimeTaskStoreWithErrors) EncodedAtTimeTasks(
 	t db.Transaction, groupId string, consumer goconsume.Consumer) error {
 	for i := range f {
 		if !consumer.CanConsume() {
 			break
 		}
-		if f[i].Id == 0 || f[i].GroupId != groupId {
-			continue
-		}
 		encodedAtTimeTask := *f[i]
 		consumer.Consume(&encodedAtTimeTask)
 	}
-	return nil
+	return kDbError
+}
+
+func encodedTasks(
+	t *testing.T,
+	store huedb.EncodedAtTimeTaskStore,
+	groupId string) (result []*huedb.EncodedAtTimeTask) {
+	if err := store.EncodedAtTimeTasks(
+		nil, groupId, goconsume.AppendPtrsTo(&result)); err != nil {
+		t.Fatalf("Error reading tasks: %v", err)
+	}
+	return
 }
 
 type fakeActionEncoder struct {
@@ -615,3 +655,80 @@ func openDb(t *testing.T) *sqlite_db.Db {
 	}
 	return db
 }
+
+func TestHueTasksByIds(t *testing.T) {
+	store := in_memory.New()
+	addNamedColors(
+		t,
+		store,
+		&ops.NamedColors{Description: "Foo", Colors: kColorMap1},
+		&ops.NamedColors{Description: "Bar", Colors: kColorMap2},
+		&ops.NamedColors{Description: "Baz", Colors: kColorMap1})
+	tasks, err := huedb.HueTasksByIds(
+		store,
+		[]int{
+			ops.PersistentTaskIdOffset + 3,
+			5,
+			ops.PersistentTaskIdOffset + 1,
+		})
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", len(tasks))
+	}
+	if tasks[0].Description != "Foo" || tasks[1].Description != "Baz" {
+		t.Errorf(
+			"Expected Foo and Baz, got %s and %s",
+			tasks[0].Description,
+			tasks[1].Description)
+	}
+}
+
+func TestEncodeDecodeRepeat(t *testing.T) {
+	repeat := ops.Repeat{Every: 24 * time.Hour, Count: 6}
+	spec := huedb.EncodeRepeat(repeat)
+	if spec != "86400:6" {
+		t.Errorf("Expected 86400:6, got %s", spec)
+	}
+	decoded, err := huedb.DecodeRepeat(spec)
+	if err != nil {
+		t.Fatalf("Got error decoding: %v", err)
+	}
+	if decoded != repeat {
+		t.Errorf("Expected %v, got %v", repeat, decoded)
+	}
+	if out := huedb.EncodeRepeat(ops.Repeat{}); out != "" {
+		t.Errorf("Expected empty string, got %s", out)
+	}
+	if _, err := huedb.DecodeRepeat("daily"); err == nil {
+		t.Error("Expected error decoding bad recurrence")
+	}
+}
+
+func TestOrderedSceneStore(t *testing.T) {
+	store := in_memory.New()
+	addNamedColors(
+		t,
+		store,
+		&ops.NamedColors{Description: "foo", Colors: kColorMap1},
+		&ops.NamedColors{Description: "Bar", Colors: kColorMap2})
+	factory := dynamic.NewPresortedSceneFactory(huedb.OrderedSceneStore(
+		store,
+		huedb.NamedColorsOrder{By: huedb.OrderById, Descending: true}))
+	expected := []string{"--Pick one--", "Bar", "foo"}
+	if out := factory.Params()[0].Selection(); !reflect.DeepEqual(
+		expected, out) {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+	decoded, err := factory.Decode(`{"Scene":["1"]}`)
+	if err != nil {
+		t.Fatalf("Got error decoding: %v", err)
+	}
+	if out := decoded.(*dynamic.SceneAction).Id; out != 1 {
+		t.Errorf("Expected scene 1, got %d", out)
+	}
+	if _, err := factory.Decode(`{"Scene":["9"]}`); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected ErrNoSuchId, got %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+// Package storetest checks that an implementation of the huedb interfaces
+// behaves the same way the sqlite store does. A new backend proves
+// conformance by calling Run from one of its tests.
+package storetest
+
+import (
+	"fmt"
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/fixture"
+	"github.com/keep94/marvin/ops"
+	"sync"
+	"testing"
+)
+
+const (
+	kWriters         = 8
+	kWritesPerWriter = 5
+)
+
+// Opener returns a new, empty store along with a function that releases
+// it. The release function may be nil.
+type Opener func(t *testing.T) (store interface{}, release func())
+
+type suite struct {
+	name string
+
+	// run runs the suite and returns true, or returns false without
+	// running if store lacks the needed interfaces.
+	run func(t *testing.T, store interface{}) bool
+}
+
+var kSuites = []suite{
+	{"NamedColorsById", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.MinimalStore)
+		if ok {
+			fixture.NamedColorsById(t, store)
+		}
+		return ok
+	}},
+	{"NamedColorsByIdNoSuchId", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.NamedColorsByIdRunner)
+		if ok {
+			namedColorsByIdNoSuchId(t, store)
+		}
+		return ok
+	}},
+	{"NamedColors", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.NamedColorsStore)
+		if ok {
+			fixture.NamedColors(t, store)
+		}
+		return ok
+	}},
+	{"NamedColorsEarlyStop", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.NamedColorsStore)
+		if ok {
+			namedColorsEarlyStop(t, store)
+		}
+		return ok
+	}},
+	{"ConcurrentAddNamedColors", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.NamedColorsStore)
+		if ok {
+			concurrentAddNamedColors(t, store)
+		}
+		return ok
+	}},
+	{"AddNamedColorsBatch", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.NamedColorsBatchStore)
+		if ok {
+			fixture.AddNamedColorsBatch(t, store)
+		}
+		return ok
+	}},
+	{"NamedColorsByIds", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.NamedColorsByIdsStore)
+		if ok {
+			fixture.NamedColorsByIds(t, store)
+		}
+		return ok
+	}},
+	{"UpdateNamedColors", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.UpdateNamedColorsStore)
+		if ok {
+			fixture.UpdateNamedColors(t, store)
+		}
+		return ok
+	}},
+	{"RemoveNamedColors", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.RemoveNamedColorsStore)
+		if ok {
+			fixture.RemoveNamedColors(t, store)
+		}
+		return ok
+	}},
+	{"NamedColorsPage", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.NamedColorsPageStore)
+		if ok {
+			fixture.NamedColorsPage(t, store)
+		}
+		return ok
+	}},
+	{"NamedColorsOrdered", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.NamedColorsOrderedStore)
+		if ok {
+			fixture.NamedColorsOrdered(t, store)
+		}
+		return ok
+	}},
+	{"NamedColorsByDescription", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.NamedColorsByDescriptionStore)
+		if ok {
+			fixture.NamedColorsByDescription(t, store)
+		}
+		return ok
+	}},
+	{"NamedColorsHistory", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.NamedColorsHistoryStore)
+		if ok {
+			fixture.NamedColorsHistory(t, store)
+		}
+		return ok
+	}},
+	{"ScheduledTasks", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.ScheduledTaskStore)
+		if ok {
+			fixture.ScheduledTasks(t, store)
+		}
+		return ok
+	}},
+	{"EncodedAtTimeTasks", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.EncodedAtTimeTaskStore)
+		if ok {
+			fixture.EncodedAtTimeTasks(t, store)
+		}
+		return ok
+	}},
+	{"ClearEncodedAtTimeTasks", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.ClearAtTimeTaskStore)
+		if ok {
+			fixture.ClearEncodedAtTimeTasks(t, store)
+		}
+		return ok
+	}},
+	{"RemoveExpired", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.EncodedAtTimeTaskStore)
+		if ok {
+			fixture.RemoveExpired(t, store)
+		}
+		return ok
+	}},
+	{"UpdateEncodedAtTimeTaskTime", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.EncodedAtTimeTaskStore)
+		if ok {
+			fixture.UpdateEncodedAtTimeTaskTime(t, store)
+		}
+		return ok
+	}},
+	{"ArchiveEncodedAtTimeTask", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.ArchiveAtTimeTaskStore)
+		if ok {
+			fixture.ArchiveEncodedAtTimeTask(t, store)
+		}
+		return ok
+	}},
+	{"Users", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.UserStore)
+		if ok {
+			fixture.Users(t, store)
+		}
+		return ok
+	}},
+	{"LightAliases", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.LightAliasStore)
+		if ok {
+			fixture.LightAliases(t, store)
+		}
+		return ok
+	}},
+	{"LastLightColors", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.LastLightColorsStore)
+		if ok {
+			fixture.LastLightColors(t, store)
+		}
+		return ok
+	}},
+	{"Search", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.SearchStore)
+		if ok {
+			fixture.Search(t, store)
+		}
+		return ok
+	}},
+	{"ScheduleProfiles", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.ScheduleProfileStore)
+		if ok {
+			fixture.ScheduleProfiles(t, store)
+		}
+		return ok
+	}},
+	{"SensorEvents", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.SensorEventStore)
+		if ok {
+			fixture.SensorEvents(t, store)
+		}
+		return ok
+	}},
+	{"WeatherObservations", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.WeatherObservationStore)
+		if ok {
+			fixture.WeatherObservations(t, store)
+		}
+		return ok
+	}},
+	{"BackupRestore", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.BackupStore)
+		if ok {
+			fixture.BackupRestore(t, store)
+		}
+		return ok
+	}},
+	{"WithContext", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.ContextStore)
+		if ok {
+			fixture.WithContext(t, store)
+		}
+		return ok
+	}},
+	{"Preferences", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.PreferencesStore)
+		if ok {
+			fixture.Preferences(t, store)
+		}
+		return ok
+	}},
+	{"SceneComponents", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.SceneComponentStore)
+		if ok {
+			fixture.SceneComponents(t, store)
+		}
+		return ok
+	}},
+	{"WeatherSettings", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(fixture.WeatherSettingsStore)
+		if ok {
+			fixture.WeatherSettings(t, store)
+		}
+		return ok
+	}},
+	{"Bridges", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.BridgeStore)
+		if ok {
+			fixture.Bridges(t, store)
+		}
+		return ok
+	}},
+	{"DescriptionOverrides", func(t *testing.T, s interface{}) bool {
+		store, ok := s.(huedb.DescriptionOverrideStore)
+		if ok {
+			fixture.DescriptionOverrides(t, store)
+		}
+		return ok
+	}},
+}
+
+// Run runs each conformance suite as a subtest of t against a new store
+// from open. A suite fails if the store does not implement the
+// interfaces it needs.
+func Run(t *testing.T, open Opener) {
+	for _, s := range kSuites {
+		s := s
+		t.Run(s.name, func(t *testing.T) {
+			store, release := open(t)
+			if release != nil {
+				defer release()
+			}
+			if !s.run(t, store) {
+				t.Errorf("Store does not support %s", s.name)
+			}
+		})
+	}
+}
+
+func namedColorsByIdNoSuchId(
+	t *testing.T, store huedb.NamedColorsByIdRunner) {
+	var namedColors ops.NamedColors
+	if err := store.NamedColorsById(
+		nil, 9999, &namedColors); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+}
+
+func namedColorsEarlyStop(t *testing.T, store fixture.NamedColorsStore) {
+	for i := 0; i < 3; i++ {
+		namedColors := ops.NamedColors{Description: fmt.Sprintf("%d", i)}
+		if err := store.AddNamedColors(nil, &namedColors); err != nil {
+			t.Fatalf("Got %v adding to store", err)
+		}
+	}
+	var results []ops.NamedColors
+	consumer := goconsume.Slice(goconsume.AppendTo(&results), 0, 2)
+	if err := store.NamedColors(nil, consumer); err != nil {
+		t.Errorf("Got error reading database: %v", err)
+	}
+	if out := len(results); out != 2 {
+		t.Errorf("Expected 2 results, got %d", out)
+	}
+}
+
+func concurrentAddNamedColors(
+	t *testing.T, store fixture.NamedColorsStore) {
+	var wg sync.WaitGroup
+	errs := make(chan error, kWriters*kWritesPerWriter)
+	for i := 0; i < kWriters; i++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for j := 0; j < kWritesPerWriter; j++ {
+				namedColors := ops.NamedColors{
+					Description: fmt.Sprintf("%d-%d", writer, j)}
+				if err := store.AddNamedColors(nil, &namedColors); err != nil {
+					errs <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Got %v adding to store", err)
+	}
+	var results []ops.NamedColors
+	if err := store.NamedColors(nil, goconsume.AppendTo(&results)); err != nil {
+		t.Fatalf("Got error reading database: %v", err)
+	}
+	ids := make(map[int64]bool)
+	for _, namedColors := range results {
+		ids[namedColors.Id] = true
+	}
+	if out := len(ids); out != kWriters*kWritesPerWriter {
+		t.Errorf(
+			"Expected %d distinct ids, got %d",
+			kWriters*kWritesPerWriter,
+			out)
+	}
+}
@@ -0,0 +1,130 @@
+package huedb
+
+import (
+	"errors"
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/appcommon/passwords"
+	"github.com/keep94/goconsume"
+)
+
+var (
+	// Indicates that a user name and password do not match.
+	ErrBadCredentials = errors.New("huedb: Bad user name or password.")
+)
+
+// Role is what a user of the hue web app may do.
+type Role int
+
+const (
+	// Guests may run tasks only.
+	Guest Role = iota
+
+	// Admins may also edit schedules and stored scenes.
+	Admin
+)
+
+func (r Role) String() string {
+	switch r {
+	case Guest:
+		return "Guest"
+	case Admin:
+		return "Admin"
+	default:
+		return "Unknown"
+	}
+}
+
+// User represents a user of the hue web app.
+type User struct {
+	// The unique database dependent numeric ID of this user.
+	Id int64
+
+	// The name used to log in. Unique among users.
+	Name string
+
+	// The one way encrypted password.
+	Password passwords.Password
+
+	Role Role
+}
+
+// SetPassword sets the password of this user to password.
+func (u *User) SetPassword(password string) {
+	u.Password = passwords.New(password)
+}
+
+// VerifyPassword returns true if password is the password of this user.
+func (u *User) VerifyPassword(password string) bool {
+	return u.Password.Verify(password)
+}
+
+// IsAdmin returns true if this user may edit schedules and stored scenes.
+func (u *User) IsAdmin() bool {
+	return u.Role == Admin
+}
+
+type UserByIdRunner interface {
+	// UserById gets a user by id.
+	UserById(t db.Transaction, id int64, user *User) error
+}
+
+type UserByNameRunner interface {
+	// UserByName gets a user by name. UserByName returns ErrNoSuchId if
+	// there is no such user.
+	UserByName(t db.Transaction, name string, user *User) error
+}
+
+type UsersRunner interface {
+	// Users gets all users.
+	Users(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+type AddUserRunner interface {
+	// AddUser adds a user.
+	AddUser(t db.Transaction, user *User) error
+}
+
+type UpdateUserRunner interface {
+	// UpdateUser updates a user by id.
+	UpdateUser(t db.Transaction, user *User) error
+}
+
+type RemoveUserRunner interface {
+	// RemoveUser removes a user by id.
+	RemoveUser(t db.Transaction, id int64) error
+}
+
+// VerifyCredentials returns the user with given name if password is
+// correct. If there is no such user or if password is wrong,
+// VerifyCredentials returns ErrBadCredentials.
+func VerifyCredentials(
+	store UserByNameRunner, name, password string) (*User, error) {
+	var user User
+	err := store.UserByName(nil, name, &user)
+	if err == ErrNoSuchId {
+		return nil, ErrBadCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.VerifyPassword(password) {
+		return nil, ErrBadCredentials
+	}
+	return &user, nil
+}
+
+// UserGetter retrieves users by id for web sessions. UserGetter
+// implements the UserGetter interface in
+// github.com/keep94/appcommon/session_util.
+type UserGetter struct {
+	Store UserByIdRunner
+}
+
+// GetUser returns the user with given id as a *User.
+func (g UserGetter) GetUser(id int64) (interface{}, error) {
+	var user User
+	if err := g.Store.UserById(nil, id, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,39 @@
+package huedb_test
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"testing"
+)
+
+func TestVerifyCredentials(t *testing.T) {
+	store := in_memory.New()
+	admin := huedb.User{Name: "jill", Role: huedb.Admin}
+	admin.SetPassword("secret")
+	if err := store.AddUser(nil, &admin); err != nil {
+		t.Fatalf("Got error adding: %v", err)
+	}
+	user, err := huedb.VerifyCredentials(store, "jill", "secret")
+	if err != nil {
+		t.Fatalf("Got error verifying: %v", err)
+	}
+	if user.Id != admin.Id || !user.IsAdmin() {
+		t.Errorf("Expected %v, got %v", &admin, user)
+	}
+	if _, err := huedb.VerifyCredentials(
+		store, "jill", "wrong"); err != huedb.ErrBadCredentials {
+		t.Errorf("Expected ErrBadCredentials, got %v", err)
+	}
+	if _, err := huedb.VerifyCredentials(
+		store, "bob", "secret"); err != huedb.ErrBadCredentials {
+		t.Errorf("Expected ErrBadCredentials, got %v", err)
+	}
+	getter := huedb.UserGetter{Store: store}
+	fetched, err := getter.GetUser(admin.Id)
+	if err != nil {
+		t.Fatalf("Got error getting user: %v", err)
+	}
+	if out := fetched.(*huedb.User).Name; out != "jill" {
+		t.Errorf("Expected jill, got %s", out)
+	}
+}
@@ -0,0 +1,85 @@
+package huedb
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/goconsume"
+	"time"
+)
+
+const (
+	// NOAA weather stations. StationId is a station such as "KNUQ".
+	NOAAProvider = "noaa"
+
+	// Open weather. StationId is a city ID such as "5375480". Requires
+	// APIKey.
+	OpenWeatherProvider = "openweather"
+
+	// Purple air. StationId is a numeric purple air station ID. Purple air
+	// reports air quality only.
+	PurpleAirProvider = "purpleair"
+)
+
+const (
+	Celsius    = "C"
+	Fahrenheit = "F"
+)
+
+// WeatherSettings configures one weather provider for the weather
+// subsystem.
+type WeatherSettings struct {
+	// The unique database dependent numeric ID of these settings.
+	Id int64
+
+	// The weather provider such as NOAAProvider.
+	Provider string
+
+	// The provider specific station or city to poll.
+	StationId string
+
+	// The API key for providers that require one.
+	APIKey string
+
+	// How often to poll the provider.
+	PollInterval time.Duration
+
+	// The units for displaying temperatures, Celsius or Fahrenheit.
+	Units string
+}
+
+type WeatherSettingsRunner interface {
+	// WeatherSettings gets all weather settings in ascending order by id.
+	WeatherSettings(t db.Transaction, consumer goconsume.Consumer) error
+}
+
+type AddWeatherSettingsRunner interface {
+	// AddWeatherSettings adds weather settings.
+	AddWeatherSettings(t db.Transaction, settings *WeatherSettings) error
+}
+
+type UpdateWeatherSettingsRunner interface {
+	// UpdateWeatherSettings updates weather settings by id.
+	UpdateWeatherSettings(t db.Transaction, settings *WeatherSettings) error
+}
+
+type RemoveWeatherSettingsRunner interface {
+	// RemoveWeatherSettings removes weather settings by id.
+	RemoveWeatherSettings(t db.Transaction, id int64) error
+}
+
+// WeatherSettingsByProvider returns the first weather settings in store
+// for provider or ErrNoSuchId if there are none.
+func WeatherSettingsByProvider(
+	t db.Transaction,
+	store WeatherSettingsRunner,
+	provider string) (*WeatherSettings, error) {
+	var all []WeatherSettings
+	if err := store.WeatherSettings(t, goconsume.AppendTo(&all)); err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if all[i].Provider == provider {
+			return &all[i], nil
+		}
+	}
+	return nil, ErrNoSuchId
+}
@@ -0,0 +1,27 @@
+package huedb_test
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"testing"
+)
+
+func TestWeatherSettingsByProvider(t *testing.T) {
+	store := in_memory.New()
+	store.AddWeatherSettings(
+		nil,
+		&huedb.WeatherSettings{
+			Provider: huedb.NOAAProvider, StationId: "KNUQ"})
+	settings, err := huedb.WeatherSettingsByProvider(
+		nil, store, huedb.NOAAProvider)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if settings.StationId != "KNUQ" {
+		t.Errorf("Expected KNUQ, got %s", settings.StationId)
+	}
+	if _, err := huedb.WeatherSettingsByProvider(
+		nil, store, huedb.PurpleAirProvider); err != huedb.ErrNoSuchId {
+		t.Errorf("Expected huedb.ErrNoSuchId, got %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Where DiscoverBridges asks Philips for the bridges on the local network.
+const kMeethueDiscoveryUrl = "https://discovery.meethue.com/"
+
+// Where DiscoverBridges sends its mDNS query.
+const kMDNSAddr = "224.0.0.251:5353"
+
+// The mDNS service that hue bridges advertise.
+const kHueService = "_hue._tcp.local."
+
+// How long DiscoverBridges waits for mDNS responses and for the meethue
+// discovery endpoint.
+const kDiscoveryTimeout = 3 * time.Second
+
+// Bridge represents a hue bridge found on the local network.
+type Bridge struct {
+	// The bridge id such as "001788fffe6a2b3c". Empty if unknown.
+	Id string
+
+	// The IP address of the bridge on the local network such as
+	// "192.168.1.2"
+	IpAddress string
+}
+
+// DiscoverBridges finds the hue bridges on the local network using both
+// mDNS and the meethue discovery endpoint. DiscoverBridges returns the
+// candidate bridges in ascending order by id. It gives up as soon as ctx
+// is done or after 3 seconds whichever comes first. DiscoverBridges
+// returns an error only if both mDNS and the meethue discovery endpoint
+// fail.
+func DiscoverBridges(ctx context.Context) ([]Bridge, error) {
+	var d BridgeDiscoverer
+	return d.Discover(ctx)
+}
+
+// BridgeDiscoverer finds hue bridges on the local network. The zero value
+// works like DiscoverBridges.
+type BridgeDiscoverer struct {
+	// The client for the meethue discovery endpoint. nil means a default
+	// client.
+	Client *http.Client
+
+	// The URL of the meethue discovery endpoint. Empty means the real one.
+	DiscoveryUrl string
+
+	// The address that receives the mDNS query. Empty means the mDNS
+	// multicast address.
+	MDNSAddr string
+}
+
+// Discover works like DiscoverBridges.
+func (d *BridgeDiscoverer) Discover(ctx context.Context) ([]Bridge, error) {
+	ctx, cancel := context.WithTimeout(ctx, kDiscoveryTimeout)
+	defer cancel()
+	type result struct {
+		bridges []Bridge
+		err     error
+	}
+	mdnsResult := make(chan result, 1)
+	go func() {
+		bridges, err := d.discoverMDNS(ctx)
+		mdnsResult <- result{bridges: bridges, err: err}
+	}()
+	meethueBridges, meethueErr := d.discoverMeethue(ctx)
+	mdns := <-mdnsResult
+	if mdns.err != nil && meethueErr != nil {
+		return nil, errors.New(fmt.Sprintf(
+			"ops:Bridge discovery failed: %v; %v", mdns.err, meethueErr))
+	}
+	return mergeBridges(mdns.bridges, meethueBridges), nil
+}
+
+func (d *BridgeDiscoverer) discoverMeethue(ctx context.Context) (
+	[]Bridge, error) {
+	discoveryUrl := d.DiscoveryUrl
+	if discoveryUrl == "" {
+		discoveryUrl = kMeethueDiscoveryUrl
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	request, err := http.NewRequest("GET", discoveryUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf(
+			"ops:Got status %d fetching %s", resp.StatusCode, discoveryUrl))
+	}
+	var entries []struct {
+		Id                string `json:"id"`
+		InternalIpAddress string `json:"internalipaddress"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	result := make([]Bridge, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, Bridge{
+			Id: entry.Id, IpAddress: entry.InternalIpAddress})
+	}
+	return result, nil
+}
+
+// discoverMDNS sends one mDNS query for hue bridges from an ephemeral
+// port and collects the responses until ctx is done. Responders answer
+// such queries directly to the sending port.
+func (d *BridgeDiscoverer) discoverMDNS(ctx context.Context) (
+	[]Bridge, error) {
+	mdnsAddr := d.MDNSAddr
+	if mdnsAddr == "" {
+		mdnsAddr = kMDNSAddr
+	}
+	addr, err := net.ResolveUDPAddr("udp4", mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query, err := mdnsQuery()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(query, addr); err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	var result []Bridge
+	buffer := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return result, nil
+			}
+			return result, err
+		}
+		if bridge, ok := parseMDNSResponse(buffer[:n], from.IP); ok {
+			result = append(result, bridge)
+		}
+	}
+}
+
+func mdnsQuery() ([]byte, error) {
+	name, err := dnsmessage.NewName(kHueService)
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET},
+		},
+	}
+	return msg.Pack()
+}
+
+// parseMDNSResponse returns the bridge in an mDNS response. from is
+// where the response came from. parseMDNSResponse returns false if the
+// response is not from a hue bridge.
+func parseMDNSResponse(response []byte, from net.IP) (Bridge, bool) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(response); err != nil {
+		return Bridge{}, false
+	}
+	isHue := false
+	var result Bridge
+	for _, resource := range append(msg.Answers, msg.Additionals...) {
+		switch body := resource.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if strings.EqualFold(resource.Header.Name.String(), kHueService) {
+				isHue = true
+			}
+		case *dnsmessage.TXTResource:
+			for _, txt := range body.TXT {
+				if strings.HasPrefix(txt, "bridgeid=") {
+					result.Id = strings.TrimPrefix(txt, "bridgeid=")
+				}
+			}
+		case *dnsmessage.AResource:
+			result.IpAddress = net.IP(body.A[:]).String()
+		}
+	}
+	if !isHue {
+		return Bridge{}, false
+	}
+	if result.IpAddress == "" {
+		result.IpAddress = from.String()
+	}
+	return result, true
+}
+
+// mergeBridges combines the bridges from each discovery method removing
+// duplicates. Bridges are the same if they have the same id ignoring
+// case. A bridge with no id is the same as any other bridge with its IP
+// address.
+func mergeBridges(bridgeLists ...[]Bridge) []Bridge {
+	byKey := make(map[string]Bridge)
+	ipAddresses := make(map[string]bool)
+	for _, bridges := range bridgeLists {
+		for _, bridge := range bridges {
+			if bridge.Id != "" {
+				bridge.Id = strings.ToLower(bridge.Id)
+				byKey[bridge.Id] = bridge
+				ipAddresses[bridge.IpAddress] = true
+			}
+		}
+	}
+	for _, bridges := range bridgeLists {
+		for _, bridge := range bridges {
+			if bridge.Id == "" && !ipAddresses[bridge.IpAddress] {
+				byKey["ip:"+bridge.IpAddress] = bridge
+			}
+		}
+	}
+	result := make([]Bridge, 0, len(byKey))
+	for _, bridge := range byKey {
+		result = append(result, bridge)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Id != result[j].Id {
+			return result[i].Id < result[j].Id
+		}
+		return result[i].IpAddress < result[j].IpAddress
+	})
+	return result
+}
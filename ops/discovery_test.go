@@ -0,0 +1,139 @@
+package ops_test
+
+import (
+	"context"
+	"github.com/keep94/marvin/ops"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiscoverBridges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[
+{"id":"001788fffe6a2b3c","internalipaddress":"192.168.1.2","port":443},
+{"id":"001788fffe000001","internalipaddress":"192.168.1.9","port":443}]`))
+		}))
+	defer server.Close()
+	responder := startMDNSResponder(t, "001788FFFE6A2B3C", "192.168.1.3")
+	defer responder.Close()
+	discoverer := ops.BridgeDiscoverer{
+		DiscoveryUrl: server.URL,
+		MDNSAddr:     responder.LocalAddr().String(),
+	}
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 200*time.Millisecond)
+	defer cancel()
+	bridges, err := discoverer.Discover(ctx)
+	if err != nil {
+		t.Fatalf("Got error discovering: %v", err)
+	}
+	expected := []ops.Bridge{
+		{Id: "001788fffe000001", IpAddress: "192.168.1.9"},
+		{Id: "001788fffe6a2b3c", IpAddress: "192.168.1.2"},
+	}
+	if !reflect.DeepEqual(expected, bridges) {
+		t.Errorf("Expected %v, got %v", expected, bridges)
+	}
+}
+
+func TestDiscoverBridgesMeethueDown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+	defer server.Close()
+	responder := startMDNSResponder(t, "001788FFFE6A2B3C", "192.168.1.3")
+	defer responder.Close()
+	discoverer := ops.BridgeDiscoverer{
+		DiscoveryUrl: server.URL,
+		MDNSAddr:     responder.LocalAddr().String(),
+	}
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 200*time.Millisecond)
+	defer cancel()
+	bridges, err := discoverer.Discover(ctx)
+	if err != nil {
+		t.Fatalf("Got error discovering: %v", err)
+	}
+	expected := []ops.Bridge{
+		{Id: "001788fffe6a2b3c", IpAddress: "192.168.1.3"},
+	}
+	if !reflect.DeepEqual(expected, bridges) {
+		t.Errorf("Expected %v, got %v", expected, bridges)
+	}
+}
+
+func TestDiscoverBridgesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer server.Close()
+	discoverer := ops.BridgeDiscoverer{
+		DiscoveryUrl: server.URL,
+		MDNSAddr:     "not an address",
+	}
+	if _, err := discoverer.Discover(context.Background()); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+// startMDNSResponder starts a fake hue bridge that answers mDNS queries
+// on a local port.
+func startMDNSResponder(
+	t *testing.T, bridgeId, ipAddress string) *net.UDPConn {
+	conn, err := net.ListenUDP(
+		"udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Got error listening: %v", err)
+	}
+	service := dnsmessage.MustNewName("_hue._tcp.local.")
+	instance := dnsmessage.MustNewName("Philips Hue - 6A2B3C._hue._tcp.local.")
+	host := dnsmessage.MustNewName("001788fffe6a2b3c.local.")
+	var a [4]byte
+	copy(a[:], net.ParseIP(ipAddress).To4())
+	response := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{
+					Name: service, Class: dnsmessage.ClassINET},
+				Body: &dnsmessage.PTRResource{PTR: instance},
+			},
+		},
+		Additionals: []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{
+					Name: instance, Class: dnsmessage.ClassINET},
+				Body: &dnsmessage.TXTResource{
+					TXT: []string{"bridgeid=" + bridgeId, "modelid=BSB002"}},
+			},
+			{
+				Header: dnsmessage.ResourceHeader{
+					Name: host, Class: dnsmessage.ClassINET},
+				Body: &dnsmessage.AResource{A: a},
+			},
+		},
+	}
+	packed, err := response.Pack()
+	if err != nil {
+		t.Fatalf("Got error packing: %v", err)
+	}
+	go func() {
+		buffer := make([]byte, 9000)
+		for {
+			_, from, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(packed, from)
+		}
+	}()
+	return conn
+}
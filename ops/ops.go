@@ -3,11 +3,17 @@ package ops
 
 import (
 	"errors"
+	"fmt"
 	"github.com/keep94/gohue"
 	"github.com/keep94/gohue/actions"
 	"github.com/keep94/marvin/lights"
 	"github.com/keep94/maybe"
 	"github.com/keep94/tasks"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -17,174 +23,1775 @@ const (
 	PersistentTaskIdOffset = 10000
 )
 
+const (
+	// The bridge's built-in effect that cycles through all colors.
+	ColorLoopEffect = "colorloop"
+
+	// No effect. Stops a built-in effect.
+	NoEffect = "none"
+)
+
+const (
+	// The bridge's alert that blinks the lights once.
+	SelectAlert = "select"
+
+	// The bridge's alert that blinks the lights for 15 seconds.
+	LongSelectAlert = "lselect"
+)
+
+const (
+	// The most commands per second TransitionHueAction sends to the bridge.
+	kMaxCommandsPerSecond = 10
+
+	// The shortest time between steps of TransitionHueAction.
+	kMinTransitionStep = 500 * time.Millisecond
+
+	// The dimmest brightness PartyAction uses.
+	kPartyMinBrightness = 64
+)
+
+const (
+	// The gamma PerceptualCurve uses to convert brightness to perceived
+	// brightness.
+	kGamma = 2.2
+)
+
+const (
+	// The range of color temperatures in kelvin that KelvinToColor and
+	// ColorTemperatureToColor support.
+	MinKelvin = 1667
+	MaxKelvin = 25000
+)
+
 // Interface Context represents a connection to the hue bridge.
 type Context interface {
 
-	// Sets the properties for a particular light
-	Set(lightId int, properties *gohue.LightProperties) (
-		response []byte, err error)
+	// Sets the properties for a particular light
+	Set(lightId int, properties *gohue.LightProperties) (
+		response []byte, err error)
+}
+
+// HueAction represents an action to be done with hue lights.
+type HueAction interface {
+	// Do does the action.
+	// ctxt is the connection to the hue bridge; lightSet is the exact set of
+	// lights. The tasks package provides e.
+	// If a Do implementation needs more than the Context interface and
+	// ctxt does not implement it then Do does nothing.
+	Do(ctxt Context, lightSet lights.Set, e *tasks.Execution)
+
+	// UsedLights returns the lights this instance will use given an initial
+	// set of lights.
+	// Implementations of UsedLights must obey these axioms:
+	// 1. UsedLights(UsedLights(A)) == UsedLights(A)
+	// 2. If A subset of B then UsedLights(A) subset of UsedLights(B)
+	UsedLights(lightSet lights.Set) lights.Set
+}
+
+// Finalizer is implemented by HueActions that need to clean up after
+// themselves such as by turning off an effect that would otherwise stay on
+// after the action ends.
+type Finalizer interface {
+	// Finalize cleans up after Do returns whether it finished or was
+	// interrupted. ctxt and lightSet are the same as for Do.
+	Finalize(ctxt Context, lightSet lights.Set)
+}
+
+// Finalize calls the Finalize method of action if action is a Finalizer.
+// Otherwise Finalize does nothing. Whatever runs a HueAction should call
+// Finalize after the Do method returns.
+func Finalize(action HueAction, ctxt Context, lightSet lights.Set) {
+	if finalizer, ok := action.(Finalizer); ok {
+		finalizer.Finalize(ctxt, lightSet)
+	}
+}
+
+// HueTask represents a HueAction with an ID and description.
+// These instances must be treated as immutable.
+type HueTask struct {
+	Id int
+	HueAction
+	Description string
+}
+
+// Refresh returns this instance.
+func (h *HueTask) Refresh() *HueTask {
+	return h
+}
+
+// GetDescription returns the description of this instance.
+func (h *HueTask) GetDescription() string {
+	return h.Description
+}
+
+// AtTimeTask represents a hue task scheduled to run at a particular time
+// on a particular set of lights.
+// These instances must be treated as immutable.
+type AtTimeTask struct {
+	// The schedule Id
+	Id string
+
+	// The Hue Task
+	H *HueTask
+
+	// The lights to run on
+	Ls lights.Set
+
+	// The time to start
+	StartTime time.Time
+
+	// How the task repeats after it runs. The zero value means the task
+	// runs once.
+	Repeat Repeat
+}
+
+// Repeat tells how an AtTimeTask repeats after it runs.
+type Repeat struct {
+	// The time between runs. A whole number of days advances by calendar
+	// days so that the time of day stays the same across daylight saving
+	// time changes.
+	Every time.Duration
+
+	// The number of runs left after the next one.
+	Count int
+}
+
+// IsZero returns true if r means run once.
+func (r Repeat) IsZero() bool {
+	return r.Every <= 0 || r.Count <= 0
+}
+
+// Next returns the time of the run that follows a run at t along with
+// the Repeat for that run. Next returns the zero Repeat once no runs are
+// left. Caller must check IsZero before calling Next.
+func (r Repeat) Next(t time.Time) (time.Time, Repeat) {
+	var next time.Time
+	if r.Every%(24*time.Hour) == 0 {
+		next = t.AddDate(0, 0, int(r.Every/(24*time.Hour)))
+	} else {
+		next = t.Add(r.Every)
+	}
+	r.Count--
+	if r.Count == 0 {
+		return next, Repeat{}
+	}
+	return next, r
+}
+
+// HueTaskList represents an immutable list of hue tasks.
+type HueTaskList []*HueTask
+
+// ColorBrightness represents a color and brightness.
+type ColorBrightness struct {
+	Color      gohue.MaybeColor
+	Brightness maybe.Uint8
+
+	// On is false to turn the light off or true to turn it on. If On has
+	// no value, the light is off when Color, Brightness, and
+	// ColorTemperature all have no value and on otherwise.
+	On maybe.Bool
+
+	// ColorTemperature is the color temperature in mireds. When the Context
+	// is a ColorTemperatureContext, ColorTemperature takes precedence over
+	// Color. Otherwise, Color takes precedence, and the color temperature
+	// is sent as the equivalent xy color only when Color has no value.
+	ColorTemperature maybe.Uint16
+
+	// Reachable is false if the bridge could not reach the light when
+	// Snapshot read it. Setting a light that is not reachable does
+	// nothing. Stores do not persist Reachable.
+	Reachable maybe.Bool
+
+	// TransitionTime is how long the light takes to change in multiples
+	// of 100ms. 0 means change instantly. When TransitionTime has no
+	// value, the action decides, usually leaving it to the bridge's
+	// default of 400ms.
+	TransitionTime maybe.Uint16
+}
+
+// IsOff returns true if this instance turns the light off.
+func (c ColorBrightness) IsOff() bool {
+	if c.On.Valid {
+		return !c.On.Value
+	}
+	return !c.Color.Valid && !c.Brightness.Valid && !c.ColorTemperature.Valid
+}
+
+// xyColor returns Color falling back to the xy color equivalent to
+// ColorTemperature.
+func (c ColorBrightness) xyColor() gohue.MaybeColor {
+	if c.Color.Valid || !c.ColorTemperature.Valid {
+		return c.Color
+	}
+	return gohue.NewMaybeColor(ColorTemperatureToColor(c.ColorTemperature.Value))
+}
+
+// LightColors represents both color and brightness for each light. The key
+// of the map is the light id; the value is the color and brightness for that
+// light. A color and brightness for light id 0 means all lights are to have
+// that color and brightness.
+// These instances must be treated as immutable.
+type LightColors map[int]ColorBrightness
+
+// Interface LightReader reads the state of a light
+type LightReader interface {
+	Get(lightId int) (*gohue.LightProperties, []byte, error)
+}
+
+// ColorTemperatureReader is a LightReader that can also read the color
+// temperature of a light.
+type ColorTemperatureReader interface {
+	LightReader
+
+	// GetColorTemperature returns the color temperature of a light in
+	// mireds. If the light is not in color temperature mode, the returned
+	// color temperature has no value.
+	GetColorTemperature(lightId int) (
+		mireds maybe.Uint16, response []byte, err error)
+}
+
+// ReachabilityReader is a LightReader that can also tell whether the bridge
+// can reach a light.
+type ReachabilityReader interface {
+	LightReader
+
+	// IsReachable returns true if the bridge can reach a light.
+	IsReachable(lightId int) (reachable bool, response []byte, err error)
+}
+
+// LightLister is a Context that can also list the lights on the bridge.
+type LightLister interface {
+	Context
+
+	// ListLights returns the ids of all the lights on the bridge in
+	// ascending order.
+	ListLights() (ids []int, response []byte, err error)
+}
+
+// ColorTemperatureContext is a Context that can also set the color
+// temperature of a light.
+type ColorTemperatureContext interface {
+	Context
+
+	// SetWithColorTemperature works like Set except that it also sets the
+	// color temperature of the light to mireds. properties.C has no value.
+	SetWithColorTemperature(
+		lightId int, properties *gohue.LightProperties, mireds uint16) (
+		response []byte, err error)
+}
+
+// GroupContext is a Context that can also set all the lights in one of the
+// bridge's groups with a single command.
+type GroupContext interface {
+	Context
+
+	// GroupFor returns the id of the bridge group having exactly the
+	// lights in lightSet. ok is false if there is no such group.
+	GroupFor(lightSet lights.Set) (groupId int, ok bool)
+
+	// SetGroup sets the properties of all the lights in a bridge group.
+	SetGroup(groupId int, properties *gohue.LightProperties) (
+		response []byte, err error)
+}
+
+// GroupMap maps the bridge's group ids to the lights in each group.
+// GroupContext implementations can use it to implement GroupFor.
+type GroupMap map[int]lights.Set
+
+// GroupFor returns the id of the group having exactly the lights in
+// lightSet. If several groups match, GroupFor returns the smallest id.
+// GroupFor never matches all lights or no lights.
+func (g GroupMap) GroupFor(lightSet lights.Set) (groupId int, ok bool) {
+	if lightSet.IsAll() || lightSet.IsNone() {
+		return
+	}
+	want := lightSet.String()
+	for id, groupLights := range g {
+		if groupLights.IsAll() || groupLights.String() != want {
+			continue
+		}
+		if !ok || id < groupId {
+			groupId, ok = id, true
+		}
+	}
+	return
+}
+
+// ColorTemperatureToColor returns the xy color of a black body at the
+// color temperature mireds. Color temperatures hotter than MaxKelvin or
+// cooler than MinKelvin are treated as MaxKelvin or MinKelvin.
+func ColorTemperatureToColor(mireds uint16) gohue.Color {
+	if mireds == 0 {
+		return KelvinToColor(MaxKelvin)
+	}
+	return KelvinToColor(1e6 / float64(mireds))
+}
+
+// KelvinToColor returns the xy color of a black body at a color
+// temperature in kelvin. kelvin is clamped to be between MinKelvin and
+// MaxKelvin.
+func KelvinToColor(kelvin float64) gohue.Color {
+	t := math.Min(math.Max(kelvin, MinKelvin), MaxKelvin)
+	var x float64
+	if t <= 4000.0 {
+		x = -0.2661239e9/(t*t*t) - 0.2343589e6/(t*t) + 0.8776956e3/t + 0.179910
+	} else {
+		x = -3.0258469e9/(t*t*t) + 2.1070379e6/(t*t) + 0.2226347e3/t + 0.240390
+	}
+	var y float64
+	switch {
+	case t <= 2222.0:
+		y = -1.1063814*x*x*x - 1.34811020*x*x + 2.18555832*x - 0.20219683
+	case t <= 4000.0:
+		y = -0.9549476*x*x*x - 1.37418593*x*x + 2.09137015*x - 0.16748867
+	default:
+		y = 3.0817580*x*x*x - 5.87338670*x*x + 3.75112997*x - 0.37001483
+	}
+	return gohue.NewColor(x, y)
+}
+
+// Snapshot reads the current state of the lights in lightSet. Snapshot
+// captures whether each light is on along with its color, brightness, and
+// color temperature even if it is off. If reader is a
+// ColorTemperatureReader, Snapshot captures the color temperature of
+// lights in color temperature mode. If reader is a ReachabilityReader,
+// Snapshot captures whether each light is reachable.
+func Snapshot(reader LightReader, lightSet lights.Set) (LightColors, error) {
+	ctReader, isCtReader := asColorTemperatureReader(reader)
+	reachabilityReader, isReachabilityReader := asReachabilityReader(reader)
+	result := make(LightColors, len(lightSet))
+	for lightId, valid := range lightSet {
+		if !valid {
+			continue
+		}
+		properties, response, err := reader.Get(lightId)
+		if err != nil {
+			return nil, FixError(lightId, response, err)
+		}
+		colorBrightness := ColorBrightness{
+			Color:      properties.C,
+			Brightness: properties.Bri,
+			On:         maybe.NewBool(properties.On.Value),
+		}
+		if isCtReader {
+			mireds, response, err := ctReader.GetColorTemperature(lightId)
+			if err != nil {
+				return nil, FixError(lightId, response, err)
+			}
+			colorBrightness.ColorTemperature = mireds
+		}
+		if isReachabilityReader {
+			reachable, response, err := reachabilityReader.IsReachable(lightId)
+			if err != nil {
+				return nil, FixError(lightId, response, err)
+			}
+			colorBrightness.Reachable = maybe.NewBool(reachable)
+		}
+		result[lightId] = colorBrightness
+	}
+	return result, nil
+}
+
+// Restore restores the lights back to their original state.
+// ctxt is the current context; lightColors are the state of the lights
+// as returned by Snapshot.
+func Restore(ctxt Context, lightColors LightColors) error {
+	for id := range lightColors {
+		// use 400ms fade in
+		if response, err := setColorBrightness(
+			ctxt, id, lightColors[id], maybe.NewUint16(4)); err != nil {
+			return FixError(id, response, err)
+		}
+	}
+	// Wait 500ms for fade in to take effect
+	time.Sleep(500 * time.Millisecond)
+	return nil
+}
+
+// StaticHueAction represents a HueAction that turns each light on to some
+// some color and brightness.
+// These instances must be treated as immutable.
+type StaticHueAction LightColors
+
+func (a StaticHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	globalCb, isGlobal := a[0]
+
+	ids, ok := lightSet.Slice()
+	if !ok {
+		return
+	}
+	var noTransition maybe.Uint16
+	if len(ids) == 0 {
+		if !isGlobal {
+			panic("Received All lights, but no global color-brightness")
+		}
+		if response, err := setColorBrightness(
+			ctxt, 0, globalCb, noTransition); err != nil {
+			e.SetError(FixError(0, response, err))
+		}
+		return
+	}
+
+	if groupCtxt, ok := AsGroupContext(ctxt); ok && len(ids) > 1 {
+		if setGroup(groupCtxt, a, ids, e) {
+			return
+		}
+	}
+	for _, id := range ids {
+		cb := a[id]
+		if isGlobal {
+			cb = globalCb
+		}
+		if response, err := setColorBrightness(
+			ctxt, id, cb, noTransition); err != nil {
+			e.SetError(FixError(id, response, err))
+		}
+	}
+}
+
+func (a StaticHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	if _, isAll := a[0]; isAll {
+		return lightSet
+	}
+	usedLights := make(lights.Set, len(a))
+	for id := range a {
+		usedLights[id] = true
+	}
+	return usedLights.Intersect(lightSet)
+}
+
+// setGroup sets the lights in ids with a single group command if they are
+// all to have the same color and brightness and they make up exactly one
+// of the bridge's groups. setGroup returns false if it could not use a
+// group command.
+func setGroup(
+	ctxt GroupContext, a StaticHueAction, ids []int, e *tasks.Execution) bool {
+	cb, ok := a[0]
+	if !ok {
+		cb = a[ids[0]]
+		for _, id := range ids[1:] {
+			if a[id] != cb {
+				return false
+			}
+		}
+	}
+	if _, isCt := AsColorTemperatureContext(ctxt); isCt &&
+		cb.ColorTemperature.Valid {
+		return false
+	}
+	if cb.Reachable.Valid && !cb.Reachable.Value {
+		return false
+	}
+	groupId, ok := ctxt.GroupFor(lights.New(ids...))
+	if !ok {
+		return false
+	}
+	var noTransition maybe.Uint16
+	if response, err := ctxt.SetGroup(
+		groupId,
+		colorBrightnessToLightPropertiesWithTransition(
+			cb, noTransition)); err != nil {
+		e.SetError(fixGroupError(response, err))
+	}
+	return true
+}
+
+// RateLimited returns a Context that sends commands to ctx at an average
+// rate of at most perSecond commands per second. It sends up to burst
+// commands at once before it starts waiting. The returned Context is safe
+// to use with multiple goroutines, so several executors can share it to
+// pace all the commands going to the same bridge. Reading lights does not
+// count against the rate. The returned Context is a Wrapper so it
+// supports the same optional interfaces as ctx. Use WithExecution so that
+// commands of a task stop waiting when the task ends.
+func RateLimited(ctx Context, perSecond float64, burst int) Context {
+	return RateLimitedWithClock(ctx, perSecond, burst, tasks.SystemClock())
+}
+
+// RateLimitedWithClock works like RateLimited except that it uses clock
+// to wait.
+func RateLimitedWithClock(
+	ctx Context, perSecond float64, burst int, clock tasks.Clock) Context {
+	if perSecond <= 0.0 {
+		panic("perSecond must be positive")
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimitedContext{
+		ContextWrapper: ContextWrapper{Context: ctx},
+		limiter: &rateLimiter{
+			clock:    clock,
+			interval: time.Duration(float64(time.Second) / perSecond),
+			burst:    burst,
+		},
+	}
+}
+
+type rateLimitedContext struct {
+	ContextWrapper
+	limiter *rateLimiter
+	ended   <-chan struct{}
+}
+
+func (c *rateLimitedContext) Rewrap(ctxt Context) Context {
+	return &rateLimitedContext{
+		ContextWrapper: ContextWrapper{Context: ctxt},
+		limiter:        c.limiter,
+		ended:          c.ended,
+	}
+}
+
+func (c *rateLimitedContext) withEnded(
+	ended <-chan struct{}) *rateLimitedContext {
+	return &rateLimitedContext{
+		ContextWrapper: c.ContextWrapper,
+		limiter:        c.limiter,
+		ended:          ended,
+	}
+}
+
+func (c *rateLimitedContext) Set(
+	lightId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	c.limiter.wait(c.ended)
+	return c.ContextWrapper.Set(lightId, properties)
+}
+
+func (c *rateLimitedContext) SetWithColorTemperature(
+	lightId int, properties *gohue.LightProperties, mireds uint16) (
+	response []byte, err error) {
+	c.limiter.wait(c.ended)
+	return c.ContextWrapper.SetWithColorTemperature(
+		lightId, properties, mireds)
+}
+
+func (c *rateLimitedContext) SetGroup(
+	groupId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	c.limiter.wait(c.ended)
+	return c.ContextWrapper.SetGroup(groupId, properties)
+}
+
+func (c *rateLimitedContext) SetEffect(lightId int, effect string) (
+	response []byte, err error) {
+	c.limiter.wait(c.ended)
+	return c.ContextWrapper.SetEffect(lightId, effect)
+}
+
+func (c *rateLimitedContext) SetAlert(lightId int, alert string) (
+	response []byte, err error) {
+	c.limiter.wait(c.ended)
+	return c.ContextWrapper.SetAlert(lightId, alert)
+}
+
+// rateLimiter hands out time slots for commands. The Contexts that
+// Rewrap and WithExecution return share it with the original.
+type rateLimiter struct {
+	clock    tasks.Clock
+	interval time.Duration
+	burst    int
+	mutex    sync.Mutex
+	next     time.Time
+}
+
+// wait waits for the next time slot. wait returns early if ended is
+// closed. A nil ended means wait until the time slot.
+func (c *rateLimiter) wait(ended <-chan struct{}) {
+	wait := c.reserve()
+	if wait <= 0 {
+		return
+	}
+	select {
+	case <-c.clock.After(wait):
+	case <-ended:
+	}
+}
+
+// reserve reserves a time slot for the next command and returns how long
+// to wait for that slot.
+func (c *rateLimiter) reserve() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := c.clock.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	wait := c.next.Sub(now) - time.Duration(c.burst-1)*c.interval
+	c.next = c.next.Add(c.interval)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Temporarily returns a HueAction that does action for d and then puts
+// the lights action used back the way they were. reader reads the state
+// of the lights before action starts. If the execution ends before d
+// elapses, the returned HueAction stops action early and still puts the
+// lights back. Since reader can read only specific lights, the returned
+// HueAction puts back nothing if action uses all lights.
+func Temporarily(
+	action HueAction, d time.Duration, reader LightReader) HueAction {
+	return &temporaryHueAction{HueAction: action, d: d, reader: reader}
+}
+
+type temporaryHueAction struct {
+	HueAction
+	d      time.Duration
+	reader LightReader
+}
+
+func (a *temporaryHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	usedLights := a.UsedLights(lightSet)
+	snapshot, err := Snapshot(a.reader, usedLights)
+	if err != nil {
+		e.SetError(err)
+		return
+	}
+	child := tasks.Start(tasks.TaskFunc(func(childE *tasks.Execution) {
+		a.HueAction.Do(ctxt, usedLights, childE)
+		Finalize(a.HueAction, ctxt, usedLights)
+	}))
+	e.Sleep(a.d)
+	child.End()
+	<-child.Done()
+	if err := child.Error(); err != nil {
+		e.SetError(err)
+	}
+	if err := Restore(ctxt, snapshot); err != nil {
+		e.SetError(err)
+	}
+}
+
+// WithTransitionTime returns a Context that works like ctxt except that
+// commands that don't specify a transition time take transitionTime.
+// WithTransitionTime rounds transitionTime down to the nearest 100ms.
+// The returned Context is a Wrapper so it supports the same optional
+// interfaces as ctxt.
+func WithTransitionTime(ctxt Context, transitionTime time.Duration) Context {
+	return &transitionTimeContext{
+		ContextWrapper: ContextWrapper{Context: ctxt},
+		transitionTime: toTransitionTime(transitionTime),
+	}
+}
+
+type transitionTimeContext struct {
+	ContextWrapper
+	transitionTime maybe.Uint16
+}
+
+func (c *transitionTimeContext) Rewrap(ctxt Context) Context {
+	return &transitionTimeContext{
+		ContextWrapper: ContextWrapper{Context: ctxt},
+		transitionTime: c.transitionTime,
+	}
+}
+
+func (c *transitionTimeContext) Set(
+	lightId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	return c.ContextWrapper.Set(lightId, c.withTransition(properties))
+}
+
+func (c *transitionTimeContext) SetWithColorTemperature(
+	lightId int, properties *gohue.LightProperties, mireds uint16) (
+	response []byte, err error) {
+	return c.ContextWrapper.SetWithColorTemperature(
+		lightId, c.withTransition(properties), mireds)
+}
+
+func (c *transitionTimeContext) SetGroup(
+	groupId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	return c.ContextWrapper.SetGroup(groupId, c.withTransition(properties))
+}
+
+// withTransition returns properties with the default transition time
+// if properties has no transition time.
+func (c *transitionTimeContext) withTransition(
+	properties *gohue.LightProperties) *gohue.LightProperties {
+	if properties.TransitionTime.Valid {
+		return properties
+	}
+	result := *properties
+	result.TransitionTime = c.transitionTime
+	return &result
+}
+
+// toTransitionTime converts d to multiples of 100ms rounding down.
+func toTransitionTime(d time.Duration) maybe.Uint16 {
+	units := d / (100 * time.Millisecond)
+	if units < 0 {
+		units = 0
+	}
+	if units > math.MaxUint16 {
+		units = math.MaxUint16
+	}
+	return maybe.NewUint16(uint16(units))
+}
+
+// Correlator is a Context that can tag the commands it sends with the
+// correlation id of the task sending them.
+type Correlator interface {
+	Context
+
+	// WithCorrelationId returns a Context that works like this one but
+	// tags each command with id.
+	WithCorrelationId(id string) Context
+}
+
+// WithCorrelationId returns a Context that tags each command with id if
+// ctxt is a Correlator or wraps one. Otherwise WithCorrelationId returns
+// ctxt.
+func WithCorrelationId(ctxt Context, id string) Context {
+	switch c := ctxt.(type) {
+	case Correlator:
+		return c.WithCorrelationId(id)
+	case Wrapper:
+		return c.Rewrap(WithCorrelationId(c.Unwrap(), id))
+	}
+	return ctxt
+}
+
+// Logged returns a Context that works like ctxt except that it logs each
+// command to logger with the light id, color, brightness, transition time,
+// and result of the command. The returned Context is a Correlator so that
+// each log line shows which task sent the command. The returned Context
+// is also a Wrapper so it supports the same optional interfaces as ctxt.
+func Logged(ctxt Context, logger *log.Logger) Context {
+	return &loggedContext{
+		ContextWrapper: ContextWrapper{Context: ctxt}, logger: logger}
+}
+
+type loggedContext struct {
+	ContextWrapper
+	logger        *log.Logger
+	correlationId string
+}
+
+func (c *loggedContext) Rewrap(ctxt Context) Context {
+	return &loggedContext{
+		ContextWrapper: ContextWrapper{Context: ctxt},
+		logger:         c.logger,
+		correlationId:  c.correlationId,
+	}
+}
+
+func (c *loggedContext) WithCorrelationId(id string) Context {
+	return &loggedContext{
+		ContextWrapper: c.ContextWrapper,
+		logger:         c.logger,
+		correlationId:  id,
+	}
+}
+
+func (c *loggedContext) Set(
+	lightId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	response, err = c.ContextWrapper.Set(lightId, properties)
+	c.log(fmt.Sprintf(
+		"light %d:%s", lightId, formatLightProperties(properties)), err)
+	return
+}
+
+func (c *loggedContext) SetWithColorTemperature(
+	lightId int, properties *gohue.LightProperties, mireds uint16) (
+	response []byte, err error) {
+	response, err = c.ContextWrapper.SetWithColorTemperature(
+		lightId, properties, mireds)
+	c.log(fmt.Sprintf(
+		"light %d:%s ct=%d",
+		lightId,
+		formatLightProperties(properties),
+		mireds), err)
+	return
+}
+
+func (c *loggedContext) SetGroup(
+	groupId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	response, err = c.ContextWrapper.SetGroup(groupId, properties)
+	c.log(fmt.Sprintf(
+		"group %d:%s", groupId, formatLightProperties(properties)), err)
+	return
+}
+
+func (c *loggedContext) SetEffect(lightId int, effect string) (
+	response []byte, err error) {
+	response, err = c.ContextWrapper.SetEffect(lightId, effect)
+	c.log(fmt.Sprintf("light %d: effect=%s", lightId, effect), err)
+	return
+}
+
+func (c *loggedContext) SetAlert(lightId int, alert string) (
+	response []byte, err error) {
+	response, err = c.ContextWrapper.SetAlert(lightId, alert)
+	c.log(fmt.Sprintf("light %d: alert=%s", lightId, alert), err)
+	return
+}
+
+// log logs one command with its result.
+func (c *loggedContext) log(command string, err error) {
+	result := "OK"
+	if err != nil {
+		result = fmt.Sprintf("ERROR: %v", err)
+	}
+	correlationId := c.correlationId
+	if correlationId == "" {
+		correlationId = "-"
+	}
+	c.logger.Printf("SET: [%s] %s: %s", correlationId, command, result)
+}
+
+func formatLightProperties(properties *gohue.LightProperties) string {
+	var result string
+	if properties.On.Valid {
+		result += fmt.Sprintf(" on=%t", properties.On.Value)
+	}
+	if properties.C.Valid {
+		result += fmt.Sprintf(" color=%s", properties.C.Color)
+	}
+	if properties.Bri.Valid {
+		result += fmt.Sprintf(" bri=%d", properties.Bri.Value)
+	}
+	if properties.TransitionTime.Valid {
+		result += fmt.Sprintf(
+			" transition=%s",
+			time.Duration(properties.TransitionTime.Value)*100*time.Millisecond)
+	}
+	return result
+}
+
+// Role is the part a light plays in an action.
+type Role int
+
+const (
+	// The main light
+	PrimaryRole Role = iota
+
+	// The light that sets off the main light
+	AccentRole
+
+	// The lights in the background
+	AmbientRole
+)
+
+// Roles maps each role to its lights.
+type Roles map[Role]lights.Set
+
+// BindRoles binds roleCount roles to the lights in lightSet. Taking
+// lights in ascending order by id, the first light gets role 0, the second
+// light gets role 1 and so on. The last role gets all the remaining
+// lights. If lightSet is all lights, the first role gets all lights.
+func BindRoles(lightSet lights.Set, roleCount int) Roles {
+	ids, ok := lightSet.Slice()
+	if !ok || roleCount < 1 {
+		return Roles{}
+	}
+	if len(ids) == 0 {
+		return Roles{0: lights.All}
+	}
+	result := make(Roles, roleCount)
+	for i, id := range ids {
+		role := Role(i)
+		if role >= Role(roleCount) {
+			role = Role(roleCount - 1)
+		}
+		if result[role] == nil {
+			result[role] = make(lights.Set)
+		}
+		result[role][id] = true
+	}
+	return result
+}
+
+// WithRoles returns a HueAction for actions written against roles rather
+// than light ids. Each time the returned HueAction runs, it binds roleCount
+// roles to its lights using BindRoles and then does the HueAction that
+// newAction returns for those roles.
+func WithRoles(roleCount int, newAction func(roles Roles) HueAction) HueAction {
+	return &roleHueAction{roleCount: roleCount, newAction: newAction}
+}
+
+// RoleColors is the color and brightness for each role.
+// These instances must be treated as immutable.
+type RoleColors map[Role]ColorBrightness
+
+// Bind returns the StaticHueAction that gives the lights of each role in
+// roles the color and brightness of that role.
+func (r RoleColors) Bind(roles Roles) StaticHueAction {
+	result := make(StaticHueAction)
+	for role, lightSet := range roles {
+		cb, ok := r[role]
+		if !ok {
+			continue
+		}
+		if lightSet.IsAll() {
+			result[0] = cb
+			continue
+		}
+		for id, valid := range lightSet {
+			if valid {
+				result[id] = cb
+			}
+		}
+	}
+	return result
+}
+
+// AsHueAction returns a HueAction that binds the roles of this instance to
+// its lights with WithRoles.
+func (r RoleColors) AsHueAction() HueAction {
+	roleCount := 0
+	for role := range r {
+		if int(role) >= roleCount {
+			roleCount = int(role) + 1
+		}
+	}
+	return WithRoles(roleCount, func(roles Roles) HueAction {
+		return r.Bind(roles)
+	})
+}
+
+type roleHueAction struct {
+	roleCount int
+	newAction func(roles Roles) HueAction
+}
+
+func (a *roleHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	roles := BindRoles(lightSet, a.roleCount)
+	if len(roles) == 0 {
+		return
+	}
+	action := a.newAction(roles)
+	action.Do(ctxt, action.UsedLights(lightSet), e)
+}
+
+func (a *roleHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+// Sequence returns a HueAction that does actions one after the other.
+// The returned HueAction stops early if its execution ends or if one of
+// actions reports an error. Its UsedLights is the union of the UsedLights
+// of actions.
+func Sequence(actions ...HueAction) HueAction {
+	return sequenceHueAction(actions)
+}
+
+// Parallel returns a HueAction that does actions all at the same time.
+// actions should use disjoint sets of lights. The returned HueAction
+// finishes when all of actions finish. Its UsedLights is the union of the
+// UsedLights of actions.
+func Parallel(actions ...HueAction) HueAction {
+	return parallelHueAction(actions)
+}
+
+// Overlay returns a HueTask that does the action of base and then the
+// action of overlay. Since the overlay goes last, its settings win for
+// the lights it covers such as dimming the accent lights of a scene.
+// base should be an action that finishes such as a scene. The returned
+// task has the id of base and its UsedLights is the union of the
+// UsedLights of base and overlay.
+func Overlay(base, overlay *HueTask) *HueTask {
+	return &HueTask{
+		Id:          base.Id,
+		HueAction:   Sequence(base.HueAction, overlay.HueAction),
+		Description: base.Description + " + " + overlay.Description,
+	}
+}
+
+type sequenceHueAction []HueAction
+
+func (a sequenceHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	for _, action := range a {
+		action.Do(ctxt, action.UsedLights(lightSet), e)
+		if e.Error() != nil || !e.Yield(nil) {
+			return
+		}
+	}
+}
+
+// Finalize finalizes each action in the sequence.
+func (a sequenceHueAction) Finalize(ctxt Context, lightSet lights.Set) {
+	for _, action := range a {
+		Finalize(action, ctxt, action.UsedLights(lightSet))
+	}
+}
+
+func (a sequenceHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return unionUsedLights(a, lightSet)
+}
+
+type parallelHueAction []HueAction
+
+func (a parallelHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	parallel := make([]tasks.Task, len(a))
+	for i := range a {
+		action := a[i]
+		parallel[i] = tasks.TaskFunc(func(e *tasks.Execution) {
+			action.Do(ctxt, action.UsedLights(lightSet), e)
+		})
+	}
+	tasks.ParallelTasks(parallel...).Do(e)
+}
+
+// Finalize finalizes each action.
+func (a parallelHueAction) Finalize(ctxt Context, lightSet lights.Set) {
+	for _, action := range a {
+		Finalize(action, ctxt, action.UsedLights(lightSet))
+	}
+}
+
+func (a parallelHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return unionUsedLights(a, lightSet)
+}
+
+func unionUsedLights(actions []HueAction, lightSet lights.Set) lights.Set {
+	result := lights.None
+	for _, action := range actions {
+		result = result.Add(action.UsedLights(lightSet))
+	}
+	return result
+}
+
+// ScaleBrightness returns a HueAction that works like action except that
+// it multiplies each brightness that action sets by factor(). factor
+// returns a value between 0 and 1. ScaleBrightness never scales a
+// brightness below 1 so scaled lights never turn off.
+func ScaleBrightness(action HueAction, factor func() float64) HueAction {
+	return &scaledHueAction{HueAction: action, factor: factor}
+}
+
+type scaledHueAction struct {
+	HueAction
+	factor func() float64
+}
+
+func (a *scaledHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	a.HueAction.Do(
+		&scaledContext{
+			ContextWrapper: ContextWrapper{Context: ctxt},
+			factor:         a.factor(),
+		},
+		lightSet,
+		e)
+}
+
+// Finalize finalizes the action being scaled.
+func (a *scaledHueAction) Finalize(ctxt Context, lightSet lights.Set) {
+	Finalize(a.HueAction, ctxt, lightSet)
+}
+
+type scaledContext struct {
+	ContextWrapper
+	factor float64
+}
+
+func (c *scaledContext) Rewrap(ctxt Context) Context {
+	return &scaledContext{
+		ContextWrapper: ContextWrapper{Context: ctxt},
+		factor:         c.factor,
+	}
+}
+
+func (c *scaledContext) Set(lightId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	return c.ContextWrapper.Set(lightId, c.scale(properties))
+}
+
+func (c *scaledContext) SetWithColorTemperature(
+	lightId int, properties *gohue.LightProperties, mireds uint16) (
+	response []byte, err error) {
+	return c.ContextWrapper.SetWithColorTemperature(
+		lightId, c.scale(properties), mireds)
+}
+
+func (c *scaledContext) SetGroup(
+	groupId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	return c.ContextWrapper.SetGroup(groupId, c.scale(properties))
+}
+
+// scale returns properties with its brightness scaled.
+func (c *scaledContext) scale(
+	properties *gohue.LightProperties) *gohue.LightProperties {
+	if !properties.Bri.Valid {
+		return properties
+	}
+	scaled := *properties
+	bri := math.Round(float64(properties.Bri.Value) * c.factor)
+	if bri < 1.0 {
+		bri = 1.0
+	}
+	if bri > 255.0 {
+		bri = 255.0
+	}
+	scaled.Bri = maybe.NewUint8(uint8(bri))
+	return &scaled
+}
+
+// TransitionHueAction returns a HueAction that gradually fades the lights
+// from one set of colors and brightnesses to another over duration.
+// A light that is off in from fades in from its color in to; a light that
+// is off in to fades out and then turns off. The returned HueAction sends
+// at most kMaxCommandsPerSecond commands to the bridge, so the more lights
+// it fades, the coarser the steps. It stops early when its execution ends.
+func TransitionHueAction(
+	from, to LightColors, duration time.Duration) HueAction {
+	return &transitionHueAction{
+		from: from, to: to, duration: duration, curve: LinearCurve}
+}
+
+// Curve returns the brightness ratio of the way from start to end.
+// ratio is between 0 and 1; start and end are between 0 and 255.
+type Curve func(start, end, ratio float64) float64
+
+// LinearCurve changes brightness at a constant rate.
+func LinearCurve(start, end, ratio float64) float64 {
+	return start + ratio*(end-start)
+}
+
+// PerceptualCurve changes brightness so that it appears to the eye to
+// change at a constant rate. Because the eye is more sensitive to changes
+// in dim light, PerceptualCurve changes brightness slowly when the light
+// is dim and quickly when it is bright.
+func PerceptualCurve(start, end, ratio float64) float64 {
+	perceivedStart := math.Pow(start/255.0, 1.0/kGamma)
+	perceivedEnd := math.Pow(end/255.0, 1.0/kGamma)
+	perceived := perceivedStart + ratio*(perceivedEnd-perceivedStart)
+	return 255.0 * math.Pow(perceived, kGamma)
+}
+
+// RampAction returns a HueAction that slowly changes the lights from
+// start to end over duration, such as for waking up or winding down.
+// curve controls how the brightness changes over time; color always
+// changes at a constant rate.
+func RampAction(
+	start, end ColorBrightness,
+	duration time.Duration,
+	curve Curve) HueAction {
+	return &transitionHueAction{
+		from:     LightColors{0: start},
+		to:       LightColors{0: end},
+		duration: duration,
+		curve:    curve,
+	}
+}
+
+// NewRampHueTask returns a HueTask for a RampAction.
+func NewRampHueTask(
+	id int,
+	description string,
+	start, end ColorBrightness,
+	duration time.Duration,
+	curve Curve) *HueTask {
+	return &HueTask{
+		Id:          id,
+		HueAction:   RampAction(start, end, duration, curve),
+		Description: description,
+	}
+}
+
+// DimAction returns a HueAction that changes the brightness of the lights
+// that are on to targetBrightness over duration without changing their
+// colors. DimAction leaves lights that are off alone. It reads the
+// starting brightness of each light from its context which should be a
+// LightReader. If its context is not a LightReader or if it is to dim all
+// the lights, DimAction asks the bridge to make the whole change with a
+// single command per light.
+func DimAction(targetBrightness uint8, duration time.Duration) HueAction {
+	return &dimHueAction{brightness: targetBrightness, duration: duration}
+}
+
+type dimHueAction struct {
+	brightness uint8
+	duration   time.Duration
+}
+
+func (a *dimHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	reader, isReader := AsLightReader(ctxt)
+	if !isReader || lightSet.IsAll() {
+		a.dimAtOnce(ctxt, lightSet, e)
+		return
+	}
+	snapshot, err := Snapshot(reader, lightSet)
+	if err != nil {
+		e.SetError(err)
+		return
+	}
+	var ids []int
+	for id, cb := range snapshot {
+		if !cb.IsOff() && (!cb.Reachable.Valid || cb.Reachable.Value) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	sort.Ints(ids)
+	steps, sleepTime := transitionSteps(len(ids), a.duration)
+	transitionTime := toTransitionTime(sleepTime)
+	for i := 1; i <= steps; i++ {
+		ratio := float64(i) / float64(steps)
+		for _, id := range ids {
+			if e.IsEnded() {
+				return
+			}
+			bri := toBrightness(LinearCurve(
+				float64(snapshot[id].Brightness.Value),
+				float64(a.brightness),
+				ratio))
+			if response, err := ctxt.Set(id, &gohue.LightProperties{
+				Bri: bri, TransitionTime: transitionTime}); err != nil {
+				e.SetError(FixError(id, response, err))
+				return
+			}
+		}
+		if i < steps && !e.Sleep(sleepTime) {
+			return
+		}
+	}
+}
+
+// dimAtOnce lets the bridge dim the lights using the transition time of
+// each command.
+func (a *dimHueAction) dimAtOnce(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	ids := []int{0}
+	if !lightSet.IsAll() {
+		ids, _ = lightSet.Slice()
+	}
+	properties := &gohue.LightProperties{
+		Bri:            toBrightness(float64(a.brightness)),
+		TransitionTime: toTransitionTime(a.duration),
+	}
+	for _, id := range ids {
+		if e.IsEnded() {
+			return
+		}
+		if response, err := ctxt.Set(id, properties); err != nil {
+			e.SetError(FixError(id, response, err))
+			return
+		}
+	}
+	e.Sleep(a.duration)
 }
 
-// HueAction represents an action to be done with hue lights.
-type HueAction interface {
-	// Do does the action.
-	// ctxt is the connection to the hue bridge; lightSet is the exact set of
-	// lights. The tasks package provides e.
-	// If a Do implementation needs more than the Context interface and
-	// ctxt does not implement it then Do does nothing.
-	Do(ctxt Context, lightSet lights.Set, e *tasks.Execution)
+func (a *dimHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
 
-	// UsedLights returns the lights this instance will use given an initial
-	// set of lights.
-	// Implementations of UsedLights must obey these axioms:
-	// 1. UsedLights(UsedLights(A)) == UsedLights(A)
-	// 2. If A subset of B then UsedLights(A) subset of UsedLights(B)
-	UsedLights(lightSet lights.Set) lights.Set
+type transitionHueAction struct {
+	from     LightColors
+	to       LightColors
+	duration time.Duration
+	curve    Curve
 }
 
-// HueTask represents a HueAction with an ID and description.
-// These instances must be treated as immutable.
-type HueTask struct {
-	Id int
-	HueAction
-	Description string
+func (a *transitionHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	ids := a.lightIds(lightSet)
+	if len(ids) == 0 {
+		return
+	}
+	steps, sleepTime := transitionSteps(len(ids), a.duration)
+	transitionTime := toTransitionTime(sleepTime)
+	for i := 1; i < steps; i++ {
+		ratio := float64(i) / float64(steps)
+		for _, id := range ids {
+			if e.IsEnded() {
+				return
+			}
+			cb := blendColorBrightness(
+				colorBrightnessFor(a.from, id),
+				colorBrightnessFor(a.to, id),
+				ratio,
+				a.curve)
+			if response, err := setColorBrightness(
+				ctxt, id, cb, transitionTime); err != nil {
+				e.SetError(FixError(id, response, err))
+				return
+			}
+		}
+		if !e.Sleep(sleepTime) {
+			return
+		}
+	}
+	for _, id := range ids {
+		if e.IsEnded() {
+			return
+		}
+		if response, err := setColorBrightness(
+			ctxt, id, colorBrightnessFor(a.to, id), transitionTime); err != nil {
+			e.SetError(FixError(id, response, err))
+			return
+		}
+	}
 }
 
-// Refresh returns this instance.
-func (h *HueTask) Refresh() *HueTask {
-	return h
+func (a *transitionHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return StaticHueAction(a.from).UsedLights(lightSet).Add(
+		StaticHueAction(a.to).UsedLights(lightSet))
 }
 
-// GetDescription returns the description of this instance.
-func (h *HueTask) GetDescription() string {
-	return h.Description
+// transitionSteps returns how many steps to take to change lightCount
+// lights over duration and how long each step lasts. Steps are long
+// enough to stay within kMaxCommandsPerSecond.
+func transitionSteps(lightCount int, duration time.Duration) (
+	steps int, stepTime time.Duration) {
+	stepTime = kMinTransitionStep
+	if minStepTime := time.Duration(lightCount) * time.Second /
+		kMaxCommandsPerSecond; minStepTime > stepTime {
+		stepTime = minStepTime
+	}
+	steps = int(duration / stepTime)
+	if steps < 1 {
+		steps = 1
+	}
+	return steps, duration / time.Duration(steps)
 }
 
-// AtTimeTask represents a hue task scheduled to run at a particular time
-// on a particular set of lights.
-// These instances must be treated as immutable.
-type AtTimeTask struct {
-	// The schedule Id
-	Id string
+// lightIds returns the ids of the lights to fade in ascending order.
+// Light id 0 means all lights.
+func (a *transitionHueAction) lightIds(lightSet lights.Set) []int {
+	ids, ok := a.UsedLights(lightSet).Slice()
+	if !ok {
+		return nil
+	}
+	if len(ids) == 0 {
+		return []int{0}
+	}
+	return ids
+}
 
-	// The Hue Task
-	H *HueTask
+// colorBrightnessFor returns the color and brightness for lightId in
+// lightColors falling back to the color and brightness for all lights.
+func colorBrightnessFor(lightColors LightColors, lightId int) ColorBrightness {
+	if cb, ok := lightColors[lightId]; ok {
+		return cb
+	}
+	return lightColors[0]
+}
 
-	// The lights to run on
-	Ls lights.Set
+// blendColorBrightness returns the color and brightness ratio of the way
+// from start to end using curve for brightness. A light that is off has
+// brightness 0 and the color of the other side. The blended brightness is
+// never less than 1 so that the light stays on.
+func blendColorBrightness(
+	start, end ColorBrightness,
+	ratio float64,
+	curve Curve) ColorBrightness {
+	if start.IsOff() && end.IsOff() {
+		return end
+	}
+	startColor, endColor := start.xyColor(), end.xyColor()
+	if !startColor.Valid {
+		startColor = endColor
+	}
+	if !endColor.Valid {
+		endColor = startColor
+	}
+	var color gohue.MaybeColor
+	if startColor.Valid {
+		color = gohue.NewMaybeColor(
+			startColor.Color.Blend(endColor.Color, ratio))
+	}
+	startBri, endBri := onBrightness(start), onBrightness(end)
+	return ColorBrightness{
+		Color:      color,
+		Brightness: toBrightness(curve(startBri, endBri, ratio)),
+	}
+}
 
-	// The time to start
-	StartTime time.Time
+// toBrightness rounds bri to a brightness between 1 and 255.
+func toBrightness(bri float64) maybe.Uint8 {
+	bri = math.Round(bri)
+	if bri < 1.0 {
+		bri = 1.0
+	}
+	if bri > 255.0 {
+		bri = 255.0
+	}
+	return maybe.NewUint8(uint8(bri))
 }
 
-// HueTaskList represents an immutable list of hue tasks.
-type HueTaskList []*HueTask
+// onBrightness returns the brightness of a light as a float. A light that
+// is off has brightness 0.
+func onBrightness(cb ColorBrightness) float64 {
+	if cb.IsOff() {
+		return 0.0
+	}
+	return float64(cb.Brightness.Value)
+}
 
-// ColorBrightness represents a color and brightness.
-type ColorBrightness struct {
-	Color      gohue.MaybeColor
-	Brightness maybe.Uint8
+// EffectContext is a Context that can also start and stop the built-in
+// effects of the hue bridge.
+type EffectContext interface {
+	Context
+
+	// SetEffect sets the effect of a particular light. effect is
+	// ColorLoopEffect or NoEffect.
+	SetEffect(lightId int, effect string) (response []byte, err error)
 }
 
-// LightColors represents both color and brightness for each light. The key
-// of the map is the light id; the value is the color and brightness for that
-// light. A color and brightness for light id 0 means all lights are to have
-// that color and brightness.
-// These instances must be treated as immutable.
-type LightColors map[int]ColorBrightness
+// ColorLoopAction returns a HueAction that cycles the lights through
+// colors at brightness until its execution ends. The lights stay at each
+// color for dwell and take transition to fade from one color to the next.
+func ColorLoopAction(
+	colors []gohue.Color,
+	brightness uint8,
+	dwell, transition time.Duration) HueAction {
+	return &colorLoopHueAction{
+		colors:     colors,
+		brightness: brightness,
+		dwell:      dwell,
+		transition: transition,
+	}
+}
 
-// Interface LightReader reads the state of a light
-type LightReader interface {
-	Get(lightId int) (*gohue.LightProperties, []byte, error)
+// NativeColorLoopAction returns a HueAction that turns the lights on at
+// brightness and runs the bridge's built-in colorloop effect on them until
+// its execution ends. The returned HueAction is a Finalizer that stops
+// the effect. If ctxt does not implement EffectContext, the returned
+// HueAction does fallback instead.
+func NativeColorLoopAction(brightness uint8, fallback HueAction) HueAction {
+	return &nativeColorLoopHueAction{
+		brightness: brightness, fallback: fallback}
 }
 
-// Snapshot reads the current state of the lights in lightSet.
-func Snapshot(reader LightReader, lightSet lights.Set) (LightColors, error) {
-	result := make(LightColors, len(lightSet))
-	for lightId, valid := range lightSet {
-		if !valid {
-			continue
+type colorLoopHueAction struct {
+	colors     []gohue.Color
+	brightness uint8
+	dwell      time.Duration
+	transition time.Duration
+}
+
+func (a *colorLoopHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	if len(a.colors) == 0 {
+		return
+	}
+	a.colorsAt(0).Do(ctxt, lightSet, e)
+	for i := 0; e.Error() == nil; i = (i + 1) % len(a.colors) {
+		// Guard against a tight loop that floods the bridge
+		dwell := a.dwell
+		if dwell < time.Second && a.transition < time.Second {
+			dwell = time.Second
 		}
-		properties, response, err := reader.Get(lightId)
-		if err != nil {
-			return nil, FixError(lightId, response, err)
+		if !e.Sleep(dwell) {
+			return
 		}
-		var colorBrightness ColorBrightness
-		if properties.On.Value {
-			colorBrightness.Color = properties.C
-			colorBrightness.Brightness = properties.Bri
+		next := (i + 1) % len(a.colors)
+		TransitionHueAction(
+			LightColors(a.colorsAt(i)),
+			LightColors(a.colorsAt(next)),
+			a.transition).Do(ctxt, lightSet, e)
+		if e.IsEnded() {
+			return
 		}
-		result[lightId] = colorBrightness
 	}
-	return result, nil
 }
 
-// Restore restores the lights back to their original state.
-// ctxt is the current context; lightColors are the state of the lights
-// as returned by Snapshot.
-func Restore(ctxt Context, lightColors LightColors) error {
-	for id := range lightColors {
-		// use 400ms fade in
-		if response, err := ctxt.Set(
-			id,
-			colorBrightnessToLightPropertiesWithTransition(
-				lightColors[id], maybe.NewUint16(4))); err != nil {
-			return FixError(id, response, err)
-		}
-	}
-	// Wait 500ms for fade in to take effect
-	time.Sleep(500 * time.Millisecond)
-	return nil
+func (a *colorLoopHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
 }
 
-// StaticHueAction represents a HueAction that turns each light on to some
-// some color and brightness.
-// These instances must be treated as immutable.
-type StaticHueAction LightColors
+func (a *colorLoopHueAction) colorsAt(idx int) StaticHueAction {
+	return StaticHueAction{0: {
+		Color:      gohue.NewMaybeColor(a.colors[idx]),
+		Brightness: maybe.NewUint8(a.brightness),
+	}}
+}
 
-func (a StaticHueAction) Do(
+type nativeColorLoopHueAction struct {
+	brightness uint8
+	fallback   HueAction
+}
+
+func (a *nativeColorLoopHueAction) Do(
 	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
-	var globalLightProperties *gohue.LightProperties
-	if globalCb, ok := a[0]; ok {
-		globalLightProperties = colorBrightnessToLightProperties(globalCb)
+	effectCtxt, ok := AsEffectContext(ctxt)
+	if !ok {
+		a.fallback.Do(ctxt, lightSet, e)
+		return
 	}
-
 	ids, ok := lightSet.Slice()
 	if !ok {
 		return
 	}
 	if len(ids) == 0 {
-		if globalLightProperties == nil {
-			panic("Received All lights, but no global color-brightness")
+		ids = []int{0}
+	}
+	properties := &gohue.LightProperties{
+		Bri: maybe.NewUint8(a.brightness), On: maybe.NewBool(true)}
+	for _, id := range ids {
+		if response, err := ctxt.Set(id, properties); err != nil {
+			e.SetError(FixError(id, response, err))
+			return
+		}
+		if response, err := effectCtxt.SetEffect(
+			id, ColorLoopEffect); err != nil {
+			e.SetError(FixError(id, response, err))
+			return
 		}
-		if response, err := ctxt.Set(0, globalLightProperties); err != nil {
+	}
+	<-e.Ended()
+}
+
+// Finalize stops the colorloop effect.
+func (a *nativeColorLoopHueAction) Finalize(
+	ctxt Context, lightSet lights.Set) {
+	effectCtxt, ok := AsEffectContext(ctxt)
+	if !ok {
+		Finalize(a.fallback, ctxt, lightSet)
+		return
+	}
+	ids, ok := lightSet.Slice()
+	if !ok {
+		return
+	}
+	if len(ids) == 0 {
+		ids = []int{0}
+	}
+	for _, id := range ids {
+		effectCtxt.SetEffect(id, NoEffect)
+	}
+}
+
+func (a *nativeColorLoopHueAction) UsedLights(
+	lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+// PartyAction returns a HueAction that changes the lights to random
+// colors from palette at random brightnesses until its execution ends.
+// The lights stay at each color for a random time between minInterval and
+// maxInterval and fade to the next color over minInterval. If
+// perLightIndependent is true, each light changes to its own color on its
+// own schedule; otherwise all the lights change to the same color
+// together. When changing all the lights independently, PartyAction needs
+// a context that is a LightLister to find the lights; with any other
+// context, all the lights change together. PartyAction makes minInterval
+// long enough that it sends no more than 10 commands per second on
+// average. PartyAction does not know about any rate limit on its context.
+// Under RateLimited, each command waits its turn, so the lights change
+// later than scheduled, but PartyAction sends no more commands once its
+// execution ends.
+func PartyAction(
+	palette []gohue.Color,
+	minInterval, maxInterval time.Duration,
+	perLightIndependent bool) HueAction {
+	return &partyHueAction{
+		palette:             palette,
+		minInterval:         minInterval,
+		maxInterval:         maxInterval,
+		perLightIndependent: perLightIndependent,
+	}
+}
+
+type partyHueAction struct {
+	palette             []gohue.Color
+	minInterval         time.Duration
+	maxInterval         time.Duration
+	perLightIndependent bool
+}
+
+func (a *partyHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	if len(a.palette) == 0 {
+		return
+	}
+	ids := []int{0}
+	if !lightSet.IsAll() {
+		ids, _ = lightSet.Slice()
+	} else if lister, ok := AsLightLister(ctxt); ok && a.perLightIndependent {
+		allIds, response, err := lister.ListLights()
+		if err != nil {
 			e.SetError(FixError(0, response, err))
+			return
 		}
+		ids = allIds
+	}
+	if len(ids) == 0 {
+		return
+	}
+	minInterval := a.minInterval
+	if rateLimit := time.Duration(len(ids)) * time.Second /
+		kMaxCommandsPerSecond; rateLimit > minInterval {
+		minInterval = rateLimit
+	}
+	maxInterval := a.maxInterval
+	if maxInterval < minInterval {
+		maxInterval = minInterval
+	}
+	seed := time.Now().UnixNano()
+	if !a.perLightIndependent || len(ids) == 1 {
+		party(ctxt, ids, a.palette, minInterval, maxInterval, seed, e)
 		return
 	}
+	parallel := make([]tasks.Task, len(ids))
+	for i := range ids {
+		lightId := ids[i]
+		parallel[i] = tasks.TaskFunc(func(e *tasks.Execution) {
+			party(
+				ctxt,
+				[]int{lightId},
+				a.palette,
+				minInterval,
+				maxInterval,
+				seed+int64(lightId),
+				e)
+		})
+	}
+	tasks.ParallelTasks(parallel...).Do(e)
+}
 
-	for _, id := range ids {
-		if globalLightProperties != nil {
-			if response, err := ctxt.Set(id, globalLightProperties); err != nil {
-				e.SetError(FixError(id, response, err))
+func (a *partyHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+// party changes the lights in ids together to random colors until e
+// ends. Each change fades over minInterval and lasts between minInterval
+// and maxInterval.
+func party(
+	ctxt Context,
+	ids []int,
+	palette []gohue.Color,
+	minInterval, maxInterval time.Duration,
+	seed int64,
+	e *tasks.Execution) {
+	r := rand.New(rand.NewSource(seed))
+	transitionTime := toTransitionTime(minInterval)
+	for {
+		cb := ColorBrightness{
+			Color: gohue.NewMaybeColor(palette[r.Intn(len(palette))]),
+			Brightness: maybe.NewUint8(uint8(
+				kPartyMinBrightness + r.Intn(256-kPartyMinBrightness))),
+		}
+		for _, id := range ids {
+			if e.IsEnded() {
+				return
 			}
-		} else {
-			if response, err := ctxt.Set(id, colorBrightnessToLightProperties(a[id])); err != nil {
+			if response, err := setColorBrightness(
+				ctxt, id, cb, transitionTime); err != nil {
 				e.SetError(FixError(id, response, err))
+				return
 			}
 		}
+		interval := minInterval + time.Duration(
+			r.Int63n(int64(maxInterval-minInterval)+1))
+		if !e.Sleep(interval) {
+			return
+		}
 	}
 }
 
-func (a StaticHueAction) UsedLights(lightSet lights.Set) lights.Set {
-	if _, isAll := a[0]; isAll {
-		return lightSet
+// AlertContext is a Context that can also use the alert effect of the hue
+// bridge.
+type AlertContext interface {
+	Context
+
+	// SetAlert sets the alert of a particular light. alert is SelectAlert
+	// or LongSelectAlert.
+	SetAlert(lightId int, alert string) (response []byte, err error)
+}
+
+// BlinkAction returns a HueAction that blinks the lights count times.
+// Each blink turns the lights on to color for onDur and then turns them
+// off for offDur. If count is positive and ctxt implements LightReader,
+// the returned HueAction restores the lights to how they were before the
+// blinking, even if its execution ends early. If count is 0 or less, the
+// returned HueAction blinks the lights until its execution ends.
+func BlinkAction(
+	color ColorBrightness, onDur, offDur time.Duration, count int) HueAction {
+	return &blinkHueAction{
+		color: color, onDur: onDur, offDur: offDur, count: count}
+}
+
+// AlertAction returns a HueAction that blinks the lights using the
+// bridge's alert effect. alert is SelectAlert or LongSelectAlert. The
+// bridge itself restores the lights when the alert finishes. If ctxt does
+// not implement AlertContext, the returned HueAction does fallback instead.
+func AlertAction(alert string, fallback HueAction) HueAction {
+	return &alertHueAction{alert: alert, fallback: fallback}
+}
+
+type blinkHueAction struct {
+	color  ColorBrightness
+	onDur  time.Duration
+	offDur time.Duration
+	count  int
+}
+
+func (a *blinkHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	if reader, ok := AsLightReader(ctxt); ok && a.count > 0 {
+		snapshot, err := Snapshot(reader, lightSet)
+		if err != nil {
+			e.SetError(err)
+			return
+		}
+		defer func() {
+			if err := Restore(ctxt, snapshot); err != nil {
+				e.SetError(err)
+			}
+		}()
 	}
-	usedLights := make(lights.Set, len(a))
-	for id := range a {
-		usedLights[id] = true
+	on := StaticHueAction{0: a.color}
+	off := StaticHueAction{0: {}}
+	for i := 0; a.count <= 0 || i < a.count; i++ {
+		on.Do(ctxt, lightSet, e)
+		if e.Error() != nil || !e.Sleep(a.onDur) {
+			return
+		}
+		off.Do(ctxt, lightSet, e)
+		if e.Error() != nil || !e.Sleep(a.offDur) {
+			return
+		}
 	}
-	return usedLights.Intersect(lightSet)
+}
+
+func (a *blinkHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+type alertHueAction struct {
+	alert    string
+	fallback HueAction
+}
+
+func (a *alertHueAction) Do(
+	ctxt Context, lightSet lights.Set, e *tasks.Execution) {
+	alertCtxt, ok := AsAlertContext(ctxt)
+	if !ok {
+		a.fallback.Do(ctxt, lightSet, e)
+		return
+	}
+	ids, ok := lightSet.Slice()
+	if !ok {
+		return
+	}
+	if len(ids) == 0 {
+		ids = []int{0}
+	}
+	for _, id := range ids {
+		if response, err := alertCtxt.SetAlert(id, a.alert); err != nil {
+			e.SetError(FixError(id, response, err))
+		}
+	}
+}
+
+func (a *alertHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
 }
 
 // NamedColors represents colors for lights by name read from persistent
@@ -296,24 +1903,51 @@ func FixError(lightId int, rawResponse []byte, err error) error {
 	return err
 }
 
-func colorBrightnessToLightProperties(
-	cb ColorBrightness) *gohue.LightProperties {
-	var transitionTime maybe.Uint16
-	return colorBrightnessToLightPropertiesWithTransition(
-		cb, transitionTime)
+func fixGroupError(rawResponse []byte, err error) error {
+	if len(rawResponse) > 0 {
+		return errors.New(string(rawResponse))
+	}
+	return err
 }
 
+// colorBrightnessToLightPropertiesWithTransition uses transitionTime
+// only if cb has no transition time of its own.
 func colorBrightnessToLightPropertiesWithTransition(
 	cb ColorBrightness,
 	transitionTime maybe.Uint16) *gohue.LightProperties {
-	if !cb.Color.Valid && !cb.Brightness.Valid {
+	if cb.TransitionTime.Valid {
+		transitionTime = cb.TransitionTime
+	}
+	if cb.IsOff() {
 		return &gohue.LightProperties{
 			On:             maybe.NewBool(false),
 			TransitionTime: transitionTime}
 	}
 	return &gohue.LightProperties{
-		C:              cb.Color,
+		C:              cb.xyColor(),
 		Bri:            cb.Brightness,
 		On:             maybe.NewBool(true),
 		TransitionTime: transitionTime}
 }
+
+// setColorBrightness sets a light to cb sending the color temperature
+// when cb has one and ctxt is a ColorTemperatureContext. If cb is not
+// reachable, setColorBrightness does nothing.
+func setColorBrightness(
+	ctxt Context,
+	lightId int,
+	cb ColorBrightness,
+	transitionTime maybe.Uint16) (response []byte, err error) {
+	if cb.Reachable.Valid && !cb.Reachable.Value {
+		return
+	}
+	properties := colorBrightnessToLightPropertiesWithTransition(
+		cb, transitionTime)
+	if ctCtxt, ok := AsColorTemperatureContext(ctxt); ok &&
+		cb.ColorTemperature.Valid && !cb.IsOff() {
+		properties.C = gohue.MaybeColor{}
+		return ctCtxt.SetWithColorTemperature(
+			lightId, properties, cb.ColorTemperature.Value)
+	}
+	return ctxt.Set(lightId, properties)
+}
@@ -1,17 +1,25 @@
 package ops_test
 
 import (
+	"bytes"
 	"github.com/keep94/gohue"
 	"github.com/keep94/marvin/lights"
 	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/ops/opstest"
 	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"log"
+	"math"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestStaticHueActionUsedLightsAll(t *testing.T) {
 	a := ops.StaticHueAction(map[int]ops.ColorBrightness{
-		0: {gohue.NewMaybeColor(gohue.Red), maybe.NewUint8(128)}})
+		0: {Color: gohue.NewMaybeColor(gohue.Red),
+			Brightness: maybe.NewUint8(128)}})
 	usedLights := a.UsedLights(lights.All)
 	if out := usedLights.String(); out != "All" {
 		t.Errorf("Expected All got %v", out)
@@ -26,9 +34,9 @@ func TestStaticHueActionUsedLightsSome(t *testing.T) {
 	someColor := gohue.NewMaybeColor(gohue.Red)
 	someBrightness := maybe.NewUint8(128)
 	a := ops.StaticHueAction(map[int]ops.ColorBrightness{
-		1: {someColor, someBrightness},
-		2: {someColor, someBrightness},
-		3: {someColor, someBrightness}})
+		1: {Color: someColor, Brightness: someBrightness},
+		2: {Color: someColor, Brightness: someBrightness},
+		3: {Color: someColor, Brightness: someBrightness}})
 	usedLights := a.UsedLights(lights.All)
 	if out := usedLights.String(); out != "1,2,3" {
 		t.Errorf("Expected 1,2,3 got %v", out)
@@ -59,7 +67,7 @@ func TestStaticHueActionDoAll(t *testing.T) {
 	someColor := gohue.NewMaybeColor(gohue.Red)
 	someBrightness := maybe.NewUint8(128)
 	a := ops.StaticHueAction(map[int]ops.ColorBrightness{
-		0: {someColor, someBrightness}})
+		0: {Color: someColor, Brightness: someBrightness}})
 	ctxt := make(contextForTesting)
 	a.Do(ctxt, lights.All, nil)
 	expected := contextForTesting{
@@ -84,7 +92,7 @@ func TestStaticHueActionDoAllOff(t *testing.T) {
 	var noColor gohue.MaybeColor
 	var noBrightness maybe.Uint8
 	a := ops.StaticHueAction(map[int]ops.ColorBrightness{
-		0: {noColor, noBrightness}})
+		0: {Color: noColor, Brightness: noBrightness}})
 	ctxt := make(contextForTesting)
 	a.Do(ctxt, lights.All, nil)
 	expected := contextForTesting{
@@ -105,13 +113,277 @@ func TestStaticHueActionDoAllOff(t *testing.T) {
 	}
 }
 
+func TestStaticHueActionDoOnOff(t *testing.T) {
+	someColor := gohue.NewMaybeColor(gohue.Red)
+	someBrightness := maybe.NewUint8(128)
+	a := ops.StaticHueAction(map[int]ops.ColorBrightness{
+		2: {Color: someColor,
+			Brightness: someBrightness, On: maybe.NewBool(false)},
+		4: {On: maybe.NewBool(true)},
+	})
+	ctxt := make(contextForTesting)
+	a.Do(ctxt, lights.New(2, 4), nil)
+	expected := contextForTesting{
+		2: {On: maybe.NewBool(false)},
+		4: {On: maybe.NewBool(true)},
+	}
+	if !reflect.DeepEqual(expected, ctxt) {
+		t.Errorf("Expected %v, got %v", expected, ctxt)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	red := gohue.NewMaybeColor(gohue.Red)
+	ctxt := &readerContextForTesting{
+		contextForTesting: contextForTesting{
+			1: {C: red, Bri: maybe.NewUint8(50), On: maybe.NewBool(true)},
+			2: {C: red, Bri: maybe.NewUint8(50), On: maybe.NewBool(false)},
+		},
+	}
+	snapshot, err := ops.Snapshot(ctxt, lights.New(1, 2))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := ops.LightColors{
+		1: {Color: red, Brightness: maybe.NewUint8(50), On: maybe.NewBool(true)},
+		2: {Color: red, Brightness: maybe.NewUint8(50), On: maybe.NewBool(false)},
+	}
+	if !reflect.DeepEqual(expected, snapshot) {
+		t.Errorf("Expected %v, got %v", expected, snapshot)
+	}
+
+	// Restoring leaves light 2 off
+	restored := make(contextForTesting)
+	ops.StaticHueAction(snapshot).Do(restored, lights.New(1, 2), nil)
+	expectedRestored := contextForTesting{
+		1: {C: red, Bri: maybe.NewUint8(50), On: maybe.NewBool(true)},
+		2: {On: maybe.NewBool(false)},
+	}
+	if !reflect.DeepEqual(expectedRestored, restored) {
+		t.Errorf("Expected %v, got %v", expectedRestored, restored)
+	}
+}
+
+func TestSnapshotReachability(t *testing.T) {
+	red := gohue.NewMaybeColor(gohue.Red)
+	ctxt := &reachabilityReaderForTesting{
+		readerContextForTesting: &readerContextForTesting{
+			contextForTesting: contextForTesting{
+				1: {C: red, Bri: maybe.NewUint8(50), On: maybe.NewBool(true)},
+				2: {C: red, Bri: maybe.NewUint8(70), On: maybe.NewBool(true)},
+			},
+		},
+		unreachable: lights.New(2),
+	}
+	snapshot, err := ops.Snapshot(ctxt, lights.New(1, 2))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := ops.LightColors{
+		1: {
+			Color:      red,
+			Brightness: maybe.NewUint8(50),
+			On:         maybe.NewBool(true),
+			Reachable:  maybe.NewBool(true),
+		},
+		2: {
+			Color:      red,
+			Brightness: maybe.NewUint8(70),
+			On:         maybe.NewBool(true),
+			Reachable:  maybe.NewBool(false),
+		},
+	}
+	if !reflect.DeepEqual(expected, snapshot) {
+		t.Errorf("Expected %v, got %v", expected, snapshot)
+	}
+	restored := make(contextForTesting)
+	ops.StaticHueAction(snapshot).Do(restored, lights.New(1, 2), nil)
+	expectedRestored := contextForTesting{
+		1: {C: red, Bri: maybe.NewUint8(50), On: maybe.NewBool(true)},
+	}
+	if !reflect.DeepEqual(expectedRestored, restored) {
+		t.Errorf("Expected %v, got %v", expectedRestored, restored)
+	}
+}
+
+func TestStaticHueActionDoColorTemperature(t *testing.T) {
+	a := ops.StaticHueAction{
+		2: {Brightness: maybe.NewUint8(200),
+			ColorTemperature: maybe.NewUint16(370)},
+		3: {Color: gohue.NewMaybeColor(gohue.Red),
+			ColorTemperature: maybe.NewUint16(153)},
+	}
+	ctxt := &colorTemperatureContextForTesting{
+		contextForTesting: make(contextForTesting)}
+	a.Do(ctxt, lights.New(2, 3), nil)
+	expected := contextForTesting{
+		2: {Bri: maybe.NewUint8(200), On: maybe.NewBool(true)},
+		3: {On: maybe.NewBool(true)},
+	}
+	if !reflect.DeepEqual(expected, ctxt.contextForTesting) {
+		t.Errorf("Expected %v, got %v", expected, ctxt.contextForTesting)
+	}
+	expectedMireds := map[int]uint16{2: 370, 3: 153}
+	if !reflect.DeepEqual(expectedMireds, ctxt.mireds) {
+		t.Errorf("Expected %v, got %v", expectedMireds, ctxt.mireds)
+	}
+
+	// Without color temperature support, color wins.
+	plainCtxt := make(contextForTesting)
+	a.Do(plainCtxt, lights.New(2, 3), nil)
+	expected = contextForTesting{
+		2: {
+			C:   gohue.NewMaybeColor(ops.ColorTemperatureToColor(370)),
+			Bri: maybe.NewUint8(200),
+			On:  maybe.NewBool(true),
+		},
+		3: {C: gohue.NewMaybeColor(gohue.Red), On: maybe.NewBool(true)},
+	}
+	if !reflect.DeepEqual(expected, plainCtxt) {
+		t.Errorf("Expected %v, got %v", expected, plainCtxt)
+	}
+}
+
+func TestColorTemperatureToColor(t *testing.T) {
+	// 2700K
+	verifyColor(t, 0.4599, 0.4106, ops.ColorTemperatureToColor(370))
+	// 6500K
+	verifyColor(t, 0.3135, 0.3237, ops.ColorTemperatureToColor(154))
+	// Hotter than 25000K
+	verifyColor(t, 0.2524, 0.2522, ops.ColorTemperatureToColor(0))
+}
+
+func TestKelvinToColor(t *testing.T) {
+	verifyColor(t, 0.4593, 0.4107, ops.KelvinToColor(2700))
+	verifyColor(t, 0.3221, 0.3318, ops.KelvinToColor(6000))
+	if ops.KelvinToColor(1000) != ops.KelvinToColor(ops.MinKelvin) {
+		t.Error("Expected color temperature to be clamped")
+	}
+	if ops.ColorTemperatureToColor(250) != ops.KelvinToColor(4000) {
+		t.Error("Expected mireds and kelvin to give the same color")
+	}
+}
+
+func TestSnapshotColorTemperature(t *testing.T) {
+	ctxt := &readerContextForTesting{
+		contextForTesting: contextForTesting{
+			1: {Bri: maybe.NewUint8(50), On: maybe.NewBool(true)},
+		},
+	}
+	ctReader := &colorTemperatureReaderForTesting{
+		readerContextForTesting: ctxt, mireds: maybe.NewUint16(250)}
+	snapshot, err := ops.Snapshot(ctReader, lights.New(1))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := ops.LightColors{
+		1: {
+			Brightness:       maybe.NewUint8(50),
+			On:               maybe.NewBool(true),
+			ColorTemperature: maybe.NewUint16(250),
+		},
+	}
+	if !reflect.DeepEqual(expected, snapshot) {
+		t.Errorf("Expected %v, got %v", expected, snapshot)
+	}
+}
+
+func verifyColor(t *testing.T, x, y float64, c gohue.Color) {
+	t.Helper()
+	if math.Abs(c.X()-x) > 0.001 || math.Abs(c.Y()-y) > 0.001 {
+		t.Errorf("Expected (%v, %v), got (%v, %v)", x, y, c.X(), c.Y())
+	}
+}
+
+func TestStaticHueActionDoGroup(t *testing.T) {
+	red := ops.ColorBrightness{
+		Color: gohue.NewMaybeColor(gohue.Red), Brightness: maybe.NewUint8(9)}
+	ctxt := &groupContextForTesting{
+		contextForTesting: make(contextForTesting),
+		GroupMap:          ops.GroupMap{1: lights.New(2, 3), 4: lights.New(5)},
+	}
+	ops.StaticHueAction{0: red}.Do(ctxt, lights.New(2, 3), nil)
+	ops.StaticHueAction{2: red, 3: red}.Do(ctxt, lights.New(2, 3), nil)
+	expectedGroups := []int{1, 1}
+	if !reflect.DeepEqual(expectedGroups, ctxt.groups) {
+		t.Errorf("Expected %v, got %v", expectedGroups, ctxt.groups)
+	}
+	if len(ctxt.contextForTesting) != 0 {
+		t.Errorf("Expected no lights set, got %v", ctxt.contextForTesting)
+	}
+
+	// No matching group
+	ops.StaticHueAction{0: red}.Do(ctxt, lights.New(2, 5), nil)
+
+	// Lights don't all match
+	ops.StaticHueAction{
+		2: red, 3: {On: maybe.NewBool(false)}}.Do(ctxt, lights.New(2, 3), nil)
+	if !reflect.DeepEqual(expectedGroups, ctxt.groups) {
+		t.Errorf("Expected %v, got %v", expectedGroups, ctxt.groups)
+	}
+	if out := len(ctxt.contextForTesting); out != 3 {
+		t.Errorf("Expected 3 lights set, got %d", out)
+	}
+}
+
+func TestGroupMap(t *testing.T) {
+	groups := ops.GroupMap{
+		7: lights.New(1, 2), 3: lights.New(2, 1), 5: lights.New(4)}
+	if groupId, ok := groups.GroupFor(lights.New(1, 2)); !ok || groupId != 3 {
+		t.Errorf("Expected group 3, got %d %v", groupId, ok)
+	}
+	if _, ok := groups.GroupFor(lights.New(1)); ok {
+		t.Error("Expected no group")
+	}
+	if _, ok := groups.GroupFor(lights.All); ok {
+		t.Error("Expected no group for all lights")
+	}
+}
+
+func TestStaticHueActionDoTransitionTime(t *testing.T) {
+	red := gohue.NewMaybeColor(gohue.Red)
+	a := ops.StaticHueAction{
+		2: {Color: red, TransitionTime: maybe.NewUint16(0)},
+		3: {Color: red},
+	}
+	ctxt := make(contextForTesting)
+	a.Do(ops.WithTransitionTime(ctxt, 5*time.Second), lights.New(2, 3), nil)
+	expected := contextForTesting{
+		2: {C: red, On: maybe.NewBool(true), TransitionTime: maybe.NewUint16(0)},
+		3: {C: red, On: maybe.NewBool(true), TransitionTime: maybe.NewUint16(50)},
+	}
+	if !reflect.DeepEqual(expected, ctxt) {
+		t.Errorf("Expected %v, got %v", expected, ctxt)
+	}
+}
+
+func TestStaticHueActionDoTransitionTimeGroup(t *testing.T) {
+	red := gohue.NewMaybeColor(gohue.Red)
+	a := ops.StaticHueAction{2: {Color: red}, 3: {Color: red}}
+	ctxt := &groupContextForTesting{
+		contextForTesting: make(contextForTesting),
+		GroupMap:          ops.GroupMap{1: lights.New(2, 3)},
+	}
+	a.Do(ops.WithTransitionTime(ctxt, 5*time.Second), lights.New(2, 3), nil)
+	if !reflect.DeepEqual([]int{1}, ctxt.groups) {
+		t.Fatalf("Expected group 1 to be set, got %v", ctxt.groups)
+	}
+	expected := gohue.LightProperties{
+		C: red, On: maybe.NewBool(true), TransitionTime: maybe.NewUint16(50)}
+	if out := ctxt.groupProperties[0]; !reflect.DeepEqual(expected, out) {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+}
+
 func TestStaticHueActionDoSome(t *testing.T) {
 	var noColor gohue.MaybeColor
 	var noBrightness maybe.Uint8
 	a := ops.StaticHueAction(map[int]ops.ColorBrightness{
-		2: {noColor, noBrightness},
-		4: {gohue.NewMaybeColor(gohue.Green), maybe.NewUint8(192)},
-		5: {gohue.NewMaybeColor(gohue.Blue), maybe.NewUint8(64)}})
+		2: {Color: noColor, Brightness: noBrightness},
+		4: {Color: gohue.NewMaybeColor(gohue.Green),
+			Brightness: maybe.NewUint8(192)},
+		5: {Color: gohue.NewMaybeColor(gohue.Blue),
+			Brightness: maybe.NewUint8(64)}})
 	ctxt := make(contextForTesting)
 	a.Do(ctxt, lights.New(2, 5), nil)
 	expected := contextForTesting{
@@ -211,6 +483,852 @@ func TestBlinkZero(t *testing.T) {
 	}
 }
 
+func TestScaleBrightness(t *testing.T) {
+	someColor := gohue.NewMaybeColor(gohue.Red)
+	a := ops.ScaleBrightness(
+		ops.StaticHueAction(map[int]ops.ColorBrightness{
+			2: {Color: someColor, Brightness: maybe.NewUint8(200)},
+			3: {Color: someColor, Brightness: maybe.NewUint8(1)},
+			4: {Color: someColor, Brightness: maybe.Uint8{}},
+		}),
+		func() float64 { return 0.25 })
+	ctxt := make(contextForTesting)
+	a.Do(ctxt, lights.New(2, 3, 4), nil)
+	expected := contextForTesting{
+		2: {C: someColor, Bri: maybe.NewUint8(50), On: maybe.NewBool(true)},
+		3: {C: someColor, Bri: maybe.NewUint8(1), On: maybe.NewBool(true)},
+		4: {C: someColor, On: maybe.NewBool(true)},
+	}
+	if !reflect.DeepEqual(expected, ctxt) {
+		t.Errorf("Expected %v, got %v", expected, ctxt)
+	}
+	if out := a.UsedLights(lights.New(2, 5)); !reflect.DeepEqual(
+		lights.New(2), out) {
+		t.Errorf("Expected %v, got %v", lights.New(2), out)
+	}
+}
+
+func TestScaleBrightnessGroup(t *testing.T) {
+	red := gohue.NewMaybeColor(gohue.Red)
+	a := ops.ScaleBrightness(
+		ops.StaticHueAction{
+			2: {Color: red, Brightness: maybe.NewUint8(200)},
+			3: {Color: red, Brightness: maybe.NewUint8(200)},
+		},
+		func() float64 { return 0.5 })
+	ctxt := &groupContextForTesting{
+		contextForTesting: make(contextForTesting),
+		GroupMap:          ops.GroupMap{1: lights.New(2, 3)},
+	}
+	a.Do(ctxt, lights.New(2, 3), nil)
+	if !reflect.DeepEqual([]int{1}, ctxt.groups) {
+		t.Fatalf("Expected group 1 to be set, got %v", ctxt.groups)
+	}
+	expected := gohue.LightProperties{
+		C: red, Bri: maybe.NewUint8(100), On: maybe.NewBool(true)}
+	if out := ctxt.groupProperties[0]; !reflect.DeepEqual(expected, out) {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+}
+
+func TestScaleBrightnessOptionalInterfaces(t *testing.T) {
+	ctxt := &effectContextForTesting{contextForTesting: make(contextForTesting)}
+	var effectSupported, groupSupported bool
+	a := ops.ScaleBrightness(
+		hueActionFunc(func(
+			ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+			_, effectSupported = ops.AsEffectContext(ctxt)
+			_, groupSupported = ops.AsGroupContext(ctxt)
+		}),
+		func() float64 { return 0.5 })
+	a.Do(ctxt, lights.New(2), nil)
+	if !effectSupported {
+		t.Error("Expected scaled context to be an EffectContext")
+	}
+	if groupSupported {
+		t.Error("Expected scaled context not to be a GroupContext")
+	}
+}
+
+func TestTransitionHueAction(t *testing.T) {
+	red := gohue.NewMaybeColor(gohue.Red)
+	blue := gohue.NewMaybeColor(gohue.Blue)
+	a := ops.TransitionHueAction(
+		ops.LightColors{
+			1: {Color: red, Brightness: maybe.NewUint8(100)},
+			2: {Color: blue, Brightness: maybe.NewUint8(100)},
+		},
+		ops.LightColors{
+			1: {Color: blue, Brightness: maybe.NewUint8(200)},
+		},
+		2*time.Second)
+	var history []int
+	ctxt := &recordingContext{
+		contextForTesting: make(contextForTesting), history: &history}
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(ctxt, lights.All, e)
+	}), clock); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := contextForTesting{
+		1: {
+			C:              blue,
+			Bri:            maybe.NewUint8(200),
+			On:             maybe.NewBool(true),
+			TransitionTime: maybe.NewUint16(5),
+		},
+		2: {On: maybe.NewBool(false), TransitionTime: maybe.NewUint16(5)},
+	}
+	if !reflect.DeepEqual(expected, ctxt.contextForTesting) {
+		t.Errorf("Expected %v, got %v", expected, ctxt.contextForTesting)
+	}
+	expectedHistory := []int{1, 2, 1, 2, 1, 2, 1, 2}
+	if !reflect.DeepEqual(expectedHistory, history) {
+		t.Errorf("Expected %v, got %v", expectedHistory, history)
+	}
+	if out := a.UsedLights(lights.New(2, 3)); !reflect.DeepEqual(
+		lights.New(2), out) {
+		t.Errorf("Expected %v, got %v", lights.New(2), out)
+	}
+}
+
+func TestTransitionHueActionMidway(t *testing.T) {
+	a := ops.TransitionHueAction(
+		ops.LightColors{0: {}},
+		ops.LightColors{
+			0: {Color: gohue.NewMaybeColor(gohue.White),
+				Brightness: maybe.NewUint8(201)}},
+		2*time.Second)
+	var history []int
+	ctxt := &recordingContext{
+		contextForTesting: make(contextForTesting), history: &history}
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var midway gohue.LightProperties
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		ctxt.onSet = func(count int) {
+			if count == 2 {
+				midway = *ctxt.contextForTesting[0]
+			}
+		}
+		a.Do(ctxt, lights.All, e)
+	}), clock); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := gohue.LightProperties{
+		C:              gohue.NewMaybeColor(gohue.White),
+		Bri:            maybe.NewUint8(101),
+		On:             maybe.NewBool(true),
+		TransitionTime: maybe.NewUint16(5),
+	}
+	if !reflect.DeepEqual(expected, midway) {
+		t.Errorf("Expected %v, got %v", expected, midway)
+	}
+	if len(history) != 4 {
+		t.Errorf("Expected 4 commands, got %d", len(history))
+	}
+}
+
+func TestColorLoopAction(t *testing.T) {
+	a := ops.ColorLoopAction(
+		[]gohue.Color{gohue.Red, gohue.Blue}, 150, 10*time.Second, 0)
+	var history []int
+	ctxt := &recordingContext{
+		contextForTesting: make(contextForTesting), history: &history}
+	var colors []gohue.Color
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		ctxt.onSet = func(count int) {
+			colors = append(colors, ctxt.contextForTesting[2].C.Color)
+			if count == 3 {
+				e.End()
+			}
+		}
+		a.Do(ctxt, lights.New(2), e)
+	}), clock); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := []gohue.Color{gohue.Red, gohue.Blue, gohue.Red}
+	if !reflect.DeepEqual(expected, colors) {
+		t.Errorf("Expected %v, got %v", expected, colors)
+	}
+	if out := ctxt.contextForTesting[2].Bri; out != maybe.NewUint8(150) {
+		t.Errorf("Expected 150, got %v", out)
+	}
+}
+
+func TestNativeColorLoopAction(t *testing.T) {
+	fallback := ops.StaticHueAction{
+		0: {Color: gohue.NewMaybeColor(gohue.Red),
+			Brightness: maybe.NewUint8(100)}}
+	a := ops.NativeColorLoopAction(200, fallback)
+
+	// Without effect support, we get the fallback
+	ctxt := make(contextForTesting)
+	a.Do(ctxt, lights.New(1), nil)
+	expected := contextForTesting{
+		1: {
+			C:   gohue.NewMaybeColor(gohue.Red),
+			Bri: maybe.NewUint8(100),
+			On:  maybe.NewBool(true),
+		},
+	}
+	if !reflect.DeepEqual(expected, ctxt) {
+		t.Errorf("Expected %v, got %v", expected, ctxt)
+	}
+
+	effectCtxt := &effectContextForTesting{
+		contextForTesting: make(contextForTesting)}
+	if err := tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		effectCtxt.onSetEffect = func(effect string) {
+			if effect == ops.ColorLoopEffect {
+				e.End()
+			}
+		}
+		a.Do(effectCtxt, lights.New(1), e)
+	})); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	ops.Finalize(ops.ScaleBrightness(a, func() float64 { return 1.0 }),
+		effectCtxt, lights.New(1))
+	expected = contextForTesting{
+		1: {Bri: maybe.NewUint8(200), On: maybe.NewBool(true)},
+	}
+	if !reflect.DeepEqual(expected, effectCtxt.contextForTesting) {
+		t.Errorf("Expected %v, got %v", expected, effectCtxt.contextForTesting)
+	}
+	expectedEffects := []string{ops.ColorLoopEffect, ops.NoEffect}
+	if !reflect.DeepEqual(expectedEffects, effectCtxt.effects) {
+		t.Errorf("Expected %v, got %v", expectedEffects, effectCtxt.effects)
+	}
+}
+
+func TestBlinkAction(t *testing.T) {
+	red := gohue.NewMaybeColor(gohue.Red)
+	blue := gohue.NewMaybeColor(gohue.Blue)
+	a := ops.BlinkAction(
+		ops.ColorBrightness{Color: red, Brightness: maybe.NewUint8(255)},
+		time.Second,
+		time.Second,
+		2)
+	ctxt := &readerContextForTesting{
+		contextForTesting: contextForTesting{
+			1: {C: blue, Bri: maybe.NewUint8(50), On: maybe.NewBool(true)},
+		},
+	}
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(ctxt, lights.New(1), e)
+	}), clock); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedOns := []bool{true, false, true, false, true}
+	if !reflect.DeepEqual(expectedOns, ctxt.ons) {
+		t.Errorf("Expected %v, got %v", expectedOns, ctxt.ons)
+	}
+	expected := contextForTesting{
+		1: {
+			C:              blue,
+			Bri:            maybe.NewUint8(50),
+			On:             maybe.NewBool(true),
+			TransitionTime: maybe.NewUint16(4),
+		},
+	}
+	if !reflect.DeepEqual(expected, ctxt.contextForTesting) {
+		t.Errorf("Expected %v, got %v", expected, ctxt.contextForTesting)
+	}
+}
+
+func TestAlertAction(t *testing.T) {
+	fallback := ops.StaticHueAction{
+		0: {Color: gohue.NewMaybeColor(gohue.Red),
+			Brightness: maybe.NewUint8(100)}}
+	a := ops.AlertAction(ops.LongSelectAlert, fallback)
+	ctxt := &alertContextForTesting{contextForTesting: make(contextForTesting)}
+	a.Do(ctxt, lights.New(2, 3), nil)
+	expected := map[int]string{2: ops.LongSelectAlert, 3: ops.LongSelectAlert}
+	if !reflect.DeepEqual(expected, ctxt.alerts) {
+		t.Errorf("Expected %v, got %v", expected, ctxt.alerts)
+	}
+	if len(ctxt.contextForTesting) != 0 {
+		t.Errorf("Expected no lights set, got %v", ctxt.contextForTesting)
+	}
+	plainCtxt := make(contextForTesting)
+	a.Do(plainCtxt, lights.New(2), nil)
+	if len(plainCtxt) != 1 {
+		t.Errorf("Expected fallback to set light 2, got %v", plainCtxt)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &tasks.ClockForTesting{Current: start}
+	var times []time.Duration
+	ctxt := &timedContextForTesting{
+		contextForTesting: make(contextForTesting),
+		clock:             clock,
+		start:             start,
+		times:             &times,
+	}
+	limited := ops.RateLimitedWithClock(ctxt, 2.0, 2, clock)
+	properties := &gohue.LightProperties{On: maybe.NewBool(true)}
+	for i := 0; i < 4; i++ {
+		limited.Set(i+1, properties)
+	}
+	clock.Current = clock.Current.Add(10 * time.Second)
+	limited.Set(5, properties)
+	expected := []time.Duration{
+		0, 0, 500 * time.Millisecond, time.Second, 11 * time.Second}
+	if !reflect.DeepEqual(expected, times) {
+		t.Errorf("Expected %v, got %v", expected, times)
+	}
+	if out := len(ctxt.contextForTesting); out != 5 {
+		t.Errorf("Expected 5 lights set, got %d", out)
+	}
+}
+
+func TestRateLimitedOptionalInterfaces(t *testing.T) {
+	clock := &tasks.ClockForTesting{
+		Current: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	groupCtxt := &groupContextForTesting{
+		contextForTesting: make(contextForTesting),
+		GroupMap:          ops.GroupMap{1: lights.New(1, 2)},
+	}
+	limited := ops.RateLimitedWithClock(groupCtxt, 1.0, 1, clock)
+	groupLimited, ok := ops.AsGroupContext(limited)
+	if !ok {
+		t.Fatal("Expected rate limited context to be a GroupContext")
+	}
+	if groupId, ok := groupLimited.GroupFor(lights.New(1, 2)); !ok ||
+		groupId != 1 {
+		t.Errorf("Expected group 1, got %d", groupId)
+	}
+	start := clock.Current
+	groupLimited.SetGroup(1, &gohue.LightProperties{On: maybe.NewBool(true)})
+	groupLimited.SetGroup(1, &gohue.LightProperties{On: maybe.NewBool(true)})
+	if out := clock.Current.Sub(start); out != time.Second {
+		t.Errorf("Expected group commands to be rate limited, got %v", out)
+	}
+	if !reflect.DeepEqual([]int{1, 1}, groupCtxt.groups) {
+		t.Errorf("Expected groups [1 1], got %v", groupCtxt.groups)
+	}
+	if _, ok := ops.AsLightReader(limited); ok {
+		t.Error("Expected rate limited context not to be a LightReader")
+	}
+	if _, ok := ops.AsEffectContext(limited); ok {
+		t.Error("Expected rate limited context not to be an EffectContext")
+	}
+	reader := &readerContextForTesting{contextForTesting: make(contextForTesting)}
+	reader.Set(1, &gohue.LightProperties{Bri: maybe.NewUint8(20)})
+	limitedReader, ok := ops.AsLightReader(
+		ops.RateLimitedWithClock(reader, 1.0, 1, clock))
+	if !ok {
+		t.Fatal("Expected rate limited context to be a LightReader")
+	}
+	properties, _, err := limitedReader.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if properties.Bri != maybe.NewUint8(20) {
+		t.Errorf("Expected brightness 20, got %v", properties.Bri)
+	}
+}
+
+func TestRateLimitedEnded(t *testing.T) {
+	ctxt := make(contextForTesting)
+	limited := ops.RateLimitedWithClock(
+		ctxt, 1.0, 1, stuckClockForTesting{})
+	e := tasks.Start(tasks.TaskFunc(func(e *tasks.Execution) {
+		running := ops.WithExecution(limited, e)
+		running.Set(1, &gohue.LightProperties{On: maybe.NewBool(true)})
+		e.End()
+		// Without the execution, this command would wait forever.
+		running.Set(2, &gohue.LightProperties{On: maybe.NewBool(true)})
+	}))
+	select {
+	case <-e.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected command to stop waiting once execution ended")
+	}
+	if len(ctxt) != 2 {
+		t.Errorf("Expected 2 lights set, got %v", ctxt)
+	}
+}
+
+func TestRateLimitedCorrelationId(t *testing.T) {
+	var buffer bytes.Buffer
+	clock := &tasks.ClockForTesting{
+		Current: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limited := ops.RateLimitedWithClock(
+		ops.Logged(make(contextForTesting), log.New(&buffer, "", 0)),
+		1.0,
+		1,
+		clock)
+	ops.WithCorrelationId(limited, "task-7").Set(
+		2, &gohue.LightProperties{On: maybe.NewBool(false)})
+	expected := "SET: [task-7] light 2: on=false: OK\n"
+	if out := buffer.String(); out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestDimAction(t *testing.T) {
+	clock := &tasks.ClockForTesting{
+		Current: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bridge := opstest.NewBridgeWithClock(clock, 1, 2, 3)
+	bridge.Set(1, &gohue.LightProperties{
+		C:   gohue.NewMaybeColor(gohue.Red),
+		Bri: maybe.NewUint8(200),
+		On:  maybe.NewBool(true)})
+	bridge.Set(2, &gohue.LightProperties{
+		C:   gohue.NewMaybeColor(gohue.Blue),
+		Bri: maybe.NewUint8(100),
+		On:  maybe.NewBool(true)})
+	bridge.ClearCommands()
+	a := ops.DimAction(20, 2*time.Second)
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(bridge, lights.New(1, 2, 3), e)
+	}), clock); err != nil {
+		t.Fatal(err)
+	}
+	var brightnesses []uint8
+	for _, command := range bridge.Commands() {
+		if command.Properties.C.Valid || command.Properties.On.Valid {
+			t.Errorf("Expected brightness only command, got %v", command)
+		}
+		if out := command.Properties.TransitionTime.Value; out != 5 {
+			t.Errorf("Expected transition time 5, got %d", out)
+		}
+		brightnesses = append(brightnesses, command.Properties.Bri.Value)
+	}
+	expected := []uint8{155, 80, 110, 60, 65, 40, 20, 20}
+	if !reflect.DeepEqual(expected, brightnesses) {
+		t.Errorf("Expected %v, got %v", expected, brightnesses)
+	}
+	light1, _ := bridge.Light(1)
+	verifyColor(t, gohue.Red.X(), gohue.Red.Y(), light1.C.Color)
+	light3, _ := bridge.Light(3)
+	if light3.On.Value || light3.Bri.Valid {
+		t.Errorf("Expected light 3 to stay off, got %v", light3)
+	}
+}
+
+func TestDimActionNoReader(t *testing.T) {
+	ctxt := make(contextForTesting)
+	a := ops.DimAction(20, 2*time.Second)
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(ctxt, lights.All, e)
+	}), &tasks.ClockForTesting{Current: time.Unix(1000000, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	expected := contextForTesting{0: {
+		Bri: maybe.NewUint8(20), TransitionTime: maybe.NewUint16(20)}}
+	if !reflect.DeepEqual(expected, ctxt) {
+		t.Errorf("Expected %v, got %v", expected, ctxt)
+	}
+}
+
+func TestPartyAction(t *testing.T) {
+	clock := &tasks.ClockForTesting{
+		Current: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bridge := opstest.NewBridgeWithClock(clock, 1, 2)
+	palette := []gohue.Color{gohue.Red, gohue.Green, gohue.Blue}
+	a := ops.PartyAction(palette, time.Second, 3*time.Second, false)
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(&limitedContextForTesting{Context: bridge, e: e, limit: 20},
+			lights.New(1, 2),
+			e)
+	}), clock); err != nil {
+		t.Fatal(err)
+	}
+	commands := bridge.Commands()
+	if len(commands) != 20 {
+		t.Fatalf("Expected 20 commands, got %d", len(commands))
+	}
+	for i := 0; i < len(commands); i += 2 {
+		first, second := commands[i], commands[i+1]
+		if first.LightId != 1 || second.LightId != 2 {
+			t.Errorf("Expected lights 1 and 2, got %d and %d",
+				first.LightId, second.LightId)
+		}
+		if !reflect.DeepEqual(first.Properties, second.Properties) {
+			t.Errorf("Expected same settings, got %v and %v",
+				first.Properties, second.Properties)
+		}
+		verifyPartySettings(t, palette, first.Properties)
+		if i == 0 {
+			continue
+		}
+		interval := first.Time.Sub(commands[i-2].Time)
+		if interval < time.Second || interval > 3*time.Second {
+			t.Errorf("Expected interval between 1s and 3s, got %v", interval)
+		}
+	}
+}
+
+func TestPartyActionPerLight(t *testing.T) {
+	bridge := opstest.NewBridge(1, 2)
+	palette := []gohue.Color{gohue.Red, gohue.Green, gohue.Blue}
+	a := ops.PartyAction(palette, 0, 0, true)
+	e := tasks.Start(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(bridge, lights.New(1, 2), e)
+	}))
+	time.Sleep(500 * time.Millisecond)
+	e.End()
+	<-e.Done()
+	if err := e.Error(); err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[int]int)
+	for _, command := range bridge.Commands() {
+		counts[command.LightId]++
+		verifyPartySettings(t, palette, command.Properties)
+	}
+	if counts[1] < 2 || counts[2] < 2 || len(counts) != 2 {
+		t.Errorf("Expected lights 1 and 2 to change on their own, got %v",
+			counts)
+	}
+	// 2 lights means no more than 1 command per light every 200ms.
+	if counts[1] > 4 || counts[2] > 4 {
+		t.Errorf("Expected rate limiting, got %v", counts)
+	}
+}
+
+func TestPartyActionPerLightAll(t *testing.T) {
+	bridge := opstest.NewBridge(1, 2)
+	palette := []gohue.Color{gohue.Red, gohue.Green, gohue.Blue}
+	a := ops.PartyAction(palette, 0, 0, true)
+	e := tasks.Start(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(bridge, lights.All, e)
+	}))
+	time.Sleep(500 * time.Millisecond)
+	e.End()
+	<-e.Done()
+	if err := e.Error(); err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[int]int)
+	for _, command := range bridge.Commands() {
+		counts[command.LightId]++
+	}
+	if counts[1] < 2 || counts[2] < 2 || len(counts) != 2 {
+		t.Errorf("Expected lights 1 and 2 to change on their own, got %v",
+			counts)
+	}
+}
+
+func verifyPartySettings(
+	t *testing.T, palette []gohue.Color, properties gohue.LightProperties) {
+	t.Helper()
+	found := false
+	for _, color := range palette {
+		if properties.C.Valid && properties.C.Color == color {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected color from palette, got %v", properties.C)
+	}
+	if properties.Bri.Value < 64 {
+		t.Errorf("Expected brightness of at least 64, got %d",
+			properties.Bri.Value)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	red := ops.ColorBrightness{
+		Color: gohue.NewMaybeColor(gohue.Red), Brightness: maybe.NewUint8(200)}
+	dim := ops.ColorBrightness{Brightness: maybe.NewUint8(20)}
+	base := &ops.HueTask{
+		Id:          5,
+		HueAction:   ops.StaticHueAction{1: red, 2: red},
+		Description: "Red",
+	}
+	overlay := &ops.HueTask{
+		Id:          6,
+		HueAction:   ops.StaticHueAction{2: dim, 3: dim},
+		Description: "Dim accents",
+	}
+	h := ops.Overlay(base, overlay)
+	if h.Id != 5 || h.Description != "Red + Dim accents" {
+		t.Errorf("Unexpected task %d %s", h.Id, h.Description)
+	}
+	if out := h.UsedLights(lights.All); !reflect.DeepEqual(
+		lights.New(1, 2, 3), out) {
+		t.Errorf("Expected %v, got %v", lights.New(1, 2, 3), out)
+	}
+	ctxt := make(contextForTesting)
+	if err := tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		h.Do(ctxt, lights.All, e)
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if out := ctxt[1].Bri.Value; out != 200 {
+		t.Errorf("Expected light 1 at 200, got %d", out)
+	}
+	for _, lightId := range []int{2, 3} {
+		if out := ctxt[lightId].Bri.Value; out != 20 {
+			t.Errorf("Expected light %d at 20, got %d", lightId, out)
+		}
+	}
+}
+
+func TestLogged(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := log.New(&buffer, "", 0)
+	ctxt := make(contextForTesting)
+	logged := ops.Logged(ctxt, logger)
+	logged.Set(2, &gohue.LightProperties{On: maybe.NewBool(false)})
+	ops.WithCorrelationId(logged, "task-7").Set(3, &gohue.LightProperties{
+		C:              gohue.NewMaybeColor(gohue.NewColor(0.25, 0.5)),
+		Bri:            maybe.NewUint8(200),
+		TransitionTime: maybe.NewUint16(4),
+	})
+	expected := "SET: [-] light 2: on=false: OK\n" +
+		"SET: [task-7] light 3: color=(0.2500, 0.5000) bri=200 " +
+		"transition=400ms: OK\n"
+	if out := buffer.String(); out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+	if len(ctxt) != 2 {
+		t.Errorf("Expected 2 lights set, got %v", ctxt)
+	}
+	if out := ops.WithCorrelationId(ctxt, "task-7"); !reflect.DeepEqual(
+		ctxt, out) {
+		t.Error("Expected non Correlator context to be unchanged.")
+	}
+}
+
+func TestLoggedOptionalInterfaces(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := log.New(&buffer, "", 0)
+	ctxt := &effectContextForTesting{contextForTesting: make(contextForTesting)}
+	logged := ops.Logged(ctxt, logger)
+	effectCtxt, ok := ops.AsEffectContext(logged)
+	if !ok {
+		t.Fatal("Expected logged context to be an EffectContext")
+	}
+	effectCtxt.SetEffect(2, ops.ColorLoopEffect)
+	if _, ok := ops.AsGroupContext(logged); ok {
+		t.Error("Expected logged context not to be a GroupContext")
+	}
+	if _, ok := ops.AsLightReader(logged); ok {
+		t.Error("Expected logged context not to be a LightReader")
+	}
+	expected := "SET: [-] light 2: effect=colorloop: OK\n"
+	if out := buffer.String(); out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+	if !reflect.DeepEqual([]string{ops.ColorLoopEffect}, ctxt.effects) {
+		t.Errorf("Expected colorloop effect, got %v", ctxt.effects)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	red := ops.ColorBrightness{
+		Color: gohue.NewMaybeColor(gohue.Red), Brightness: maybe.NewUint8(9)}
+	blue := ops.ColorBrightness{
+		Color: gohue.NewMaybeColor(gohue.Blue), Brightness: maybe.NewUint8(9)}
+	a := ops.Sequence(
+		ops.StaticHueAction{2: red}, ops.StaticHueAction{3: blue})
+	if out := a.UsedLights(lights.All); !reflect.DeepEqual(
+		lights.New(2, 3), out) {
+		t.Errorf("Expected %v, got %v", lights.New(2, 3), out)
+	}
+	var history []int
+	ctxt := &recordingContext{
+		contextForTesting: make(contextForTesting), history: &history}
+	if err := tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(ctxt, lights.All, e)
+	})); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedHistory := []int{2, 3}
+	if !reflect.DeepEqual(expectedHistory, history) {
+		t.Errorf("Expected %v, got %v", expectedHistory, history)
+	}
+
+	// Stops when interrupted
+	history = nil
+	a = ops.Sequence(
+		ops.StaticHueAction{2: red},
+		endingHueAction{},
+		ops.StaticHueAction{3: blue})
+	if err := tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(ctxt, lights.All, e)
+	})); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedHistory = []int{2}
+	if !reflect.DeepEqual(expectedHistory, history) {
+		t.Errorf("Expected %v, got %v", expectedHistory, history)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	red := ops.ColorBrightness{
+		Color: gohue.NewMaybeColor(gohue.Red), Brightness: maybe.NewUint8(9)}
+	blue := ops.ColorBrightness{
+		Color: gohue.NewMaybeColor(gohue.Blue), Brightness: maybe.NewUint8(9)}
+	a := ops.Parallel(
+		ops.StaticHueAction{2: red}, ops.StaticHueAction{3: blue, 4: blue})
+	if out := a.UsedLights(lights.New(3, 2, 5)); !reflect.DeepEqual(
+		lights.New(2, 3), out) {
+		t.Errorf("Expected %v, got %v", lights.New(2, 3), out)
+	}
+	ctxt := &lockedContextForTesting{
+		contextForTesting: make(contextForTesting)}
+	if err := tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(ctxt, lights.All, e)
+	})); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := contextForTesting{
+		2: {C: red.Color, Bri: red.Brightness, On: maybe.NewBool(true)},
+		3: {C: blue.Color, Bri: blue.Brightness, On: maybe.NewBool(true)},
+		4: {C: blue.Color, Bri: blue.Brightness, On: maybe.NewBool(true)},
+	}
+	if !reflect.DeepEqual(expected, ctxt.contextForTesting) {
+		t.Errorf("Expected %v, got %v", expected, ctxt.contextForTesting)
+	}
+}
+
+func TestTemporarily(t *testing.T) {
+	red := gohue.NewMaybeColor(gohue.Red)
+	blue := gohue.NewMaybeColor(gohue.Blue)
+	ctxt := &readerContextForTesting{
+		contextForTesting: contextForTesting{
+			1: {C: blue, Bri: maybe.NewUint8(50), On: maybe.NewBool(true)},
+			2: {C: blue, Bri: maybe.NewUint8(50), On: maybe.NewBool(false)},
+		},
+	}
+	a := ops.Temporarily(
+		ops.StaticHueAction{
+			0: {Color: red, Brightness: maybe.NewUint8(255)}},
+		10*time.Second,
+		ctxt)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &tasks.ClockForTesting{Current: start}
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		a.Do(ctxt, lights.New(1, 2), e)
+	}), clock); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	// Both lights turn on before being put back
+	expectedOns := []bool{true, true}
+	if len(ctxt.ons) != 4 || !reflect.DeepEqual(expectedOns, ctxt.ons[:2]) {
+		t.Errorf("Expected %v then 2 more, got %v", expectedOns, ctxt.ons)
+	}
+	expected := contextForTesting{
+		1: {
+			C:              blue,
+			Bri:            maybe.NewUint8(50),
+			On:             maybe.NewBool(true),
+			TransitionTime: maybe.NewUint16(4),
+		},
+		2: {On: maybe.NewBool(false), TransitionTime: maybe.NewUint16(4)},
+	}
+	if !reflect.DeepEqual(expected, ctxt.contextForTesting) {
+		t.Errorf("Expected %v, got %v", expected, ctxt.contextForTesting)
+	}
+	if out := clock.Current.Sub(start); out != 10*time.Second {
+		t.Errorf("Expected 10s, got %v", out)
+	}
+}
+
+func TestBindRoles(t *testing.T) {
+	roles := ops.BindRoles(lights.New(7, 3, 5, 9), 3)
+	expected := ops.Roles{
+		ops.PrimaryRole: lights.New(3),
+		ops.AccentRole:  lights.New(5),
+		ops.AmbientRole: lights.New(7, 9),
+	}
+	if !reflect.DeepEqual(expected, roles) {
+		t.Errorf("Expected %v, got %v", expected, roles)
+	}
+	roles = ops.BindRoles(lights.New(4), 3)
+	expected = ops.Roles{ops.PrimaryRole: lights.New(4)}
+	if !reflect.DeepEqual(expected, roles) {
+		t.Errorf("Expected %v, got %v", expected, roles)
+	}
+	roles = ops.BindRoles(lights.All, 3)
+	expected = ops.Roles{ops.PrimaryRole: lights.All}
+	if !reflect.DeepEqual(expected, roles) {
+		t.Errorf("Expected %v, got %v", expected, roles)
+	}
+}
+
+func TestRoleColors(t *testing.T) {
+	red := ops.ColorBrightness{
+		Color: gohue.NewMaybeColor(gohue.Red), Brightness: maybe.NewUint8(9)}
+	blue := ops.ColorBrightness{
+		Color: gohue.NewMaybeColor(gohue.Blue), Brightness: maybe.NewUint8(9)}
+	a := ops.RoleColors{
+		ops.PrimaryRole: red, ops.AmbientRole: blue}.AsHueAction()
+	ctxt := make(contextForTesting)
+	a.Do(ctxt, lights.New(1, 2, 3, 4), nil)
+	expected := contextForTesting{
+		1: {C: red.Color, Bri: red.Brightness, On: maybe.NewBool(true)},
+		3: {C: blue.Color, Bri: blue.Brightness, On: maybe.NewBool(true)},
+		4: {C: blue.Color, Bri: blue.Brightness, On: maybe.NewBool(true)},
+	}
+	if !reflect.DeepEqual(expected, ctxt) {
+		t.Errorf("Expected %v, got %v", expected, ctxt)
+	}
+}
+
+func TestCurves(t *testing.T) {
+	if out := ops.LinearCurve(10.0, 110.0, 0.25); out != 35.0 {
+		t.Errorf("Expected 35, got %v", out)
+	}
+	if out := ops.PerceptualCurve(0.0, 255.0, 0.0); out != 0.0 {
+		t.Errorf("Expected 0, got %v", out)
+	}
+	if out := ops.PerceptualCurve(0.0, 255.0, 1.0); math.Abs(out-255.0) > 1e-9 {
+		t.Errorf("Expected 255, got %v", out)
+	}
+	if out := ops.PerceptualCurve(0.0, 255.0, 0.5); math.Abs(out-55.5) > 0.1 {
+		t.Errorf("Expected 55.5, got %v", out)
+	}
+	// Winding down mirrors waking up
+	if out := ops.PerceptualCurve(255.0, 0.0, 0.5); math.Abs(out-55.5) > 0.1 {
+		t.Errorf("Expected 55.5, got %v", out)
+	}
+}
+
+func TestRampAction(t *testing.T) {
+	white := gohue.NewMaybeColor(gohue.White)
+	task := ops.NewRampHueTask(
+		3,
+		"Wake up",
+		ops.ColorBrightness{Color: white, Brightness: maybe.NewUint8(0)},
+		ops.ColorBrightness{Color: white, Brightness: maybe.NewUint8(255)},
+		2*time.Second,
+		ops.PerceptualCurve)
+	var history []int
+	ctxt := &recordingContext{
+		contextForTesting: make(contextForTesting), history: &history}
+	var brightnesses []uint8
+	ctxt.onSet = func(count int) {
+		brightnesses = append(brightnesses, ctxt.contextForTesting[0].Bri.Value)
+	}
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		task.Do(ctxt, lights.All, e)
+	}), clock); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expected := []uint8{12, 55, 135, 255}
+	if !reflect.DeepEqual(expected, brightnesses) {
+		t.Errorf("Expected %v, got %v", expected, brightnesses)
+	}
+}
+
 type contextForTesting map[int]*gohue.LightProperties
 
 func (c contextForTesting) Set(
@@ -220,3 +1338,237 @@ func (c contextForTesting) Set(
 	c[lightId] = &propertiesCopy
 	return
 }
+
+func TestRepeatNext(t *testing.T) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skipf("No time zone data: %v", err)
+	}
+	// Daylight saving time starts March 9, 2014
+	start := time.Date(2014, 3, 8, 21, 30, 0, 0, loc)
+	r := ops.Repeat{Every: 24 * time.Hour, Count: 2}
+	next, r := r.Next(start)
+	expected := time.Date(2014, 3, 9, 21, 30, 0, 0, loc)
+	if !next.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, next)
+	}
+	if r != (ops.Repeat{Every: 24 * time.Hour, Count: 1}) {
+		t.Errorf("Expected 1 run left, got %v", r)
+	}
+	next, r = r.Next(next)
+	expected = time.Date(2014, 3, 10, 21, 30, 0, 0, loc)
+	if !next.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, next)
+	}
+	if !r.IsZero() {
+		t.Errorf("Expected no runs left, got %v", r)
+	}
+}
+
+func TestRepeatNextHours(t *testing.T) {
+	start := time.Unix(1400000000, 0)
+	r := ops.Repeat{Every: 90 * time.Minute, Count: 3}
+	next, r := r.Next(start)
+	if out := next.Sub(start); out != 90*time.Minute {
+		t.Errorf("Expected 90 minutes, got %v", out)
+	}
+	if r.Count != 2 {
+		t.Errorf("Expected 2, got %d", r.Count)
+	}
+}
+
+type recordingContext struct {
+	contextForTesting
+	history *[]int
+	onSet   func(count int)
+}
+
+func (c *recordingContext) Set(
+	lightId int,
+	properties *gohue.LightProperties) (response []byte, err error) {
+	*c.history = append(*c.history, lightId)
+	response, err = c.contextForTesting.Set(lightId, properties)
+	if c.onSet != nil {
+		c.onSet(len(*c.history))
+	}
+	return
+}
+
+type effectContextForTesting struct {
+	contextForTesting
+	effects     []string
+	onSetEffect func(effect string)
+}
+
+func (c *effectContextForTesting) SetEffect(
+	lightId int, effect string) (response []byte, err error) {
+	c.effects = append(c.effects, effect)
+	if c.onSetEffect != nil {
+		c.onSetEffect(effect)
+	}
+	return
+}
+
+type readerContextForTesting struct {
+	contextForTesting
+	ons []bool
+}
+
+func (c *readerContextForTesting) Set(
+	lightId int,
+	properties *gohue.LightProperties) (response []byte, err error) {
+	c.ons = append(c.ons, properties.On.Value)
+	return c.contextForTesting.Set(lightId, properties)
+}
+
+func (c *readerContextForTesting) Get(lightId int) (
+	*gohue.LightProperties, []byte, error) {
+	propertiesCopy := *c.contextForTesting[lightId]
+	return &propertiesCopy, nil, nil
+}
+
+type alertContextForTesting struct {
+	contextForTesting
+	alerts map[int]string
+}
+
+func (c *alertContextForTesting) SetAlert(
+	lightId int, alert string) (response []byte, err error) {
+	if c.alerts == nil {
+		c.alerts = make(map[int]string)
+	}
+	c.alerts[lightId] = alert
+	return
+}
+
+type colorTemperatureContextForTesting struct {
+	contextForTesting
+	mireds map[int]uint16
+}
+
+func (c *colorTemperatureContextForTesting) SetWithColorTemperature(
+	lightId int, properties *gohue.LightProperties, mireds uint16) (
+	response []byte, err error) {
+	if c.mireds == nil {
+		c.mireds = make(map[int]uint16)
+	}
+	c.mireds[lightId] = mireds
+	return c.contextForTesting.Set(lightId, properties)
+}
+
+type colorTemperatureReaderForTesting struct {
+	*readerContextForTesting
+	mireds maybe.Uint16
+}
+
+func (c *colorTemperatureReaderForTesting) GetColorTemperature(
+	lightId int) (maybe.Uint16, []byte, error) {
+	return c.mireds, nil, nil
+}
+
+type groupContextForTesting struct {
+	contextForTesting
+	ops.GroupMap
+	groups          []int
+	groupProperties []gohue.LightProperties
+}
+
+func (c *groupContextForTesting) SetGroup(
+	groupId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	c.groups = append(c.groups, groupId)
+	c.groupProperties = append(c.groupProperties, *properties)
+	return
+}
+
+type reachabilityReaderForTesting struct {
+	*readerContextForTesting
+	unreachable lights.Set
+}
+
+func (c *reachabilityReaderForTesting) IsReachable(
+	lightId int) (bool, []byte, error) {
+	return !c.unreachable[lightId], nil, nil
+}
+
+type timedContextForTesting struct {
+	contextForTesting
+	clock *tasks.ClockForTesting
+	start time.Time
+	times *[]time.Duration
+}
+
+func (c *timedContextForTesting) Set(
+	lightId int,
+	properties *gohue.LightProperties) (response []byte, err error) {
+	*c.times = append(*c.times, c.clock.Current.Sub(c.start))
+	return c.contextForTesting.Set(lightId, properties)
+}
+
+// stuckClockForTesting never finishes waiting.
+type stuckClockForTesting struct {
+}
+
+func (c stuckClockForTesting) Now() time.Time {
+	return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (c stuckClockForTesting) After(d time.Duration) <-chan time.Time {
+	return nil
+}
+
+type endingHueAction struct {
+}
+
+func (a endingHueAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	e.End()
+}
+
+func (a endingHueAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lights.None
+}
+
+type hueActionFunc func(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution)
+
+func (f hueActionFunc) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+	f(ctxt, lightSet, e)
+}
+
+func (f hueActionFunc) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+type lockedContextForTesting struct {
+	contextForTesting
+	mutex sync.Mutex
+}
+
+func (c *lockedContextForTesting) Set(
+	lightId int,
+	properties *gohue.LightProperties) (response []byte, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.contextForTesting.Set(lightId, properties)
+}
+
+// limitedContextForTesting ends e once it has sent limit commands.
+type limitedContextForTesting struct {
+	ops.Context
+	e     *tasks.Execution
+	limit int
+	count int
+}
+
+func (c *limitedContextForTesting) Set(
+	lightId int,
+	properties *gohue.LightProperties) (response []byte, err error) {
+	response, err = c.Context.Set(lightId, properties)
+	c.count++
+	if c.count == c.limit {
+		c.e.End()
+	}
+	return
+}
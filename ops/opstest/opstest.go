@@ -0,0 +1,205 @@
+// Package opstest provides a fake hue bridge for testing code that uses
+// the ops package.
+package opstest
+
+import (
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	_ ops.Context     = (*Bridge)(nil)
+	_ ops.LightReader = (*Bridge)(nil)
+	_ ops.LightLister = (*Bridge)(nil)
+)
+
+// Command is one command that a Bridge received.
+type Command struct {
+	// The light id. 0 means all lights.
+	LightId int
+
+	// What the command set.
+	Properties gohue.LightProperties
+
+	// When the bridge received the command.
+	Time time.Time
+}
+
+// Bridge is a fake hue bridge that implements ops.Context and
+// ops.LightReader. Bridge records each command it receives and keeps the
+// state of each light. Bridge instances are safe to use with multiple
+// goroutines.
+type Bridge struct {
+	clock    tasks.Clock
+	mutex    sync.Mutex
+	lights   map[int]*gohue.LightProperties
+	commands []Command
+	latency  time.Duration
+	errs     map[int]error
+}
+
+// NewBridge returns a new Bridge with lights lightIds all turned off.
+func NewBridge(lightIds ...int) *Bridge {
+	return NewBridgeWithClock(tasks.SystemClock(), lightIds...)
+}
+
+// NewBridgeWithClock works like NewBridge except that the returned
+// Bridge uses clock to timestamp commands and to wait out latency.
+func NewBridgeWithClock(clock tasks.Clock, lightIds ...int) *Bridge {
+	result := &Bridge{
+		clock:  clock,
+		lights: make(map[int]*gohue.LightProperties, len(lightIds)),
+		errs:   make(map[int]error),
+	}
+	for _, id := range lightIds {
+		result.lights[id] = &gohue.LightProperties{
+			On: maybe.NewBool(false)}
+	}
+	return result
+}
+
+// SetLatency makes each Set and Get wait d before returning.
+func (b *Bridge) SetLatency(d time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.latency = d
+}
+
+// SetError makes Set and Get return err for lightId. Setting light 0
+// fails if any light fails. A nil err clears the error.
+func (b *Bridge) SetError(lightId int, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		delete(b.errs, lightId)
+	} else {
+		b.errs[lightId] = err
+	}
+}
+
+// Set updates the state of a light and records the command. Light 0 means
+// all lights. Set returns gohue.NoSuchResourceError for unknown lights.
+// A failed command changes nothing, but Set still records it.
+func (b *Bridge) Set(lightId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	b.wait()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.commands = append(b.commands, Command{
+		LightId:    lightId,
+		Properties: *properties,
+		Time:       b.clock.Now(),
+	})
+	if err = b.checkError(lightId); err != nil {
+		return
+	}
+	if lightId == 0 {
+		for _, light := range b.lights {
+			update(light, properties)
+		}
+		return
+	}
+	update(b.lights[lightId], properties)
+	return
+}
+
+// Get returns the state of a light. Get returns
+// gohue.NoSuchResourceError for unknown lights.
+func (b *Bridge) Get(lightId int) (
+	properties *gohue.LightProperties, response []byte, err error) {
+	b.wait()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err = b.checkError(lightId); err != nil {
+		return
+	}
+	result := *b.lights[lightId]
+	return &result, nil, nil
+}
+
+// Light returns the current state of a light. ok is false if there is no
+// such light.
+func (b *Bridge) Light(lightId int) (
+	properties gohue.LightProperties, ok bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	light, ok := b.lights[lightId]
+	if !ok {
+		return
+	}
+	return *light, true
+}
+
+// LightIds returns the ids of the lights in ascending order.
+func (b *Bridge) LightIds() []int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	result := make([]int, 0, len(b.lights))
+	for id := range b.lights {
+		result = append(result, id)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// ListLights returns the ids of the lights in ascending order. It never
+// returns an error.
+func (b *Bridge) ListLights() (ids []int, response []byte, err error) {
+	return b.LightIds(), nil, nil
+}
+
+// Commands returns the commands received so far oldest first.
+func (b *Bridge) Commands() []Command {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	result := make([]Command, len(b.commands))
+	copy(result, b.commands)
+	return result
+}
+
+// ClearCommands forgets the commands received so far.
+func (b *Bridge) ClearCommands() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.commands = nil
+}
+
+func (b *Bridge) wait() {
+	b.mutex.Lock()
+	latency := b.latency
+	b.mutex.Unlock()
+	if latency > 0 {
+		<-b.clock.After(latency)
+	}
+}
+
+// checkError must be called with the mutex held.
+func (b *Bridge) checkError(lightId int) error {
+	if lightId == 0 {
+		for _, err := range b.errs {
+			return err
+		}
+		return nil
+	}
+	if _, ok := b.lights[lightId]; !ok {
+		return gohue.NoSuchResourceError
+	}
+	return b.errs[lightId]
+}
+
+func update(light, properties *gohue.LightProperties) {
+	if properties.C.Valid {
+		light.C = properties.C
+	}
+	if properties.Bri.Valid {
+		light.Bri = properties.Bri
+	}
+	if properties.On.Valid {
+		light.On = properties.On
+	}
+}
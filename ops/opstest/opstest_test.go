@@ -0,0 +1,104 @@
+package opstest_test
+
+import (
+	"errors"
+	"github.com/keep94/gohue"
+	"github.com/keep94/gohue/actions"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/ops/opstest"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBridge(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &tasks.ClockForTesting{Current: start}
+	bridge := opstest.NewBridgeWithClock(clock, 1, 2, 3)
+	bridge.SetLatency(time.Second)
+	red := gohue.NewMaybeColor(gohue.Red)
+	ops.StaticHueAction{
+		0: {Color: red, Brightness: maybe.NewUint8(100)},
+	}.Do(bridge, lights.New(1, 3), nil)
+	expectedCommands := []opstest.Command{
+		{
+			LightId: 1,
+			Properties: gohue.LightProperties{
+				C: red, Bri: maybe.NewUint8(100), On: maybe.NewBool(true)},
+			Time: start.Add(time.Second),
+		},
+		{
+			LightId: 3,
+			Properties: gohue.LightProperties{
+				C: red, Bri: maybe.NewUint8(100), On: maybe.NewBool(true)},
+			Time: start.Add(2 * time.Second),
+		},
+	}
+	if out := bridge.Commands(); !reflect.DeepEqual(expectedCommands, out) {
+		t.Errorf("Expected %v, got %v", expectedCommands, out)
+	}
+	snapshot, err := ops.Snapshot(bridge, lights.New(1, 2))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	expectedSnapshot := ops.LightColors{
+		1: {
+			Color:      red,
+			Brightness: maybe.NewUint8(100),
+			On:         maybe.NewBool(true),
+		},
+		2: {On: maybe.NewBool(false)},
+	}
+	if !reflect.DeepEqual(expectedSnapshot, snapshot) {
+		t.Errorf("Expected %v, got %v", expectedSnapshot, snapshot)
+	}
+	bridge.ClearCommands()
+	if out := bridge.Commands(); len(out) != 0 {
+		t.Errorf("Expected no commands, got %v", out)
+	}
+
+	// All lights
+	bridge.SetLatency(0)
+	ops.StaticHueAction{0: {}}.Do(bridge, lights.All, nil)
+	for _, id := range bridge.LightIds() {
+		if light, _ := bridge.Light(id); light.On.Value {
+			t.Errorf("Expected light %d off", id)
+		}
+	}
+}
+
+func TestBridgeErrors(t *testing.T) {
+	bridge := opstest.NewBridge(1, 2)
+	someError := errors.New("opstest:Unreachable")
+	bridge.SetError(2, someError)
+	red := ops.StaticHueAction{0: {
+		Color: gohue.NewMaybeColor(gohue.Red), Brightness: maybe.NewUint8(1)}}
+	err := tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		red.Do(bridge, lights.New(1, 2), e)
+	}))
+	if err != someError {
+		t.Errorf("Expected %v, got %v", someError, err)
+	}
+	if light, _ := bridge.Light(1); !light.On.Value {
+		t.Error("Expected light 1 on")
+	}
+	if light, _ := bridge.Light(2); light.On.Value {
+		t.Error("Expected light 2 still off")
+	}
+	if out := len(bridge.Commands()); out != 2 {
+		t.Errorf("Expected 2 commands, got %d", out)
+	}
+	bridge.SetError(2, nil)
+	err = tasks.Run(tasks.TaskFunc(func(e *tasks.Execution) {
+		red.Do(bridge, lights.New(2, 5), e)
+	}))
+	if _, ok := err.(*actions.NoSuchLightIdError); !ok {
+		t.Errorf("Expected no such light error, got %v", err)
+	}
+	if _, ok := bridge.Light(5); ok {
+		t.Error("Expected no light 5")
+	}
+}
@@ -0,0 +1,101 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The application part of the device type Pair registers with the bridge.
+const kPairAppName = "marvin"
+
+// How often Pair asks the bridge for an API username.
+const kPairPollInterval = time.Second
+
+// The bridge's error type meaning its link button has not been pressed.
+const kLinkButtonNotPressed = 101
+
+var (
+	// Pair returns ErrLinkButtonNotPressed if no one pressed the link
+	// button on the bridge in time.
+	ErrLinkButtonNotPressed = errors.New("ops: Link button not pressed.")
+)
+
+// Pair registers with the hue bridge at bridgeIP and returns the API
+// username that the bridge issues. deviceName identifies this installation
+// of marvin to the bridge such as "living room pi". Someone must press the
+// link button on the bridge while Pair runs. Pair asks the bridge once a
+// second until it issues a username or until ctx is done in which case
+// Pair returns ErrLinkButtonNotPressed.
+func Pair(ctx context.Context, bridgeIP, deviceName string) (
+	string, error) {
+	body, err := json.Marshal(
+		map[string]string{"devicetype": kPairAppName + "#" + deviceName})
+	if err != nil {
+		return "", err
+	}
+	pairUrl := "http://" + bridgeIP + "/api"
+	for {
+		username, err := requestUsername(ctx, pairUrl, body)
+		if err != ErrLinkButtonNotPressed {
+			return username, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", ErrLinkButtonNotPressed
+		case <-time.After(kPairPollInterval):
+		}
+	}
+}
+
+// requestUsername makes one request for an API username. It returns
+// ErrLinkButtonNotPressed if the link button has not been pressed.
+func requestUsername(
+	ctx context.Context, pairUrl string, body []byte) (string, error) {
+	request, err := http.NewRequest("POST", pairUrl, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ErrLinkButtonNotPressed
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(fmt.Sprintf(
+			"ops:Got status %d pairing with %s", resp.StatusCode, pairUrl))
+	}
+	var results []struct {
+		Success *struct {
+			Username string `json:"username"`
+		} `json:"success"`
+		Error *struct {
+			Type        int    `json:"type"`
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return "", err
+	}
+	for _, result := range results {
+		if result.Success != nil && result.Success.Username != "" {
+			return result.Success.Username, nil
+		}
+		if result.Error != nil {
+			if result.Error.Type == kLinkButtonNotPressed {
+				return "", ErrLinkButtonNotPressed
+			}
+			return "", errors.New(fmt.Sprintf(
+				"ops:Pairing failed: %s", result.Error.Description))
+		}
+	}
+	return "", errors.New("ops:Pairing failed: Empty response from bridge")
+}
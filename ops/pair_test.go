@@ -0,0 +1,79 @@
+package ops_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/keep94/marvin/ops"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPair(t *testing.T) {
+	requestCount := 0
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if r.Method != "POST" || r.URL.Path != "/api" ||
+				body["devicetype"] != "marvin#living room" {
+				t.Errorf("Unexpected request %s %s %v", r.Method, r.URL, body)
+			}
+			requestCount++
+			if requestCount == 1 {
+				w.Write([]byte(`[{"error":{"type":101,"address":"",` +
+					`"description":"link button not pressed"}}]`))
+				return
+			}
+			w.Write([]byte(`[{"success":{"username":"abc123"}}]`))
+		}))
+	defer server.Close()
+	username, err := ops.Pair(
+		context.Background(),
+		strings.TrimPrefix(server.URL, "http://"),
+		"living room")
+	if err != nil {
+		t.Fatalf("Got error pairing: %v", err)
+	}
+	if username != "abc123" {
+		t.Errorf("Expected abc123, got %s", username)
+	}
+	if requestCount != 2 {
+		t.Errorf("Expected 2 requests, got %d", requestCount)
+	}
+}
+
+func TestPairButtonNotPressed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"error":{"type":101,"address":"",` +
+				`"description":"link button not pressed"}}]`))
+		}))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := ops.Pair(
+		ctx, strings.TrimPrefix(server.URL, "http://"), "living room")
+	if err != ops.ErrLinkButtonNotPressed {
+		t.Errorf("Expected ErrLinkButtonNotPressed, got %v", err)
+	}
+}
+
+func TestPairError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"error":{"type":7,"address":"/devicetype",` +
+				`"description":"invalid value"}}]`))
+		}))
+	defer server.Close()
+	_, err := ops.Pair(
+		context.Background(),
+		strings.TrimPrefix(server.URL, "http://"),
+		"living room")
+	if err == nil || err == ops.ErrLinkButtonNotPressed {
+		t.Errorf("Expected pairing error, got %v", err)
+	}
+}
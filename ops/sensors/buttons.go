@@ -0,0 +1,153 @@
+package sensors
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/tasks"
+	"strconv"
+	"time"
+)
+
+// PressType tells how a button was pressed.
+type PressType int
+
+const (
+	// The button was just pressed.
+	InitialPress PressType = iota
+
+	// The button is being held down.
+	Hold
+
+	// The button was released after a short press.
+	ShortRelease
+
+	// The button was released after being held down.
+	LongRelease
+)
+
+// Tap switch button event codes for buttons 1 through 4.
+var kTapSwitchCodes = map[int]int{34: 1, 16: 2, 17: 3, 18: 4}
+
+// ParseButtonEvent converts a button event code from a dimmer switch
+// such as 1002 or a tap switch such as 34 into the button number and the
+// press type. Tap switches report only an InitialPress. ok is false if
+// code is not a button event code.
+func ParseButtonEvent(code int) (button int, press PressType, ok bool) {
+	if button, ok := kTapSwitchCodes[code]; ok {
+		return button, InitialPress, true
+	}
+	button = code / 1000
+	press = PressType(code % 1000)
+	if button < 1 || press < InitialPress || press > LongRelease {
+		return 0, 0, false
+	}
+	return button, press, true
+}
+
+// Button identifies one way to press one button on one switch.
+type Button struct {
+	// The hue bridge sensor id of the switch
+	SensorId int
+
+	// The button number starting at 1
+	Button int
+
+	// How the button is pressed
+	Press PressType
+}
+
+// Executor starts hue tasks interrupting any running tasks using the
+// same lights. utils.MultiExecutor implements Executor.
+type Executor interface {
+	Start(h *ops.HueTask, lightSet lights.Set) *tasks.Execution
+}
+
+type buttonBinding struct {
+	task     *ops.HueTask
+	lightSet lights.Set
+	toggle   bool
+}
+
+// ButtonTrigger starts and stops hue tasks when buttons on dimmer
+// switches and tap switches are pressed. Bind buttons before passing a
+// ButtonTrigger to NewWatcher.
+type ButtonTrigger struct {
+	executor   Executor
+	bindings   map[Button]buttonBinding
+	executions map[Button]*tasks.Execution
+}
+
+// NewButtonTrigger returns a ButtonTrigger that starts tasks with
+// executor.
+func NewButtonTrigger(executor Executor) *ButtonTrigger {
+	return &ButtonTrigger{
+		executor:   executor,
+		bindings:   make(map[Button]buttonBinding),
+		executions: make(map[Button]*tasks.Execution),
+	}
+}
+
+// Bind makes button start task on lightSet.
+func (b *ButtonTrigger) Bind(
+	button Button, task *ops.HueTask, lightSet lights.Set) {
+	b.bindings[button] = buttonBinding{task: task, lightSet: lightSet}
+}
+
+// BindToggle makes button start task on lightSet or stop task if button
+// started it and it is still running.
+func (b *ButtonTrigger) BindToggle(
+	button Button, task *ops.HueTask, lightSet lights.Set) {
+	b.bindings[button] = buttonBinding{
+		task: task, lightSet: lightSet, toggle: true}
+}
+
+// BindStop makes button stop all the running tasks that this instance
+// started.
+func (b *ButtonTrigger) BindStop(button Button) {
+	b.bindings[button] = buttonBinding{}
+}
+
+func (b *ButtonTrigger) Handle(event *huedb.SensorEvent, now time.Time) {
+	if event.Type != huedb.ButtonEvent {
+		return
+	}
+	code, err := strconv.Atoi(event.Value)
+	if err != nil {
+		return
+	}
+	number, press, ok := ParseButtonEvent(code)
+	if !ok {
+		return
+	}
+	button := Button{SensorId: event.SensorId, Button: number, Press: press}
+	binding, ok := b.bindings[button]
+	if !ok {
+		return
+	}
+	if binding.task == nil {
+		for pressed, e := range b.executions {
+			e.End()
+			delete(b.executions, pressed)
+		}
+		return
+	}
+	if e := b.executions[button]; e != nil && !e.IsDone() && binding.toggle {
+		e.End()
+		delete(b.executions, button)
+		return
+	}
+	if e := b.executor.Start(binding.task, binding.lightSet); e != nil {
+		b.executions[button] = e
+	} else {
+		delete(b.executions, button)
+	}
+}
+
+func (b *ButtonTrigger) Tick(now time.Time) {
+	for button, e := range b.executions {
+		if e.IsDone() {
+			delete(b.executions, button)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package sensors_test
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/ops/sensors"
+	"testing"
+	"time"
+)
+
+const kSwitchId = 7
+
+func TestParseButtonEvent(t *testing.T) {
+	verifyButtonEvent(t, 1000, 1, sensors.InitialPress)
+	verifyButtonEvent(t, 2001, 2, sensors.Hold)
+	verifyButtonEvent(t, 3002, 3, sensors.ShortRelease)
+	verifyButtonEvent(t, 4003, 4, sensors.LongRelease)
+	verifyButtonEvent(t, 34, 1, sensors.InitialPress)
+	verifyButtonEvent(t, 18, 4, sensors.InitialPress)
+	for _, code := range []int{0, 5, 1004, -1002} {
+		if _, _, ok := sensors.ParseButtonEvent(code); ok {
+			t.Errorf("Expected %d to be invalid", code)
+		}
+	}
+}
+
+func TestButtonTrigger(t *testing.T) {
+	executor := &recordingStarter{}
+	trigger := sensors.NewButtonTrigger(executor)
+	onButton := sensors.Button{
+		SensorId: kSwitchId, Button: 1, Press: sensors.ShortRelease}
+	toggleButton := sensors.Button{
+		SensorId: kSwitchId, Button: 2, Press: sensors.ShortRelease}
+	offButton := sensors.Button{
+		SensorId: kSwitchId, Button: 4, Press: sensors.ShortRelease}
+	trigger.Bind(onButton, &ops.HueTask{Id: 1}, lights.All)
+	trigger.BindToggle(toggleButton, &ops.HueTask{Id: 2}, lights.New(1))
+	trigger.BindStop(offButton)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	// Unbound press does nothing
+	pressButton(trigger, kSwitchId, "1000", now)
+	pressButton(trigger, kSwitchId+1, "1002", now)
+	if len(executor.executions) != 0 {
+		t.Fatalf("Expected no tasks started, got %d", len(executor.executions))
+	}
+
+	pressButton(trigger, kSwitchId, "1002", now)
+	pressButton(trigger, kSwitchId, "2002", now)
+	if len(executor.executions) != 2 {
+		t.Fatalf("Expected 2 tasks started, got %d", len(executor.executions))
+	}
+
+	// Pressing toggle button again stops its task
+	pressButton(trigger, kSwitchId, "2002", now)
+	if len(executor.executions) != 2 {
+		t.Fatalf("Expected 2 tasks started, got %d", len(executor.executions))
+	}
+	<-executor.executions[1].Done()
+	if executor.executions[0].IsEnded() {
+		t.Error("Expected first task to still be running.")
+	}
+
+	// Pressing toggle button a third time starts its task again
+	pressButton(trigger, kSwitchId, "2002", now)
+	if len(executor.executions) != 3 {
+		t.Fatalf("Expected 3 tasks started, got %d", len(executor.executions))
+	}
+
+	// Off button stops everything
+	pressButton(trigger, kSwitchId, "4002", now)
+	<-executor.executions[0].Done()
+	<-executor.executions[2].Done()
+}
+
+func pressButton(
+	trigger sensors.Trigger, sensorId int, code string, now time.Time) {
+	trigger.Handle(
+		&huedb.SensorEvent{
+			SensorId: sensorId,
+			Type:     huedb.ButtonEvent,
+			Value:    code,
+			Time:     now,
+		},
+		now)
+	trigger.Tick(now)
+}
+
+func verifyButtonEvent(
+	t *testing.T, code, button int, press sensors.PressType) {
+	t.Helper()
+	actualButton, actualPress, ok := sensors.ParseButtonEvent(code)
+	if !ok || actualButton != button || actualPress != press {
+		t.Errorf(
+			"For %d expected (%d, %d), got (%d, %d, %v)",
+			code, button, press, actualButton, actualPress, ok)
+	}
+}
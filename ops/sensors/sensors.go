@@ -0,0 +1,219 @@
+// Package sensors watches the sensors on the hue bridge such as motion
+// sensors and starts hue tasks when they report events.
+package sensors
+
+import (
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// State is the state of one sensor.
+type State struct {
+	// Presence is true if a motion sensor sees motion. Presence has no
+	// value for sensors that are not motion sensors.
+	Presence maybe.Bool
+
+	// ButtonEvent is the code of the last button event such as 1002. 0
+	// means no button event.
+	ButtonEvent int
+
+	// When the sensor last changed state.
+	LastUpdated time.Time
+}
+
+// Reader reads the state of the sensors on the hue bridge.
+type Reader interface {
+	// Sensors returns the state of each sensor by sensor id.
+	Sensors() (map[int]State, error)
+}
+
+// Starter starts hue tasks. utils.MultiExecutor implements Starter.
+type Starter interface {
+	// MaybeStart starts h on lightSet unless doing so would interrupt
+	// running tasks. MaybeStart returns nil if it did not start h.
+	MaybeStart(h *ops.HueTask, lightSet lights.Set) *tasks.Execution
+}
+
+// Trigger reacts to sensor events.
+type Trigger interface {
+	// Handle handles one sensor event that happened at now.
+	Handle(event *huedb.SensorEvent, now time.Time)
+
+	// Tick is called once per poll after all the events of that poll
+	// have been handled. Triggers use it to time out.
+	Tick(now time.Time)
+}
+
+// Watcher is a task that polls the sensors on the hue bridge, turns
+// changes in their state into sensor events, logs the events, and passes
+// them to triggers. Use utils.TaskToScheduledTask to run a Watcher in the
+// background.
+type Watcher struct {
+	reader   Reader
+	interval time.Duration
+	store    huedb.AddSensorEventRunner
+	triggers []Trigger
+}
+
+// NewWatcher returns a Watcher that polls reader every interval and
+// passes the events it finds to triggers. If store is not nil, the
+// Watcher logs each event to store.
+func NewWatcher(
+	reader Reader,
+	interval time.Duration,
+	store huedb.AddSensorEventRunner,
+	triggers ...Trigger) *Watcher {
+	return &Watcher{
+		reader:   reader,
+		interval: interval,
+		store:    store,
+		triggers: triggers,
+	}
+}
+
+// Do polls the sensors until e ends. Do reports errors reading the
+// sensors or logging events through e but keeps polling.
+func (w *Watcher) Do(e *tasks.Execution) {
+	var previous map[int]State
+	for {
+		current, err := w.reader.Sensors()
+		if err != nil {
+			e.SetError(err)
+		} else {
+			now := e.Now()
+			if previous != nil {
+				w.dispatch(e, Events(previous, current, now), now)
+			}
+			previous = current
+			for _, trigger := range w.triggers {
+				trigger.Tick(now)
+			}
+		}
+		if !e.Sleep(w.interval) {
+			return
+		}
+	}
+}
+
+func (w *Watcher) dispatch(
+	e *tasks.Execution, events []*huedb.SensorEvent, now time.Time) {
+	for _, event := range events {
+		if w.store != nil {
+			if err := w.store.AddSensorEvent(nil, event); err != nil {
+				e.SetError(err)
+			}
+		}
+		for _, trigger := range w.triggers {
+			trigger.Handle(event, now)
+		}
+	}
+}
+
+// Events returns the sensor events that take the sensors from previous to
+// current in ascending order by sensor id. now is the time of the events.
+func Events(previous, current map[int]State, now time.Time) []*huedb.SensorEvent {
+	ids := make([]int, 0, len(current))
+	for id := range current {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	var result []*huedb.SensorEvent
+	for _, id := range ids {
+		before, after := previous[id], current[id]
+		if after.Presence.Valid && after.Presence != before.Presence {
+			result = append(result, &huedb.SensorEvent{
+				SensorId: id,
+				Type:     huedb.MotionEvent,
+				Value:    strconv.FormatBool(after.Presence.Value),
+				Time:     now,
+			})
+		}
+		if after.ButtonEvent != 0 && !after.LastUpdated.Equal(before.LastUpdated) {
+			result = append(result, &huedb.SensorEvent{
+				SensorId: id,
+				Type:     huedb.ButtonEvent,
+				Value:    strconv.Itoa(after.ButtonEvent),
+				Time:     now,
+			})
+		}
+	}
+	return result
+}
+
+// MotionTrigger starts a hue task when a motion sensor sees motion during
+// certain hours of the day and ends it once the motion sensor has seen
+// no motion for a while. For example, MotionTrigger can turn on a night
+// light for 3 minutes when someone walks down the hallway between 22:00
+// and 06:00. The zero value is not usable; set at least SensorId,
+// Starter, and Task. MotionTrigger instances must not be copied once
+// they are in use.
+type MotionTrigger struct {
+	// The id of the motion sensor
+	SensorId int
+
+	// Starts the task
+	Starter Starter
+
+	// The task to start
+	Task *ops.HueTask
+
+	// The lights for the task
+	Lights lights.Set
+
+	// The task starts only on motion between From and To which are times
+	// of day as durations since midnight in local time. To may be less
+	// than From such as From = 22:00 and To = 06:00. If From equals To,
+	// motion at any time starts the task.
+	From, To time.Duration
+
+	// Once motion stops, the task ends after Timeout passes with no
+	// motion. 0 means let the task end on its own.
+	Timeout time.Duration
+
+	execution  *tasks.Execution
+	present    bool
+	lastMotion time.Time
+}
+
+func (m *MotionTrigger) Handle(event *huedb.SensorEvent, now time.Time) {
+	if event.SensorId != m.SensorId || event.Type != huedb.MotionEvent {
+		return
+	}
+	m.present = event.Value == "true"
+	m.lastMotion = now
+	if !m.present || !m.inWindow(now) {
+		return
+	}
+	if m.execution == nil || m.execution.IsDone() {
+		m.execution = m.Starter.MaybeStart(m.Task, m.Lights)
+	}
+}
+
+func (m *MotionTrigger) Tick(now time.Time) {
+	if m.execution == nil || m.present || m.Timeout == 0 {
+		return
+	}
+	if now.Sub(m.lastMotion) >= m.Timeout {
+		m.execution.End()
+		m.execution = nil
+	}
+}
+
+func (m *MotionTrigger) inWindow(now time.Time) bool {
+	if m.From == m.To {
+		return true
+	}
+	year, month, day := now.Date()
+	sinceMidnight := now.Sub(
+		time.Date(year, month, day, 0, 0, 0, 0, now.Location()))
+	if m.From < m.To {
+		return sinceMidnight >= m.From && sinceMidnight < m.To
+	}
+	return sinceMidnight >= m.From || sinceMidnight < m.To
+}
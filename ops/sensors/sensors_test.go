@@ -0,0 +1,192 @@
+package sensors_test
+
+import (
+	"github.com/keep94/goconsume"
+	"github.com/keep94/marvin/huedb"
+	"github.com/keep94/marvin/huedb/in_memory"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/ops/sensors"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const kMotionSensorId = 5
+
+func TestMotionTrigger(t *testing.T) {
+	starter := &recordingStarter{}
+	trigger := &sensors.MotionTrigger{
+		SensorId: kMotionSensorId,
+		Starter:  starter,
+		Task:     &ops.HueTask{Id: 1, Description: "Night light"},
+		Lights:   lights.New(3),
+		From:     22 * time.Hour,
+		To:       6 * time.Hour,
+		Timeout:  3 * time.Minute,
+	}
+	store := in_memory.New()
+	start := time.Date(2026, 10, 16, 23, 0, 0, 0, time.Local)
+	runWatcher(
+		t,
+		start,
+		store,
+		trigger,
+		false, true, true, false, false, false, false)
+	if len(starter.executions) != 1 {
+		t.Fatalf("Expected 1 task started, got %d", len(starter.executions))
+	}
+	if !starter.executions[0].IsEnded() {
+		t.Error("Expected task to be ended after presence timeout.")
+	}
+	var events []huedb.SensorEvent
+	if err := store.SensorEvents(
+		nil,
+		start,
+		start.Add(time.Hour),
+		goconsume.AppendTo(&events)); err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for _, event := range events {
+		if event.SensorId != kMotionSensorId || event.Type != huedb.MotionEvent {
+			t.Errorf("Unexpected event: %v", event)
+		}
+		values = append(values, event.Value)
+	}
+	if expected := []string{"true", "false"}; !reflect.DeepEqual(
+		expected, values) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
+
+func TestMotionTriggerMotionResetsTimeout(t *testing.T) {
+	starter := &recordingStarter{}
+	trigger := &sensors.MotionTrigger{
+		SensorId: kMotionSensorId,
+		Starter:  starter,
+		Task:     &ops.HueTask{Id: 1, Description: "Night light"},
+		Lights:   lights.New(3),
+		Timeout:  3 * time.Minute,
+	}
+	runWatcher(
+		t,
+		time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local),
+		nil,
+		trigger,
+		false, true, false, false, true, false, false)
+	if len(starter.executions) != 1 {
+		t.Fatalf("Expected 1 task started, got %d", len(starter.executions))
+	}
+	if starter.executions[0].IsEnded() {
+		t.Error("Expected task to still be running.")
+	}
+	starter.executions[0].End()
+}
+
+func TestMotionTriggerOutsideWindow(t *testing.T) {
+	starter := &recordingStarter{}
+	trigger := &sensors.MotionTrigger{
+		SensorId: kMotionSensorId,
+		Starter:  starter,
+		Task:     &ops.HueTask{Id: 1, Description: "Night light"},
+		Lights:   lights.New(3),
+		From:     22 * time.Hour,
+		To:       6 * time.Hour,
+	}
+	runWatcher(
+		t,
+		time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local),
+		nil,
+		trigger,
+		false, true, false)
+	if len(starter.executions) != 0 {
+		t.Errorf("Expected no tasks started, got %d", len(starter.executions))
+	}
+}
+
+func TestEvents(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	previous := map[int]sensors.State{
+		1: {Presence: maybe.NewBool(false)},
+		2: {ButtonEvent: 1002, LastUpdated: now.Add(-time.Hour)},
+		3: {ButtonEvent: 1002, LastUpdated: now.Add(-time.Hour)},
+	}
+	current := map[int]sensors.State{
+		1: {Presence: maybe.NewBool(true)},
+		2: {ButtonEvent: 1002, LastUpdated: now.Add(-time.Hour)},
+		3: {ButtonEvent: 4002, LastUpdated: now},
+		4: {Presence: maybe.NewBool(false)},
+	}
+	var actual []huedb.SensorEvent
+	for _, event := range sensors.Events(previous, current, now) {
+		actual = append(actual, *event)
+	}
+	expected := []huedb.SensorEvent{
+		{SensorId: 1, Type: huedb.MotionEvent, Value: "true", Time: now},
+		{SensorId: 3, Type: huedb.ButtonEvent, Value: "4002", Time: now},
+		{SensorId: 4, Type: huedb.MotionEvent, Value: "false", Time: now},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+// runWatcher runs a watcher that polls once a minute starting at start.
+// Each poll reports the next presence value for the motion sensor. The
+// watcher stops when presences run out.
+func runWatcher(
+	t *testing.T,
+	start time.Time,
+	store huedb.AddSensorEventRunner,
+	trigger sensors.Trigger,
+	presences ...bool) {
+	reader := &scriptedReader{presences: presences}
+	watcher := sensors.NewWatcher(reader, time.Minute, store, trigger)
+	err := tasks.RunForTesting(
+		tasks.TaskFunc(func(e *tasks.Execution) {
+			reader.e = e
+			watcher.Do(e)
+		}),
+		&tasks.ClockForTesting{Current: start})
+	if err != nil {
+		t.Errorf("Got error running watcher: %v", err)
+	}
+}
+
+type scriptedReader struct {
+	e         *tasks.Execution
+	presences []bool
+}
+
+func (r *scriptedReader) Sensors() (map[int]sensors.State, error) {
+	if len(r.presences) == 0 {
+		r.e.End()
+		return map[int]sensors.State{}, nil
+	}
+	presence := r.presences[0]
+	r.presences = r.presences[1:]
+	return map[int]sensors.State{
+		kMotionSensorId: {Presence: maybe.NewBool(presence)},
+	}, nil
+}
+
+type recordingStarter struct {
+	executions []*tasks.Execution
+}
+
+func (s *recordingStarter) MaybeStart(
+	h *ops.HueTask, lightSet lights.Set) *tasks.Execution {
+	return s.Start(h, lightSet)
+}
+
+func (s *recordingStarter) Start(
+	h *ops.HueTask, lightSet lights.Set) *tasks.Execution {
+	e := tasks.Start(tasks.TaskFunc(func(e *tasks.Execution) {
+		<-e.Ended()
+	}))
+	s.executions = append(s.executions, e)
+	return e
+}
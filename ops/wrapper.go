@@ -0,0 +1,266 @@
+package ops
+
+import (
+	"errors"
+	"github.com/keep94/gohue"
+	"github.com/keep94/marvin/lights"
+	"github.com/keep94/maybe"
+	"github.com/keep94/tasks"
+)
+
+var (
+	// ContextWrapper returns ErrNotSupported when the Context it wraps
+	// lacks the optional interface of the method called.
+	ErrNotSupported = errors.New("ops: Not supported.")
+)
+
+// Wrapper is a Context that adds behavior to another Context, such as the
+// Contexts that RateLimited and Logged return. Wrappers embed
+// ContextWrapper so that they have the methods of every optional
+// interface such as LightReader and GroupContext. A Wrapper supports an
+// optional interface only if the Context it wraps does, so use functions
+// like AsLightReader and AsGroupContext rather than type assertions to
+// find out what a Context supports.
+type Wrapper interface {
+	Context
+
+	// Unwrap returns the Context this Wrapper wraps.
+	Unwrap() Context
+
+	// Rewrap returns a Context that adds the same behavior as this
+	// Wrapper to ctxt. Functions like WithCorrelationId use Rewrap to
+	// change a Context deep inside a chain of Wrappers.
+	Rewrap(ctxt Context) Context
+}
+
+// ContextWrapper forwards every method of Context and of the optional
+// Context interfaces to the Context it wraps. Wrappers embed
+// ContextWrapper and override only the methods whose behavior they
+// change.
+type ContextWrapper struct {
+	Context
+}
+
+// Unwrap returns the wrapped Context.
+func (w ContextWrapper) Unwrap() Context {
+	return w.Context
+}
+
+// Get forwards to the wrapped Context if it is a LightReader.
+func (w ContextWrapper) Get(lightId int) (
+	*gohue.LightProperties, []byte, error) {
+	reader, ok := AsLightReader(w.Context)
+	if !ok {
+		return nil, nil, ErrNotSupported
+	}
+	return reader.Get(lightId)
+}
+
+// GetColorTemperature forwards to the wrapped Context if it is a
+// ColorTemperatureReader.
+func (w ContextWrapper) GetColorTemperature(lightId int) (
+	mireds maybe.Uint16, response []byte, err error) {
+	reader, ok := asColorTemperatureReader(w.Context)
+	if !ok {
+		err = ErrNotSupported
+		return
+	}
+	return reader.GetColorTemperature(lightId)
+}
+
+// IsReachable forwards to the wrapped Context if it is a
+// ReachabilityReader.
+func (w ContextWrapper) IsReachable(lightId int) (
+	reachable bool, response []byte, err error) {
+	reader, ok := asReachabilityReader(w.Context)
+	if !ok {
+		return false, nil, ErrNotSupported
+	}
+	return reader.IsReachable(lightId)
+}
+
+// ListLights forwards to the wrapped Context if it is a LightLister.
+func (w ContextWrapper) ListLights() (
+	ids []int, response []byte, err error) {
+	lister, ok := AsLightLister(w.Context)
+	if !ok {
+		return nil, nil, ErrNotSupported
+	}
+	return lister.ListLights()
+}
+
+// SetWithColorTemperature forwards to the wrapped Context if it is a
+// ColorTemperatureContext.
+func (w ContextWrapper) SetWithColorTemperature(
+	lightId int, properties *gohue.LightProperties, mireds uint16) (
+	response []byte, err error) {
+	ctCtxt, ok := AsColorTemperatureContext(w.Context)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return ctCtxt.SetWithColorTemperature(lightId, properties, mireds)
+}
+
+// GroupFor forwards to the wrapped Context if it is a GroupContext.
+// Otherwise GroupFor reports that there is no group.
+func (w ContextWrapper) GroupFor(lightSet lights.Set) (
+	groupId int, ok bool) {
+	groupCtxt, isGroupCtxt := AsGroupContext(w.Context)
+	if !isGroupCtxt {
+		return 0, false
+	}
+	return groupCtxt.GroupFor(lightSet)
+}
+
+// SetGroup forwards to the wrapped Context if it is a GroupContext.
+func (w ContextWrapper) SetGroup(
+	groupId int, properties *gohue.LightProperties) (
+	response []byte, err error) {
+	groupCtxt, ok := AsGroupContext(w.Context)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return groupCtxt.SetGroup(groupId, properties)
+}
+
+// SetEffect forwards to the wrapped Context if it is an EffectContext.
+func (w ContextWrapper) SetEffect(lightId int, effect string) (
+	response []byte, err error) {
+	effectCtxt, ok := AsEffectContext(w.Context)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return effectCtxt.SetEffect(lightId, effect)
+}
+
+// SetAlert forwards to the wrapped Context if it is an AlertContext.
+func (w ContextWrapper) SetAlert(lightId int, alert string) (
+	response []byte, err error) {
+	alertCtxt, ok := AsAlertContext(w.Context)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return alertCtxt.SetAlert(lightId, alert)
+}
+
+// AsLightReader returns ctxt as a LightReader if ctxt supports reading
+// lights.
+func AsLightReader(ctxt Context) (LightReader, bool) {
+	if supports(ctxt, func(x interface{}) bool {
+		_, ok := x.(LightReader)
+		return ok
+	}) {
+		return ctxt.(LightReader), true
+	}
+	return nil, false
+}
+
+// AsLightLister returns ctxt as a LightLister if ctxt supports listing
+// the lights.
+func AsLightLister(ctxt Context) (LightLister, bool) {
+	if supports(ctxt, func(x interface{}) bool {
+		_, ok := x.(LightLister)
+		return ok
+	}) {
+		return ctxt.(LightLister), true
+	}
+	return nil, false
+}
+
+// AsColorTemperatureContext returns ctxt as a ColorTemperatureContext if
+// ctxt supports setting color temperatures.
+func AsColorTemperatureContext(ctxt Context) (
+	ColorTemperatureContext, bool) {
+	if supports(ctxt, func(x interface{}) bool {
+		_, ok := x.(ColorTemperatureContext)
+		return ok
+	}) {
+		return ctxt.(ColorTemperatureContext), true
+	}
+	return nil, false
+}
+
+// AsGroupContext returns ctxt as a GroupContext if ctxt supports setting
+// groups.
+func AsGroupContext(ctxt Context) (GroupContext, bool) {
+	if supports(ctxt, func(x interface{}) bool {
+		_, ok := x.(GroupContext)
+		return ok
+	}) {
+		return ctxt.(GroupContext), true
+	}
+	return nil, false
+}
+
+// AsEffectContext returns ctxt as an EffectContext if ctxt supports
+// effects.
+func AsEffectContext(ctxt Context) (EffectContext, bool) {
+	if supports(ctxt, func(x interface{}) bool {
+		_, ok := x.(EffectContext)
+		return ok
+	}) {
+		return ctxt.(EffectContext), true
+	}
+	return nil, false
+}
+
+// AsAlertContext returns ctxt as an AlertContext if ctxt supports alerts.
+func AsAlertContext(ctxt Context) (AlertContext, bool) {
+	if supports(ctxt, func(x interface{}) bool {
+		_, ok := x.(AlertContext)
+		return ok
+	}) {
+		return ctxt.(AlertContext), true
+	}
+	return nil, false
+}
+
+func asColorTemperatureReader(reader interface{}) (
+	ColorTemperatureReader, bool) {
+	if supports(reader, func(x interface{}) bool {
+		_, ok := x.(ColorTemperatureReader)
+		return ok
+	}) {
+		return reader.(ColorTemperatureReader), true
+	}
+	return nil, false
+}
+
+func asReachabilityReader(reader interface{}) (
+	ReachabilityReader, bool) {
+	if supports(reader, func(x interface{}) bool {
+		_, ok := x.(ReachabilityReader)
+		return ok
+	}) {
+		return reader.(ReachabilityReader), true
+	}
+	return nil, false
+}
+
+// supports returns true if x implements an interface and, when x wraps
+// another Context, the wrapped Context supports that interface too.
+// implements tells whether its argument implements the interface.
+func supports(x interface{}, implements func(x interface{}) bool) bool {
+	for implements(x) {
+		wrapper, ok := x.(interface{ Unwrap() Context })
+		if !ok {
+			return true
+		}
+		x = wrapper.Unwrap()
+	}
+	return false
+}
+
+// WithExecution returns a Context that works like ctxt except that
+// commands waiting for their turn under RateLimited go out right away
+// once e ends so that a task that was told to stop is never stuck
+// waiting.
+func WithExecution(ctxt Context, e *tasks.Execution) Context {
+	switch c := ctxt.(type) {
+	case *rateLimitedContext:
+		return c.withEnded(e.Ended())
+	case Wrapper:
+		return c.Rewrap(WithExecution(c.Unwrap(), e))
+	}
+	return ctxt
+}
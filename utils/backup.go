@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"github.com/keep94/appcommon/db"
+	"github.com/keep94/tasks"
+	"log"
+	"time"
+)
+
+// Backuper backs up a database to a file. huedb.BackupRunner instances
+// are Backupers.
+type Backuper interface {
+	Backup(t db.Transaction, dest string) error
+}
+
+// BackupTask returns a task that backs up the database using backuper.
+// The task names the backup file by formatting the current time with
+// pathLayout, a time.Time layout such as "/backups/hue-20060102.db".
+// The task logs to logger and reports any error through its execution.
+// Use TaskToScheduledTask to run the returned task nightly.
+func BackupTask(
+	backuper Backuper,
+	pathLayout string,
+	logger *log.Logger) tasks.Task {
+	return BackupTaskWithClock(
+		backuper, pathLayout, logger, tasks.SystemClock())
+}
+
+// BackupTaskWithClock provides a caller supplied clock for testing.
+func BackupTaskWithClock(
+	backuper Backuper,
+	pathLayout string,
+	logger *log.Logger,
+	clock tasks.Clock) tasks.Task {
+	return tasks.TaskFunc(func(e *tasks.Execution) {
+		path := clock.Now().Format(pathLayout)
+		start := time.Now()
+		if err := backuper.Backup(nil, path); err != nil {
+			logger.Printf("While backing up to %s: %v", path, err)
+			e.SetError(err)
+			return
+		}
+		logger.Printf("Backed up to %s in %v", path, time.Since(start))
+	})
+}
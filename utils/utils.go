@@ -2,6 +2,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"github.com/keep94/marvin/lights"
 	"github.com/keep94/marvin/ops"
@@ -11,6 +12,7 @@ import (
 	"log"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -65,6 +67,15 @@ type FutureHueTask interface {
 	GetDescription() string
 }
 
+// ContextFutureHueTask is a FutureHueTask whose refresh can be cancelled.
+type ContextFutureHueTask interface {
+	FutureHueTask
+
+	// RefreshWithContext works like Refresh but gives up as soon as ctx
+	// is done.
+	RefreshWithContext(ctx context.Context) *ops.HueTask
+}
+
 // ScheduledTask represents a scheduled task that runs periodically to
 // operate hue lights.
 // ScheduledTask instances should not be copied via assignment operator.
@@ -102,11 +113,15 @@ func HueTaskToScheduledTask(
 	var atask tasks.Task
 	if hiPriority {
 		atask = tasks.TaskFunc(func(e *tasks.Execution) {
-			te.Start(h.Refresh(), lightSet)
+			if hueTask := refresh(h, e); hueTask != nil {
+				te.Start(hueTask, lightSet)
+			}
 		})
 	} else {
 		atask = tasks.TaskFunc(func(e *tasks.Execution) {
-			te.MaybeStart(h.Refresh(), lightSet)
+			if hueTask := refresh(h, e); hueTask != nil {
+				te.MaybeStart(hueTask, lightSet)
+			}
 		})
 	}
 	result := TaskToScheduledTask(id, h.GetDescription(), r, atask)
@@ -115,6 +130,29 @@ func HueTaskToScheduledTask(
 	return result
 }
 
+// refresh refreshes h. If h is a ContextFutureHueTask, refresh gives up
+// when e is ended. refresh returns nil if e ended while refreshing.
+func refresh(h FutureHueTask, e *tasks.Execution) *ops.HueTask {
+	ch, ok := h.(ContextFutureHueTask)
+	if !ok {
+		return h.Refresh()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-e.Ended():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	result := ch.RefreshWithContext(ctx)
+	if e.IsEnded() {
+		return nil
+	}
+	return result
+}
+
 // TaskToScheduledTask creates a ScheduledTask from an ordinary task.
 // id is the id of the new HueTaskToScheduledTask.
 // description is a description for task.
@@ -310,6 +348,23 @@ type AtTimeTaskStore interface {
 	Add(task *ops.AtTimeTask)
 }
 
+// AtTimeTaskRescheduler is an optional interface that an AtTimeTaskStore
+// can implement to move a stored task to a new time without removing it.
+type AtTimeTaskRescheduler interface {
+	// Reschedule changes when a stored task runs and its schedule Id.
+	Reschedule(scheduleId, newScheduleId string, newTime time.Time)
+}
+
+// AtTimeTaskFinisher is an optional interface that an AtTimeTaskStore
+// can implement to learn how a stored task ended. When the store
+// implements AtTimeTaskFinisher, MultiTimer calls Finish instead of Remove
+// once a stored task runs or is cancelled.
+type AtTimeTaskFinisher interface {
+	// Finish removes a stored task by schedule Id. ran is true if the
+	// task ran and false if it was cancelled.
+	Finish(scheduleId string, ran bool)
+}
+
 // Interface HueTaskBeginner can begin a hue task. MultiExecutor
 // implements this interface.
 type HueTaskBeginner interface {
@@ -352,36 +407,110 @@ func NewMultiTimerWithStoreAndClock(
 		store:     store}
 	tasks := store.All()
 	for i := range tasks {
-		result.schedule(tasks[i].H, tasks[i].Ls, tasks[i].StartTime)
+		result.schedule(
+			tasks[i].H, tasks[i].Ls, tasks[i].StartTime, tasks[i].Repeat)
 	}
 	return result
 }
 
 func (m *MultiTimer) schedule(
-	h *ops.HueTask, usedLights lights.Set, startTime time.Time) string {
+	h *ops.HueTask,
+	usedLights lights.Set,
+	startTime time.Time,
+	repeat ops.Repeat) string {
 	wrapper := &TimerTaskWrapper{
 		H:         h,
 		Ls:        usedLights,
 		StartTime: startTime,
+		Repeat:    repeat,
 		executor:  m.executor,
-		store:     m.store}
+		store:     m.store,
+		timer:     m}
 	m.scheduler.Start(wrapper)
 	return wrapper.TaskId()
 }
 
+// scheduleNext schedules and stores the run of wrapper that follows its
+// run at wrapper.StartTime skipping any runs that would be at or before
+// now.
+func (m *MultiTimer) scheduleNext(wrapper *TimerTaskWrapper, now time.Time) {
+	startTime, repeat := wrapper.StartTime, wrapper.Repeat
+	for !repeat.IsZero() {
+		startTime, repeat = repeat.Next(startTime)
+		if startTime.After(now) {
+			scheduleId := m.schedule(wrapper.H, wrapper.Ls, startTime, repeat)
+			m.store.Add(&ops.AtTimeTask{
+				Id:        scheduleId,
+				H:         wrapper.H,
+				Ls:        wrapper.Ls,
+				StartTime: startTime,
+				Repeat:    repeat})
+			return
+		}
+	}
+}
+
 // Schedule schedules a hue task to be run.
 // h is the hue task; lightSet is suggested set of lights for which the
 // task should run;
 // startTime is the time that the hue task should run.
 func (m *MultiTimer) Schedule(
 	h *ops.HueTask, lightSet lights.Set, startTime time.Time) {
+	m.ScheduleRepeating(h, lightSet, startTime, ops.Repeat{})
+}
+
+// ScheduleRepeating works like Schedule except that the hue task runs
+// again as repeat specifies. After each run, ScheduleRepeating stores the
+// next run so that the remaining runs survive restarts.
+func (m *MultiTimer) ScheduleRepeating(
+	h *ops.HueTask,
+	lightSet lights.Set,
+	startTime time.Time,
+	repeat ops.Repeat) {
 	usedLights := h.UsedLights(lightSet)
 	if usedLights.IsNone() {
 		return
 	}
-	scheduleId := m.schedule(h, usedLights, startTime)
+	scheduleId := m.schedule(h, usedLights, startTime, repeat)
 	m.store.Add(&ops.AtTimeTask{
-		Id: scheduleId, H: h, Ls: usedLights, StartTime: startTime})
+		Id:        scheduleId,
+		H:         h,
+		Ls:        usedLights,
+		StartTime: startTime,
+		Repeat:    repeat})
+}
+
+// Reschedule moves a scheduled task to newTime and returns the new
+// schedule Id of the task. If the store of this instance implements
+// AtTimeTaskRescheduler, Reschedule uses it to update the stored task;
+// otherwise, Reschedule removes the stored task and adds it back.
+// If scheduleId is not found or if the task has already started running,
+// Reschedule does nothing and returns the empty string.
+func (m *MultiTimer) Reschedule(scheduleId string, newTime time.Time) string {
+	wrapper := m.findByScheduleId(scheduleId)
+	e := m.FindByScheduleId(scheduleId)
+	if wrapper == nil || e == nil {
+		return ""
+	}
+	if !atomic.CompareAndSwapInt32(
+		&wrapper.state, kTimerPending, kTimerRescheduling) {
+		return ""
+	}
+	e.End()
+	<-e.Done()
+	newScheduleId := m.schedule(wrapper.H, wrapper.Ls, newTime, wrapper.Repeat)
+	if rescheduler, ok := m.store.(AtTimeTaskRescheduler); ok {
+		rescheduler.Reschedule(scheduleId, newScheduleId, newTime)
+	} else {
+		m.store.Remove(scheduleId)
+		m.store.Add(&ops.AtTimeTask{
+			Id:        newScheduleId,
+			H:         wrapper.H,
+			Ls:        wrapper.Ls,
+			StartTime: newTime,
+			Repeat:    wrapper.Repeat})
+	}
+	return newScheduleId
 }
 
 // Scheduled returns the tasks scheduled to be run.
@@ -398,6 +527,15 @@ func (m *MultiTimer) FindByScheduleId(scheduleId string) *tasks.Execution {
 	return m.scheduler.Tasks().(*TaskCollection).FindByTaskId(scheduleId)
 }
 
+func (m *MultiTimer) findByScheduleId(scheduleId string) *TimerTaskWrapper {
+	for _, wrapper := range m.Scheduled() {
+		if wrapper.TaskId() == scheduleId {
+			return wrapper
+		}
+	}
+	return nil
+}
+
 // Cancel cancels a scheduled task. scheduleId comes from
 // TimerTaskWrapper.TaskId() and identifies the scheduling of a task.
 // This ID is different from the ID of a running task
@@ -586,6 +724,10 @@ func (c *TaskCollection) FindByTaskId(taskId string) *tasks.Execution {
 	return nil
 }
 
+// The number of times any HueTaskWrapper has run. Used to make
+// correlation ids unique.
+var runCount uint64
+
 // HueTaskWrapper represents a hue task bound to a context and a light set.
 // Implements Task.
 type HueTaskWrapper struct {
@@ -605,15 +747,25 @@ type HueTaskWrapper struct {
 	name string
 }
 
-// Do performs the task
+// Do performs the task. If the hue action of the task is an
+// ops.Finalizer, Do finalizes it after it finishes or is interrupted.
+// If the context is an ops.Correlator, Do tags the commands of each run
+// with a correlation id made from TaskId and the run number. Commands
+// that the hue action sends stop waiting on an ops.RateLimited context
+// once the task ends.
 func (t *HueTaskWrapper) Do(e *tasks.Execution) {
+	c := ops.WithCorrelationId(
+		t.c,
+		fmt.Sprintf("%s#%d", t.TaskId(), atomic.AddUint64(&runCount, 1)))
+	defer ops.Finalize(t.H.HueAction, c, t.Ls)
+	running := ops.WithExecution(c, e)
 	// This added for testing for when there is no log.
 	if t.log == nil {
-		t.H.Do(t.c, t.Ls, e)
+		t.H.Do(running, t.Ls, e)
 		return
 	}
 	t.log.Printf("START: %s", t)
-	t.H.Do(t.c, t.Ls, e)
+	t.H.Do(running, t.Ls, e)
 	if err := e.Error(); err != nil {
 		t.log.Printf("ERROR: %s: %v\n", t, err)
 	} else if e.IsEnded() {
@@ -638,6 +790,14 @@ func (t *HueTaskWrapper) String() string {
 	return fmt.Sprintf("{%s, %d, %s, %s}", t.name, t.H.Id, t.H.Description, t.Ls)
 }
 
+// The states of a TimerTaskWrapper.
+const (
+	kTimerPending int32 = iota
+	kTimerRunning
+	kTimerFinished
+	kTimerRescheduling
+)
+
 // TimerTaskWrapper represents a hue task bound to a light set to start at
 // a particular time. Implements Task.
 type TimerTaskWrapper struct {
@@ -651,17 +811,43 @@ type TimerTaskWrapper struct {
 	// The time to start
 	StartTime time.Time
 
+	// How the hue task repeats after it runs
+	Repeat ops.Repeat
+
 	executor HueTaskBeginner
 
 	store AtTimeTaskStore
+
+	timer *MultiTimer
+
+	// One of kTimerPending, kTimerRunning, kTimerFinished, or
+	// kTimerRescheduling. Do and Reschedule each claim this task by
+	// moving it out of kTimerPending so that a task being rescheduled
+	// never runs and a task that is running is never rescheduled.
+	state int32
 }
 
 func (t *TimerTaskWrapper) Do(e *tasks.Execution) {
 	d := t.StartTime.Sub(e.Now())
-	if d > 0 && e.Sleep(d) {
+	ran := false
+	if d > 0 && e.Sleep(d) && atomic.CompareAndSwapInt32(
+		&t.state, kTimerPending, kTimerRunning) {
 		t.executor.Begin(t.H, t.Ls)
+		ran = true
+	}
+	if !ran && !atomic.CompareAndSwapInt32(
+		&t.state, kTimerPending, kTimerFinished) {
+		// Reschedule owns the stored task now.
+		return
+	}
+	if !e.IsEnded() && !t.Repeat.IsZero() {
+		t.timer.scheduleNext(t, e.Now())
+	}
+	if finisher, ok := t.store.(AtTimeTaskFinisher); ok {
+		finisher.Finish(t.TaskId(), ran)
+	} else {
+		t.store.Remove(t.TaskId())
 	}
-	t.store.Remove(t.TaskId())
 }
 
 func (t *TimerTaskWrapper) ConflictsWith(other Task) bool {
@@ -1,11 +1,20 @@
 package utils_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/keep94/appcommon/db"
 	"github.com/keep94/marvin/lights"
 	"github.com/keep94/marvin/ops"
+	"github.com/keep94/marvin/ops/opstest"
 	"github.com/keep94/marvin/utils"
+	"github.com/keep94/maybe"
 	"github.com/keep94/tasks"
+	"io/ioutil"
+	"log"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -71,6 +80,34 @@ func TestTaskCollection(t *testing.T) {
 	verifyExecution(t, e1, coll.FindByTaskId("50:All"))
 }
 
+func TestHueTaskWrapperFinalizes(t *testing.T) {
+	action := &finalizingAction{}
+	htw := &utils.HueTaskWrapper{
+		H: &ops.HueTask{Id: 17, HueAction: action}, Ls: lights.New(1, 3)}
+	if err := tasks.Run(htw); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if out := action.finalized.String(); out != "1,3" {
+		t.Errorf("Expected 1,3 finalized, got %v", out)
+	}
+}
+
+func TestHueTaskWrapperCorrelationId(t *testing.T) {
+	var buffer bytes.Buffer
+	logged := ops.Logged(opstest.NewBridge(1), log.New(&buffer, "", 0))
+	executor := utils.NewMultiExecutor(logged, nil)
+	defer executor.Close()
+	task := &ops.HueTask{
+		Id: 17,
+		HueAction: ops.StaticHueAction{
+			1: {On: maybe.NewBool(false)}},
+	}
+	<-executor.Start(task, lights.New(1)).Done()
+	if out := buffer.String(); !strings.HasPrefix(out, "SET: [17:1#") {
+		t.Errorf("Expected correlation id for task 17, got %q", out)
+	}
+}
+
 func TestTimerTaskWrapper(t *testing.T) {
 	now := time.Unix(1300000000, 0)
 	task := &utils.TimerTaskWrapper{
@@ -302,6 +339,177 @@ func TestMultiTimerPersistence(t *testing.T) {
 	beginner.VerifyNoInteraction(t)
 }
 
+func TestMultiTimerReschedule(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+	storeActivity := make(chan interface{}, 10)
+	beginnerActivity := make(chan interface{}, 10)
+	defer close(storeActivity)
+	defer close(beginnerActivity)
+	clock := tasks.NewFakeClock(now)
+	store := &reschedulingAtTimeTaskStore{
+		atTimeTaskStore{Activity: storeActivity}}
+	beginner := hueTaskBeginner{beginnerActivity}
+	mt := utils.NewMultiTimerWithStoreAndClock(beginner, store, clock)
+	h := &ops.HueTask{Id: 21, HueAction: intAction(121), Description: "Foo"}
+	mt.Schedule(h, lights.New(2), now.Add(10*time.Minute))
+	store.VerifyAdded(t, &ops.AtTimeTask{
+		Id:        "21:1400000600:2",
+		H:         h,
+		Ls:        lights.New(2),
+		StartTime: now.Add(10 * time.Minute)}, true)
+	newScheduleId := mt.Reschedule("21:1400000600:2", now.Add(time.Hour))
+	assertStrEqual(t, "21:1400003600:2", newScheduleId)
+	store.VerifyRescheduled(t, "21:1400000600:2", "21:1400003600:2")
+	store.VerifyNoInteraction(t)
+	verifyScheduled(t, []*ops.AtTimeTask{
+		{H: h, Ls: lights.New(2), StartTime: now.Add(time.Hour)},
+	}, mt.Scheduled())
+	assertStrEqual(t, "", mt.Reschedule("NoSuchTaskId", now))
+	clock.Advance(time.Hour)
+	beginner.Verify(t, h, lights.New(2))
+	store.VerifyRemoved(t, "21:1400003600:2", true)
+}
+
+func TestMultiTimerRescheduleWhileRunning(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+	storeActivity := make(chan interface{}, 10)
+	defer close(storeActivity)
+	clock := tasks.NewFakeClock(now)
+	store := &atTimeTaskStore{Activity: storeActivity}
+	beginner := &reschedulingHueTaskBeginner{
+		scheduleId: "21:1400000600:2",
+		newTime:    now.Add(time.Hour),
+		Activity:   make(chan interface{}, 10),
+	}
+	mt := utils.NewMultiTimerWithStoreAndClock(beginner, store, clock)
+	beginner.timer = mt
+	h := &ops.HueTask{Id: 21, HueAction: intAction(121), Description: "Foo"}
+	mt.Schedule(h, lights.New(2), now.Add(10*time.Minute))
+	store.VerifyAdded(t, &ops.AtTimeTask{
+		Id:        "21:1400000600:2",
+		H:         h,
+		Ls:        lights.New(2),
+		StartTime: now.Add(10 * time.Minute)}, true)
+
+	// Reschedule gets called while the task is starting.
+	clock.Advance(10 * time.Minute)
+	if out := nextActivity(beginner.Activity, kMaxActivityWaitTime); out != "" {
+		t.Errorf("Expected Reschedule to do nothing, got %v", out)
+	}
+	store.VerifyRemoved(t, "21:1400000600:2", true)
+	clock.Advance(time.Hour)
+	if out := nextActivity(beginner.Activity, 100*time.Millisecond); out != nil {
+		t.Errorf("Expected task to run once, got %v", out)
+	}
+	store.VerifyNoInteraction(t)
+	verifyScheduled(t, nil, mt.Scheduled())
+}
+
+func TestMultiTimerRepeat(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+	storeActivity := make(chan interface{}, 10)
+	beginnerActivity := make(chan interface{}, 10)
+	defer close(storeActivity)
+	defer close(beginnerActivity)
+	clock := tasks.NewFakeClock(now)
+	store := &atTimeTaskStore{Activity: storeActivity}
+	beginner := hueTaskBeginner{beginnerActivity}
+	mt := utils.NewMultiTimerWithStoreAndClock(beginner, store, clock)
+	h := &ops.HueTask{Id: 21, HueAction: intAction(121), Description: "Foo"}
+	mt.ScheduleRepeating(
+		h,
+		lights.New(2),
+		now.Add(10*time.Minute),
+		ops.Repeat{Every: time.Hour, Count: 1})
+	store.VerifyAdded(t, &ops.AtTimeTask{
+		Id:        "21:1400000600:2",
+		H:         h,
+		Ls:        lights.New(2),
+		StartTime: now.Add(10 * time.Minute),
+		Repeat:    ops.Repeat{Every: time.Hour, Count: 1}}, true)
+	clock.Advance(10 * time.Minute)
+	beginner.Verify(t, h, lights.New(2))
+	store.VerifyAdded(t, &ops.AtTimeTask{
+		Id:        "21:1400004200:2",
+		H:         h,
+		Ls:        lights.New(2),
+		StartTime: now.Add(70 * time.Minute)}, true)
+	store.VerifyRemoved(t, "21:1400000600:2", true)
+	verifyScheduled(t, []*ops.AtTimeTask{
+		{H: h, Ls: lights.New(2), StartTime: now.Add(70 * time.Minute)},
+	}, mt.Scheduled())
+	mt.Cancel("21:1400004200:2")
+	store.VerifyRemoved(t, "21:1400004200:2", true)
+	store.VerifyNoInteraction(t)
+	beginner.VerifyNoInteraction(t)
+}
+
+func TestMultiTimerRepeatSkipsMissedRuns(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+	storeActivity := make(chan interface{}, 10)
+	beginnerActivity := make(chan interface{}, 10)
+	defer close(storeActivity)
+	defer close(beginnerActivity)
+	clock := tasks.NewFakeClock(now)
+	h := &ops.HueTask{Id: 21, HueAction: intAction(121), Description: "Foo"}
+	store := &atTimeTaskStore{
+		Tasks: []*ops.AtTimeTask{
+			{
+				H:         h,
+				Ls:        lights.New(2),
+				StartTime: now.Add(-90 * time.Minute),
+				Repeat:    ops.Repeat{Every: time.Hour, Count: 3},
+			},
+		},
+		Activity: storeActivity}
+	beginner := hueTaskBeginner{beginnerActivity}
+	mt := utils.NewMultiTimerWithStoreAndClock(beginner, store, clock)
+	store.VerifyAdded(t, &ops.AtTimeTask{
+		Id:        "21:1400001800:2",
+		H:         h,
+		Ls:        lights.New(2),
+		StartTime: now.Add(30 * time.Minute),
+		Repeat:    ops.Repeat{Every: time.Hour, Count: 1}}, true)
+	store.VerifyRemoved(t, "21:1399994600:2", true)
+	mt.Cancel("21:1400001800:2")
+	store.VerifyRemoved(t, "21:1400001800:2", true)
+	store.VerifyNoInteraction(t)
+	beginner.VerifyNoInteraction(t)
+}
+
+func TestMultiTimerFinish(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+	storeActivity := make(chan interface{}, 10)
+	beginnerActivity := make(chan interface{}, 10)
+	defer close(storeActivity)
+	defer close(beginnerActivity)
+	clock := tasks.NewFakeClock(now)
+	store := &finishingAtTimeTaskStore{
+		atTimeTaskStore{Activity: storeActivity}}
+	beginner := hueTaskBeginner{beginnerActivity}
+	mt := utils.NewMultiTimerWithStoreAndClock(beginner, store, clock)
+	h := &ops.HueTask{Id: 21, HueAction: intAction(121), Description: "Foo"}
+	mt.Schedule(h, lights.New(2), now.Add(10*time.Minute))
+	mt.Schedule(h, lights.New(3), now.Add(20*time.Minute))
+	store.VerifyAdded(t, &ops.AtTimeTask{
+		Id:        "21:1400000600:2",
+		H:         h,
+		Ls:        lights.New(2),
+		StartTime: now.Add(10 * time.Minute)}, true)
+	store.VerifyAdded(t, &ops.AtTimeTask{
+		Id:        "21:1400001200:3",
+		H:         h,
+		Ls:        lights.New(3),
+		StartTime: now.Add(20 * time.Minute)}, true)
+	clock.Advance(10 * time.Minute)
+	beginner.Verify(t, h, lights.New(2))
+	store.VerifyFinished(t, "21:1400000600:2", true)
+	mt.Cancel("21:1400001200:3")
+	store.VerifyFinished(t, "21:1400001200:3", false)
+	store.VerifyNoInteraction(t)
+	beginner.VerifyNoInteraction(t)
+}
+
 func assertStrEqual(t *testing.T, expected, actual string) {
 	if expected != actual {
 		t.Errorf("Expected %s, got %s", expected, actual)
@@ -474,6 +682,28 @@ func (b hueTaskBeginner) VerifyNoInteraction(t *testing.T) {
 	}
 }
 
+// reschedulingHueTaskBeginner reschedules a task as it begins and sends
+// what Reschedule returns to Activity or "blocked" if Reschedule blocks.
+type reschedulingHueTaskBeginner struct {
+	timer      *utils.MultiTimer
+	scheduleId string
+	newTime    time.Time
+	Activity   chan interface{}
+}
+
+func (b *reschedulingHueTaskBeginner) Begin(h *ops.HueTask, ls lights.Set) {
+	result := make(chan string, 1)
+	go func() {
+		result <- b.timer.Reschedule(b.scheduleId, b.newTime)
+	}()
+	select {
+	case r := <-result:
+		b.Activity <- r
+	case <-time.After(kMaxActivityWaitTime / 2):
+		b.Activity <- "blocked"
+	}
+}
+
 type atTimeTaskStore struct {
 	Tasks    []*ops.AtTimeTask
 	Activity chan interface{}
@@ -531,6 +761,37 @@ func (s *atTimeTaskStore) VerifyRemoved(
 	}
 }
 
+type reschedulingAtTimeTaskStore struct {
+	atTimeTaskStore
+}
+
+func (s *reschedulingAtTimeTaskStore) Reschedule(
+	scheduleId, newScheduleId string, newTime time.Time) {
+	s.Activity <- []string{scheduleId, newScheduleId}
+}
+
+func (s *reschedulingAtTimeTaskStore) VerifyRescheduled(
+	t *testing.T, expectedId, expectedNewId string) {
+	expected := []string{expectedId, expectedNewId}
+	actual := nextActivity(s.Activity, kMaxActivityWaitTime)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v rescheduled, got %v", expected, actual)
+	}
+}
+
+type finishingAtTimeTaskStore struct {
+	atTimeTaskStore
+}
+
+func (s *finishingAtTimeTaskStore) Finish(scheduleId string, ran bool) {
+	s.Activity <- fmt.Sprintf("%s %v", scheduleId, ran)
+}
+
+func (s *finishingAtTimeTaskStore) VerifyFinished(
+	t *testing.T, expectedId string, expectedRan bool) {
+	s.VerifyRemoved(t, fmt.Sprintf("%s %v", expectedId, expectedRan), true)
+}
+
 func verifyScheduled(
 	t *testing.T,
 	expected []*ops.AtTimeTask,
@@ -560,6 +821,15 @@ func verifyScheduled(
 
 func nextActivity(
 	activity <-chan interface{}, maxWait time.Duration) interface{} {
+	// With no wait, a timer could win over activity that is already there.
+	if maxWait == 0 {
+		select {
+		case result := <-activity:
+			return result
+		default:
+			return nil
+		}
+	}
 	select {
 	case result := <-activity:
 		return result
@@ -567,3 +837,50 @@ func nextActivity(
 		return nil
 	}
 }
+
+func TestBackupTask(t *testing.T) {
+	backuper := &fakeBackuper{}
+	clock := &tasks.ClockForTesting{
+		Current: time.Date(2015, 6, 1, 2, 0, 0, 0, time.Local)}
+	task := utils.BackupTaskWithClock(
+		backuper,
+		"/backups/hue-20060102.db",
+		log.New(ioutil.Discard, "", 0),
+		clock)
+	if err := tasks.Run(task); err != nil {
+		t.Errorf("Got error backing up: %v", err)
+	}
+	if backuper.dest != "/backups/hue-20150601.db" {
+		t.Errorf("Expected /backups/hue-20150601.db, got %s", backuper.dest)
+	}
+	backuper.err = errors.New("disk full")
+	if err := tasks.Run(task); err != backuper.err {
+		t.Errorf("Expected %v, got %v", backuper.err, err)
+	}
+}
+
+type fakeBackuper struct {
+	dest string
+	err  error
+}
+
+func (f *fakeBackuper) Backup(t db.Transaction, dest string) error {
+	f.dest = dest
+	return f.err
+}
+
+type finalizingAction struct {
+	finalized lights.Set
+}
+
+func (a *finalizingAction) Do(
+	ctxt ops.Context, lightSet lights.Set, e *tasks.Execution) {
+}
+
+func (a *finalizingAction) UsedLights(lightSet lights.Set) lights.Set {
+	return lightSet
+}
+
+func (a *finalizingAction) Finalize(ctxt ops.Context, lightSet lights.Set) {
+	a.finalized = lightSet
+}
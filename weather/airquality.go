@@ -0,0 +1,125 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/keep94/appcommon/http_util"
+)
+
+// How far in miles AirNow looks for a monitoring station when given a
+// latitude and longitude.
+const kAirNowDistance = 25
+
+// AirNowProvider provides the current air quality from AirNow. location
+// is either a US zip code such as "94043" or a latitude and longitude
+// separated by a comma such as "37.39,-122.08". The observations it
+// returns have only the AQI field set.
+type AirNowProvider struct {
+	// The AirNow API key
+	APIKey string
+
+	// The client for making requests. nil means a default client that
+	// gives up after 30 seconds.
+	Client *http.Client
+}
+
+func (p *AirNowProvider) Current(
+	ctx context.Context, location string) (*Observation, error) {
+	resp, err := doGet(ctx, p.Client, getAirNowUrl(p.APIKey, location))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var readings []airNowReading
+	if err := json.NewDecoder(resp.Body).Decode(&readings); err != nil {
+		return nil, err
+	}
+	if len(readings) == 0 {
+		return nil, errors.New(fmt.Sprintf(
+			"weather:No AirNow readings for %s", location))
+	}
+	aqi := 0
+	for _, reading := range readings {
+		if reading.AQI > aqi {
+			aqi = reading.AQI
+		}
+	}
+	return &Observation{AQI: aqi}, nil
+}
+
+// EPAUVProvider provides today's UV index forecast from the EPA.
+// location is a US zip code such as "94043". The observations it returns
+// have only the UVIndex field set.
+type EPAUVProvider struct {
+	// The client for making requests. nil means a default client that
+	// gives up after 30 seconds.
+	Client *http.Client
+}
+
+func (p *EPAUVProvider) Current(
+	ctx context.Context, location string) (*Observation, error) {
+	resp, err := doGet(ctx, p.Client, getEPAUVUrl(location))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var forecasts []epaUVForecast
+	if err := json.NewDecoder(resp.Body).Decode(&forecasts); err != nil {
+		return nil, err
+	}
+	if len(forecasts) == 0 {
+		return nil, errors.New(fmt.Sprintf(
+			"weather:No UV index for %s", location))
+	}
+	return &Observation{UVIndex: forecasts[0].UVIndex}, nil
+}
+
+type airNowReading struct {
+	ParameterName string `json:"ParameterName"`
+	AQI           int    `json:"AQI"`
+}
+
+type epaUVForecast struct {
+	UVIndex float64 `json:"UV_INDEX"`
+}
+
+func getAirNowUrl(apiKey, location string) *url.URL {
+	params := openWeatherParams(location)
+	if params[0] == "lat" {
+		base := &url.URL{
+			Scheme: "https",
+			Host:   "www.airnowapi.org",
+			Path:   "/aq/observation/latLong/current/"}
+		return http_util.AppendParams(
+			base,
+			"format", "application/json",
+			"latitude", params[1],
+			"longitude", params[3],
+			"distance", strconv.Itoa(kAirNowDistance),
+			"API_KEY", apiKey)
+	}
+	base := &url.URL{
+		Scheme: "https",
+		Host:   "www.airnowapi.org",
+		Path:   "/aq/observation/zipCode/current/"}
+	return http_util.AppendParams(
+		base,
+		"format", "application/json",
+		"zipCode", location,
+		"distance", strconv.Itoa(kAirNowDistance),
+		"API_KEY", apiKey)
+}
+
+func getEPAUVUrl(zipCode string) *url.URL {
+	return &url.URL{
+		Scheme: "https",
+		Host:   "data.epa.gov",
+		Path: fmt.Sprintf(
+			"/efservice/getEnvirofactsUVDAILY/ZIP/%s/JSON", zipCode)}
+}
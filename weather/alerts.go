@@ -0,0 +1,109 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/keep94/appcommon/http_util"
+)
+
+// Alert represents an active weather watch, warning, or advisory.
+// These instances must be treated as immutable.
+type Alert struct {
+	// Unique ID of the alert
+	Id string
+
+	// What the alert is for e.g 'Tornado Warning'
+	Event string
+
+	// 'Extreme', 'Severe', 'Moderate', 'Minor', or 'Unknown'
+	Severity string
+
+	// One line summary of the alert
+	Headline string
+
+	// When the alert takes effect
+	Onset time.Time
+
+	// When the alert expires
+	Expires time.Time
+}
+
+// IsWarning returns true if this alert is a warning as opposed to a watch
+// or advisory.
+func (a *Alert) IsWarning() bool {
+	return strings.HasSuffix(a.Event, " Warning")
+}
+
+// AlertProvider provides active weather alerts.
+type AlertProvider interface {
+	// Alerts returns the active alerts for zone. What zone means depends
+	// on the provider. Alerts gives up as soon as ctx is done.
+	Alerts(ctx context.Context, zone string) ([]Alert, error)
+}
+
+// NWSAlertProvider provides active alerts from the National Weather
+// Service. zone is a NWS zone such as "CAZ508".
+type NWSAlertProvider struct {
+	// The client for making requests. nil means a default client that
+	// gives up after 30 seconds.
+	Client *http.Client
+}
+
+func (p *NWSAlertProvider) Alerts(
+	ctx context.Context, zone string) ([]Alert, error) {
+	resp, err := doGet(ctx, p.Client, getNWSAlertsUrl(zone))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result nwsAlerts
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	alerts := make([]Alert, len(result.Features))
+	for i := range result.Features {
+		alerts[i] = result.Features[i].Properties.toAlert()
+	}
+	return alerts, nil
+}
+
+type nwsAlerts struct {
+	Features []nwsAlertFeature `json:"features"`
+}
+
+type nwsAlertFeature struct {
+	Properties nwsAlertProperties `json:"properties"`
+}
+
+type nwsAlertProperties struct {
+	Id       string    `json:"id"`
+	Event    string    `json:"event"`
+	Severity string    `json:"severity"`
+	Headline string    `json:"headline"`
+	Onset    time.Time `json:"onset"`
+	Expires  time.Time `json:"expires"`
+}
+
+func (p *nwsAlertProperties) toAlert() Alert {
+	return Alert{
+		Id:       p.Id,
+		Event:    p.Event,
+		Severity: p.Severity,
+		Headline: p.Headline,
+		Onset:    p.Onset,
+		Expires:  p.Expires,
+	}
+}
+
+func getNWSAlertsUrl(zone string) *url.URL {
+	base := &url.URL{
+		Scheme: "https",
+		Host:   "api.weather.gov",
+		Path:   "/alerts/active"}
+	return http_util.AppendParams(base, "zone", zone)
+}
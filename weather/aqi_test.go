@@ -28,3 +28,15 @@ func TestCalculateAQI(t *testing.T) {
 	assert.Equal(500, computeAQI(500.4))
 	assert.Equal(500, computeAQI(600.5))
 }
+
+func TestAirNowUrl(t *testing.T) {
+	assert := asserts.New(t)
+	u := getAirNowUrl("key", "94043")
+	assert.Equal("/aq/observation/zipCode/current/", u.Path)
+	assert.Equal("94043", u.Query().Get("zipCode"))
+	assert.Equal("key", u.Query().Get("API_KEY"))
+	u = getAirNowUrl("key", "37.39, -122.08")
+	assert.Equal("/aq/observation/latLong/current/", u.Path)
+	assert.Equal("37.39", u.Query().Get("latitude"))
+	assert.Equal("-122.08", u.Query().Get("longitude"))
+}
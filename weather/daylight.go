@@ -0,0 +1,87 @@
+package weather
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// How bright it is outside at sunrise and sunset relative to noon on
+	// a clear day.
+	kHorizonDaylight = 0.1
+
+	// How much full overcast cuts daylight.
+	kOvercastDimming = 0.75
+
+	// The smallest factor DaylightFactor returns.
+	kMinDaylightFactor = 0.25
+)
+
+// Cloudiness estimates how cloudy it is from weather conditions such as
+// "Partly Cloudy" or "light rain" returning 0 for clear skies and 1 for
+// complete overcast.
+func Cloudiness(conditions string) float64 {
+	conditions = strings.ToLower(conditions)
+	switch {
+	case strings.Contains(conditions, "overcast"),
+		strings.Contains(conditions, "rain"),
+		strings.Contains(conditions, "drizzle"),
+		strings.Contains(conditions, "snow"),
+		strings.Contains(conditions, "thunderstorm"),
+		strings.Contains(conditions, "fog"),
+		strings.Contains(conditions, "obscured"):
+		return 1.0
+	case strings.Contains(conditions, "mostly cloudy"),
+		strings.Contains(conditions, "broken clouds"):
+		return 0.75
+	case strings.Contains(conditions, "partly cloudy"),
+		strings.Contains(conditions, "scattered clouds"):
+		return 0.5
+	case strings.Contains(conditions, "few clouds"),
+		strings.Contains(conditions, "haze"),
+		strings.Contains(conditions, "mist"):
+		return 0.25
+	case strings.Contains(conditions, "cloud"):
+		return 0.75
+	default:
+		return 0.0
+	}
+}
+
+// DaylightFactor returns how much to scale indoor lighting at now given
+// the sun times for the day and cloudiness between 0 and 1 such as
+// Cloudiness returns. The factor is 1 from dusk to dawn and on the darkest
+// days; it drops to 0.25 at noon on a clear day. Use
+// ops.ScaleBrightness to apply the factor to a HueAction.
+func DaylightFactor(
+	now time.Time, sunTimes *Daylight, cloudiness float64) float64 {
+	cloudiness = math.Max(0.0, math.Min(1.0, cloudiness))
+	daylight := outdoorDaylight(now, sunTimes) *
+		(1.0 - kOvercastDimming*cloudiness)
+	return 1.0 - (1.0-kMinDaylightFactor)*daylight
+}
+
+// outdoorDaylight returns how bright it is outside from 0 for night to 1
+// for noon on a clear day.
+func outdoorDaylight(now time.Time, sunTimes *Daylight) float64 {
+	switch {
+	case !now.After(sunTimes.Dawn) || !now.Before(sunTimes.Dusk):
+		return 0.0
+	case now.Before(sunTimes.Sunrise):
+		return kHorizonDaylight * fraction(now, sunTimes.Dawn, sunTimes.Sunrise)
+	case now.After(sunTimes.Sunset):
+		return kHorizonDaylight * fraction(now, sunTimes.Dusk, sunTimes.Sunset)
+	}
+	x := fraction(now, sunTimes.Sunrise, sunTimes.Sunset)
+	return kHorizonDaylight + (1.0-kHorizonDaylight)*math.Sin(math.Pi*x)
+}
+
+// fraction returns how far now is from start toward end between 0 and 1.
+func fraction(now, start, end time.Time) float64 {
+	total := end.Sub(start)
+	if total == 0 {
+		return 1.0
+	}
+	return float64(now.Sub(start)) / float64(total)
+}
@@ -0,0 +1,358 @@
+package weather
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/keep94/appcommon/http_util"
+)
+
+// Visibility in statute miles below which the Weather field of an
+// observation from a METAR report includes the visibility.
+const kMETARLowVisibility = 3.0
+
+const kMetersPerSecondPerKnot = 1852.0 / 3600.0
+
+var (
+	kMETARIntensities = map[string]string{
+		"-":  "Light",
+		"+":  "Heavy",
+		"VC": "Nearby",
+	}
+	kMETARDescriptors = map[string]string{
+		"MI": "Shallow",
+		"PR": "Partial",
+		"BC": "Patches",
+		"DR": "Low Drifting",
+		"BL": "Blowing",
+		"SH": "Showers",
+		"TS": "Thunderstorm",
+		"FZ": "Freezing",
+	}
+	kMETARPhenomena = map[string]string{
+		"DZ": "Drizzle",
+		"RA": "Rain",
+		"SN": "Snow",
+		"SG": "Snow Grains",
+		"IC": "Ice Crystals",
+		"PL": "Ice Pellets",
+		"GR": "Hail",
+		"GS": "Small Hail",
+		"UP": "Unknown Precipitation",
+		"BR": "Mist",
+		"FG": "Fog",
+		"FU": "Smoke",
+		"VA": "Volcanic Ash",
+		"DU": "Dust",
+		"SA": "Sand",
+		"HZ": "Haze",
+		"PY": "Spray",
+		"PO": "Dust Whirls",
+		"SQ": "Squalls",
+		"FC": "Funnel Cloud",
+		"SS": "Sandstorm",
+		"DS": "Duststorm",
+	}
+	kMETARSkyConditions = map[string]string{
+		"SKC": "Fair",
+		"CLR": "Fair",
+		"NSC": "Fair",
+		"NCD": "Fair",
+		"FEW": "A Few Clouds",
+		"SCT": "Partly Cloudy",
+		"BKN": "Mostly Cloudy",
+		"OVC": "Overcast",
+		"VV":  "Obscured",
+	}
+	kMETARSkyRanks = map[string]int{
+		"SKC": 1, "CLR": 1, "NSC": 1, "NCD": 1,
+		"FEW": 2, "SCT": 3, "BKN": 4, "OVC": 5, "VV": 6,
+	}
+)
+
+// GetMETAR returns the current observation from the latest METAR report
+// that aviationweather.gov has for an airport weather station such as
+// "KNUQ". GetMETAR gives up after 30 seconds.
+func GetMETAR(station string) (observation *Observation, err error) {
+	return GetMETARWithContext(context.Background(), nil, station)
+}
+
+// GetMETARWithContext works like GetMETAR except that it gives up as soon
+// as ctx is done and uses client to make the request. If client is nil,
+// GetMETARWithContext uses a default client that gives up after 30 seconds.
+func GetMETARWithContext(
+	ctx context.Context, client *http.Client, station string) (
+	observation *Observation, err error) {
+	var resp *http.Response
+	if resp, err = doGet(ctx, client, getMETARUrl(station)); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if report := strings.TrimSpace(scanner.Text()); report != "" {
+			return ParseMETAR(report)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	return nil, errors.New(fmt.Sprintf("weather:No METAR found for %s", station))
+}
+
+// ParseMETAR converts a raw METAR report such as
+// "KNUQ 161756Z 32010KT 10SM FEW015 22/12 A2999" to an observation.
+// The Weather field of the returned observation describes the present
+// weather if the report has any, such as "Light Rain"; otherwise it
+// describes the sky condition such as "Partly Cloudy". When visibility
+// is poor, the Weather field includes it.
+func ParseMETAR(report string) (*Observation, error) {
+	fields := strings.Fields(report)
+	var temperature float64
+	foundTemperature := false
+	var phenomena []string
+	skyCondition := ""
+	skyRank := 0
+	visibility := -1.0
+	windSpeed := 0.0
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if field == "RMK" {
+			break
+		}
+		if field == "TEMPO" || field == "BECMG" {
+			break
+		}
+		if w, ok := parseWind(field); ok {
+			windSpeed = w
+			continue
+		}
+		if v, ok := parseVisibility(fields, &i); ok {
+			visibility = v
+			continue
+		}
+		if t, ok := parseTemperature(field); ok {
+			temperature = t
+			foundTemperature = true
+			continue
+		}
+		if cover, ok := parseSkyCondition(field); ok {
+			if kMETARSkyRanks[cover] > skyRank {
+				skyRank = kMETARSkyRanks[cover]
+				skyCondition = kMETARSkyConditions[cover]
+			}
+			continue
+		}
+		if weather, ok := parsePresentWeather(field); ok {
+			phenomena = append(phenomena, weather)
+		}
+	}
+	if !foundTemperature {
+		return nil, errors.New("weather:Missing temperature in METAR report")
+	}
+	description := strings.Join(phenomena, ", ")
+	if description == "" {
+		description = skyCondition
+	}
+	if visibility >= 0 && visibility < kMETARLowVisibility {
+		visibilityStr := fmt.Sprintf(
+			"Visibility %s mi", strconv.FormatFloat(visibility, 'f', -1, 64))
+		if description == "" {
+			description = visibilityStr
+		} else {
+			description = description + ", " + visibilityStr
+		}
+	}
+	return &Observation{
+		Temperature: temperature,
+		Weather:     description,
+		WindSpeed:   windSpeed,
+	}, nil
+}
+
+// parseWind parses a wind group like "32010KT", "VRB03KT", or
+// "27015G25KT" returning the sustained wind speed in meters per second.
+func parseWind(field string) (float64, bool) {
+	factor := kMetersPerSecondPerKnot
+	var speed string
+	switch {
+	case strings.HasSuffix(field, "KT"):
+		speed = strings.TrimSuffix(field, "KT")
+	case strings.HasSuffix(field, "MPS"):
+		speed = strings.TrimSuffix(field, "MPS")
+		factor = 1.0
+	default:
+		return 0, false
+	}
+	if len(speed) < 5 {
+		return 0, false
+	}
+	if direction := speed[:3]; direction != "VRB" && !isDigits(direction) {
+		return 0, false
+	}
+	speed = speed[3:]
+	if idx := strings.Index(speed, "G"); idx != -1 {
+		if !isDigits(speed[idx+1:]) {
+			return 0, false
+		}
+		speed = speed[:idx]
+	}
+	if !isDigits(speed) {
+		return 0, false
+	}
+	value, _ := strconv.Atoi(speed)
+	return float64(value) * factor, true
+}
+
+// parseVisibility parses the visibility at fields[*idx] in statute
+// miles. Visibility like "1 1/2SM" spans two fields in which case
+// parseVisibility advances *idx past the first one.
+func parseVisibility(fields []string, idx *int) (float64, bool) {
+	field := fields[*idx]
+	if field == "CAVOK" {
+		return 10.0, true
+	}
+	if len(field) == 4 && isDigits(field) && *idx > 1 {
+		// Meters. 9999 means 10km or more.
+		meters, _ := strconv.Atoi(field)
+		return float64(meters) / 1609.344, true
+	}
+	if !strings.HasSuffix(field, "SM") {
+		if *idx+1 < len(fields) && isDigits(field) &&
+			strings.HasSuffix(fields[*idx+1], "SM") {
+			whole, _ := strconv.Atoi(field)
+			fraction, ok := parseMiles(strings.TrimSuffix(fields[*idx+1], "SM"))
+			if ok {
+				*idx++
+				return float64(whole) + fraction, true
+			}
+		}
+		return 0, false
+	}
+	miles := strings.TrimPrefix(strings.TrimPrefix(
+		strings.TrimSuffix(field, "SM"), "P"), "M")
+	return parseMiles(miles)
+}
+
+func parseMiles(miles string) (float64, bool) {
+	if parts := strings.Split(miles, "/"); len(parts) == 2 {
+		numerator, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return 0, false
+		}
+		denominator, err := strconv.Atoi(parts[1])
+		if err != nil || denominator == 0 {
+			return 0, false
+		}
+		return float64(numerator) / float64(denominator), true
+	}
+	result, err := strconv.Atoi(miles)
+	if err != nil {
+		return 0, false
+	}
+	return float64(result), true
+}
+
+// parseTemperature parses a temperature group like "22/12" or "M05/M10"
+// returning the temperature in celsius.
+func parseTemperature(field string) (float64, bool) {
+	parts := strings.Split(field, "/")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	sign := 1.0
+	temp := parts[0]
+	if strings.HasPrefix(temp, "M") {
+		sign = -1.0
+		temp = temp[1:]
+	}
+	if len(temp) != 2 || !isDigits(temp) {
+		return 0, false
+	}
+	dewPoint := strings.TrimPrefix(parts[1], "M")
+	if dewPoint != "" && !isDigits(dewPoint) {
+		return 0, false
+	}
+	value, _ := strconv.Atoi(temp)
+	return sign * float64(value), true
+}
+
+// parseSkyCondition parses a sky condition group like "BKN015" returning
+// its cover such as "BKN".
+func parseSkyCondition(field string) (string, bool) {
+	if _, ok := kMETARSkyRanks[field]; ok {
+		return field, true
+	}
+	for _, cover := range []string{"FEW", "SCT", "BKN", "OVC", "VV"} {
+		if !strings.HasPrefix(field, cover) {
+			continue
+		}
+		height := strings.TrimSuffix(strings.TrimSuffix(
+			field[len(cover):], "CB"), "TCU")
+		if len(height) == 3 && (isDigits(height) || height == "///") {
+			return cover, true
+		}
+	}
+	return "", false
+}
+
+// parsePresentWeather parses a present weather group like "-SHRA"
+// returning a description such as "Light Showers Rain".
+func parsePresentWeather(field string) (string, bool) {
+	var words []string
+	rest := field
+	for _, intensity := range []string{"-", "+", "VC"} {
+		if strings.HasPrefix(rest, intensity) {
+			words = append(words, kMETARIntensities[intensity])
+			rest = rest[len(intensity):]
+			break
+		}
+	}
+	if len(rest) < 2 || len(rest)%2 != 0 {
+		return "", false
+	}
+	foundPhenomenon := false
+	for i := 0; i < len(rest); i += 2 {
+		code := rest[i : i+2]
+		if word, ok := kMETARDescriptors[code]; ok && i == 0 {
+			words = append(words, word)
+			continue
+		}
+		word, ok := kMETARPhenomena[code]
+		if !ok {
+			return "", false
+		}
+		words = append(words, word)
+		foundPhenomenon = true
+	}
+	if !foundPhenomenon && rest != "TS" {
+		return "", false
+	}
+	return strings.Join(words, " "), true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func getMETARUrl(station string) *url.URL {
+	base := &url.URL{
+		Scheme: "https",
+		Host:   "aviationweather.gov",
+		Path:   "/api/data/metar"}
+	return http_util.AppendParams(base, "ids", station, "format", "raw")
+}
@@ -0,0 +1,126 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+)
+
+var kNoStations = errors.New("weather:No stations")
+
+// Aggregator gets one observation from several stations using provider.
+// Aggregator returns an error only if it could get no observation at all.
+type Aggregator func(
+	ctx context.Context,
+	provider Provider,
+	stations []string) (*Observation, error)
+
+// Coordinates represents a location on the earth. Latitude is positive for
+// north and negative for south. Longitude is positive for east and
+// negative for west.
+type Coordinates struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// MultiGet returns the current observation from the first NOAA weather
+// station in stations that reports one. MultiGet is the same as
+// calling FirstSuccess with a NOAAProvider.
+func MultiGet(stations []string) (*Observation, error) {
+	return FirstSuccess(context.Background(), &NOAAProvider{}, stations)
+}
+
+// FirstSuccess tries stations one at a time in order and returns the
+// first observation it gets. If every station fails, FirstSuccess returns
+// the error from the last one.
+func FirstSuccess(
+	ctx context.Context,
+	provider Provider,
+	stations []string) (*Observation, error) {
+	err := kNoStations
+	for _, station := range stations {
+		var observation *Observation
+		if observation, err = provider.Current(ctx, station); err == nil {
+			return observation, nil
+		}
+	}
+	return nil, err
+}
+
+// Average fetches from all stations at once. The returned observation has
+// the average temperature of the stations that reported and the weather
+// conditions of the first of those stations in stations. If every station
+// fails, Average returns the error from the first one.
+func Average(
+	ctx context.Context,
+	provider Provider,
+	stations []string) (*Observation, error) {
+	if len(stations) == 0 {
+		return nil, kNoStations
+	}
+	observations := make([]*Observation, len(stations))
+	errs := make([]error, len(stations))
+	var wg sync.WaitGroup
+	for i := range stations {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			observations[i], errs[i] = provider.Current(ctx, stations[i])
+		}(i)
+	}
+	wg.Wait()
+	var result *Observation
+	count := 0
+	total := 0.0
+	for _, observation := range observations {
+		if observation == nil {
+			continue
+		}
+		if result == nil {
+			result = &Observation{
+				Weather: observation.Weather, Units: observation.Units}
+		}
+		total += observation.Temperature
+		count++
+	}
+	if result == nil {
+		return nil, errs[0]
+	}
+	result.Temperature = total / float64(count)
+	return result, nil
+}
+
+// Nearest returns an Aggregator that works like FirstSuccess except that
+// it tries stations in order of their distance from home. locations
+// gives the location of each station. Nearest tries stations missing from
+// locations last in their original order.
+func Nearest(home Coordinates, locations map[string]Coordinates) Aggregator {
+	return func(
+		ctx context.Context,
+		provider Provider,
+		stations []string) (*Observation, error) {
+		byDistance := make([]string, len(stations))
+		copy(byDistance, stations)
+		sort.SliceStable(byDistance, func(i, j int) bool {
+			iloc, iok := locations[byDistance[i]]
+			jloc, jok := locations[byDistance[j]]
+			if !iok || !jok {
+				return iok && !jok
+			}
+			return distance(home, iloc) < distance(home, jloc)
+		})
+		return FirstSuccess(ctx, provider, byDistance)
+	}
+}
+
+// distance returns the angle in radians between two locations as seen from
+// the center of the earth.
+func distance(a, b Coordinates) float64 {
+	dlat := (b.Latitude - a.Latitude) * math.Pi / 180.0
+	dlon := (b.Longitude - a.Longitude) * math.Pi / 180.0
+	h := math.Pow(math.Sin(dlat/2.0), 2) +
+		cosDeg(a.Latitude)*cosDeg(b.Latitude)*math.Pow(math.Sin(dlon/2.0), 2)
+	return 2.0 * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,95 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	asserts "github.com/stretchr/testify/assert"
+)
+
+func TestOpenWeatherParams(t *testing.T) {
+	assert := asserts.New(t)
+	assert.Equal([]string{"id", "5375480"}, openWeatherParams("5375480"))
+	assert.Equal(
+		[]string{"lat", "37.39", "lon", "-122.08"},
+		openWeatherParams("37.39, -122.08"))
+	assert.Equal(
+		[]string{"q", "Mountain View,US"},
+		openWeatherParams("Mountain View,US"))
+}
+
+func TestOpenWeatherGetLocation(t *testing.T) {
+	assert := asserts.New(t)
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			fmt.Fprint(w, `{"weather":[{"description":"light rain"}],"main":{"temp":283.15},"wind":{"speed":4.5}}`)
+		}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+	conn := &OpenWeatherConn{url: serverUrl}
+	provider := &OpenWeatherProvider{Conn: conn}
+	observation, err := provider.Current(
+		context.Background(), "37.39,-122.08")
+	assert.NoError(err)
+	assert.Equal("light rain", observation.Weather)
+	assert.InDelta(10.0, observation.Temperature, 0.001)
+	assert.Equal(4.5, observation.WindSpeed)
+	assert.Equal("37.39", query.Get("lat"))
+	assert.Equal("-122.08", query.Get("lon"))
+}
+
+func TestOpenWeatherMissingMain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"weather":[{"description":"clear sky"}]}`)
+		}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+	conn := &OpenWeatherConn{url: serverUrl}
+	_, err := conn.Get("5375480")
+	asserts.Error(t, err)
+}
+
+func TestOpenWeatherImperial(t *testing.T) {
+	assert := asserts.New(t)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"weather":[{"description":"clear sky"}],"main":{"temp":283.15},"wind":{"speed":10.0}}`)
+		}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+	conn := &OpenWeatherConn{url: serverUrl, units: Imperial}
+	observation, err := conn.Get("5375480")
+	assert.NoError(err)
+	assert.Equal(Imperial, observation.Units)
+	assert.InDelta(50.0, observation.Temperature, 0.001)
+	assert.InDelta(22.369, observation.WindSpeed, 0.001)
+}
+
+func TestOpenWeatherContext(t *testing.T) {
+	assert := asserts.New(t)
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+	defer server.Close()
+	defer close(done)
+	serverUrl, _ := url.Parse(server.URL)
+	conn := &OpenWeatherConn{url: serverUrl}
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := conn.GetLocationWithContext(ctx, "5375480")
+	assert.Error(err)
+	conn = conn.WithClient(&http.Client{Timeout: 10 * time.Millisecond})
+	_, err = conn.Get("5375480")
+	assert.Error(err)
+}
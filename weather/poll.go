@@ -0,0 +1,117 @@
+package weather
+
+import (
+	"context"
+	"time"
+
+	"github.com/keep94/tasks"
+)
+
+// How long a poll task first waits to retry after an error. The wait
+// doubles with each consecutive error up to the poll interval.
+const kInitialBackoff = 30 * time.Second
+
+// ObservationLog records observations that poll tasks fetch.
+// Implementations must be safe to use with multiple goroutines.
+type ObservationLog interface {
+	// LogObservation records that observation for station was fetched
+	// at fetchedAt.
+	LogObservation(
+		station string, observation *Observation, fetchedAt time.Time) error
+}
+
+// NewPollTask returns a task that uses provider to get the current
+// observation for station every interval and stores it in cache. When
+// provider fails, the task retries with exponential backoff starting at
+// 30 seconds but never waiting longer than interval. The task leaves the
+// cache's observation alone when provider fails, but records the error
+// with cache.SetError and reports it through its execution. The task
+// runs until ended; ending the task cancels any request in progress. Use
+// utils.TaskToScheduledTask to run the returned task in the background.
+func NewPollTask(
+	provider Provider,
+	station string,
+	interval time.Duration,
+	cache *Cache) tasks.Task {
+	return NewPollTaskWithLog(provider, station, interval, cache, nil)
+}
+
+// NewPollTaskWithLog works like NewPollTask except that the returned
+// task also records each observation it fetches with log. The task
+// reports errors from log through its execution. log may be nil.
+func NewPollTaskWithLog(
+	provider Provider,
+	station string,
+	interval time.Duration,
+	cache *Cache,
+	log ObservationLog) tasks.Task {
+	return tasks.TaskFunc(func(e *tasks.Execution) {
+		poll(e, interval, func(ctx context.Context) error {
+			observation, err := provider.Current(ctx, station)
+			if err != nil {
+				cache.SetError(err)
+				return err
+			}
+			cache.Set(observation)
+			if log != nil {
+				e.SetError(log.LogObservation(station, observation, e.Now()))
+			}
+			return nil
+		})
+	})
+}
+
+// NewAlertPollTask returns a task that uses provider to get the active
+// alerts for zone every interval and stores them in cache with
+// cache.SetAlerts. The returned task retries errors like the task
+// NewPollTask returns.
+func NewAlertPollTask(
+	provider AlertProvider,
+	zone string,
+	interval time.Duration,
+	cache *Cache) tasks.Task {
+	return tasks.TaskFunc(func(e *tasks.Execution) {
+		poll(e, interval, func(ctx context.Context) error {
+			alerts, err := provider.Alerts(ctx, zone)
+			if err != nil {
+				return err
+			}
+			cache.SetAlerts(alerts)
+			return nil
+		})
+	})
+}
+
+// poll calls fetch every interval until e ends backing off exponentially
+// when fetch returns an error. Ending e cancels the context passed to
+// fetch.
+func poll(
+	e *tasks.Execution,
+	interval time.Duration,
+	fetch func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-e.Ended():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	backoff := kInitialBackoff
+	for {
+		wait := interval
+		if err := fetch(ctx); err != nil {
+			e.SetError(err)
+			if backoff < interval {
+				wait = backoff
+			}
+			backoff *= 2
+		} else {
+			backoff = kInitialBackoff
+		}
+		if !e.Sleep(wait) {
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package weather
+
+import (
+	"context"
+	"net/http"
+)
+
+// Provider provides current weather observations from one weather
+// service.
+type Provider interface {
+	// Current returns the current observation at location. What location
+	// means depends on the provider. Current gives up as soon as ctx is
+	// done.
+	Current(ctx context.Context, location string) (*Observation, error)
+}
+
+// ProviderFunc converts an ordinary function into a Provider.
+type ProviderFunc func(
+	ctx context.Context, location string) (*Observation, error)
+
+func (f ProviderFunc) Current(
+	ctx context.Context, location string) (*Observation, error) {
+	return f(ctx, location)
+}
+
+// NOAAProvider provides observations from NOAA weather stations. location
+// is a station such as "KNUQ".
+type NOAAProvider struct {
+	// The client for making requests. nil means a default client that
+	// gives up after 30 seconds.
+	Client *http.Client
+
+	// The base URL of the NOAA server such as the URL of a local caching
+	// proxy. Empty means "https://w1.weather.gov".
+	BaseURL string
+}
+
+func (p *NOAAProvider) Current(
+	ctx context.Context, location string) (*Observation, error) {
+	return getNOAA(ctx, p.Client, p.BaseURL, location)
+}
+
+// METARProvider provides observations from the METAR reports of airport
+// weather stations. location is a station such as "KNUQ".
+type METARProvider struct {
+	// The client for making requests. nil means a default client that
+	// gives up after 30 seconds.
+	Client *http.Client
+}
+
+func (p *METARProvider) Current(
+	ctx context.Context, location string) (*Observation, error) {
+	return GetMETARWithContext(ctx, p.Client, location)
+}
+
+// OpenWeatherProvider provides observations from open weather. location
+// takes the forms that OpenWeatherConn.GetLocation takes.
+type OpenWeatherProvider struct {
+	// The connection to open weather
+	Conn *OpenWeatherConn
+}
+
+func (p *OpenWeatherProvider) Current(
+	ctx context.Context, location string) (*Observation, error) {
+	return p.Conn.GetLocationWithContext(ctx, location)
+}
+
+// WithUnits returns a Provider that works like provider except that it
+// returns observations in units.
+func WithUnits(provider Provider, units Units) Provider {
+	return &unitsProvider{delegate: provider, units: units}
+}
+
+type unitsProvider struct {
+	delegate Provider
+	units    Units
+}
+
+func (p *unitsProvider) Current(
+	ctx context.Context, location string) (*Observation, error) {
+	observation, err := p.delegate.Current(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return observation.In(p.units), nil
+}
@@ -0,0 +1,107 @@
+package weather
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	kJulianEpoch = 2451545.0
+	kUnixEpoch   = int64(946728000)
+
+	// Elevation of the sun's center in degrees at sunrise and sunset
+	// accounting for refraction and the sun's radius.
+	kSunriseElevation = -0.83
+
+	// Elevation of the sun's center in degrees at the start of dawn and
+	// end of dusk.
+	kCivilTwilightElevation = -6.0
+)
+
+// Daylight gives the sunrise, sunset, and civil twilight times for a day.
+// These instances must be treated as immutable.
+type Daylight struct {
+	// Start of civil twilight
+	Dawn time.Time
+
+	// Sunrise
+	Sunrise time.Time
+
+	// Sunset
+	Sunset time.Time
+
+	// End of civil twilight
+	Dusk time.Time
+}
+
+// SunTimes computes the sunrise, sunset, and civil twilight times for the
+// day that date falls on in date's timezone. latitude is positive for north
+// and negative for south; longitude is positive for east and negative for
+// west. SunTimes needs no network access. The returned times are in the
+// same timezone as date. On days when the sun never rises, the sunrise and
+// sunset both equal solar noon; on days when it never sets, they are 12
+// hours before and after solar noon. The same goes for dawn and dusk.
+func SunTimes(latitude, longitude float64, date time.Time) *Daylight {
+	year, month, day := date.Date()
+	noon := time.Date(year, month, day, 12, 0, 0, 0, date.Location())
+	jstar := math.Floor(
+		julianDay(noon)-0.0009+longitude/360.0+0.5) + 0.0009 - longitude/360.0
+	meanAnomaly := mod360(357.5291 + 0.98560028*(jstar-kJulianEpoch))
+	center := 1.9148*sinDeg(meanAnomaly) +
+		0.02*sinDeg(2.0*meanAnomaly) +
+		0.0003*sinDeg(3.0*meanAnomaly)
+	eclipticLongitude := mod360(meanAnomaly + 102.9372 + center + 180.0)
+	solarNoon := jstar + 0.0053*sinDeg(meanAnomaly) -
+		0.0069*sinDeg(2.0*eclipticLongitude)
+	declination := asinDeg(sinDeg(eclipticLongitude) * sinDeg(23.45))
+	sunrise := hourAngleInDays(latitude, declination, kSunriseElevation)
+	twilight := hourAngleInDays(latitude, declination, kCivilTwilightElevation)
+	loc := date.Location()
+	return &Daylight{
+		Dawn:    goTime(solarNoon-twilight, loc),
+		Sunrise: goTime(solarNoon-sunrise, loc),
+		Sunset:  goTime(solarNoon+sunrise, loc),
+		Dusk:    goTime(solarNoon+twilight, loc),
+	}
+}
+
+func hourAngleInDays(latitude, declination, elevation float64) float64 {
+	return acosDeg(
+		(sinDeg(elevation)-sinDeg(latitude)*sinDeg(declination))/
+			(cosDeg(latitude)*cosDeg(declination))) / 360.0
+}
+
+func julianDay(t time.Time) float64 {
+	return float64(t.Unix()-kUnixEpoch)/86400.0 + kJulianEpoch
+}
+
+func goTime(julianDay float64, loc *time.Location) time.Time {
+	unix := kUnixEpoch + int64((julianDay-kJulianEpoch)*86400.0)
+	return time.Unix(unix, 0).In(loc)
+}
+
+func sinDeg(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180.0)
+}
+
+func cosDeg(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180.0)
+}
+
+func asinDeg(x float64) float64 {
+	return math.Asin(x) * 180.0 / math.Pi
+}
+
+func acosDeg(x float64) float64 {
+	if x >= 1.0 {
+		return 0.0
+	}
+	if x <= -1.0 {
+		return 180.0
+	}
+	return math.Acos(x) * 180.0 / math.Pi
+}
+
+func mod360(x float64) float64 {
+	return x - 360.0*math.Floor(x/360.0)
+}
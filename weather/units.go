@@ -0,0 +1,64 @@
+package weather
+
+// Units tells what units an observation uses.
+type Units int
+
+const (
+	// Temperature in celsius; wind speed in meters per second.
+	Metric Units = iota
+
+	// Temperature in fahrenheit; wind speed in miles per hour.
+	Imperial
+)
+
+const kMetersPerMile = 1609.344
+
+func (u Units) String() string {
+	switch u {
+	case Metric:
+		return "Metric"
+	case Imperial:
+		return "Imperial"
+	default:
+		return "Unknown"
+	}
+}
+
+// CelsiusToFahrenheit converts celsius to fahrenheit.
+func CelsiusToFahrenheit(celsius float64) float64 {
+	return celsius*9.0/5.0 + 32.0
+}
+
+// FahrenheitToCelsius converts fahrenheit to celsius.
+func FahrenheitToCelsius(fahrenheit float64) float64 {
+	return (fahrenheit - 32.0) * 5.0 / 9.0
+}
+
+// MetersPerSecondToMPH converts meters per second to miles per hour.
+func MetersPerSecondToMPH(metersPerSecond float64) float64 {
+	return metersPerSecond * 3600.0 / kMetersPerMile
+}
+
+// MPHToMetersPerSecond converts miles per hour to meters per second.
+func MPHToMetersPerSecond(mph float64) float64 {
+	return mph * kMetersPerMile / 3600.0
+}
+
+// In returns this observation converted to units. In returns this same
+// observation if it already uses units.
+func (o *Observation) In(units Units) *Observation {
+	if o.Units == units {
+		return o
+	}
+	result := *o
+	result.Units = units
+	switch units {
+	case Imperial:
+		result.Temperature = CelsiusToFahrenheit(o.Temperature)
+		result.WindSpeed = MetersPerSecondToMPH(o.WindSpeed)
+	case Metric:
+		result.Temperature = FahrenheitToCelsius(o.Temperature)
+		result.WindSpeed = MPHToMetersPerSecond(o.WindSpeed)
+	}
+	return &result
+}
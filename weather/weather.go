@@ -2,17 +2,22 @@
 package weather
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"path"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/keep94/appcommon/http_util"
+	"github.com/keep94/tasks"
 	"golang.org/x/net/html/charset"
 )
 
@@ -32,42 +37,112 @@ type Report struct {
 // Observation represents a weather observation.
 // These instances must be treated as immutable.
 type Observation struct {
-	// Temperature in celsius
+	// Temperature in celsius or fahrenheit depending on Units
 	Temperature float64 `xml:"temp_c"`
 	// Weather conditions e.g 'Fair' or 'Partly Cloudy'
 	Weather string `xml:"weather"`
+	// Wind speed in meters per second or miles per hour depending on Units
+	WindSpeed float64 `xml:"-"`
+	// The units of this observation. Providers return Metric observations
+	// unless asked otherwise.
+	Units Units `xml:"-"`
+	// The Air Quality Index (0-500). 0 if the provider does not report it.
+	AQI int `xml:"-"`
+	// The UV index. 0 if the provider does not report it.
+	UVIndex float64 `xml:"-"`
 }
 
+// How long the default HTTP client waits for a weather service to respond.
+const kDefaultTimeout = 30 * time.Second
+
+// Where NOAA current observations come from by default.
+const kNOAABaseUrl = "https://w1.weather.gov"
+
+// The User-Agent sent with each request. Some services such as the
+// National Weather Service reject requests without one.
+const kUserAgent = "marvin (github.com/keep94/marvin)"
+
+var kDefaultClient = &http.Client{Timeout: kDefaultTimeout}
+
 // Get returns the current observation from a NOAA weather station. For example
-// "KNUQ" means moffett field.
+// "KNUQ" means moffett field. Get gives up after 30 seconds.
 func Get(station string) (observation *Observation, err error) {
-	request := &http.Request{
-		Method: "GET",
-		URL:    getUrl(station)}
-	var client http.Client
+	return GetWithContext(context.Background(), nil, station)
+}
+
+// GetWithContext works like Get except that it gives up as soon as ctx is
+// done and uses client to make the request. If client is nil,
+// GetWithContext uses a default client that gives up after 30 seconds.
+func GetWithContext(
+	ctx context.Context, client *http.Client, station string) (
+	observation *Observation, err error) {
+	return getNOAA(ctx, client, "", station)
+}
+
+// StatusError reports that a weather service responded with a status
+// other than 200 OK.
+type StatusError struct {
+	// The HTTP status code such as 503
+	StatusCode int
+
+	// The URL requested
+	URL string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf(
+		"weather:Got status %d fetching %s", e.StatusCode, e.URL)
+}
+
+func getNOAA(
+	ctx context.Context,
+	client *http.Client,
+	baseUrl, station string) (observation *Observation, err error) {
+	var u *url.URL
+	if u, err = getUrl(baseUrl, station); err != nil {
+		return
+	}
 	var resp *http.Response
-	if resp, err = client.Do(request); err != nil {
+	if resp, err = doGet(ctx, client, u); err != nil {
 		return
 	}
 	defer resp.Body.Close()
 	decoder := xml.NewDecoder(resp.Body)
 	decoder.CharsetReader = charset.NewReaderLabel
-	var result Observation
+	var result noaaObservation
 	if err = decoder.Decode(&result); err != nil {
 		return
 	}
-	return &result, nil
+	result.Observation.WindSpeed = MPHToMetersPerSecond(result.WindMPH)
+	return &result.Observation, nil
 }
 
 // OpenWeatherConn represents a connection to the open weather servers
 type OpenWeatherConn struct {
-	client http.Client
+	client *http.Client
 	url    *url.URL
+	units  Units
 }
 
 // NewOpenWeatherConn returns a new, long lived, open weather connection.
+// The returned connection returns Metric observations.
 func NewOpenWeatherConn(apiKey string) *OpenWeatherConn {
-	return &OpenWeatherConn{url: getOpenWeatherUrl(apiKey)}
+	return NewOpenWeatherConnWithUnits(apiKey, Metric)
+}
+
+// NewOpenWeatherConnWithUnits works like NewOpenWeatherConn except that
+// the returned connection returns observations in units.
+func NewOpenWeatherConnWithUnits(apiKey string, units Units) *OpenWeatherConn {
+	return &OpenWeatherConn{url: getOpenWeatherUrl(apiKey), units: units}
+}
+
+// WithClient returns a connection like this one that uses client to make
+// requests. By default, connections use a client that gives up after 30
+// seconds.
+func (c *OpenWeatherConn) WithClient(client *http.Client) *OpenWeatherConn {
+	result := *c
+	result.client = client
+	return &result
 }
 
 // Get returns the weather for a particular city. The city ID for a city
@@ -76,11 +151,40 @@ func NewOpenWeatherConn(apiKey string) *OpenWeatherConn {
 // is "5375480"
 func (c *OpenWeatherConn) Get(cityId string) (
 	observation *Observation, err error) {
-	request := &http.Request{
-		Method: "GET",
-		URL:    http_util.AppendParams(c.url, "id", cityId)}
+	return c.GetWithContext(context.Background(), cityId)
+}
+
+// GetWithContext works like Get except that it gives up as soon as ctx
+// is done.
+func (c *OpenWeatherConn) GetWithContext(
+	ctx context.Context, cityId string) (
+	observation *Observation, err error) {
+	return c.get(ctx, "id", cityId)
+}
+
+// GetLocation returns the weather for a location. location is either a
+// city ID like Get takes, a latitude and longitude separated by a comma
+// such as "37.39,-122.08", or a city name such as "Mountain View,US".
+func (c *OpenWeatherConn) GetLocation(location string) (
+	observation *Observation, err error) {
+	return c.GetLocationWithContext(context.Background(), location)
+}
+
+// GetLocationWithContext works like GetLocation except that it gives up as
+// soon as ctx is done.
+func (c *OpenWeatherConn) GetLocationWithContext(
+	ctx context.Context, location string) (
+	observation *Observation, err error) {
+	return c.get(ctx, openWeatherParams(location)...)
+}
+
+func (c *OpenWeatherConn) get(ctx context.Context, nameValues ...string) (
+	observation *Observation, err error) {
 	var resp *http.Response
-	if resp, err = c.client.Do(request); err != nil {
+	if resp, err = doGet(
+		ctx,
+		c.client,
+		http_util.AppendParams(c.url, nameValues...)); err != nil {
 		return
 	}
 	defer resp.Body.Close()
@@ -97,10 +201,21 @@ func (c *OpenWeatherConn) Get(cityId string) (
 		err = errors.New("weather:Missing main section in open weather response")
 		return
 	}
-	return &Observation{
+	observation = &Observation{
 		Temperature: result.Main.Temp - 273.15,
 		Weather:     result.Weather[0].Description,
-	}, nil
+	}
+	if result.Wind != nil {
+		observation.WindSpeed = result.Wind.Speed
+	}
+	return observation.In(c.units), nil
+}
+
+// GetOWM returns the current observation from open weather for a
+// location using apiKey. See OpenWeatherConn.GetLocation for the forms
+// that cityOrCoords can take.
+func GetOWM(apiKey, cityOrCoords string) (*Observation, error) {
+	return NewOpenWeatherConn(apiKey).GetLocation(cityOrCoords)
 }
 
 // PurpleAirConn represents a connection to purple air
@@ -109,7 +224,9 @@ type PurpleAirConn struct {
 	url    *url.URL
 }
 
-var kPurpleAirConn = &PurpleAirConn{url: getPurpleAirUrl()}
+var kPurpleAirConn = &PurpleAirConn{
+	client: http.Client{Timeout: kDefaultTimeout},
+	url:    getPurpleAirUrl()}
 
 // NewPurpleAirConn returns a new, long lived, purple air connection.
 func NewPurpleAirConn() *PurpleAirConn {
@@ -183,25 +300,118 @@ func (r *ReportCache) set(
 	return result
 }
 
+// How many observations a Cache remembers: a day's worth when polling
+// every 5 minutes.
+const kCacheHistorySize = 288
+
+// TimedObservation is an observation along with when it was fetched.
+type TimedObservation struct {
+	*Observation
+	FetchedAt time.Time
+}
+
 // Cache stores a single weather observation and notifies clients when
 // this observation changes. Cache instances can be safely used with
 // multiple goroutines.
 type Cache struct {
+	clock       tasks.Clock
 	lock        sync.Mutex
 	observation *Observation
+	fetchedAt   time.Time
+	lastError   error
+	history     []TimedObservation
+	historyEnd  int
+	alerts      []Alert
 	stale       chan struct{}
+	hasLocation bool
+	latitude    float64
+	longitude   float64
+	daylight    *Daylight
+	daylightDay time.Time
 }
 
 // NewCache creates a new cache containing no observation.
 func NewCache() *Cache {
-	return &Cache{stale: make(chan struct{})}
+	return NewCacheWithClock(tasks.SystemClock())
+}
+
+// NewCacheWithClock works like NewCache but lets caller supply the clock
+// that determines when observations are fetched.
+func NewCacheWithClock(clock tasks.Clock) *Cache {
+	return &Cache{clock: clock, stale: make(chan struct{})}
 }
 
 // Set updates the observation in this cache and notifies all waiting clients.
+// Set records the current time as the time the observation was fetched
+// and clears any error that SetError recorded.
 func (c *Cache) Set(observation *Observation) {
 	close(c.set(observation, make(chan struct{})))
 }
 
+// SetError records that fetching a new observation failed with err.
+// SetError leaves the current observation alone and does not notify
+// waiting clients.
+func (c *Cache) SetError(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lastError = err
+}
+
+// History returns up to the last n observations stored in this cache
+// oldest first along with when they were fetched. A cache remembers the
+// last 288 observations.
+func (c *Cache) History(n int) []TimedObservation {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if n > len(c.history) {
+		n = len(c.history)
+	}
+	if n <= 0 {
+		return nil
+	}
+	result := make([]TimedObservation, n)
+	start := c.historyEnd - n
+	for i := range result {
+		result[i] = c.history[(start+i+len(c.history))%len(c.history)]
+	}
+	return result
+}
+
+// SetAlerts replaces the active weather alerts in this cache. SetAlerts
+// leaves the current observation alone and does not notify waiting
+// clients.
+func (c *Cache) SetAlerts(alerts []Alert) {
+	stored := make([]Alert, len(alerts))
+	copy(stored, alerts)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.alerts = stored
+}
+
+// Alerts returns the alerts from the most recent call to SetAlerts.
+// Caller must not modify the returned slice.
+func (c *Cache) Alerts() []Alert {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.alerts
+}
+
+// LastError returns the error from the most recent failed fetch or nil
+// if the most recent fetch succeeded.
+func (c *Cache) LastError() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lastError
+}
+
+// LastSuccess returns when the current observation was fetched or the
+// zero time if this cache has no observation.
+func (c *Cache) LastSuccess() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.fetchedAt
+}
+
 // Get returns the current observation in this cache. Clients can use the
 // returned channel to block until a new observation is available.
 func (c *Cache) Get() (*Observation, <-chan struct{}) {
@@ -210,27 +420,120 @@ func (c *Cache) Get() (*Observation, <-chan struct{}) {
 	return c.observation, c.stale
 }
 
+// GetFresh returns the current observation in this cache along with when
+// it was fetched. stale is true if the observation was fetched more than
+// maxAge ago or if this cache has no observation.
+func (c *Cache) GetFresh(maxAge time.Duration) (
+	observation *Observation, fetchedAt time.Time, stale bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.observation == nil {
+		return nil, time.Time{}, true
+	}
+	return c.observation,
+		c.fetchedAt,
+		c.clock.Now().Sub(c.fetchedAt) > maxAge
+}
+
 // Close frees resources associated with this cache.
 func (c *Cache) Close() error {
 	close(c.set(nil, nil))
 	return nil
 }
 
+// SetLocation sets the latitude and longitude that SunTimes uses.
+func (c *Cache) SetLocation(latitude, longitude float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.hasLocation = true
+	c.latitude = latitude
+	c.longitude = longitude
+	c.daylight = nil
+}
+
+// SunTimes returns today's sunrise, sunset, and civil twilight times in
+// the local timezone at the location given to SetLocation. SunTimes
+// returns nil if SetLocation was never called.
+func (c *Cache) SunTimes() *Daylight {
+	return c.sunTimes(time.Now())
+}
+
+func (c *Cache) sunTimes(now time.Time) *Daylight {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.hasLocation {
+		return nil
+	}
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	if c.daylight == nil || !c.daylightDay.Equal(today) {
+		c.daylight = SunTimes(c.latitude, c.longitude, today)
+		c.daylightDay = today
+	}
+	return c.daylight
+}
+
 func (c *Cache) set(
 	observation *Observation, stale chan struct{}) chan struct{} {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	c.observation = observation
+	c.lastError = nil
+	if observation != nil {
+		c.fetchedAt = c.clock.Now()
+		c.addToHistory(TimedObservation{
+			Observation: observation, FetchedAt: c.fetchedAt})
+	} else {
+		c.fetchedAt = time.Time{}
+	}
 	result := c.stale
 	c.stale = stale
 	return result
 }
 
-func getUrl(station string) *url.URL {
-	return &url.URL{
-		Scheme: "http",
-		Host:   "w1.weather.gov",
-		Path:   fmt.Sprintf("/xml/current_obs/%s.xml", station)}
+func (c *Cache) addToHistory(observation TimedObservation) {
+	if len(c.history) < kCacheHistorySize {
+		c.history = append(c.history, observation)
+		c.historyEnd = len(c.history) % kCacheHistorySize
+		return
+	}
+	c.history[c.historyEnd] = observation
+	c.historyEnd = (c.historyEnd + 1) % kCacheHistorySize
+}
+
+// doGet fetches u. If the response status is not 200, doGet closes the
+// response body and returns a *StatusError.
+func doGet(ctx context.Context, client *http.Client, u *url.URL) (
+	*http.Response, error) {
+	if client == nil {
+		client = kDefaultClient
+	}
+	request := &http.Request{
+		Method: "GET",
+		URL:    u,
+		Header: http.Header{"User-Agent": {kUserAgent}}}
+	resp, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{StatusCode: resp.StatusCode, URL: u.String()}
+	}
+	return resp, nil
+}
+
+func getUrl(baseUrl, station string) (*url.URL, error) {
+	if baseUrl == "" {
+		baseUrl = kNOAABaseUrl
+	}
+	result, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	result.Path = path.Join(
+		result.Path, fmt.Sprintf("/xml/current_obs/%s.xml", station))
+	return result, nil
 }
 
 func getPurpleAirUrl() *url.URL {
@@ -248,9 +551,34 @@ func getOpenWeatherUrl(apiKey string) *url.URL {
 	return http_util.AppendParams(base, "appid", apiKey)
 }
 
+// openWeatherParams returns the open weather query parameters for
+// location.
+func openWeatherParams(location string) []string {
+	location = strings.TrimSpace(location)
+	if _, err := strconv.ParseInt(location, 10, 64); err == nil {
+		return []string{"id", location}
+	}
+	if parts := strings.Split(location, ","); len(parts) == 2 {
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if latErr == nil && lonErr == nil {
+			return []string{
+				"lat", strconv.FormatFloat(lat, 'f', -1, 64),
+				"lon", strconv.FormatFloat(lon, 'f', -1, 64)}
+		}
+	}
+	return []string{"q", location}
+}
+
+type noaaObservation struct {
+	Observation
+	WindMPH float64 `xml:"wind_mph"`
+}
+
 type openWeatherObservation struct {
 	Weather []openWeatherWeather `json:"weather"`
 	Main    *openWeatherMain     `json:"main"`
+	Wind    *openWeatherWind     `json:"wind"`
 }
 
 type openWeatherWeather struct {
@@ -261,6 +589,10 @@ type openWeatherMain struct {
 	Temp float64 `json:"temp"`
 }
 
+type openWeatherWind struct {
+	Speed float64 `json:"speed"`
+}
+
 type purpleAirResponse struct {
 	Results []purpleAirStation `json:"results"`
 }
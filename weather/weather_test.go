@@ -1,9 +1,17 @@
 package weather_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/keep94/marvin/weather"
+	"github.com/keep94/tasks"
 	asserts "github.com/stretchr/testify/assert"
 )
 
@@ -56,3 +64,439 @@ func TestReportCache(t *testing.T) {
 	report, _ = cache.Get()
 	assert.Equal(35.0, report.Temperature)
 }
+
+func TestParseMETAR(t *testing.T) {
+	assertMETAR(
+		t,
+		"KNUQ 161756Z 32010KT 10SM FEW015 SCT200 22/12 A2999 RMK AO2",
+		22.0, "Partly Cloudy", 5.144)
+	assertMETAR(
+		t,
+		"KSFO 161756Z 28008KT 1 1/2SM -RA BR BKN004 OVC010 M02/M03 A3001",
+		-2.0, "Light Rain, Mist, Visibility 1.5 mi", 4.116)
+	assertMETAR(
+		t,
+		"KSJC 161756Z 00000KT 1/4SM FG VV001 10/10 A3002",
+		10.0, "Fog, Visibility 0.25 mi", 0.0)
+	assertMETAR(
+		t,
+		"KOAK 161756Z 27015G25KT 10SM +TSRA OVC030CB 18/16 A2990",
+		18.0, "Heavy Thunderstorm Rain", 7.717)
+	assertMETAR(
+		t,
+		"EGLL 161750Z 24004MPS 9999 NSC 15/08 Q1015",
+		15.0, "Fair", 4.0)
+	_, err := weather.ParseMETAR("KNUQ 161756Z 32010KT 10SM CLR A2999")
+	asserts.Error(t, err)
+}
+
+func TestSunTimes(t *testing.T) {
+	assert := asserts.New(t)
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skip("No timezone database")
+	}
+	// Mountain View, CA
+	daylight := weather.SunTimes(
+		37.39, -122.08, time.Date(2020, 6, 21, 8, 0, 0, 0, loc))
+	assertNear(t, time.Date(2020, 6, 21, 5, 18, 0, 0, loc), daylight.Dawn)
+	assertNear(t, time.Date(2020, 6, 21, 5, 48, 0, 0, loc), daylight.Sunrise)
+	assertNear(t, time.Date(2020, 6, 21, 20, 32, 0, 0, loc), daylight.Sunset)
+	assertNear(t, time.Date(2020, 6, 21, 21, 2, 0, 0, loc), daylight.Dusk)
+	assert.Equal(loc, daylight.Sunrise.Location())
+
+	// The sun never rises in Barrow, AK in late December
+	daylight = weather.SunTimes(
+		71.29, -156.79, time.Date(2020, 12, 21, 12, 0, 0, 0, time.UTC))
+	assert.Equal(daylight.Sunrise, daylight.Sunset)
+	assert.True(daylight.Dawn.Before(daylight.Dusk))
+}
+
+func TestCacheSunTimes(t *testing.T) {
+	assert := asserts.New(t)
+	cache := weather.NewCache()
+	defer cache.Close()
+	assert.Nil(cache.SunTimes())
+	cache.SetLocation(37.39, -122.08)
+	now := time.Now()
+	assert.Equal(weather.SunTimes(37.39, -122.08, now), cache.SunTimes())
+}
+
+func assertNear(t *testing.T, expected, actual time.Time) {
+	t.Helper()
+	diff := actual.Sub(expected)
+	if diff < -3*time.Minute || diff > 3*time.Minute {
+		t.Errorf("Expected about %v, got %v", expected, actual)
+	}
+}
+
+func TestPollTask(t *testing.T) {
+	assert := asserts.New(t)
+	cache := weather.NewCache()
+	defer cache.Close()
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 6, 21, 8, 0, 0, 0, time.UTC)}
+	start := clock.Current
+	var execution *tasks.Execution
+	var fetchTimes []time.Duration
+	fetch := func(
+		ctx context.Context, station string) (*weather.Observation, error) {
+		assert.Equal("KNUQ", station)
+		fetchTimes = append(fetchTimes, clock.Current.Sub(start))
+		count := len(fetchTimes)
+		if count == 8 {
+			execution.End()
+		}
+		if count == 1 || count == 7 {
+			return &weather.Observation{Temperature: float64(count)}, nil
+		}
+		return nil, errors.New("weather:Fetch failed")
+	}
+	pollTask := weather.NewPollTask(
+		weather.ProviderFunc(fetch), "KNUQ", 3*time.Minute, cache)
+	err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		execution = e
+		pollTask.Do(e)
+	}), clock)
+	assert.Error(err)
+	assert.Equal(
+		[]time.Duration{
+			0,
+			3 * time.Minute,
+			3*time.Minute + 30*time.Second,
+			4*time.Minute + 30*time.Second,
+			6*time.Minute + 30*time.Second,
+			9*time.Minute + 30*time.Second,
+			12*time.Minute + 30*time.Second,
+			15*time.Minute + 30*time.Second,
+		},
+		fetchTimes)
+	observation, _ := cache.Get()
+	assert.Equal(&weather.Observation{Temperature: 7.0}, observation)
+	assert.Error(cache.LastError())
+}
+
+func TestCacheGetFresh(t *testing.T) {
+	assert := asserts.New(t)
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 6, 21, 8, 0, 0, 0, time.UTC)}
+	cache := weather.NewCacheWithClock(clock)
+	defer cache.Close()
+	observation, fetchedAt, stale := cache.GetFresh(time.Hour)
+	assert.Nil(observation)
+	assert.True(fetchedAt.IsZero())
+	assert.True(stale)
+	cache.Set(&weather.Observation{Temperature: 30.0})
+	clock.Current = clock.Current.Add(time.Hour)
+	observation, fetchedAt, stale = cache.GetFresh(time.Hour)
+	assert.Equal(&weather.Observation{Temperature: 30.0}, observation)
+	assert.Equal(time.Date(2020, 6, 21, 8, 0, 0, 0, time.UTC), fetchedAt)
+	assert.False(stale)
+	clock.Current = clock.Current.Add(time.Second)
+	_, _, stale = cache.GetFresh(time.Hour)
+	assert.True(stale)
+}
+
+func TestAggregators(t *testing.T) {
+	assert := asserts.New(t)
+	var mutex sync.Mutex
+	var fetched []string
+	fetch := weather.ProviderFunc(func(
+		ctx context.Context, station string) (*weather.Observation, error) {
+		mutex.Lock()
+		fetched = append(fetched, station)
+		mutex.Unlock()
+		switch station {
+		case "KNUQ":
+			return &weather.Observation{Temperature: 20.0, Weather: "Fair"}, nil
+		case "KSJC":
+			return &weather.Observation{Temperature: 24.0, Weather: "Overcast"}, nil
+		default:
+			return nil, errors.New("weather:Station down")
+		}
+	})
+	ctx := context.Background()
+	observation, err := weather.FirstSuccess(
+		ctx, fetch, []string{"KPAO", "KSJC", "KNUQ"})
+	assert.NoError(err)
+	assert.Equal(
+		&weather.Observation{Temperature: 24.0, Weather: "Overcast"},
+		observation)
+	assert.Equal([]string{"KPAO", "KSJC"}, fetched)
+
+	observation, err = weather.Average(
+		ctx, fetch, []string{"KPAO", "KNUQ", "KSJC"})
+	assert.NoError(err)
+	assert.Equal(
+		&weather.Observation{Temperature: 22.0, Weather: "Fair"},
+		observation)
+
+	fetched = nil
+	nearest := weather.Nearest(
+		weather.Coordinates{Latitude: 37.36, Longitude: -121.95},
+		map[string]weather.Coordinates{
+			"KNUQ": {Latitude: 37.42, Longitude: -122.05},
+			"KSJC": {Latitude: 37.36, Longitude: -121.93},
+			"KPAO": {Latitude: 37.46, Longitude: -122.11},
+		})
+	observation, err = nearest(ctx, fetch, []string{"KOAK", "KNUQ", "KPAO", "KSJC"})
+	assert.NoError(err)
+	assert.Equal(
+		&weather.Observation{Temperature: 24.0, Weather: "Overcast"},
+		observation)
+	assert.Equal([]string{"KSJC"}, fetched)
+
+	_, err = weather.FirstSuccess(ctx, fetch, []string{"KPAO", "KOAK"})
+	assert.Error(err)
+	_, err = weather.Average(ctx, fetch, nil)
+	assert.Error(err)
+}
+
+func assertMETAR(
+	t *testing.T,
+	report string,
+	temperature float64,
+	conditions string,
+	windSpeed float64) {
+	t.Helper()
+	assert := asserts.New(t)
+	observation, err := weather.ParseMETAR(report)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(temperature, observation.Temperature)
+	assert.Equal(conditions, observation.Weather)
+	assert.InDelta(windSpeed, observation.WindSpeed, 0.001)
+	assert.Equal(weather.Metric, observation.Units)
+}
+
+func TestUnits(t *testing.T) {
+	assert := asserts.New(t)
+	assert.Equal(212.0, weather.CelsiusToFahrenheit(100.0))
+	assert.Equal(-40.0, weather.FahrenheitToCelsius(-40.0))
+	assert.InDelta(22.369, weather.MetersPerSecondToMPH(10.0), 0.001)
+	assert.InDelta(10.0, weather.MPHToMetersPerSecond(22.369), 0.001)
+	metric := &weather.Observation{
+		Temperature: 20.0, Weather: "Fair", WindSpeed: 10.0}
+	imperial := metric.In(weather.Imperial)
+	assert.Equal(weather.Imperial, imperial.Units)
+	assert.Equal(68.0, imperial.Temperature)
+	assert.InDelta(22.369, imperial.WindSpeed, 0.001)
+	assert.Equal("Fair", imperial.Weather)
+	assert.True(imperial == imperial.In(weather.Imperial))
+	back := imperial.In(weather.Metric)
+	assert.InDelta(20.0, back.Temperature, 0.001)
+	assert.InDelta(10.0, back.WindSpeed, 0.001)
+	assert.Equal(weather.Metric, metric.Units)
+	provider := weather.WithUnits(
+		weather.ProviderFunc(func(
+			ctx context.Context,
+			location string) (*weather.Observation, error) {
+			return metric, nil
+		}),
+		weather.Imperial)
+	observation, err := provider.Current(context.Background(), "KNUQ")
+	assert.NoError(err)
+	assert.Equal(68.0, observation.Temperature)
+}
+
+func TestPollTaskWithLog(t *testing.T) {
+	assert := asserts.New(t)
+	cache := weather.NewCache()
+	defer cache.Close()
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 6, 21, 8, 0, 0, 0, time.UTC)}
+	var execution *tasks.Execution
+	count := 0
+	provider := weather.ProviderFunc(func(
+		ctx context.Context, station string) (*weather.Observation, error) {
+		count++
+		if count == 2 {
+			execution.End()
+		}
+		return &weather.Observation{Temperature: float64(count)}, nil
+	})
+	var log fakeObservationLog
+	pollTask := weather.NewPollTaskWithLog(
+		provider, "KNUQ", time.Hour, cache, &log)
+	err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		execution = e
+		pollTask.Do(e)
+	}), clock)
+	assert.NoError(err)
+	assert.Equal(
+		[]string{
+			"KNUQ 1.0 2020-06-21T08:00:00Z",
+			"KNUQ 2.0 2020-06-21T09:00:00Z",
+		},
+		log.entries)
+}
+
+type fakeObservationLog struct {
+	entries []string
+}
+
+func (f *fakeObservationLog) LogObservation(
+	station string,
+	observation *weather.Observation,
+	fetchedAt time.Time) error {
+	f.entries = append(f.entries, fmt.Sprintf(
+		"%s %.1f %s",
+		station,
+		observation.Temperature,
+		fetchedAt.Format(time.RFC3339)))
+	return nil
+}
+
+func TestCacheErrors(t *testing.T) {
+	assert := asserts.New(t)
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 6, 21, 14, 2, 0, 0, time.UTC)}
+	cache := weather.NewCacheWithClock(clock)
+	defer cache.Close()
+	assert.NoError(cache.LastError())
+	assert.True(cache.LastSuccess().IsZero())
+	cache.Set(&weather.Observation{Temperature: 30.0})
+	clock.Current = clock.Current.Add(time.Hour)
+	fetchErr := errors.New("weather:Fetch failed")
+	cache.SetError(fetchErr)
+	assert.Equal(fetchErr, cache.LastError())
+	assert.Equal(
+		time.Date(2020, 6, 21, 14, 2, 0, 0, time.UTC), cache.LastSuccess())
+	observation, _ := cache.Get()
+	assert.Equal(&weather.Observation{Temperature: 30.0}, observation)
+	cache.Set(&weather.Observation{Temperature: 31.0})
+	assert.NoError(cache.LastError())
+	assert.Equal(
+		time.Date(2020, 6, 21, 15, 2, 0, 0, time.UTC), cache.LastSuccess())
+}
+
+func TestCacheHistory(t *testing.T) {
+	assert := asserts.New(t)
+	start := time.Date(2020, 6, 21, 14, 0, 0, 0, time.UTC)
+	clock := &tasks.ClockForTesting{Current: start}
+	cache := weather.NewCacheWithClock(clock)
+	defer cache.Close()
+	assert.Empty(cache.History(5))
+	for i := 0; i < 300; i++ {
+		cache.Set(&weather.Observation{Temperature: float64(i)})
+		clock.Current = clock.Current.Add(5 * time.Minute)
+	}
+	history := cache.History(3)
+	assert.Len(history, 3)
+	for i, observation := range history {
+		assert.Equal(float64(297+i), observation.Temperature)
+		assert.Equal(
+			start.Add(time.Duration(297+i)*5*time.Minute),
+			observation.FetchedAt)
+	}
+	history = cache.History(1000)
+	assert.Len(history, 288)
+	assert.Equal(12.0, history[0].Temperature)
+	assert.Equal(299.0, history[287].Temperature)
+	assert.Empty(cache.History(0))
+}
+
+func TestAlertPollTask(t *testing.T) {
+	assert := asserts.New(t)
+	cache := weather.NewCache()
+	defer cache.Close()
+	assert.Empty(cache.Alerts())
+	clock := &tasks.ClockForTesting{Current: time.Date(
+		2020, 6, 21, 8, 0, 0, 0, time.UTC)}
+	var execution *tasks.Execution
+	provider := alertProviderFunc(func(
+		ctx context.Context, zone string) ([]weather.Alert, error) {
+		assert.Equal("CAZ508", zone)
+		execution.End()
+		return []weather.Alert{{Event: "Tornado Warning"}}, nil
+	})
+	pollTask := weather.NewAlertPollTask(
+		provider, "CAZ508", time.Minute, cache)
+	err := tasks.RunForTesting(tasks.TaskFunc(func(e *tasks.Execution) {
+		execution = e
+		pollTask.Do(e)
+	}), clock)
+	assert.NoError(err)
+	assert.Equal([]weather.Alert{{Event: "Tornado Warning"}}, cache.Alerts())
+}
+
+type alertProviderFunc func(
+	ctx context.Context, zone string) ([]weather.Alert, error)
+
+func (f alertProviderFunc) Alerts(
+	ctx context.Context, zone string) ([]weather.Alert, error) {
+	return f(ctx, zone)
+}
+
+func TestNOAAProvider(t *testing.T) {
+	assert := asserts.New(t)
+	var path, userAgent string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			userAgent = r.Header.Get("User-Agent")
+			w.WriteHeader(status)
+			fmt.Fprint(w, `<current_observation><weather>Fair</weather><temp_c>21.5</temp_c><wind_mph>0.0</wind_mph></current_observation>`)
+		}))
+	defer server.Close()
+	provider := &weather.NOAAProvider{BaseURL: server.URL + "/proxy"}
+	observation, err := provider.Current(context.Background(), "KNUQ")
+	assert.NoError(err)
+	assert.Equal(
+		&weather.Observation{Temperature: 21.5, Weather: "Fair"},
+		observation)
+	assert.Equal("/proxy/xml/current_obs/KNUQ.xml", path)
+	assert.NotEmpty(userAgent)
+	status = http.StatusServiceUnavailable
+	_, err = provider.Current(context.Background(), "KNUQ")
+	var statusErr *weather.StatusError
+	if assert.True(errors.As(err, &statusErr)) {
+		assert.Equal(http.StatusServiceUnavailable, statusErr.StatusCode)
+	}
+}
+
+func TestDaylightFactor(t *testing.T) {
+	assert := asserts.New(t)
+	day := time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC)
+	sunTimes := &weather.Daylight{
+		Dawn:    day.Add(5 * time.Hour),
+		Sunrise: day.Add(6 * time.Hour),
+		Sunset:  day.Add(18 * time.Hour),
+		Dusk:    day.Add(19 * time.Hour),
+	}
+	assert.Equal(1.0, weather.DaylightFactor(day.Add(time.Hour), sunTimes, 0.0))
+	assert.Equal(
+		1.0, weather.DaylightFactor(day.Add(20*time.Hour), sunTimes, 0.0))
+	assert.InDelta(
+		0.25, weather.DaylightFactor(day.Add(12*time.Hour), sunTimes, 0.0),
+		0.001)
+	assert.InDelta(
+		0.925, weather.DaylightFactor(day.Add(6*time.Hour), sunTimes, 0.0),
+		0.001)
+	assert.InDelta(
+		0.9625,
+		weather.DaylightFactor(day.Add(5*time.Hour+30*time.Minute), sunTimes, 0.0),
+		0.001)
+	assert.InDelta(
+		0.9625,
+		weather.DaylightFactor(day.Add(18*time.Hour+30*time.Minute), sunTimes, 0.0),
+		0.001)
+	stormy := weather.DaylightFactor(day.Add(12*time.Hour), sunTimes, 1.0)
+	assert.InDelta(0.8125, stormy, 0.001)
+	partly := weather.DaylightFactor(
+		day.Add(12*time.Hour), sunTimes, weather.Cloudiness("Partly Cloudy"))
+	assert.True(partly > 0.25 && partly < stormy)
+}
+
+func TestCloudiness(t *testing.T) {
+	assert := asserts.New(t)
+	assert.Equal(0.0, weather.Cloudiness("Fair"))
+	assert.Equal(0.0, weather.Cloudiness("clear sky"))
+	assert.Equal(0.25, weather.Cloudiness("A Few Clouds"))
+	assert.Equal(0.5, weather.Cloudiness("Partly Cloudy"))
+	assert.Equal(0.75, weather.Cloudiness("broken clouds"))
+	assert.Equal(1.0, weather.Cloudiness("Light Rain, Mist"))
+	assert.Equal(1.0, weather.Cloudiness("Overcast"))
+}
@@ -0,0 +1,238 @@
+// Package weathertest provides a fake weather provider and a fake weather
+// server for testing code that depends on the weather package without
+// the network.
+package weathertest
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keep94/marvin/weather"
+)
+
+// Result is one scripted result from a FakeProvider.
+type Result struct {
+	Observation *weather.Observation
+	Err         error
+}
+
+// FakeProvider is a weather.Provider that returns scripted results.
+// FakeProvider instances are safe to use with multiple goroutines.
+type FakeProvider struct {
+	lock      sync.Mutex
+	results   []Result
+	locations []string
+}
+
+// NewFakeProvider returns a FakeProvider that returns results in order,
+// one for each call to Current. Once it runs out of results, the
+// returned provider keeps returning the last one. If results is empty,
+// the returned provider always returns an error.
+func NewFakeProvider(results ...Result) *FakeProvider {
+	return &FakeProvider{results: results}
+}
+
+// Current returns the next scripted result and records location. Current
+// returns ctx.Err() without consuming a result if ctx is done.
+func (f *FakeProvider) Current(
+	ctx context.Context, location string) (*weather.Observation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.locations = append(f.locations, location)
+	if len(f.results) == 0 {
+		return nil, errors.New(fmt.Sprintf(
+			"weathertest:No results for %s", location))
+	}
+	result := f.results[0]
+	if len(f.results) > 1 {
+		f.results = f.results[1:]
+	}
+	return result.Observation, result.Err
+}
+
+// Locations returns the locations passed to Current in order.
+func (f *FakeProvider) Locations() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	result := make([]string, len(f.locations))
+	copy(result, f.locations)
+	return result
+}
+
+// Server is a fake weather server that serves canned NOAA, open weather,
+// METAR, AirNow, EPA UV index, and NWS alert responses. Server instances are safe to use with multiple
+// goroutines.
+type Server struct {
+	server      *httptest.Server
+	serverUrl   *url.URL
+	lock        sync.Mutex
+	observation weather.Observation
+	metar       string
+	alerts      []weather.Alert
+	status      int
+}
+
+// NewServer starts a new fake weather server. Until Set or SetMETAR is
+// called, the server reports 20 degrees celsius and "Fair" weather.
+// Caller must call Close on the returned server when done with it.
+func NewServer() *Server {
+	result := &Server{
+		observation: weather.Observation{Temperature: 20.0, Weather: "Fair"},
+		metar:       "KNUQ 161756Z 00000KT 10SM CLR 20/10 A2999",
+		status:      http.StatusOK,
+	}
+	result.server = httptest.NewServer(http.HandlerFunc(result.serve))
+	result.serverUrl, _ = url.Parse(result.server.URL)
+	return result
+}
+
+// Client returns an HTTP client that sends every request to this server
+// regardless of host. Pass it to weather.GetWithContext,
+// weather.NOAAProvider, weather.METARProvider, or
+// weather.OpenWeatherConn.WithClient.
+func (s *Server) Client() *http.Client {
+	return &http.Client{Transport: roundTripperFunc(
+		func(r *http.Request) (*http.Response, error) {
+			redirected := r.Clone(r.Context())
+			redirected.URL.Scheme = s.serverUrl.Scheme
+			redirected.URL.Host = s.serverUrl.Host
+			redirected.Host = ""
+			return http.DefaultTransport.RoundTrip(redirected)
+		})}
+}
+
+// Set sets the observation that this server reports to NOAA, open
+// weather, AirNow, and EPA UV index clients. observation must use metric
+// units.
+func (s *Server) Set(observation *weather.Observation) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.observation = *observation
+}
+
+// SetMETAR sets the raw METAR report that this server serves.
+func (s *Server) SetMETAR(report string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.metar = report
+}
+
+// SetAlerts sets the alerts that this server serves to NWS alert
+// clients.
+func (s *Server) SetAlerts(alerts []weather.Alert) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.alerts = make([]weather.Alert, len(alerts))
+	copy(s.alerts, alerts)
+}
+
+// SetStatus makes this server fail every request with the given HTTP
+// status code. http.StatusOK restores normal responses.
+func (s *Server) SetStatus(status int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status = status
+}
+
+// Close shuts down this server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	observation := s.observation
+	metar := s.metar
+	alerts := s.alerts
+	status := s.status
+	s.lock.Unlock()
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/xml/current_obs/"):
+		w.Header().Set("Content-Type", "text/xml")
+		xml.NewEncoder(w).Encode(&noaaObservation{
+			Weather:     observation.Weather,
+			Temperature: observation.Temperature,
+			WindMPH:     weather.MetersPerSecondToMPH(observation.WindSpeed),
+		})
+	case r.URL.Path == "/data/2.5/weather":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(
+			w,
+			`{"weather":[{"description":%q}],"main":{"temp":%g},"wind":{"speed":%g}}`,
+			observation.Weather,
+			observation.Temperature+273.15,
+			observation.WindSpeed)
+	case strings.HasPrefix(r.URL.Path, "/aq/observation/"):
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(
+			w,
+			`[{"ParameterName":"O3","AQI":%d},{"ParameterName":"PM2.5","AQI":%d}]`,
+			observation.AQI/2,
+			observation.AQI)
+	case strings.HasPrefix(r.URL.Path, "/efservice/getEnvirofactsUVDAILY/"):
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"UV_INDEX":%g,"UV_ALERT":0}]`, observation.UVIndex)
+	case r.URL.Path == "/alerts/active":
+		w.Header().Set("Content-Type", "application/geo+json")
+		features := make([]nwsAlertFeature, len(alerts))
+		for i := range alerts {
+			features[i].Properties = nwsAlertProperties{
+				Id:       alerts[i].Id,
+				Event:    alerts[i].Event,
+				Severity: alerts[i].Severity,
+				Headline: alerts[i].Headline,
+				Onset:    alerts[i].Onset,
+				Expires:  alerts[i].Expires,
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type": "FeatureCollection", "features": features})
+	case r.URL.Path == "/api/data/metar":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, metar)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type noaaObservation struct {
+	XMLName     xml.Name `xml:"current_observation"`
+	Weather     string   `xml:"weather"`
+	Temperature float64  `xml:"temp_c"`
+	WindMPH     float64  `xml:"wind_mph"`
+}
+
+type nwsAlertFeature struct {
+	Properties nwsAlertProperties `json:"properties"`
+}
+
+type nwsAlertProperties struct {
+	Id       string    `json:"id"`
+	Event    string    `json:"event"`
+	Severity string    `json:"severity"`
+	Headline string    `json:"headline"`
+	Onset    time.Time `json:"onset"`
+	Expires  time.Time `json:"expires"`
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,107 @@
+package weathertest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/keep94/marvin/weather"
+	"github.com/keep94/marvin/weather/weathertest"
+	asserts "github.com/stretchr/testify/assert"
+)
+
+func TestFakeProvider(t *testing.T) {
+	assert := asserts.New(t)
+	fetchErr := errors.New("weathertest:Fetch failed")
+	provider := weathertest.NewFakeProvider(
+		weathertest.Result{Observation: &weather.Observation{Temperature: 1.0}},
+		weathertest.Result{Err: fetchErr})
+	ctx := context.Background()
+	observation, err := provider.Current(ctx, "KNUQ")
+	assert.NoError(err)
+	assert.Equal(1.0, observation.Temperature)
+	_, err = provider.Current(ctx, "KSJC")
+	assert.Equal(fetchErr, err)
+	_, err = provider.Current(ctx, "KNUQ")
+	assert.Equal(fetchErr, err)
+	assert.Equal([]string{"KNUQ", "KSJC", "KNUQ"}, provider.Locations())
+	_, err = weathertest.NewFakeProvider().Current(ctx, "KNUQ")
+	assert.Error(err)
+}
+
+func TestServer(t *testing.T) {
+	assert := asserts.New(t)
+	server := weathertest.NewServer()
+	defer server.Close()
+	server.Set(&weather.Observation{
+		Temperature: 12.0, Weather: "Overcast", WindSpeed: 4.0})
+	server.SetMETAR("KNUQ 161756Z 32010KT 10SM SCT200 22/12 A2999")
+	ctx := context.Background()
+	client := server.Client()
+
+	observation, err := (&weather.NOAAProvider{Client: client}).Current(
+		ctx, "KNUQ")
+	assert.NoError(err)
+	assert.Equal(12.0, observation.Temperature)
+	assert.Equal("Overcast", observation.Weather)
+	assert.InDelta(4.0, observation.WindSpeed, 0.001)
+
+	conn := weather.NewOpenWeatherConn("key").WithClient(client)
+	observation, err = (&weather.OpenWeatherProvider{Conn: conn}).Current(
+		ctx, "5375480")
+	assert.NoError(err)
+	assert.InDelta(12.0, observation.Temperature, 0.001)
+	assert.Equal("Overcast", observation.Weather)
+
+	observation, err = (&weather.METARProvider{Client: client}).Current(
+		ctx, "KNUQ")
+	assert.NoError(err)
+	assert.Equal(22.0, observation.Temperature)
+	assert.Equal("Partly Cloudy", observation.Weather)
+
+	server.Set(&weather.Observation{AQI: 162, UVIndex: 7.0})
+	observation, err = (&weather.AirNowProvider{
+		APIKey: "key", Client: client}).Current(ctx, "94043")
+	assert.NoError(err)
+	assert.Equal(162, observation.AQI)
+	observation, err = (&weather.EPAUVProvider{Client: client}).Current(
+		ctx, "94043")
+	assert.NoError(err)
+	assert.Equal(7.0, observation.UVIndex)
+
+	server.SetStatus(http.StatusServiceUnavailable)
+	_, err = (&weather.METARProvider{Client: client}).Current(ctx, "KNUQ")
+	assert.Error(err)
+	_, err = (&weather.AirNowProvider{Client: client}).Current(ctx, "94043")
+	assert.Error(err)
+}
+
+func TestServerAlerts(t *testing.T) {
+	assert := asserts.New(t)
+	server := weathertest.NewServer()
+	defer server.Close()
+	tornado := weather.Alert{
+		Id:       "urn:1",
+		Event:    "Tornado Warning",
+		Severity: "Extreme",
+		Headline: "Tornado Warning until 3:00 PM",
+		Onset:    time.Date(2020, 6, 21, 14, 0, 0, 0, time.UTC),
+		Expires:  time.Date(2020, 6, 21, 15, 0, 0, 0, time.UTC),
+	}
+	flood := weather.Alert{
+		Id:       "urn:2",
+		Event:    "Flood Watch",
+		Severity: "Moderate",
+		Onset:    time.Date(2020, 6, 21, 12, 0, 0, 0, time.UTC),
+		Expires:  time.Date(2020, 6, 22, 12, 0, 0, 0, time.UTC),
+	}
+	server.SetAlerts([]weather.Alert{tornado, flood})
+	provider := &weather.NWSAlertProvider{Client: server.Client()}
+	alerts, err := provider.Alerts(context.Background(), "CAZ508")
+	assert.NoError(err)
+	assert.Equal([]weather.Alert{tornado, flood}, alerts)
+	assert.True(alerts[0].IsWarning())
+	assert.False(alerts[1].IsWarning())
+}